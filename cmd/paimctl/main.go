@@ -0,0 +1,307 @@
+// Command paimctl is a command-line client for a PAIM server.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/client"
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+const usage = `usage: paimctl [--addr URL] [--api-key KEY] [--namespace NS] [--json] <command> [args]
+
+commands:
+  remember [--source S] [--session ID] [text]
+                                 store text (read from stdin when omitted)
+  ask [-k N] [query]             recall context; empty query lists recent memories
+  facts list [filters]           list stored facts
+  logs list [--limit N] [--meta K=V]
+                                 list the latest raw logs
+  consolidate                    distill the sensory buffer now
+  export [-o file]               write an export document (stdout by default)
+  import [file]                  load an export document (stdin by default)
+  reindex [--resume]             re-embed every log in the background
+  reindex status                 show progress of the latest reindex
+`
+
+type app struct {
+	c       *client.Client
+	jsonOut bool
+	out     io.Writer
+}
+
+func main() {
+	global := flag.NewFlagSet("paimctl", flag.ExitOnError)
+	global.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	addr := global.String("addr", getenv("PAIM_ADDR", "http://localhost:8080"), "server address")
+	apiKey := global.String("api-key", os.Getenv("PAIM_API_KEY"), "API key")
+	namespace := global.String("namespace", os.Getenv("PAIM_NAMESPACE"), "namespace to work in (server default when empty)")
+	jsonOut := global.Bool("json", false, "print raw JSON")
+	global.Parse(os.Args[1:])
+
+	args := global.Args()
+	if len(args) == 0 {
+		global.Usage()
+		os.Exit(2)
+	}
+	a := &app{c: client.New(*addr, *apiKey, client.WithNamespace(*namespace)), jsonOut: *jsonOut, out: os.Stdout}
+	if err := a.run(context.Background(), args[0], args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "paimctl:", err)
+		os.Exit(1)
+	}
+}
+
+func (a *app) run(ctx context.Context, cmd string, args []string) error {
+	switch cmd {
+	case "remember":
+		return a.remember(ctx, args)
+	case "ask":
+		return a.ask(ctx, args)
+	case "facts":
+		if len(args) == 0 || args[0] != "list" {
+			return errors.New("usage: paimctl facts list [filters]")
+		}
+		return a.factsList(ctx, args[1:])
+	case "logs":
+		if len(args) == 0 || args[0] != "list" {
+			return errors.New("usage: paimctl logs list [--limit N]")
+		}
+		return a.logsList(ctx, args[1:])
+	case "consolidate":
+		if err := a.c.Consolidate(ctx); err != nil {
+			return err
+		}
+		fmt.Fprintln(a.out, "ok")
+		return nil
+	case "export":
+		return a.export(ctx, args)
+	case "import":
+		return a.importDoc(ctx, args)
+	case "reindex":
+		return a.reindex(ctx, args)
+	default:
+		return fmt.Errorf("unknown command %q\n%s", cmd, usage)
+	}
+}
+
+func (a *app) remember(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("remember", flag.ExitOnError)
+	source := fs.String("source", "paimctl", "source label")
+	session := fs.String("session", "", "conversation the text belongs to")
+	fs.Parse(args)
+
+	text := strings.Join(fs.Args(), " ")
+	if text == "" {
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		text = string(b)
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return errors.New("nothing to remember")
+	}
+	res, err := a.c.Remember(ctx, model.SensoryInput{Content: text, Source: *source, SessionID: *session})
+	if err != nil {
+		return err
+	}
+	if res.Duplicate {
+		fmt.Fprintf(a.out, "%s (duplicate, similarity %.3f)\n", res.LogID, res.Similarity)
+		return nil
+	}
+	fmt.Fprintln(a.out, res.LogID)
+	return nil
+}
+
+func (a *app) ask(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("ask", flag.ExitOnError)
+	k := fs.Int("k", 0, "number of results (server default when 0)")
+	fs.Parse(args)
+
+	res, err := a.c.Ask(ctx, strings.Join(fs.Args(), " "), client.WithTopK(*k))
+	if err != nil {
+		return err
+	}
+	if a.jsonOut {
+		return a.printJSON(res)
+	}
+	tw := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tSCORE\tTEXT")
+	for _, item := range res.Ranked {
+		var text string
+		switch {
+		case item.Log != nil:
+			text = oneLine(item.Log.Content)
+		case item.Fact != nil:
+			text = fmt.Sprintf("%s %s %s", item.Fact.Subject, item.Fact.Predicate, item.Fact.Object)
+		}
+		fmt.Fprintf(tw, "%s\t%.3f\t%s\n", item.Kind, item.Score, text)
+	}
+	return tw.Flush()
+}
+
+func (a *app) factsList(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("facts list", flag.ExitOnError)
+	var q client.FactsQuery
+	fs.StringVar(&q.Subject, "subject", "", "subject filter")
+	fs.StringVar(&q.Predicate, "predicate", "", "predicate filter")
+	fs.StringVar(&q.Object, "object", "", "object filter")
+	fs.Float64Var(&q.MinConfidence, "min-confidence", 0, "minimum confidence")
+	fs.IntVar(&q.Limit, "limit", 0, "page size")
+	fs.Int64Var(&q.Cursor, "cursor", 0, "cursor from a previous page")
+	fs.Parse(args)
+
+	page, err := a.c.ListFacts(ctx, q)
+	if err != nil {
+		return err
+	}
+	if a.jsonOut {
+		return a.printJSON(page)
+	}
+	tw := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSUBJECT\tPREDICATE\tOBJECT\tCONFIDENCE")
+	for _, f := range page.Facts {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%.2f\n", f.ID, f.Subject, f.Predicate, f.Object, f.Confidence)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if page.NextCursor != 0 {
+		fmt.Fprintf(a.out, "\n%d more; next page: --cursor %d\n", page.Remaining, page.NextCursor)
+	}
+	return nil
+}
+
+func (a *app) logsList(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("logs list", flag.ExitOnError)
+	limit := fs.Int("limit", 0, "number of logs (server default when 0)")
+	meta := map[string]string{}
+	fs.Func("meta", "metadata filter key=value (repeatable; dotted keys are nested)", func(v string) error {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok {
+			return errors.New("want key=value")
+		}
+		meta[key] = value
+		return nil
+	})
+	fs.Parse(args)
+
+	logs, err := a.c.LogsByMetadata(ctx, meta, *limit)
+	if err != nil {
+		return err
+	}
+	if a.jsonOut {
+		return a.printJSON(logs)
+	}
+	tw := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIMESTAMP\tSOURCE\tCONTENT")
+	for _, l := range logs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", l.Timestamp.Local().Format(time.DateTime), l.SourceType, oneLine(l.Content))
+	}
+	return tw.Flush()
+}
+
+func (a *app) export(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	out := fs.String("o", "", "output file (stdout when empty)")
+	fs.Parse(args)
+
+	if *out == "" {
+		return a.c.Export(ctx, a.out)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := a.c.Export(ctx, f); err != nil {
+		f.Close()
+		os.Remove(*out)
+		return err
+	}
+	return f.Close()
+}
+
+func (a *app) importDoc(ctx context.Context, args []string) error {
+	var r io.Reader = os.Stdin
+	if len(args) > 0 && args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	report, err := a.c.Import(ctx, r)
+	if err != nil {
+		return err
+	}
+	if a.jsonOut {
+		return a.printJSON(report)
+	}
+	fmt.Fprintf(a.out, "imported %d logs, %d facts\n", report.Logs, report.Facts)
+	return nil
+}
+
+func (a *app) reindex(ctx context.Context, args []string) error {
+	var st *client.ReindexStatus
+	var err error
+	if len(args) > 0 && args[0] == "status" {
+		st, err = a.c.ReindexStatus(ctx)
+	} else {
+		fs := flag.NewFlagSet("reindex", flag.ExitOnError)
+		resume := fs.Bool("resume", false, "only drain what an interrupted run left queued")
+		fs.Parse(args)
+		st, err = a.c.Reindex(ctx, *resume)
+	}
+	if err != nil {
+		return err
+	}
+	if a.jsonOut {
+		return a.printJSON(st)
+	}
+	p := st.Progress
+	switch {
+	case st.Running:
+		fmt.Fprintf(a.out, "running: %d/%d embedded, %d failed\n", p.Embedded, p.Queued, p.Failed)
+	case st.StartedAt == nil:
+		fmt.Fprintln(a.out, "no reindex has run")
+	case st.Error != "":
+		fmt.Fprintf(a.out, "failed: %s (%d/%d embedded)\n", st.Error, p.Embedded, p.Queued)
+	default:
+		fmt.Fprintf(a.out, "done: %d/%d embedded, %d failed, %d still queued, %.1fs\n",
+			p.Embedded, p.Queued, p.Failed, p.Remaining, p.DurationSeconds)
+	}
+	return nil
+}
+
+func (a *app) printJSON(v any) error {
+	enc := json.NewEncoder(a.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// oneLine flattens content for table output and truncates long entries.
+func oneLine(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > 80 {
+		return string(r[:77]) + "..."
+	}
+	return s
+}
+
+func getenv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
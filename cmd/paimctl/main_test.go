@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/client"
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// fakeServer answers paimctl's requests with canned replies, after
+// checking the API key and namespace, and records the requests it saw as
+// "METHOD /path?query".
+func fakeServer(t *testing.T) (*httptest.Server, *[]string) {
+	t.Helper()
+	var seen []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/remember", func(w http.ResponseWriter, r *http.Request) {
+		var in model.SensoryInput
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.Content == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":{"code":"invalid_input","message":"content is required"}}`)
+			return
+		}
+		if in.Content == "again" {
+			json.NewEncoder(w).Encode(model.ObserveResult{LogID: "log-1", Duplicate: true, Similarity: 0.9876})
+			return
+		}
+		json.NewEncoder(w).Encode(model.ObserveResult{LogID: "log-1:" + in.Source + ":" + in.Content})
+	})
+	mux.HandleFunc("/ask", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"ranked":[
+            {"kind":"fact","score":0.9,"fact":{"subject":"alice","predicate":"works_at","object":"acme"}},
+            {"kind":"log","score":0.5,"log":{"content":"Alice   works\nat Acme."}}
+        ]}`)
+	})
+	mux.HandleFunc("/facts", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"facts":[{"id":7,"subject":"alice","predicate":"works_at","object":"acme","confidence":0.8}],"next_cursor":7,"remaining":3}`)
+	})
+	mux.HandleFunc("/logs", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"logs":[{"id":"l1","content":"hello","source_type":"chat","timestamp":"2026-06-01T12:00:00Z"}]}`)
+	})
+	mux.HandleFunc("/consolidate", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"status":"ok"}`)
+	})
+	mux.HandleFunc("/export", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"version":1}`)
+	})
+	mux.HandleFunc("/import", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		if string(b) != `{"version":1}` {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, `{"logs":2,"facts":5}`)
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" || r.Header.Get("X-PAIM-Namespace") != "work" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"error":{"code":"unauthorized","message":"bad key"}}`)
+			return
+		}
+		seen = append(seen, r.Method+" "+r.URL.RequestURI())
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &seen
+}
+
+func newTestApp(t *testing.T, jsonOut bool) (*app, *bytes.Buffer, *[]string) {
+	t.Helper()
+	srv, seen := fakeServer(t)
+	var out bytes.Buffer
+	c := client.New(srv.URL, "key", client.WithNamespace("work"))
+	return &app{c: c, jsonOut: jsonOut, out: &out}, &out, seen
+}
+
+func TestCommands(t *testing.T) {
+	dir := t.TempDir()
+	doc := filepath.Join(dir, "export.json")
+	for _, tt := range []struct {
+		name string
+		args []string
+		json bool
+		// request is the request the command must send; out lines the
+		// output must contain.
+		request string
+		out     []string
+	}{
+		{"remember", []string{"remember", "--source", "cli", "Alice", "works", "at", "Acme."}, false,
+			"POST /remember", []string{"log-1:cli:Alice works at Acme."}},
+		{"remember duplicate", []string{"remember", "again"}, false,
+			"POST /remember", []string{"log-1 (duplicate, similarity 0.988)"}},
+		{"ask", []string{"ask", "-k", "3", "where", "does", "alice", "work"}, false,
+			"GET /ask?k=3&q=where+does+alice+work", []string{"KIND", "fact  0.900  alice works_at acme", "log   0.500  Alice works at Acme."}},
+		{"facts list", []string{"facts", "list", "--subject", "alice", "--limit", "1"}, false,
+			"GET /facts?limit=1&subject=alice", []string{"7   alice", "3 more; next page: --cursor 7"}},
+		{"facts list json", []string{"facts", "list"}, true,
+			"GET /facts", []string{`"next_cursor": 7`}},
+		{"logs list", []string{"logs", "list", "--limit", "5", "--meta", "user.id=42"}, false,
+			"GET /logs?limit=5&meta.user.id=42", []string{"chat", "hello"}},
+		{"consolidate", []string{"consolidate"}, false, "POST /consolidate", []string{"ok"}},
+		{"export", []string{"export", "-o", doc}, false, "GET /export", nil},
+		{"import", []string{"import", doc}, false, "POST /import", []string{"imported 2 logs, 5 facts"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			a, out, seen := newTestApp(t, tt.json)
+			if err := a.run(context.Background(), tt.args[0], tt.args[1:]); err != nil {
+				t.Fatal(err)
+			}
+			if len(*seen) != 1 || (*seen)[0] != tt.request {
+				t.Errorf("requests = %q, want %q", *seen, tt.request)
+			}
+			for _, want := range tt.out {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output missing %q:\n%s", want, out)
+				}
+			}
+		})
+	}
+	if b, err := os.ReadFile(doc); err != nil || string(b) != `{"version":1}` {
+		t.Errorf("export file = %q, %v", b, err)
+	}
+}
+
+func TestCommandErrors(t *testing.T) {
+	srv, seen := fakeServer(t)
+	a := &app{c: client.New(srv.URL, "key", client.WithNamespace("work")), out: io.Discard}
+	ctx := context.Background()
+	for _, args := range [][]string{{"bogus"}, {"facts"}, {"logs", "tail"}} {
+		if err := a.run(ctx, args[0], args[1:]); err == nil {
+			t.Errorf("paimctl %q succeeded", args)
+		}
+	}
+	if len(*seen) != 0 {
+		t.Errorf("usage errors sent requests: %q", *seen)
+	}
+
+	a.c = client.New(srv.URL, "wrong", client.WithNamespace("work"))
+	err := a.run(ctx, "consolidate", nil)
+	if !errors.Is(err, client.ErrUnauthorized) {
+		t.Fatalf("consolidate with a bad key = %v, want ErrUnauthorized", err)
+	}
+}
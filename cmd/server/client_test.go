@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/client"
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+)
+
+// TestClient runs pkg/client against the real handlers so the two stay in
+// sync.
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig(t)
+	cfg.APIKey = "s3cret"
+	srv, _ := newTestServer(t, cfg, store.Options{})
+	c := client.New(srv.URL, "s3cret", client.WithNamespace("work"))
+
+	one, err := c.Remember(ctx, model.SensoryInput{Content: "Alice works at Acme.", Metadata: map[string]any{"room": "A"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if one.LogID == "" || one.Duplicate {
+		t.Errorf("Remember = %+v", one)
+	}
+	batch, err := c.RememberBatch(ctx, []model.SensoryInput{{Content: "Bob lives in Berlin."}, {Content: "Carol likes tea."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batch) != 2 || batch[0].LogID == "" || batch[1].LogID == "" {
+		t.Errorf("RememberBatch = %+v", batch)
+	}
+	if err := c.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := c.Ask(ctx, "Alice", client.WithTopK(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.RelatedFacts) == 0 || res.RelatedFacts[0].Subject != "alice" || res.RelatedFacts[0].Namespace != "work" {
+		t.Errorf("Ask facts = %+v, want alice's fact in work", res.RelatedFacts)
+	}
+	logs, err := c.LogsByMetadata(ctx, map[string]string{"room": "A"}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || logs[0].ID != one.LogID {
+		t.Errorf("LogsByMetadata = %+v, want the Alice log", logs)
+	}
+	page, err := c.ListFacts(ctx, client.FactsQuery{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Facts) != 3 {
+		t.Errorf("ListFacts = %d facts, want 3", len(page.Facts))
+	}
+	st, err := c.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Logs != 3 {
+		t.Errorf("Stats logs = %d, want 3", st.Logs)
+	}
+
+	// another namespace sees none of it
+	home, err := client.New(srv.URL, "s3cret").Ask(ctx, "Alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(home.RelatedFacts) != 0 {
+		t.Errorf("default namespace facts = %+v, want none", home.RelatedFacts)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig(t)
+	cfg.APIKey = "s3cret"
+	srv, _ := newTestServer(t, cfg, store.Options{})
+	c := client.New(srv.URL, "s3cret")
+
+	_, err := c.Remember(ctx, model.SensoryInput{Content: " "})
+	var apiErr *client.APIError
+	if !errors.Is(err, client.ErrInvalidInput) || !errors.As(err, &apiErr) || apiErr.Status != 400 || apiErr.Message == "" {
+		t.Errorf("empty content: %v, want a 400 invalid_input APIError", err)
+	}
+	if _, err := client.New(srv.URL, "wrong").Stats(ctx); !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("wrong key: %v, want ErrUnauthorized", err)
+	}
+	if _, err := client.New(srv.URL, "s3cret", client.WithNamespace("bad namespace!")).Stats(ctx); !errors.Is(err, client.ErrInvalidInput) {
+		t.Errorf("malformed namespace: %v, want ErrInvalidInput", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := c.Stats(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled context: %v, want context.Canceled", err)
+	}
+}
+
+func TestConsolidationHistory(t *testing.T) {
+	ctx := context.Background()
+	srv, engine := newTestServer(t, testConfig(t), store.Options{})
+	c := client.New(srv.URL, "")
+	if runs, err := c.ConsolidationRuns(ctx, 0); err != nil || len(runs) != 0 {
+		t.Fatalf("ConsolidationRuns of a new server = %+v, %v", runs, err)
+	}
+	for _, content := range []string{"Alice works at Acme.", "Bob lives in Berlin."} {
+		if err := engine.Observe(ctx, model.SensoryInput{Content: content}); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Consolidate(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runs, err := c.ConsolidationRuns(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].ID <= runs[1].ID || runs[0].Inputs != 1 || runs[0].TriplesWritten != 1 || runs[0].Error != "" {
+		t.Fatalf("ConsolidationRuns = %+v, want both runs, latest first", runs)
+	}
+	if latest, err := c.ConsolidationRuns(ctx, 1); err != nil || len(latest) != 1 || latest[0].ID != runs[0].ID {
+		t.Errorf("ConsolidationRuns(1) = %+v, %v; want the latest run", latest, err)
+	}
+	st, err := c.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.LastConsolidationRun == nil || st.LastConsolidationRun.ID != runs[0].ID {
+		t.Errorf("Stats.LastConsolidationRun = %+v, want run %d", st.LastConsolidationRun, runs[0].ID)
+	}
+	for _, bad := range []string{"0", "-1", "many"} {
+		var e errorBody
+		if status := do(t, "GET", srv.URL+"/consolidations?limit="+bad, "", &e); status != http.StatusBadRequest || e.Error.Code != codeInvalidInput {
+			t.Errorf("/consolidations?limit=%s = %d %+v, want 400 invalid_input", bad, status, e)
+		}
+	}
+}
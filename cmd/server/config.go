@@ -0,0 +1,430 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/johncui/PAIM/pkg/engine/embed"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/postgres"
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+)
+
+type config struct {
+	ListenAddr         string
+	GRPCAddr           string
+	DBPath             string
+	EnableVSS          bool
+	VectorBackend      string
+	ExtensionsPath     string
+	VectorDim          int
+	MigrateDim         bool
+	VSSRequired        bool
+	BufferSize         int
+	BufferTTL          time.Duration
+	BufferDedup        string
+	ConsolidationEvery time.Duration
+	SyncEmbedding      bool
+	StoreEmbeddings    bool
+	EmbedWorkers       int
+	Distiller          string
+	UserEntity         string
+	LLMEndpoint        string
+	LLMAPIKey          string
+	LLMModel           string
+	LLMBatchSize       int
+	LLMTimeout         time.Duration
+	RulesFile          string
+	BackupDir          string
+	MaxTopK            int
+	APIKey             string
+	LogRetention       time.Duration
+	MaxLogs            int
+	MaxBodyBytes       int
+	MaxContentChars    int
+	TruncateContent    bool
+	ReadConns          int
+	RequestTimeout     time.Duration
+	LogFormat          string
+	LogLevel           string
+	OTelEnabled        bool
+	HTTPStats          bool
+	CORSOrigins        string
+	MCPNamespace       string
+	NeighborExpansion  int
+	MinConfidence      float64
+	ReinforceFacts     bool
+	ReinforceStep      float64
+	ReinforceCap       float64
+	// ConsolidateFillRatio triggers consolidation at this buffer fill level,
+	// at most once per ConsolidateMinInterval.
+	ConsolidateFillRatio   float64
+	ConsolidateMinInterval time.Duration
+	// ConsolidationHistory is how many consolidation runs the database
+	// keeps; ConsolidationFailureWarn how many failed runs in a row the
+	// loop warns about.
+	ConsolidationHistory     int
+	ConsolidationFailureWarn int
+
+	// FactPruneAge, FactPruneConfidence and FactPrunePredicate select the
+	// facts the consolidation loop prunes.
+	FactPruneAge        time.Duration
+	FactPruneConfidence float64
+	FactPrunePredicate  string
+
+	Summarizer      string
+	SummarizeAge    time.Duration
+	SummarizeDelete bool
+	DedupThreshold  float64
+	RecencyHalfLife time.Duration
+
+	// EmbedderEndpoint, when set, embeds with a remote embeddings endpoint
+	// instead of the built-in HashEmbedder; with EmbedderFallback the hash
+	// embedder stands in while the endpoint fails.
+	EmbedderEndpoint string
+	EmbedderAPIKey   string
+	EmbedderModel    string
+	EmbedderTimeout  time.Duration
+	EmbedderFallback bool
+	EmbedderCooldown time.Duration
+	// EmbedderMaxAttempts bounds the calls per text when the endpoint
+	// answers 429, 5xx or not at all.
+	EmbedderMaxAttempts int
+
+	// EmbedTimeout bounds each embedder call made by the engine; the
+	// breaker skips embedding after EmbedBreakerThreshold consecutive
+	// failures, for EmbedBreakerCooldown.
+	EmbedTimeout          time.Duration
+	EmbedBreakerThreshold int
+	EmbedBreakerCooldown  time.Duration
+
+	// MaintenanceInterval schedules WAL checkpoints and PRAGMA optimize;
+	// the WAL is truncated once it exceeds CheckpointWALBytes.
+	MaintenanceInterval time.Duration
+	CheckpointWALBytes  int
+
+	// ReadOnly serves the database without writing to it.
+	ReadOnly bool
+
+	// DBKey, or the contents of DBKeyFile, encrypts the database.
+	DBKey     string
+	DBKeyFile string
+
+	// Redact lists the categories of personal data removed from inputs
+	// before they are stored: "all", or some of email, phone and card.
+	Redact string
+
+	// UniqueContentSources is a comma-separated list of the sources stored
+	// exactly once by content.
+	UniqueContentSources string
+	// FunctionalPredicates is a comma-separated list of the single-valued
+	// predicates; ContradictionPolicy is "supersede" or "delete".
+	FunctionalPredicates string
+	ContradictionPolicy  string
+}
+
+// loadConfig reads the optional YAML file at path and overlays environment
+// variables on top of it. Each setting has a file key such as buffer_ttl and
+// an env var PAIM_<KEY> (buffer_ttl -> PAIM_BUFFER_TTL); an env var that is set
+// and non-empty wins over the file, which wins over the default. Malformed
+// values fail with the offending key named. File keys that match no setting
+// are returned as unknown so the caller can warn about them.
+func loadConfig(path string) (cfg config, unknown []string, err error) {
+	src := &configSource{env: os.Getenv}
+	if path != "" {
+		if src.file, err = readConfigFile(path); err != nil {
+			return config{}, nil, err
+		}
+	}
+
+	cfg = config{
+		ListenAddr:         src.str("listen_addr", ":8080"),
+		GRPCAddr:           src.str("grpc_addr", ""),
+		DBPath:             src.str("db_path", "paim.db"),
+		EnableVSS:          src.boolean("enable_vss", false),
+		VectorBackend:      src.str("vector_backend", "vss"),
+		ExtensionsPath:     src.strEnv("extensions_path", "GO_SQLITE3_EXTENSIONS", ""),
+		VectorDim:          src.integer("vector_dim", 1536),
+		MigrateDim:         src.boolean("migrate_dim", false),
+		VSSRequired:        src.boolean("vss_required", false),
+		BufferSize:         src.integer("buffer_size", 128),
+		BufferTTL:          src.duration("buffer_ttl", 30*time.Minute),
+		BufferDedup:        src.str("buffer_dedup", "off"),
+		ConsolidationEvery: src.duration("consolidation_every", 5*time.Minute),
+		SyncEmbedding:      src.boolean("sync_embedding", false),
+		StoreEmbeddings:    src.boolean("store_embeddings", false),
+		EmbedWorkers:       src.integer("embed_workers", 2),
+		Distiller:          src.str("distiller", "heuristic"),
+		UserEntity:         src.str("user_entity", "user"),
+		LLMEndpoint:        src.str("llm_endpoint", ""),
+		LLMAPIKey:          src.str("llm_api_key", ""),
+		LLMModel:           src.str("llm_model", ""),
+		LLMBatchSize:       src.integer("llm_batch_size", 20),
+		LLMTimeout:         src.duration("llm_timeout", 60*time.Second),
+		RulesFile:          src.str("rules_file", ""),
+		BackupDir:          src.str("backup_dir", "backups"),
+		MaxTopK:            src.integer("max_top_k", store.DefaultMaxTopK),
+		APIKey:             src.str("api_key", ""),
+		LogRetention:       src.duration("log_retention", 0),
+		MaxLogs:            src.integer("max_logs", 0),
+		MaxBodyBytes:       src.integer("max_body_bytes", 1<<20),
+		MaxContentChars:    src.integer("max_content_chars", store.DefaultMaxContentChars),
+		TruncateContent:    src.boolean("truncate_content", false),
+		ReadConns:          src.integer("read_conns", 4),
+		RequestTimeout:     src.duration("request_timeout", 15*time.Second),
+		LogFormat:          src.str("log_format", "text"),
+		LogLevel:           src.str("log_level", "info"),
+		OTelEnabled:        src.boolean("otel_enabled", false),
+		HTTPStats:          src.boolean("http_stats", false),
+		CORSOrigins:        src.str("cors_origins", ""),
+		MCPNamespace:       src.str("mcp_namespace", ""),
+		NeighborExpansion:  src.integer("neighbor_expansion", store.DefaultNeighborExpansion),
+		MinConfidence:      src.number("min_confidence", 0),
+		ReinforceFacts:     src.boolean("reinforce_facts", false),
+		ReinforceStep:      src.number("reinforce_step", store.DefaultReinforceStep),
+		ReinforceCap:       src.number("reinforce_cap", store.DefaultReinforceCap),
+
+		ConsolidateFillRatio:     src.number("consolidate_fill_ratio", store.DefaultConsolidateFillRatio),
+		ConsolidateMinInterval:   src.duration("consolidate_min_interval", 0),
+		ConsolidationHistory:     src.integer("consolidation_history", store.DefaultConsolidationHistory),
+		ConsolidationFailureWarn: src.integer("consolidation_failure_warn", 3),
+
+		FactPruneAge:        src.duration("fact_prune_age", 0),
+		FactPruneConfidence: src.number("fact_prune_confidence", store.DefaultFactPruneConfidence),
+		FactPrunePredicate:  src.str("fact_prune_predicate", ""),
+
+		Summarizer:      src.str("summarizer", "none"),
+		SummarizeAge:    src.duration("summarize_age", 0),
+		SummarizeDelete: src.boolean("summarize_delete", false),
+		DedupThreshold:  src.number("dedup_threshold", 0),
+		RecencyHalfLife: src.duration("recency_half_life", 0),
+
+		EmbedderEndpoint: src.str("embedder_endpoint", ""),
+		EmbedderAPIKey:   src.str("embedder_api_key", ""),
+		EmbedderModel:    src.str("embedder_model", ""),
+		EmbedderTimeout:  src.duration("embedder_timeout", 30*time.Second),
+		EmbedderFallback: src.boolean("embedder_fallback", false),
+		EmbedderCooldown: src.duration("embedder_cooldown", embed.DefaultCooldown),
+
+		EmbedderMaxAttempts: src.integer("embedder_max_attempts", embed.DefaultRetryPolicy().MaxAttempts),
+
+		EmbedTimeout:          src.duration("embed_timeout", 0),
+		EmbedBreakerThreshold: src.integer("embed_breaker_threshold", store.DefaultEmbedBreakerThreshold),
+		EmbedBreakerCooldown:  src.duration("embed_breaker_cooldown", store.DefaultEmbedBreakerCooldown),
+
+		MaintenanceInterval: src.duration("maintenance_interval", sqlite.DefaultMaintenanceInterval),
+		CheckpointWALBytes:  src.integer("checkpoint_wal_bytes", sqlite.DefaultCheckpointWALBytes),
+
+		ReadOnly: src.boolean("read_only", false),
+
+		DBKey:     src.str("db_key", ""),
+		DBKeyFile: src.str("db_key_file", ""),
+
+		Redact: src.str("redact", "none"),
+
+		UniqueContentSources: src.str("unique_content_sources", ""),
+		FunctionalPredicates: src.str("functional_predicates", ""),
+		ContradictionPolicy:  src.str("contradiction_policy", "supersede"),
+	}
+	if len(src.errs) > 0 {
+		return config{}, nil, errors.Join(src.errs...)
+	}
+	return cfg, src.unknownKeys(), nil
+}
+
+// dbKey returns the database encryption key: PAIM_DB_KEY, or the contents of
+// PAIM_DB_KEY_FILE without surrounding whitespace. Setting both is an error.
+func (c config) dbKey() (string, error) {
+	if c.DBKeyFile == "" {
+		return c.DBKey, nil
+	}
+	if c.DBKey != "" {
+		return "", errors.New("db_key and db_key_file are both set")
+	}
+	data, err := os.ReadFile(c.DBKeyFile)
+	if err != nil {
+		return "", fmt.Errorf("db_key_file: %w", err)
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", fmt.Errorf("db_key_file: %s is empty", c.DBKeyFile)
+	}
+	return key, nil
+}
+
+// dbForLog returns DBPath for log lines: the password of a PostgreSQL URL,
+// in its user info or its password parameter, is masked.
+func (c config) dbForLog() string {
+	if !postgres.IsDSN(c.DBPath) {
+		return c.DBPath
+	}
+	u, err := url.Parse(c.DBPath)
+	if err != nil {
+		return "postgres://(unparsable URL)"
+	}
+	if q := u.Query(); q.Has("password") {
+		q.Set("password", "xxxxx")
+		u.RawQuery = q.Encode()
+	}
+	return u.Redacted()
+}
+
+// corsOrigins splits CORSOrigins, dropping blank entries.
+func (c config) corsOrigins() []string {
+	return splitList(c.CORSOrigins)
+}
+
+// uniqueContentSources splits UniqueContentSources, dropping blank entries.
+func (c config) uniqueContentSources() []string {
+	return splitList(c.UniqueContentSources)
+}
+
+// functionalPredicates splits FunctionalPredicates, dropping blank entries.
+func (c config) functionalPredicates() []string {
+	return splitList(c.FunctionalPredicates)
+}
+
+// splitList splits a comma-separated setting, dropping blank entries.
+func splitList(v string) []string {
+	var items []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			items = append(items, s)
+		}
+	}
+	return items
+}
+
+// readConfigFile parses a flat YAML mapping of scalar values.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	var raw map[string]yaml.Node
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	out := make(map[string]string, len(raw))
+	for k, n := range raw {
+		if n.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("config %s: %s must be a scalar value", path, k)
+		}
+		if n.Tag == "!!null" {
+			continue
+		}
+		out[k] = n.Value
+	}
+	return out, nil
+}
+
+// configSource resolves settings from the environment and the config file,
+// collecting parse errors instead of falling back to defaults.
+type configSource struct {
+	env  func(string) string
+	file map[string]string
+	used map[string]bool
+	errs []error
+}
+
+// lookup returns the raw value for key and a name for error messages.
+func (s *configSource) lookup(key, envKey string) (value, origin string, ok bool) {
+	if s.used == nil {
+		s.used = make(map[string]bool)
+	}
+	s.used[key] = true
+	if v := s.env(envKey); v != "" {
+		return v, envKey, true
+	}
+	if v, ok := s.file[key]; ok {
+		return v, "config key " + key, true
+	}
+	return "", "", false
+}
+
+func envName(key string) string {
+	return "PAIM_" + strings.ToUpper(key)
+}
+
+func (s *configSource) str(key, def string) string {
+	return s.strEnv(key, envName(key), def)
+}
+
+func (s *configSource) strEnv(key, envKey, def string) string {
+	if v, _, ok := s.lookup(key, envKey); ok {
+		return v
+	}
+	return def
+}
+
+func (s *configSource) boolean(key string, def bool) bool {
+	v, origin, ok := s.lookup(key, envName(key))
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s: invalid boolean %q", origin, v))
+		return def
+	}
+	return b
+}
+
+func (s *configSource) integer(key string, def int) int {
+	v, origin, ok := s.lookup(key, envName(key))
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s: invalid integer %q", origin, v))
+		return def
+	}
+	return n
+}
+
+func (s *configSource) number(key string, def float64) float64 {
+	v, origin, ok := s.lookup(key, envName(key))
+	if !ok {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s: invalid number %q", origin, v))
+		return def
+	}
+	return f
+}
+
+func (s *configSource) duration(key string, def time.Duration) time.Duration {
+	v, origin, ok := s.lookup(key, envName(key))
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s: invalid duration %q", origin, v))
+		return def
+	}
+	return d
+}
+
+// unknownKeys lists file keys that no setting looked up, sorted.
+func (s *configSource) unknownKeys() []string {
+	var out []string
+	for k := range s.file {
+		if !s.used[k] {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
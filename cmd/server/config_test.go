@@ -0,0 +1,224 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/engine/embed"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+)
+
+func writeConfig(t *testing.T, yaml string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "paim.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		want func(config) bool
+	}{
+		{"default", "", nil, func(c config) bool { return c.BufferTTL == 30*time.Minute && c.ListenAddr == ":8080" }},
+		{"file over default", "buffer_ttl: 10m\nlisten_addr: :9000\n", nil,
+			func(c config) bool { return c.BufferTTL == 10*time.Minute && c.ListenAddr == ":9000" }},
+		{"env over file", "buffer_ttl: 10m\n", map[string]string{"PAIM_BUFFER_TTL": "1h"},
+			func(c config) bool { return c.BufferTTL == time.Hour }},
+		{"empty env falls through to file", "buffer_size: 7\n", map[string]string{"PAIM_BUFFER_SIZE": ""},
+			func(c config) bool { return c.BufferSize == 7 }},
+		{"env without file", "", map[string]string{"PAIM_ENABLE_VSS": "true"},
+			func(c config) bool { return c.EnableVSS }},
+		{"custom env name", "extensions_path: /a\n", map[string]string{"GO_SQLITE3_EXTENSIONS": "/b"},
+			func(c config) bool { return c.ExtensionsPath == "/b" }},
+		{"null value keeps the default", "buffer_size: ~\n", nil, func(c config) bool { return c.BufferSize == 128 }},
+		{"numbers", "min_confidence: 0.25\nmax_top_k: 9\n", nil,
+			func(c config) bool { return c.MinConfidence == 0.25 && c.MaxTopK == 9 }},
+		{"recency half-life", "", map[string]string{"PAIM_RECENCY_HALF_LIFE": "72h"},
+			func(c config) bool { return c.RecencyHalfLife == 72*time.Hour }},
+		{"embedder defaults", "", nil,
+			func(c config) bool {
+				return c.EmbedderTimeout == 30*time.Second && c.EmbedderCooldown == embed.DefaultCooldown && !c.EmbedderFallback && c.EmbedderMaxAttempts == 3
+			}},
+		{"embedder fallback", "embedder_endpoint: http://embed.local\nembedder_cooldown: 1m\n", map[string]string{"PAIM_EMBEDDER_FALLBACK": "true"},
+			func(c config) bool {
+				return c.EmbedderEndpoint == "http://embed.local" && c.EmbedderFallback && c.EmbedderCooldown == time.Minute
+			}},
+		{"embedder attempts", "", map[string]string{"PAIM_EMBEDDER_MAX_ATTEMPTS": "5"},
+			func(c config) bool { return c.EmbedderMaxAttempts == 5 }},
+		{"consolidation interval", "consolidate_min_interval: 30s\n", nil,
+			func(c config) bool { return c.ConsolidateMinInterval == 30*time.Second }},
+		{"functional predicates", "functional_predicates: lives_in, prefers_*\n", map[string]string{"PAIM_CONTRADICTION_POLICY": "delete"},
+			func(c config) bool {
+				return slices.Equal(c.functionalPredicates(), []string{"lives_in", "prefers_*"}) && c.ContradictionPolicy == "delete"
+			}},
+		{"contradiction policy default", "", nil, func(c config) bool { return c.ContradictionPolicy == "supersede" && c.functionalPredicates() == nil }},
+		{"unique content sources", "unique_content_sources: bookmark, ,feed\n", nil,
+			func(c config) bool { return slices.Equal(c.uniqueContentSources(), []string{"bookmark", "feed"}) }},
+		{"redact", "redact: email, card\n", nil,
+			func(c config) bool { return c.Redact == "email, card" }},
+		{"read-only", "", map[string]string{"PAIM_READ_ONLY": "true"},
+			func(c config) bool { return c.ReadOnly }},
+		{"maintenance defaults", "", nil,
+			func(c config) bool {
+				return c.MaintenanceInterval == sqlite.DefaultMaintenanceInterval && c.CheckpointWALBytes == sqlite.DefaultCheckpointWALBytes
+			}},
+		{"maintenance", "maintenance_interval: -1s\n", map[string]string{"PAIM_CHECKPOINT_WAL_BYTES": "1048576"},
+			func(c config) bool { return c.MaintenanceInterval == -time.Second && c.CheckpointWALBytes == 1<<20 }},
+		{"embed breaker defaults", "", nil,
+			func(c config) bool {
+				return c.EmbedTimeout == 0 && c.EmbedBreakerThreshold == store.DefaultEmbedBreakerThreshold && c.EmbedBreakerCooldown == store.DefaultEmbedBreakerCooldown
+			}},
+		{"consolidation history defaults", "", nil,
+			func(c config) bool {
+				return c.ConsolidationHistory == store.DefaultConsolidationHistory && c.ConsolidationFailureWarn == 3
+			}},
+		{"consolidation history", "consolidation_history: 10\n", map[string]string{"PAIM_CONSOLIDATION_FAILURE_WARN": "0"},
+			func(c config) bool { return c.ConsolidationHistory == 10 && c.ConsolidationFailureWarn == 0 }},
+		{"vss optional by default", "enable_vss: true\n", nil, func(c config) bool { return c.EnableVSS && !c.VSSRequired }},
+		{"vss required", "", map[string]string{"PAIM_VSS_REQUIRED": "true"}, func(c config) bool { return c.VSSRequired }},
+		{"http stats", "", map[string]string{"PAIM_HTTP_STATS": "true"}, func(c config) bool { return c.HTTPStats }},
+		{"cors origins", "cors_origins: http://localhost:5173\n", map[string]string{"PAIM_CORS_ORIGINS": "*, ,https://ui.example"},
+			func(c config) bool { return slices.Equal(c.corsOrigins(), []string{"*", "https://ui.example"}) }},
+		{"embed breaker", "embed_timeout: 2s\nembed_breaker_cooldown: 1m\n", map[string]string{"PAIM_EMBED_BREAKER_THRESHOLD": "-1"},
+			func(c config) bool {
+				return c.EmbedTimeout == 2*time.Second && c.EmbedBreakerThreshold == -1 && c.EmbedBreakerCooldown == time.Minute
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			path := ""
+			if tt.file != "" {
+				path = writeConfig(t, tt.file)
+			}
+			cfg, unknown, err := loadConfig(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(unknown) != 0 {
+				t.Errorf("unknown keys %q", unknown)
+			}
+			if !tt.want(cfg) {
+				t.Errorf("config = %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestConfigUnknownKeys(t *testing.T) {
+	_, unknown, err := loadConfig(writeConfig(t, "buffer_size: 3\nbufer_ttl: 1m\nzzz: x\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(unknown, []string{"bufer_ttl", "zzz"}) {
+		t.Fatalf("unknown = %q, want the misspelled keys", unknown)
+	}
+}
+
+func TestConfigErrorsNameTheKey(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		want []string
+	}{
+		{"file duration", "buffer_ttl: soon\n", nil, []string{"config key buffer_ttl", `"soon"`}},
+		{"env bool", "", map[string]string{"PAIM_ENABLE_VSS": "maybe"}, []string{"PAIM_ENABLE_VSS"}},
+		{"every bad key", "buffer_size: many\nmin_confidence: high\n", nil,
+			[]string{"config key buffer_size", "config key min_confidence"}},
+		{"not a scalar", "buffer_size: [1, 2]\n", nil, []string{"buffer_size must be a scalar"}},
+		{"not yaml", "buffer_size: [\n", nil, []string{"parse config"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			path := ""
+			if tt.file != "" {
+				path = writeConfig(t, tt.file)
+			}
+			_, _, err := loadConfig(path)
+			if err == nil {
+				t.Fatal("loadConfig succeeded")
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(err.Error(), w) {
+					t.Errorf("error %q does not mention %s", err, w)
+				}
+			}
+		})
+	}
+	if _, _, err := loadConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("loadConfig of a missing file succeeded")
+	}
+}
+
+func TestDBKey(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	if err := os.WriteFile(keyFile, []byte("  s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	blank := filepath.Join(dir, "blank")
+	if err := os.WriteFile(blank, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		cfg  config
+		want string
+		err  string
+	}{
+		{"none", config{}, "", ""},
+		{"inline", config{DBKey: "inline"}, "inline", ""},
+		{"file", config{DBKeyFile: keyFile}, "s3cret", ""},
+		{"both", config{DBKey: "inline", DBKeyFile: keyFile}, "", "both set"},
+		{"missing file", config{DBKeyFile: filepath.Join(dir, "missing")}, "", "db_key_file"},
+		{"empty file", config{DBKeyFile: blank}, "", "is empty"},
+	}
+	for _, tt := range tests {
+		key, err := tt.cfg.dbKey()
+		if tt.err == "" && (err != nil || key != tt.want) {
+			t.Errorf("%s: dbKey = %q, %v; want %q", tt.name, key, err, tt.want)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: dbKey error %v, want one mentioning %s", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestDBForLog(t *testing.T) {
+	for path, want := range map[string]string{
+		"paim.db":                                  "paim.db",
+		"postgres://paim:s3cret@db:5432/paim":      "postgres://paim:xxxxx@db:5432/paim",
+		"postgresql://db/paim?password=s3cret&x=1": "postgresql://db/paim?password=xxxxx&x=1",
+		"postgres://paim@db/paim?sslmode=require":  "postgres://paim@db/paim?sslmode=require",
+	} {
+		if got := (config{DBPath: path}).dbForLog(); got != want {
+			t.Errorf("dbForLog(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestExampleConfigLoads(t *testing.T) {
+	_, unknown, err := loadConfig(filepath.Join("..", "..", "paim.example.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unknown) != 0 {
+		t.Fatalf("paim.example.yaml has unknown keys %q", unknown)
+	}
+}
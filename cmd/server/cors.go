@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// corsAllowMethods are the methods the API routes use.
+	corsAllowMethods = "GET, HEAD, POST, PATCH, DELETE"
+	// corsAllowHeaders are the request headers the API reads; Idempotency-Key
+	// is accepted for clients that send it with writes.
+	corsAllowHeaders = "Authorization, Content-Type, " + namespaceHeader + ", Idempotency-Key, Last-Event-ID"
+	// corsExposeHeaders are the response headers scripts may read.
+	corsExposeHeaders = "Content-Disposition"
+	// corsMaxAge is how long browsers may cache a preflight answer.
+	corsMaxAge = 600
+)
+
+// cors answers cross-origin requests from origins, whose entries are
+// scheme://host[:port] origins or "*" for any. Preflight requests are
+// answered here, before authentication, since browsers send them without
+// credentials: 204 with the allowed methods and headers, or 403 for an
+// origin not listed. Other requests from a listed origin get
+// Access-Control-Allow-Origin; those from other origins are served without
+// it, so the browser withholds the response.
+func cors(origins []string) func(http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(origins))
+	anyOrigin := false
+	for _, o := range origins {
+		if o == "*" {
+			anyOrigin = true
+		}
+		allowed[normalizeOrigin(o)] = true
+	}
+	allow := func(origin string) (string, bool) {
+		switch {
+		case anyOrigin:
+			return "*", true
+		case allowed[normalizeOrigin(origin)]:
+			return origin, true
+		}
+		return "", false
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			origin := req.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, req)
+				return
+			}
+			h := w.Header()
+			if !anyOrigin {
+				h.Add("Vary", "Origin")
+			}
+			value, ok := allow(origin)
+			if req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != "" {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+				if !ok {
+					writeError(w, http.StatusForbidden, codeForbidden, "origin not allowed")
+					return
+				}
+				h.Set("Access-Control-Allow-Origin", value)
+				h.Set("Access-Control-Allow-Methods", corsAllowMethods)
+				h.Set("Access-Control-Allow-Headers", corsAllowHeaders)
+				h.Set("Access-Control-Max-Age", strconv.Itoa(corsMaxAge))
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			if ok {
+				h.Set("Access-Control-Allow-Origin", value)
+				h.Set("Access-Control-Expose-Headers", corsExposeHeaders)
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// normalizeOrigin lowercases an origin and drops a trailing slash, as
+// browsers send origins in that form.
+func normalizeOrigin(origin string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/store"
+)
+
+func TestCORS(t *testing.T) {
+	served := false
+	h := cors([]string{"http://localhost:5173", "HTTPS://UI.example/"})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		served = true
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(method, origin string, preflight bool) *httptest.ResponseRecorder {
+		t.Helper()
+		served = false
+		req := httptest.NewRequest(method, "/ask?q=x", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if preflight {
+			req.Header.Set("Access-Control-Request-Method", "POST")
+			req.Header.Set("Access-Control-Request-Headers", "authorization, x-paim-namespace")
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(http.MethodOptions, "https://ui.example", true)
+	hdr := rec.Header()
+	if rec.Code != http.StatusNoContent || served {
+		t.Errorf("allowed preflight = %d (served %v), want 204 answered by the middleware", rec.Code, served)
+	}
+	if hdr.Get("Access-Control-Allow-Origin") != "https://ui.example" || hdr.Get("Access-Control-Allow-Methods") != corsAllowMethods ||
+		hdr.Get("Access-Control-Allow-Headers") != corsAllowHeaders || hdr.Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("allowed preflight headers = %v", hdr)
+	}
+	for _, v := range []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"} {
+		if !slices.Contains(hdr.Values("Vary"), v) {
+			t.Errorf("preflight Vary = %q, want %s", hdr.Values("Vary"), v)
+		}
+	}
+
+	rec = serve(http.MethodOptions, "http://evil.example", true)
+	var e errorBody
+	if err := json.Unmarshal(rec.Body.Bytes(), &e); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusForbidden || e.Error.Code != codeForbidden || served || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("disallowed preflight = %d %s (served %v, headers %v), want 403 forbidden", rec.Code, rec.Body, served, rec.Header())
+	}
+
+	rec = serve(http.MethodGet, "http://localhost:5173", false)
+	if !served || rec.Header().Get("Access-Control-Allow-Origin") != "http://localhost:5173" || rec.Header().Get("Access-Control-Expose-Headers") != corsExposeHeaders {
+		t.Errorf("allowed request = served %v, headers %v", served, rec.Header())
+	}
+	rec = serve(http.MethodGet, "http://evil.example", false)
+	if !served || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("disallowed request = served %v, headers %v, want served without CORS headers", served, rec.Header())
+	}
+	rec = serve(http.MethodGet, "", false)
+	if !served || len(rec.Header()) != 0 {
+		t.Errorf("same-origin request = served %v, headers %v, want no CORS headers", served, rec.Header())
+	}
+	// an OPTIONS request without Access-Control-Request-Method is no preflight
+	if serve(http.MethodOptions, "http://localhost:5173", false); !served {
+		t.Error("plain OPTIONS request was answered as a preflight")
+	}
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	h := cors([]string{"*"})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/facts", nil)
+	req.Header.Set("Origin", "http://anything.example")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Header().Get("Access-Control-Allow-Origin") != "*" || rec.Header().Get("Vary") != "" {
+		t.Errorf("headers = %v, want * without Vary", rec.Header())
+	}
+}
+
+func TestCORSOnTheServer(t *testing.T) {
+	preflight := func(url string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodOptions, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Origin", "http://localhost:5173")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	cfg := testConfig(t)
+	cfg.APIKey = "s3cret"
+	cfg.CORSOrigins = "http://localhost:5173, https://ui.example"
+	srv, _ := newTestServer(t, cfg, store.Options{})
+	if resp := preflight(srv.URL + "/remember"); resp.StatusCode != http.StatusNoContent || resp.Header.Get("Access-Control-Allow-Origin") != "http://localhost:5173" {
+		t.Errorf("preflight without credentials = %d %v, want 204 before authentication", resp.StatusCode, resp.Header)
+	}
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/stats", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Origin", "https://ui.example")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("Access-Control-Allow-Origin") != "https://ui.example" {
+		t.Errorf("request without the key = %d %v, want a 401 the page can read", resp.StatusCode, resp.Header)
+	}
+
+	srv, _ = newTestServer(t, testConfig(t), store.Options{})
+	if resp := preflight(srv.URL + "/remember"); resp.StatusCode == http.StatusNoContent || resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("preflight with CORS disabled = %d %v, want no CORS answer", resp.StatusCode, resp.Header)
+	}
+}
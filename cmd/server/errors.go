@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/johncui/PAIM/pkg/store"
+)
+
+// Error codes carried in the "code" field of error responses.
+const (
+	codeInvalidInput = "invalid_input"
+	codeNotFound     = "not_found"
+	codeConflict     = "conflict"
+	codeReadOnly     = "read_only"
+	codeUnauthorized = "unauthorized"
+	codeForbidden    = "forbidden"
+	codeInternal     = "internal"
+	codeUnavailable  = "unavailable"
+	codeTimeout      = "timeout"
+)
+
+type errorBody struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeError sends {"error": {"code": ..., "message": ...}} with status.
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorBody{Error: errorDetail{Code: code, Message: msg}})
+}
+
+// writeEngineError maps an error from MemoryEngine to a response. Messages of
+// invalid-input and not-found errors are written out since they describe the
+// request; anything else is logged and replaced by a generic message so
+// database internals are not echoed to clients.
+func writeEngineError(w http.ResponseWriter, req *http.Request, logger *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, store.ErrInvalidInput):
+		writeError(w, http.StatusBadRequest, codeInvalidInput, err.Error())
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, codeNotFound, err.Error())
+	case errors.Is(err, store.ErrConflict):
+		writeError(w, http.StatusConflict, codeConflict, err.Error())
+	case errors.Is(err, store.ErrReadOnly):
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, codeReadOnly, "the server is read-only")
+	case errors.Is(err, context.DeadlineExceeded):
+		logger.Warn("request timed out", "path", req.URL.Path, "request_id", middleware.GetReqID(req.Context()), "err", err)
+		writeError(w, http.StatusGatewayTimeout, codeTimeout, "request timed out")
+	case store.IsUnavailable(err):
+		logger.Warn("request failed", "path", req.URL.Path, "request_id", middleware.GetReqID(req.Context()), "err", err)
+		writeError(w, http.StatusServiceUnavailable, codeUnavailable, "temporarily unavailable, retry later")
+	default:
+		logger.Error("request failed", "path", req.URL.Path, "request_id", middleware.GetReqID(req.Context()), "err", err)
+		writeError(w, http.StatusInternalServerError, codeInternal, "internal error")
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/johncui/PAIM/pkg/store"
+)
+
+func TestWriteEngineError(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		code    string
+		message string // "" when the message must not echo err
+	}{
+		{"invalid input", fmt.Errorf("%w: content is empty", store.ErrInvalidInput), http.StatusBadRequest, codeInvalidInput, "invalid input: content is empty"},
+		{"not found", fmt.Errorf("fact 9: %w", store.ErrNotFound), http.StatusNotFound, codeNotFound, "fact 9: not found"},
+		{"conflict", fmt.Errorf("%w: log exists", store.ErrConflict), http.StatusConflict, codeConflict, "conflict: log exists"},
+		{"read-only", store.ErrReadOnly, http.StatusMethodNotAllowed, codeReadOnly, "the server is read-only"},
+		{"timeout", fmt.Errorf("query: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, codeTimeout, ""},
+		{"busy", fmt.Errorf("insert log: %w", sqlite3.Error{Code: sqlite3.ErrBusy}), http.StatusServiceUnavailable, codeUnavailable, ""},
+		{"sql", fmt.Errorf("get fact: %w", sql.ErrNoRows), http.StatusInternalServerError, codeInternal, ""},
+		{"driver", errors.New(`near "SELEC": syntax error in SELECT * FROM triples`), http.StatusInternalServerError, codeInternal, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeEngineError(rec, httptest.NewRequest("GET", "/facts/9", nil), logger, tt.err)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			var body map[string]map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %q: %v", rec.Body, err)
+			}
+			detail := body["error"]
+			if len(body) != 1 || len(detail) != 2 || detail["code"] != tt.code || detail["message"] == "" {
+				t.Fatalf("body = %s, want {\"error\": {\"code\": %q, \"message\": ...}}", rec.Body, tt.code)
+			}
+			switch {
+			case tt.message != "" && detail["message"] != tt.message:
+				t.Errorf("message = %q, want %q", detail["message"], tt.message)
+			case tt.message == "" && (strings.Contains(detail["message"], tt.err.Error()) ||
+				strings.Contains(strings.ToLower(detail["message"]), "sql")):
+				t.Errorf("message %q echoes the internal error", detail["message"])
+			}
+		})
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	srv, _ := newTestServer(t, testConfig(t), store.Options{})
+	for _, tt := range []struct {
+		method, path, body string
+		status             int
+		code               string
+	}{
+		{"GET", "/facts/12345", "", http.StatusNotFound, codeNotFound},
+		{"GET", "/facts/abc", "", http.StatusBadRequest, codeInvalidInput},
+		{"GET", "/logs/00000000-0000-4000-8000-000000000000", "", http.StatusNotFound, codeNotFound},
+		{"GET", "/logs/nope", "", http.StatusBadRequest, codeInvalidInput},
+		{"POST", "/remember", `{"content":""}`, http.StatusBadRequest, codeInvalidInput},
+		{"POST", "/remember", `{"content":`, http.StatusBadRequest, codeInvalidInput},
+		{"GET", "/ask?q=x&match=fuzzy", "", http.StatusBadRequest, codeInvalidInput},
+		{"GET", "/facts?subject=x&match=fuzzy", "", http.StatusBadRequest, codeInvalidInput},
+		{"GET", "/ask?q=x&k_facts=0", "", http.StatusBadRequest, codeInvalidInput},
+		{"GET", "/ask?q=x&k_logs=many", "", http.StatusBadRequest, codeInvalidInput},
+		{"GET", "/ask?q=x&recency_halflife=soon", "", http.StatusBadRequest, codeInvalidInput},
+		{"GET", "/ask?q=x&recency_halflife=-1h", "", http.StatusBadRequest, codeInvalidInput},
+		{"POST", "/facts/prune", `{"max_age":"soon","max_confidence":0.5}`, http.StatusBadRequest, codeInvalidInput},
+		{"POST", "/facts/prune", `{"max_age":"720h"}`, http.StatusBadRequest, codeInvalidInput},
+	} {
+		var out errorBody
+		status := do(t, tt.method, srv.URL+tt.path, tt.body, &out)
+		if status != tt.status || out.Error.Code != tt.code || out.Error.Message == "" {
+			t.Errorf("%s %s = %d %+v, want %d %s", tt.method, tt.path, status, out, tt.status, tt.code)
+		}
+		if strings.Contains(out.Error.Message, "sql") {
+			t.Errorf("%s %s leaks %q", tt.method, tt.path, out.Error.Message)
+		}
+	}
+}
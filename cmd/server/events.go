@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/store"
+)
+
+// eventsHeartbeat is how often an idle event stream sends a comment line so
+// proxies do not close it.
+const eventsHeartbeat = 15 * time.Second
+
+// lastEventID reads the Last-Event-ID header a reconnecting EventSource
+// sends; ok is false when it is missing or not an event id.
+func lastEventID(req *http.Request) (id uint64, ok bool) {
+	v := req.Header.Get("Last-Event-ID")
+	if v == "" {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(v, 10, 64)
+	return id, err == nil
+}
+
+// streamEvents writes events as server-sent events until the channel closes
+// or the client goes away (which cancels the subscription's context).
+func streamEvents(w http.ResponseWriter, events <-chan store.Event) error {
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return err
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return nil
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data); err != nil {
+				return err
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return err
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return err
+		}
+	}
+}
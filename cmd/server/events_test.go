@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+)
+
+// eventStream reads server-sent events from GET /events.
+type eventStream struct {
+	t  *testing.T
+	sc *bufio.Scanner
+}
+
+func openEvents(t *testing.T, u string, header http.Header) *eventStream {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("GET /events: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return &eventStream{t: t, sc: bufio.NewScanner(resp.Body)}
+}
+
+// next returns the id, type and payload of the next event.
+func (s *eventStream) next() (id, typ string, ev store.Event) {
+	s.t.Helper()
+	for s.sc.Scan() {
+		line := s.sc.Text()
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			typ = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev); err != nil {
+				s.t.Fatal(err)
+			}
+		case line == "" && id != "":
+			return id, typ, ev
+		}
+	}
+	s.t.Fatalf("event stream ended: %v", s.sc.Err())
+	return "", "", ev
+}
+
+func TestEventStream(t *testing.T) {
+	srv, _ := newTestServer(t, testConfig(t), store.Options{})
+	stream := openEvents(t, srv.URL+"/events?namespace=work", nil)
+
+	for _, ns := range []string{"home", "work"} {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/remember", strings.NewReader(`{"content":"Alice works at Acme."}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(namespaceHeader, ns)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("remember in %s: %d", ns, resp.StatusCode)
+		}
+	}
+
+	id, typ, ev := stream.next()
+	if typ != string(store.EventMemoryObserved) || ev.Namespace != "work" || ev.Log == nil || ev.Log.Content != "Alice works at Acme." {
+		t.Errorf("event %s %s %+v, want the work log only", id, typ, ev)
+	}
+	if id != strconv.FormatUint(ev.ID, 10) {
+		t.Errorf("id line %s, payload id %d", id, ev.ID)
+	}
+}
+
+func TestEventStreamResumes(t *testing.T) {
+	srv, engine := newTestServer(t, testConfig(t), store.Options{})
+	observe := func(content string) {
+		if err := engine.Observe(context.Background(), model.SensoryInput{Content: content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	observe("first")
+	observe("second")
+
+	stream := openEvents(t, srv.URL+"/events", http.Header{"Last-Event-Id": {"1"}})
+	if _, _, ev := stream.next(); ev.Log.Content != "second" {
+		t.Errorf("resumed at %q, want second", ev.Log.Content)
+	}
+	observe("third")
+	if _, _, ev := stream.next(); ev.Log.Content != "third" {
+		t.Errorf("next live event %q, want third", ev.Log.Content)
+	}
+}
+
+func TestLastEventID(t *testing.T) {
+	for v, want := range map[string]bool{"": false, "7": true, "x": false, "-1": false} {
+		req := httptest.NewRequest(http.MethodGet, "/events", nil)
+		if v != "" {
+			req.Header.Set("Last-Event-ID", v)
+		}
+		if _, ok := lastEventID(req); ok != want {
+			t.Errorf("Last-Event-ID %q accepted = %v, want %v", v, ok, want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+)
+
+func TestPostFacts(t *testing.T) {
+	srv, _ := newTestServer(t, testConfig(t), store.Options{})
+	var out struct {
+		Facts []store.AssertedFact `json:"facts"`
+	}
+	status := do(t, "POST", srv.URL+"/facts", `{"subject":"Alice","predicate":"works_at","object":"Acme"}`, &out)
+	if status != http.StatusOK || len(out.Facts) != 1 || !out.Facts[0].Inserted {
+		t.Fatalf("POST one fact = %d %+v, want it inserted", status, out)
+	}
+	first := out.Facts[0].Fact
+	if first.ID == 0 || first.Confidence != 1 {
+		t.Fatalf("stored fact = %+v, want an id and confidence 1", first)
+	}
+
+	out.Facts = nil
+	status = do(t, "POST", srv.URL+"/facts", `[
+        {"subject":"alice","predicate":"works_at","object":"acme","confidence":0.5},
+        {"subject":"bob","predicate":"likes","object":"tea","confidence":0.4}
+    ]`, &out)
+	if status != http.StatusOK || len(out.Facts) != 2 {
+		t.Fatalf("POST two facts = %d %+v", status, out)
+	}
+	if out.Facts[0].Inserted || out.Facts[0].Fact.ID != first.ID {
+		t.Errorf("repeated fact = %+v, want row %d reinforced", out.Facts[0], first.ID)
+	}
+	if !out.Facts[1].Inserted || out.Facts[1].Fact.Confidence != 0.4 {
+		t.Errorf("new fact = %+v, want it inserted at 0.4", out.Facts[1])
+	}
+
+	for _, body := range []string{
+		`{"subject":"","predicate":"p","object":"o"}`,
+		`{"subject":"s","predicate":"p","object":"o","confidence":1.5}`,
+		`[{"subject":"s","predicate":"p","object":"o"},{"subject":"s","predicate":" ","object":"o"}]`,
+		`{"subject":"s","predicate":"p","object":"o","valid_from":"2026-02-01T00:00:00Z","valid_to":"2026-01-01T00:00:00Z"}`,
+		`[]`,
+		`{"subject":`,
+	} {
+		var e errorBody
+		if status := do(t, "POST", srv.URL+"/facts", body, &e); status != http.StatusBadRequest || e.Error.Code != codeInvalidInput {
+			t.Errorf("POST %s = %d %+v, want 400 invalid_input", body, status, e)
+		}
+	}
+	var page struct {
+		Facts []any `json:"facts"`
+	}
+	if do(t, "GET", srv.URL+"/facts", "", &page); len(page.Facts) != 2 {
+		t.Fatalf("%d facts stored, want 2: a rejected batch stores nothing", len(page.Facts))
+	}
+}
+
+func TestFactsAsOf(t *testing.T) {
+	srv, _ := newTestServer(t, testConfig(t), store.Options{NeighborExpansion: -1})
+	body := `[{"subject":"alice","predicate":"works_at","object":"acme","valid_from":"2019-01-01T00:00:00Z","valid_to":"2023-01-01T00:00:00Z"},
+        {"subject":"alice","predicate":"works_at","object":"globex","valid_from":"2023-01-01T00:00:00Z"}]`
+	if status := do(t, "POST", srv.URL+"/facts", body, nil); status != http.StatusOK {
+		t.Fatalf("POST /facts = %d", status)
+	}
+	for _, tt := range []struct{ asOf, want string }{
+		{"2020-06-01T00:00:00Z", "acme"},
+		{"2022-12-31T23:59:59Z", "acme"},
+		{"2023-01-01T00:00:00Z", "globex"},
+		{"2023-01-01T01:00:00%2B01:00", "globex"},
+	} {
+		var page struct{ Facts []model.Triple }
+		if status := do(t, "GET", srv.URL+"/facts?subject=alice&as_of="+tt.asOf, "", &page); status != http.StatusOK {
+			t.Fatalf("GET /facts as of %s = %d", tt.asOf, status)
+		}
+		if len(page.Facts) != 1 || page.Facts[0].Object != tt.want {
+			t.Errorf("facts as of %s = %+v, want %s", tt.asOf, page.Facts, tt.want)
+		}
+		var res model.RecalledContext
+		if status := do(t, "GET", srv.URL+"/ask?q=alice&as_of="+tt.asOf, "", &res); status != http.StatusOK {
+			t.Fatalf("GET /ask as of %s = %d", tt.asOf, status)
+		}
+		if len(res.RelatedFacts) != 1 || res.RelatedFacts[0].Object != tt.want {
+			t.Errorf("ask as of %s = %+v, want %s", tt.asOf, res.RelatedFacts, tt.want)
+		}
+	}
+
+	for _, path := range []string{"/facts?as_of=2023", "/ask?q=x&as_of=2026-06-01T00:00:00"} {
+		var e errorBody
+		if status := do(t, "GET", srv.URL+path, "", &e); status != http.StatusBadRequest || e.Error.Code != codeInvalidInput {
+			t.Errorf("GET %s = %d %+v, want 400 invalid_input", path, status, e)
+		}
+	}
+}
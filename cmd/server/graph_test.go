@@ -0,0 +1,194 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/graph"
+)
+
+func TestGraphEntities(t *testing.T) {
+	srv, _ := newTestServer(t, testConfig(t), store.Options{})
+	status := do(t, "POST", srv.URL+"/facts", `[
+        {"subject":"Alice","predicate":"works_at","object":"Acme"},
+        {"subject":"Alan","predicate":"lives_in","object":"Berlin"}
+    ]`, nil)
+	if status != http.StatusOK {
+		t.Fatalf("POST /facts = %d", status)
+	}
+
+	var out struct {
+		Entities []graph.EntityInfo `json:"entities"`
+	}
+	status = do(t, "GET", srv.URL+"/graph/entities?prefix=AL&limit=1&offset=1", "", &out)
+	if status != http.StatusOK || len(out.Entities) != 1 || out.Entities[0].Entity != "alice" {
+		t.Fatalf("GET /graph/entities = %d %+v, want the second al- entity", status, out)
+	}
+	if e := out.Entities[0]; e.AsSubject != 1 || e.AsObject != 0 {
+		t.Errorf("alice = %+v, want one edge as subject", e)
+	}
+
+	for _, q := range []string{"limit=0", "limit=x", "offset=-1", "offset=x"} {
+		if status := do(t, "GET", srv.URL+"/graph/entities?"+q, "", nil); status != http.StatusBadRequest {
+			t.Errorf("GET /graph/entities?%s = %d, want 400", q, status)
+		}
+	}
+}
+
+func TestGraphQuery(t *testing.T) {
+	srv, _ := newTestServer(t, testConfig(t), store.Options{})
+	if status := do(t, "POST", srv.URL+"/facts", `[
+        {"subject":"Alice","predicate":"works_at","object":"Acme"},
+        {"subject":"Bob","predicate":"works_at","object":"Initech"},
+        {"subject":"Acme","predicate":"located_in","object":"Berlin"}
+    ]`, nil); status != http.StatusOK {
+		t.Fatalf("POST /facts = %d", status)
+	}
+	var out struct {
+		Matches []graph.PatternMatch `json:"matches"`
+	}
+	status := do(t, "POST", srv.URL+"/graph/query", `{"patterns":[
+        {"subject":"?p","predicate":"works_at","object":"?c"},
+        {"subject":"?c","predicate":"located_in","object":"Berlin"}
+    ]}`, &out)
+	if status != http.StatusOK || len(out.Matches) != 1 || out.Matches[0].Bindings["p"] != "alice" || len(out.Matches[0].Triples) != 2 {
+		t.Fatalf("POST /graph/query = %d %+v, want alice via acme", status, out)
+	}
+
+	for _, body := range []string{
+		`{"patterns":[]}`,
+		`{"patterns":[{"subject":"?s","predicate":"","object":"?o"}]}`,
+		`{"patterns":[{"subject":"?s","predicate":"?p","object":"?o"}],"limit":-1}`,
+		`{"patterns":`,
+	} {
+		var e errorBody
+		if status := do(t, "POST", srv.URL+"/graph/query", body, &e); status != http.StatusBadRequest || e.Error.Code != codeInvalidInput {
+			t.Errorf("POST /graph/query %s = %d %+v, want 400 invalid_input", body, status, e)
+		}
+	}
+}
+
+func TestGraphExport(t *testing.T) {
+	srv, _ := newTestServer(t, testConfig(t), store.Options{})
+	if status := do(t, "POST", srv.URL+"/facts", `[
+        {"subject":"Alice","predicate":"works_at","object":"Acme","confidence":0.9},
+        {"subject":"Alice","predicate":"knows","object":"Bob","confidence":0.3}
+    ]`, nil); status != http.StatusOK {
+		t.Fatalf("POST /facts = %d", status)
+	}
+	get := func(query string) (*http.Response, string) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "/graph/export" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, string(body)
+	}
+
+	resp, body := get("")
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/vnd.graphviz") || !strings.HasPrefix(body, "digraph paim {") {
+		t.Errorf("default export = %d %q:\n%s", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+	if cd := resp.Header.Get("Content-Disposition"); !strings.Contains(cd, `filename="paim.dot"`) {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	resp, body = get("?format=graphml&min_conf=0.5")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "<graphml") || strings.Count(body, "<edge ") != 1 {
+		t.Errorf("GraphML export above 0.5 = %d:\n%s", resp.StatusCode, body)
+	}
+	if _, body := get("?predicate=knows"); strings.Count(body, " -> ") != 1 || !strings.Contains(body, `"bob"`) {
+		t.Errorf("export of knows:\n%s", body)
+	}
+
+	for _, q := range []string{"?format=png", "?min_confidence=high", "?min_confidence=2", "?max_nodes=0"} {
+		if resp, _ := get(q); resp.StatusCode != http.StatusBadRequest || resp.Header.Get("Content-Disposition") != "" {
+			t.Errorf("GET /graph/export%s = %d (%q), want 400 without an attachment", q, resp.StatusCode, resp.Header.Get("Content-Disposition"))
+		}
+	}
+}
+
+func TestGraphView(t *testing.T) {
+	srv, _ := newTestServer(t, testConfig(t), store.Options{})
+	if status := do(t, "POST", srv.URL+"/facts", `[
+        {"subject":"Alice","predicate":"works_at","object":"Acme","confidence":0.9},
+        {"subject":"Acme","predicate":"based_in","object":"Berlin","confidence":0.6},
+        {"subject":"Carol","predicate":"likes","object":"Tea","confidence":0.7}
+    ]`, nil); status != http.StatusOK {
+		t.Fatalf("POST /facts = %d", status)
+	}
+
+	var v graph.View
+	if status := do(t, "GET", srv.URL+"/graph?center=Alice&depth=1", "", &v); status != http.StatusOK {
+		t.Fatalf("GET /graph = %d", status)
+	}
+	if len(v.Edges) != 1 || v.Edges[0].Source != "alice" || v.Edges[0].Target != "acme" || len(v.Nodes) != 2 || v.Nodes[1].Label != "Alice" {
+		t.Errorf("view around alice at depth 1 = %+v", v)
+	}
+
+	v = graph.View{}
+	if status := do(t, "GET", srv.URL+"/graph?limit=2", "", &v); status != http.StatusOK {
+		t.Fatalf("GET /graph = %d", status)
+	}
+	if len(v.Edges) != 2 || !v.Truncated || v.Edges[0].Confidence != 0.9 || v.Edges[1].Confidence != 0.7 {
+		t.Errorf("whole graph limited to 2 = %+v, want the two most confident edges, truncated", v)
+	}
+
+	for _, q := range []string{"limit=0", "limit=x", "depth=x", "namespace=a%20b"} {
+		if status := do(t, "GET", srv.URL+"/graph?"+q, "", nil); status != http.StatusBadRequest {
+			t.Errorf("GET /graph?%s = %d, want 400", q, status)
+		}
+	}
+}
+
+func TestGraphNeighbors(t *testing.T) {
+	srv, _ := newTestServer(t, testConfig(t), store.Options{})
+	if status := do(t, "POST", srv.URL+"/facts", `[
+        {"subject":"Alice","predicate":"works_at","object":"AC/DC","confidence":0.9},
+        {"subject":"Bob","predicate":"likes","object":"AC/DC","confidence":0.3},
+        {"subject":"AC/DC","predicate":"based_in","object":"New York","confidence":0.8},
+        {"subject":"Zoë","predicate":"lives_in","object":"Zürich","confidence":0.8}
+    ]`, nil); status != http.StatusOK {
+		t.Fatalf("POST /facts = %d", status)
+	}
+
+	var n graph.Neighbors
+	if status := do(t, "GET", srv.URL+"/graph/neighbors/AC%2FDC", "", &n); status != http.StatusOK {
+		t.Fatalf("GET /graph/neighbors/AC%%2FDC = %d", status)
+	}
+	if n.Entity != "ac/dc" || len(n.Outgoing) != 1 || len(n.Incoming) != 2 || n.Degree != (graph.Degree{Out: 1, In: 2, Total: 3}) {
+		t.Errorf("neighbours of AC/DC = %+v", n)
+	}
+
+	n = graph.Neighbors{}
+	if status := do(t, "GET", srv.URL+"/graph/neighbors/AC%2FDC?min_conf=0.5", "", &n); status != http.StatusOK {
+		t.Fatalf("GET /graph/neighbors/AC%%2FDC?min_conf=0.5 = %d", status)
+	}
+	if len(n.Incoming) != 1 || n.Incoming[0].Subject != "alice" || n.Degree.Total != 3 {
+		t.Errorf("neighbours of AC/DC above 0.5 = %+v, want alice only with the full degree", n)
+	}
+
+	for _, path := range []string{"/graph/neighbors/New%20York", "/graph/neighbors/Z%C3%BCrich"} {
+		n = graph.Neighbors{}
+		if status := do(t, "GET", srv.URL+path, "", &n); status != http.StatusOK || n.Degree.In != 1 {
+			t.Errorf("GET %s = %d %+v, want one incoming fact", path, status, n)
+		}
+	}
+
+	var e errorBody
+	if status := do(t, "GET", srv.URL+"/graph/neighbors/nobody", "", &e); status != http.StatusNotFound {
+		t.Errorf("GET /graph/neighbors/nobody = %d %+v, want 404", status, e)
+	}
+	for _, q := range []string{"depth=0", "depth=x", "limit=0", "min_conf=high", "min_confidence=x", "min_conf=-0.1", "min_confidence=1.5"} {
+		if status := do(t, "GET", srv.URL+"/graph/neighbors/alice?"+q, "", nil); status != http.StatusBadRequest {
+			t.Errorf("GET /graph/neighbors/alice?%s = %d, want 400", q, status)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+
+	"github.com/johncui/PAIM/pkg/grpcapi"
+	"github.com/johncui/PAIM/pkg/store"
+)
+
+// serveGRPC serves the gRPC API on lis once the engine is open. Connections
+// made while the engine is starting wait in the listen backlog.
+func serveGRPC(lis net.Listener, engine *store.MemoryEngine, cfg config, logger *slog.Logger) {
+	srv := grpcapi.NewServer(engine, grpcapi.Config{
+		APIKey:         cfg.APIKey,
+		MaxTopK:        cfg.MaxTopK,
+		RequestTimeout: cfg.RequestTimeout,
+		MaxBatchBytes:  cfg.MaxBodyBytes,
+		Logger:         logger.With("component", "grpc"),
+	})
+	logger.Info("serving gRPC API", "addr", lis.Addr().String())
+	if err := srv.GRPCServer().Serve(lis); err != nil {
+		logger.Error("grpc server stopped", "err", err)
+	}
+}
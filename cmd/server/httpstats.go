@@ -0,0 +1,216 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// httpStatsPath serves the snapshot of httpStats.
+const httpStatsPath = "/debug/httpstats"
+
+// latencyBucketsMs are the upper bounds of the latency histogram buckets, in
+// milliseconds; slower requests only count towards the total.
+var latencyBucketsMs = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// unmatchedRoute labels requests no route matched, so that scanned paths do
+// not each get their own series.
+const unmatchedRoute = "unmatched"
+
+// httpStats keeps a latency histogram and status code counts per method and
+// route pattern, plus the number of requests in flight. Routes are labeled
+// with chi's pattern, such as /facts/{id}, never the raw path, which keeps
+// the number of series bounded by the routes defined.
+type httpStats struct {
+	started  time.Time
+	inFlight atomic.Int64
+
+	mu     sync.Mutex
+	routes map[routeKey]*routeStats
+}
+
+type routeKey struct {
+	method, route string
+}
+
+type routeStats struct {
+	count   int64
+	sumMs   float64
+	maxMs   float64
+	buckets []int64 // per bucket, not cumulative
+	status  map[int]int64
+}
+
+func newHTTPStats() *httpStats {
+	return &httpStats{started: time.Now(), routes: make(map[routeKey]*routeStats)}
+}
+
+// middleware records every request. It must run inside the router, where
+// chi's route context holds the matched pattern once the handler returns,
+// and outside middleware.Recoverer so that panics count as 500s.
+func (s *httpStats) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+		ww := middleware.NewWrapResponseWriter(w, req.ProtoMajor)
+		start := time.Now()
+		defer func() {
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			s.observe(req.Method, routePattern(req), status, time.Since(start))
+		}()
+		next.ServeHTTP(ww, req)
+	})
+}
+
+// routePattern returns the pattern of the route that served req. A request
+// refused by middleware before routing, such as a 401 from requireAPIKey or
+// a 503 while the engine starts, is labeled with the route it would have
+// reached, so that failures on real routes are not hidden as unmatched.
+func routePattern(req *http.Request) string {
+	rctx := chi.RouteContext(req.Context())
+	if rctx == nil {
+		return unmatchedRoute
+	}
+	if pattern := rctx.RoutePattern(); pattern != "" {
+		return pattern
+	}
+	if rctx.Routes == nil {
+		return unmatchedRoute
+	}
+	path := req.URL.RawPath
+	if path == "" {
+		path = req.URL.Path
+	}
+	tctx := chi.NewRouteContext()
+	if !rctx.Routes.Match(tctx, req.Method, path) {
+		return unmatchedRoute
+	}
+	if pattern := tctx.RoutePattern(); pattern != "" {
+		return pattern
+	}
+	return unmatchedRoute
+}
+
+func (s *httpStats) observe(method, route string, status int, d time.Duration) {
+	ms := float64(d) / float64(time.Millisecond)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := routeKey{method, route}
+	rs := s.routes[key]
+	if rs == nil {
+		rs = &routeStats{buckets: make([]int64, len(latencyBucketsMs)), status: make(map[int]int64)}
+		s.routes[key] = rs
+	}
+	rs.count++
+	rs.sumMs += ms
+	rs.maxMs = max(rs.maxMs, ms)
+	if i := sort.SearchFloat64s(latencyBucketsMs, ms); i < len(latencyBucketsMs) {
+		rs.buckets[i]++
+	}
+	rs.status[status]++
+}
+
+// httpStatsSnapshot is the JSON served at /debug/httpstats.
+type httpStatsSnapshot struct {
+	Since    time.Time       `json:"since"`
+	InFlight int64           `json:"in_flight"`
+	Routes   []routeSnapshot `json:"routes"`
+}
+
+// routeSnapshot describes the requests of one method and route pattern.
+// Quantiles are estimated from the histogram by linear interpolation within
+// a bucket.
+type routeSnapshot struct {
+	Method string  `json:"method"`
+	Route  string  `json:"route"`
+	Count  int64   `json:"count"`
+	MeanMs float64 `json:"mean_ms"`
+	P50Ms  float64 `json:"p50_ms"`
+	P95Ms  float64 `json:"p95_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+	MaxMs  float64 `json:"max_ms"`
+	// Buckets holds cumulative counts of requests at most LeMs long;
+	// requests slower than the last bound count only towards Count.
+	Buckets     []latencyBucket  `json:"buckets"`
+	Status      map[string]int64 `json:"status"`
+	StatusClass map[string]int64 `json:"status_class"`
+}
+
+// latencyBucket is one cumulative histogram bucket.
+type latencyBucket struct {
+	LeMs  float64 `json:"le_ms"`
+	Count int64   `json:"count"`
+}
+
+// snapshot returns the statistics gathered so far, ordered by route and
+// method.
+func (s *httpStats) snapshot() httpStatsSnapshot {
+	out := httpStatsSnapshot{Since: s.started, InFlight: s.inFlight.Load(), Routes: []routeSnapshot{}}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, rs := range s.routes {
+		r := routeSnapshot{
+			Method:      key.method,
+			Route:       key.route,
+			Count:       rs.count,
+			MeanMs:      rs.sumMs / float64(rs.count),
+			P50Ms:       rs.quantile(0.5),
+			P95Ms:       rs.quantile(0.95),
+			P99Ms:       rs.quantile(0.99),
+			MaxMs:       rs.maxMs,
+			Buckets:     make([]latencyBucket, len(latencyBucketsMs)),
+			Status:      make(map[string]int64, len(rs.status)),
+			StatusClass: make(map[string]int64),
+		}
+		var cum int64
+		for i, le := range latencyBucketsMs {
+			cum += rs.buckets[i]
+			r.Buckets[i] = latencyBucket{LeMs: le, Count: cum}
+		}
+		for code, n := range rs.status {
+			r.Status[strconv.Itoa(code)] += n
+			r.StatusClass[strconv.Itoa(code/100)+"xx"] += n
+		}
+		out.Routes = append(out.Routes, r)
+	}
+	sort.Slice(out.Routes, func(i, j int) bool {
+		a, b := out.Routes[i], out.Routes[j]
+		if a.Route != b.Route {
+			return a.Route < b.Route
+		}
+		return a.Method < b.Method
+	})
+	return out
+}
+
+// quantile estimates the q-quantile of the latencies in milliseconds. A
+// quantile beyond the last bucket is reported as the slowest request.
+func (rs *routeStats) quantile(q float64) float64 {
+	rank := q * float64(rs.count)
+	var cum int64
+	lower := 0.0
+	for i, upper := range latencyBucketsMs {
+		n := rs.buckets[i]
+		if n > 0 && float64(cum+n) >= rank {
+			est := lower + (upper-lower)*(rank-float64(cum))/float64(n)
+			return math.Min(est, rs.maxMs)
+		}
+		cum += n
+		lower = upper
+	}
+	return rs.maxMs
+}
+
+func (s *httpStats) handler(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, s.snapshot())
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/store"
+)
+
+// routeStatsOf returns the statistics of method on route, failing when
+// there are none.
+func routeStatsOf(t *testing.T, snap httpStatsSnapshot, method, route string) routeSnapshot {
+	t.Helper()
+	for _, r := range snap.Routes {
+		if r.Method == method && r.Route == route {
+			return r
+		}
+	}
+	t.Fatalf("no statistics for %s %s in %+v", method, route, snap.Routes)
+	return routeSnapshot{}
+}
+
+func TestHTTPStatsLabelRoutePatterns(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.HTTPStats = true
+	srv, _ := newTestServer(t, cfg, store.Options{})
+	if status := do(t, "POST", srv.URL+"/facts", `[{"subject":"AC/DC","predicate":"based_in","object":"Sydney"}]`, nil); status != http.StatusOK {
+		t.Fatalf("POST /facts = %d", status)
+	}
+	for _, path := range []string{"/facts/1", "/facts/2", "/facts/x", "/graph/neighbors/AC%2FDC", "/graph/neighbors/sydney", "/no/such/path", "/wp-login.php"} {
+		do(t, "GET", srv.URL+path, "", nil)
+	}
+
+	var snap httpStatsSnapshot
+	if status := do(t, "GET", srv.URL+httpStatsPath, "", &snap); status != http.StatusOK {
+		t.Fatalf("GET %s = %d", httpStatsPath, status)
+	}
+	for _, r := range snap.Routes {
+		if strings.Contains(r.Route, "AC") || strings.Contains(r.Route, "sydney") || strings.HasPrefix(r.Route, "/facts/") && r.Route != "/facts/{id}" {
+			t.Errorf("route %q is labeled by its raw path", r.Route)
+		}
+	}
+	facts := routeStatsOf(t, snap, "GET", "/facts/{id}")
+	if facts.Count != 3 || facts.Status["200"] != 1 || facts.Status["404"] != 1 || facts.Status["400"] != 1 || facts.StatusClass["4xx"] != 2 {
+		t.Errorf("GET /facts/{id} = %+v, want one 200, one 404 and one 400", facts)
+	}
+	if n := routeStatsOf(t, snap, "GET", "/graph/neighbors/{entity}"); n.Count != 2 || n.StatusClass["2xx"] != 2 {
+		t.Errorf("GET /graph/neighbors/{entity} = %+v, want two successes", n)
+	}
+	if u := routeStatsOf(t, snap, "GET", unmatchedRoute); u.Count != 2 || u.Status["404"] != 2 {
+		t.Errorf("unmatched GETs = %+v, want both 404s under one label", u)
+	}
+	if p := routeStatsOf(t, snap, "POST", "/facts"); p.Count != 1 || len(p.Buckets) != len(latencyBucketsMs) {
+		t.Errorf("POST /facts = %+v", p)
+	}
+	if snap.InFlight != 1 {
+		t.Errorf("in flight = %d, want the stats request itself", snap.InFlight)
+	}
+}
+
+func TestHTTPStatsDisabledByDefault(t *testing.T) {
+	srv, _ := newTestServer(t, testConfig(t), store.Options{})
+	if status := do(t, "GET", srv.URL+httpStatsPath, "", nil); status != http.StatusNotFound {
+		t.Errorf("GET %s = %d, want 404 when disabled", httpStatsPath, status)
+	}
+}
+
+func TestHTTPStatsServedBeforeTheEngine(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.HTTPStats = true
+	var startup startupState
+	h, _ := newRouter(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), &startup)
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	if status := do(t, "GET", srv.URL+"/ask?q=x", "", nil); status != http.StatusServiceUnavailable {
+		t.Fatalf("GET /ask while starting = %d, want 503", status)
+	}
+	var snap httpStatsSnapshot
+	if status := do(t, "GET", srv.URL+httpStatsPath, "", &snap); status != http.StatusOK {
+		t.Fatalf("GET %s while starting = %d, want 200", httpStatsPath, status)
+	}
+	if a := routeStatsOf(t, snap, "GET", "/ask"); a.Status["503"] != 1 {
+		t.Errorf("request refused while starting = %+v, want one 503 on /ask", a)
+	}
+}
+
+func TestHTTPStatsLabelRefusedRequests(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.HTTPStats = true
+	cfg.APIKey = "s3cret"
+	srv, _ := newTestServer(t, cfg, store.Options{})
+	for _, path := range []string{"/facts/1", "/no/such/path"} {
+		if status := do(t, "GET", srv.URL+path, "", nil); status != http.StatusUnauthorized {
+			t.Fatalf("GET %s without a key = %d, want 401", path, status)
+		}
+	}
+
+	req, err := http.NewRequest("GET", srv.URL+httpStatsPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer s3cret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var snap httpStatsSnapshot
+	if err := json.NewDecoder(resp.Body).Decode(&snap); err != nil {
+		t.Fatal(err)
+	}
+	if f := routeStatsOf(t, snap, "GET", "/facts/{id}"); f.Count != 1 || f.Status["401"] != 1 {
+		t.Errorf("GET /facts/{id} without a key = %+v, want one 401", f)
+	}
+	if u := routeStatsOf(t, snap, "GET", unmatchedRoute); u.Count != 1 || u.Status["401"] != 1 {
+		t.Errorf("unmatched GETs without a key = %+v, want one 401", u)
+	}
+}
+
+func TestHTTPStatsQuantiles(t *testing.T) {
+	s := newHTTPStats()
+	for i := 0; i < 90; i++ {
+		s.observe("GET", "/ask", http.StatusOK, 2*time.Millisecond)
+	}
+	for i := 0; i < 9; i++ {
+		s.observe("GET", "/ask", http.StatusOK, 40*time.Millisecond)
+	}
+	s.observe("GET", "/ask", http.StatusInternalServerError, 20*time.Second)
+
+	snap := s.snapshot()
+	if len(snap.Routes) != 1 {
+		t.Fatalf("%d routes, want 1", len(snap.Routes))
+	}
+	r := snap.Routes[0]
+	if r.Count != 100 || r.MaxMs != 20000 || r.StatusClass["2xx"] != 99 || r.StatusClass["5xx"] != 1 {
+		t.Errorf("snapshot = %+v", r)
+	}
+	if r.Buckets[0].Count != 90 || r.Buckets[3].Count != 99 || r.Buckets[len(r.Buckets)-1].Count != 99 {
+		t.Errorf("buckets = %+v, want 90 within 5ms, 99 within 50ms, the slowest in none", r.Buckets)
+	}
+	if r.P50Ms <= 0 || r.P50Ms > 5 {
+		t.Errorf("p50 = %vms, want within the first bucket", r.P50Ms)
+	}
+	if r.P95Ms <= 25 || r.P95Ms > 50 {
+		t.Errorf("p95 = %vms, want within the 25-50ms bucket", r.P95Ms)
+	}
+	if r.P99Ms > 50 {
+		t.Errorf("p99 = %vms, want at most 50ms", r.P99Ms)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "JSON", "warn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("dropped")
+	logger.Warn("kept", "component", "vector")
+	var rec map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("output %q is not one JSON record: %v", buf.String(), err)
+	}
+	if rec["msg"] != "kept" || rec["component"] != "vector" {
+		t.Errorf("logged %v, want only the warning", rec)
+	}
+
+	buf.Reset()
+	if logger, err = newLogger(&buf, "", "debug"); err != nil {
+		t.Fatal(err)
+	}
+	logger.Debug("shown")
+	if !strings.Contains(buf.String(), "msg=shown") {
+		t.Errorf("text output %q lacks the debug record", buf.String())
+	}
+}
+
+func TestNewLoggerRejects(t *testing.T) {
+	for _, tt := range []struct{ format, level, key string }{
+		{"xml", "info", "log_format"},
+		{"text", "loud", "log_level"},
+	} {
+		_, err := newLogger(&bytes.Buffer{}, tt.format, tt.level)
+		if err == nil || !strings.Contains(err.Error(), tt.key) {
+			t.Errorf("newLogger(%q, %q) = %v, want an error naming %s", tt.format, tt.level, err, tt.key)
+		}
+	}
+}
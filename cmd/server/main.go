@@ -2,180 +2,1233 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"log/slog"
+	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
+	"github.com/johncui/PAIM/pkg/engine/distill"
+	"github.com/johncui/PAIM/pkg/engine/embed"
+	"github.com/johncui/PAIM/pkg/engine/redact"
+	"github.com/johncui/PAIM/pkg/engine/summarize"
+	"github.com/johncui/PAIM/pkg/memory"
 	"github.com/johncui/PAIM/pkg/model"
 	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/graph"
+	"github.com/johncui/PAIM/pkg/store/sqlite"
 )
 
 func main() {
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-	cfg := loadConfig()
+	configPath := flag.String("config", os.Getenv("PAIM_CONFIG"), "path to a YAML config file")
+	migrateDim := flag.Bool("migrate-dim", false, "rebuild the vector table if PAIM_VECTOR_DIM changed and re-embed every log")
+	mcpStdio := flag.Bool("mcp-stdio", false, "serve the Model Context Protocol on stdin/stdout instead of HTTP")
+	flag.Parse()
+	cfg, unknown, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	if *migrateDim {
+		cfg.MigrateDim = true
+	}
+	// in MCP mode stdout carries the protocol
+	logOut := os.Stdout
+	if *mcpStdio {
+		logOut = os.Stderr
+	}
+	logger, err := newLogger(logOut, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	if len(unknown) > 0 {
+		logger.Warn("ignoring unknown config keys", "path", *configPath, "keys", unknown)
+	}
 
 	ctx := context.Background()
-	engine, err := store.NewMemoryEngine(ctx, store.Options{
-		DBPath:         cfg.DBPath,
-		EnableVSS:      cfg.EnableVSS,
-		ExtensionsPath: cfg.ExtensionsPath,
-		VectorDim:      cfg.VectorDim,
-		BufferSize:     cfg.BufferSize,
-		BufferTTL:      cfg.BufferTTL,
-		Logger:         logger,
-	})
+	if cfg.OTelEnabled {
+		shutdown, err := setupTracing(ctx)
+		if err != nil {
+			log.Fatalf("failed to init tracing: %v", err)
+		}
+		defer shutdown(context.Background())
+		logger.Info("tracing enabled; exporting spans over OTLP")
+	}
+	dedup, err := memory.ParseDedupMode(cfg.BufferDedup)
 	if err != nil {
-		log.Fatalf("failed to init engine: %v", err)
+		log.Fatalf("invalid PAIM_BUFFER_DEDUP: %v", err)
+	}
+	contradictions, err := graph.ParseContradictionPolicy(cfg.ContradictionPolicy)
+	if err != nil {
+		log.Fatalf("invalid PAIM_CONTRADICTION_POLICY: %v", err)
+	}
+	distiller, err := newDistiller(cfg)
+	if err != nil {
+		log.Fatalf("failed to init distiller: %v", err)
+	}
+	summarizer, err := newSummarizer(cfg)
+	if err != nil {
+		log.Fatalf("failed to init summarizer: %v", err)
+	}
+	redactor, err := newRedactor(cfg)
+	if err != nil {
+		log.Fatalf("invalid PAIM_REDACT: %v", err)
+	}
+	embedder, embedderModel, err := newEmbedder(cfg, logger)
+	if err != nil {
+		log.Fatalf("failed to init embedder: %v", err)
+	}
+	dbKey, err := cfg.dbKey()
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	opts := store.Options{
+		DBPath:          cfg.DBPath,
+		EnableVSS:       cfg.EnableVSS,
+		VectorBackend:   cfg.VectorBackend,
+		ExtensionsPath:  cfg.ExtensionsPath,
+		VectorDim:       cfg.VectorDim,
+		MigrateDim:      cfg.MigrateDim,
+		VSSRequired:     cfg.VSSRequired,
+		BufferSize:      cfg.BufferSize,
+		BufferTTL:       cfg.BufferTTL,
+		BufferDedup:     dedup,
+		Logger:          logger,
+		SyncEmbedding:   cfg.SyncEmbedding,
+		StoreEmbeddings: cfg.StoreEmbeddings,
+		EmbedWorkers:    cfg.EmbedWorkers,
+		Distiller:       distiller,
+		MaxTopK:         cfg.MaxTopK,
+		LogRetention:    cfg.LogRetention,
+		MaxLogs:         cfg.MaxLogs,
+		MaxContentChars: cfg.MaxContentChars,
+		TruncateContent: cfg.TruncateContent,
+		ReadConns:       cfg.ReadConns,
+
+		ConsolidateFillRatio: cfg.ConsolidateFillRatio,
+		NeighborExpansion:    cfg.NeighborExpansion,
+		MinConfidence:        cfg.MinConfidence,
+		ReinforceFacts:       cfg.ReinforceFacts,
+		ReinforceStep:        cfg.ReinforceStep,
+		ReinforceCap:         cfg.ReinforceCap,
+		FactPruneAge:         cfg.FactPruneAge,
+		FactPruneConfidence:  cfg.FactPruneConfidence,
+		FactPrunePredicate:   cfg.FactPrunePredicate,
+		Summarizer:           summarizer,
+		SummarizeAge:         cfg.SummarizeAge,
+		SummarizeDelete:      cfg.SummarizeDelete,
+		DedupThreshold:       cfg.DedupThreshold,
+		UniqueContentSources: cfg.uniqueContentSources(),
+		FunctionalPredicates: cfg.functionalPredicates(),
+		Contradictions:       contradictions,
+		RecencyHalfLife:      cfg.RecencyHalfLife,
+
+		ConsolidateMinInterval: cfg.ConsolidateMinInterval,
+		ConsolidationHistory:   cfg.ConsolidationHistory,
+
+		Embedder:      embedder,
+		EmbedderModel: embedderModel,
+
+		MaintenanceInterval: cfg.MaintenanceInterval,
+		CheckpointWALBytes:  int64(cfg.CheckpointWALBytes),
+		ReadOnly:            cfg.ReadOnly,
+		EncryptionKey:       dbKey,
+		Redactor:            redactor,
+
+		EmbedTimeout:          cfg.EmbedTimeout,
+		EmbedBreakerThreshold: cfg.EmbedBreakerThreshold,
+		EmbedBreakerCooldown:  cfg.EmbedBreakerCooldown,
+	}
+	if *mcpStdio {
+		if err := runMCP(ctx, opts, cfg, logger); err != nil {
+			log.Fatalf("mcp: %v", err)
+		}
+		return
 	}
-	defer engine.Close()
 
-	go startConsolidationLoop(ctx, engine, cfg.ConsolidationEvery, logger)
+	// The listener starts right away; the engine (extension loading and
+	// migrations can be slow) is opened in the background and published
+	// through startup, which gates every route but the probes.
+	var startup startupState
+	r, setEngine := newRouter(cfg, logger, &startup)
+	var grpcLis net.Listener
+	if cfg.GRPCAddr != "" {
+		if grpcLis, err = net.Listen("tcp", cfg.GRPCAddr); err != nil {
+			log.Fatalf("grpc listen: %v", err)
+		}
+	}
+	startup.set(stateStarting, "")
+	go func() {
+		eng, degraded, err := openEngine(ctx, opts)
+		if err != nil {
+			logger.Error("failed to init engine", "err", err)
+			startup.set(stateFailed, err.Error())
+			return
+		}
+		setEngine(eng)
+		if !cfg.ReadOnly {
+			go startConsolidationLoop(ctx, eng, cfg.ConsolidationEvery, cfg.ConsolidationFailureWarn, logger)
+		}
+		if grpcLis != nil {
+			go serveGRPC(grpcLis, eng, cfg, logger)
+		}
+		if degraded != "" {
+			startup.set(stateDegraded, degraded)
+			return
+		}
+		startup.set(stateReady, "")
+		logger.Info("engine ready")
+	}()
+
+	addr := cfg.ListenAddr
+	logger.Info("starting PAIM server", "addr", addr, "db", cfg.dbForLog(), "vss", cfg.EnableVSS, "vector_backend", cfg.VectorBackend)
+	var handler http.Handler = r
+	if cfg.OTelEnabled {
+		handler = traceRequests(r)
+	}
+	if err := http.ListenAndServe(addr, handler); err != nil {
+		log.Fatalf("server error: %v", err)
+	}
+}
 
+// newRouter builds the HTTP API. Every route but the probes answers 503
+// until startup reports the engine ready; the engine is handed over through
+// the returned function before that happens.
+func newRouter(cfg config, logger *slog.Logger, startup *startupState) (http.Handler, func(*store.MemoryEngine)) {
+	var engine *store.MemoryEngine
 	r := chi.NewRouter()
-	r.Use(middleware.RequestID, middleware.RealIP, middleware.Logger, middleware.Recoverer)
+	r.Use(middleware.RequestID, middleware.RealIP, middleware.Logger)
+	var stats *httpStats
+	if cfg.HTTPStats {
+		stats = newHTTPStats()
+		r.Use(stats.middleware)
+	}
+	r.Use(middleware.Recoverer)
+	if origins := cfg.corsOrigins(); len(origins) > 0 {
+		r.Use(cors(origins))
+		logger.Info("CORS enabled", "origins", origins)
+	}
+	if cfg.APIKey != "" {
+		r.Use(requireAPIKey(cfg.APIKey))
+	}
+	r.Use(startup.requireEngine)
+	r.Use(requestTimeout(cfg.RequestTimeout))
+	r.Use(withNamespace)
 
 	r.Get("/health", func(w http.ResponseWriter, _ *http.Request) {
+		out := map[string]string{"status": "ok"}
+		if startup.get().serving() {
+			out["vector_search"], out["vector_error"] = engine.VectorStatus()
+			if out["vector_error"] == "" {
+				delete(out, "vector_error")
+			}
+		}
+		writeJSON(w, out)
+	})
+	r.Get("/livez", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("ok"))
 	})
 
+	r.Get("/readyz", func(w http.ResponseWriter, req *http.Request) {
+		st := startup.get()
+		if st.serving() {
+			if err := engine.Ping(req.Context()); err != nil {
+				st = startupStatus{State: stateFailed, Detail: "database: " + err.Error()}
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if !st.serving() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(st)
+	})
+
+	r.Get("/ready", func(w http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithTimeout(req.Context(), 5*time.Second)
+		defer cancel()
+		rep := engine.Health(ctx)
+		w.Header().Set("Content-Type", "application/json")
+		if !rep.OK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(rep)
+	})
+
 	r.Post("/remember", func(w http.ResponseWriter, req *http.Request) {
-		var in model.SensoryInput
-		if err := json.NewDecoder(req.Body).Decode(&in); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		req.Body = http.MaxBytesReader(w, req.Body, int64(cfg.MaxBodyBytes))
+		inputs, many, err := decodeOneOrMany[model.SensoryInput](req.Body)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeError(w, http.StatusRequestEntityTooLarge, codeInvalidInput, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+				return
+			}
+			writeError(w, http.StatusBadRequest, codeInvalidInput, "invalid JSON body: "+err.Error())
+			return
+		}
+		if len(inputs) == 0 {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, "at least one input is required")
 			return
 		}
-		if in.Source == "" {
-			in.Source = "chat"
+		ns := reqNamespace(req)
+		for i := range inputs {
+			if inputs[i].Source == "" {
+				inputs[i].Source = "chat"
+			}
+			if strings.TrimSpace(inputs[i].Content) == "" {
+				writeError(w, http.StatusBadRequest, codeInvalidInput, "content is required")
+				return
+			}
+			if inputs[i].Namespace != "" && inputs[i].Namespace != ns {
+				writeError(w, http.StatusBadRequest, codeInvalidInput, fmt.Sprintf("input namespace %q differs from the request namespace %q", inputs[i].Namespace, ns))
+				return
+			}
+			inputs[i].Namespace = ns
 		}
-		if err := engine.Observe(req.Context(), in); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		results, err := engine.ObserveResults(req.Context(), inputs)
+		if err != nil {
+			writeEngineError(w, req, logger, err)
 			return
 		}
-		w.WriteHeader(http.StatusNoContent)
+		// 201 when anything was stored; inputs dropped as duplicates only
+		// point at existing logs
+		status := http.StatusOK
+		for _, r := range results {
+			if !r.Duplicate {
+				status = http.StatusCreated
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if many {
+			_ = json.NewEncoder(w).Encode(map[string]any{"results": results})
+		} else {
+			_ = json.NewEncoder(w).Encode(results[0])
+		}
 	})
 
 	r.Get("/ask", func(w http.ResponseWriter, req *http.Request) {
 		query := req.URL.Query().Get("q")
-		topKStr := req.URL.Query().Get("k")
-		topK := 5
-		if topKStr != "" {
-			if v, err := strconv.Atoi(topKStr); err == nil {
-				topK = v
+		topK, err := positiveIntParam(req.URL.Query(), "k", 5, cfg.MaxTopK)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, err.Error())
+			return
+		}
+		opts := model.RecallOptions{
+			TopK:           topK,
+			Namespace:      reqNamespace(req),
+			Source:         req.URL.Query().Get("source"),
+			ExpandSessions: req.URL.Query().Get("expand_sessions") == "true",
+			Predicate:      req.URL.Query().Get("predicate"),
+			Match:          req.URL.Query().Get("match"),
+
+			IncludeSuperseded: req.URL.Query().Get("include_superseded") == "true",
+		}
+		if opts.SessionWindow, err = positiveIntParam(req.URL.Query(), "session_window", model.DefaultSessionWindow, cfg.MaxTopK); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, err.Error())
+			return
+		}
+		if opts.MaxFacts, err = positiveIntParam(req.URL.Query(), "k_facts", 0, cfg.MaxTopK); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, err.Error())
+			return
+		}
+		if opts.MaxLogs, err = positiveIntParam(req.URL.Query(), "k_logs", 0, cfg.MaxTopK); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, err.Error())
+			return
+		}
+		// min_confidence is accepted too, as on /facts
+		for _, name := range []string{"min_confidence", "min_conf"} {
+			if v := req.URL.Query().Get(name); v != "" {
+				if opts.MinConfidence, err = strconv.ParseFloat(v, 64); err != nil {
+					writeError(w, http.StatusBadRequest, codeInvalidInput, name+" must be a number")
+					return
+				}
+			}
+		}
+		for _, bound := range []struct {
+			param string
+			dst   *time.Time
+		}{{"from", &opts.From}, {"to", &opts.To}, {"as_of", &opts.AsOf}} {
+			v := req.URL.Query().Get(bound.param)
+			if v == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, codeInvalidInput, fmt.Sprintf("invalid %s: %v", bound.param, err))
+				return
+			}
+			*bound.dst = t
+		}
+		if v := req.URL.Query().Get("recency_halflife"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				writeError(w, http.StatusBadRequest, codeInvalidInput, "recency_halflife must be a non-negative duration such as 72h")
+				return
+			}
+			// 0 turns the engine default off for this request
+			opts.RecencyHalfLife = d
+			if d == 0 {
+				opts.RecencyHalfLife = -1
 			}
 		}
-		res, err := engine.Recall(req.Context(), query, topK)
+		opts.Metadata = metadataParams(req.URL.Query())
+		res, err := engine.RecallWithOptions(req.Context(), query, opts)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeEngineError(w, req, logger, err)
 			return
 		}
 		writeJSON(w, res)
 	})
 
-	addr := cfg.ListenAddr
-	logger.Info("starting PAIM server", "addr", addr, "db", cfg.DBPath, "vss", cfg.EnableVSS)
-	if err := http.ListenAndServe(addr, r); err != nil {
-		log.Fatalf("server error: %v", err)
+	r.Get("/facts", func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		params := graph.ListParams{
+			Namespace: reqNamespace(req),
+			Subject:   q.Get("subject"),
+			Predicate: q.Get("predicate"),
+			Object:    q.Get("object"),
+			Match:     graph.MatchMode(q.Get("match")),
+
+			IncludeSuperseded: q.Get("include_superseded") == "true",
+		}
+		var err error
+		if params.Limit, err = positiveIntParam(q, "limit", 50, 500); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, err.Error())
+			return
+		}
+		if v := q.Get("cursor"); v != "" {
+			if params.Cursor, err = strconv.ParseInt(v, 10, 64); err != nil {
+				writeError(w, http.StatusBadRequest, codeInvalidInput, "cursor must be an integer")
+				return
+			}
+		}
+		if v := q.Get("min_confidence"); v != "" {
+			if params.MinConfidence, err = strconv.ParseFloat(v, 64); err != nil {
+				writeError(w, http.StatusBadRequest, codeInvalidInput, "min_confidence must be a number")
+				return
+			}
+		}
+		if v := q.Get("as_of"); v != "" {
+			if params.AsOf, err = time.Parse(time.RFC3339, v); err != nil {
+				writeError(w, http.StatusBadRequest, codeInvalidInput, fmt.Sprintf("invalid as_of: %v", err))
+				return
+			}
+		}
+		page, err := engine.ListFacts(req.Context(), params)
+		if err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		writeJSON(w, page)
+	})
+
+	r.Post("/facts", func(w http.ResponseWriter, req *http.Request) {
+		type factIn struct {
+			Subject    string     `json:"subject"`
+			Predicate  string     `json:"predicate"`
+			Object     string     `json:"object"`
+			Confidence *float64   `json:"confidence"`
+			ValidFrom  *time.Time `json:"valid_from"`
+			ValidTo    *time.Time `json:"valid_to"`
+		}
+		in, _, err := decodeOneOrMany[factIn](req.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, "invalid JSON body: "+err.Error())
+			return
+		}
+		facts := make([]model.Triple, len(in))
+		for i, f := range in {
+			// an explicitly asserted fact is certain unless stated otherwise
+			confidence := 1.0
+			if f.Confidence != nil {
+				confidence = *f.Confidence
+			}
+			facts[i] = model.Triple{Subject: f.Subject, Predicate: f.Predicate, Object: f.Object, Confidence: confidence,
+				ValidFrom: f.ValidFrom, ValidTo: f.ValidTo, Namespace: reqNamespace(req)}
+		}
+		stored, err := engine.Assert(req.Context(), facts)
+		if err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		writeJSON(w, map[string]any{"facts": stored})
+	})
+
+	r.Get("/facts/{id}", func(w http.ResponseWriter, req *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(req, "id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, "invalid fact id")
+			return
+		}
+		fact, err := engine.Fact(req.Context(), reqNamespace(req), id)
+		if err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		writeJSON(w, fact)
+	})
+
+	r.Delete("/facts/{id}", func(w http.ResponseWriter, req *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(req, "id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, "invalid fact id")
+			return
+		}
+		err = engine.DeleteFact(req.Context(), reqNamespace(req), id)
+		if err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	r.Delete("/facts", func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		n, err := engine.DeleteFacts(req.Context(), reqNamespace(req), q.Get("subject"), q.Get("predicate"), q.Get("object"), q.Get("confirm") == "all")
+		if errors.Is(err, store.ErrInvalidInput) {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, err.Error()+" (pass confirm=all to delete every fact of the namespace)")
+			return
+		}
+		if err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		writeJSON(w, map[string]int64{"deleted": n})
+	})
+
+	r.Post("/facts/prune", func(w http.ResponseWriter, req *http.Request) {
+		var in struct {
+			MaxAge        string  `json:"max_age"`
+			MaxConfidence float64 `json:"max_confidence"`
+			Predicate     string  `json:"predicate"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&in); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, "invalid JSON body: "+err.Error())
+			return
+		}
+		maxAge, err := time.ParseDuration(in.MaxAge)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, "max_age must be a duration such as 720h")
+			return
+		}
+		n, err := engine.PruneFacts(req.Context(), graph.PruneParams{
+			Namespace:     reqNamespace(req),
+			MaxAge:        maxAge,
+			MaxConfidence: in.MaxConfidence,
+			Predicate:     in.Predicate,
+		})
+		if err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		writeJSON(w, map[string]int64{"deleted": n})
+	})
+
+	r.Post("/graph/aliases", func(w http.ResponseWriter, req *http.Request) {
+		var in struct {
+			Alias     string `json:"alias"`
+			Canonical string `json:"canonical"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&in); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, "invalid JSON body: "+err.Error())
+			return
+		}
+		err := engine.AddAlias(req.Context(), reqNamespace(req), in.Alias, in.Canonical)
+		if err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	r.Get("/graph/neighbors/{entity}", func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		entity := chi.URLParam(req, "entity")
+		if req.URL.RawPath != "" {
+			// chi routed on the escaped path, e.g. for an entity holding "%2F"
+			var err error
+			if entity, err = url.PathUnescape(entity); err != nil {
+				writeError(w, http.StatusBadRequest, codeInvalidInput, "invalid entity: "+err.Error())
+				return
+			}
+		}
+		depth, err := positiveIntParam(q, "depth", 1, 0)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, err.Error())
+			return
+		}
+		limit, err := positiveIntParam(q, "limit", 50, 500)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, err.Error())
+			return
+		}
+		var minConf float64
+		for _, name := range []string{"min_conf", "min_confidence"} {
+			if v := q.Get(name); v != "" {
+				if minConf, err = strconv.ParseFloat(v, 64); err != nil {
+					writeError(w, http.StatusBadRequest, codeInvalidInput, name+" must be a number")
+					return
+				}
+			}
+		}
+		neighbors, err := engine.Neighbors(req.Context(), reqNamespace(req), entity, depth, limit, minConf)
+		if err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		writeJSON(w, neighbors)
+	})
+
+	r.Get("/graph", func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		depth, err := positiveIntParam(q, "depth", 2, 0)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, err.Error())
+			return
+		}
+		limit, err := positiveIntParam(q, "limit", 200, 1000)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, err.Error())
+			return
+		}
+		view, err := engine.GraphView(req.Context(), reqNamespace(req), q.Get("center"), depth, limit)
+		if err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		writeJSON(w, view)
+	})
+
+	r.Get("/graph/entities", func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		limit, err := positiveIntParam(q, "limit", 50, 500)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, err.Error())
+			return
+		}
+		offset := 0
+		if v := q.Get("offset"); v != "" {
+			if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+				writeError(w, http.StatusBadRequest, codeInvalidInput, "offset must be a non-negative integer")
+				return
+			}
+		}
+		entities, err := engine.ListEntities(req.Context(), reqNamespace(req), q.Get("prefix"), limit, offset)
+		if err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		writeJSON(w, map[string]any{"entities": entities})
+	})
+
+	r.Get("/graph/path", func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		from, to := q.Get("from"), q.Get("to")
+		if from == "" || to == "" {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, "from and to are required")
+			return
+		}
+		depth, err := positiveIntParam(q, "depth", 4, 6)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, err.Error())
+			return
+		}
+		path, err := engine.FindPath(req.Context(), reqNamespace(req), from, to, depth)
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, codeNotFound, fmt.Sprintf("no path from %q to %q within %d hops", from, to, depth))
+			return
+		}
+		if err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		writeJSON(w, map[string]any{"from": from, "to": to, "depth": depth, "path": path})
+	})
+
+	r.Post("/graph/query", func(w http.ResponseWriter, req *http.Request) {
+		var in struct {
+			Patterns []graph.TriplePattern `json:"patterns"`
+			Limit    int                   `json:"limit"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&in); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, "invalid JSON body: "+err.Error())
+			return
+		}
+		if in.Limit < 0 {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, "limit must not be negative")
+			return
+		}
+		matches, err := engine.QueryPattern(req.Context(), reqNamespace(req), in.Patterns, in.Limit)
+		if err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		writeJSON(w, map[string]any{"matches": matches})
+	})
+
+	if stats != nil {
+		r.Get(httpStatsPath, stats.handler)
 	}
-}
 
-// ------------ config & helpers ------------
+	r.Get("/stats", func(w http.ResponseWriter, req *http.Request) {
+		stats, err := engine.Stats(req.Context())
+		if err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		writeJSON(w, stats)
+	})
 
-type config struct {
-	ListenAddr         string
-	DBPath             string
-	EnableVSS          bool
-	ExtensionsPath     string
-	VectorDim          int
-	BufferSize         int
-	BufferTTL          time.Duration
-	ConsolidationEvery time.Duration
+	r.Get("/buffer", func(w http.ResponseWriter, req *http.Request) {
+		items, err := engine.BufferedInputs(reqNamespace(req))
+		if err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		writeJSON(w, map[string]any{"items": items})
+	})
+
+	r.Get("/logs", func(w http.ResponseWriter, req *http.Request) {
+		limit, err := positiveIntParam(req.URL.Query(), "limit", 50, 500)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, err.Error())
+			return
+		}
+		var logs []model.LogEntry
+		if meta := metadataParams(req.URL.Query()); meta != nil {
+			logs, err = engine.QueryLogsByMetadata(req.Context(), reqNamespace(req), meta, limit)
+		} else {
+			logs, err = engine.RecentLogs(req.Context(), reqNamespace(req), limit)
+		}
+		if err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		writeJSON(w, map[string]any{"logs": logs})
+	})
+
+	r.Delete("/logs", func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		p := sqlite.DeleteParams{Namespace: reqNamespace(req), Source: q.Get("source")}
+		for _, bound := range []struct {
+			param string
+			dst   *time.Time
+		}{{"before", &p.Before}, {"after", &p.After}} {
+			v := q.Get(bound.param)
+			if v == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, codeInvalidInput, fmt.Sprintf("invalid %s: %v", bound.param, err))
+				return
+			}
+			*bound.dst = t
+		}
+		n, err := engine.DeleteLogs(req.Context(), p, q.Get("confirm") == "all")
+		if errors.Is(err, store.ErrInvalidInput) && p.IsZero() {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, err.Error()+" (pass confirm=all to delete every log of the namespace)")
+			return
+		}
+		if err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		writeJSON(w, map[string]int64{"deleted": n})
+	})
+
+	r.Get("/logs/{id}", func(w http.ResponseWriter, req *http.Request) {
+		detail, err := engine.Log(req.Context(), reqNamespace(req), chi.URLParam(req, "id"))
+		if err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		writeJSON(w, detail)
+	})
+
+	r.Patch("/logs/{id}", func(w http.ResponseWriter, req *http.Request) {
+		var in struct {
+			Content      *string        `json:"content"`
+			SourceType   *string        `json:"source_type"`
+			Metadata     map[string]any `json:"metadata"`
+			MetadataMode string         `json:"metadata_mode"`
+			IfUpdatedAt  *time.Time     `json:"if_updated_at"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&in); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, "invalid JSON body: "+err.Error())
+			return
+		}
+		patch := sqlite.LogPatch{Content: in.Content, SourceType: in.SourceType, Metadata: in.Metadata}
+		switch in.MetadataMode {
+		case "", "merge":
+		case "replace":
+			patch.ReplaceMetadata = true
+		default:
+			writeError(w, http.StatusBadRequest, codeInvalidInput, `metadata_mode must be "merge" or "replace"`)
+			return
+		}
+		if in.IfUpdatedAt != nil {
+			patch.UnmodifiedSince = *in.IfUpdatedAt
+		}
+		e, err := engine.UpdateLog(req.Context(), reqNamespace(req), chi.URLParam(req, "id"), patch)
+		if err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		writeJSON(w, e)
+	})
+
+	r.Get("/events", func(w http.ResponseWriter, req *http.Request) {
+		var events <-chan store.Event
+		if id, ok := lastEventID(req); ok {
+			events = engine.SubscribeSince(req.Context(), reqNamespace(req), id)
+		} else {
+			events = engine.Subscribe(req.Context(), reqNamespace(req))
+		}
+		if err := streamEvents(w, events); err != nil && req.Context().Err() == nil {
+			logger.Warn("event stream ended", "err", err)
+		}
+	})
+
+	r.Post("/consolidate", func(w http.ResponseWriter, req *http.Request) {
+		if err := engine.Consolidate(req.Context()); err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	r.Get("/consolidations", func(w http.ResponseWriter, req *http.Request) {
+		limit, err := positiveIntParam(req.URL.Query(), "limit", 20, store.MaxConsolidationRuns)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, err.Error())
+			return
+		}
+		runs, err := engine.ConsolidationRuns(req.Context(), limit)
+		if err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		writeJSON(w, map[string]any{"runs": runs})
+	})
+
+	r.Get("/export", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := engine.Export(req.Context(), w); err != nil {
+			// headers are gone once streaming started; the truncated body
+			// fails to parse on the client
+			logger.Error("export failed", "err", err)
+		}
+	})
+
+	r.Get("/graph/export", func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		name := q.Get("format")
+		if name == "" {
+			name = string(graph.ExportDOT)
+		}
+		format, err := graph.ParseExportFormat(name)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, err.Error())
+			return
+		}
+		opts := graph.ExportOptions{Namespace: reqNamespace(req), Predicates: q["predicate"]}
+		for _, name := range []string{"min_confidence", "min_conf"} {
+			if v := q.Get(name); v != "" {
+				if opts.MinConfidence, err = strconv.ParseFloat(v, 64); err != nil {
+					writeError(w, http.StatusBadRequest, codeInvalidInput, name+" must be a number")
+					return
+				}
+			}
+		}
+		if opts.MaxNodes, err = positiveIntParam(q, "max_nodes", 0, 0); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="paim.%s"`, format))
+		if err := engine.ExportGraph(req.Context(), w, format, opts); err != nil {
+			if errors.Is(err, store.ErrInvalidInput) {
+				w.Header().Del("Content-Disposition")
+				writeEngineError(w, req, logger, err)
+				return
+			}
+			// as for /export, the truncated document fails to parse
+			logger.Error("graph export failed", "err", err)
+		}
+	})
+
+	r.Post("/import", func(w http.ResponseWriter, req *http.Request) {
+		report, err := engine.Import(req.Context(), req.Body)
+		if err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		writeJSON(w, report)
+	})
+
+	r.Post("/prune", func(w http.ResponseWriter, req *http.Request) {
+		report, err := engine.Prune(req.Context())
+		if err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		writeJSON(w, report)
+	})
+
+	r.Post("/maintenance", func(w http.ResponseWriter, req *http.Request) {
+		report, err := engine.Maintain(req.Context())
+		if err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		writeJSON(w, report)
+	})
+
+	r.Post("/summarize", func(w http.ResponseWriter, req *http.Request) {
+		report, err := engine.Summarize(req.Context())
+		if err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		writeJSON(w, report)
+	})
+
+	var reindex reindexJob
+	r.Post("/reindex", func(w http.ResponseWriter, req *http.Request) {
+		if engine.ReadOnly() {
+			writeEngineError(w, req, logger, store.ErrReadOnly)
+			return
+		}
+		if !engine.VectorEnabled() && !engine.StoresEmbeddings() {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, "vector search and embedding storage are disabled")
+			return
+		}
+		batch, err := positiveIntParam(req.URL.Query(), "batch_size", store.DefaultReindexBatchSize, 1000)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, err.Error())
+			return
+		}
+		opts := store.ReindexOptions{BatchSize: batch, Resume: req.URL.Query().Get("resume") == "true"}
+		if !reindex.start(engine, opts, logger) {
+			writeError(w, http.StatusConflict, codeConflict, "a reindex is already running")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(reindex.get())
+	})
+
+	r.Get("/reindex", func(w http.ResponseWriter, req *http.Request) {
+		writeJSON(w, reindex.get())
+	})
+
+	var backingUp atomic.Bool
+	r.Post("/backup", func(w http.ResponseWriter, req *http.Request) {
+		if !backingUp.CompareAndSwap(false, true) {
+			writeError(w, http.StatusConflict, codeConflict, "a backup is already running")
+			return
+		}
+		defer backingUp.Store(false)
+
+		name := req.URL.Query().Get("name")
+		if name == "" {
+			name = "paim-" + time.Now().UTC().Format("20060102T150405Z") + ".db"
+		}
+		dest, err := backupPath(cfg.BackupDir, name)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, err.Error())
+			return
+		}
+		if err := os.MkdirAll(cfg.BackupDir, 0o755); err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		if err := engine.Backup(req.Context(), dest); err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		info, err := os.Stat(dest)
+		if err != nil {
+			writeEngineError(w, req, logger, err)
+			return
+		}
+		writeJSON(w, map[string]any{"path": dest, "size": info.Size()})
+	})
+
+	return r, func(e *store.MemoryEngine) { engine = e }
 }
 
-func loadConfig() config {
-	return config{
-		ListenAddr:         getenv("PAIM_LISTEN_ADDR", ":8080"),
-		DBPath:             getenv("PAIM_DB_PATH", "paim.db"),
-		EnableVSS:          getenvBool("PAIM_ENABLE_VSS", false),
-		ExtensionsPath:     os.Getenv("GO_SQLITE3_EXTENSIONS"),
-		VectorDim:          getenvInt("PAIM_VECTOR_DIM", 1536),
-		BufferSize:         getenvInt("PAIM_BUFFER_SIZE", 128),
-		BufferTTL:          getenvDuration("PAIM_BUFFER_TTL", 30*time.Minute),
-		ConsolidationEvery: getenvDuration("PAIM_CONSOLIDATION_EVERY", 5*time.Minute),
+// ------------ config & helpers ------------
+
+// openEngine opens the memory engine and returns why it is degraded, if it
+// is: vector search was requested but the extension could not provide it,
+// and PAIM_VSS_REQUIRED is unset. Errors get a hint on how to fix them.
+func openEngine(ctx context.Context, opts store.Options) (*store.MemoryEngine, string, error) {
+	engine, err := store.NewMemoryEngine(ctx, opts)
+	if errors.Is(err, store.ErrVectorUnavailable) {
+		return nil, "", fmt.Errorf("%w; fix GO_SQLITE3_EXTENSIONS (extensions_path), or unset PAIM_VSS_REQUIRED to start without vector search", err)
+	}
+	if errors.Is(err, store.ErrVectorDimMismatch) {
+		// falling back would hide the problem; the data needs a decision
+		return nil, "", fmt.Errorf("%w; restore PAIM_VECTOR_DIM or restart with --migrate-dim (PAIM_MIGRATE_DIM=true) to rebuild the vector table and re-embed every log", err)
+	}
+	// vector search is not the problem here either
+	if errors.Is(err, store.ErrEncryptionUnsupported) {
+		return nil, "", fmt.Errorf("%w; build with -tags libsqlite3 against libsqlcipher, or unset PAIM_DB_KEY", err)
+	}
+	if sqlite.IsKeyError(err) {
+		return nil, "", fmt.Errorf("%w; set PAIM_DB_KEY or PAIM_DB_KEY_FILE to the key the database was encrypted with", err)
+	}
+	if err != nil {
+		return nil, "", err
 	}
+	if mode, reason := engine.VectorStatus(); mode == store.VectorDegraded {
+		return engine, "vector search disabled: " + reason, nil
+	}
+	return engine, "", nil
 }
 
-func getenv(key, def string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
+// newDistiller builds the distiller named by PAIM_DISTILLER. A comma-separated
+// list runs several distillers as a Chain; the LLM distiller always falls back
+// to the heuristic when the endpoint is down or returns nothing.
+func newDistiller(cfg config) (distill.Distiller, error) {
+	heuristic, err := distill.NewHeuristicWithConfig(distill.HeuristicConfig{UserEntity: cfg.UserEntity})
+	if err != nil {
+		return nil, err
+	}
+	var members []distill.Distiller
+	for _, name := range strings.Split(cfg.Distiller, ",") {
+		switch strings.TrimSpace(name) {
+		case "", "heuristic":
+			members = append(members, heuristic)
+		case "llm":
+			llm := distill.NewLLM(distill.LLMConfig{
+				Endpoint:         cfg.LLMEndpoint,
+				APIKey:           cfg.LLMAPIKey,
+				Model:            cfg.LLMModel,
+				MaxInputsPerCall: cfg.LLMBatchSize,
+				Timeout:          cfg.LLMTimeout,
+			})
+			members = append(members, distill.Fallback(llm, heuristic))
+		case "rules":
+			if cfg.RulesFile == "" {
+				return nil, errors.New("PAIM_RULES_FILE is required for the rules distiller")
+			}
+			rules, err := distill.LoadRules(cfg.RulesFile)
+			if err != nil {
+				return nil, err
+			}
+			rd, err := distill.NewRules(rules, heuristic)
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, rd)
+		default:
+			return nil, fmt.Errorf("unknown distiller %q", name)
+		}
+	}
+	if len(members) == 1 {
+		return members[0], nil
 	}
-	return def
+	return distill.Chain(members...), nil
 }
 
-func getenvBool(key string, def bool) bool {
-	v := os.Getenv(key)
-	if v == "" {
-		return def
+// newEmbedder builds the remote embedder configured by PAIM_EMBEDDER_ENDPOINT
+// and the model name recorded with its vectors; nil keeps the built-in
+// HashEmbedder. Transient failures are retried with the default backoff.
+// With PAIM_EMBEDDER_FALLBACK the hash embedder takes over while the
+// endpoint fails, and its vectors are recorded as hash vectors.
+func newEmbedder(cfg config, logger *slog.Logger) (model.EmbeddingClient, string, error) {
+	if cfg.EmbedderEndpoint == "" {
+		return nil, "", nil
+	}
+	httpEmbedder := embed.NewHTTP(embed.HTTPConfig{
+		Endpoint: cfg.EmbedderEndpoint,
+		APIKey:   cfg.EmbedderAPIKey,
+		Model:    cfg.EmbedderModel,
+		Timeout:  cfg.EmbedderTimeout,
+	})
+	policy := embed.DefaultRetryPolicy()
+	policy.MaxAttempts = cfg.EmbedderMaxAttempts
+	remote := embed.WithRetry(httpEmbedder, policy)
+	if !cfg.EmbedderFallback {
+		return remote, httpEmbedder.String(), nil
 	}
-	b, err := strconv.ParseBool(v)
+	chain, err := embed.NewFallback(embed.FallbackConfig{
+		Primary:        remote,
+		Secondary:      store.NewHashEmbedder(cfg.VectorDim),
+		SecondaryModel: store.HashEmbedderModel,
+		Cooldown:       cfg.EmbedderCooldown,
+		Logger:         logger,
+	})
 	if err != nil {
-		return def
+		return nil, "", err
 	}
-	return b
+	return chain, httpEmbedder.String(), nil
 }
 
-func getenvInt(key string, def int) int {
-	v := os.Getenv(key)
-	if v == "" {
-		return def
+// newSummarizer builds the summarizer named by PAIM_SUMMARIZER; nil leaves
+// summarization off.
+func newSummarizer(cfg config) (summarize.Summarizer, error) {
+	switch cfg.Summarizer {
+	case "", "none":
+		return nil, nil
+	case "extractive":
+		return summarize.NewExtractive(cfg.MaxContentChars), nil
+	default:
+		return nil, fmt.Errorf("unknown summarizer %q", cfg.Summarizer)
 	}
-	n, err := strconv.Atoi(v)
+}
+
+// newRedactor builds the redactor for the categories in PAIM_REDACT; nil
+// leaves inputs as they are.
+func newRedactor(cfg config) (redact.Redactor, error) {
+	switch cfg.Redact {
+	case "", "none":
+		return nil, nil
+	case "all":
+		return redact.NewRegex()
+	}
+	var categories []string
+	for _, c := range strings.Split(cfg.Redact, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			categories = append(categories, c)
+		}
+	}
+	r, err := redact.NewRegex(categories...)
 	if err != nil {
-		return def
+		return nil, err
+	}
+	return r, nil
+}
+
+// requireAPIKey rejects requests without "Authorization: Bearer <key>",
+// except the liveness and readiness probes.
+func requireAPIKey(key string) func(http.Handler) http.Handler {
+	want := []byte("Bearer " + key)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if !isProbe(req.URL.Path) && subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), want) != 1 {
+				writeError(w, http.StatusUnauthorized, codeUnauthorized, "missing or invalid API key")
+				return
+			}
+			next.ServeHTTP(w, req)
+		})
 	}
-	return n
 }
 
-func getenvDuration(key string, def time.Duration) time.Duration {
-	v := os.Getenv(key)
-	if v == "" {
-		return def
+func isProbe(path string) bool {
+	return isLiveness(path) || path == "/ready" || path == "/readyz"
+}
+
+// backupPath resolves name inside dir, rejecting anything that would escape it.
+func backupPath(dir, name string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
 	}
-	d, err := time.ParseDuration(v)
+	dest, err := filepath.Abs(filepath.Join(absDir, name))
 	if err != nil {
-		return def
+		return "", err
 	}
-	return d
+	if rel, err := filepath.Rel(absDir, dest); err != nil || rel == "." || strings.HasPrefix(rel, "..") || strings.ContainsRune(rel, filepath.Separator) {
+		return "", fmt.Errorf("backup name %q must be a file name inside the backup directory", name)
+	}
+	return dest, nil
 }
 
 func writeJSON(w http.ResponseWriter, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(v); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, codeInternal, "internal error")
 	}
 }
 
-func startConsolidationLoop(ctx context.Context, engine model.MemoryStore, every time.Duration, logger *slog.Logger) {
+// startConsolidationLoop consolidates on a timer jittered by ±10% (so
+// instances on one host drift apart) and whenever the engine requests it,
+// e.g. because the buffer is filling up. Timed runs also retry pending
+// embeddings, prune and summarize; a run is skipped if another is still in
+// progress. Once failWarn runs in a row have failed it warns, and logs again
+// when a run succeeds; failWarn <= 0 disables the warning.
+func startConsolidationLoop(ctx context.Context, engine *store.MemoryEngine, every time.Duration, failWarn int, logger *slog.Logger) {
 	if every <= 0 {
 		every = 5 * time.Minute
 	}
-	ticker := time.NewTicker(every)
-	defer ticker.Stop()
+	timer := time.NewTimer(jitter(every, 0.1))
+	defer timer.Stop()
+	failures := 0
+	// consolidate logs a failed run itself; it reports whether a run
+	// completed and whether it was skipped because another was in progress
+	consolidate := func() (ok, skipped bool) {
+		ran, err := engine.TryConsolidate(ctx)
+		switch {
+		case err != nil:
+			failures++
+			logger.Error("consolidation failed", "err", err)
+			if failures == failWarn {
+				logger.Warn("consolidation keeps failing", "consecutive_failures", failures, "err", err)
+			}
+		case ran:
+			if failWarn > 0 && failures >= failWarn {
+				logger.Info("consolidation recovered", "failed_runs", failures)
+			}
+			failures = 0
+		}
+		return ran && err == nil, !ran && err == nil
+	}
 	for {
 		select {
-		case <-ticker.C:
-			if err := engine.Consolidate(ctx); err != nil {
-				logger.Error("consolidation failed", "err", err)
+		case <-engine.ConsolidationRequests():
+			if ok, _ := consolidate(); ok {
+				logger.Debug("consolidated on request")
+			}
+		case <-timer.C:
+			timer.Reset(jitter(every, 0.1))
+			if _, skipped := consolidate(); skipped {
+				logger.Info("skipping consolidation; previous run still in progress")
+			}
+			if n, err := engine.RetryPendingEmbeddings(ctx, 100); err != nil {
+				logger.Error("embedding retry failed", "err", err)
+			} else if n > 0 {
+				logger.Info("embedded pending logs", "count", n)
+			}
+			if depth, err := engine.EmbeddingQueueDepth(ctx); err == nil && depth > 0 {
+				logger.Info("embedding queue", "depth", depth)
+			}
+			if report, err := engine.Prune(ctx); err != nil {
+				logger.Error("prune failed", "err", err)
+			} else if report.Logs > 0 || report.Facts > 0 {
+				logger.Info("pruned memory", "logs", report.Logs, "embeddings", report.Embeddings, "facts", report.Facts)
+			}
+			if report, err := engine.Summarize(ctx); err != nil {
+				logger.Error("summarization failed", "err", err)
+			} else if report.Summaries > 0 {
+				logger.Info("summarized memory logs", "logs", report.Logs, "summaries", report.Summaries, "deleted", report.Deleted)
 			}
 		case <-ctx.Done():
 			return
 		}
 	}
 }
+
+// jitter spreads d uniformly over [d*(1-frac), d*(1+frac)].
+func jitter(d time.Duration, frac float64) time.Duration {
+	return time.Duration(float64(d) * (1 - frac + 2*frac*rand.Float64()))
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/engine/embed"
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+func TestBackupPath(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"paim.db", true},
+		{"paim-20260101T000000Z.db", true},
+		{"../paim.db", false},
+		{"sub/paim.db", false},
+		{"/etc/paim.db", false},
+		{".", false},
+		{"..", false},
+	}
+	for _, tt := range tests {
+		got, err := backupPath(dir, tt.name)
+		if (err == nil) != tt.ok {
+			t.Errorf("backupPath(%q) = %q, %v; want ok %v", tt.name, got, err, tt.ok)
+			continue
+		}
+		if tt.ok && got != filepath.Join(dir, tt.name) {
+			t.Errorf("backupPath(%q) = %q, want it inside %s", tt.name, got, dir)
+		}
+	}
+}
+
+func TestJitter(t *testing.T) {
+	seen := map[bool]bool{}
+	for i := 0; i < 1000; i++ {
+		d := jitter(time.Minute, 0.1)
+		if d < 54*time.Second || d > 66*time.Second {
+			t.Fatalf("jitter(1m, 0.1) = %v, want within ±10%%", d)
+		}
+		seen[d > time.Minute] = true
+	}
+	if len(seen) != 2 {
+		t.Error("jitter never spread to both sides of the interval")
+	}
+}
+
+func TestConsolidationLoopRunsOnRequest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	engine := storetest.NewTestEngine(t)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		startConsolidationLoop(ctx, engine, time.Hour, 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	if err := engine.Observe(ctx, model.SensoryInput{Content: "Alice works at Acme."}); err != nil {
+		t.Fatal(err)
+	}
+	engine.RequestConsolidation()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st, err := engine.Stats(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.LastConsolidation != nil && st.BufferLen == 0 && st.Triples == 1 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no consolidation an hour before the timer: %+v", st)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNewEmbedder(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if emb, name, err := newEmbedder(config{}, logger); emb != nil || name != "" || err != nil {
+		t.Errorf("newEmbedder without an endpoint = %v, %q, %v; want the built-in embedder", emb, name, err)
+	}
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	t.Cleanup(down.Close)
+	cfg := config{EmbedderEndpoint: down.URL, EmbedderModel: "small", EmbedderTimeout: time.Second, VectorDim: 8, EmbedderCooldown: time.Minute}
+	emb, name, err := newEmbedder(cfg, logger)
+	if err != nil || name != "small" {
+		t.Fatalf("newEmbedder = %q, %v; want the remote model", name, err)
+	}
+	if _, err := emb.EmbedText(context.Background(), "x"); err == nil {
+		t.Error("remote embedder without a fallback succeeded against a failing endpoint")
+	}
+
+	cfg.EmbedderFallback = true
+	if emb, name, err = newEmbedder(cfg, logger); err != nil || name != "small" {
+		t.Fatalf("newEmbedder with a fallback = %q, %v", name, err)
+	}
+	vec, vecModel, err := emb.(model.ModelEmbedder).EmbedTextModel(context.Background(), "x")
+	if err != nil || len(vec) != 8 || vecModel != store.HashEmbedderModel {
+		t.Errorf("fallback chain embedded %d dimensions as %q, %v; want hash vectors", len(vec), vecModel, err)
+	}
+	if _, ok := emb.(*embed.FallbackEmbedder); !ok {
+		t.Errorf("newEmbedder with a fallback = %T", emb)
+	}
+}
+
+func TestNewRedactor(t *testing.T) {
+	for _, setting := range []string{"", "none"} {
+		if r, err := newRedactor(config{Redact: setting}); r != nil || err != nil {
+			t.Errorf("newRedactor(%q) = %v, %v; want none", setting, r, err)
+		}
+	}
+	for setting, want := range map[string]string{
+		"all":          "[EMAIL] [PHONE]",
+		"email":        "[EMAIL] 555-123-4567",
+		" phone , ,  ": "alice@example.com [PHONE]",
+	} {
+		r, err := newRedactor(config{Redact: setting})
+		if err != nil {
+			t.Fatalf("newRedactor(%q): %v", setting, err)
+		}
+		out, err := r.Redact(context.Background(), model.SensoryInput{Content: "alice@example.com 555-123-4567"})
+		if err != nil || out.Content != want {
+			t.Errorf("newRedactor(%q) redacts to %q, %v; want %q", setting, out.Content, err, want)
+		}
+	}
+	if _, err := newRedactor(config{Redact: "email,ssn"}); err == nil || !strings.Contains(err.Error(), "ssn") {
+		t.Errorf("newRedactor with an unknown category = %v, want an error naming it", err)
+	}
+}
+
+func TestOpenEngineWithoutTheExtension(t *testing.T) {
+	ctx := context.Background()
+	missing := filepath.Join(t.TempDir(), "vss0.so")
+	opts := store.Options{DBPath: store.MemoryPath, EnableVSS: true, ExtensionsPath: missing,
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	engine, degraded, err := openEngine(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close()
+	if !strings.HasPrefix(degraded, "vector search disabled: ") || !strings.Contains(degraded, missing) {
+		t.Errorf("degraded = %q, want the missing extension named", degraded)
+	}
+
+	opts.VSSRequired = true
+	if _, _, err := openEngine(ctx, opts); !errors.Is(err, store.ErrVectorUnavailable) || !strings.Contains(err.Error(), "PAIM_VSS_REQUIRED") {
+		t.Errorf("openEngine with VSSRequired: %v, want ErrVectorUnavailable with a hint", err)
+	}
+}
+
+// failingDistiller fails every run.
+type failingDistiller struct{}
+
+func (failingDistiller) Distill(context.Context, []model.SensoryInput) ([]model.Triple, error) {
+	return nil, errors.New("model unavailable")
+}
+
+// syncBuffer is a bytes.Buffer safe to log to from another goroutine.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestConsolidationLoopWarnsAfterRepeatedFailures(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	engine := storetest.NewTestEngineWithOptions(t, store.Options{Distiller: failingDistiller{}})
+	var logs syncBuffer
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		startConsolidationLoop(ctx, engine, time.Hour, 3, slog.New(slog.NewTextHandler(&logs, nil)))
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	if err := engine.Observe(ctx, model.SensoryInput{Content: "Alice works at Acme."}); err != nil {
+		t.Fatal(err)
+	}
+
+	// failed runs are recorded, so wait for each before requesting the next
+	failRuns := func(n int) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			runs, err := engine.ConsolidationRuns(ctx, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(runs) >= n {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%d runs recorded, want %d", len(runs), n)
+			}
+			engine.RequestConsolidation()
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	failRuns(2)
+	if strings.Contains(logs.String(), "consolidation keeps failing") {
+		t.Fatalf("warned after two failures:\n%s", logs.String())
+	}
+	failRuns(3)
+	if n := strings.Count(logs.String(), "consolidation keeps failing"); n != 1 {
+		t.Errorf("warned %d times after three failures, want once:\n%s", n, logs.String())
+	}
+	if !strings.Contains(logs.String(), "consecutive_failures=3") {
+		t.Errorf("warning does not count the failures:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/johncui/PAIM/pkg/mcp"
+	"github.com/johncui/PAIM/pkg/store"
+)
+
+// runMCP opens the engine and serves MCP on stdin/stdout until the client
+// closes stdin. Consolidation keeps running in the background as it does
+// for the HTTP server, and runs once more on exit: clients start and stop
+// the process per session, and the sensory buffer does not survive it.
+func runMCP(ctx context.Context, opts store.Options, cfg config, logger *slog.Logger) error {
+	namespace, err := store.NormalizeNamespace(cfg.MCPNamespace)
+	if err != nil {
+		return fmt.Errorf("PAIM_MCP_NAMESPACE: %w", err)
+	}
+	engine, degraded, err := openEngine(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer engine.Close()
+	if degraded != "" {
+		logger.Warn("engine degraded", "reason", degraded)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if !cfg.ReadOnly {
+		go startConsolidationLoop(ctx, engine, cfg.ConsolidationEvery, cfg.ConsolidationFailureWarn, logger)
+	}
+
+	srv := mcp.NewServer(engine, mcp.Config{
+		MaxTopK:   cfg.MaxTopK,
+		Namespace: namespace,
+		Logger:    logger.With("component", "mcp"),
+	})
+	logger.Info("serving MCP on stdio", "db", cfg.dbForLog(), "namespace", namespace)
+	serveErr := srv.Serve(ctx, os.Stdin, os.Stdout)
+	cancel()
+	if err := engine.Consolidate(context.Background()); err != nil {
+		logger.Error("final consolidation failed", "err", err)
+	}
+	return serveErr
+}
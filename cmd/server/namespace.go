@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/johncui/PAIM/pkg/store"
+)
+
+// namespaceHeader selects the namespace of a request; the namespace query
+// parameter does the same for clients that cannot set headers, such as
+// browsers opening the event stream.
+const namespaceHeader = "X-PAIM-Namespace"
+
+type namespaceKey struct{}
+
+// withNamespace resolves the namespace of every request, answering 400 when
+// it is malformed, so handlers can read it with reqNamespace.
+func withNamespace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		raw := req.Header.Get(namespaceHeader)
+		if raw == "" {
+			raw = req.URL.Query().Get("namespace")
+		}
+		ns, err := store.NormalizeNamespace(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidInput, err.Error())
+			return
+		}
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), namespaceKey{}, ns)))
+	})
+}
+
+// reqNamespace returns the namespace withNamespace resolved for req.
+func reqNamespace(req *http.Request) string {
+	if ns, ok := req.Context().Value(namespaceKey{}).(string); ok {
+		return ns
+	}
+	return ""
+}
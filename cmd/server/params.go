@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// positiveIntParam reads a positive integer query parameter. A missing value
+// yields def, values above max are capped to max, and anything else that is
+// not a positive integer is an error the caller should report as 400.
+func positiveIntParam(q url.Values, name string, def, max int) (int, error) {
+	v := q.Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s must be a positive integer, got %q", name, v)
+	}
+	if max > 0 && n > max {
+		n = max
+	}
+	return n, nil
+}
+
+// metadataParams collects meta.<key>=<value> query parameters, keeping the
+// last value of a repeated key; it returns nil when there are none.
+func metadataParams(q url.Values) map[string]string {
+	var meta map[string]string
+	for key, values := range q {
+		if name, ok := strings.CutPrefix(key, "meta."); ok && len(values) > 0 {
+			if meta == nil {
+				meta = make(map[string]string)
+			}
+			meta[name] = values[len(values)-1]
+		}
+	}
+	return meta
+}
+
+// decodeOneOrMany decodes a request body holding either a single JSON object
+// or an array of them, reporting which it was.
+func decodeOneOrMany[T any](body io.Reader) ([]T, bool, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(body).Decode(&raw); err != nil {
+		return nil, false, err
+	}
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		var many []T
+		if err := json.Unmarshal(trimmed, &many); err != nil {
+			return nil, false, err
+		}
+		return many, true, nil
+	}
+	var one T
+	if err := json.Unmarshal(raw, &one); err != nil {
+		return nil, false, err
+	}
+	return []T{one}, false, nil
+}
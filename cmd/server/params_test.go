@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPositiveIntParam(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    int
+		wantErr bool
+	}{
+		{"", 5, false},
+		{"k=3", 3, false},
+		{"k=100", 100, false},
+		{"k=101", 100, false},
+		{"k=1000000", 100, false},
+		{"k=0", 0, true},
+		{"k=-1", 0, true},
+		{"k=abc", 0, true},
+		{"k=2.5", 0, true},
+		{"k=", 5, false},
+	}
+	for _, tt := range tests {
+		q, err := url.ParseQuery(tt.raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := positiveIntParam(q, "k", 5, 100)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("positiveIntParam(%q) = %d, %v; want %d, error %v", tt.raw, got, err, tt.want, tt.wantErr)
+		}
+	}
+	if got, _ := positiveIntParam(url.Values{"n": {"5000"}}, "n", 1, 0); got != 5000 {
+		t.Errorf("positiveIntParam without a max = %d, want 5000", got)
+	}
+}
+
+func TestMetadataParams(t *testing.T) {
+	q := url.Values{"meta.channel": {"a", "b"}, "meta.owner.name": {"x"}, "q": {"ignored"}}
+	got := metadataParams(q)
+	if len(got) != 2 || got["channel"] != "b" || got["owner.name"] != "x" {
+		t.Fatalf("metadataParams = %v", got)
+	}
+	if metadataParams(url.Values{"q": {"x"}}) != nil {
+		t.Fatal("metadataParams without meta. keys is not nil")
+	}
+}
+
+func TestDecodeOneOrMany(t *testing.T) {
+	type item struct{ Content string }
+	one, many, err := decodeOneOrMany[item](strings.NewReader(`{"Content":"a"}`))
+	if err != nil || many || len(one) != 1 || one[0].Content != "a" {
+		t.Fatalf("object: %+v, %v, %v", one, many, err)
+	}
+	list, many, err := decodeOneOrMany[item](strings.NewReader(` [{"Content":"a"},{"Content":"b"}]`))
+	if err != nil || !many || len(list) != 2 {
+		t.Fatalf("array: %+v, %v, %v", list, many, err)
+	}
+	if _, _, err := decodeOneOrMany[item](strings.NewReader(`{"Content":`)); err == nil {
+		t.Fatal("decodeOneOrMany accepted truncated JSON")
+	}
+}
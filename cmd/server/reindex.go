@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/store"
+)
+
+// reindexStatus is the body of GET /reindex.
+type reindexStatus struct {
+	Running    bool                `json:"running"`
+	StartedAt  *time.Time          `json:"started_at,omitempty"`
+	FinishedAt *time.Time          `json:"finished_at,omitempty"`
+	Progress   store.ReindexReport `json:"progress"`
+	Error      string              `json:"error,omitempty"`
+}
+
+// reindexJob runs at most one Reindex at a time in the background and keeps
+// the status of the latest run.
+type reindexJob struct {
+	mu     sync.Mutex
+	status reindexStatus
+}
+
+// start launches a run and reports false if one is already in progress.
+func (j *reindexJob) start(engine *store.MemoryEngine, opts store.ReindexOptions, logger *slog.Logger) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status.Running {
+		return false
+	}
+	now := time.Now().UTC()
+	j.status = reindexStatus{Running: true, StartedAt: &now}
+
+	opts.Progress = func(r store.ReindexReport) {
+		j.mu.Lock()
+		j.status.Progress = r
+		j.mu.Unlock()
+	}
+	go func() {
+		report, err := engine.Reindex(context.Background(), opts)
+		if err != nil {
+			logger.Error("reindex failed", "err", err)
+		}
+		finished := time.Now().UTC()
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		j.status.Running = false
+		j.status.FinishedAt = &finished
+		j.status.Progress = report
+		if err != nil {
+			// details stay in the server log, like other internal errors
+			j.status.Error = "reindex failed; see the server log"
+		}
+	}()
+	return true
+}
+
+func (j *reindexJob) get() reindexStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+)
+
+func TestReindexRunsInTheBackground(t *testing.T) {
+	srv, engine := newTestServer(t, testConfig(t), store.Options{
+		Embedder:        store.NewHashEmbedder(16),
+		VectorDim:       16,
+		StoreEmbeddings: true,
+		SyncEmbedding:   true,
+	})
+	for _, c := range []string{"a", "b", "c"} {
+		if err := engine.Observe(context.Background(), model.SensoryInput{Content: c}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var st reindexStatus
+	if status := do(t, "POST", srv.URL+"/reindex?batch_size=2", "", &st); status != http.StatusAccepted || st.StartedAt == nil {
+		t.Fatalf("POST /reindex = %d %+v, want 202 and a start time", status, st)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for st.Running || st.FinishedAt == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("reindex still running: %+v", st)
+		}
+		time.Sleep(10 * time.Millisecond)
+		st = reindexStatus{}
+		do(t, "GET", srv.URL+"/reindex", "", &st)
+	}
+	if p := st.Progress; st.Error != "" || p.Queued != 3 || p.Embedded != 3 || p.Remaining != 0 {
+		t.Fatalf("finished reindex = %+v, want all 3 logs embedded", st)
+	}
+
+	if status := do(t, "POST", srv.URL+"/reindex?batch_size=0", "", nil); status != http.StatusBadRequest {
+		t.Errorf("POST /reindex with a bad batch size = %d, want 400", status)
+	}
+}
+
+func TestReindexNeedsEmbeddings(t *testing.T) {
+	srv, _ := newTestServer(t, testConfig(t), store.Options{})
+	var out errorBody
+	if status := do(t, "POST", srv.URL+"/reindex", "", &out); status != http.StatusBadRequest || out.Error.Code != codeInvalidInput {
+		t.Fatalf("POST /reindex = %d %+v, want 400", status, out)
+	}
+}
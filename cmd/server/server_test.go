@@ -0,0 +1,650 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+// testConfig is the default configuration, as loaded from the environment.
+func testConfig(t *testing.T) config {
+	t.Helper()
+	cfg, _, err := loadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// newTestServer serves the API for cfg on an in-memory engine opened with
+// opt, ready as soon as it is returned.
+func newTestServer(t *testing.T, cfg config, opt store.Options) (*httptest.Server, *store.MemoryEngine) {
+	t.Helper()
+	engine := storetest.NewTestEngineWithOptions(t, opt)
+	var startup startupState
+	h, setEngine := newRouter(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), &startup)
+	setEngine(engine)
+	startup.set(stateReady, "")
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv, engine
+}
+
+// do sends a request with an optional JSON body and decodes the JSON reply,
+// error envelopes included, into out, if given, returning the status.
+func do(t *testing.T, method, u, body string, out any) int {
+	t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, u, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decode: %v", method, u, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestAskTimeRange(t *testing.T) {
+	srv, engine := newTestServer(t, testConfig(t), store.Options{})
+	ctx := context.Background()
+	if err := engine.Observe(ctx, model.SensoryInput{Content: "alice works at acme"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// facts are bounded by when they were stored, which is now
+	now := time.Now()
+	q := url.Values{"q": {"alice"}, "from": {now.Add(-time.Hour).Format(time.RFC3339)}, "to": {now.Add(time.Hour).Format(time.RFC3339)}}
+	var res model.RecalledContext
+	if status := do(t, "GET", srv.URL+"/ask?"+q.Encode(), "", &res); status != http.StatusOK {
+		t.Fatalf("status %d", status)
+	}
+	if len(res.RelatedFacts) != 1 {
+		t.Fatalf("facts = %+v, want the one stored within the hour", res.RelatedFacts)
+	}
+	q.Del("from")
+	q.Set("to", now.Add(-time.Hour).Format(time.RFC3339))
+	res = model.RecalledContext{}
+	if status := do(t, "GET", srv.URL+"/ask?"+q.Encode(), "", &res); status != http.StatusOK || len(res.RelatedFacts) != 0 {
+		t.Fatalf("status %d, facts %+v; want none stored over an hour ago", status, res.RelatedFacts)
+	}
+
+	for _, bad := range []string{"from=yesterday", "to=2026-06-01"} {
+		if status := do(t, "GET", srv.URL+"/ask?q=x&"+bad, "", nil); status != http.StatusBadRequest {
+			t.Errorf("/ask?%s = %d, want 400", bad, status)
+		}
+	}
+}
+
+func TestAskReportsDiagnostics(t *testing.T) {
+	srv, engine := newTestServer(t, testConfig(t), store.Options{})
+	if err := engine.Observe(context.Background(), model.SensoryInput{Content: "Alice works at Acme."}); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Consolidate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var res struct {
+		Diagnostics map[string]any `json:"diagnostics"`
+	}
+	if status := do(t, "GET", srv.URL+"/ask?q=+alice+&k=2", "", &res); status != http.StatusOK {
+		t.Fatalf("status %d", status)
+	}
+	d := res.Diagnostics
+	if d["query"] != "alice" || d["max_facts"] != 2.0 || d["vector_search"] != false || d["facts_matched"] != 1.0 {
+		t.Errorf("diagnostics = %v", d)
+	}
+	if timings, ok := d["timings_ms"].(map[string]any); !ok || timings["total"] == nil {
+		t.Errorf("diagnostics timings = %v, want a total", d["timings_ms"])
+	}
+}
+
+func TestAskValidatesK(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MaxTopK = 3
+	srv, engine := newTestServer(t, cfg, store.Options{MaxTopK: 3})
+	for _, c := range []string{"a", "b", "c", "d", "e"} {
+		if err := engine.Observe(context.Background(), model.SensoryInput{Content: c}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, k := range []string{"0", "-2", "ten", "1.5"} {
+		var e errorBody
+		if status := do(t, "GET", srv.URL+"/ask?k="+k, "", &e); status != http.StatusBadRequest || e.Error.Code != codeInvalidInput {
+			t.Errorf("/ask?k=%s = %d %+v, want 400 invalid_input", k, status, e)
+		}
+	}
+	var res model.RecalledContext
+	if status := do(t, "GET", srv.URL+"/ask?k=1000000", "", &res); status != http.StatusOK {
+		t.Fatalf("/ask?k=1000000 = %d, want it capped", status)
+	}
+	if len(res.RelatedLogs) != 3 {
+		t.Fatalf("%d logs for a capped k, want 3", len(res.RelatedLogs))
+	}
+}
+
+func TestStats(t *testing.T) {
+	srv, engine := newTestServer(t, testConfig(t), store.Options{})
+	if err := engine.Observe(context.Background(), model.SensoryInput{Content: "Alice works at Acme."}); err != nil {
+		t.Fatal(err)
+	}
+	var st store.EngineStats
+	if status := do(t, "GET", srv.URL+"/stats", "", &st); status != http.StatusOK {
+		t.Fatalf("GET /stats = %d", status)
+	}
+	if st.Logs != 1 || st.BufferLen != 1 || st.SchemaVersion == 0 {
+		t.Fatalf("stats = %+v, want one buffered log", st)
+	}
+}
+
+func TestRememberLimits(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MaxBodyBytes = 100
+	srv, engine := newTestServer(t, cfg, store.Options{MaxContentChars: 86})
+	// the JSON around the content is 14 bytes
+	body := func(n int) string { return `{"content":"` + strings.Repeat("x", n) + `"}` }
+	if len(body(86)) != cfg.MaxBodyBytes {
+		t.Fatalf("body(86) is %d bytes", len(body(86)))
+	}
+
+	for _, tt := range []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"at the limits", body(86), http.StatusCreated},
+		{"oversized body", body(87), http.StatusRequestEntityTooLarge},
+		{"far oversized body", body(1 << 20), http.StatusRequestEntityTooLarge},
+		{"empty content", body(0), http.StatusBadRequest},
+		{"blank content", `{"content":"  \n "}`, http.StatusBadRequest},
+		{"empty in a batch", `[{"content":"a"},{"content":""}]`, http.StatusBadRequest},
+	} {
+		var out errorBody
+		status := do(t, "POST", srv.URL+"/remember", tt.body, &out)
+		if status != tt.status {
+			t.Errorf("%s: status = %d %+v, want %d", tt.name, status, out, tt.status)
+		}
+		if status != http.StatusCreated && out.Error.Code != codeInvalidInput {
+			t.Errorf("%s: error = %+v, want %s", tt.name, out, codeInvalidInput)
+		}
+	}
+	if logs, err := engine.RecentLogs(context.Background(), "", 10); err != nil || len(logs) != 1 {
+		t.Fatalf("stored %d logs, %v; want only the one at the limits", len(logs), err)
+	}
+
+	srv, _ = newTestServer(t, cfg, store.Options{MaxContentChars: 10})
+	var out errorBody
+	if status := do(t, "POST", srv.URL+"/remember", body(11), &out); status != http.StatusBadRequest || out.Error.Code != codeInvalidInput {
+		t.Errorf("content over the character limit = %d %+v, want 400", status, out)
+	}
+}
+
+// unreachableEmbedder embeds with a HashEmbedder but fails its health check.
+type unreachableEmbedder struct{ *store.HashEmbedder }
+
+func (unreachableEmbedder) HealthCheck(context.Context) error {
+	return errors.New("connection refused")
+}
+
+func TestReadyNamesTheFailingComponent(t *testing.T) {
+	srv, _ := newTestServer(t, testConfig(t), store.Options{})
+	var rep store.HealthReport
+	if status := do(t, "GET", srv.URL+"/ready", "", &rep); status != http.StatusOK || !rep.OK {
+		t.Fatalf("GET /ready = %d %+v, want 200", status, rep)
+	}
+
+	srv, _ = newTestServer(t, testConfig(t), store.Options{Embedder: unreachableEmbedder{store.NewHashEmbedder(8)}})
+	rep = store.HealthReport{}
+	if status := do(t, "GET", srv.URL+"/ready", "", &rep); status != http.StatusServiceUnavailable || rep.OK {
+		t.Fatalf("GET /ready = %d %+v, want 503", status, rep)
+	}
+	if rep.Components["embedder"] != "connection refused" || rep.Components["database"] != store.HealthOK {
+		t.Errorf("components = %v, want only the embedder failing", rep.Components)
+	}
+	// liveness does not depend on the embedder
+	for _, path := range []string{"/livez", "/health"} {
+		if status := do(t, "GET", srv.URL+path, "", nil); status != http.StatusOK {
+			t.Errorf("GET %s = %d, want 200", path, status)
+		}
+	}
+}
+
+func TestDegradedVectorSearch(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "vss0.so")
+	srv, _ := newTestServer(t, testConfig(t), store.Options{EnableVSS: true, ExtensionsPath: missing})
+
+	var health map[string]string
+	if status := do(t, "GET", srv.URL+"/health", "", &health); status != http.StatusOK {
+		t.Fatalf("GET /health = %d", status)
+	}
+	if health["status"] != "ok" || health["vector_search"] != store.VectorDegraded || !strings.Contains(health["vector_error"], missing) {
+		t.Errorf("GET /health = %v, want vector search degraded by the missing extension", health)
+	}
+	var st model.EngineStats
+	if status := do(t, "GET", srv.URL+"/stats", "", &st); status != http.StatusOK || st.VectorSearch != store.VectorDegraded || st.VectorError == "" {
+		t.Errorf("GET /stats = %d, vector %q %q; want degraded", status, st.VectorSearch, st.VectorError)
+	}
+	var rep store.HealthReport
+	if status := do(t, "GET", srv.URL+"/ready", "", &rep); status != http.StatusOK || rep.Components["vector"] != store.HealthDegraded || rep.Detail["vector"] == "" {
+		t.Errorf("GET /ready = %d %+v, want ready with the vector degraded", status, rep)
+	}
+
+	srv, _ = newTestServer(t, testConfig(t), store.Options{})
+	health = nil
+	if do(t, "GET", srv.URL+"/health", "", &health); health["vector_search"] != store.VectorDisabled || health["vector_error"] != "" {
+		t.Errorf("GET /health without vector search = %v", health)
+	}
+}
+
+func TestRememberSessionID(t *testing.T) {
+	srv, _ := newTestServer(t, testConfig(t), store.Options{})
+	if status := do(t, "POST", srv.URL+"/remember", `{"content":"hello","session_id":"chat-1"}`, nil); status != http.StatusCreated {
+		t.Fatalf("remember = %d", status)
+	}
+	var res model.RecalledContext
+	if status := do(t, "GET", srv.URL+"/ask?expand_sessions=true", "", &res); status != http.StatusOK {
+		t.Fatalf("ask = %d", status)
+	}
+	if len(res.RelatedLogs) != 1 || res.RelatedLogs[0].SessionID != "chat-1" {
+		t.Errorf("logs = %+v, want the remembered one in session chat-1", res.RelatedLogs)
+	}
+
+	for _, bad := range []struct{ method, path, body string }{
+		{"POST", "/remember", `{"content":"x","session_id":"` + strings.Repeat("s", 257) + `"}`},
+		{"GET", "/ask?q=x&expand_sessions=true&session_window=-1", ""},
+	} {
+		var e errorBody
+		if status := do(t, bad.method, srv.URL+bad.path, bad.body, &e); status != http.StatusBadRequest || e.Error.Code != codeInvalidInput {
+			t.Errorf("%s %.40s = %d %+v, want 400 invalid_input", bad.method, bad.path, status, e)
+		}
+	}
+}
+
+func TestAskMinConfidence(t *testing.T) {
+	srv, engine := newTestServer(t, testConfig(t), store.Options{NeighborExpansion: -1})
+	if _, err := engine.Assert(context.Background(), []model.Triple{
+		{Subject: "alice", Predicate: "works_at", Object: "acme", Confidence: 0.9},
+		{Subject: "alice", Predicate: "knows", Object: "bob", Confidence: 0.3},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"min_confidence", "min_conf"} {
+		var res model.RecalledContext
+		if status := do(t, "GET", srv.URL+"/ask?q=alice&"+name+"=0.5", "", &res); status != http.StatusOK {
+			t.Fatalf("%s: status %d", name, status)
+		}
+		if len(res.RelatedFacts) != 1 || res.RelatedFacts[0].Object != "acme" {
+			t.Errorf("%s=0.5: facts %+v, want acme only", name, res.RelatedFacts)
+		}
+	}
+	for _, bad := range []string{"min_confidence=high", "min_conf=1.5"} {
+		var e errorBody
+		if status := do(t, "GET", srv.URL+"/ask?q=alice&"+bad, "", &e); status != http.StatusBadRequest || e.Error.Code != codeInvalidInput {
+			t.Errorf("/ask?%s = %d %+v, want 400 invalid_input", bad, status, e)
+		}
+	}
+}
+
+func TestPruneFacts(t *testing.T) {
+	srv, engine := newTestServer(t, testConfig(t), store.Options{})
+	if _, err := engine.Assert(context.Background(), []model.Triple{
+		{Subject: "alice", Predicate: "notes", Object: "maybe", Confidence: 0.3},
+		{Subject: "alice", Predicate: "works_at", Object: "acme", Confidence: 0.9},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]int64
+	if status := do(t, "POST", srv.URL+"/facts/prune", `{"max_age":"1ns","max_confidence":0.5}`, &out); status != http.StatusOK || out["deleted"] != 1 {
+		t.Errorf("prune = %d %v, want the low-confidence fact deleted", status, out)
+	}
+}
+
+func TestRememberReturnsIDs(t *testing.T) {
+	srv, engine := newTestServer(t, testConfig(t), store.Options{StoreEmbeddings: true, SyncEmbedding: true, DedupThreshold: 0.99})
+	var one model.ObserveResult
+	if status := do(t, "POST", srv.URL+"/remember", `{"content":"Alice works at Acme."}`, &one); status != http.StatusCreated || one.LogID == "" || one.Duplicate {
+		t.Fatalf("remember = %d %+v, want 201 with the new id", status, one)
+	}
+	if logs, err := engine.RecentLogs(context.Background(), "", 1); err != nil || len(logs) != 1 || logs[0].ID != one.LogID {
+		t.Errorf("latest log = %+v, %v; want %s", logs, err, one.LogID)
+	}
+
+	var many struct{ Results []model.ObserveResult }
+	if status := do(t, "POST", srv.URL+"/remember", `[{"content":"Bob lives in Berlin."},{"content":"Alice works at Acme."}]`, &many); status != http.StatusCreated {
+		t.Fatalf("batch = %d, want 201", status)
+	}
+	if len(many.Results) != 2 || many.Results[0].Duplicate || !many.Results[1].Duplicate || many.Results[1].LogID != one.LogID {
+		t.Errorf("batch results = %+v, want a new log and a duplicate of %s", many.Results, one.LogID)
+	}
+
+	var dup model.ObserveResult
+	if status := do(t, "POST", srv.URL+"/remember", `{"content":"Alice works at Acme."}`, &dup); status != http.StatusOK || !dup.Duplicate || dup.LogID != one.LogID {
+		t.Errorf("duplicate = %d %+v, want 200 pointing at %s", status, dup, one.LogID)
+	}
+}
+
+func TestGetLog(t *testing.T) {
+	srv, engine := newTestServer(t, testConfig(t), store.Options{})
+	var res model.ObserveResult
+	if status := do(t, "POST", srv.URL+"/remember", `{"content":"Alice works at Acme."}`, &res); status != http.StatusCreated {
+		t.Fatalf("remember = %d", status)
+	}
+	if err := engine.Consolidate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var detail store.LogDetail
+	if status := do(t, "GET", srv.URL+"/logs/"+res.LogID, "", &detail); status != http.StatusOK {
+		t.Fatalf("GET /logs/%s = %d", res.LogID, status)
+	}
+	if detail.Log.ID != res.LogID || detail.Embedding != store.EmbeddingDisabled || len(detail.Facts) != 1 || detail.Facts[0].Subject != "alice" {
+		t.Errorf("detail = %+v, want the log, its embedding state and the alice fact", detail)
+	}
+	var e errorBody
+	if status := do(t, "GET", srv.URL+"/logs/"+res.LogID+"?namespace=work", "", &e); status != http.StatusNotFound {
+		t.Errorf("log read from another namespace = %d %+v, want 404", status, e)
+	}
+}
+
+func TestPatchLog(t *testing.T) {
+	srv, _ := newTestServer(t, testConfig(t), store.Options{})
+	var res model.ObserveResult
+	if status := do(t, "POST", srv.URL+"/remember", `{"content":"draft","metadata":{"tags":["a"],"draft":true}}`, &res); status != http.StatusCreated {
+		t.Fatalf("remember = %d", status)
+	}
+	u := srv.URL + "/logs/" + res.LogID
+
+	var e model.LogEntry
+	if status := do(t, "PATCH", u, `{"content":"final","metadata":{"draft":null,"owner":"bob"}}`, &e); status != http.StatusOK {
+		t.Fatalf("PATCH = %d", status)
+	}
+	if e.Content != "final" || e.Metadata["draft"] != nil || e.Metadata["owner"] != "bob" || e.Metadata["tags"] == nil || e.UpdatedAt == nil {
+		t.Errorf("merged log = %+v, want the new content, merged metadata and an update time", e)
+	}
+	e = model.LogEntry{}
+	if status := do(t, "PATCH", u, `{"metadata":{"only":1},"metadata_mode":"replace"}`, &e); status != http.StatusOK || len(e.Metadata) != 1 {
+		t.Errorf("replace = %d %v, want the new metadata only", status, e.Metadata)
+	}
+
+	ifUpdated, err := json.Marshal(e.UpdatedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		body   string
+		status int
+		code   string
+	}{
+		{`{}`, http.StatusBadRequest, codeInvalidInput},
+		{`{"content":"x","metadata_mode":"append"}`, http.StatusBadRequest, codeInvalidInput},
+		{`{"content":"x","if_updated_at":"2020-01-01T00:00:00Z"}`, http.StatusConflict, codeConflict},
+	} {
+		var eb errorBody
+		if status := do(t, "PATCH", u, tc.body, &eb); status != tc.status || eb.Error.Code != tc.code {
+			t.Errorf("PATCH %s = %d %+v, want %d %s", tc.body, status, eb, tc.status, tc.code)
+		}
+	}
+	if status := do(t, "PATCH", u, `{"content":"again","if_updated_at":`+string(ifUpdated)+`}`, &e); status != http.StatusOK || e.Content != "again" {
+		t.Errorf("PATCH with the current updated_at = %d %+v", status, e)
+	}
+	if status := do(t, "PATCH", u+"?namespace=work", `{"content":"x"}`, nil); status != http.StatusNotFound {
+		t.Errorf("PATCH from another namespace = %d, want 404", status)
+	}
+}
+
+func TestRememberTimestamp(t *testing.T) {
+	srv, engine := newTestServer(t, testConfig(t), store.Options{})
+	var res model.ObserveResult
+	if status := do(t, "POST", srv.URL+"/remember", `{"content":"old","timestamp":"2019-03-04T05:06:07+02:00"}`, &res); status != http.StatusCreated {
+		t.Fatalf("remember = %d", status)
+	}
+	l, err := engine.Log(context.Background(), "", res.LogID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2019, 3, 4, 3, 6, 7, 0, time.UTC); !l.Log.Timestamp.Equal(want) {
+		t.Errorf("timestamp = %v, want %v", l.Log.Timestamp, want)
+	}
+
+	future := time.Now().Add(time.Hour).Format(time.RFC3339)
+	for _, body := range []string{`{"content":"x","timestamp":"` + future + `"}`, `{"content":"x","timestamp":"yesterday"}`} {
+		var e errorBody
+		if status := do(t, "POST", srv.URL+"/remember", body, &e); status != http.StatusBadRequest || e.Error.Code != codeInvalidInput {
+			t.Errorf("remember %s = %d %+v, want 400 invalid_input", body, status, e)
+		}
+	}
+}
+
+func TestAskFactAndLogLimits(t *testing.T) {
+	srv, engine := newTestServer(t, testConfig(t), store.Options{NeighborExpansion: -1})
+	for _, c := range []string{"Alice works at Acme.", "Alice lives in Berlin.", "Alice is a doctor."} {
+		if err := engine.Observe(context.Background(), model.SensoryInput{Content: c}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := engine.Consolidate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var res model.RecalledContext
+	if status := do(t, "GET", srv.URL+"/ask?k=1&k_facts=3", "", &res); status != http.StatusOK {
+		t.Fatalf("ask = %d", status)
+	}
+	if len(res.RelatedFacts) != 3 || len(res.RelatedLogs) != 1 {
+		t.Errorf("%d facts and %d logs, want 3 facts and 1 log", len(res.RelatedFacts), len(res.RelatedLogs))
+	}
+}
+
+func TestMatchModes(t *testing.T) {
+	srv, engine := newTestServer(t, testConfig(t), store.Options{NeighborExpansion: -1})
+	if _, err := engine.Assert(context.Background(), []model.Triple{
+		{Subject: "alice", Predicate: "works_at", Object: "acme", Confidence: 0.8},
+		{Subject: "alice", Predicate: "likes", Object: "tea", Confidence: 0.8},
+		{Subject: "malice", Predicate: "works_at", Object: "evil corp", Confidence: 0.8},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var res model.RecalledContext
+	if status := do(t, "GET", srv.URL+"/ask?q=alice&match=exact&predicate=works_at", "", &res); status != http.StatusOK {
+		t.Fatalf("ask = %d", status)
+	}
+	if len(res.RelatedFacts) != 1 || res.RelatedFacts[0].Object != "acme" {
+		t.Errorf("ask facts = %+v, want alice works_at acme only", res.RelatedFacts)
+	}
+	var page struct{ Facts []model.Triple }
+	if status := do(t, "GET", srv.URL+"/facts?subject=mal&match=prefix", "", &page); status != http.StatusOK {
+		t.Fatalf("facts = %d", status)
+	}
+	if len(page.Facts) != 1 || page.Facts[0].Subject != "malice" {
+		t.Errorf("facts = %+v, want malice's only", page.Facts)
+	}
+
+	res = model.RecalledContext{}
+	if status := do(t, "GET", srv.URL+"/ask?q=tea+corp&match=any", "", &res); status != http.StatusOK {
+		t.Fatalf("ask = %d", status)
+	}
+	if len(res.RelatedFacts) != 2 {
+		t.Errorf("ask facts = %+v, want the tea and evil corp facts", res.RelatedFacts)
+	}
+	page.Facts = nil
+	if status := do(t, "GET", srv.URL+"/facts?object=corp+evil&match=all", "", &page); status != http.StatusOK {
+		t.Fatalf("facts = %d", status)
+	}
+	if len(page.Facts) != 1 || page.Facts[0].Subject != "malice" {
+		t.Errorf("facts = %+v, want malice's only", page.Facts)
+	}
+}
+
+func TestSupersededFacts(t *testing.T) {
+	srv, engine := newTestServer(t, testConfig(t), store.Options{FunctionalPredicates: []string{"lives_in"}, NeighborExpansion: -1})
+	for _, city := range []string{"paris", "berlin"} {
+		if _, err := engine.Assert(context.Background(), []model.Triple{{Subject: "alice", Predicate: "lives_in", Object: city, Confidence: 0.8}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tt := range []struct {
+		query string
+		want  int
+	}{
+		{"", 1},
+		{"&include_superseded=true", 2},
+	} {
+		var res model.RecalledContext
+		if status := do(t, "GET", srv.URL+"/ask?q=alice"+tt.query, "", &res); status != http.StatusOK {
+			t.Fatalf("ask = %d", status)
+		}
+		if len(res.RelatedFacts) != tt.want || res.RelatedFacts[0].Object != "berlin" {
+			t.Errorf("/ask%s facts = %+v, want %d with berlin first", tt.query, res.RelatedFacts, tt.want)
+		}
+		var page struct{ Facts []model.Triple }
+		if status := do(t, "GET", srv.URL+"/facts?subject=alice"+tt.query, "", &page); status != http.StatusOK {
+			t.Fatalf("facts = %d", status)
+		}
+		if len(page.Facts) != tt.want {
+			t.Errorf("/facts%s = %+v, want %d", tt.query, page.Facts, tt.want)
+		}
+		if tt.want == 2 && page.Facts[0].SupersededBy != page.Facts[1].ID {
+			t.Errorf("paris superseded by %d, want berlin's id %d", page.Facts[0].SupersededBy, page.Facts[1].ID)
+		}
+	}
+}
+
+func TestDeleteLogs(t *testing.T) {
+	srv, engine := newTestServer(t, testConfig(t), store.Options{})
+	for _, body := range []string{
+		`{"content":"old chat","source":"chat","timestamp":"2020-01-01T00:00:00Z"}`,
+		`{"content":"new chat","source":"chat"}`,
+		`{"content":"old mail","source":"mail","timestamp":"2020-01-01T00:00:00Z"}`,
+	} {
+		if status := do(t, "POST", srv.URL+"/remember", body, nil); status != http.StatusCreated {
+			t.Fatalf("POST /remember %s = %d", body, status)
+		}
+	}
+
+	var e errorBody
+	if status := do(t, "DELETE", srv.URL+"/logs", "", &e); status != http.StatusBadRequest || !strings.Contains(e.Error.Message, "confirm=all") {
+		t.Errorf("DELETE /logs without a filter = %d %+v, want 400 pointing at confirm=all", status, e)
+	}
+	for _, q := range []string{"before=yesterday", "after=2020-01-02", "after=2021-01-01T00:00:00Z&before=2020-01-01T00:00:00Z"} {
+		if status := do(t, "DELETE", srv.URL+"/logs?"+q, "", nil); status != http.StatusBadRequest {
+			t.Errorf("DELETE /logs?%s = %d, want 400", q, status)
+		}
+	}
+
+	var out struct{ Deleted int64 }
+	if status := do(t, "DELETE", srv.URL+"/logs?source=chat&before=2021-01-01T00:00:00Z", "", &out); status != http.StatusOK || out.Deleted != 1 {
+		t.Errorf("DELETE old chat logs = %d %+v, want 1 deleted", status, out)
+	}
+	logs, err := engine.RecentLogs(context.Background(), "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 {
+		t.Errorf("%d logs left, want new chat and old mail", len(logs))
+	}
+	if status := do(t, "DELETE", srv.URL+"/logs?confirm=all", "", &out); status != http.StatusOK || out.Deleted != 2 {
+		t.Errorf("DELETE /logs?confirm=all = %d %+v, want 2 deleted", status, out)
+	}
+}
+
+func TestGetBuffer(t *testing.T) {
+	srv, _ := newTestServer(t, testConfig(t), store.Options{ConsolidateFillRatio: -1})
+	if status := do(t, "POST", srv.URL+"/remember?namespace=work", `{"content":"Alice works at Acme.","source":"chat"}`, nil); status != http.StatusCreated {
+		t.Fatalf("POST /remember = %d", status)
+	}
+	var out struct {
+		Items []store.BufferedInput `json:"items"`
+	}
+	if status := do(t, "GET", srv.URL+"/buffer?namespace=work", "", &out); status != http.StatusOK {
+		t.Fatalf("GET /buffer = %d", status)
+	}
+	if len(out.Items) != 1 || out.Items[0].Input.Content != "Alice works at Acme." || out.Items[0].Input.Source != "chat" || out.Items[0].Seq == 0 {
+		t.Errorf("work buffer = %+v, want the remembered input", out.Items)
+	}
+
+	var raw map[string]json.RawMessage
+	if status := do(t, "GET", srv.URL+"/buffer", "", &raw); status != http.StatusOK || string(raw["items"]) != "[]" {
+		t.Errorf("GET /buffer of the default namespace = %d %s, want an empty list", status, raw["items"])
+	}
+	if status := do(t, "GET", srv.URL+"/buffer?namespace=a%20b", "", nil); status != http.StatusBadRequest {
+		t.Errorf("GET /buffer of a malformed namespace = %d, want 400", status)
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "paim.db")
+	srv, _ := newTestServer(t, testConfig(t), store.Options{DBPath: path, MaintenanceInterval: -1, CheckpointWALBytes: 1})
+	if status := do(t, "POST", srv.URL+"/remember", `{"content":"Alice works at Acme."}`, nil); status != http.StatusCreated {
+		t.Fatalf("POST /remember = %d", status)
+	}
+	var report store.MaintenanceReport
+	if status := do(t, "POST", srv.URL+"/maintenance", "", &report); status != http.StatusOK {
+		t.Fatalf("POST /maintenance = %d", status)
+	}
+	if report.Checkpoint != sqlite.CheckpointTruncate || report.WALBytesBefore == 0 || report.WALBytesAfter != 0 {
+		t.Errorf("maintenance = %+v, want the WAL truncated", report)
+	}
+}
+
+func TestReadOnlyServer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "paim.db")
+	rw, err := store.NewMemoryEngine(context.Background(), store.Options{DBPath: path, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.Observe(context.Background(), model.SensoryInput{Content: "Alice works at Acme."}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConfig(t)
+	cfg.ReadOnly = true
+	srv, _ := newTestServer(t, cfg, store.Options{DBPath: path, ReadOnly: true})
+	for _, tt := range []struct{ method, path, body string }{
+		{"POST", "/remember", `{"content":"Alice works at Acme."}`},
+		{"POST", "/consolidate", ""},
+		{"POST", "/facts", `{"facts":[{"subject":"alice","predicate":"knows","object":"bob"}]}`},
+		{"POST", "/prune", ""},
+		{"POST", "/maintenance", ""},
+		{"POST", "/reindex", ""},
+	} {
+		var body errorBody
+		if status := do(t, tt.method, srv.URL+tt.path, tt.body, &body); status != http.StatusMethodNotAllowed || body.Error.Code != codeReadOnly {
+			t.Errorf("%s %s = %d %q, want 405 read_only", tt.method, tt.path, status, body.Error.Code)
+		}
+	}
+	// the snapshot written above is served, not a fresh database
+	var st model.EngineStats
+	if status := do(t, "GET", srv.URL+"/stats", "", &st); status != http.StatusOK || st.Logs != 1 {
+		t.Errorf("GET /stats = %d with %d logs, want 200 with the seeded log", status, st.Logs)
+	}
+}
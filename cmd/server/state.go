@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// Startup states reported by /readyz.
+const (
+	stateStarting = "starting"
+	stateReady    = "ready"
+	stateDegraded = "degraded"
+	stateFailed   = "failed"
+)
+
+// startupStatus is a snapshot of engine initialization.
+type startupStatus struct {
+	State string `json:"state"`
+	// Detail explains a degraded or failed state.
+	Detail string `json:"detail,omitempty"`
+}
+
+// startupState is read by request handlers while initialization runs in the
+// background. Publishing ready or degraded happens after the engine is
+// assigned, so a handler that observed either state may use the engine.
+type startupState struct {
+	v atomic.Pointer[startupStatus]
+}
+
+func (s *startupState) set(state, detail string) {
+	s.v.Store(&startupStatus{State: state, Detail: detail})
+}
+
+func (s *startupState) get() startupStatus {
+	if st := s.v.Load(); st != nil {
+		return *st
+	}
+	return startupStatus{State: stateStarting}
+}
+
+func (st startupStatus) serving() bool {
+	return st.State == stateReady || st.State == stateDegraded
+}
+
+// requireEngine answers 503 until the engine is initialized, except for the
+// liveness and readiness probes which report startup state themselves, and
+// the HTTP statistics, which do not involve the engine.
+func (s *startupState) requireEngine(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if isLiveness(req.URL.Path) || req.URL.Path == "/readyz" || req.URL.Path == httpStatsPath {
+			next.ServeHTTP(w, req)
+			return
+		}
+		switch st := s.get(); st.State {
+		case stateReady, stateDegraded:
+			next.ServeHTTP(w, req)
+		case stateFailed:
+			writeError(w, http.StatusServiceUnavailable, codeUnavailable, "engine failed to initialize: "+st.Detail)
+		default:
+			writeError(w, http.StatusServiceUnavailable, codeUnavailable, "server is starting")
+		}
+	})
+}
+
+func isLiveness(path string) bool {
+	return path == "/health" || path == "/livez"
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+func TestStartupStates(t *testing.T) {
+	var startup startupState
+	h, setEngine := newRouter(testConfig(t), slog.New(slog.NewTextHandler(io.Discard, nil)), &startup)
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	probe := func(path string) (int, string) {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+	expect := func(state string, want map[string]int, body map[string]string) {
+		t.Helper()
+		for path, status := range want {
+			got, b := probe(path)
+			if got != status {
+				t.Errorf("%s: GET %s = %d %s, want %d", state, path, got, b, status)
+			}
+			if s, ok := body[path]; ok && !strings.Contains(b, s) {
+				t.Errorf("%s: GET %s body %s, want it to mention %q", state, path, b, s)
+			}
+		}
+	}
+
+	// no engine yet: nothing may reach it
+	expect(stateStarting, map[string]int{
+		"/livez": 200, "/health": 200, "/readyz": 503,
+		"/ask?q=x": 503, "/stats": 503, "/ready": 503,
+	}, map[string]string{"/readyz": `"state":"starting"`, "/ask?q=x": "server is starting"})
+	resp, err := http.Post(srv.URL+"/remember", "application/json", strings.NewReader(`{"content":"x"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("POST /remember while starting = %d, want 503", resp.StatusCode)
+	}
+
+	startup.set(stateFailed, "migration 14: disk full")
+	expect(stateFailed, map[string]int{"/livez": 200, "/readyz": 503, "/ask?q=x": 503},
+		map[string]string{"/readyz": "disk full", "/ask?q=x": "disk full"})
+
+	setEngine(storetest.NewTestEngine(t))
+	startup.set(stateDegraded, "vector search unavailable")
+	expect(stateDegraded, map[string]int{"/readyz": 200, "/ask?q=x": 200},
+		map[string]string{"/readyz": `"state":"degraded"`})
+
+	startup.set(stateReady, "")
+	expect(stateReady, map[string]int{"/livez": 200, "/readyz": 200, "/ask?q=x": 200, "/stats": 200},
+		map[string]string{"/readyz": `"state":"ready"`})
+}
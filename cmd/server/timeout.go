@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// requestTimeout bounds the context of every request except the routes that
+// legitimately run long (streaming an export or the event feed, a backup, an
+// LLM consolidation). Handlers pass the context to the engine, and a request
+// that runs out of time is answered with 504 by writeEngineError.
+func requestTimeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if d <= 0 || isLongRunning(req.URL.Path) {
+				next.ServeHTTP(w, req)
+				return
+			}
+			ctx, cancel := context.WithTimeout(req.Context(), d)
+			defer cancel()
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
+
+func isLongRunning(path string) bool {
+	switch path {
+	case "/export", "/import", "/backup", "/consolidate", "/prune", "/maintenance", "/events":
+		return true
+	}
+	return false
+}
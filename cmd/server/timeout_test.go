@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/store"
+)
+
+func TestRequestTimeoutSetsADeadline(t *testing.T) {
+	for _, tt := range []struct {
+		timeout time.Duration
+		path    string
+		want    bool
+	}{
+		{time.Second, "/ask", true},
+		{time.Second, "/remember", true},
+		{time.Second, "/export", false},
+		{time.Second, "/consolidate", false},
+		{time.Second, "/maintenance", false},
+		{0, "/ask", false},
+	} {
+		var got bool
+		h := requestTimeout(tt.timeout)(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+			_, got = req.Context().Deadline()
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if got != tt.want {
+			t.Errorf("timeout %v on %s: deadline set = %v, want %v", tt.timeout, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestTimedOutRequestIs504(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.RequestTimeout = time.Nanosecond
+	srv, _ := newTestServer(t, cfg, store.Options{})
+
+	var body errorBody
+	if code := do(t, http.MethodGet, srv.URL+"/ask?q=Alice", "", &body); code != http.StatusGatewayTimeout {
+		t.Fatalf("status %d, want 504", code)
+	}
+	if body.Error.Code != codeTimeout {
+		t.Errorf("error code %q, want %q", body.Error.Code, codeTimeout)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// setupTracing installs a global tracer provider exporting spans over OTLP/HTTP.
+// The exporter reads the standard OTEL_EXPORTER_OTLP_* environment variables
+// (endpoint, headers, ...). The returned function flushes pending spans.
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	exp, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName("paim")))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp.Shutdown, nil
+}
+
+// traceRequests wraps the router so each request gets a server span that the
+// engine's spans nest under. Span names are the method only; raw paths such
+// as /facts/42 would make names unbounded.
+func traceRequests(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "paim", otelhttp.WithSpanNameFormatter(func(_ string, req *http.Request) string {
+		return "HTTP " + req.Method
+	}))
+}
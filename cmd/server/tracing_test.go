@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceRequests(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	var inner trace.SpanContext
+	h := traceRequests(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		inner = trace.SpanContextFromContext(req.Context())
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/facts/42", nil))
+
+	spans := rec.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("%d spans, want 1", len(spans))
+	}
+	if name := spans[0].Name(); name != "HTTP GET" {
+		t.Errorf("span name %q, want the method only", name)
+	}
+	if inner.SpanID() != spans[0].SpanContext().SpanID() {
+		t.Error("handler context does not carry the request span")
+	}
+}
@@ -0,0 +1,496 @@
+// Package client talks to a PAIM server over its HTTP API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// Client is a PAIM HTTP API client.
+type Client struct {
+	baseURL    string
+	apiKey     string
+	namespace  string
+	httpClient *http.Client
+	timeout    time.Duration
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient makes the client send requests with hc, e.g. to customize
+// transport or TLS settings.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithTimeout bounds each request, including reading the response body.
+// Contexts passed to the methods can shorten it further.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) { c.timeout = d }
+}
+
+// WithNamespace scopes every request to namespace, sent as the
+// X-PAIM-Namespace header; the server uses "default" without it.
+func WithNamespace(namespace string) Option {
+	return func(c *Client) { c.namespace = namespace }
+}
+
+// New creates a client for addr ("host:port" or a full URL). apiKey is sent
+// as a bearer token when non-empty.
+func New(addr, apiKey string, opts ...Option) *Client {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	c := &Client{baseURL: strings.TrimRight(addr, "/"), apiKey: apiKey, httpClient: &http.Client{}}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.timeout > 0 {
+		hc := *c.httpClient
+		hc.Timeout = c.timeout
+		c.httpClient = &hc
+	}
+	return c
+}
+
+// Errors matched by errors.Is against an *APIError with the corresponding
+// code, e.g. errors.Is(err, client.ErrNotFound).
+var (
+	ErrInvalidInput = errors.New("paim: invalid input")
+	ErrNotFound     = errors.New("paim: not found")
+	ErrConflict     = errors.New("paim: conflict")
+	ErrReadOnly     = errors.New("paim: read-only")
+	ErrUnauthorized = errors.New("paim: unauthorized")
+	ErrForbidden    = errors.New("paim: forbidden")
+	ErrUnavailable  = errors.New("paim: unavailable")
+	ErrTimeout      = errors.New("paim: timeout")
+	ErrInternal     = errors.New("paim: internal error")
+)
+
+var errorsByCode = map[string]error{
+	"invalid_input": ErrInvalidInput,
+	"not_found":     ErrNotFound,
+	"conflict":      ErrConflict,
+	"read_only":     ErrReadOnly,
+	"unauthorized":  ErrUnauthorized,
+	"forbidden":     ErrForbidden,
+	"unavailable":   ErrUnavailable,
+	"timeout":       ErrTimeout,
+	"internal":      ErrInternal,
+}
+
+// APIError is a non-2xx response from the server.
+type APIError struct {
+	Status int
+	// Code is the machine-readable error code, e.g. "invalid_input" or
+	// "not_found"; empty when the response was not a PAIM error body.
+	Code    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("paim: %d %s: %s", e.Status, e.Code, e.Message)
+	}
+	return fmt.Sprintf("paim: %d %s: %s", e.Status, http.StatusText(e.Status), e.Message)
+}
+
+// Is reports whether target is the sentinel error for e's code.
+func (e *APIError) Is(target error) bool {
+	sentinel, ok := errorsByCode[e.Code]
+	return ok && sentinel == target
+}
+
+// FactsQuery filters and pages ListFacts.
+type FactsQuery struct {
+	Subject       string
+	Predicate     string
+	Object        string
+	MinConfidence float64
+	Cursor        int64
+	Limit         int
+	// Match is how Subject, Predicate and Object match: "exact" (the
+	// default), "prefix", "contains", "phrase", or per word "any" or "all".
+	Match string
+	// IncludeSuperseded lists superseded facts too.
+	IncludeSuperseded bool
+	// AsOf, when set, lists only facts valid at that instant.
+	AsOf time.Time
+}
+
+// FactsPage is one page of facts.
+type FactsPage struct {
+	Facts      []model.Triple `json:"facts"`
+	NextCursor int64          `json:"next_cursor"`
+	Remaining  int64          `json:"remaining"`
+}
+
+// ImportReport counts what an import added.
+type ImportReport struct {
+	Logs  int64 `json:"logs"`
+	Facts int64 `json:"facts"`
+}
+
+// ReindexStatus is the state of the server's latest reindex run.
+type ReindexStatus struct {
+	Running    bool       `json:"running"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Progress   struct {
+		Queued          int64   `json:"queued"`
+		Embedded        int64   `json:"embedded"`
+		Failed          int64   `json:"failed"`
+		Remaining       int64   `json:"remaining"`
+		DurationSeconds float64 `json:"duration_seconds"`
+	} `json:"progress"`
+	Error string `json:"error,omitempty"`
+}
+
+// Remember records a new memory and returns the ID of its log entry. When
+// the server drops the input as a near-duplicate, the result names the
+// existing entry and has Duplicate set.
+func (c *Client) Remember(ctx context.Context, in model.SensoryInput) (model.ObserveResult, error) {
+	var out model.ObserveResult
+	err := c.doJSON(ctx, http.MethodPost, "/remember", nil, in, &out)
+	return out, err
+}
+
+// RememberBatch records several memories in one request; either all are
+// stored or none. The results are in input order.
+func (c *Client) RememberBatch(ctx context.Context, in []model.SensoryInput) ([]model.ObserveResult, error) {
+	var out struct {
+		Results []model.ObserveResult `json:"results"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, "/remember", nil, in, &out); err != nil {
+		return nil, err
+	}
+	return out.Results, nil
+}
+
+// AskOption narrows Ask.
+type AskOption func(url.Values)
+
+// WithTopK sets how many results Ask returns; k <= 0 keeps the server
+// default (5).
+func WithTopK(k int) AskOption {
+	return func(q url.Values) {
+		if k > 0 {
+			q.Set("k", strconv.Itoa(k))
+		}
+	}
+}
+
+// WithFactLimit and WithLogLimit set how many facts and logs Ask returns,
+// independently of WithTopK; n <= 0 keeps the top-k limit.
+func WithFactLimit(n int) AskOption {
+	return func(q url.Values) {
+		if n > 0 {
+			q.Set("k_facts", strconv.Itoa(n))
+		}
+	}
+}
+
+// WithLogLimit is WithFactLimit for logs.
+func WithLogLimit(n int) AskOption {
+	return func(q url.Values) {
+		if n > 0 {
+			q.Set("k_logs", strconv.Itoa(n))
+		}
+	}
+}
+
+// WithSource restricts Ask to logs with this source, and to facts distilled
+// from them.
+func WithSource(source string) AskOption {
+	return func(q url.Values) { q.Set("source", source) }
+}
+
+// WithMetadata requires a log's metadata key to equal value.
+func WithMetadata(key, value string) AskOption {
+	return func(q url.Values) { q.Set("meta."+key, value) }
+}
+
+// WithTimeRange bounds log timestamps and fact creation times; a zero bound
+// is open.
+func WithTimeRange(from, to time.Time) AskOption {
+	return func(q url.Values) {
+		if !from.IsZero() {
+			q.Set("from", from.Format(time.RFC3339))
+		}
+		if !to.IsZero() {
+			q.Set("to", to.Format(time.RFC3339))
+		}
+	}
+}
+
+// WithPredicate restricts Ask to facts with this predicate.
+func WithPredicate(predicate string) AskOption {
+	return func(q url.Values) { q.Set("predicate", predicate) }
+}
+
+// WithMatch sets how the query matches fact subjects and objects: "exact",
+// "prefix", "contains" (the server default) or "phrase", or per word:
+// "any" or "all".
+func WithMatch(mode string) AskOption {
+	return func(q url.Values) { q.Set("match", mode) }
+}
+
+// WithSuperseded also returns facts superseded by a newer value of a
+// functional predicate.
+func WithSuperseded() AskOption {
+	return func(q url.Values) { q.Set("include_superseded", "true") }
+}
+
+// WithAsOf returns only facts valid at instant t, superseded or not.
+func WithAsOf(t time.Time) AskOption {
+	return func(q url.Values) { q.Set("as_of", t.Format(time.RFC3339)) }
+}
+
+// WithMinConfidence drops facts below confidence c.
+func WithMinConfidence(c float64) AskOption {
+	return func(q url.Values) { q.Set("min_confidence", strconv.FormatFloat(c, 'f', -1, 64)) }
+}
+
+// WithRecencyHalfLife scales ranked scores down by age, halving them every
+// halfLife; 0 turns off the server's default scaling for this request.
+func WithRecencyHalfLife(halfLife time.Duration) AskOption {
+	return func(q url.Values) { q.Set("recency_halflife", halfLife.String()) }
+}
+
+// WithSessions adds the conversation around each log hit that belongs to a
+// session, window entries per side; window <= 0 keeps the server default.
+func WithSessions(window int) AskOption {
+	return func(q url.Values) {
+		q.Set("expand_sessions", "true")
+		if window > 0 {
+			q.Set("session_window", strconv.Itoa(window))
+		}
+	}
+}
+
+// Ask recalls context for query; an empty query returns recent context.
+func (c *Client) Ask(ctx context.Context, query string, opts ...AskOption) (*model.RecalledContext, error) {
+	q := url.Values{"q": {query}}
+	for _, opt := range opts {
+		opt(q)
+	}
+	var out model.RecalledContext
+	if err := c.doJSON(ctx, http.MethodGet, "/ask", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListFacts returns one page of facts.
+func (c *Client) ListFacts(ctx context.Context, fq FactsQuery) (*FactsPage, error) {
+	q := url.Values{}
+	setIf := func(k, v string) {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	setIf("subject", fq.Subject)
+	setIf("predicate", fq.Predicate)
+	setIf("object", fq.Object)
+	setIf("match", fq.Match)
+	if fq.IncludeSuperseded {
+		q.Set("include_superseded", "true")
+	}
+	if !fq.AsOf.IsZero() {
+		q.Set("as_of", fq.AsOf.Format(time.RFC3339))
+	}
+	if fq.MinConfidence > 0 {
+		q.Set("min_confidence", strconv.FormatFloat(fq.MinConfidence, 'f', -1, 64))
+	}
+	if fq.Cursor > 0 {
+		q.Set("cursor", strconv.FormatInt(fq.Cursor, 10))
+	}
+	if fq.Limit > 0 {
+		q.Set("limit", strconv.Itoa(fq.Limit))
+	}
+	var out FactsPage
+	if err := c.doJSON(ctx, http.MethodGet, "/facts", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RecentLogs returns the latest logs, newest first.
+func (c *Client) RecentLogs(ctx context.Context, limit int) ([]model.LogEntry, error) {
+	return c.LogsByMetadata(ctx, nil, limit)
+}
+
+// LogsByMetadata returns the latest logs whose metadata matches every
+// filter, newest first; dotted keys address nested objects. No filters
+// behaves like RecentLogs.
+func (c *Client) LogsByMetadata(ctx context.Context, filters map[string]string, limit int) ([]model.LogEntry, error) {
+	q := url.Values{}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	for k, v := range filters {
+		q.Set("meta."+k, v)
+	}
+	var out struct {
+		Logs []model.LogEntry `json:"logs"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, "/logs", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Logs, nil
+}
+
+// Consolidate distills the server's sensory buffer now.
+func (c *Client) Consolidate(ctx context.Context) error {
+	return c.doJSON(ctx, http.MethodPost, "/consolidate", nil, nil, nil)
+}
+
+// ConsolidationRuns returns the latest consolidation runs, newest first;
+// limit <= 0 uses the server default.
+func (c *Client) ConsolidationRuns(ctx context.Context, limit int) ([]model.ConsolidationRun, error) {
+	q := url.Values{}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	var out struct {
+		Runs []model.ConsolidationRun `json:"runs"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, "/consolidations", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Runs, nil
+}
+
+// Stats returns the server's engine statistics.
+func (c *Client) Stats(ctx context.Context) (*model.EngineStats, error) {
+	var out model.EngineStats
+	if err := c.doJSON(ctx, http.MethodGet, "/stats", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Export streams the server's export document to w.
+func (c *Client) Export(ctx context.Context, w io.Writer) error {
+	resp, err := c.do(ctx, http.MethodGet, "/export", nil, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// Import uploads an export document read from r.
+func (c *Client) Import(ctx context.Context, r io.Reader) (*ImportReport, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/import", nil, r, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var out ImportReport
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Reindex starts re-embedding every log in the background. With resume set
+// it only drains what an interrupted run left queued.
+func (c *Client) Reindex(ctx context.Context, resume bool) (*ReindexStatus, error) {
+	q := url.Values{}
+	if resume {
+		q.Set("resume", "true")
+	}
+	var out ReindexStatus
+	if err := c.doJSON(ctx, http.MethodPost, "/reindex", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ReindexStatus reports the progress of the latest reindex.
+func (c *Client) ReindexStatus(ctx context.Context) (*ReindexStatus, error) {
+	var out ReindexStatus
+	if err := c.doJSON(ctx, http.MethodGet, "/reindex", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// doJSON sends in (if non-nil) as JSON and decodes the response into out (if
+// non-nil).
+func (c *Client) doJSON(ctx context.Context, method, path string, q url.Values, in, out any) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body, contentType = bytes.NewReader(b), "application/json"
+	}
+	resp, err := c.do(ctx, method, path, q, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// do performs a request and turns non-2xx responses into *APIError.
+func (c *Client) do(ctx context.Context, method, path string, q url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	u := c.baseURL + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	if c.namespace != "" {
+		req.Header.Set("X-PAIM-Namespace", c.namespace)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		apiErr := &APIError{Status: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+		var body struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(msg, &body) == nil && body.Error.Code != "" {
+			apiErr.Code, apiErr.Message = body.Error.Code, body.Error.Message
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRequestHeaders(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = req.Header.Clone()
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	if _, err := New(srv.URL, "key", WithNamespace("work")).Stats(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("Authorization") != "Bearer key" || got.Get("X-PAIM-Namespace") != "work" {
+		t.Errorf("headers = %v", got)
+	}
+	if _, err := New(srv.URL, "").Stats(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("Authorization") != "" || got.Get("X-PAIM-Namespace") != "" {
+		t.Errorf("headers without key or namespace = %v", got)
+	}
+}
+
+func TestNewAddress(t *testing.T) {
+	for addr, want := range map[string]string{
+		"localhost:8080":         "http://localhost:8080",
+		"https://paim.example/":  "https://paim.example",
+		"http://10.0.0.1:9/base": "http://10.0.0.1:9/base",
+	} {
+		if got := New(addr, "").baseURL; got != want {
+			t.Errorf("New(%q) base URL = %q, want %q", addr, got, want)
+		}
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	for _, tt := range []struct {
+		status int
+		body   string
+		want   error
+		code   string
+	}{
+		{404, `{"error":{"code":"not_found","message":"no such fact"}}`, ErrNotFound, "not_found"},
+		{409, `{"error":{"code":"conflict","message":"busy"}}`, ErrConflict, "conflict"},
+		{405, `{"error":{"code":"read_only","message":"the server is read-only"}}`, ErrReadOnly, "read_only"},
+		{403, `{"error":{"code":"forbidden","message":"origin not allowed"}}`, ErrForbidden, "forbidden"},
+		{504, `{"error":{"code":"timeout","message":"request timed out"}}`, ErrTimeout, "timeout"},
+		{502, `bad gateway`, nil, ""},
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(tt.status)
+			w.Write([]byte(tt.body))
+		}))
+		_, err := New(srv.URL, "").Stats(context.Background())
+		srv.Close()
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.Status != tt.status || apiErr.Code != tt.code {
+			t.Errorf("%d %s: error %#v", tt.status, tt.body, err)
+			continue
+		}
+		if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%d: %v is not %v", tt.status, err, tt.want)
+		}
+		if tt.want == nil && (errors.Is(err, ErrInternal) || apiErr.Message != tt.body) {
+			t.Errorf("%d without an error body: %#v", tt.status, apiErr)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-release:
+		case <-req.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	start := time.Now()
+	if err := New(srv.URL, "", WithTimeout(50*time.Millisecond)).Consolidate(context.Background()); err == nil {
+		t.Fatal("hung request succeeded")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("request gave up after %v, want about the 50ms timeout", d)
+	}
+
+	// the option copies the http.Client instead of modifying it
+	hc := &http.Client{}
+	New(srv.URL, "", WithHTTPClient(hc), WithTimeout(time.Second))
+	if hc.Timeout != 0 {
+		t.Errorf("WithTimeout changed the caller's http.Client: %v", hc.Timeout)
+	}
+}
+
+func TestAskOptions(t *testing.T) {
+	var got url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Query()
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	c := New(srv.URL, "")
+	for _, tt := range []struct {
+		opt         AskOption
+		param, want string
+	}{
+		{WithFactLimit(20), "k_facts", "20"},
+		{WithFactLimit(0), "k_facts", ""},
+		{WithLogLimit(3), "k_logs", "3"},
+		{WithPredicate("works_at"), "predicate", "works_at"},
+		{WithMatch("exact"), "match", "exact"},
+		{WithRecencyHalfLife(72 * time.Hour), "recency_halflife", "72h0m0s"},
+		{WithRecencyHalfLife(0), "recency_halflife", "0s"},
+		{WithSuperseded(), "include_superseded", "true"},
+		{WithAsOf(time.Date(2023, 1, 1, 1, 0, 0, 0, time.FixedZone("CET", 3600))), "as_of", "2023-01-01T01:00:00+01:00"},
+	} {
+		if _, err := c.Ask(context.Background(), "q", tt.opt); err != nil {
+			t.Fatal(err)
+		}
+		if v := got.Get(tt.param); v != tt.want {
+			t.Errorf("%s = %q, want %q", tt.param, v, tt.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package distill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// Named labels a distiller so the triples it produces can be attributed.
+func Named(name string, d Distiller) Distiller {
+	return namedDistiller{name: name, inner: d}
+}
+
+type namedDistiller struct {
+	name  string
+	inner Distiller
+}
+
+func (n namedDistiller) Distill(ctx context.Context, inputs []model.SensoryInput) ([]model.Triple, error) {
+	triples, err := n.inner.Distill(ctx, inputs)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.name, err)
+	}
+	for i := range triples {
+		if triples[i].Distiller == "" {
+			triples[i].Distiller = n.name
+		}
+	}
+	return triples, nil
+}
+
+func (n namedDistiller) String() string { return n.name }
+
+// nameOf returns a label for d, used when tagging triples.
+func nameOf(d Distiller) string {
+	if s, ok := d.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", d)
+}
+
+// Chain runs all distillers concurrently and merges their output,
+// deduplicating by subject/predicate/object and keeping the highest
+// confidence (source logs are unioned). Any member error fails the chain;
+// wrap unreliable members in Fallback to tolerate failures.
+func Chain(distillers ...Distiller) Distiller {
+	return chainDistiller(distillers)
+}
+
+type chainDistiller []Distiller
+
+func (c chainDistiller) Distill(ctx context.Context, inputs []model.SensoryInput) ([]model.Triple, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([][]model.Triple, len(c))
+	errs := make([]error, len(c))
+	var wg sync.WaitGroup
+	for i, d := range c {
+		wg.Add(1)
+		go func(i int, d Distiller) {
+			defer wg.Done()
+			triples, err := d.Distill(ctx, inputs)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", nameOf(d), err)
+				cancel()
+				return
+			}
+			tag(triples, d)
+			results[i] = triples
+		}(i, d)
+	}
+	wg.Wait()
+
+	// a failing member cancels the others; report its error, not theirs
+	var first error
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	if first != nil {
+		return nil, first
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var all []model.Triple
+	for _, r := range results {
+		all = append(all, r...)
+	}
+	return dedupe(all), nil
+}
+
+func (c chainDistiller) String() string { return "chain" }
+
+// Fallback invokes secondary only when primary errors or yields no triples.
+// A cancelled context is returned as-is rather than triggering the fallback.
+func Fallback(primary, secondary Distiller) Distiller {
+	return fallbackDistiller{primary: primary, secondary: secondary}
+}
+
+type fallbackDistiller struct {
+	primary, secondary Distiller
+}
+
+func (f fallbackDistiller) Distill(ctx context.Context, inputs []model.SensoryInput) ([]model.Triple, error) {
+	triples, err := f.primary.Distill(ctx, inputs)
+	if err == nil && len(triples) > 0 {
+		tag(triples, f.primary)
+		return triples, nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	triples, serr := f.secondary.Distill(ctx, inputs)
+	if serr != nil {
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v; fallback %s: %w", nameOf(f.primary), err, nameOf(f.secondary), serr)
+		}
+		return nil, fmt.Errorf("%s: %w", nameOf(f.secondary), serr)
+	}
+	tag(triples, f.secondary)
+	return triples, nil
+}
+
+func (f fallbackDistiller) String() string {
+	return nameOf(f.primary) + "|" + nameOf(f.secondary)
+}
+
+func tag(triples []model.Triple, d Distiller) {
+	name := nameOf(d)
+	for i := range triples {
+		if triples[i].Distiller == "" {
+			triples[i].Distiller = name
+		}
+	}
+}
+
+func dedupe(triples []model.Triple) []model.Triple {
+	index := make(map[[3]string]int, len(triples))
+	out := make([]model.Triple, 0, len(triples))
+	for _, t := range triples {
+		key := [3]string{t.Subject, t.Predicate, t.Object}
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(out)
+			out = append(out, t)
+			continue
+		}
+		sources := unionStrings(out[i].Sources, t.Sources)
+		if t.Confidence > out[i].Confidence {
+			out[i] = t
+		}
+		out[i].Sources = sources
+	}
+	return out
+}
+
+func unionStrings(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var out []string
+	for _, s := range append(append([]string(nil), a...), b...) {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
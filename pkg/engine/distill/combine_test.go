@@ -0,0 +1,118 @@
+package distill
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// blockingDistiller waits for its context to end.
+type blockingDistiller struct{}
+
+func (blockingDistiller) Distill(ctx context.Context, _ []model.SensoryInput) ([]model.Triple, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+var note = []model.SensoryInput{{Content: "note"}}
+
+func TestChainMergesOverlappingOutput(t *testing.T) {
+	a := &fakeDistiller{triples: []model.Triple{
+		{Subject: "alice", Predicate: "likes", Object: "tea", Confidence: 0.5, Sources: []string{"1"}},
+		{Subject: "alice", Predicate: "works_at", Object: "acme", Confidence: 0.6},
+	}}
+	b := &fakeDistiller{triples: []model.Triple{
+		{Subject: "alice", Predicate: "likes", Object: "tea", Confidence: 0.9, Sources: []string{"2"}},
+	}}
+	got, err := Chain(Named("a", a), Named("b", b), &fakeDistiller{}).Distill(context.Background(), note)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := tripleKeys(got); !reflect.DeepEqual(keys, []string{"alice|likes|tea", "alice|works_at|acme"}) {
+		t.Fatalf("Chain = %q", keys)
+	}
+	if got[0].Confidence != 0.9 || got[0].Distiller != "b" {
+		t.Errorf("merged triple = %+v, want b's confidence 0.9", got[0])
+	}
+	if !reflect.DeepEqual(got[0].Sources, []string{"1", "2"}) {
+		t.Errorf("merged sources = %q, want both", got[0].Sources)
+	}
+	if got[1].Distiller != "a" {
+		t.Errorf("distiller of %s = %q, want a", tripleKeys(got[1:]), got[1].Distiller)
+	}
+}
+
+func TestChainFailsAndCancelsOnMemberError(t *testing.T) {
+	boom := errors.New("boom")
+	done := make(chan error, 1)
+	go func() {
+		_, err := Chain(blockingDistiller{}, &fakeDistiller{err: boom}).Distill(context.Background(), note)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, boom) {
+			t.Fatalf("Chain = %v, want the member error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Chain did not cancel its other members")
+	}
+}
+
+func TestChainPropagatesCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Chain(blockingDistiller{}).Distill(ctx, note); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Chain = %v, want context.Canceled", err)
+	}
+}
+
+func TestFallback(t *testing.T) {
+	fact := []model.Triple{{Subject: "s", Predicate: "p", Object: "o"}}
+	tests := []struct {
+		name              string
+		primary           *fakeDistiller
+		secondary         *fakeDistiller
+		wantSecondary     bool
+		wantErr           bool
+		wantDistillerName string
+	}{
+		{"primary succeeds", &fakeDistiller{triples: fact}, &fakeDistiller{}, false, false, "primary"},
+		{"primary errors", &fakeDistiller{err: errors.New("down")}, &fakeDistiller{triples: fact}, true, false, "secondary"},
+		{"primary empty", &fakeDistiller{}, &fakeDistiller{triples: fact}, true, false, "secondary"},
+		{"both fail", &fakeDistiller{err: errors.New("down")}, &fakeDistiller{err: errors.New("also down")}, true, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// copy the shared triples so tagging one case doesn't leak into the next
+			tt.primary.triples = append([]model.Triple(nil), tt.primary.triples...)
+			tt.secondary.triples = append([]model.Triple(nil), tt.secondary.triples...)
+			got, err := Fallback(Named("primary", tt.primary), Named("secondary", tt.secondary)).Distill(context.Background(), note)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fallback error = %v, want error %v", err, tt.wantErr)
+			}
+			if called := len(tt.secondary.inputs) > 0; called != tt.wantSecondary {
+				t.Fatalf("secondary called = %v, want %v", called, tt.wantSecondary)
+			}
+			if !tt.wantErr && (len(got) != 1 || got[0].Distiller != tt.wantDistillerName) {
+				t.Fatalf("Fallback = %+v, want one triple from %s", got, tt.wantDistillerName)
+			}
+		})
+	}
+}
+
+func TestFallbackDoesNotRunSecondaryOnCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	secondary := &fakeDistiller{}
+	if _, err := Fallback(blockingDistiller{}, secondary).Distill(ctx, note); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Fallback = %v, want context.Canceled", err)
+	}
+	if len(secondary.inputs) > 0 {
+		t.Fatal("secondary ran after the context was cancelled")
+	}
+}
@@ -0,0 +1,216 @@
+package distill
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// ContentPattern extracts a triple from one sentence or line of content.
+// Pattern is matched case-insensitively against the whole sentence, without
+// its final punctuation, and must capture "object". The subject comes from a
+// "subject" group, defaulting to the user entity, and the predicate from a
+// "predicate" group, defaulting to Predicate. First-person subjects such as
+// "I" and "my" stand for the user entity.
+type ContentPattern struct {
+	Name       string
+	Pattern    string
+	Predicate  string
+	Confidence float64
+}
+
+// DefaultContentPatterns is the pattern set of NewHeuristic, tried in order;
+// the first pattern that matches a sentence wins.
+var DefaultContentPatterns = []ContentPattern{
+	{Name: "possessive", Pattern: `(?P<subject>my) (?P<predicate>[a-z][a-z' ]{0,30}?) (?:is|are) (?P<object>.+)`, Confidence: 0.6},
+	{Name: "works_at", Pattern: `(?P<subject>.{1,40}?) (?:works?|worked) (?:at|for) (?P<object>.+)`, Predicate: "works_at", Confidence: 0.6},
+	{Name: "lives_in", Pattern: `(?P<subject>.{1,40}?) (?:lives?|lived) in (?P<object>.+)`, Predicate: "lives_in", Confidence: 0.6},
+	// "is located in", "was born in", "is married to": the participle and
+	// preposition make the predicate, not part of the object
+	{Name: "participle", Pattern: `(?P<subject>.{1,40}?) (?:is|am|are|was|were) (?P<predicate>(?:[a-z]{3,}ed|born|made|known) (?:in|at|on|to|by|from|with|as)) (?P<object>.+)`, Confidence: 0.55},
+	{Name: "copula", Pattern: `(?P<subject>.{1,40}?) (?:is|am|are) (?:an? |the )?(?P<object>.+)`, Predicate: "is", Confidence: 0.5},
+	{Name: "key_value", Pattern: `(?P<predicate>[a-z][a-z0-9 _-]{0,30}):\s+(?P<object>.+)`, Confidence: 0.5},
+}
+
+// maxContentObject bounds extracted objects; longer ones are not facts.
+const maxContentObject = 80
+
+var (
+	// negationRe and questionRe reject sentences that do not assert a
+	// fact.
+	negationRe = regexp.MustCompile(`(?i)\b(not|never|no longer|nobody|nothing)\b|n't\b`)
+	questionRe = regexp.MustCompile(`(?i)^(who|what|where|when|why|how|which|is|are|am|do|does|did|can|could|should|would|will)\b`)
+	// sentenceEndRe splits a line after terminal punctuation.
+	sentenceEndRe = regexp.MustCompile(`[.!?]+\s+`)
+	// clauseBreakRe matches where a sentence may join two clauses: a comma
+	// or semicolon, a coordinating conjunction, or both.
+	clauseBreakRe = regexp.MustCompile(`(?i)\s*[,;]\s*(?:(?:and|but|or|so)\s+)?|\s+(?:and|but|or|so|while|whereas)\s+`)
+)
+
+// firstPerson are subjects that refer to the user.
+var firstPerson = map[string]bool{"i": true, "me": true, "my": true, "myself": true}
+
+// subordinators open a subordinate clause, which does not assert its
+// content ("If Alice is a doctor, ...").
+var subordinators = map[string]bool{
+	"if": true, "unless": true, "when": true, "whenever": true, "because": true, "since": true,
+	"although": true, "though": true, "whether": true, "while": true, "once": true,
+	"until": true, "before": true, "after": true, "as": true, "suppose": true, "assuming": true,
+}
+
+// vagueSubjects are subjects too vague to make a fact of.
+var vagueSubjects = map[string]bool{
+	"it": true, "this": true, "that": true, "there": true, "here": true, "he": true, "she": true,
+	"they": true, "we": true, "you": true, "what": true, "which": true, "who": true,
+}
+
+type compiledPattern struct {
+	ContentPattern
+	re *regexp.Regexp
+}
+
+func compilePatterns(patterns []ContentPattern) ([]compiledPattern, error) {
+	compiled := make([]compiledPattern, 0, len(patterns))
+	for i, p := range patterns {
+		re, err := regexp.Compile(`(?i)^(?:` + p.Pattern + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %d (%s): %w", i, p.Name, err)
+		}
+		names := re.SubexpNames()
+		if !hasGroup(names, "object") {
+			return nil, fmt.Errorf("pattern %d (%s): pattern must have a named group object", i, p.Name)
+		}
+		if p.Predicate == "" && !hasGroup(names, "predicate") {
+			return nil, fmt.Errorf("pattern %d (%s): predicate or a predicate group is required", i, p.Name)
+		}
+		if p.Confidence <= 0 || p.Confidence > 1 {
+			p.Confidence = 0.5
+		}
+		compiled = append(compiled, compiledPattern{ContentPattern: p, re: re})
+	}
+	return compiled, nil
+}
+
+// extract applies the patterns to every clause of every sentence of
+// in.Content.
+func (h *HeuristicDistiller) extract(in model.SensoryInput) []model.Triple {
+	var out []model.Triple
+	seen := make(map[[3]string]bool)
+	for _, sentence := range sentences(in.Content) {
+		if strings.HasSuffix(sentence, "?") {
+			continue
+		}
+		for _, clause := range h.clauses(sentence) {
+			t, ok := h.match(clause)
+			if !ok {
+				continue
+			}
+			key := [3]string{strings.ToLower(t.Subject), t.Predicate, strings.ToLower(t.Object)}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			t.Sources = sourcesOf(in)
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// clauses splits a sentence at commas, semicolons and conjunctions, but only
+// where what follows is a clause of its own, one a pattern matches: "the sky
+// is blue and the grass is green" is two clauses, while "Alice works at
+// Ernst and Young" and "Alice lives in Berlin, Germany" are one.
+func (h *HeuristicDistiller) clauses(sentence string) []string {
+	locs := clauseBreakRe.FindAllStringIndex(sentence, -1)
+	if len(locs) == 0 {
+		return []string{sentence}
+	}
+	var out []string
+	start := 0
+	for i, loc := range locs {
+		end := len(sentence)
+		if i+1 < len(locs) {
+			end = locs[i+1][0]
+		}
+		if h.isClause(sentence[loc[1]:end]) {
+			out = append(out, sentence[start:loc[0]])
+			start = loc[1]
+		}
+	}
+	return append(out, sentence[start:])
+}
+
+// isClause reports whether any pattern matches s.
+func (h *HeuristicDistiller) isClause(s string) bool {
+	s = strings.TrimRight(s, ".!; ")
+	for _, p := range h.patterns {
+		if p.re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *HeuristicDistiller) match(sentence string) (model.Triple, bool) {
+	if strings.HasSuffix(sentence, "?") || questionRe.MatchString(sentence) || negationRe.MatchString(sentence) {
+		return model.Triple{}, false
+	}
+	sentence = strings.TrimRight(sentence, ".!; ")
+	for _, p := range h.patterns {
+		m := p.re.FindStringSubmatch(sentence)
+		if m == nil {
+			continue
+		}
+		groups := make(map[string]string)
+		for i, name := range p.re.SubexpNames() {
+			if name != "" {
+				groups[name] = strings.TrimSpace(m[i])
+			}
+		}
+		subject := groups["subject"]
+		if first, _, _ := strings.Cut(strings.ToLower(subject), " "); subordinators[first] {
+			continue
+		}
+		if subject == "" || firstPerson[strings.ToLower(subject)] {
+			subject = h.userEntity
+		}
+		predicate := p.Predicate
+		if g := normalizePredicate(groups["predicate"]); g != "" {
+			predicate = g
+		}
+		object := groups["object"]
+		if vagueSubjects[strings.ToLower(subject)] || object == "" || len(object) > maxContentObject {
+			continue
+		}
+		return model.Triple{Subject: subject, Predicate: predicate, Object: object, Confidence: p.Confidence}, true
+	}
+	return model.Triple{}, false
+}
+
+// sentences splits content into lines and the lines into sentences.
+func sentences(content string) []string {
+	var out []string
+	for _, line := range strings.Split(content, "\n") {
+		for _, s := range splitAfter(line, sentenceEndRe) {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+// splitAfter splits s after every match of re, keeping the matched
+// punctuation with the preceding part.
+func splitAfter(s string, re *regexp.Regexp) []string {
+	var out []string
+	start := 0
+	for _, loc := range re.FindAllStringIndex(s, -1) {
+		out = append(out, s[start:loc[1]])
+		start = loc[1]
+	}
+	return append(out, s[start:])
+}
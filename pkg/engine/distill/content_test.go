@@ -0,0 +1,177 @@
+package distill
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+func TestHeuristicExtractsSentences(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []string // subject|predicate|object
+	}{
+		{"Alice works at Acme.", []string{"Alice|works_at|Acme"}},
+		{"Alice works at Ernst and Young", []string{"Alice|works_at|Ernst and Young"}},
+		{"Bob lives in Berlin, Germany.", []string{"Bob|lives_in|Berlin, Germany"}},
+		{"My favourite colour is blue", []string{"user|favourite_colour|blue"}},
+		{"The sky is blue and the grass is green", []string{"The sky|is|blue", "the grass|is|green"}},
+		{"Alice is a doctor; Bob is a nurse.", []string{"Alice|is|doctor", "Bob|is|nurse"}},
+		{"If Alice is a doctor, Bob is a nurse", []string{"Bob|is|nurse"}},
+		{"When Carol is away, Dave works at the desk", []string{"Dave|works_at|the desk"}},
+		{"Acme is located in Berlin", []string{"Acme|located_in|Berlin"}},
+		{"Carol was born in Lisbon.", []string{"Carol|born_in|Lisbon"}},
+		{"Alice is married to Bob and Bob works at Acme", []string{"Alice|married_to|Bob", "Bob|works_at|Acme"}},
+		{"My favourite colours are red and blue", []string{"user|favourite_colours|red and blue"}},
+		{"Alice is not a doctor", nil},
+		{"Is Alice a doctor?", nil},
+		{"It is raining and the grass is wet", []string{"the grass|is|wet"}},
+		{"editor: vim", []string{"user|editor|vim"}},
+	}
+	h := NewHeuristic()
+	for _, tt := range tests {
+		t.Run(tt.content, func(t *testing.T) {
+			got := h.extract(model.SensoryInput{Content: tt.content})
+			var keys []string
+			for _, tr := range got {
+				keys = append(keys, tr.Subject+"|"+tr.Predicate+"|"+tr.Object)
+			}
+			if !reflect.DeepEqual(keys, tt.want) {
+				t.Fatalf("extract(%q) = %q, want %q", tt.content, keys, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeuristicFallsBackToNotes(t *testing.T) {
+	h := NewHeuristic()
+	got, err := h.Distill(context.Background(), []model.SensoryInput{{Content: "remember the milk", Source: "chat"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Predicate != DefaultNotesPredicate || got[0].Subject != "chat" {
+		t.Fatalf("Distill = %+v, want one notes triple about chat", got)
+	}
+}
+
+func TestHeuristicConfig(t *testing.T) {
+	ctx := context.Background()
+	h, err := NewHeuristicWithConfig(HeuristicConfig{
+		UserEntity: "john",
+		Patterns: []ContentPattern{
+			{Name: "owns", Pattern: `(?P<subject>.+?) owns? (?P<object>.+)`, Predicate: "owns", Confidence: 0.7},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := h.Distill(ctx, []model.SensoryInput{
+		{Content: "I own a boat."},
+		{Content: "Alice works at Acme.", Source: "chat"},
+		{Content: "ignored", Metadata: map[string]any{"subject": "bob", "predicate": "likes", "object": "tea"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, tr := range got {
+		keys = append(keys, tr.Subject+"|"+tr.Predicate+"|"+tr.Object)
+	}
+	// the default patterns are replaced, so the second input is a note
+	want := []string{"john|owns|a boat", "chat|" + DefaultNotesPredicate + "|Alice works at Acme.", "bob|likes|tea"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("Distill = %q, want %q", keys, want)
+	}
+	if got[0].Confidence != 0.7 {
+		t.Errorf("pattern confidence = %v, want 0.7", got[0].Confidence)
+	}
+
+	none, err := NewHeuristicWithConfig(HeuristicConfig{Patterns: []ContentPattern{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := none.Distill(ctx, []model.SensoryInput{{Content: "Alice works at Acme."}}); len(got) != 1 || got[0].Predicate != DefaultNotesPredicate {
+		t.Errorf("Distill without patterns = %+v, want a note", got)
+	}
+
+	for name, p := range map[string]ContentPattern{
+		"bad regexp":   {Pattern: `(?P<object>`, Predicate: "p"},
+		"no object":    {Pattern: `(?P<subject>.+) x`, Predicate: "p"},
+		"no predicate": {Pattern: `(?P<object>.+)`},
+	} {
+		if _, err := NewHeuristicWithConfig(HeuristicConfig{Patterns: []ContentPattern{p}}); err == nil {
+			t.Errorf("%s: pattern accepted", name)
+		}
+	}
+}
+
+func TestHeuristicSettings(t *testing.T) {
+	h, err := NewHeuristicWithConfig(HeuristicConfig{
+		MetadataConfidence: 0.75,
+		NotesConfidence:    0.2,
+		NotesPredicate:     " mentions ",
+		SnippetLength:      5,
+		DefaultSubject:     "me",
+		Patterns:           []ContentPattern{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := h.Distill(context.Background(), []model.SensoryInput{
+		{Content: "日本語のメモです"},
+		{Content: "x", Metadata: map[string]any{"subject": "bob", "predicate": "likes", "object": "tea"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []model.Triple{
+		{Subject: "me", Predicate: "mentions", Object: "日本語のメ", Confidence: 0.2},
+		{Subject: "bob", Predicate: "likes", Object: "tea", Confidence: 0.75},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Distill = %+v, want %+v", got, want)
+	}
+
+	// zero values keep the defaults
+	d, err := NewHeuristicWithConfig(HeuristicConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.metadataConf != DefaultMetadataConfidence || d.notesConf != DefaultNotesConfidence || d.notesPredicate != DefaultNotesPredicate ||
+		d.snippetLength != DefaultSnippetLength || d.defaultSubject != DefaultNotesSubject {
+		t.Errorf("zero config = %+v, want the defaults", d)
+	}
+
+	for name, cfg := range map[string]HeuristicConfig{
+		"metadata confidence above 1": {MetadataConfidence: 1.5},
+		"negative notes confidence":   {NotesConfidence: -0.1},
+		"negative snippet length":     {SnippetLength: -1},
+	} {
+		if _, err := NewHeuristicWithConfig(cfg); err == nil {
+			t.Errorf("%s: config accepted", name)
+		}
+	}
+}
+
+func TestTruncateRunes(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 3, "hel"},
+		{"héllo", 2, "hé"},
+		{"日本語", 2, "日本"},
+		{"日本語", 0, ""},
+	} {
+		if got := truncateRunes(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncateRunes(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+	if got := truncate("日本語", 1); got != "日..." {
+		t.Errorf("truncate = %q, want a whole character and an ellipsis", got)
+	}
+}
@@ -2,7 +2,9 @@ package distill
 
 import (
 	"context"
+	"fmt"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/johncui/PAIM/pkg/model"
 )
@@ -12,14 +14,155 @@ type Distiller interface {
 	Distill(ctx context.Context, inputs []model.SensoryInput) ([]model.Triple, error)
 }
 
-// HeuristicDistiller is a lightweight placeholder distiller using simple rules.
-type HeuristicDistiller struct{}
+// WithProvenance adapts a Distiller that does not fill model.Triple.Sources:
+// triples without sources are attributed to every input in the batch, which is
+// the most precise statement possible without the distiller's cooperation.
+func WithProvenance(d Distiller) Distiller {
+	if _, ok := d.(provenanceDistiller); ok {
+		return d
+	}
+	return provenanceDistiller{inner: d}
+}
+
+type provenanceDistiller struct {
+	inner Distiller
+}
 
-func NewHeuristic() *HeuristicDistiller { return &HeuristicDistiller{} }
+func (p provenanceDistiller) String() string { return nameOf(p.inner) }
+
+func (p provenanceDistiller) Distill(ctx context.Context, inputs []model.SensoryInput) ([]model.Triple, error) {
+	triples, err := p.inner.Distill(ctx, inputs)
+	if err != nil {
+		return nil, err
+	}
+	var all []string
+	for _, in := range inputs {
+		if in.LogID != "" {
+			all = append(all, in.LogID)
+		}
+	}
+	for i := range triples {
+		if len(triples[i].Sources) == 0 {
+			triples[i].Sources = all
+		}
+	}
+	return triples, nil
+}
+
+// Defaults of HeuristicConfig.
+const (
+	DefaultMetadataConfidence = 0.9
+	DefaultNotesConfidence    = 0.4
+	DefaultNotesPredicate     = "notes"
+	DefaultSnippetLength      = 80
+	DefaultNotesSubject       = "user"
+)
+
+// HeuristicDistiller is a lightweight distiller using simple rules.
+type HeuristicDistiller struct {
+	userEntity     string
+	patterns       []compiledPattern
+	metadataConf   float64
+	notesConf      float64
+	notesPredicate string
+	snippetLength  int
+	defaultSubject string
+}
+
+// HeuristicConfig configures HeuristicDistiller.
+type HeuristicConfig struct {
+	// UserEntity is the entity first-person statements are about
+	// (default "user").
+	UserEntity string
+	// Patterns extract triples from content; nil means
+	// DefaultContentPatterns and an empty slice disables extraction.
+	Patterns []ContentPattern
+	// MetadataConfidence is the confidence of triples given in metadata and
+	// NotesConfidence that of the fallback notes triples; both must be in
+	// (0, 1], zero meaning the default (0.9 and 0.4).
+	MetadataConfidence float64
+	NotesConfidence    float64
+	// NotesPredicate names the fallback triples (default "notes").
+	NotesPredicate string
+	// SnippetLength caps the characters of content a notes triple keeps
+	// (default 80).
+	SnippetLength int
+	// DefaultSubject is the subject of notes triples of inputs without a
+	// source (default "user").
+	DefaultSubject string
+}
+
+var defaultPatterns = mustCompilePatterns(DefaultContentPatterns)
+
+func mustCompilePatterns(patterns []ContentPattern) []compiledPattern {
+	compiled, err := compilePatterns(patterns)
+	if err != nil {
+		panic(err)
+	}
+	return compiled
+}
+
+func NewHeuristic() *HeuristicDistiller {
+	return &HeuristicDistiller{
+		userEntity:     "user",
+		patterns:       defaultPatterns,
+		metadataConf:   DefaultMetadataConfidence,
+		notesConf:      DefaultNotesConfidence,
+		notesPredicate: DefaultNotesPredicate,
+		snippetLength:  DefaultSnippetLength,
+		defaultSubject: DefaultNotesSubject,
+	}
+}
+
+// NewHeuristicWithConfig builds a HeuristicDistiller from cfg, failing on
+// out-of-range settings and on patterns that do not compile or lack the
+// required groups.
+func NewHeuristicWithConfig(cfg HeuristicConfig) (*HeuristicDistiller, error) {
+	h := NewHeuristic()
+	if cfg.UserEntity != "" {
+		h.userEntity = cfg.UserEntity
+	}
+	for _, c := range []struct {
+		name string
+		v    float64
+		dst  *float64
+	}{{"metadata confidence", cfg.MetadataConfidence, &h.metadataConf}, {"notes confidence", cfg.NotesConfidence, &h.notesConf}} {
+		if c.v < 0 || c.v > 1 {
+			return nil, fmt.Errorf("%s must be within (0, 1], got %v", c.name, c.v)
+		}
+		if c.v > 0 {
+			*c.dst = c.v
+		}
+	}
+	if cfg.SnippetLength < 0 {
+		return nil, fmt.Errorf("snippet length must not be negative, got %d", cfg.SnippetLength)
+	}
+	if cfg.SnippetLength > 0 {
+		h.snippetLength = cfg.SnippetLength
+	}
+	if p := strings.TrimSpace(cfg.NotesPredicate); p != "" {
+		h.notesPredicate = p
+	}
+	if s := strings.TrimSpace(cfg.DefaultSubject); s != "" {
+		h.defaultSubject = s
+	}
+	if cfg.Patterns != nil {
+		patterns, err := compilePatterns(cfg.Patterns)
+		if err != nil {
+			return nil, err
+		}
+		h.patterns = patterns
+	}
+	return h, nil
+}
+
+func (h *HeuristicDistiller) String() string { return "heuristic" }
 
 // Distill attempts to derive triples using naive heuristics:
 // - If metadata contains subject/predicate/object keys, use them.
-// - Otherwise, create a generic "notes" triple linking source -> content snippet.
+// - Otherwise, match the content patterns against each sentence, skipping questions and negations.
+// - Failing that, create a generic "notes" triple linking source -> content snippet.
+// Confidences, the notes predicate and the snippet length come from HeuristicConfig.
 func (h *HeuristicDistiller) Distill(_ context.Context, inputs []model.SensoryInput) ([]model.Triple, error) {
 	var triples []model.Triple
 	for _, in := range inputs {
@@ -31,31 +174,55 @@ func (h *HeuristicDistiller) Distill(_ context.Context, inputs []model.SensoryIn
 				Subject:    subject,
 				Predicate:  predicate,
 				Object:     object,
-				Confidence: 0.9,
+				Confidence: h.metadataConf,
+				Sources:    sourcesOf(in),
 			})
 			continue
 		}
-
-		snippet := strings.TrimSpace(in.Content)
-		if len(snippet) > 80 {
-			snippet = snippet[:80]
+		if found := h.extract(in); len(found) > 0 {
+			triples = append(triples, found...)
+			continue
 		}
+
+		snippet := truncateRunes(strings.TrimSpace(in.Content), h.snippetLength)
 		if snippet == "" {
 			continue
 		}
 		triples = append(triples, model.Triple{
-			Subject:    defaultIfEmpty(in.Source, "user"),
-			Predicate:  "notes",
+			Subject:    defaultIfEmpty(in.Source, h.defaultSubject),
+			Predicate:  h.notesPredicate,
 			Object:     snippet,
-			Confidence: 0.4,
+			Confidence: h.notesConf,
+			Sources:    sourcesOf(in),
 		})
 	}
 	return triples, nil
 }
 
+// truncateRunes returns the first n characters of s, never splitting a
+// multibyte character.
+func truncateRunes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	i := 0
+	for count := 0; count < n && i < len(s); count++ {
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+	}
+	return s[:i]
+}
+
 func defaultIfEmpty(v, def string) string {
 	if strings.TrimSpace(v) == "" {
 		return def
 	}
 	return v
 }
+
+func sourcesOf(in model.SensoryInput) []string {
+	if in.LogID == "" {
+		return nil
+	}
+	return []string{in.LogID}
+}
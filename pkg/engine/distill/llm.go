@@ -0,0 +1,231 @@
+package distill
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// LLMConfig configures LLMDistiller.
+type LLMConfig struct {
+	// Endpoint is a chat-completions compatible URL.
+	Endpoint string
+	APIKey   string
+	Model    string
+	// MaxInputsPerCall bounds how many inputs are sent in one request.
+	MaxInputsPerCall int
+	// Timeout is a hard limit for each request.
+	Timeout time.Duration
+	// DefaultConfidence is used when the model omits or garbles a confidence.
+	DefaultConfidence float64
+	HTTPClient        *http.Client
+}
+
+// LLMDistiller asks a chat-completions endpoint to extract triples.
+type LLMDistiller struct {
+	cfg LLMConfig
+}
+
+func NewLLM(cfg LLMConfig) *LLMDistiller {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://api.openai.com/v1/chat/completions"
+	}
+	if cfg.Model == "" {
+		cfg.Model = "gpt-4o-mini"
+	}
+	if cfg.MaxInputsPerCall <= 0 {
+		cfg.MaxInputsPerCall = 20
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 60 * time.Second
+	}
+	if cfg.DefaultConfidence <= 0 || cfg.DefaultConfidence > 1 {
+		cfg.DefaultConfidence = 0.7
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{}
+	}
+	return &LLMDistiller{cfg: cfg}
+}
+
+const llmSystemPrompt = `You extract durable facts about the user and their world from short notes.
+Reply with JSON only, no prose, in the form:
+{"triples":[{"input":0,"subject":"alice","predicate":"works_at","object":"acme","confidence":0.8}]}
+- "input" is the index of the note the fact came from.
+- subject and object are short entity names; predicate is snake_case.
+- confidence is between 0 and 1.
+- Skip small talk and questions; return {"triples":[]} when nothing is worth remembering.`
+
+func (l *LLMDistiller) String() string { return "llm" }
+
+// Distill sends inputs in batches of MaxInputsPerCall and merges the results.
+func (l *LLMDistiller) Distill(ctx context.Context, inputs []model.SensoryInput) ([]model.Triple, error) {
+	var out []model.Triple
+	for start := 0; start < len(inputs); start += l.cfg.MaxInputsPerCall {
+		end := start + l.cfg.MaxInputsPerCall
+		if end > len(inputs) {
+			end = len(inputs)
+		}
+		triples, err := l.distillBatch(ctx, inputs[start:end])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, triples...)
+	}
+	return out, nil
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	Temperature float64       `json:"temperature"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+type llmTriple struct {
+	Input      *int     `json:"input"`
+	Subject    string   `json:"subject"`
+	Predicate  string   `json:"predicate"`
+	Object     string   `json:"object"`
+	Confidence *float64 `json:"confidence"`
+}
+
+func (l *LLMDistiller) distillBatch(ctx context.Context, inputs []model.SensoryInput) ([]model.Triple, error) {
+	ctx, cancel := context.WithTimeout(ctx, l.cfg.Timeout)
+	defer cancel()
+
+	var notes strings.Builder
+	for i, in := range inputs {
+		fmt.Fprintf(&notes, "[%d] (%s) %s\n", i, defaultIfEmpty(in.Source, "user"), strings.TrimSpace(in.Content))
+	}
+	body, err := json.Marshal(chatRequest{
+		Model: l.cfg.Model,
+		Messages: []chatMessage{
+			{Role: "system", Content: llmSystemPrompt},
+			{Role: "user", Content: notes.String()},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if l.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+l.cfg.APIKey)
+	}
+	resp, err := l.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("llm request: %w", err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, fmt.Errorf("llm response: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("llm request: status %d: %s", resp.StatusCode, truncate(string(raw), 200))
+	}
+
+	var chat chatResponse
+	if err := json.Unmarshal(raw, &chat); err != nil {
+		return nil, fmt.Errorf("llm response: %w", err)
+	}
+	if len(chat.Choices) == 0 {
+		return nil, errors.New("llm response: no choices")
+	}
+	parsed, err := parseLLMTriples(chat.Choices[0].Message.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []model.Triple
+	for _, p := range parsed {
+		subject := strings.TrimSpace(p.Subject)
+		predicate := normalizePredicate(p.Predicate)
+		object := strings.TrimSpace(p.Object)
+		if subject == "" || predicate == "" || object == "" {
+			continue
+		}
+		conf := l.cfg.DefaultConfidence
+		if p.Confidence != nil && *p.Confidence > 0 && *p.Confidence <= 1 {
+			conf = *p.Confidence
+		}
+		t := model.Triple{Subject: subject, Predicate: predicate, Object: object, Confidence: conf}
+		if p.Input != nil && *p.Input >= 0 && *p.Input < len(inputs) {
+			t.Sources = sourcesOf(inputs[*p.Input])
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+var (
+	fenceRe         = regexp.MustCompile("(?s)```(?:json)?\\s*(.*?)```")
+	trailingCommaRe = regexp.MustCompile(`,\s*([}\]])`)
+)
+
+// parseLLMTriples extracts triples from model output, tolerating markdown
+// fences, surrounding prose, a bare array instead of an object, and trailing
+// commas.
+func parseLLMTriples(content string) ([]llmTriple, error) {
+	text := strings.TrimSpace(content)
+	if m := fenceRe.FindStringSubmatch(text); m != nil {
+		text = strings.TrimSpace(m[1])
+	}
+	start := strings.IndexAny(text, "{[")
+	end := strings.LastIndexAny(text, "}]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("llm output has no JSON: %q", truncate(content, 200))
+	}
+	text = trailingCommaRe.ReplaceAllString(text[start:end+1], "$1")
+
+	if text[0] == '[' {
+		var list []llmTriple
+		if err := json.Unmarshal([]byte(text), &list); err != nil {
+			return nil, fmt.Errorf("llm output: %w", err)
+		}
+		return list, nil
+	}
+	var wrapped struct {
+		Triples []llmTriple `json:"triples"`
+	}
+	if err := json.Unmarshal([]byte(text), &wrapped); err != nil {
+		return nil, fmt.Errorf("llm output: %w", err)
+	}
+	return wrapped.Triples, nil
+}
+
+func normalizePredicate(p string) string {
+	p = strings.ToLower(strings.TrimSpace(p))
+	return strings.Join(strings.Fields(p), "_")
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return truncateRunes(s, n) + "..."
+}
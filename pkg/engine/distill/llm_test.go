@@ -0,0 +1,145 @@
+package distill
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// chatServer answers every chat-completions request with reply, and counts
+// the requests it served.
+func chatServer(t *testing.T, reply func(req chatRequest) string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("Authorization") != "Bearer key" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var req chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var resp chatResponse
+		resp.Choices = append(resp.Choices, struct {
+			Message chatMessage `json:"message"`
+		}{chatMessage{Role: "assistant", Content: reply(req)}})
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestLLMParsesModelOutput(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		want  []string // subject|predicate|object|confidence
+	}{
+		{"object", `{"triples":[{"input":0,"subject":"Alice","predicate":"works at","object":"Acme","confidence":0.9}]}`,
+			[]string{"Alice|works_at|Acme|0.9"}},
+		{"fenced", "Here you go:\n```json\n{\"triples\":[{\"subject\":\"Bob\",\"predicate\":\"likes\",\"object\":\"tea\"}]}\n```",
+			[]string{"Bob|likes|tea|0.7"}},
+		{"bare array with trailing comma", `[{"subject":"a","predicate":"p","object":"b","confidence":2},]`,
+			[]string{"a|p|b|0.7"}},
+		{"blank fields skipped", `{"triples":[{"subject":"","predicate":"p","object":"b"}]}`, nil},
+		{"empty", `{"triples":[]}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := chatServer(t, func(chatRequest) string { return tt.reply })
+			l := NewLLM(LLMConfig{Endpoint: srv.URL, APIKey: "key"})
+			got, err := l.Distill(context.Background(), []model.SensoryInput{{Content: "note", LogID: "log-1"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var keys []string
+			for _, tr := range got {
+				keys = append(keys, strings.Join([]string{tr.Subject, tr.Predicate, tr.Object, formatConfidence(tr.Confidence)}, "|"))
+			}
+			if strings.Join(keys, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("Distill = %q, want %q", keys, tt.want)
+			}
+		})
+	}
+}
+
+func formatConfidence(c float64) string {
+	b, _ := json.Marshal(c)
+	return string(b)
+}
+
+func TestLLMRejectsMalformedOutput(t *testing.T) {
+	for _, reply := range []string{"I could not find any facts.", `{"triples":[{"subject":"a",}`} {
+		srv, _ := chatServer(t, func(chatRequest) string { return reply })
+		l := NewLLM(LLMConfig{Endpoint: srv.URL, APIKey: "key"})
+		if _, err := l.Distill(context.Background(), []model.SensoryInput{{Content: "note"}}); err == nil {
+			t.Errorf("Distill accepted %q", reply)
+		}
+	}
+}
+
+func TestLLMBatchesInputsAndAttributesSources(t *testing.T) {
+	srv, calls := chatServer(t, func(req chatRequest) string {
+		// one fact per note: "[i] (user) <content>"
+		var out []string
+		for _, line := range strings.Split(strings.TrimSpace(req.Messages[1].Content), "\n") {
+			i := strings.Index(line, "]")
+			content := line[strings.Index(line, ") ")+2:]
+			out = append(out, `{"input":`+line[1:i]+`,"subject":"`+content+`","predicate":"seen","object":"true"}`)
+		}
+		return `{"triples":[` + strings.Join(out, ",") + `]}`
+	})
+	l := NewLLM(LLMConfig{Endpoint: srv.URL, APIKey: "key", MaxInputsPerCall: 2})
+	inputs := []model.SensoryInput{{Content: "a", LogID: "1"}, {Content: "b", LogID: "2"}, {Content: "c", LogID: "3"}}
+	got, err := l.Distill(context.Background(), inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("%d requests for 3 inputs in batches of 2, want 2", n)
+	}
+	if len(got) != 3 {
+		t.Fatalf("Distill = %+v, want 3 triples", got)
+	}
+	for i, tr := range got {
+		if tr.Subject != inputs[i].Content || len(tr.Sources) != 1 || tr.Sources[0] != inputs[i].LogID {
+			t.Errorf("triple %d = %s with sources %q, want %s from log %s", i, tr.Subject, tr.Sources, inputs[i].Content, inputs[i].LogID)
+		}
+	}
+}
+
+func TestLLMFailsOnErrorStatusAndTimeout(t *testing.T) {
+	srv, _ := chatServer(t, func(chatRequest) string { return `{"triples":[]}` })
+	l := NewLLM(LLMConfig{Endpoint: srv.URL, APIKey: "wrong"})
+	if _, err := l.Distill(context.Background(), []model.SensoryInput{{Content: "note"}}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("Distill with a rejected key = %v, want a status 401 error", err)
+	}
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+	l = NewLLM(LLMConfig{Endpoint: slow.URL, Timeout: 50 * time.Millisecond})
+	start := time.Now()
+	if _, err := l.Distill(context.Background(), []model.SensoryInput{{Content: "note"}}); err == nil {
+		t.Fatal("Distill succeeded against a hanging endpoint")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("Distill returned after %v, want the 50ms timeout to apply", d)
+	}
+}
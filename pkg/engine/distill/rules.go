@@ -0,0 +1,146 @@
+package distill
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// Rule maps a regular expression with named capture groups to a triple.
+// The pattern must capture "subject" and "object"; the predicate comes from
+// a "predicate" group when present, otherwise from Predicate.
+type Rule struct {
+	Name       string  `json:"name"`
+	Pattern    string  `json:"pattern"`
+	Predicate  string  `json:"predicate"`
+	Confidence float64 `json:"confidence"`
+}
+
+// RuleDistiller applies user-defined regex rules to each input's content.
+type RuleDistiller struct {
+	rules    []compiledRule
+	fallback Distiller
+}
+
+type compiledRule struct {
+	Rule
+	re *regexp.Regexp
+}
+
+// NewRules compiles rules. fallback, if non-nil, is invoked for inputs that
+// no rule matched (e.g. NewHeuristic()).
+func NewRules(rules []Rule, fallback Distiller) (*RuleDistiller, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+	for i, r := range rules {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d (%s): %w", i, r.Name, err)
+		}
+		names := re.SubexpNames()
+		if !hasGroup(names, "subject") || !hasGroup(names, "object") {
+			return nil, fmt.Errorf("rule %d (%s): pattern must have named groups subject and object", i, r.Name)
+		}
+		if r.Predicate == "" && !hasGroup(names, "predicate") {
+			return nil, fmt.Errorf("rule %d (%s): predicate or a predicate group is required", i, r.Name)
+		}
+		if r.Confidence <= 0 || r.Confidence > 1 {
+			r.Confidence = 0.7
+		}
+		compiled = append(compiled, compiledRule{Rule: r, re: re})
+	}
+	return &RuleDistiller{rules: compiled, fallback: fallback}, nil
+}
+
+func (r *RuleDistiller) String() string { return "rules" }
+
+// LoadRules reads a JSON array of rules from path.
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse rules %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// Distill applies every rule to every input. All matches of all rules are
+// emitted, deduplicated per input by subject/predicate/object (keeping the
+// highest confidence); unmatched inputs go to the fallback distiller.
+func (r *RuleDistiller) Distill(ctx context.Context, inputs []model.SensoryInput) ([]model.Triple, error) {
+	var out []model.Triple
+	var unmatched []model.SensoryInput
+	for _, in := range inputs {
+		found := r.match(in)
+		if len(found) == 0 {
+			unmatched = append(unmatched, in)
+			continue
+		}
+		out = append(out, found...)
+	}
+
+	if r.fallback != nil && len(unmatched) > 0 {
+		extra, err := r.fallback.Distill(ctx, unmatched)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, extra...)
+	}
+	return out, nil
+}
+
+func (r *RuleDistiller) match(in model.SensoryInput) []model.Triple {
+	var out []model.Triple
+	index := make(map[[3]string]int)
+	for _, rule := range r.rules {
+		names := rule.re.SubexpNames()
+		for _, m := range rule.re.FindAllStringSubmatch(in.Content, -1) {
+			groups := make(map[string]string, len(names))
+			for i, name := range names {
+				if name != "" {
+					groups[name] = strings.TrimSpace(m[i])
+				}
+			}
+			predicate := rule.Predicate
+			if p := normalizePredicate(groups["predicate"]); p != "" {
+				predicate = p
+			}
+			t := model.Triple{
+				Subject:    groups["subject"],
+				Predicate:  predicate,
+				Object:     groups["object"],
+				Confidence: rule.Confidence,
+				Sources:    sourcesOf(in),
+			}
+			if t.Subject == "" || t.Object == "" {
+				continue
+			}
+			key := [3]string{t.Subject, t.Predicate, t.Object}
+			if i, ok := index[key]; ok {
+				if t.Confidence > out[i].Confidence {
+					out[i].Confidence = t.Confidence
+				}
+				continue
+			}
+			index[key] = len(out)
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func hasGroup(names []string, group string) bool {
+	for _, n := range names {
+		if n == group {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package distill
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// fakeDistiller returns triples, or err, and records the inputs it got.
+type fakeDistiller struct {
+	triples []model.Triple
+	err     error
+	inputs  []model.SensoryInput
+}
+
+func (f *fakeDistiller) Distill(_ context.Context, inputs []model.SensoryInput) ([]model.Triple, error) {
+	f.inputs = append(f.inputs, inputs...)
+	return f.triples, f.err
+}
+
+func tripleKeys(triples []model.Triple) []string {
+	var out []string
+	for _, t := range triples {
+		out = append(out, t.Subject+"|"+t.Predicate+"|"+t.Object)
+	}
+	return out
+}
+
+func TestRulesMatchEveryOccurrence(t *testing.T) {
+	r, err := NewRules([]Rule{
+		{Name: "lives", Pattern: `(?P<subject>\w+) lives in (?P<object>\w+)`, Predicate: "lives_in", Confidence: 0.6},
+		{Name: "verb", Pattern: `(?P<subject>\w+) (?P<predicate>lives in|works at) (?P<object>\w+)`, Confidence: 0.9},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.Distill(context.Background(), []model.SensoryInput{{
+		Content: "Alice lives in Berlin and Bob works at Acme", LogID: "log-1",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Alice|lives_in|Berlin", "Bob|works_at|Acme"}
+	if keys := tripleKeys(got); !reflect.DeepEqual(keys, want) {
+		t.Fatalf("Distill = %q, want %q", keys, want)
+	}
+	// both rules matched the first fact; the higher confidence wins
+	if got[0].Confidence != 0.9 {
+		t.Errorf("confidence of the overlapping match = %v, want 0.9", got[0].Confidence)
+	}
+	if !reflect.DeepEqual(got[1].Sources, []string{"log-1"}) {
+		t.Errorf("sources = %q, want the input's log", got[1].Sources)
+	}
+}
+
+func TestRulesFallBackForUnmatchedInputs(t *testing.T) {
+	fallback := &fakeDistiller{triples: []model.Triple{{Subject: "x", Predicate: "notes", Object: "y"}}}
+	r, err := NewRules([]Rule{{Pattern: `(?P<subject>\w+) likes (?P<object>\w+)`, Predicate: "likes"}}, fallback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.Distill(context.Background(), []model.SensoryInput{{Content: "Bob likes tea"}, {Content: "nothing here"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fallback.inputs) != 1 || fallback.inputs[0].Content != "nothing here" {
+		t.Fatalf("fallback got %+v, want only the unmatched input", fallback.inputs)
+	}
+	want := []string{"Bob|likes|tea", "x|notes|y"}
+	if keys := tripleKeys(got); !reflect.DeepEqual(keys, want) {
+		t.Fatalf("Distill = %q, want %q", keys, want)
+	}
+	if got[0].Confidence != 0.7 {
+		t.Errorf("default confidence = %v, want 0.7", got[0].Confidence)
+	}
+}
+
+func TestNewRulesRejectsInvalidRules(t *testing.T) {
+	for _, rule := range []Rule{
+		{Name: "syntax", Pattern: `(?P<subject>\w+`, Predicate: "p"},
+		{Name: "no object", Pattern: `(?P<subject>\w+) is`, Predicate: "p"},
+		{Name: "no predicate", Pattern: `(?P<subject>\w+) is (?P<object>\w+)`},
+	} {
+		if _, err := NewRules([]Rule{rule}, nil); err == nil {
+			t.Errorf("NewRules accepted rule %q", rule.Name)
+		}
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	data := `[{"name":"likes","pattern":"(?P<subject>\\w+) likes (?P<object>\\w+)","predicate":"likes","confidence":0.8}]`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || rules[0].Predicate != "likes" || rules[0].Confidence != 0.8 {
+		t.Fatalf("LoadRules = %+v", rules)
+	}
+	if err := os.WriteFile(path, []byte(`{"name":`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRules(path); err == nil {
+		t.Fatal("LoadRules accepted malformed JSON")
+	}
+}
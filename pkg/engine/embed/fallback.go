@@ -0,0 +1,145 @@
+package embed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// DefaultCooldown is how long FallbackEmbedder skips a failed primary.
+const DefaultCooldown = 30 * time.Second
+
+// FallbackConfig configures FallbackEmbedder.
+type FallbackConfig struct {
+	Primary   model.EmbeddingClient
+	Secondary model.EmbeddingClient
+	// PrimaryModel and SecondaryModel name the model behind each client;
+	// they default to the client's String method, or its type.
+	PrimaryModel   string
+	SecondaryModel string
+	// Cooldown is how long the primary is skipped after it failed (default
+	// DefaultCooldown); negative retries the primary on every call.
+	Cooldown time.Duration
+	Logger   *slog.Logger
+}
+
+// FallbackEmbedder embeds with Primary and falls back to Secondary when it
+// errors. After a primary failure every call goes straight to Secondary for
+// Cooldown, so a dead endpoint costs one timeout per window rather than one
+// per text. It implements model.ModelEmbedder, so the engine records which
+// model produced each vector.
+type FallbackEmbedder struct {
+	cfg FallbackConfig
+
+	mu        sync.Mutex
+	downUntil time.Time
+}
+
+// NewFallback validates cfg and returns the chain.
+func NewFallback(cfg FallbackConfig) (*FallbackEmbedder, error) {
+	if cfg.Primary == nil || cfg.Secondary == nil {
+		return nil, errors.New("fallback embedder needs a primary and a secondary")
+	}
+	if cfg.PrimaryModel == "" {
+		cfg.PrimaryModel = nameOf(cfg.Primary)
+	}
+	if cfg.SecondaryModel == "" {
+		cfg.SecondaryModel = nameOf(cfg.Secondary)
+	}
+	if cfg.Cooldown == 0 {
+		cfg.Cooldown = DefaultCooldown
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	return &FallbackEmbedder{cfg: cfg}, nil
+}
+
+// Must is NewFallback panicking on an invalid cfg, for static wiring.
+func Must(cfg FallbackConfig) *FallbackEmbedder {
+	f, err := NewFallback(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// Fallback chains primary and secondary with the default cooldown. It
+// panics when either is nil.
+func Fallback(primary, secondary model.EmbeddingClient, logger *slog.Logger) *FallbackEmbedder {
+	return Must(FallbackConfig{Primary: primary, Secondary: secondary, Logger: logger})
+}
+
+// nameOf returns a model name for c.
+func nameOf(c model.EmbeddingClient) string {
+	if s, ok := c.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", c)
+}
+
+func (f *FallbackEmbedder) String() string { return f.cfg.PrimaryModel }
+
+// EmbedText returns the vector of text from whichever client produced it.
+func (f *FallbackEmbedder) EmbedText(ctx context.Context, text string) ([]float64, error) {
+	emb, _, err := f.EmbedTextModel(ctx, text)
+	return emb, err
+}
+
+// EmbedTextModel embeds text and names the model that produced the vector.
+// A cancelled context is returned as-is rather than triggering the fallback
+// or the cooldown.
+func (f *FallbackEmbedder) EmbedTextModel(ctx context.Context, text string) ([]float64, string, error) {
+	var perr error
+	if f.primaryUp() {
+		emb, err := f.cfg.Primary.EmbedText(ctx, text)
+		if err == nil {
+			return emb, f.cfg.PrimaryModel, nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, "", ctxErr
+		}
+		perr = err
+		f.markDown(err)
+	}
+	emb, err := f.cfg.Secondary.EmbedText(ctx, text)
+	if err != nil {
+		if perr != nil {
+			return nil, "", fmt.Errorf("%s: %v; fallback %s: %w", f.cfg.PrimaryModel, perr, f.cfg.SecondaryModel, err)
+		}
+		return nil, "", fmt.Errorf("%s: %w", f.cfg.SecondaryModel, err)
+	}
+	return emb, f.cfg.SecondaryModel, nil
+}
+
+// primaryUp reports whether the primary is outside its cooldown window.
+func (f *FallbackEmbedder) primaryUp() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return !time.Now().Before(f.downUntil)
+}
+
+// markDown starts a cooldown window, logging only the failure that opens it.
+func (f *FallbackEmbedder) markDown(err error) {
+	opened := true
+	if f.cfg.Cooldown > 0 {
+		f.mu.Lock()
+		opened = !time.Now().Before(f.downUntil)
+		f.downUntil = time.Now().Add(f.cfg.Cooldown)
+		f.mu.Unlock()
+	}
+	if opened {
+		f.cfg.Logger.Warn("primary embedder failed; using fallback",
+			"primary", f.cfg.PrimaryModel, "fallback", f.cfg.SecondaryModel, "cooldown", max(f.cfg.Cooldown, 0), "err", err)
+	}
+}
+
+var (
+	_ model.EmbeddingClient = (*FallbackEmbedder)(nil)
+	_ model.ModelEmbedder   = (*FallbackEmbedder)(nil)
+)
@@ -0,0 +1,156 @@
+package embed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubEmbedder returns a one-dimension vector holding its value, or err
+// while set, and counts its calls.
+type stubEmbedder struct {
+	name  string
+	value float64
+
+	mu    sync.Mutex
+	err   error
+	calls int
+}
+
+func (s *stubEmbedder) String() string { return s.name }
+
+func (s *stubEmbedder) EmbedText(ctx context.Context, _ string) ([]float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return []float64{s.value}, nil
+}
+
+func (s *stubEmbedder) set(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func (s *stubEmbedder) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func embedModel(t *testing.T, f *FallbackEmbedder) (float64, string) {
+	t.Helper()
+	emb, name, err := f.EmbedTextModel(context.Background(), "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return emb[0], name
+}
+
+func TestFallbackCooldown(t *testing.T) {
+	primary := &stubEmbedder{name: "remote", value: 1}
+	secondary := &stubEmbedder{name: "hash", value: 2}
+	f := Must(FallbackConfig{Primary: primary, Secondary: secondary, Cooldown: 50 * time.Millisecond, Logger: discard})
+	if f.String() != "remote" {
+		t.Errorf("String = %q, want the primary model", f.String())
+	}
+
+	if v, name := embedModel(t, f); v != 1 || name != "remote" {
+		t.Fatalf("healthy primary: %v from %s", v, name)
+	}
+	primary.set(errors.New("connection refused"))
+	if v, name := embedModel(t, f); v != 2 || name != "hash" {
+		t.Fatalf("failed primary: %v from %s, want the fallback", v, name)
+	}
+	// within the cooldown the primary is not tried at all
+	primary.set(nil)
+	embedModel(t, f)
+	if n := primary.count(); n != 2 {
+		t.Fatalf("primary called %d times, want it skipped during the cooldown", n)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if v, name := embedModel(t, f); v != 1 || name != "remote" {
+		t.Errorf("after the cooldown: %v from %s, want the primary again", v, name)
+	}
+}
+
+func TestFallbackWithoutCooldown(t *testing.T) {
+	primary := &stubEmbedder{name: "remote", err: errors.New("down")}
+	f := Must(FallbackConfig{Primary: primary, Secondary: &stubEmbedder{name: "hash"}, Cooldown: -1, Logger: discard})
+	for i := 0; i < 3; i++ {
+		embedModel(t, f)
+	}
+	if n := primary.count(); n != 3 {
+		t.Errorf("primary called %d times, want every call with a negative cooldown", n)
+	}
+}
+
+func TestFallbackErrors(t *testing.T) {
+	primary := &stubEmbedder{name: "remote", err: errors.New("primary down")}
+	secondary := &stubEmbedder{name: "hash", err: errors.New("secondary down")}
+	f := Must(FallbackConfig{Primary: primary, Secondary: secondary, Logger: discard})
+	_, err := f.EmbedText(context.Background(), "x")
+	if err == nil || !strings.Contains(err.Error(), "primary down") || !strings.Contains(err.Error(), "secondary down") {
+		t.Errorf("both failing: %v, want both errors", err)
+	}
+	// the primary is cooling down now, so only the fallback is reported
+	if _, err := f.EmbedText(context.Background(), "x"); err == nil || strings.Contains(err.Error(), "primary down") {
+		t.Errorf("fallback failing alone: %v", err)
+	}
+
+	if _, err := NewFallback(FallbackConfig{Primary: primary}); err == nil {
+		t.Error("NewFallback accepted a chain without a secondary")
+	}
+}
+
+// cancellableEmbedder fails the way a client does once its context ends.
+type cancellableEmbedder struct{ stubEmbedder }
+
+func (c *cancellableEmbedder) EmbedText(ctx context.Context, text string) ([]float64, error) {
+	emb, err := c.stubEmbedder.EmbedText(ctx, text)
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("embedding request: %w", ctx.Err())
+	}
+	return emb, err
+}
+
+func TestFallbackDoesNotFallBackOnCancellation(t *testing.T) {
+	primary := &cancellableEmbedder{}
+	secondary := &stubEmbedder{name: "hash"}
+	f := Must(FallbackConfig{Primary: primary, Secondary: secondary, Logger: discard})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.EmbedText(ctx, "x"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled call: %v, want context.Canceled", err)
+	}
+	if secondary.count() != 0 {
+		t.Error("fallback used for a cancelled call")
+	}
+	// no cooldown was started either
+	f.EmbedText(context.Background(), "x")
+	if n := primary.count(); n != 2 {
+		t.Errorf("primary called %d times, want it tried again", n)
+	}
+}
+
+type unnamed struct{}
+
+func (unnamed) EmbedText(context.Context, string) ([]float64, error) { return []float64{0}, nil }
+
+func TestFallbackModelNames(t *testing.T) {
+	f := Must(FallbackConfig{Primary: unnamed{}, Secondary: &stubEmbedder{name: "hash"}, SecondaryModel: "hash-v2"})
+	if f.cfg.PrimaryModel != "embed.unnamed" || f.cfg.SecondaryModel != "hash-v2" {
+		t.Errorf("models = %q and %q", f.cfg.PrimaryModel, f.cfg.SecondaryModel)
+	}
+}
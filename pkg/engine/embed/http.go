@@ -0,0 +1,142 @@
+// Package embed provides embedding clients and combinators over
+// model.EmbeddingClient.
+package embed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPConfig configures HTTPEmbedder.
+type HTTPConfig struct {
+	// Endpoint is an embeddings compatible URL.
+	Endpoint string
+	APIKey   string
+	Model    string
+	// Timeout is a hard limit for each request.
+	Timeout    time.Duration
+	HTTPClient *http.Client
+}
+
+// HTTPEmbedder asks an OpenAI-compatible embeddings endpoint for vectors.
+type HTTPEmbedder struct {
+	cfg HTTPConfig
+}
+
+func NewHTTP(cfg HTTPConfig) *HTTPEmbedder {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://api.openai.com/v1/embeddings"
+	}
+	if cfg.Model == "" {
+		cfg.Model = "text-embedding-3-small"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{}
+	}
+	return &HTTPEmbedder{cfg: cfg}
+}
+
+// String returns the model name, which is recorded with the vectors.
+func (h *HTTPEmbedder) String() string { return h.cfg.Model }
+
+type embeddingRequest struct {
+	Model string `json:"model"`
+	Input string `json:"input"`
+}
+
+type embeddingResponse struct {
+	Data []struct {
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+}
+
+// EmbedText embeds text with one request.
+func (h *HTTPEmbedder) EmbedText(ctx context.Context, text string) ([]float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, h.cfg.Timeout)
+	defer cancel()
+
+	body, err := json.Marshal(embeddingRequest{Model: h.cfg.Model, Input: text})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+h.cfg.APIKey)
+	}
+	resp, err := h.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embedding request: %w", err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return nil, fmt.Errorf("embedding response: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, &StatusError{
+			StatusCode: resp.StatusCode,
+			Body:       truncate(string(raw), 200),
+			RetryAfter: retryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	var parsed embeddingResponse
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		return nil, fmt.Errorf("embedding response: %w", err)
+	}
+	if len(parsed.Data) == 0 || len(parsed.Data[0].Embedding) == 0 {
+		return nil, errors.New("embedding response: no embedding")
+	}
+	return parsed.Data[0].Embedding, nil
+}
+
+// StatusError is a non-2xx response from an embeddings endpoint.
+type StatusError struct {
+	StatusCode int
+	Body       string
+	// RetryAfter is the delay the server asked for, or 0.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("embedding request: status %d: %s", e.StatusCode, e.Body)
+}
+
+// Temporary reports whether the request may succeed when retried: the
+// server was rate limiting or failing, not rejecting the request.
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// retryAfter parses a Retry-After header given in seconds; dates are
+// ignored.
+func retryAfter(v string) time.Duration {
+	secs, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || secs <= 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "…"
+}
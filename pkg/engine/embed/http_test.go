@@ -0,0 +1,78 @@
+package embed
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// embeddingServer answers embeddings requests with handle.
+func embeddingServer(t *testing.T, handle func(w http.ResponseWriter, req embeddingRequest)) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var req embeddingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		handle(w, req)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHTTPEmbedder(t *testing.T) {
+	srv := embeddingServer(t, func(w http.ResponseWriter, req embeddingRequest) {
+		if req.Model != "small" || req.Input != "hello" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"data":[{"embedding":[0.5,-0.25]}]}`))
+	})
+	h := NewHTTP(HTTPConfig{Endpoint: srv.URL, APIKey: "key", Model: "small"})
+	if h.String() != "small" {
+		t.Errorf("String = %q, want the model", h.String())
+	}
+	emb, err := h.EmbedText(context.Background(), "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emb) != 2 || emb[0] != 0.5 || emb[1] != -0.25 {
+		t.Errorf("EmbedText = %v", emb)
+	}
+
+	if _, err := NewHTTP(HTTPConfig{Endpoint: srv.URL, Model: "small"}).EmbedText(context.Background(), "hello"); err == nil {
+		t.Error("request without the key succeeded")
+	}
+	if got := NewHTTP(HTTPConfig{}).String(); got != "text-embedding-3-small" {
+		t.Errorf("default model = %q", got)
+	}
+}
+
+func TestHTTPEmbedderRejectsBadResponses(t *testing.T) {
+	for name, body := range map[string]string{
+		"not json":        `<html>`,
+		"no data":         `{"data":[]}`,
+		"empty embedding": `{"data":[{"embedding":[]}]}`,
+	} {
+		srv := embeddingServer(t, func(w http.ResponseWriter, _ embeddingRequest) { w.Write([]byte(body)) })
+		if emb, err := NewHTTP(HTTPConfig{Endpoint: srv.URL, APIKey: "key"}).EmbedText(context.Background(), "x"); err == nil {
+			t.Errorf("%s: EmbedText = %v, want an error", name, emb)
+		}
+	}
+
+	slow := embeddingServer(t, func(w http.ResponseWriter, _ embeddingRequest) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte(`{"data":[{"embedding":[1]}]}`))
+	})
+	if _, err := NewHTTP(HTTPConfig{Endpoint: slow.URL, APIKey: "key", Timeout: 20 * time.Millisecond}).EmbedText(context.Background(), "x"); err == nil {
+		t.Error("request outlasting the timeout succeeded")
+	}
+}
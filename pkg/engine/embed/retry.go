@@ -0,0 +1,124 @@
+package embed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// RetryPolicy configures WithRetry.
+type RetryPolicy struct {
+	// MaxAttempts bounds the calls per text, the first included (default 3).
+	MaxAttempts int
+	// BaseDelay is the wait before the first retry, doubled for each further
+	// one up to MaxDelay (defaults 200ms and 5s). A longer Retry-After asked
+	// by the server is honored, still capped at MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Jitter randomizes each wait by up to this fraction of it, so clients
+	// throttled together do not retry in lockstep (default 0.2; negative
+	// disables it).
+	Jitter float64
+	// Retryable classifies errors (default Retryable).
+	Retryable func(error) bool
+}
+
+// DefaultRetryPolicy is the policy used for remote embedders.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 3, BaseDelay: 200 * time.Millisecond, MaxDelay: 5 * time.Second, Jitter: 0.2}
+}
+
+// Retryable reports whether err is transient: a status error that is
+// Temporary (429 or 5xx) or a failed round trip, such as a refused
+// connection or a request timeout.
+func Retryable(err error) bool {
+	var serr *StatusError
+	if errors.As(err, &serr) {
+		return serr.Temporary()
+	}
+	// *url.Error has a Temporary method too, but it is false for a refused
+	// connection, so round-trip failures are matched by type
+	var uerr *url.Error
+	return errors.As(err, &uerr)
+}
+
+// WithRetry retries the transient failures of client with exponential
+// backoff. A wait that would outlast the context deadline is not started:
+// the last error is returned at once, so retries never exceed the caller's
+// budget.
+func WithRetry(client model.EmbeddingClient, policy RetryPolicy) model.EmbeddingClient {
+	def := DefaultRetryPolicy()
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = def.MaxAttempts
+	}
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = def.BaseDelay
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = def.MaxDelay
+	}
+	if policy.MaxDelay < policy.BaseDelay {
+		policy.MaxDelay = policy.BaseDelay
+	}
+	if policy.Jitter == 0 {
+		policy.Jitter = def.Jitter
+	}
+	if policy.Retryable == nil {
+		policy.Retryable = Retryable
+	}
+	return &retryEmbedder{inner: client, policy: policy}
+}
+
+type retryEmbedder struct {
+	inner  model.EmbeddingClient
+	policy RetryPolicy
+}
+
+func (r *retryEmbedder) String() string { return nameOf(r.inner) }
+
+func (r *retryEmbedder) EmbedText(ctx context.Context, text string) ([]float64, error) {
+	for attempt := 1; ; attempt++ {
+		emb, err := r.inner.EmbedText(ctx, text)
+		if err == nil {
+			return emb, nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if attempt >= r.policy.MaxAttempts || !r.policy.Retryable(err) {
+			return nil, err
+		}
+		wait := r.delay(attempt, err)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return nil, fmt.Errorf("%w (no time left to retry)", err)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// delay is the wait after the given failed attempt.
+func (r *retryEmbedder) delay(attempt int, err error) time.Duration {
+	d := r.policy.BaseDelay
+	for i := 1; i < attempt && d < r.policy.MaxDelay; i++ {
+		d *= 2
+	}
+	if r.policy.Jitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * r.policy.Jitter * float64(d))
+	}
+	var serr *StatusError
+	if errors.As(err, &serr) && serr.RetryAfter > d {
+		d = serr.RetryAfter
+	}
+	return min(max(d, 0), r.policy.MaxDelay)
+}
@@ -0,0 +1,146 @@
+package embed
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failing fails its first n calls with err, then embeds.
+func failing(n int, err error) *scriptedEmbedder {
+	return &scriptedEmbedder{failures: n, err: err}
+}
+
+type scriptedEmbedder struct {
+	failures int
+	err      error
+	calls    int
+}
+
+func (s *scriptedEmbedder) EmbedText(context.Context, string) ([]float64, error) {
+	s.calls++
+	if s.calls <= s.failures {
+		return nil, s.err
+	}
+	return []float64{1}, nil
+}
+
+var unavailable = &StatusError{StatusCode: http.StatusServiceUnavailable, Body: "busy"}
+
+func fastPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond, Jitter: -1}
+}
+
+func TestRetryTransientFailures(t *testing.T) {
+	tests := []struct {
+		name      string
+		inner     *scriptedEmbedder
+		wantCalls int
+		wantErr   bool
+	}{
+		{"success", failing(0, nil), 1, false},
+		{"fails twice", failing(2, unavailable), 3, false},
+		{"fails every attempt", failing(5, unavailable), 3, true},
+		{"rate limited", failing(1, &StatusError{StatusCode: http.StatusTooManyRequests}), 2, false},
+		{"unreachable", failing(1, &url.Error{Op: "Post", URL: "http://x", Err: errors.New("connection refused")}), 2, false},
+		{"rejected", failing(1, &StatusError{StatusCode: http.StatusBadRequest}), 1, true},
+		{"not classified", failing(1, errors.New("bad vector")), 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := WithRetry(tt.inner, fastPolicy()).EmbedText(context.Background(), "x")
+			if (err != nil) != tt.wantErr || tt.inner.calls != tt.wantCalls {
+				t.Errorf("EmbedText = %v after %d calls, want error %v after %d", err, tt.inner.calls, tt.wantErr, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryStopsWhenCancelledDuringBackoff(t *testing.T) {
+	inner := failing(5, unavailable)
+	r := WithRetry(inner, RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour, Jitter: -1})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := r.EmbedText(ctx, "x")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("EmbedText = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("returned %v after the cancellation", elapsed)
+	}
+	if inner.calls != 1 {
+		t.Errorf("%d calls, want none after the cancellation", inner.calls)
+	}
+}
+
+func TestRetryDoesNotWaitPastTheDeadline(t *testing.T) {
+	inner := failing(5, unavailable)
+	r := WithRetry(inner, RetryPolicy{MaxAttempts: 5, BaseDelay: time.Minute, MaxDelay: time.Minute, Jitter: -1})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	_, err := r.EmbedText(ctx, "x")
+	if !errors.As(err, new(*StatusError)) || !strings.Contains(err.Error(), "no time left") {
+		t.Fatalf("EmbedText = %v, want the last failure", err)
+	}
+	if time.Since(start) > 500*time.Millisecond || inner.calls != 1 {
+		t.Errorf("waited %v and made %d calls, want an immediate return", time.Since(start), inner.calls)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	r := &retryEmbedder{policy: RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, Jitter: -1}}
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 5: time.Second, 10: time.Second} {
+		if got := r.delay(attempt, unavailable); got != want {
+			t.Errorf("delay after attempt %d = %v, want %v", attempt, got, want)
+		}
+	}
+	// a longer Retry-After is honored up to MaxDelay
+	if got := r.delay(1, &StatusError{StatusCode: 429, RetryAfter: 500 * time.Millisecond}); got != 500*time.Millisecond {
+		t.Errorf("delay with Retry-After 500ms = %v", got)
+	}
+	if got := r.delay(1, &StatusError{StatusCode: 429, RetryAfter: time.Hour}); got != time.Second {
+		t.Errorf("delay with Retry-After 1h = %v, want MaxDelay", got)
+	}
+
+	r.policy.Jitter = 0.2
+	for i := 0; i < 100; i++ {
+		if got := r.delay(2, unavailable); got < 160*time.Millisecond || got > 240*time.Millisecond {
+			t.Fatalf("jittered delay = %v, want within 20%% of 200ms", got)
+		}
+	}
+}
+
+func TestWithRetryDefaults(t *testing.T) {
+	r := WithRetry(failing(0, nil), RetryPolicy{BaseDelay: time.Minute}).(*retryEmbedder)
+	if r.policy.MaxAttempts != 3 || r.policy.MaxDelay != time.Minute || r.policy.Jitter != 0.2 || r.policy.Retryable == nil {
+		t.Errorf("policy = %+v, want the defaults with MaxDelay raised to BaseDelay", r.policy)
+	}
+}
+
+func TestHTTPStatusError(t *testing.T) {
+	srv := embeddingServer(t, func(w http.ResponseWriter, _ embeddingRequest) {
+		w.Header().Set("Retry-After", "7")
+		http.Error(w, strings.Repeat("slow down ", 50), http.StatusTooManyRequests)
+	})
+	_, err := NewHTTP(HTTPConfig{Endpoint: srv.URL, APIKey: "key"}).EmbedText(context.Background(), "x")
+	var serr *StatusError
+	if !errors.As(err, &serr) {
+		t.Fatalf("EmbedText = %v, want a *StatusError", err)
+	}
+	if serr.StatusCode != http.StatusTooManyRequests || serr.RetryAfter != 7*time.Second || !serr.Temporary() || len([]rune(serr.Body)) != 201 {
+		t.Errorf("status error = %+v", serr)
+	}
+	for v, want := range map[string]time.Duration{"": 0, "0": 0, "-3": 0, " 2 ": 2 * time.Second, "Wed, 21 Oct 2026 07:28:00 GMT": 0} {
+		if got := retryAfter(v); got != want {
+			t.Errorf("retryAfter(%q) = %v, want %v", v, got, want)
+		}
+	}
+}
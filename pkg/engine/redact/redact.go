@@ -0,0 +1,197 @@
+// Package redact removes personal data from inputs before they are stored.
+package redact
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// Redactor rewrites an input before it is stored, embedded or distilled. It
+// must not modify the input it is given; the returned input replaces it.
+type Redactor interface {
+	Redact(ctx context.Context, input model.SensoryInput) (model.SensoryInput, error)
+}
+
+// Categories of personal data Regex knows.
+const (
+	Email = "email"
+	Phone = "phone"
+	Card  = "card"
+)
+
+// Categories lists every category Regex knows.
+func Categories() []string {
+	return []string{Email, Card, Phone}
+}
+
+// Placeholders replace each redacted match, by category.
+var Placeholders = map[string]string{
+	Email: "[EMAIL]",
+	Phone: "[PHONE]",
+	Card:  "[CARD]",
+}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+	// 13 to 19 digits, optionally grouped by single spaces or dashes
+	cardPattern = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	// +country numbers; North American (555) 123-4567 and 555-123-4567
+	// forms; Chinese mobile numbers
+	phonePattern = regexp.MustCompile(`\+\d{1,3}(?:[ .-]?\(?\d{1,4}\)?){2,4}[ .-]?\d{2,4}\b|(?:\(\d{3}\)\s?|\b\d{3}[ .-])\d{3}[ .-]\d{4}\b|\b1[3-9]\d{9}\b`)
+)
+
+// Regex redacts emails, payment card numbers and phone numbers with
+// regular expressions, replacing each with its placeholder. To keep order
+// numbers, dates, versions, IP addresses and the like intact it only takes
+// card numbers that pass the Luhn check and start like one, and digits that
+// are not part of a longer run. It redacts the content and every string in
+// the metadata.
+type Regex struct {
+	email, card, phone bool
+}
+
+// NewRegex returns a Regex for the given categories; none means all.
+func NewRegex(categories ...string) (*Regex, error) {
+	if len(categories) == 0 {
+		categories = Categories()
+	}
+	r := &Regex{}
+	for _, c := range categories {
+		switch strings.ToLower(strings.TrimSpace(c)) {
+		case Email:
+			r.email = true
+		case Card:
+			r.card = true
+		case Phone:
+			r.phone = true
+		default:
+			return nil, fmt.Errorf("unknown redaction category %q (want %s)", c, strings.Join(Categories(), ", "))
+		}
+	}
+	return r, nil
+}
+
+func (r *Regex) String() string { return "regex" }
+
+// Redact returns input with its content and metadata strings redacted.
+func (r *Regex) Redact(_ context.Context, input model.SensoryInput) (model.SensoryInput, error) {
+	input.Content = r.RedactText(input.Content)
+	if input.Metadata != nil {
+		input.Metadata = r.redactValue(input.Metadata).(map[string]interface{})
+	}
+	return input, nil
+}
+
+// RedactText redacts s. Emails go first so their digits are not taken for
+// phone numbers, and card numbers before phone numbers for the same reason.
+func (r *Regex) RedactText(s string) string {
+	if r.email {
+		s = emailPattern.ReplaceAllLiteralString(s, Placeholders[Email])
+	}
+	if r.card {
+		s = replaceMatches(s, cardPattern, Placeholders[Card], cardLength)
+	}
+	if r.phone {
+		s = replaceMatches(s, phonePattern, Placeholders[Phone], func(m string) int { return len(m) })
+	}
+	return s
+}
+
+// redactValue copies v, a decoded JSON value, with its strings redacted.
+func (r *Regex) redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return r.RedactText(v)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			out[k] = r.redactValue(e)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = r.redactValue(e)
+		}
+		return out
+	}
+	return v
+}
+
+// replaceMatches replaces the matches of re in s, or the leading part of
+// each that length accepts, unless it continues a longer run of digits,
+// such as the first groups of a longer number. length returns 0 to keep a
+// match.
+func replaceMatches(s string, re *regexp.Regexp, placeholder string, length func(string) int) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range re.FindAllStringIndex(s, -1) {
+		start := loc[0]
+		n := length(s[start:loc[1]])
+		if n == 0 || continuesDigits(s, start, start+n) {
+			continue
+		}
+		end := start + n
+		b.WriteString(s[last:start])
+		b.WriteString(placeholder)
+		last = end
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// continuesDigits reports whether s[start:end] is next to more digits,
+// directly or across a dash or dot. A space ends the run: "room 12
+// 555-123-4567" holds two numbers, not a longer one.
+func continuesDigits(s string, start, end int) bool {
+	isDigit := func(i int) bool { return i >= 0 && i < len(s) && s[i] >= '0' && s[i] <= '9' }
+	isSep := func(i int) bool { return i >= 0 && i < len(s) && strings.IndexByte("-.", s[i]) >= 0 }
+	return isDigit(start-1) || isDigit(end) ||
+		(isSep(start-1) && isDigit(start-2)) || (isSep(end) && isDigit(end+1))
+}
+
+// cardLength returns the length of the longest prefix of m, cut at a
+// separator, that is a card number, or 0. The greedy match can take in the
+// first digits of a number that follows: "4111 1111 1111 1111 555-0100".
+func cardLength(m string) int {
+	for end := len(m); end > 0; end = strings.LastIndexAny(m[:end], " -") {
+		if isCardNumber(m[:end]) {
+			return end
+		}
+	}
+	return 0
+}
+
+// isCardNumber reports whether m has the length and first digit of a card
+// number and passes the Luhn check.
+func isCardNumber(m string) bool {
+	var digits []byte
+	for i := 0; i < len(m); i++ {
+		if m[i] >= '0' && m[i] <= '9' {
+			digits = append(digits, m[i]-'0')
+		}
+	}
+	if len(digits) < 13 || len(digits) > 19 || digits[0] < 2 || digits[0] > 6 {
+		return false
+	}
+	sum := 0
+	for i := range digits {
+		d := int(digits[len(digits)-1-i])
+		if i%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+var _ Redactor = (*Regex)(nil)
@@ -0,0 +1,123 @@
+package redact
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+func TestRegexRedactsText(t *testing.T) {
+	r, err := NewRegex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct{ in, want string }{
+		{"mail alice@example.com now", "mail [EMAIL] now"},
+		{"a.b+tag@mail.co.uk", "[EMAIL]"},
+		// the digits of an address are not a phone number
+		{"bob4155552671@x.io", "[EMAIL]"},
+		{"card 4111 1111 1111 1111 ok", "card [CARD] ok"},
+		{"4111-1111-1111-1111", "[CARD]"},
+		{"5555555555554444", "[CARD]"},
+		{"+1 415 555 2671", "[PHONE]"},
+		{"+86 138 1234 5678", "[PHONE]"},
+		{"(555) 123-4567", "[PHONE]"},
+		{"tel:555.123.4567", "tel:[PHONE]"},
+		{"call 13812345678", "call [PHONE]"},
+		{"alice@example.com or 555-123-4567", "[EMAIL] or [PHONE]"},
+		// numbers next to each other across a space are separate numbers
+		{"room 12 555-123-4567", "room 12 [PHONE]"},
+		{"555-123-4567 555-987-6543", "[PHONE] [PHONE]"},
+		{"4111 1111 1111 1111 555-123-4567", "[CARD] [PHONE]"},
+	} {
+		if got := r.RedactText(tt.in); got != tt.want {
+			t.Errorf("RedactText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRegexKeepsNearMisses(t *testing.T) {
+	r, err := NewRegex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, in := range []string{
+		"user@localhost",
+		"follow @handle",
+		// fails the Luhn check
+		"order 4111111111111112",
+		// passes it, but no card number starts with 1
+		"1234567890123",
+		// one digit too many for a mobile number
+		"138123456789",
+		// part of a longer run of digits
+		"ref 12555-123-4567",
+		"555-1234",
+		"2024-06-01",
+		"12:30-14:45",
+		"v1.2.3",
+		"192.168.1.10",
+		"ISBN 978-3-16-148410-0",
+		"timestamp 1700000000000",
+	} {
+		if got := r.RedactText(in); got != in {
+			t.Errorf("RedactText(%q) = %q, want it unchanged", in, got)
+		}
+	}
+}
+
+func TestRegexCategories(t *testing.T) {
+	const text = "alice@example.com 4111 1111 1111 1111 555-123-4567"
+	for _, tt := range []struct {
+		categories []string
+		want       string
+	}{
+		{nil, "[EMAIL] [CARD] [PHONE]"},
+		{[]string{"email"}, "[EMAIL] 4111 1111 1111 1111 555-123-4567"},
+		{[]string{" Card ", "PHONE"}, "alice@example.com [CARD] [PHONE]"},
+	} {
+		r, err := NewRegex(tt.categories...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.RedactText(text); got != tt.want {
+			t.Errorf("categories %q: %q, want %q", tt.categories, got, tt.want)
+		}
+	}
+	if _, err := NewRegex("email", "ssn"); err == nil {
+		t.Error("NewRegex accepted an unknown category")
+	}
+}
+
+func TestRegexRedactsMetadataCopy(t *testing.T) {
+	r, err := NewRegex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := map[string]interface{}{
+		"from":  "alice@example.com",
+		"count": 3.0,
+		"to":    []interface{}{"bob@example.com", "carol"},
+		"card":  map[string]interface{}{"number": "4111 1111 1111 1111", "valid": true},
+	}
+	in := model.SensoryInput{Content: "call 555-123-4567", Source: "mail", Metadata: meta}
+	out, err := r.Redact(context.Background(), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"from":  "[EMAIL]",
+		"count": 3.0,
+		"to":    []interface{}{"[EMAIL]", "carol"},
+		"card":  map[string]interface{}{"number": "[CARD]", "valid": true},
+	}
+	if out.Content != "call [PHONE]" || out.Source != "mail" || !reflect.DeepEqual(out.Metadata, want) {
+		t.Errorf("Redact = %+v, want content and metadata redacted", out)
+	}
+	if meta["from"] != "alice@example.com" || meta["to"].([]interface{})[0] != "bob@example.com" ||
+		meta["card"].(map[string]interface{})["number"] != "4111 1111 1111 1111" {
+		t.Errorf("Redact modified the input metadata: %v", meta)
+	}
+}
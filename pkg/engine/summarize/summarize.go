@@ -0,0 +1,56 @@
+// Package summarize condenses groups of old memory logs into summaries.
+package summarize
+
+import (
+	"context"
+	"strings"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// Summarizer condenses a group of related logs, in time order, into the
+// content of one summary log. An empty summary leaves the group as it is.
+type Summarizer interface {
+	Summarize(ctx context.Context, logs []model.LogEntry) (string, error)
+}
+
+// Noop summarizes nothing; it is the default.
+type Noop struct{}
+
+func (Noop) String() string { return "none" }
+
+func (Noop) Summarize(context.Context, []model.LogEntry) (string, error) { return "", nil }
+
+// Extractive summarizes without a model by joining the first line of each
+// distinct log, up to MaxChars characters (default 1000).
+type Extractive struct {
+	MaxChars int
+}
+
+func NewExtractive(maxChars int) *Extractive {
+	if maxChars <= 0 {
+		maxChars = 1000
+	}
+	return &Extractive{MaxChars: maxChars}
+}
+
+func (e *Extractive) String() string { return "extractive" }
+
+func (e *Extractive) Summarize(_ context.Context, logs []model.LogEntry) (string, error) {
+	seen := make(map[string]bool)
+	var parts []string
+	for _, l := range logs {
+		line, _, _ := strings.Cut(strings.TrimSpace(l.Content), "\n")
+		line = strings.TrimSpace(line)
+		if line == "" || seen[strings.ToLower(line)] {
+			continue
+		}
+		seen[strings.ToLower(line)] = true
+		parts = append(parts, line)
+	}
+	summary := strings.Join(parts, "; ")
+	if r := []rune(summary); len(r) > e.MaxChars {
+		summary = string(r[:e.MaxChars])
+	}
+	return summary, nil
+}
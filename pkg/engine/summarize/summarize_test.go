@@ -0,0 +1,49 @@
+package summarize
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+func logs(contents ...string) []model.LogEntry {
+	out := make([]model.LogEntry, len(contents))
+	for i, c := range contents {
+		out[i] = model.LogEntry{Content: c}
+	}
+	return out
+}
+
+func TestExtractive(t *testing.T) {
+	got, err := NewExtractive(0).Summarize(context.Background(), logs(
+		"  Met Alice.\nShe works at Acme.",
+		"met alice.",
+		"",
+		"Booked a flight.",
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Met Alice.; Booked a flight."; got != want {
+		t.Errorf("summary = %q, want %q", got, want)
+	}
+
+	got, err = NewExtractive(5).Summarize(context.Background(), logs("héllo wörld"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "héllo" {
+		t.Errorf("summary capped at 5 characters = %q", got)
+	}
+	if got, _ := NewExtractive(0).Summarize(context.Background(), logs(strings.Repeat("x", 1200))); len(got) != 1000 {
+		t.Errorf("default cap kept %d characters, want 1000", len(got))
+	}
+}
+
+func TestNoop(t *testing.T) {
+	if got, err := (Noop{}).Summarize(context.Background(), logs("a", "b")); got != "" || err != nil {
+		t.Errorf("Noop = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,387 @@
+// Package grpcapi serves the memory engine over gRPC. The service is defined
+// in paimpb/paim.proto and mirrors the core routes of the HTTP API.
+package grpcapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/johncui/PAIM/pkg/grpcapi/paimpb"
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+)
+
+// Config configures a Server.
+type Config struct {
+	// APIKey, when set, must be sent as "authorization: Bearer <key>"
+	// metadata on every call.
+	APIKey string
+	// MaxTopK caps top_k of Ask; 0 means no cap.
+	MaxTopK int
+	// RequestTimeout bounds every call except Consolidate and RememberBatch,
+	// on top of any deadline the client sets. 0 disables it.
+	RequestTimeout time.Duration
+	// MaxBatchBytes bounds the encoded size of the memories one
+	// RememberBatch stream carries, which are held in memory until the
+	// client half-closes it; 0 means DefaultMaxBatchBytes.
+	MaxBatchBytes int
+	Logger        *slog.Logger
+}
+
+// DefaultMaxBatchBytes is the default Config.MaxBatchBytes, the default
+// request body limit of the HTTP API.
+const DefaultMaxBatchBytes = 1 << 20
+
+// Server implements paimpb.MemoryServer on top of a MemoryEngine.
+type Server struct {
+	paimpb.UnimplementedMemoryServer
+
+	engine *store.MemoryEngine
+	cfg    Config
+	logger *slog.Logger
+}
+
+// NewServer creates a Server for engine.
+func NewServer(engine *store.MemoryEngine, cfg Config) *Server {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if cfg.MaxBatchBytes <= 0 {
+		cfg.MaxBatchBytes = DefaultMaxBatchBytes
+	}
+	return &Server{engine: engine, cfg: cfg, logger: logger}
+}
+
+// GRPCServer returns a grpc.Server with s registered and the API key and
+// timeout interceptors installed.
+func (s *Server) GRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(s.authUnary, s.timeoutUnary),
+		grpc.ChainStreamInterceptor(s.authStream),
+	)
+	gs := grpc.NewServer(opts...)
+	paimpb.RegisterMemoryServer(gs, s)
+	return gs
+}
+
+// Remember records one memory.
+func (s *Server) Remember(ctx context.Context, req *paimpb.RememberRequest) (*paimpb.RememberResponse, error) {
+	in, err := toSensoryInput(req)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := s.engine.ObserveBatch(ctx, []model.SensoryInput{in})
+	if err != nil {
+		return nil, s.toStatus(ctx, "Remember", err)
+	}
+	return &paimpb.RememberResponse{LogId: ids[0]}, nil
+}
+
+// RememberBatch collects the streamed memories and records them together
+// once the client half-closes the stream. A stream carrying more than
+// Config.MaxBatchBytes fails with ResourceExhausted and records nothing.
+func (s *Server) RememberBatch(stream paimpb.Memory_RememberBatchServer) error {
+	var inputs []model.SensoryInput
+	size := 0
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if size += proto.Size(req); size > s.cfg.MaxBatchBytes {
+			return status.Errorf(codes.ResourceExhausted, "batch exceeds %d bytes; split it into smaller streams", s.cfg.MaxBatchBytes)
+		}
+		in, err := toSensoryInput(req)
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, in)
+	}
+	if len(inputs) == 0 {
+		return status.Error(codes.InvalidArgument, "at least one input is required")
+	}
+	ids, err := s.engine.ObserveBatch(stream.Context(), inputs)
+	if err != nil {
+		return s.toStatus(stream.Context(), "RememberBatch", err)
+	}
+	return stream.SendAndClose(&paimpb.RememberBatchResponse{LogIds: ids})
+}
+
+// Ask recalls context for the query.
+func (s *Server) Ask(ctx context.Context, req *paimpb.AskRequest) (*paimpb.AskResponse, error) {
+	topK := int(req.GetTopK())
+	switch {
+	case topK < 0:
+		return nil, status.Errorf(codes.InvalidArgument, "top_k must be positive, got %d", topK)
+	case topK == 0:
+		topK = 5
+	case s.cfg.MaxTopK > 0 && topK > s.cfg.MaxTopK:
+		topK = s.cfg.MaxTopK
+	}
+	opts := model.RecallOptions{
+		TopK:           topK,
+		Namespace:      req.GetNamespace(),
+		Source:         req.GetSource(),
+		Metadata:       req.GetMetadata(),
+		ExpandSessions: req.GetExpandSessions(),
+		SessionWindow:  int(req.GetSessionWindow()),
+		MinConfidence:  req.GetMinConfidence(),
+		Predicate:      req.GetPredicate(),
+		Match:          req.GetMatch(),
+	}
+	for _, l := range []struct {
+		n   int32
+		dst *int
+	}{{req.GetMaxFacts(), &opts.MaxFacts}, {req.GetMaxLogs(), &opts.MaxLogs}} {
+		if l.n < 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "max_facts and max_logs must not be negative, got %d", l.n)
+		}
+		*l.dst = int(l.n)
+		if s.cfg.MaxTopK > 0 && *l.dst > s.cfg.MaxTopK {
+			*l.dst = s.cfg.MaxTopK
+		}
+	}
+	if req.GetFrom() != nil {
+		opts.From = req.GetFrom().AsTime()
+	}
+	if req.GetTo() != nil {
+		opts.To = req.GetTo().AsTime()
+	}
+	if hl := req.GetRecencyHalfLife(); hl != nil {
+		if opts.RecencyHalfLife = hl.AsDuration(); opts.RecencyHalfLife <= 0 {
+			opts.RecencyHalfLife = -1
+		}
+	}
+	res, err := s.engine.RecallWithOptions(ctx, req.GetQuery(), opts)
+	if err != nil {
+		return nil, s.toStatus(ctx, "Ask", err)
+	}
+	out, err := fromRecalledContext(res)
+	if err != nil {
+		return nil, s.toStatus(ctx, "Ask", err)
+	}
+	return out, nil
+}
+
+// Consolidate distills buffered inputs into facts.
+func (s *Server) Consolidate(ctx context.Context, _ *paimpb.ConsolidateRequest) (*paimpb.ConsolidateResponse, error) {
+	if err := s.engine.Consolidate(ctx); err != nil {
+		return nil, s.toStatus(ctx, "Consolidate", err)
+	}
+	return &paimpb.ConsolidateResponse{}, nil
+}
+
+// Stats summarizes the engine's state.
+func (s *Server) Stats(ctx context.Context, _ *paimpb.StatsRequest) (*paimpb.StatsResponse, error) {
+	st, err := s.engine.Stats(ctx)
+	if err != nil {
+		return nil, s.toStatus(ctx, "Stats", err)
+	}
+	return &paimpb.StatsResponse{
+		Logs:                     st.Logs,
+		Triples:                  st.Triples,
+		Embeddings:               st.Embeddings,
+		PendingEmbeddings:        st.PendingEmbeddings,
+		BufferLen:                int64(st.BufferLen),
+		BufferOldestAgeSeconds:   st.BufferOldestAgeSeconds,
+		DbSizeBytes:              st.DBSizeBytes,
+		WalSizeBytes:             st.WALSizeBytes,
+		LastConsolidation:        optionalTimestamp(st.LastConsolidation),
+		LastConsolidationFailure: optionalTimestamp(st.LastConsolidationFailure),
+		LastConsolidationError:   st.LastConsolidationError,
+		SchemaVersion:            int32(st.SchemaVersion),
+		BufferCapacity:           int64(st.BufferCapacity),
+		BufferEvicted:            st.BufferEvicted,
+		BufferExpired:            st.BufferExpired,
+		BufferOverflow:           st.BufferOverflow,
+		EmbedderBreaker:          st.EmbedderBreaker,
+		EmbedderFailures:         int64(st.EmbedderFailures),
+	}, nil
+}
+
+// toStatus maps an engine error to a gRPC status the same way the HTTP API
+// maps it to a response: invalid-input and not-found messages are passed on,
+// anything else is logged and replaced by a generic message.
+func (s *Server) toStatus(ctx context.Context, method string, err error) error {
+	switch {
+	case errors.Is(err, store.ErrInvalidInput):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, store.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, store.ErrReadOnly):
+		return status.Error(codes.FailedPrecondition, "the server is read-only")
+	case errors.Is(err, context.DeadlineExceeded):
+		s.logger.WarnContext(ctx, "grpc call timed out", "method", method, "err", err)
+		return status.Error(codes.DeadlineExceeded, "request timed out")
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, "request canceled")
+	case store.IsUnavailable(err):
+		s.logger.WarnContext(ctx, "grpc call failed", "method", method, "err", err)
+		return status.Error(codes.Unavailable, "temporarily unavailable, retry later")
+	default:
+		s.logger.ErrorContext(ctx, "grpc call failed", "method", method, "err", err)
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+func (s *Server) authorized(ctx context.Context) error {
+	if s.cfg.APIKey == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	var got string
+	if v := md.Get("authorization"); len(v) > 0 {
+		got = v[0]
+	}
+	if subtle.ConstantTimeCompare([]byte(got), []byte("Bearer "+s.cfg.APIKey)) != 1 {
+		return status.Error(codes.Unauthenticated, "missing or invalid API key")
+	}
+	return nil
+}
+
+func (s *Server) authUnary(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := s.authorized(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) authStream(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.authorized(ss.Context()); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// timeoutUnary applies RequestTimeout, leaving Consolidate unbounded as the
+// HTTP API does.
+func (s *Server) timeoutUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if s.cfg.RequestTimeout <= 0 || strings.HasSuffix(info.FullMethod, "/Consolidate") {
+		return handler(ctx, req)
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.RequestTimeout)
+	defer cancel()
+	return handler(ctx, req)
+}
+
+func toSensoryInput(req *paimpb.RememberRequest) (model.SensoryInput, error) {
+	if strings.TrimSpace(req.GetContent()) == "" {
+		return model.SensoryInput{}, status.Error(codes.InvalidArgument, "content is required")
+	}
+	in := model.SensoryInput{Content: req.GetContent(), Source: req.GetSource(), Namespace: req.GetNamespace(), SessionID: req.GetSessionId()}
+	if in.Source == "" {
+		in.Source = "chat"
+	}
+	if req.GetMetadata() != nil {
+		in.Metadata = req.GetMetadata().AsMap()
+	}
+	if req.GetTimestamp() != nil {
+		in.Timestamp = req.GetTimestamp().AsTime()
+	}
+	return in, nil
+}
+
+func fromRecalledContext(res *model.RecalledContext) (*paimpb.AskResponse, error) {
+	out := &paimpb.AskResponse{Recent: res.Recent, VectorSkipped: res.VectorSkipped}
+	for i := range res.RelatedLogs {
+		l, err := fromLogEntry(&res.RelatedLogs[i])
+		if err != nil {
+			return nil, err
+		}
+		out.RelatedLogs = append(out.RelatedLogs, l)
+	}
+	for i := range res.RelatedFacts {
+		out.RelatedFacts = append(out.RelatedFacts, fromTriple(&res.RelatedFacts[i]))
+	}
+	for _, it := range res.Ranked {
+		item := &paimpb.RecalledItem{Kind: it.Kind, Score: it.Score, Distance: it.Distance}
+		if it.Log != nil {
+			l, err := fromLogEntry(it.Log)
+			if err != nil {
+				return nil, err
+			}
+			item.Log = l
+		}
+		if it.Fact != nil {
+			item.Fact = fromTriple(it.Fact)
+		}
+		out.Ranked = append(out.Ranked, item)
+	}
+	for _, sc := range res.Sessions {
+		session := &paimpb.Session{SessionId: sc.SessionID}
+		for i := range sc.Logs {
+			l, err := fromLogEntry(&sc.Logs[i])
+			if err != nil {
+				return nil, err
+			}
+			session.Logs = append(session.Logs, l)
+		}
+		out.Sessions = append(out.Sessions, session)
+	}
+	return out, nil
+}
+
+func fromLogEntry(l *model.LogEntry) (*paimpb.LogEntry, error) {
+	out := &paimpb.LogEntry{
+		Id:         l.ID,
+		Timestamp:  timestamppb.New(l.Timestamp),
+		SourceType: l.SourceType,
+		Content:    l.Content,
+		Namespace:  l.Namespace,
+		SessionId:  l.SessionID,
+
+		LastAccessedAt: optionalTimestamp(l.LastAccessedAt),
+		AccessCount:    int32(l.AccessCount),
+	}
+	if l.Metadata != nil {
+		md, err := structpb.NewStruct(l.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		out.Metadata = md
+	}
+	return out, nil
+}
+
+func fromTriple(t *model.Triple) *paimpb.Triple {
+	return &paimpb.Triple{
+		Id:               t.ID,
+		Subject:          t.Subject,
+		Predicate:        t.Predicate,
+		Object:           t.Object,
+		Confidence:       t.Confidence,
+		CreatedAt:        timestamppb.New(t.CreatedAt),
+		SubjectLabel:     t.SubjectLabel,
+		ObjectLabel:      t.ObjectLabel,
+		ObservationCount: int32(t.ObservationCount),
+		Sources:          t.Sources,
+		Namespace:        t.Namespace,
+
+		LastAccessedAt: optionalTimestamp(t.LastAccessedAt),
+		AccessCount:    int32(t.AccessCount),
+	}
+}
+
+func optionalTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
@@ -0,0 +1,292 @@
+package grpcapi_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/johncui/PAIM/pkg/grpcapi"
+	"github.com/johncui/PAIM/pkg/grpcapi/paimpb"
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+// newTestClient serves engine over an in-process connection and returns a
+// client for it.
+func newTestClient(t *testing.T, engine *store.MemoryEngine, cfg grpcapi.Config) paimpb.MemoryClient {
+	t.Helper()
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	lis := bufconn.Listen(1 << 20)
+	gs := grpcapi.NewServer(engine, cfg).GRPCServer()
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return paimpb.NewMemoryClient(conn)
+}
+
+func rememberBatch(ctx context.Context, c paimpb.MemoryClient, contents ...string) (*paimpb.RememberBatchResponse, error) {
+	stream, err := c.RememberBatch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, content := range contents {
+		if err := stream.Send(&paimpb.RememberRequest{Content: content}); err != nil {
+			// the server has failed the stream; CloseAndRecv reports why
+			break
+		}
+	}
+	return stream.CloseAndRecv()
+}
+
+func wantCode(t *testing.T, what string, err error, want codes.Code) {
+	t.Helper()
+	if got := status.Code(err); got != want {
+		t.Errorf("%s: code %v (%v), want %v", what, got, err, want)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, storetest.NewTestEngine(t), grpcapi.Config{})
+
+	one, err := c.Remember(ctx, &paimpb.RememberRequest{Content: "Alice works at Acme.", Namespace: "work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if one.GetLogId() == "" {
+		t.Error("Remember returned no log id")
+	}
+	batch, err := rememberBatch(ctx, c, "Bob lives in Berlin.", "Carol likes tea.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batch.GetLogIds()) != 2 {
+		t.Errorf("RememberBatch returned %d ids, want 2", len(batch.GetLogIds()))
+	}
+	if _, err := c.Consolidate(ctx, &paimpb.ConsolidateRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := c.Ask(ctx, &paimpb.AskRequest{Query: "Alice", Namespace: "work", TopK: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, f := range res.GetRelatedFacts() {
+		if f.GetSubject() == "alice" && f.GetNamespace() == "work" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Ask facts = %v, want alice's fact", res.GetRelatedFacts())
+	}
+
+	st, err := c.Stats(ctx, &paimpb.StatsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.GetLogs() != 3 || st.GetTriples() == 0 {
+		t.Errorf("Stats = %d logs and %d triples, want 3 logs and some triples", st.GetLogs(), st.GetTriples())
+	}
+}
+
+func TestRememberBatchTooLarge(t *testing.T) {
+	ctx := context.Background()
+	engine := storetest.NewTestEngine(t)
+	c := newTestClient(t, engine, grpcapi.Config{MaxBatchBytes: 64})
+
+	_, err := rememberBatch(ctx, c, strings.Repeat("a", 40), strings.Repeat("b", 40))
+	wantCode(t, "oversized batch", err, codes.ResourceExhausted)
+	st, err := engine.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Logs != 0 {
+		t.Errorf("%d logs recorded from a rejected stream, want none", st.Logs)
+	}
+
+	if _, err := rememberBatch(ctx, c, strings.Repeat("a", 40)); err != nil {
+		t.Errorf("batch under the limit: %v", err)
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, storetest.NewTestEngine(t), grpcapi.Config{})
+
+	_, err := c.Remember(ctx, &paimpb.RememberRequest{Content: "  "})
+	wantCode(t, "empty content", err, codes.InvalidArgument)
+	_, err = c.Ask(ctx, &paimpb.AskRequest{Query: "x", TopK: -1})
+	wantCode(t, "negative top_k", err, codes.InvalidArgument)
+	_, err = c.Ask(ctx, &paimpb.AskRequest{Query: "x", MaxFacts: -1})
+	wantCode(t, "negative max_facts", err, codes.InvalidArgument)
+	_, err = rememberBatch(ctx, c)
+	wantCode(t, "empty batch", err, codes.InvalidArgument)
+	_, err = rememberBatch(ctx, c, "ok", "")
+	wantCode(t, "batch with empty content", err, codes.InvalidArgument)
+}
+
+func TestReadOnlyIsFailedPrecondition(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "paim.db")
+	rw, err := store.NewMemoryEngine(context.Background(), store.Options{DBPath: path, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.Observe(context.Background(), model.SensoryInput{Content: "Alice works at Acme."}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestClient(t, storetest.NewTestEngineWithOptions(t, store.Options{DBPath: path, ReadOnly: true}), grpcapi.Config{})
+
+	_, err = c.Remember(context.Background(), &paimpb.RememberRequest{Content: "Alice works at Acme."})
+	wantCode(t, "Remember on a read-only server", err, codes.FailedPrecondition)
+	_, err = rememberBatch(context.Background(), c, "Alice works at Acme.")
+	wantCode(t, "RememberBatch on a read-only server", err, codes.FailedPrecondition)
+	_, err = c.Consolidate(context.Background(), &paimpb.ConsolidateRequest{})
+	wantCode(t, "Consolidate on a read-only server", err, codes.FailedPrecondition)
+	// the snapshot written above is served, not a fresh database
+	if st, err := c.Stats(context.Background(), &paimpb.StatsRequest{}); err != nil || st.GetLogs() != 1 {
+		t.Errorf("Stats on a read-only server = %v, %v; want the seeded log", st, err)
+	}
+}
+
+func TestAPIKey(t *testing.T) {
+	c := newTestClient(t, storetest.NewTestEngine(t), grpcapi.Config{APIKey: "s3cret"})
+
+	_, err := c.Stats(context.Background(), &paimpb.StatsRequest{})
+	wantCode(t, "unary call without a key", err, codes.Unauthenticated)
+	_, err = rememberBatch(context.Background(), c, "Alice works at Acme.")
+	wantCode(t, "stream without a key", err, codes.Unauthenticated)
+
+	wrong := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer nope")
+	_, err = c.Stats(wrong, &paimpb.StatsRequest{})
+	wantCode(t, "wrong key", err, codes.Unauthenticated)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer s3cret")
+	if _, err := c.Stats(ctx, &paimpb.StatsRequest{}); err != nil {
+		t.Errorf("unary call with the key: %v", err)
+	}
+	if _, err := rememberBatch(ctx, c, "Alice works at Acme."); err != nil {
+		t.Errorf("stream with the key: %v", err)
+	}
+}
+
+func TestRememberTimestamp(t *testing.T) {
+	ctx := context.Background()
+	engine := storetest.NewTestEngine(t)
+	c := newTestClient(t, engine, grpcapi.Config{})
+	at := time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC)
+	res, err := c.Remember(ctx, &paimpb.RememberRequest{Content: "old", Timestamp: timestamppb.New(at)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := engine.Log(ctx, "", res.GetLogId())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !l.Log.Timestamp.Equal(at) {
+		t.Errorf("timestamp = %v, want %v", l.Log.Timestamp, at)
+	}
+	_, err = c.Remember(ctx, &paimpb.RememberRequest{Content: "x", Timestamp: timestamppb.New(time.Now().Add(time.Hour))})
+	wantCode(t, "future timestamp", err, codes.InvalidArgument)
+}
+
+func TestAskFactAndLogLimits(t *testing.T) {
+	ctx := context.Background()
+	engine := storetest.NewTestEngine(t)
+	c := newTestClient(t, engine, grpcapi.Config{MaxTopK: 2})
+	for _, content := range []string{"Alice works at Acme.", "Alice lives in Berlin.", "Alice is a doctor."} {
+		if _, err := c.Remember(ctx, &paimpb.RememberRequest{Content: content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.Consolidate(ctx, &paimpb.ConsolidateRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.Ask(ctx, &paimpb.AskRequest{MaxFacts: 5, MaxLogs: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.GetRelatedFacts()) != 2 || len(res.GetRelatedLogs()) != 1 {
+		t.Errorf("%d facts and %d logs, want the fact limit clamped to 2 and 1 log", len(res.GetRelatedFacts()), len(res.GetRelatedLogs()))
+	}
+}
+
+func TestStatsReportsBufferDrops(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, storetest.NewTestEngineWithOptions(t, store.Options{BufferSize: 1, ConsolidateFillRatio: -1}), grpcapi.Config{})
+	for _, content := range []string{"a", "b"} {
+		if _, err := c.Remember(ctx, &paimpb.RememberRequest{Content: content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st, err := c.Stats(ctx, &paimpb.StatsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.GetBufferCapacity() != 1 || st.GetBufferEvicted() != 1 || st.GetBufferExpired() != 0 {
+		t.Errorf("buffer capacity %d, evicted %d, expired %d; want 1, 1, 0", st.GetBufferCapacity(), st.GetBufferEvicted(), st.GetBufferExpired())
+	}
+}
+
+func TestStatsReportsTheEmbedderBreaker(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, storetest.NewTestEngineWithOptions(t, store.Options{
+		Embedder:              downEmbedder{},
+		VectorDim:             8,
+		StoreEmbeddings:       true,
+		SyncEmbedding:         true,
+		EmbedBreakerThreshold: 1,
+		EmbedBreakerCooldown:  time.Hour,
+	}), grpcapi.Config{})
+	st, err := c.Stats(ctx, &paimpb.StatsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.GetEmbedderBreaker() != store.BreakerClosed {
+		t.Errorf("breaker %q before any failure, want closed", st.GetEmbedderBreaker())
+	}
+	if _, err := c.Remember(ctx, &paimpb.RememberRequest{Content: "Alice works at Acme."}); err != nil {
+		t.Fatal(err)
+	}
+	st, err = c.Stats(ctx, &paimpb.StatsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.GetEmbedderBreaker() != store.BreakerOpen || st.GetEmbedderFailures() != 1 {
+		t.Errorf("breaker %q with %d failures, want open with 1", st.GetEmbedderBreaker(), st.GetEmbedderFailures())
+	}
+}
+
+// downEmbedder fails every call.
+type downEmbedder struct{}
+
+func (downEmbedder) EmbedText(context.Context, string) ([]float64, error) {
+	return nil, errors.New("embedder down")
+}
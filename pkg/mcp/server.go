@@ -0,0 +1,392 @@
+// Package mcp serves the memory engine as Model Context Protocol tools over a
+// newline-delimited JSON-RPC 2.0 stream, as MCP clients expect from a server
+// started on stdio.
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+)
+
+// protocolVersions lists the MCP revisions the server speaks, newest first.
+var protocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// JSON-RPC error codes.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+// Config configures a Server.
+type Config struct {
+	// Version is reported to clients as the server version.
+	Version string
+	// MaxTopK caps top_k of the recall tool; 0 means store.DefaultMaxTopK.
+	MaxTopK int
+	// Namespace is where the tools remember and recall; empty means the
+	// default namespace.
+	Namespace string
+	Logger    *slog.Logger
+}
+
+// Server answers MCP requests with MemoryEngine calls.
+type Server struct {
+	engine *store.MemoryEngine
+	cfg    Config
+	logger *slog.Logger
+}
+
+// NewServer creates a Server for engine.
+func NewServer(engine *store.MemoryEngine, cfg Config) *Server {
+	if cfg.MaxTopK <= 0 {
+		cfg.MaxTopK = store.DefaultMaxTopK
+	}
+	if cfg.Version == "" {
+		cfg.Version = "dev"
+	}
+	if cfg.Namespace == "" {
+		cfg.Namespace = model.DefaultNamespace
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Server{engine: engine, cfg: cfg, logger: logger}
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string { return e.Message }
+
+// Serve reads requests from r and writes responses to w, one JSON message
+// per line, until r is exhausted or ctx is done. Malformed messages and
+// failing tools are answered with errors; only a broken stream ends it.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	in := bufio.NewReader(r)
+	for {
+		line, err := in.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			if resp := s.handleMessage(ctx, line); resp != nil {
+				if werr := writeResponse(w, resp); werr != nil {
+					return werr
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+func writeResponse(w io.Writer, resp *response) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// handleMessage returns the response to one message, or nil for a
+// notification.
+func (s *Server) handleMessage(ctx context.Context, line []byte) (resp *response) {
+	if line[0] == '[' {
+		return errorResponse(nil, codeInvalidRequest, "batch requests are not supported")
+	}
+	var req request
+	if err := json.Unmarshal(line, &req); err != nil {
+		return errorResponse(nil, codeParseError, "parse error: "+err.Error())
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return errorResponse(req.ID, codeInvalidRequest, "invalid JSON-RPC 2.0 request")
+	}
+	notification := len(req.ID) == 0
+	defer func() {
+		if p := recover(); p != nil {
+			s.logger.Error("mcp handler panicked", "method", req.Method, "panic", p)
+			resp = errorResponse(req.ID, codeInternalError, "internal error")
+		}
+		if notification {
+			resp = nil
+		}
+	}()
+
+	result, err := s.dispatch(ctx, req)
+	if err != nil {
+		var re *rpcError
+		if !errors.As(err, &re) {
+			re = &rpcError{Code: codeInternalError, Message: err.Error()}
+		}
+		return errorResponse(req.ID, re.Code, re.Message)
+	}
+	if result == nil {
+		result = map[string]any{}
+	}
+	return &response{JSONRPC: "2.0", ID: req.ID, Result: result}
+}
+
+func errorResponse(id json.RawMessage, code int, msg string) *response {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return &response{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: code, Message: msg}}
+}
+
+func (s *Server) dispatch(ctx context.Context, req request) (any, error) {
+	switch req.Method {
+	case "initialize":
+		var p struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		if err := unmarshalParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		version := protocolVersions[0]
+		for _, v := range protocolVersions {
+			if v == p.ProtocolVersion {
+				version = v
+			}
+		}
+		return map[string]any{
+			"protocolVersion": version,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "paim", "version": s.cfg.Version},
+		}, nil
+	case "notifications/initialized", "notifications/cancelled":
+		return nil, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		return map[string]any{"tools": s.tools()}, nil
+	case "tools/call":
+		var p struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := unmarshalParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		return s.callTool(ctx, p.Name, p.Arguments)
+	default:
+		return nil, &rpcError{Code: codeMethodNotFound, Message: "method not found: " + req.Method}
+	}
+}
+
+func unmarshalParams(raw json.RawMessage, dst any) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, dst); err != nil {
+		return &rpcError{Code: codeInvalidParams, Message: "invalid params: " + err.Error()}
+	}
+	return nil
+}
+
+// tool describes one tool in tools/list.
+type tool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+func (s *Server) tools() []tool {
+	return []tool{
+		{
+			Name:        "remember",
+			Description: "Store a memory: a piece of text worth recalling later, such as a fact the user stated or a decision that was made.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"content":    map[string]any{"type": "string", "description": "The text to remember."},
+					"source":     map[string]any{"type": "string", "description": `Where the memory came from (default "chat").`},
+					"metadata":   map[string]any{"type": "object", "description": "Optional key/value metadata, e.g. subject, predicate and object to record a fact directly."},
+					"session_id": map[string]any{"type": "string", "description": "Optional id of the conversation the memory belongs to."},
+				},
+				"required":             []string{"content"},
+				"additionalProperties": false,
+			},
+		},
+		{
+			Name:        "recall",
+			Description: "Recall stored memories and facts related to a query. An empty query returns the most recent ones.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"query": map[string]any{"type": "string", "description": "What to look for."},
+					"top_k": map[string]any{"type": "integer", "minimum": 1, "maximum": s.cfg.MaxTopK, "description": "Maximum number of results (default 5)."},
+				},
+				"additionalProperties": false,
+			},
+		},
+		{
+			Name:        "consolidate",
+			Description: "Distill recently stored memories into facts now instead of waiting for the next scheduled consolidation.",
+			InputSchema: map[string]any{"type": "object", "properties": map[string]any{}, "additionalProperties": false},
+		},
+	}
+}
+
+// toolResult is the result of tools/call. Failures of the tool itself are
+// reported with IsError so the model can see them, not as JSON-RPC errors.
+type toolResult struct {
+	Content []textContent `json:"content"`
+	IsError bool          `json:"isError,omitempty"`
+}
+
+type textContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+func textResult(text string) *toolResult {
+	return &toolResult{Content: []textContent{{Type: "text", Text: text}}}
+}
+
+func toolError(text string) *toolResult {
+	r := textResult(text)
+	r.IsError = true
+	return r
+}
+
+func (s *Server) callTool(ctx context.Context, name string, args json.RawMessage) (any, error) {
+	decode := func(dst any) error {
+		if len(args) == 0 || string(args) == "null" {
+			return nil
+		}
+		dec := json.NewDecoder(bytes.NewReader(args))
+		dec.DisallowUnknownFields()
+		return dec.Decode(dst)
+	}
+	switch name {
+	case "remember":
+		var in model.SensoryInput
+		if err := decode(&in); err != nil {
+			return toolError("invalid arguments: " + err.Error()), nil
+		}
+		if in.Source == "" {
+			in.Source = "chat"
+		}
+		if in.Namespace != "" && in.Namespace != s.cfg.Namespace {
+			return toolError("this server only stores memories in namespace " + strconv.Quote(s.cfg.Namespace)), nil
+		}
+		in.Namespace = s.cfg.Namespace
+		ids, err := s.engine.ObserveBatch(ctx, []model.SensoryInput{in})
+		if err != nil {
+			return s.engineError(name, err), nil
+		}
+		return textResult("Remembered (log " + ids[0] + ")."), nil
+	case "recall":
+		var in struct {
+			Query string `json:"query"`
+			TopK  int    `json:"top_k"`
+		}
+		if err := decode(&in); err != nil {
+			return toolError("invalid arguments: " + err.Error()), nil
+		}
+		switch {
+		case in.TopK < 0:
+			return toolError("top_k must be a positive integer"), nil
+		case in.TopK == 0:
+			in.TopK = 5
+		case in.TopK > s.cfg.MaxTopK:
+			in.TopK = s.cfg.MaxTopK
+		}
+		res, err := s.engine.RecallWithOptions(ctx, in.Query, model.RecallOptions{TopK: in.TopK, Namespace: s.cfg.Namespace})
+		if err != nil {
+			return s.engineError(name, err), nil
+		}
+		return textResult(formatRecall(res)), nil
+	case "consolidate":
+		if err := s.engine.Consolidate(ctx); err != nil {
+			return s.engineError(name, err), nil
+		}
+		return textResult("Consolidated buffered memories into facts."), nil
+	default:
+		return nil, &rpcError{Code: codeInvalidParams, Message: "unknown tool: " + name}
+	}
+}
+
+// engineError reports an engine failure as a tool error, passing on input
+// errors and hiding database internals like the HTTP API does.
+func (s *Server) engineError(tool string, err error) *toolResult {
+	switch {
+	case errors.Is(err, store.ErrInvalidInput), errors.Is(err, store.ErrNotFound):
+		return toolError(err.Error())
+	case errors.Is(err, store.ErrReadOnly):
+		return toolError("the memory store is read-only")
+	case store.IsUnavailable(err):
+		s.logger.Warn("mcp tool failed", "tool", tool, "err", err)
+		return toolError("memory store is temporarily unavailable, retry later")
+	default:
+		s.logger.Error("mcp tool failed", "tool", tool, "err", err)
+		return toolError("internal error")
+	}
+}
+
+// formatRecall renders recalled context as plain text, best match first.
+func formatRecall(res *model.RecalledContext) string {
+	if len(res.Ranked) == 0 {
+		return "No related memories."
+	}
+	var b strings.Builder
+	if res.Recent {
+		b.WriteString("Most recent memories:\n")
+	} else {
+		b.WriteString("Related memories, best match first:\n")
+	}
+	for _, it := range res.Ranked {
+		switch {
+		case it.Fact != nil:
+			f := it.Fact
+			subject, object := f.Subject, f.Object
+			if f.SubjectLabel != "" {
+				subject = f.SubjectLabel
+			}
+			if f.ObjectLabel != "" {
+				object = f.ObjectLabel
+			}
+			fmt.Fprintf(&b, "- fact: %s %s %s (confidence %.2f)\n", subject, f.Predicate, object, f.Confidence)
+		case it.Log != nil:
+			l := it.Log
+			fmt.Fprintf(&b, "- memory [%s, %s]: %s\n", l.Timestamp.Format("2006-01-02 15:04"), l.SourceType, l.Content)
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
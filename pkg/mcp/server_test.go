@@ -0,0 +1,271 @@
+package mcp_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/mcp"
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result"`
+	Error   *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type toolResult struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	IsError bool `json:"isError"`
+}
+
+// serve feeds the canned messages to a server on a fresh engine and returns
+// its responses in order.
+func serve(t *testing.T, cfg mcp.Config, messages ...string) []rpcResponse {
+	t.Helper()
+	cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := mcp.NewServer(storetest.NewTestEngine(t), cfg)
+	var out bytes.Buffer
+	if err := srv.Serve(context.Background(), strings.NewReader(strings.Join(messages, "\n")+"\n"), &out); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	var resps []rpcResponse
+	sc := bufio.NewScanner(&out)
+	for sc.Scan() {
+		var r rpcResponse
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			t.Fatalf("response %q: %v", sc.Text(), err)
+		}
+		if r.JSONRPC != "2.0" {
+			t.Errorf("response %q is not JSON-RPC 2.0", sc.Text())
+		}
+		resps = append(resps, r)
+	}
+	return resps
+}
+
+func call(id int, tool, args string) string {
+	b, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0", "id": id, "method": "tools/call",
+		"params": map[string]any{"name": tool, "arguments": json.RawMessage(args)},
+	})
+	return string(b)
+}
+
+func toolText(t *testing.T, r rpcResponse) (string, bool) {
+	t.Helper()
+	if r.Error != nil {
+		t.Fatalf("tool call %s failed: %+v", r.ID, r.Error)
+	}
+	var res toolResult
+	if err := json.Unmarshal(r.Result, &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Content) != 1 || res.Content[0].Type != "text" {
+		t.Fatalf("tool result %s = %s, want one text item", r.ID, r.Result)
+	}
+	return res.Content[0].Text, res.IsError
+}
+
+func TestSession(t *testing.T) {
+	resps := serve(t, mcp.Config{Version: "1.2.3"},
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"test","version":"0"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		call(3, "remember", `{"content":"Alice works at Acme.","source":"note","metadata":{"room":"A"}}`),
+		call(4, "consolidate", `{}`),
+		call(5, "recall", `{"query":"Alice","top_k":3}`),
+		`{"jsonrpc":"2.0","id":"six","method":"ping"}`,
+		call(7, "recall", `{}`),
+	)
+	if len(resps) != 7 {
+		t.Fatalf("%d responses, want 7 (none for the notification)", len(resps))
+	}
+
+	var init struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		ServerInfo      struct{ Name, Version string }
+		Capabilities    map[string]any
+	}
+	if err := json.Unmarshal(resps[0].Result, &init); err != nil {
+		t.Fatal(err)
+	}
+	if init.ProtocolVersion != "2024-11-05" || init.ServerInfo.Version != "1.2.3" || init.Capabilities["tools"] == nil {
+		t.Errorf("initialize = %s", resps[0].Result)
+	}
+
+	var list struct {
+		Tools []struct {
+			Name        string
+			InputSchema struct {
+				Type       string
+				Properties map[string]any
+				Required   []string
+			}
+		}
+	}
+	if err := json.Unmarshal(resps[1].Result, &list); err != nil {
+		t.Fatal(err)
+	}
+	schemas := make(map[string][]string)
+	for _, tl := range list.Tools {
+		if tl.InputSchema.Type != "object" {
+			t.Errorf("tool %s schema type %q, want object", tl.Name, tl.InputSchema.Type)
+		}
+		schemas[tl.Name] = tl.InputSchema.Required
+	}
+	if len(schemas) != 3 || len(schemas["remember"]) != 1 || schemas["remember"][0] != "content" {
+		t.Errorf("tools = %s", resps[1].Result)
+	}
+
+	if text, isErr := toolText(t, resps[2]); isErr || !strings.HasPrefix(text, "Remembered") {
+		t.Errorf("remember = %q (error %v)", text, isErr)
+	}
+	if _, isErr := toolText(t, resps[3]); isErr {
+		t.Error("consolidate failed")
+	}
+	text, isErr := toolText(t, resps[4])
+	if isErr || !strings.Contains(text, "- fact: Alice works_at Acme") {
+		t.Errorf("recall = %q, want the fact with its labels", text)
+	}
+	if string(resps[5].ID) != `"six"` || resps[5].Error != nil {
+		t.Errorf("ping = %+v", resps[5])
+	}
+	text, isErr = toolText(t, resps[6])
+	if isErr || !strings.HasPrefix(text, "Most recent memories:") || !strings.Contains(text, ", note]: Alice works at Acme.") {
+		t.Errorf("recall without a query = %q, want the recent memory", text)
+	}
+}
+
+func TestToolErrorsKeepTheLoopRunning(t *testing.T) {
+	resps := serve(t, mcp.Config{Namespace: "work"},
+		call(1, "remember", `{"content":""}`),
+		call(2, "remember", `{"content":"x","colour":"red"}`),
+		call(3, "remember", `{"content":"x","namespace":"home"}`),
+		call(4, "recall", `{"top_k":-1}`),
+		call(5, "recall", `{"query":"nothing here"}`),
+	)
+	if len(resps) != 5 {
+		t.Fatalf("%d responses, want 5", len(resps))
+	}
+	for i, want := range []string{"content", "unknown field", `namespace "work"`, "top_k"} {
+		text, isErr := toolText(t, resps[i])
+		if !isErr || !strings.Contains(text, want) {
+			t.Errorf("call %d = %q (error %v), want a tool error mentioning %s", i+1, text, isErr, want)
+		}
+	}
+	if text, isErr := toolText(t, resps[4]); isErr || text != "No related memories." {
+		t.Errorf("recall with no results = %q (error %v)", text, isErr)
+	}
+}
+
+func TestProtocolErrors(t *testing.T) {
+	resps := serve(t, mcp.Config{},
+		`not json`,
+		`[{"jsonrpc":"2.0","id":1,"method":"ping"}]`,
+		`{"jsonrpc":"1.0","id":2,"method":"ping"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"resources/list"}`,
+		call(4, "forget", `{}`),
+		`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":"oops"}`,
+		`{"jsonrpc":"2.0","method":"no/such/notification"}`,
+		`{"jsonrpc":"2.0","id":6,"method":"ping"}`,
+	)
+	want := []struct {
+		id   string
+		code int
+	}{
+		{"null", -32700},
+		{"null", -32600},
+		{"2", -32600},
+		{"3", -32601},
+		{"4", -32602},
+		{"5", -32602},
+		{"6", 0},
+	}
+	if len(resps) != len(want) {
+		t.Fatalf("%d responses, want %d", len(resps), len(want))
+	}
+	for i, w := range want {
+		r := resps[i]
+		code := 0
+		if r.Error != nil {
+			code = r.Error.Code
+		}
+		if string(r.ID) != w.id || code != w.code {
+			t.Errorf("response %d: id %s code %d, want id %s code %d", i, r.ID, code, w.id, w.code)
+		}
+	}
+}
+
+func TestRememberUsesTheServerNamespace(t *testing.T) {
+	engine := storetest.NewTestEngine(t)
+	srv := mcp.NewServer(engine, mcp.Config{Namespace: "work", Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err := srv.Serve(context.Background(), strings.NewReader(call(1, "remember", `{"content":"Alice works at Acme."}`)+"\n"), io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	res, err := engine.RecallWithOptions(context.Background(), "", model.RecallOptions{TopK: 5, Namespace: "work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.RelatedLogs) != 1 || res.RelatedLogs[0].Namespace != "work" {
+		t.Errorf("work logs = %+v, want the remembered one", res.RelatedLogs)
+	}
+}
+
+func TestReadOnlyToolErrors(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	path := filepath.Join(t.TempDir(), "paim.db")
+	rw, err := store.NewMemoryEngine(ctx, store.Options{DBPath: path, Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	srv := mcp.NewServer(storetest.NewTestEngineWithOptions(t, store.Options{DBPath: path, ReadOnly: true}), mcp.Config{Logger: logger})
+	var out bytes.Buffer
+	in := strings.Join([]string{
+		call(1, "remember", `{"content":"Alice works at Acme."}`),
+		call(2, "consolidate", `{}`),
+		call(3, "recall", `{"query":"Alice"}`),
+	}, "\n") + "\n"
+	if err := srv.Serve(ctx, strings.NewReader(in), &out); err != nil {
+		t.Fatal(err)
+	}
+	var resps []rpcResponse
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var r rpcResponse
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatal(err)
+		}
+		resps = append(resps, r)
+	}
+	if len(resps) != 3 {
+		t.Fatalf("%d responses, want 3", len(resps))
+	}
+	for _, r := range resps[:2] {
+		if text, isErr := toolText(t, r); !isErr || text != "the memory store is read-only" {
+			t.Errorf("write %s = %q (error %v), want the read-only tool error", r.ID, text, isErr)
+		}
+	}
+	if _, isErr := toolText(t, resps[2]); isErr {
+		t.Error("recall failed on a read-only store")
+	}
+}
@@ -1,42 +1,236 @@
 package memory
 
 import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/johncui/PAIM/pkg/model"
 )
 
+// DedupMode controls how SensoryBuffer treats an input whose content and
+// source match an item already buffered.
+type DedupMode int
+
+const (
+	// DedupOff buffers every input, duplicates included.
+	DedupOff DedupMode = iota
+	// DedupSkip drops the duplicate and leaves the buffered item as is.
+	DedupSkip
+	// DedupRefresh drops the duplicate but renews the buffered item's
+	// timestamp, moving it to the newest position.
+	DedupRefresh
+)
+
+// ParseDedupMode maps "off", "skip" or "refresh" to a DedupMode.
+func ParseDedupMode(s string) (DedupMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "off":
+		return DedupOff, nil
+	case "skip":
+		return DedupSkip, nil
+	case "refresh":
+		return DedupRefresh, nil
+	default:
+		return DedupOff, fmt.Errorf("unknown buffer dedup mode %q (want off, skip or refresh)", s)
+	}
+}
+
+// BufferConfig configures a SensoryBuffer.
+type BufferConfig struct {
+	Capacity int
+	TTL      time.Duration
+	Dedup    DedupMode
+	// OnEvict, when set, receives the items Add pushes out at capacity,
+	// oldest first, so they can still be consolidated. It is called after
+	// the buffer is unlocked.
+	OnEvict func([]Item)
+}
+
 // SensoryBuffer is an in-memory TTL buffer for short-lived sensory memories.
 type SensoryBuffer struct {
 	mu       sync.Mutex
 	items    []bufferItem
 	capacity int
 	ttl      time.Duration
+	dedup    DedupMode
+	onEvict  func([]Item)
+	nextSeq  uint64
+	// evicted and expired count items dropped for capacity and for age.
+	evicted uint64
+	expired uint64
+}
+
+// BufferStats describes a SensoryBuffer at one point in time.
+type BufferStats struct {
+	// Len counts the non-expired items.
+	Len      int
+	Capacity int
+	// OldestAge is how long the oldest non-expired item has waited.
+	OldestAge time.Duration
+	// Evicted counts items pushed out by newer ones at capacity and Expired
+	// items that outlived the TTL before being snapshotted, both since the
+	// buffer was created.
+	Evicted uint64
+	Expired uint64
 }
 
 type bufferItem struct {
+	seq   uint64
 	at    time.Time
+	key   [sha256.Size]byte
 	input model.SensoryInput
 }
 
+// Item is a buffered input tagged with its insertion sequence number.
+type Item struct {
+	Seq   uint64
+	At    time.Time
+	Input model.SensoryInput
+}
+
 func NewSensoryBuffer(capacity int, ttl time.Duration) *SensoryBuffer {
-	return &SensoryBuffer{capacity: capacity, ttl: ttl}
+	return NewSensoryBufferWithConfig(BufferConfig{Capacity: capacity, TTL: ttl})
 }
 
-// Add pushes a new item, evicting the oldest if capacity exceeded.
-func (b *SensoryBuffer) Add(input model.SensoryInput) {
+// NewSensoryBufferWithConfig creates a buffer with optional deduplication.
+func NewSensoryBufferWithConfig(cfg BufferConfig) *SensoryBuffer {
+	return &SensoryBuffer{capacity: cfg.Capacity, ttl: cfg.TTL, dedup: cfg.Dedup, onEvict: cfg.OnEvict}
+}
+
+func dedupKey(input model.SensoryInput) [sha256.Size]byte {
+	return sha256.Sum256([]byte(input.Namespace + "\x00" + input.Source + "\x00" + input.Content))
+}
+
+// Add pushes a new item, evicting the oldest if capacity exceeded; evicted
+// items are handed to BufferConfig.OnEvict. It reports whether the input was
+// buffered as a new item; with deduplication enabled a live duplicate is
+// not, and under DedupRefresh the existing item is renewed instead.
+func (b *SensoryBuffer) Add(input model.SensoryInput) bool {
+	added, evicted := b.add(input)
+	if len(evicted) > 0 && b.onEvict != nil {
+		b.onEvict(evicted)
+	}
+	return added
+}
+
+func (b *SensoryBuffer) add(input model.SensoryInput) (bool, []Item) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	b.items = append(b.items, bufferItem{at: time.Now(), input: input})
+	now := time.Now()
+	key := dedupKey(input)
+	if b.dedup != DedupOff {
+		cutoff := now.Add(-b.ttl)
+		for i, item := range b.items {
+			if item.key != key || !item.at.After(cutoff) {
+				continue
+			}
+			if b.dedup == DedupRefresh {
+				item.at = now
+				b.items = append(append(b.items[:i:i], b.items[i+1:]...), item)
+			}
+			return false, nil
+		}
+	}
+
+	b.nextSeq++
+	b.items = append(b.items, bufferItem{seq: b.nextSeq, at: now, key: key, input: input})
+	var evicted []Item
 	if len(b.items) > b.capacity {
-		b.items = b.items[len(b.items)-b.capacity:]
+		n := len(b.items) - b.capacity
+		cutoff := now.Add(-b.ttl)
+		for _, item := range b.items[:n] {
+			// expired items would not have been consolidated either
+			if item.at.After(cutoff) {
+				evicted = append(evicted, Item{Seq: item.seq, At: item.at, Input: item.input})
+			} else {
+				b.expired++
+			}
+		}
+		b.evicted += uint64(len(evicted))
+		b.items = b.items[n:]
+	}
+	return true, evicted
+}
+
+// Stats returns the buffer's size, age and drop counters. Expired items not
+// yet purged by a snapshot are already counted as expired.
+func (b *SensoryBuffer) Stats() BufferStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-b.ttl)
+	st := BufferStats{Capacity: b.capacity, Evicted: b.evicted, Expired: b.expired}
+	var oldest time.Time
+	for _, item := range b.items {
+		if !item.at.After(cutoff) {
+			st.Expired++
+			continue
+		}
+		st.Len++
+		if oldest.IsZero() || item.at.Before(oldest) {
+			oldest = item.at
+		}
+	}
+	if !oldest.IsZero() {
+		st.OldestAge = now.Sub(oldest)
+	}
+	return st
+}
+
+// Len returns the number of non-expired items.
+func (b *SensoryBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	cutoff := time.Now().Add(-b.ttl)
+	n := 0
+	for _, item := range b.items {
+		if item.at.After(cutoff) {
+			n++
+		}
+	}
+	return n
+}
+
+// OldestAge returns how long the oldest non-expired item has been buffered,
+// or zero when the buffer is empty.
+func (b *SensoryBuffer) OldestAge() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-b.ttl)
+	var oldest time.Time
+	for _, item := range b.items {
+		if item.at.After(cutoff) && (oldest.IsZero() || item.at.Before(oldest)) {
+			oldest = item.at
+		}
+	}
+	if oldest.IsZero() {
+		return 0
 	}
+	return now.Sub(oldest)
 }
 
 // Snapshot returns non-expired items.
 func (b *SensoryBuffer) Snapshot() []model.SensoryInput {
+	items := b.SnapshotItems()
+	outputs := make([]model.SensoryInput, len(items))
+	for i, item := range items {
+		outputs[i] = item.Input
+	}
+	return outputs
+}
+
+// SnapshotItems returns non-expired items along with their sequence numbers,
+// so callers can later Remove exactly what they processed, or TrimThrough the
+// highest sequence number in the snapshot.
+func (b *SensoryBuffer) SnapshotItems() []Item {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
@@ -47,15 +241,95 @@ func (b *SensoryBuffer) Snapshot() []model.SensoryInput {
 			filtered = append(filtered, item)
 		}
 	}
+	b.expired += uint64(len(b.items) - len(filtered))
 	b.items = filtered
 
-	outputs := make([]model.SensoryInput, len(filtered))
+	outputs := make([]Item, len(filtered))
 	for i, item := range filtered {
-		outputs[i] = item.input
+		outputs[i] = Item{Seq: item.seq, At: item.at, Input: item.input}
 	}
 	return outputs
 }
 
+// Remove drops the given items (matched by sequence number), leaving anything
+// added after the snapshot untouched.
+func (b *SensoryBuffer) Remove(items []Item) {
+	if len(items) == 0 {
+		return
+	}
+	drop := make(map[uint64]struct{}, len(items))
+	for _, item := range items {
+		drop[item.Seq] = struct{}{}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	kept := b.items[:0]
+	for _, item := range b.items {
+		if _, ok := drop[item.seq]; !ok {
+			kept = append(kept, item)
+		}
+	}
+	b.items = kept
+}
+
+// TrimThrough drops every item with a sequence number up to and including
+// seq, the highest one a caller has processed. Items added later, which get
+// larger sequence numbers, are kept.
+func (b *SensoryBuffer) TrimThrough(seq uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	kept := b.items[:0]
+	for _, item := range b.items {
+		if item.seq > seq {
+			kept = append(kept, item)
+		}
+	}
+	b.items = kept
+}
+
+// Update applies fn to the buffered input of a stored log, so distillation
+// sees later edits of the log. It reports whether the log was buffered.
+func (b *SensoryBuffer) Update(logID string, fn func(*model.SensoryInput)) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	found := false
+	for i := range b.items {
+		if b.items[i].input.LogID != logID {
+			continue
+		}
+		fn(&b.items[i].input)
+		b.items[i].key = dedupKey(b.items[i].input)
+		found = true
+	}
+	return found
+}
+
+// RemoveLogs drops the buffered inputs of the given stored logs, so deleted
+// logs are not distilled, and returns how many were dropped.
+func (b *SensoryBuffer) RemoveLogs(logIDs []string) int {
+	drop := make(map[string]struct{}, len(logIDs))
+	for _, id := range logIDs {
+		drop[id] = struct{}{}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	kept := b.items[:0]
+	for _, item := range b.items {
+		if _, ok := drop[item.input.LogID]; !ok || item.input.LogID == "" {
+			kept = append(kept, item)
+		}
+	}
+	removed := len(b.items) - len(kept)
+	b.items = kept
+	return removed
+}
+
 // Clear removes all items.
 func (b *SensoryBuffer) Clear() {
 	b.mu.Lock()
@@ -0,0 +1,226 @@
+package memory
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+func contents(inputs []model.SensoryInput) []string {
+	var out []string
+	for _, in := range inputs {
+		out = append(out, in.Content)
+	}
+	return out
+}
+
+func addAll(b *SensoryBuffer, inputs ...string) {
+	for _, c := range inputs {
+		b.Add(model.SensoryInput{Content: c, Source: "chat"})
+	}
+}
+
+func TestBufferDedupModes(t *testing.T) {
+	tests := []struct {
+		mode DedupMode
+		want []string
+	}{
+		{DedupOff, []string{"a", "b", "a"}},
+		{DedupSkip, []string{"a", "b"}},
+		{DedupRefresh, []string{"b", "a"}},
+	}
+	for _, tt := range tests {
+		b := NewSensoryBufferWithConfig(BufferConfig{Capacity: 10, TTL: time.Hour, Dedup: tt.mode})
+		addAll(b, "a", "b", "a")
+		if got := contents(b.Snapshot()); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("mode %d: Snapshot = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestBufferDedupKeysOnSourceAndNamespace(t *testing.T) {
+	b := NewSensoryBufferWithConfig(BufferConfig{Capacity: 10, TTL: time.Hour, Dedup: DedupSkip})
+	for _, in := range []model.SensoryInput{
+		{Content: "a", Source: "chat"},
+		{Content: "a", Source: "email"},
+		{Content: "a", Source: "chat", Namespace: "work"},
+		{Content: "a", Source: "chat"},
+	} {
+		b.Add(in)
+	}
+	if n := b.Len(); n != 3 {
+		t.Fatalf("Len = %d, want 3 distinct inputs", n)
+	}
+}
+
+func TestBufferEvictionWithDedup(t *testing.T) {
+	var evicted []string
+	b := NewSensoryBufferWithConfig(BufferConfig{
+		Capacity: 2, TTL: time.Hour, Dedup: DedupRefresh,
+		OnEvict: func(items []Item) {
+			for _, it := range items {
+				evicted = append(evicted, it.Input.Content)
+			}
+		},
+	})
+	// the refreshed a survives the eviction c causes; b does not
+	addAll(b, "a", "b", "a", "c")
+	if got := contents(b.Snapshot()); !reflect.DeepEqual(got, []string{"a", "c"}) {
+		t.Fatalf("Snapshot = %q, want a and c", got)
+	}
+	if !reflect.DeepEqual(evicted, []string{"b"}) {
+		t.Fatalf("evicted %q, want b", evicted)
+	}
+	// a duplicate does not take a slot, so nothing is evicted
+	addAll(b, "c")
+	if len(evicted) != 1 {
+		t.Fatalf("a duplicate evicted %q", evicted[1:])
+	}
+	if st := b.Stats(); st.Evicted != 1 || st.Len != 2 || st.Capacity != 2 {
+		t.Fatalf("Stats = %+v, want 2 of 2 items and one eviction", st)
+	}
+}
+
+func TestBufferExpiredDuplicateIsAddedAgain(t *testing.T) {
+	b := NewSensoryBufferWithConfig(BufferConfig{Capacity: 10, TTL: 20 * time.Millisecond, Dedup: DedupSkip})
+	addAll(b, "a")
+	time.Sleep(30 * time.Millisecond)
+	if !b.Add(model.SensoryInput{Content: "a", Source: "chat"}) {
+		t.Fatal("Add dropped a duplicate of an expired item")
+	}
+	if n := b.Len(); n != 1 {
+		t.Fatalf("Len = %d, want only the new item", n)
+	}
+}
+
+func TestBufferOldestAge(t *testing.T) {
+	b := NewSensoryBuffer(10, time.Hour)
+	if age := b.OldestAge(); age != 0 {
+		t.Fatalf("OldestAge of an empty buffer = %v", age)
+	}
+	addAll(b, "a")
+	time.Sleep(10 * time.Millisecond)
+	addAll(b, "b")
+	if age := b.OldestAge(); age < 10*time.Millisecond {
+		t.Fatalf("OldestAge = %v, want the age of a", age)
+	}
+}
+
+func TestParseDedupMode(t *testing.T) {
+	for s, want := range map[string]DedupMode{"": DedupOff, "off": DedupOff, "Skip": DedupSkip, " refresh ": DedupRefresh} {
+		got, err := ParseDedupMode(s)
+		if err != nil || got != want {
+			t.Errorf("ParseDedupMode(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	if _, err := ParseDedupMode("always"); err == nil {
+		t.Error("ParseDedupMode accepted an unknown mode")
+	}
+}
+
+func TestBufferRemoveAndTrimKeepLaterItems(t *testing.T) {
+	b := NewSensoryBuffer(10, time.Hour)
+	addAll(b, "a", "b")
+	snap := b.SnapshotItems()
+	if len(snap) != 2 || snap[0].Seq >= snap[1].Seq {
+		t.Fatalf("snapshot = %+v, want increasing sequence numbers", snap)
+	}
+	addAll(b, "c")
+	b.Remove(snap)
+	if got := contents(b.Snapshot()); !reflect.DeepEqual(got, []string{"c"}) {
+		t.Fatalf("after Remove = %q, want the later item", got)
+	}
+
+	addAll(b, "d")
+	snap = b.SnapshotItems()
+	addAll(b, "e")
+	b.TrimThrough(snap[len(snap)-1].Seq)
+	if got := contents(b.Snapshot()); !reflect.DeepEqual(got, []string{"e"}) {
+		t.Fatalf("after TrimThrough = %q, want the later item", got)
+	}
+	if next := b.SnapshotItems(); next[0].Seq <= snap[len(snap)-1].Seq {
+		t.Errorf("sequence numbers went backwards: %d after %d", next[0].Seq, snap[len(snap)-1].Seq)
+	}
+}
+
+func TestBufferUpdate(t *testing.T) {
+	b := NewSensoryBufferWithConfig(BufferConfig{Capacity: 10, TTL: time.Hour, Dedup: DedupSkip})
+	b.Add(model.SensoryInput{Content: "draft", LogID: "log-1"})
+	b.Add(model.SensoryInput{Content: "other", LogID: "log-2"})
+	if !b.Update("log-1", func(in *model.SensoryInput) { in.Content = "final" }) {
+		t.Fatal("Update did not find a buffered log")
+	}
+	if b.Update("missing", func(*model.SensoryInput) { t.Error("fn called for a log not buffered") }) {
+		t.Error("Update reported a log that is not buffered")
+	}
+	if got := contents(b.Snapshot()); !reflect.DeepEqual(got, []string{"final", "other"}) {
+		t.Errorf("after Update = %q, want the edited content in place", got)
+	}
+	// the dedup key follows the edit
+	if b.Add(model.SensoryInput{Content: "final"}) {
+		t.Error("added a duplicate of the edited content")
+	}
+	if !b.Add(model.SensoryInput{Content: "draft"}) {
+		t.Error("the old content still counts as buffered")
+	}
+}
+
+func TestBufferRemoveLogs(t *testing.T) {
+	b := NewSensoryBufferWithConfig(BufferConfig{Capacity: 10, TTL: time.Hour})
+	b.Add(model.SensoryInput{Content: "a", LogID: "log-1"})
+	b.Add(model.SensoryInput{Content: "unstored"})
+	b.Add(model.SensoryInput{Content: "b", LogID: "log-2"})
+	b.Add(model.SensoryInput{Content: "c", LogID: "log-3"})
+	// an empty id must not match inputs that were never stored
+	if n := b.RemoveLogs([]string{"log-1", "log-3", "", "missing"}); n != 2 {
+		t.Errorf("RemoveLogs = %d, want 2", n)
+	}
+	if got := contents(b.Snapshot()); !reflect.DeepEqual(got, []string{"unstored", "b"}) {
+		t.Errorf("after RemoveLogs = %q, want the other inputs in order", got)
+	}
+}
+
+func TestBufferStatsCountsDrops(t *testing.T) {
+	b := NewSensoryBufferWithConfig(BufferConfig{Capacity: 2, TTL: 20 * time.Millisecond})
+	addAll(b, "a", "b", "c")
+	st := b.Stats()
+	if st.Len != 2 || st.Capacity != 2 || st.Evicted != 1 || st.Expired != 0 {
+		t.Fatalf("Stats after overflowing = %+v, want 2/2 buffered and 1 evicted", st)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if st := b.Stats(); st.Len != 0 || st.Expired != 2 || st.OldestAge != 0 {
+		t.Fatalf("Stats after the TTL = %+v, want both items counted as expired", st)
+	}
+	// purging them in a snapshot must not count them again
+	if snap := b.Snapshot(); len(snap) != 0 {
+		t.Fatalf("snapshot returned expired items %q", contents(snap))
+	}
+	addAll(b, "d")
+	if st := b.Stats(); st.Len != 1 || st.Evicted != 1 || st.Expired != 2 || st.OldestAge <= 0 {
+		t.Errorf("Stats after a purge = %+v, want 1 buffered, 1 evicted and 2 expired", st)
+	}
+}
+
+func TestBufferEvictionSkipsExpiredItems(t *testing.T) {
+	var evicted []string
+	b := NewSensoryBufferWithConfig(BufferConfig{
+		Capacity: 1, TTL: 20 * time.Millisecond,
+		OnEvict: func(items []Item) {
+			for _, it := range items {
+				evicted = append(evicted, it.Input.Content)
+			}
+		},
+	})
+	addAll(b, "a")
+	time.Sleep(30 * time.Millisecond)
+	addAll(b, "b", "c")
+	if !reflect.DeepEqual(evicted, []string{"b"}) {
+		t.Errorf("evicted %q, want only the live b", evicted)
+	}
+	if st := b.Stats(); st.Evicted != 1 || st.Expired != 1 {
+		t.Errorf("Stats = %+v, want a counted as expired and b as evicted", st)
+	}
+}
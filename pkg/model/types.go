@@ -5,11 +5,28 @@ import (
 	"time"
 )
 
+// DefaultNamespace holds memories stored without an explicit namespace.
+const DefaultNamespace = "default"
+
+// SummarySource is the source type of logs that summarize older logs.
+const SummarySource = "summary"
+
 // SensoryInput represents raw input captured by the assistant.
 type SensoryInput struct {
 	Content  string                 `json:"content"`
 	Source   string                 `json:"source"`
 	Metadata map[string]interface{} `json:"metadata"`
+	// Namespace isolates the input, its log and the facts distilled from it
+	// from other namespaces; empty means DefaultNamespace.
+	Namespace string `json:"namespace,omitempty"`
+	// SessionID groups inputs of one conversation so recall can return the
+	// surrounding exchange; empty leaves the input outside any session.
+	SessionID string `json:"session_id,omitempty"`
+	// Timestamp is when the input happened, for importing older material;
+	// zero means now. It is stored in UTC with second precision.
+	Timestamp time.Time `json:"timestamp,omitempty"`
+	// LogID is assigned by Observe once the input is durably logged.
+	LogID string `json:"-"`
 }
 
 // LogEntry mirrors memory_logs rows.
@@ -19,6 +36,16 @@ type LogEntry struct {
 	SourceType string                 `json:"source_type"`
 	Content    string                 `json:"content"`
 	Metadata   map[string]interface{} `json:"metadata"`
+	Namespace  string                 `json:"namespace,omitempty"`
+	SessionID  string                 `json:"session_id,omitempty"`
+	// LastAccessedAt and AccessCount record when and how often recall
+	// returned the log.
+	LastAccessedAt *time.Time `json:"last_accessed_at,omitempty"`
+	AccessCount    int        `json:"access_count"`
+	// SummarizedInto is the id of the summary log that covers this log.
+	SummarizedInto string `json:"summarized_into,omitempty"`
+	// UpdatedAt is when the log was last edited; nil if it never was.
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
 }
 
 // Triple represents a semantic fact.
@@ -29,22 +56,281 @@ type Triple struct {
 	Object     string    `json:"object"`
 	Confidence float64   `json:"confidence"`
 	CreatedAt  time.Time `json:"created_at"`
+	// SubjectLabel and ObjectLabel keep the most recent surface form of the
+	// (normalized) Subject and Object.
+	SubjectLabel string `json:"subject_label,omitempty"`
+	ObjectLabel  string `json:"object_label,omitempty"`
+	// ObservationCount is how many times the triple has been upserted.
+	ObservationCount int `json:"observation_count"`
+	// SupersededBy is the id of the triple that replaced this one as the
+	// value of a functional predicate; 0 for a current triple.
+	SupersededBy int64 `json:"superseded_by,omitempty"`
+	// ValidFrom and ValidTo bound when the fact holds, [ValidFrom,
+	// ValidTo); nil is an open end. They are kept at one-second precision.
+	ValidFrom *time.Time `json:"valid_from,omitempty"`
+	ValidTo   *time.Time `json:"valid_to,omitempty"`
+	// Hop is the graph distance from the queried entity for traversal
+	// results. In recall, facts added as neighbours of the matched facts'
+	// entities have Hop 1.
+	Hop int `json:"hop,omitempty"`
+	// Sources lists the memory_logs ids the triple was distilled from.
+	Sources []string `json:"sources,omitempty"`
+	// Namespace is the namespace the triple belongs to; empty means
+	// DefaultNamespace.
+	Namespace string `json:"namespace,omitempty"`
+	// LastAccessedAt and AccessCount record when and how often recall
+	// returned the triple.
+	LastAccessedAt *time.Time `json:"last_accessed_at,omitempty"`
+	AccessCount    int        `json:"access_count"`
+	// Distiller names the distiller that produced the triple; not persisted.
+	Distiller string `json:"-"`
 }
 
 // RecalledContext combines vector and graph results.
 type RecalledContext struct {
 	RelatedLogs  []LogEntry `json:"related_logs"`
 	RelatedFacts []Triple   `json:"related_facts"`
+	// Ranked merges logs and facts into one list, best first.
+	Ranked []RecalledItem `json:"ranked"`
+	// Recent is set when the query was empty and the results are simply the
+	// latest logs and the most confident recent facts.
+	Recent bool `json:"recent,omitempty"`
+	// Sessions holds, when RecallOptions.ExpandSessions is set, the
+	// conversation around each log hit that belongs to a session, one entry
+	// per session in the order of its best hit.
+	Sessions []SessionContext `json:"sessions,omitempty"`
+	// VectorSkipped is set when the query could not be embedded, the
+	// embedder failing or its circuit breaker being open, and the results
+	// come from the graph only.
+	VectorSkipped bool `json:"vector_skipped,omitempty"`
+	// Diagnostics describes how the recall ran, for tuning and debugging.
+	Diagnostics *RecallDiagnostics `json:"diagnostics,omitempty"`
+}
+
+// RecallDiagnostics reports what a recall did: the query and limits it
+// used, which retrieval steps ran, how many candidates each produced and
+// how long each took.
+type RecallDiagnostics struct {
+	// Query is the query with surrounding whitespace removed; Match is the
+	// mode facts were matched with.
+	Query     string `json:"query"`
+	Match     string `json:"match,omitempty"`
+	Namespace string `json:"namespace"`
+	// MaxFacts and MaxLogs are the effective limits after TopK and the
+	// configured maximum were applied.
+	MaxFacts int `json:"max_facts"`
+	MaxLogs  int `json:"max_logs"`
+
+	// VectorSearch is set when the vector index was searched, with the
+	// backend that answered; it is unset when vector search is disabled or
+	// the query could not be embedded (see RecalledContext.VectorSkipped).
+	VectorSearch  bool   `json:"vector_search"`
+	VectorBackend string `json:"vector_backend,omitempty"`
+	// GraphExpansion is set when the neighbours of the matched facts were
+	// added.
+	GraphExpansion bool `json:"graph_expansion"`
+
+	// FactsMatched facts matched the query; of the NeighborsFetched
+	// neighbours, those not already matched were added, NeighborsAdded.
+	FactsMatched     int `json:"facts_matched"`
+	NeighborsFetched int `json:"neighbors_fetched,omitempty"`
+	NeighborsAdded   int `json:"neighbors_added,omitempty"`
+	// VectorHits is the number of nearest neighbours the last index search
+	// returned, across namespaces; LogCandidates of them were in the
+	// namespace, and Logs logs were kept after the filters and the limit.
+	VectorHits    int `json:"vector_hits,omitempty"`
+	LogCandidates int `json:"log_candidates,omitempty"`
+	Logs          int `json:"logs"`
+
+	Timings RecallTimings `json:"timings_ms"`
+}
+
+// RecallTimings splits the duration of a recall, in milliseconds, per step.
+// Vector adds up every round of an over-fetching search, which reads the
+// logs in the same query; Fetch times the logs read without one.
+type RecallTimings struct {
+	Graph    float64 `json:"graph"`
+	Expand   float64 `json:"expand,omitempty"`
+	Embed    float64 `json:"embed,omitempty"`
+	Vector   float64 `json:"vector,omitempty"`
+	Fetch    float64 `json:"fetch,omitempty"`
+	Sessions float64 `json:"sessions,omitempty"`
+	Rank     float64 `json:"rank"`
+	Total    float64 `json:"total"`
+}
+
+// SessionContext is a chronological excerpt of one session.
+type SessionContext struct {
+	SessionID string     `json:"session_id"`
+	Logs      []LogEntry `json:"logs"`
+}
+
+// Kinds of RecalledItem.
+const (
+	RecalledLog  = "log"
+	RecalledFact = "fact"
+)
+
+// RecalledItem is one ranked recall result: either a log or a fact.
+type RecalledItem struct {
+	Kind  string    `json:"kind"`
+	Score float64   `json:"score"`
+	Log   *LogEntry `json:"log,omitempty"`
+	Fact  *Triple   `json:"fact,omitempty"`
+	// Distance is the raw vector distance of a log hit (smaller is nearer);
+	// it is unset for facts and for logs that did not come from vector search.
+	Distance *float64 `json:"distance,omitempty"`
 }
 
-// MemoryStore captures the core interface described in README.
+// RecallOptions narrows recall. Zero-valued fields do not filter.
+type RecallOptions struct {
+	TopK int
+	// MaxFacts and MaxLogs limit facts and logs separately; zero falls
+	// back to TopK, which is then required.
+	MaxFacts int
+	MaxLogs  int
+	// Namespace selects whose memories are searched; empty means
+	// DefaultNamespace. Unlike the other fields it always applies.
+	Namespace string
+	// Source restricts results to logs with this source_type, and facts to
+	// those distilled from such logs.
+	Source string
+	// Metadata requires each key to equal the given value in the log's
+	// metadata (for facts: in at least one source log's metadata).
+	Metadata map[string]string
+	// From and To bound log timestamps and fact creation times, inclusive,
+	// at one-second precision.
+	From time.Time
+	To   time.Time
+	// MinConfidence drops facts below this confidence; zero falls back to
+	// the engine's default threshold.
+	MinConfidence float64
+	// Predicate restricts facts to those with exactly this predicate.
+	Predicate string
+	// Match is how the query matches fact subjects and objects: "exact",
+	// "prefix", "contains" (the default) or its synonym "phrase", or per
+	// word: "any" (facts matching more words first) or "all".
+	Match string
+	// IncludeSuperseded also returns facts superseded by a newer value of a
+	// functional predicate.
+	IncludeSuperseded bool
+	// AsOf, when set, returns only facts valid at that instant (see
+	// Triple.ValidFrom), including superseded ones.
+	AsOf time.Time
+	// ExpandSessions adds, for every vector hit that belongs to a session,
+	// up to SessionWindow entries on either side of it to Sessions.
+	ExpandSessions bool
+	// SessionWindow is the number of neighbours per side; zero means
+	// DefaultSessionWindow.
+	SessionWindow int
+	// RecencyHalfLife scales ranked scores by a recency factor halving
+	// with each RecencyHalfLife of age; zero falls back to the engine's
+	// default and a negative value turns the scaling off.
+	RecencyHalfLife time.Duration
+}
+
+// DefaultSessionWindow is the RecallOptions.SessionWindow used when unset.
+const DefaultSessionWindow = 3
+
+// ObserveResult reports what a store did with one observed input.
+type ObserveResult struct {
+	// LogID is the id of the new log, or of the stored log a duplicate
+	// input matched.
+	LogID string `json:"id"`
+	// Duplicate is set when the input was not stored because LogID holds
+	// nearly the same content; Similarity is their cosine similarity.
+	Duplicate  bool    `json:"duplicate,omitempty"`
+	Similarity float64 `json:"similarity,omitempty"`
+}
+
+// MemoryStore captures the core interface described in README. Observe
+// keeps its signature for existing implementations and callers; stores
+// that can report the stored log implement IDObserver as well.
 type MemoryStore interface {
 	Observe(ctx context.Context, input SensoryInput) error
 	Recall(ctx context.Context, query string, topK int) (*RecalledContext, error)
+	RecallWithOptions(ctx context.Context, query string, opts RecallOptions) (*RecalledContext, error)
 	Consolidate(ctx context.Context) error
 }
 
+// IDObserver is Observe reporting the id of the stored log, so callers can
+// reference, link or delete the memory they just created.
+type IDObserver interface {
+	ObserveWithID(ctx context.Context, input SensoryInput) (ObserveResult, error)
+}
+
 // EmbeddingClient produces embeddings compatible with SQLite-VSS.
 type EmbeddingClient interface {
 	EmbedText(ctx context.Context, text string) ([]float64, error)
 }
+
+// ModelEmbedder is implemented by embedding clients that can name the model
+// behind each vector, such as a fallback chain; the name is stored with the
+// vector in place of the configured embedder model.
+type ModelEmbedder interface {
+	EmbedTextModel(ctx context.Context, text string) ([]float64, string, error)
+}
+
+// HealthChecker is implemented by embedding clients that can report whether
+// their backing service is reachable.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// ConsolidationRun records one consolidation in the history kept in the
+// database.
+type ConsolidationRun struct {
+	ID         int64     `json:"id"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Inputs counts the buffered and overflow inputs distilled, and
+	// TriplesWritten the triples stored, new or reinforced.
+	Inputs         int `json:"inputs"`
+	TriplesWritten int `json:"triples_written"`
+	// Error is why the run failed; empty for a successful run.
+	Error string `json:"error,omitempty"`
+}
+
+// EngineStats is a point-in-time summary of the engine's state.
+type EngineStats struct {
+	Logs              int64 `json:"logs"`
+	Triples           int64 `json:"triples"`
+	Embeddings        int64 `json:"embeddings"`
+	PendingEmbeddings int64 `json:"pending_embeddings"`
+	BufferLen         int   `json:"buffer_len"`
+	// BufferOldestAgeSeconds is how long the oldest buffered input has waited.
+	BufferOldestAgeSeconds float64 `json:"buffer_oldest_age_seconds"`
+	BufferCapacity         int     `json:"buffer_capacity"`
+	// BufferEvicted and BufferExpired count inputs the buffer dropped since
+	// start, for lack of room and for exceeding the TTL before consolidation.
+	BufferEvicted uint64 `json:"buffer_evicted"`
+	BufferExpired uint64 `json:"buffer_expired"`
+	// BufferOverflow counts logs of evicted inputs staged for the next
+	// consolidation.
+	BufferOverflow int64 `json:"buffer_overflow"`
+	// DBSizeBytes covers the database file; WALSizeBytes its write-ahead log.
+	DBSizeBytes  int64 `json:"db_size_bytes"`
+	WALSizeBytes int64 `json:"wal_size_bytes"`
+	// LastConsolidation is the time of the last successful Consolidate.
+	LastConsolidation *time.Time `json:"last_consolidation,omitempty"`
+	// LastConsolidationFailure and LastConsolidationError describe the most
+	// recent failed Consolidate, if any.
+	LastConsolidationFailure *time.Time `json:"last_consolidation_failure,omitempty"`
+	LastConsolidationError   string     `json:"last_consolidation_error,omitempty"`
+	// LastConsolidationRun is the latest run in the consolidation history,
+	// which outlives restarts.
+	LastConsolidationRun *ConsolidationRun `json:"last_consolidation_run,omitempty"`
+	SchemaVersion        int               `json:"schema_version"`
+	// EmbedderBreaker is the state of the embedder circuit breaker:
+	// "closed", "open", "half_open" or "disabled"; EmbedderFailures counts
+	// the consecutive failures that may open it.
+	EmbedderBreaker  string `json:"embedder_breaker"`
+	EmbedderFailures int    `json:"embedder_failures"`
+	// VectorSearch is "enabled", "disabled" or "degraded": enabled in the
+	// options but unavailable, with VectorError saying why. VectorBackend
+	// and VectorVersion name the extension in use.
+	VectorSearch  string `json:"vector_search"`
+	VectorBackend string `json:"vector_backend,omitempty"`
+	VectorVersion string `json:"vector_version,omitempty"`
+	VectorError   string `json:"vector_error,omitempty"`
+}
@@ -0,0 +1,152 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+)
+
+const (
+	// accessFlushInterval is how often accesses recorded by recall are
+	// written; accessFlushSize flushes earlier once that many distinct logs
+	// and facts are pending.
+	accessFlushInterval = 2 * time.Second
+	accessFlushSize     = 512
+	// accessQueueSize bounds recalls waiting to be tallied. Recall drops its
+	// accesses rather than wait when the queue is full.
+	accessQueueSize = 256
+	// accessWriteTimeout bounds one flush, which waits its turn on the
+	// writer connection.
+	accessWriteTimeout = 10 * time.Second
+)
+
+// access lists the logs and facts one recall returned.
+type access struct {
+	logs  []string
+	facts []int64
+}
+
+// accessTracker tallies recall accesses in the background and writes them
+// in batches, so recall never waits on the writer connection. The same
+// batches reinforce the returned facts when Options.ReinforceFacts is set.
+type accessTracker struct {
+	queue    chan access
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func (m *MemoryEngine) startAccessTracker() {
+	t := &accessTracker{
+		queue: make(chan access, accessQueueSize),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	m.access = t
+	go m.trackAccess(t)
+}
+
+// recordAccess queues the logs and facts res returned, counting each once.
+func (m *MemoryEngine) recordAccess(res *model.RecalledContext) {
+	if m.access == nil || res == nil {
+		return
+	}
+	var a access
+	seenLogs := make(map[string]bool)
+	addLogs := func(logs []model.LogEntry) {
+		for _, l := range logs {
+			if !seenLogs[l.ID] {
+				seenLogs[l.ID] = true
+				a.logs = append(a.logs, l.ID)
+			}
+		}
+	}
+	addLogs(res.RelatedLogs)
+	for _, s := range res.Sessions {
+		addLogs(s.Logs)
+	}
+	seenFacts := make(map[int64]bool)
+	for _, f := range res.RelatedFacts {
+		if f.ID != 0 && !seenFacts[f.ID] {
+			seenFacts[f.ID] = true
+			a.facts = append(a.facts, f.ID)
+		}
+	}
+	if len(a.logs) == 0 && len(a.facts) == 0 {
+		return
+	}
+	select {
+	case m.access.queue <- a:
+	default:
+		m.logger.Debug("access queue full, dropping recall accesses", "logs", len(a.logs), "facts", len(a.facts))
+	}
+}
+
+func (m *MemoryEngine) trackAccess(t *accessTracker) {
+	defer close(t.done)
+	logs := make(map[string]int)
+	facts := make(map[int64]int)
+	add := func(a access) {
+		for _, id := range a.logs {
+			logs[id]++
+		}
+		for _, id := range a.facts {
+			facts[id]++
+		}
+	}
+	flush := func() {
+		if len(logs) == 0 && len(facts) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), accessWriteTimeout)
+		defer cancel()
+		err := m.db.RecordAccess(ctx, sqlite.AccessBatch{
+			Logs:          logs,
+			Triples:       facts,
+			At:            time.Now(),
+			ReinforceStep: m.reinforceStep,
+			ReinforceCap:  m.reinforceCap,
+		})
+		if err != nil {
+			m.logger.Warn("record recall accesses", "logs", len(logs), "facts", len(facts), "err", err)
+		}
+		clear(logs)
+		clear(facts)
+	}
+
+	ticker := time.NewTicker(accessFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case a := <-t.queue:
+			add(a)
+			if len(logs)+len(facts) >= accessFlushSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.stop:
+			for {
+				select {
+				case a := <-t.queue:
+					add(a)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// stopAccessTracker writes pending accesses and stops the tracker.
+func (m *MemoryEngine) stopAccessTracker() {
+	if m.access == nil {
+		return
+	}
+	m.access.stopOnce.Do(func() { close(m.access.stop) })
+	<-m.access.done
+}
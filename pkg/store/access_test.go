@@ -0,0 +1,84 @@
+package store_test
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+// accessedEngine opens a file database with opt, records an observed log
+// and its fact, recalls them and closes the engine, which flushes the
+// accesses. It returns the database path and the log id.
+func accessedEngine(t *testing.T, opt store.Options) (string, string) {
+	t.Helper()
+	ctx := context.Background()
+	opt.DBPath = filepath.Join(t.TempDir(), "paim.db")
+	m := storetest.NewTestEngineWithOptions(t, opt)
+	logID := observeID(t, m, "Alice works at Acme.")
+	if err := m.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// a recent-context recall returns the log and the fact, a query only
+	// the fact
+	for _, q := range []string{"", "alice", "alice"} {
+		recall(t, m, q, model.RecallOptions{})
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return opt.DBPath, logID
+}
+
+func TestRecallRecordsAccesses(t *testing.T) {
+	ctx := context.Background()
+	path, logID := accessedEngine(t, store.Options{})
+	m := storetest.NewTestEngineWithOptions(t, store.Options{DBPath: path})
+
+	log, err := m.Log(ctx, "", logID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log.Log.AccessCount != 1 || log.Log.LastAccessedAt == nil {
+		t.Errorf("log accessed %d times, last at %v; want once", log.Log.AccessCount, log.Log.LastAccessedAt)
+	}
+	res := recall(t, m, "alice", model.RecallOptions{})
+	if len(res.RelatedFacts) != 1 {
+		t.Fatalf("facts = %+v, want alice's", res.RelatedFacts)
+	}
+	if f := res.RelatedFacts[0]; f.AccessCount != 3 || f.LastAccessedAt == nil {
+		t.Errorf("fact accessed %d times, last at %v; want three times", f.AccessCount, f.LastAccessedAt)
+	}
+}
+
+func TestRecallReinforcesFacts(t *testing.T) {
+	ctx := context.Background()
+	for _, tt := range []struct {
+		name string
+		opt  store.Options
+		want float64
+	}{
+		{"off", store.Options{}, 0.6},
+		{"three recalls", store.Options{ReinforceFacts: true, ReinforceStep: 0.05}, 0.75},
+		{"capped", store.Options{ReinforceFacts: true, ReinforceStep: 0.1, ReinforceCap: 0.7}, 0.7},
+	} {
+		path, _ := accessedEngine(t, tt.opt)
+		m := storetest.NewTestEngineWithOptions(t, store.Options{DBPath: path})
+		facts := recall(t, m, "alice", model.RecallOptions{}).RelatedFacts
+		if len(facts) != 1 || math.Abs(facts[0].Confidence-tt.want) > 1e-9 {
+			t.Errorf("%s: facts = %+v, want confidence %v", tt.name, facts, tt.want)
+		}
+	}
+
+	for _, opt := range []store.Options{{ReinforceStep: -0.1}, {ReinforceStep: 1.5}, {ReinforceCap: 2}} {
+		opt.DBPath = store.MemoryPath
+		if m, err := store.NewMemoryEngine(ctx, opt); err == nil {
+			m.Close()
+			t.Errorf("opened an engine with reinforce step %v and cap %v", opt.ReinforceStep, opt.ReinforceCap)
+		}
+	}
+}
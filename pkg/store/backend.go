@@ -0,0 +1,311 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store/graph"
+	"github.com/johncui/PAIM/pkg/store/postgres"
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+	"github.com/johncui/PAIM/pkg/store/vector"
+)
+
+// LogStore keeps the memory logs and their bookkeeping: the embedding
+// queue, the logs staged by buffer evictions and the consolidation history.
+// sqlite.Database and postgres.Database implement it.
+type LogStore interface {
+	InsertLogs(ctx context.Context, inputs []model.SensoryInput) (ids []string, existing []bool, err error)
+	InsertLogsPendingEmbedding(ctx context.Context, inputs []model.SensoryInput) (ids []string, existing []bool, err error)
+	ImportLogs(ctx context.Context, logs []model.LogEntry, enqueue bool) (int64, error)
+	InsertSummary(ctx context.Context, summary model.SensoryInput, at time.Time, originals []string, enqueue bool) (string, error)
+	FetchLog(ctx context.Context, id string) (*model.LogEntry, error)
+	FetchLogs(ctx context.Context, ids []string) ([]model.LogEntry, error)
+	FetchSessionFiltered(ctx context.Context, sessionID string, f sqlite.LogFilter) ([]model.LogEntry, error)
+	RecentLogsFiltered(ctx context.Context, limit int, f sqlite.LogFilter) ([]model.LogEntry, error)
+	EachLog(ctx context.Context, fn func(model.LogEntry) error) error
+	CountLogs(ctx context.Context) (int64, error)
+	UpdateLog(ctx context.Context, id string, patch sqlite.LogPatch) error
+	UpdateLogPendingEmbedding(ctx context.Context, id string, patch sqlite.LogPatch) error
+	DeleteLogs(ctx context.Context, ids []string) (int64, error)
+	DeleteLogsWhere(ctx context.Context, p sqlite.DeleteParams, before func(ids []string) error) (int64, error)
+	PrunableLogs(ctx context.Context, olderThan time.Time, keep int, exclude []string) ([]string, error)
+	UncitedLogs(ctx context.Context, ids []string) ([]string, error)
+	SummaryCandidates(ctx context.Context, olderThan time.Time, limit int) ([]model.LogEntry, error)
+	RecordAccess(ctx context.Context, b sqlite.AccessBatch) error
+
+	// the embedding queue and the stored embeddings
+	ClaimEmbeddings(ctx context.Context, limit int, lease time.Duration) ([]sqlite.PendingEmbedding, error)
+	CompleteEmbedding(ctx context.Context, logID string) error
+	FailEmbedding(ctx context.Context, logID string, cause error, retryAt time.Time) error
+	ReleaseEmbeddings(ctx context.Context, logIDs []string) error
+	EnqueueAllLogs(ctx context.Context) (int64, error)
+	PendingEmbeddingCount(ctx context.Context) (int64, error)
+	LogEmbeddingState(ctx context.Context, logID string, indexed bool) (sqlite.EmbeddingState, error)
+	SaveEmbedding(ctx context.Context, logID, model string, embedding []float64) error
+	StoredEmbedding(ctx context.Context, logID, model string) ([]float64, error)
+	RecentEmbeddings(ctx context.Context, namespace, source, model string, limit int) ([]sqlite.StoredVector, error)
+	EmbedderModel(ctx context.Context) (string, error)
+	SetEmbedderModel(ctx context.Context, name string) error
+	VectorDim() int
+
+	// logs evicted from the sensory buffer before consolidation; the
+	// transaction ClearOverflowTx joins is one TripleStore.UpsertTriplesWith
+	// opened, so both stores must share their database
+	StageOverflow(ctx context.Context, logIDs []string) error
+	OverflowLogs(ctx context.Context, limit int) ([]model.LogEntry, error)
+	OverflowCount(ctx context.Context) (int64, error)
+	ClearOverflowTx(ctx context.Context, tx *sql.Tx, logIDs []string) error
+
+	RecordConsolidationRun(ctx context.Context, run *model.ConsolidationRun, keep int) error
+	ConsolidationRuns(ctx context.Context, limit int) ([]model.ConsolidationRun, error)
+
+	// the database itself; Path is empty when there is no file to measure
+	Ping(ctx context.Context) error
+	Close() error
+	Path() string
+	InMemory() bool
+	SchemaVersion() int
+	VectorVersion() string
+	Encrypted() bool
+	Rekey(ctx context.Context, newKey string) error
+	Backup(ctx context.Context, destPath string) error
+	Maintain(ctx context.Context) (sqlite.MaintenanceReport, error)
+}
+
+// TripleStore keeps the knowledge graph. graph.Store and postgres.Graph
+// implement it.
+type TripleStore interface {
+	UpsertTriples(ctx context.Context, triples []model.Triple) ([]graph.UpsertResult, error)
+	UpsertTriplesWith(ctx context.Context, triples []model.Triple, then func(tx *sql.Tx) error) ([]graph.UpsertResult, error)
+	GetTriple(ctx context.Context, id int64) (*model.Triple, error)
+	ListTriples(ctx context.Context, p graph.ListParams) (graph.ListResult, error)
+	RecentFacts(ctx context.Context, limit int, f graph.FactFilter) ([]model.Triple, error)
+	SearchFactsFiltered(ctx context.Context, term string, limit int, f graph.FactFilter) ([]model.Triple, error)
+	TriplesFromLog(ctx context.Context, logID string) ([]model.Triple, error)
+	SourcesOf(ctx context.Context, ids []int64) (map[int64][]string, error)
+	Neighbors(ctx context.Context, entity string, depth, limit int, f graph.FactFilter) (graph.Neighbors, error)
+	NeighborsOf(ctx context.Context, entities []string, limit int, f graph.FactFilter) ([]model.Triple, error)
+	Neighborhood(ctx context.Context, namespace, entity string, depth, limit int) ([]model.Triple, error)
+	FindPath(ctx context.Context, namespace, from, to string, maxDepth int) ([]model.Triple, error)
+	QueryPattern(ctx context.Context, namespace string, patterns []graph.TriplePattern, limit int) ([]graph.PatternMatch, error)
+	ListEntities(ctx context.Context, namespace, prefix string, limit, offset int) ([]graph.EntityInfo, error)
+	AddAlias(ctx context.Context, namespace, alias, canonical string) error
+	DeleteTriple(ctx context.Context, namespace string, id int64) error
+	DeleteMatching(ctx context.Context, namespace, subject, predicate, object string) (int64, error)
+	DeleteAll(ctx context.Context, namespace string) (int64, error)
+	PruneTriples(ctx context.Context, p graph.PruneParams) (int64, error)
+	Count(ctx context.Context) (int64, error)
+	Export(ctx context.Context, w io.Writer, format graph.ExportFormat, opts graph.ExportOptions) error
+}
+
+// VectorIndex searches the logs by embedding. Hits span all namespaces;
+// SearchLogsFiltered applies a LogFilter to the logs of the hits.
+type VectorIndex interface {
+	Enabled() bool
+	// Name identifies the index in stats and recall diagnostics.
+	Name() string
+	// Similarity converts a search distance into the cosine similarity of
+	// unit-length embeddings.
+	Similarity(distance float64) float64
+	UpsertEmbedding(ctx context.Context, logID string, embedding []float64) error
+	SearchWithScores(ctx context.Context, embedding []float64, topK int) ([]vector.SearchHit, error)
+	SearchLogsFiltered(ctx context.Context, embedding []float64, topK int, f sqlite.LogFilter) (vector.LogResult, error)
+	DeleteByLogIDs(ctx context.Context, logIDs []string) (int64, error)
+	Clear(ctx context.Context) error
+	Count(ctx context.Context) (int64, error)
+	Ping(ctx context.Context) error
+}
+
+var (
+	_ LogStore    = (*sqlite.Database)(nil)
+	_ TripleStore = (*graph.Store)(nil)
+	_ VectorIndex = sqliteVectors{}
+
+	_ LogStore    = (*postgres.Database)(nil)
+	_ TripleStore = (*postgres.Graph)(nil)
+	_ VectorIndex = (*postgres.Vectors)(nil)
+)
+
+// Stores are the backends an engine runs on, all on one database.
+type Stores struct {
+	Logs    LogStore
+	Triples TripleStore
+	Vectors VectorIndex
+	// VectorDegraded says why vector search is off although
+	// Options.EnableVSS was set.
+	VectorDegraded string
+}
+
+// Close closes the database the stores share.
+func (s Stores) Close() error {
+	return s.Logs.Close()
+}
+
+// OpenStores opens the stores at opt.DBPath as NewMemoryEngine does, without
+// an engine around them; the caller closes them. A postgres:// or
+// postgresql:// DBPath selects PostgreSQL, anything else SQLite. Only the
+// storage fields of opt are used, and Logger defaults to one that discards
+// everything.
+func OpenStores(ctx context.Context, opt Options) (Stores, error) {
+	if opt.Logger == nil {
+		opt.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	if postgres.IsDSN(opt.DBPath) {
+		return openPostgres(ctx, opt)
+	}
+	return openSQLite(ctx, opt)
+}
+
+// openSQLite opens the SQLite database at opt.DBPath and the vector index
+// and graph on it, repairing what older builds left behind and indexing
+// the embeddings stored while vector search was off.
+func openSQLite(ctx context.Context, opt Options) (Stores, error) {
+	dbConfig := sqlite.Config{
+		Path:           opt.DBPath,
+		EnableVSS:      opt.EnableVSS,
+		VectorBackend:  opt.VectorBackend,
+		ExtensionsPath: opt.ExtensionsPath,
+		VectorDim:      opt.VectorDim,
+		MigrateDim:     opt.MigrateDim,
+		ReadConns:      opt.ReadConns,
+		Logger:         opt.Logger.With("component", "sqlite"),
+
+		MaintenanceInterval: opt.MaintenanceInterval,
+		CheckpointWALBytes:  opt.CheckpointWALBytes,
+		ReadOnly:            opt.ReadOnly,
+		EncryptionKey:       opt.EncryptionKey,
+
+		UniqueContentSources: opt.UniqueContentSources,
+	}
+	var st Stores
+	db, err := sqlite.New(ctx, dbConfig)
+	if errors.Is(err, ErrVectorUnavailable) && !opt.VSSRequired {
+		opt.Logger.Warn("vector search unavailable; continuing without it", "err", err)
+		st.VectorDegraded = err.Error()
+		dbConfig.EnableVSS = false
+		db, err = sqlite.New(ctx, dbConfig)
+	}
+	if err != nil {
+		return st, err
+	}
+
+	vec := vector.NewWithConfig(db.Writer(), vector.Config{
+		Reader:  db.Reader(),
+		Enabled: db.HasVSS(),
+		Dim:     db.VectorDim(),
+		Model:   opt.EmbedderModel,
+		Backend: db.VectorBackend(),
+		Logger:  opt.Logger.With("component", "vector"),
+	})
+	gr := graph.NewWithConfig(db.Writer(), graph.Config{
+		Reader:               db.Reader(),
+		Logger:               opt.Logger.With("component", "graph"),
+		Merge:                opt.FactMerge,
+		DisableNormalization: opt.DisableEntityNormalization,
+		FunctionalPredicates: opt.FunctionalPredicates,
+		Contradictions:       opt.Contradictions,
+	})
+	if !opt.ReadOnly {
+		if err := repairOnOpen(ctx, vec, gr, opt.Logger); err != nil {
+			db.Close()
+			return st, err
+		}
+		// embeddings stored while vector search was off
+		if n, err := vec.BuildIndexFromTable(ctx); err != nil {
+			db.Close()
+			return st, fmt.Errorf("index stored embeddings: %w", err)
+		} else if n > 0 {
+			opt.Logger.Info("indexed stored embeddings", "count", n)
+		}
+	}
+	st.Logs, st.Triples, st.Vectors = db, gr, sqliteVectors{vec}
+	return st, nil
+}
+
+// openPostgres opens the PostgreSQL database opt.DBPath names and the vector
+// index and graph on it. The SQLite-only options (VectorBackend,
+// ExtensionsPath, the maintenance schedule) do not apply; ReadConns sizes
+// the one connection pool, and EncryptionKey is refused since encryption at
+// rest is the server's business.
+//
+// Unlike openSQLite it has nothing to repair: the repairs undo what SQLite
+// builds from before vector cleanup and entity normalization left behind,
+// and no such build ever wrote to PostgreSQL. Vectors go with their log
+// through a foreign key, so none can be orphaned, and the schema requires
+// every triple to carry the labels whose absence marks a triple
+// NormalizeExisting still has to rewrite.
+func openPostgres(ctx context.Context, opt Options) (Stores, error) {
+	var st Stores
+	if opt.EncryptionKey != "" {
+		return st, errors.New("an encryption key only applies to SQLite databases")
+	}
+	dbConfig := postgres.Config{
+		DSN:        opt.DBPath,
+		EnableVSS:  opt.EnableVSS,
+		VectorDim:  opt.VectorDim,
+		MigrateDim: opt.MigrateDim,
+		MaxConns:   opt.ReadConns,
+		Logger:     opt.Logger.With("component", "postgres"),
+		ReadOnly:   opt.ReadOnly,
+
+		UniqueContentSources: opt.UniqueContentSources,
+	}
+	db, err := postgres.Open(ctx, dbConfig)
+	if errors.Is(err, ErrVectorUnavailable) && !opt.VSSRequired {
+		opt.Logger.Warn("vector search unavailable; continuing without it", "err", err)
+		st.VectorDegraded = err.Error()
+		dbConfig.EnableVSS = false
+		db, err = postgres.Open(ctx, dbConfig)
+	}
+	if err != nil {
+		return st, err
+	}
+
+	vec := postgres.NewVectors(db.DB(), vector.Config{
+		Enabled: db.HasVSS(),
+		Dim:     db.VectorDim(),
+		Model:   opt.EmbedderModel,
+		Logger:  opt.Logger.With("component", "vector"),
+	})
+	gr := postgres.NewGraph(db.DB(), graph.Config{
+		Logger:               opt.Logger.With("component", "graph"),
+		Merge:                opt.FactMerge,
+		DisableNormalization: opt.DisableEntityNormalization,
+		FunctionalPredicates: opt.FunctionalPredicates,
+		Contradictions:       opt.Contradictions,
+	})
+	if !opt.ReadOnly {
+		// embeddings stored while vector search was off
+		if n, err := vec.BuildIndexFromTable(ctx); err != nil {
+			db.Close()
+			return st, fmt.Errorf("index stored embeddings: %w", err)
+		} else if n > 0 {
+			opt.Logger.Info("indexed stored embeddings", "count", n)
+		}
+	}
+	st.Logs, st.Triples, st.Vectors = db, gr, vec
+	return st, nil
+}
+
+// sqliteVectors adapts vector.Store, which takes its log conditions as
+// SQL, to VectorIndex.
+type sqliteVectors struct {
+	*vector.Store
+}
+
+func (v sqliteVectors) Name() string { return v.Backend().Name() }
+
+func (v sqliteVectors) Similarity(distance float64) float64 {
+	return v.Backend().Similarity(distance)
+}
+
+func (v sqliteVectors) SearchLogsFiltered(ctx context.Context, embedding []float64, topK int, f sqlite.LogFilter) (vector.LogResult, error) {
+	cond, args := f.Where("l")
+	return v.SearchLogsWhere(ctx, embedding, topK, cond, args)
+}
@@ -0,0 +1,14 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+func TestSQLiteConformance(t *testing.T) {
+	storetest.RunConformance(t, func(t *testing.T, opt store.Options) store.Stores {
+		return storetest.NewTestStores(t, opt)
+	})
+}
@@ -0,0 +1,174 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+const (
+	// DefaultEmbedBreakerThreshold is the default Options.EmbedBreakerThreshold.
+	DefaultEmbedBreakerThreshold = 5
+	// DefaultEmbedBreakerCooldown is the default Options.EmbedBreakerCooldown.
+	DefaultEmbedBreakerCooldown = 30 * time.Second
+)
+
+// ErrEmbedderUnavailable is returned for embeddings skipped while the
+// embedder circuit breaker is open.
+var ErrEmbedderUnavailable = errors.New("embedder unavailable")
+
+// States of the embedder circuit breaker, as reported by Stats.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+	BreakerDisabled = "disabled"
+)
+
+// breaker stops calling the embedder after threshold consecutive failures.
+// Once cooldown has passed one call is let through as a probe: its success
+// closes the breaker, its failure opens it for another cooldown.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// newBreaker returns a breaker, or nil when threshold <= 0 disables it; a
+// nil breaker allows every call.
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &breaker{threshold: threshold, cooldown: cooldown, now: time.Now, state: BreakerClosed}
+}
+
+// allow reports whether a call may go to the embedder, and whether it is
+// the probe of the half-open state, the only call allowed then. Every call
+// allowed must be followed by done.
+func (b *breaker) allow() (ok, probe bool) {
+	if b == nil {
+		return true, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false, false
+		}
+		b.state = BreakerHalfOpen
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probing {
+			return false, false
+		}
+		b.probing = true
+		return true, true
+	}
+	return true, false
+}
+
+// done records the outcome of an allowed call; ok is false for a failure
+// and abandoned is set when the caller gave up, which counts as neither. It
+// reports whether the call opened the breaker.
+func (b *breaker) done(probe, ok, abandoned bool) (opened bool) {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	switch {
+	case abandoned:
+	case ok:
+		b.state, b.failures = BreakerClosed, 0
+	case probe:
+		b.state, b.openedAt = BreakerOpen, b.now()
+		opened = true
+	default:
+		b.failures++
+		if b.state == BreakerClosed && b.failures >= b.threshold {
+			b.state, b.openedAt = BreakerOpen, b.now()
+			opened = true
+		}
+	}
+	return opened
+}
+
+// openFor returns how long the breaker stays open, or 0.
+func (b *breaker) openFor() time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != BreakerOpen {
+		return 0
+	}
+	return max(b.cooldown-b.now().Sub(b.openedAt), 0)
+}
+
+// snapshot returns the state and the consecutive failure count.
+func (b *breaker) snapshot() (string, int) {
+	if b == nil {
+		return BreakerDisabled, 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state := b.state
+	if state == BreakerOpen && b.now().Sub(b.openedAt) >= b.cooldown {
+		state = BreakerHalfOpen
+	}
+	return state, b.failures
+}
+
+// embedText embeds text through the breaker and Options.EmbedTimeout, and
+// names the model that produced the vector: the one reported by a
+// model.ModelEmbedder, else the configured model. While the breaker is open
+// it fails at once with ErrEmbedderUnavailable.
+func (m *MemoryEngine) embedText(ctx context.Context, text string) ([]float64, string, error) {
+	allowed, probe := m.breaker.allow()
+	if !allowed {
+		return nil, "", ErrEmbedderUnavailable
+	}
+	ectx, span := m.startSpan(ctx, "embed")
+	if m.embedTimeout > 0 {
+		var cancel context.CancelFunc
+		ectx, cancel = context.WithTimeout(ectx, m.embedTimeout)
+		defer cancel()
+	}
+	var (
+		emb  []float64
+		name string
+		err  error
+	)
+	if me, ok := m.embedder.(model.ModelEmbedder); ok {
+		emb, name, err = me.EmbedTextModel(ectx, text)
+	} else {
+		emb, err = m.embedder.EmbedText(ectx, text)
+	}
+	if err != nil && ectx.Err() != nil && ctx.Err() == nil {
+		err = fmt.Errorf("embed: no answer within %s: %w", m.embedTimeout, err)
+	}
+	endSpan(span, err)
+	if m.breaker.done(probe, err == nil, err != nil && ctx.Err() != nil) {
+		m.logger.Warn("embedder failing; skipping embeddings", "cooldown", m.breaker.cooldown, "err", err)
+	}
+	if name == "" {
+		name = m.embedderModel
+	}
+	return emb, name, err
+}
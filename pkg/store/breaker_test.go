@@ -0,0 +1,159 @@
+package store
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// testBreaker returns a breaker whose clock moves only when advanced.
+func testBreaker(threshold int, cooldown time.Duration) (*breaker, func(time.Duration)) {
+	var mu sync.Mutex
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newBreaker(threshold, cooldown)
+	b.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	return b, func(d time.Duration) {
+		mu.Lock()
+		now = now.Add(d)
+		mu.Unlock()
+	}
+}
+
+// fail runs one allowed call that fails and reports whether it opened b.
+func fail(t *testing.T, b *breaker) bool {
+	t.Helper()
+	ok, probe := b.allow()
+	if !ok {
+		t.Fatal("call refused")
+	}
+	return b.done(probe, false, false)
+}
+
+func wantState(t *testing.T, b *breaker, state string, failures int) {
+	t.Helper()
+	if s, n := b.snapshot(); s != state || n != failures {
+		t.Errorf("breaker %s with %d failures, want %s with %d", s, n, state, failures)
+	}
+}
+
+func TestBreakerOpensAtTheThreshold(t *testing.T) {
+	b, _ := testBreaker(3, time.Minute)
+	if fail(t, b) || fail(t, b) {
+		t.Fatal("opened before the threshold")
+	}
+	wantState(t, b, BreakerClosed, 2)
+	// a success in between starts the count again
+	ok, probe := b.allow()
+	if !ok || probe {
+		t.Fatalf("closed breaker allow = %v, %v", ok, probe)
+	}
+	b.done(probe, true, false)
+	wantState(t, b, BreakerClosed, 0)
+
+	fail(t, b)
+	fail(t, b)
+	if !fail(t, b) {
+		t.Fatal("third consecutive failure did not open the breaker")
+	}
+	wantState(t, b, BreakerOpen, 3)
+	if ok, _ := b.allow(); ok {
+		t.Error("open breaker allowed a call")
+	}
+	if d := b.openFor(); d != time.Minute {
+		t.Errorf("openFor = %v, want the whole cooldown", d)
+	}
+}
+
+func TestBreakerProbesAfterTheCooldown(t *testing.T) {
+	b, advance := testBreaker(1, time.Minute)
+	fail(t, b)
+	advance(40 * time.Second)
+	if d := b.openFor(); d != 20*time.Second {
+		t.Errorf("openFor = %v, want 20s", d)
+	}
+	advance(20 * time.Second)
+	wantState(t, b, BreakerHalfOpen, 1)
+	if d := b.openFor(); d != 0 {
+		t.Errorf("openFor past the cooldown = %v, want 0", d)
+	}
+
+	ok, probe := b.allow()
+	if !ok || !probe {
+		t.Fatalf("allow after the cooldown = %v, %v; want a probe", ok, probe)
+	}
+	if ok, _ := b.allow(); ok {
+		t.Error("a second call was let through while probing")
+	}
+	if !b.done(probe, false, false) {
+		t.Error("failed probe did not reopen the breaker")
+	}
+	wantState(t, b, BreakerOpen, 1)
+	if ok, _ := b.allow(); ok {
+		t.Error("reopened breaker allowed a call")
+	}
+
+	advance(time.Minute)
+	ok, probe = b.allow()
+	if !ok || !probe {
+		t.Fatalf("allow after the second cooldown = %v, %v; want a probe", ok, probe)
+	}
+	if b.done(probe, true, false) {
+		t.Error("successful probe reported opening the breaker")
+	}
+	wantState(t, b, BreakerClosed, 0)
+	if ok, probe := b.allow(); !ok || probe {
+		t.Errorf("closed breaker allow = %v, %v", ok, probe)
+	}
+}
+
+func TestBreakerIgnoresAbandonedCalls(t *testing.T) {
+	b, advance := testBreaker(2, time.Minute)
+	fail(t, b)
+	for i := 0; i < 3; i++ {
+		ok, probe := b.allow()
+		if !ok {
+			t.Fatal("call refused")
+		}
+		if b.done(probe, false, true) {
+			t.Fatal("abandoned call opened the breaker")
+		}
+	}
+	wantState(t, b, BreakerClosed, 1)
+
+	fail(t, b)
+	advance(time.Minute)
+	ok, probe := b.allow()
+	if !ok || !probe {
+		t.Fatal("no probe after the cooldown")
+	}
+	b.done(probe, false, true)
+	// the abandoned probe frees the slot for the next one
+	wantState(t, b, BreakerHalfOpen, 2)
+	if ok, probe := b.allow(); !ok || !probe {
+		t.Errorf("allow after an abandoned probe = %v, %v; want another probe", ok, probe)
+	}
+}
+
+func TestNilBreakerAllowsEverything(t *testing.T) {
+	b := newBreaker(0, time.Minute)
+	if b != nil {
+		t.Fatal("threshold 0 built a breaker")
+	}
+	for i := 0; i < 10; i++ {
+		ok, probe := b.allow()
+		if !ok || probe {
+			t.Fatalf("nil breaker allow = %v, %v", ok, probe)
+		}
+		if b.done(probe, false, false) {
+			t.Fatal("nil breaker opened")
+		}
+	}
+	wantState(t, b, BreakerDisabled, 0)
+	if d := b.openFor(); d != 0 {
+		t.Errorf("nil breaker openFor = %v", d)
+	}
+}
@@ -0,0 +1,82 @@
+package store_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/graph"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+func TestConcurrentObserveRecallAndConsolidate(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngineWithOptions(t, store.Options{DBPath: filepath.Join(t.TempDir(), "paim.db")})
+	const writers, perWriter = 4, 25
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				in := model.SensoryInput{Content: fmt.Sprintf("Person%d_%d works at Acme.", w, i)}
+				if err := m.Observe(ctx, in); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+	}
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if _, err := m.RecallWithOptions(ctx, "", model.RecallOptions{TopK: 5}); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := m.ListFacts(ctx, graph.ListParams{Limit: 5}); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := m.TryConsolidate(ctx); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if err := m.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	st, err := m.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Logs != writers*perWriter || st.Triples != writers*perWriter || st.BufferLen != 0 {
+		t.Fatalf("%d logs, %d facts, %d buffered; want %d logs distilled into as many facts",
+			st.Logs, st.Triples, st.BufferLen, writers*perWriter)
+	}
+}
@@ -0,0 +1,231 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/graph"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+// stubDistiller turns every input into "<content> seen true", or fails
+// while err is set. While bad is set it cancels the consolidation once it
+// has distilled, so that writing the triples fails. It records the contents
+// it was given.
+type stubDistiller struct {
+	mu     sync.Mutex
+	err    error
+	bad    bool
+	cancel context.CancelFunc
+	inputs []string
+}
+
+func (d *stubDistiller) Distill(_ context.Context, inputs []model.SensoryInput) ([]model.Triple, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return nil, d.err
+	}
+	var out []model.Triple
+	for _, in := range inputs {
+		d.inputs = append(d.inputs, in.Content)
+		out = append(out, model.Triple{Subject: in.Content, Predicate: "seen", Object: "true", Confidence: 0.8})
+	}
+	if d.bad && d.cancel != nil {
+		d.cancel()
+	}
+	return out, nil
+}
+
+func (d *stubDistiller) set(err error, bad bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.err, d.bad = err, bad
+}
+
+func (d *stubDistiller) distilled() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.inputs...)
+}
+
+func observeAll(t *testing.T, m *store.MemoryEngine, contents ...string) {
+	t.Helper()
+	for _, c := range contents {
+		if err := m.Observe(context.Background(), model.SensoryInput{Content: c}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func bufferLen(t *testing.T, m *store.MemoryEngine) int {
+	t.Helper()
+	st, err := m.Stats(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st.BufferLen
+}
+
+func factCount(t *testing.T, m *store.MemoryEngine) int {
+	t.Helper()
+	res, err := m.ListFacts(context.Background(), graph.ListParams{Limit: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(res.Triples)
+}
+
+func TestConsolidateKeepsBufferWhenDistillerFails(t *testing.T) {
+	ctx := context.Background()
+	d := &stubDistiller{}
+	m := storetest.NewTestEngineWithOptions(t, store.Options{Distiller: d})
+	observeAll(t, m, "a", "b")
+
+	d.set(errors.New("model unavailable"), false)
+	if err := m.Consolidate(ctx); err == nil {
+		t.Fatal("Consolidate succeeded with a failing distiller")
+	}
+
+	d.set(nil, false)
+	if err := m.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := d.distilled(); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("distilled %q after a failed run, want the kept a and b", got)
+	}
+	if n := factCount(t, m); n != 2 {
+		t.Fatalf("%d facts, want 2", n)
+	}
+	// the successful run emptied the buffer
+	if err := m.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := d.distilled(); len(got) != 2 {
+		t.Fatalf("distilled %q, want nothing more after the buffer was consolidated", got)
+	}
+}
+
+func TestConsolidateKeepsBufferWhenGraphWriteFails(t *testing.T) {
+	d := &stubDistiller{}
+	m := storetest.NewTestEngineWithOptions(t, store.Options{Distiller: d})
+	observeAll(t, m, "a", "b")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	d.set(nil, true)
+	if err := m.Consolidate(ctx); err == nil {
+		t.Fatal("Consolidate succeeded although the triples were not written")
+	}
+	if n := factCount(t, m); n != 0 {
+		t.Fatalf("%d facts written by a failed run", n)
+	}
+
+	d.set(nil, false)
+	if err := m.Consolidate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := d.distilled(); !slices.Equal(got, []string{"a", "b", "a", "b"}) {
+		t.Fatalf("distilled %q, want a and b again after the failed write", got)
+	}
+	if n := factCount(t, m); n != 2 {
+		t.Fatalf("%d facts, want 2", n)
+	}
+}
+
+func TestOverflowKeepsTheNamespace(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngineWithOptions(t, store.Options{BufferSize: 1, ConsolidateFillRatio: -1})
+	for _, in := range []model.SensoryInput{
+		{Content: "Alice works at Acme.", Namespace: "work"},
+		{Content: "Bob lives in Berlin.", Namespace: "home"},
+	} {
+		if err := m.Observe(ctx, in); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	work, err := m.ListFacts(ctx, graph.ListParams{Namespace: "work", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(work.Triples) != 1 || work.Triples[0].Subject != "alice" {
+		t.Errorf("work facts = %+v, want the evicted input distilled into work", work.Triples)
+	}
+	if n := namespaceFacts(t, m, "home"); n != 1 {
+		t.Errorf("%d home facts, want 1", n)
+	}
+}
+
+func TestConsolidateRecordsEachRun(t *testing.T) {
+	ctx := context.Background()
+	d := &stubDistiller{}
+	m := storetest.NewTestEngineWithOptions(t, store.Options{Distiller: d, ConsolidationHistory: 2})
+	runs := func() []model.ConsolidationRun {
+		t.Helper()
+		runs, err := m.ConsolidationRuns(ctx, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return runs
+	}
+
+	// an idle run is recorded, so the history shows the loop is alive
+	if err := m.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if r := runs(); len(r) != 1 || r[0].Inputs != 0 || r[0].TriplesWritten != 0 || r[0].Error != "" {
+		t.Fatalf("runs after an empty consolidation = %+v, want the idle run", r)
+	}
+
+	observeAll(t, m, "a", "b")
+	d.set(errors.New("model unavailable"), false)
+	if err := m.Consolidate(ctx); err == nil {
+		t.Fatal("Consolidate succeeded with a failing distiller")
+	}
+	r := runs()
+	if len(r) != 2 || r[0].Inputs != 2 || r[0].TriplesWritten != 0 || r[0].Error != "distill: model unavailable" || r[0].FinishedAt.Before(r[0].StartedAt) {
+		t.Fatalf("runs after a failure = %+v, want the failed run first", r)
+	}
+
+	d.set(nil, false)
+	if ran, err := m.TryConsolidate(ctx); !ran || err != nil {
+		t.Fatalf("TryConsolidate = %v, %v", ran, err)
+	}
+	r = runs()
+	if len(r) != 2 || r[0].Inputs != 2 || r[0].TriplesWritten != 2 || r[0].Error != "" {
+		t.Fatalf("runs after a success = %+v, want it first", r)
+	}
+	st, err := m.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.LastConsolidationRun == nil || st.LastConsolidationRun.ID != r[0].ID {
+		t.Errorf("Stats.LastConsolidationRun = %+v, want run %d", st.LastConsolidationRun, r[0].ID)
+	}
+
+	// only the latest two are kept
+	observeAll(t, m, "c")
+	if err := m.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if r := runs(); len(r) != 2 || r[0].Inputs != 1 || r[1].Error != "" {
+		t.Errorf("runs = %+v, want the two successful ones", r)
+	}
+
+	off := storetest.NewTestEngineWithOptions(t, store.Options{Distiller: &stubDistiller{}, ConsolidationHistory: -1})
+	observeAll(t, off, "a")
+	if err := off.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := off.ConsolidationRuns(ctx, 10); err != nil || len(r) != 0 {
+		t.Errorf("runs with the history off = %+v, %v", r, err)
+	}
+}
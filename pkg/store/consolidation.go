@@ -0,0 +1,210 @@
+package store
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/memory"
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// DefaultConsolidateFillRatio is the buffer fill level at which Observe
+// requests a consolidation when Options.ConsolidateFillRatio is unset.
+const DefaultConsolidateFillRatio = 0.8
+
+const (
+	// DefaultConsolidationHistory is the default Options.ConsolidationHistory.
+	DefaultConsolidationHistory = 100
+	// MaxConsolidationRuns bounds the runs ConsolidationRuns returns.
+	MaxConsolidationRuns = 1000
+)
+
+// RequestConsolidation asks the consolidation loop to run soon. It never
+// blocks; requests made while one is pending are coalesced.
+func (m *MemoryEngine) RequestConsolidation() {
+	select {
+	case m.consolidateReq <- struct{}{}:
+	default:
+	}
+}
+
+// ConsolidationRequests delivers RequestConsolidation calls to whatever runs
+// the consolidation loop.
+func (m *MemoryEngine) ConsolidationRequests() <-chan struct{} {
+	return m.consolidateReq
+}
+
+// TryConsolidate runs Consolidate unless one is already in progress, in which
+// case it returns false without waiting.
+func (m *MemoryEngine) TryConsolidate(ctx context.Context) (bool, error) {
+	if m.readOnly {
+		return false, ErrReadOnly
+	}
+	if !m.consolidateMu.TryLock() {
+		return false, nil
+	}
+	defer m.consolidateMu.Unlock()
+	return true, m.runConsolidation(ctx)
+}
+
+// runConsolidation consolidates and records the outcome in the stats and the
+// consolidation history. Runs that found nothing to distill are recorded too,
+// so an idle loop can be told apart from a stopped one. The caller holds
+// consolidateMu.
+func (m *MemoryEngine) runConsolidation(ctx context.Context) error {
+	run := model.ConsolidationRun{StartedAt: time.Now()}
+	var err error
+	run.Inputs, run.TriplesWritten, err = m.consolidate(ctx)
+	run.FinishedAt = time.Now()
+	m.recordConsolidation(err)
+	if err != nil {
+		run.Error = err.Error()
+	}
+	if m.history < 0 {
+		return err
+	}
+	// a run failing because ctx ended is still recorded
+	if herr := m.db.RecordConsolidationRun(context.WithoutCancel(ctx), &run, m.history); herr != nil {
+		m.logger.Error("record consolidation run", "err", herr)
+	}
+	return err
+}
+
+// ConsolidationRuns returns up to limit runs of the consolidation history,
+// latest first (limit defaults to 20 and is capped at MaxConsolidationRuns).
+func (m *MemoryEngine) ConsolidationRuns(ctx context.Context, limit int) ([]model.ConsolidationRun, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	limit = min(limit, MaxConsolidationRuns)
+	runs, err := m.db.ConsolidationRuns(ctx, limit)
+	if runs == nil && err == nil {
+		runs = []model.ConsolidationRun{}
+	}
+	return runs, err
+}
+
+// bufferInput adds an observed input to the sensory buffer and requests a
+// consolidation once the buffer is filled past the configured threshold.
+func (m *MemoryEngine) bufferInput(input model.SensoryInput) {
+	m.buffer.Add(input)
+	if m.consolidateAt > 0 && m.buffer.Len() >= m.consolidateAt {
+		m.requestAfterGap()
+	}
+}
+
+// requestAfterGap calls RequestConsolidation, or schedules it for when
+// Options.ConsolidateMinInterval has passed since the last consolidation.
+// Requests made while one is scheduled are coalesced into it.
+func (m *MemoryEngine) requestAfterGap() {
+	wait := m.consolidateGap - time.Since(m.lastConsolidationRun())
+	if wait <= 0 {
+		m.RequestConsolidation()
+		return
+	}
+	m.deferMu.Lock()
+	defer m.deferMu.Unlock()
+	if m.deferredReq != nil {
+		return
+	}
+	m.deferredReq = time.AfterFunc(wait, func() {
+		m.deferMu.Lock()
+		m.deferredReq = nil
+		m.deferMu.Unlock()
+		m.RequestConsolidation()
+	})
+}
+
+// lastConsolidationRun returns when the last consolidation ended, failed or
+// not; zero if none ran yet.
+func (m *MemoryEngine) lastConsolidationRun() time.Time {
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+	if m.lastConsolidationFailure.After(m.lastConsolidation) {
+		return m.lastConsolidationFailure
+	}
+	return m.lastConsolidation
+}
+
+// maxOverflowBatch bounds the evicted logs one consolidation distills; the
+// rest wait for the next one, which is requested right away.
+const maxOverflowBatch = 1000
+
+// overflowStager stages the logs of inputs the buffer evicts, so no
+// observed input misses distillation because the buffer was full.
+//
+// An input can be evicted while a consolidation that snapshotted it is
+// still distilling. Staged before the run commits, its log is cleared by the
+// run itself (see commit); evicted after, it is recognized by its sequence
+// number and not staged. Either way it is distilled once.
+type overflowStager struct {
+	db     LogStore
+	logger *slog.Logger
+
+	mu sync.Mutex
+	// distilled holds the sequence numbers of the snapshot the last
+	// consolidation committed.
+	distilled map[uint64]struct{}
+}
+
+// stage is the buffer eviction callback.
+func (s *overflowStager) stage(items []memory.Item) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(items))
+	for _, it := range items {
+		if _, ok := s.distilled[it.Seq]; ok {
+			continue
+		}
+		if it.Input.LogID != "" {
+			ids = append(ids, it.Input.LogID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	if err := s.db.StageOverflow(context.Background(), ids); err != nil {
+		s.logger.Error("stage evicted inputs; they will not be distilled", "logs", len(ids), "err", err)
+	}
+}
+
+// commit runs write, which must also clear the staged logs of the snapshot
+// items, and records the snapshot as distilled once it succeeds. Evictions
+// wait meanwhile, so none is staged between the two.
+func (s *overflowStager) commit(snapshot []memory.Item, write func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := write(); err != nil {
+		return err
+	}
+	s.distilled = make(map[uint64]struct{}, len(snapshot))
+	for _, it := range snapshot {
+		s.distilled[it.Seq] = struct{}{}
+	}
+	return nil
+}
+
+// overflowInput rebuilds the input of a staged log for distillation.
+func overflowInput(e model.LogEntry) model.SensoryInput {
+	return model.SensoryInput{
+		Content:   e.Content,
+		Source:    e.SourceType,
+		Metadata:  e.Metadata,
+		Namespace: e.Namespace,
+		SessionID: e.SessionID,
+		Timestamp: e.Timestamp,
+		LogID:     e.ID,
+	}
+}
+
+// fillThreshold converts a fill ratio into an item count; ratios outside
+// (0, 1] disable the trigger.
+func fillThreshold(capacity int, ratio float64) int {
+	if ratio <= 0 || ratio > 1 {
+		return 0
+	}
+	return int(math.Max(1, math.Ceil(float64(capacity)*ratio)))
+}
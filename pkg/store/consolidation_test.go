@@ -0,0 +1,209 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+// gatedDistiller signals on started when a Distill call begins and blocks
+// it until release is closed, then distills like stubDistiller.
+type gatedDistiller struct {
+	stubDistiller
+	started chan struct{}
+	release chan struct{}
+}
+
+func newGatedDistiller() *gatedDistiller {
+	return &gatedDistiller{started: make(chan struct{}, 1), release: make(chan struct{})}
+}
+
+func (d *gatedDistiller) Distill(ctx context.Context, inputs []model.SensoryInput) ([]model.Triple, error) {
+	d.started <- struct{}{}
+	select {
+	case <-d.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return d.stubDistiller.Distill(ctx, inputs)
+}
+
+func requested(m *store.MemoryEngine) bool {
+	select {
+	case <-m.ConsolidationRequests():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestFillRatioRequestsConsolidation(t *testing.T) {
+	m := storetest.NewTestEngineWithOptions(t, store.Options{BufferSize: 10, ConsolidateFillRatio: 0.5, Distiller: &stubDistiller{}})
+	observeAll(t, m, "1", "2", "3", "4")
+	if requested(m) {
+		t.Fatal("consolidation requested below the fill ratio")
+	}
+	observeAll(t, m, "5")
+	if !requested(m) {
+		t.Fatal("no consolidation requested at the fill ratio")
+	}
+	// requests coalesce until the loop takes one
+	observeAll(t, m, "6", "7")
+	if !requested(m) || requested(m) {
+		t.Fatal("requests above the fill ratio did not coalesce into one")
+	}
+
+	if err := m.Consolidate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	observeAll(t, m, "8")
+	if requested(m) {
+		t.Fatal("consolidation requested after the buffer was drained")
+	}
+}
+
+func TestFillRatioOutOfRangeDisablesTheTrigger(t *testing.T) {
+	for _, ratio := range []float64{-1, 1.5} {
+		m := storetest.NewTestEngineWithOptions(t, store.Options{BufferSize: 2, ConsolidateFillRatio: ratio})
+		observeAll(t, m, "a", "b", "c")
+		if requested(m) {
+			t.Errorf("ratio %v requested a consolidation", ratio)
+		}
+	}
+}
+
+func TestMinIntervalDefersTheRequest(t *testing.T) {
+	m := storetest.NewTestEngineWithOptions(t, store.Options{
+		BufferSize:             4,
+		ConsolidateFillRatio:   0.25,
+		ConsolidateMinInterval: 200 * time.Millisecond,
+		Distiller:              &stubDistiller{},
+	})
+	if err := m.Consolidate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	observeAll(t, m, "a")
+	if requested(m) {
+		t.Fatal("request not deferred right after a consolidation")
+	}
+	select {
+	case <-m.ConsolidationRequests():
+	case <-time.After(5 * time.Second):
+		t.Fatal("deferred request never fired")
+	}
+}
+
+func TestTryConsolidateSkipsWhileOneRuns(t *testing.T) {
+	ctx := context.Background()
+	d := newGatedDistiller()
+	m := storetest.NewTestEngineWithOptions(t, store.Options{Distiller: d})
+	observeAll(t, m, "a")
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.TryConsolidate(ctx)
+		done <- err
+	}()
+	<-d.started
+	if ran, err := m.TryConsolidate(ctx); ran || err != nil {
+		t.Errorf("TryConsolidate during a run = %v, %v; want it skipped", ran, err)
+	}
+	close(d.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if ran, err := m.TryConsolidate(ctx); !ran || err != nil {
+		t.Errorf("TryConsolidate after the run = %v, %v; want it run", ran, err)
+	}
+}
+
+func TestConsolidateKeepsInputsObservedWhileDistilling(t *testing.T) {
+	ctx := context.Background()
+	d := newGatedDistiller()
+	m := storetest.NewTestEngineWithOptions(t, store.Options{Distiller: d})
+	observeAll(t, m, "early")
+
+	done := make(chan error, 1)
+	go func() { done <- m.Consolidate(ctx) }()
+	<-d.started
+	observeAll(t, m, "late 1", "late 2")
+	close(d.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if n := bufferLen(t, m); n != 2 {
+		t.Fatalf("%d inputs buffered after the run, want the 2 observed during it", n)
+	}
+
+	if err := m.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got := d.distilled()
+	if len(got) != 3 || got[0] != "early" || got[1] != "late 1" || got[2] != "late 2" {
+		t.Fatalf("distilled %q, want every input exactly once", got)
+	}
+	if n := bufferLen(t, m); n != 0 {
+		t.Fatalf("%d inputs still buffered", n)
+	}
+}
+
+func TestMinIntervalCoalescesDeferredRequests(t *testing.T) {
+	d := &stubDistiller{}
+	m := storetest.NewTestEngineWithOptions(t, store.Options{
+		BufferSize:             4,
+		ConsolidateFillRatio:   0.25,
+		ConsolidateMinInterval: 100 * time.Millisecond,
+		Distiller:              d,
+	})
+	// nothing ran yet, so there is no interval to wait for
+	observeAll(t, m, "a")
+	if !requested(m) {
+		t.Fatal("first request deferred")
+	}
+
+	// a failed run starts the interval too
+	d.set(errors.New("model offline"), false)
+	if err := m.Consolidate(context.Background()); err == nil {
+		t.Fatal("Consolidate succeeded with a failing distiller")
+	}
+	observeAll(t, m, "b", "c")
+	if requested(m) {
+		t.Fatal("request not deferred after a failed consolidation")
+	}
+	time.Sleep(300 * time.Millisecond)
+	if !requested(m) || requested(m) {
+		t.Fatal("deferred requests did not fire once, coalesced")
+	}
+}
+
+func TestCloseStopsADeferredRequest(t *testing.T) {
+	m, err := store.NewMemoryEngine(context.Background(), store.Options{
+		DBPath:                 store.MemoryPath,
+		BufferSize:             4,
+		ConsolidateFillRatio:   0.25,
+		ConsolidateMinInterval: 50 * time.Millisecond,
+		Distiller:              &stubDistiller{},
+		Logger:                 slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Consolidate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	observeAll(t, m, "a")
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if requested(m) {
+		t.Error("deferred request fired after Close")
+	}
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+const (
+	// dedupCandidates is how many nearest neighbours the vector index is
+	// asked for when checking an input for duplicates.
+	dedupCandidates = 5
+	// dedupScanLimit bounds the stored embeddings compared by brute force
+	// when vector search is disabled: the newest logs of the same namespace
+	// and source.
+	dedupScanLimit = 1000
+)
+
+// dedupEnabled reports whether Observe checks inputs for near-duplicates:
+// Options.DedupThreshold must be set and there must be embeddings to compare
+// against, in the vector index or the embeddings table.
+func (m *MemoryEngine) dedupEnabled() bool {
+	return m.dedupThreshold > 0 && (m.vec.Enabled() || m.storeEmbeddings)
+}
+
+// duplicate is an input that nearly repeats the stored log logID, or the
+// earlier input of its batch at index input when logID is empty.
+type duplicate struct {
+	logID      string
+	input      int
+	similarity float64
+}
+
+// findDuplicates embeds the inputs and reports every input that nearly
+// repeats a stored log, or an earlier new input of the batch, of the same
+// namespace and source; new inputs get nil. The embeddings are returned for
+// reuse, with the model that computed each. An embedder or search failure
+// only skips the check for that input, so deduplication never makes Observe
+// fail; so does a vector from a fallback model, which is not comparable
+// with the stored ones.
+func (m *MemoryEngine) findDuplicates(ctx context.Context, inputs []model.SensoryInput) ([]*duplicate, [][]float64, []string) {
+	dups := make([]*duplicate, len(inputs))
+	embs := make([][]float64, len(inputs))
+	models := make([]string, len(inputs))
+	for i, in := range inputs {
+		emb, embModel, err := m.embedText(ctx, in.Content)
+		if errors.Is(err, ErrEmbedderUnavailable) {
+			break
+		}
+		if err != nil {
+			m.logger.Warn("duplicate check skipped", "err", err)
+			continue
+		}
+		embs[i], models[i] = emb, embModel
+		if embModel != m.embedderModel {
+			continue
+		}
+		for j := 0; j < i; j++ {
+			if dups[j] != nil || embs[j] == nil || models[j] != embModel || inputs[j].Namespace != in.Namespace || inputs[j].Source != in.Source {
+				continue
+			}
+			if sim := cosine(emb, embs[j]); sim >= m.dedupThreshold {
+				dups[i] = &duplicate{input: j, similarity: sim}
+				break
+			}
+		}
+		if dups[i] != nil {
+			continue
+		}
+		id, sim, err := m.nearestLog(ctx, in, emb)
+		if err != nil {
+			m.logger.Warn("duplicate check skipped", "err", err)
+			continue
+		}
+		if id != "" && sim >= m.dedupThreshold {
+			dups[i] = &duplicate{logID: id, input: -1, similarity: sim}
+		}
+	}
+	return dups, embs, models
+}
+
+// nearestLog returns the stored log of in's namespace and source most
+// similar to emb, with its similarity, or "" when there is none.
+func (m *MemoryEngine) nearestLog(ctx context.Context, in model.SensoryInput, emb []float64) (string, float64, error) {
+	if !m.vec.Enabled() {
+		stored, err := m.db.RecentEmbeddings(ctx, in.Namespace, in.Source, m.embedderModel, dedupScanLimit)
+		if err != nil {
+			return "", 0, err
+		}
+		best, bestSim := "", -1.0
+		for _, s := range stored {
+			if sim := cosine(emb, s.Embedding); sim > bestSim {
+				best, bestSim = s.LogID, sim
+			}
+		}
+		return best, bestSim, nil
+	}
+
+	hits, err := m.vec.SearchWithScores(ctx, emb, dedupCandidates)
+	if err != nil {
+		return "", 0, err
+	}
+	var ids []string
+	sims := make(map[string]float64)
+	for _, h := range hits {
+		if h.Namespace == in.Namespace {
+			ids = append(ids, h.LogID)
+			sims[h.LogID] = m.vec.Similarity(h.Distance)
+		}
+	}
+	logs, err := m.db.FetchLogs(ctx, ids)
+	if err != nil {
+		return "", 0, err
+	}
+	best, bestSim := "", -1.0
+	for _, l := range logs {
+		if l.SourceType == in.Source && sims[l.ID] > bestSim {
+			best, bestSim = l.ID, sims[l.ID]
+		}
+	}
+	return best, bestSim, nil
+}
+
+// cosine returns the cosine similarity of a and b, or 0 when their
+// dimensions differ or either is zero.
+func cosine(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
@@ -0,0 +1,144 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+// fixedEmbedder embeds each known content as its listed vector and fails
+// for anything else.
+type fixedEmbedder map[string][]float64
+
+func (e fixedEmbedder) EmbedText(_ context.Context, text string) ([]float64, error) {
+	if v, ok := e[text]; ok {
+		return v, nil
+	}
+	return nil, errors.New("unknown content")
+}
+
+func newDedupEngine(t *testing.T) *store.MemoryEngine {
+	t.Helper()
+	return storetest.NewTestEngineWithOptions(t, store.Options{
+		Embedder: fixedEmbedder{
+			"Alice works at Acme.":      {1, 0},
+			"Alice works at Acme Corp.": {0.999, 0.04},
+			"Bob lives in Berlin.":      {0, 1},
+			"Carol likes tea.":          {0.6, 0.8},
+			"Carol likes green tea.":    {0.61, 0.79},
+		},
+		EmbedderModel:   "fixed",
+		VectorDim:       2,
+		StoreEmbeddings: true,
+		SyncEmbedding:   true,
+		DedupThreshold:  0.99,
+		Distiller:       noFacts{},
+	})
+}
+
+func observeResult(t *testing.T, m *store.MemoryEngine, in model.SensoryInput) model.ObserveResult {
+	t.Helper()
+	res, err := m.ObserveWithID(context.Background(), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestObserveDropsNearDuplicates(t *testing.T) {
+	m := newDedupEngine(t)
+	first := observeResult(t, m, model.SensoryInput{Content: "Alice works at Acme.", Source: "chat"})
+
+	dup := observeResult(t, m, model.SensoryInput{Content: "Alice works at Acme Corp.", Source: "chat"})
+	if !dup.Duplicate || dup.LogID != first.LogID || dup.Similarity < 0.99 {
+		t.Errorf("near duplicate = %+v, want a duplicate of %s", dup, first.LogID)
+	}
+	for _, in := range []model.SensoryInput{
+		{Content: "Bob lives in Berlin.", Source: "chat"},
+		{Content: "Alice works at Acme Corp.", Source: "mail"},
+		{Content: "Alice works at Acme Corp.", Source: "chat", Namespace: "work"},
+		// not embeddable, so not checked
+		{Content: "Dave is new.", Source: "chat"},
+	} {
+		if res := observeResult(t, m, in); res.Duplicate {
+			t.Errorf("%q from %s in %q reported as a duplicate of %s", in.Content, in.Source, in.Namespace, res.LogID)
+		}
+	}
+	if got := len(logContents(t, m)); got != 4 {
+		t.Errorf("%d logs stored in the default namespace, want 4", got)
+	}
+}
+
+func TestObserveDropsDuplicatesWithinABatch(t *testing.T) {
+	m := newDedupEngine(t)
+	res, err := m.ObserveResults(context.Background(), []model.SensoryInput{
+		{Content: "Carol likes tea."},
+		{Content: "Bob lives in Berlin."},
+		{Content: "Carol likes green tea."},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res[0].Duplicate || res[1].Duplicate || !res[2].Duplicate || res[2].LogID != res[0].LogID {
+		t.Errorf("results = %+v, want the third input reported as a duplicate of the first", res)
+	}
+	if got := len(logContents(t, m)); got != 2 {
+		t.Errorf("%d logs stored, want 2", got)
+	}
+
+	if _, err := store.NewMemoryEngine(context.Background(), store.Options{DBPath: store.MemoryPath, DedupThreshold: 1.5}); err == nil {
+		t.Error("opened an engine with a dedup threshold of 1.5")
+	}
+}
+
+// switchingEmbedder is a fixedEmbedder that names its vectors "fixed", or
+// "fallback" while fallback is set, like an embedder chain whose primary
+// went down.
+type switchingEmbedder struct {
+	fixedEmbedder
+	fallback atomic.Bool
+}
+
+func (e *switchingEmbedder) EmbedTextModel(ctx context.Context, text string) ([]float64, string, error) {
+	emb, err := e.EmbedText(ctx, text)
+	if e.fallback.Load() {
+		return emb, "fallback", err
+	}
+	return emb, "fixed", err
+}
+
+func TestFallbackVectorsAreNotComparedForDuplicates(t *testing.T) {
+	emb := &switchingEmbedder{fixedEmbedder: fixedEmbedder{
+		"Alice works at Acme.":      {1, 0},
+		"Alice works at Acme Corp.": {0.999, 0.04},
+		"Carol likes tea.":          {0.6, 0.8},
+		"Carol likes green tea.":    {0.61, 0.79},
+	}}
+	m := storetest.NewTestEngineWithOptions(t, store.Options{
+		Embedder: emb, EmbedderModel: "fixed", VectorDim: 2,
+		StoreEmbeddings: true, SyncEmbedding: true, DedupThreshold: 0.99, Distiller: noFacts{},
+	})
+	observeResult(t, m, model.SensoryInput{Content: "Alice works at Acme."})
+
+	emb.fallback.Store(true)
+	if res := observeResult(t, m, model.SensoryInput{Content: "Alice works at Acme Corp."}); res.Duplicate {
+		t.Errorf("a fallback vector matched a stored one: %+v", res)
+	}
+	res, err := m.ObserveResults(context.Background(), []model.SensoryInput{{Content: "Carol likes tea."}, {Content: "Carol likes green tea."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res[0].Duplicate || res[1].Duplicate {
+		t.Errorf("fallback vectors of one batch matched each other: %+v", res)
+	}
+
+	emb.fallback.Store(false)
+	if res := observeResult(t, m, model.SensoryInput{Content: "Alice works at Acme Corp."}); !res.Duplicate {
+		t.Errorf("primary vector did not match the stored one: %+v", res)
+	}
+}
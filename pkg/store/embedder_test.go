@@ -0,0 +1,82 @@
+package store_test
+
+import (
+	"context"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/store"
+)
+
+func embed(t *testing.T, h *store.HashEmbedder, text string) []float64 {
+	t.Helper()
+	v, err := h.EmbedText(context.Background(), text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func dot(a, b []float64) float64 {
+	var s float64
+	for i := range a {
+		s += a[i] * b[i]
+	}
+	return s
+}
+
+func TestHashEmbedderIsStable(t *testing.T) {
+	// vectors stored under HashEmbedderModel depend on these exact values;
+	// when they change, so must the model name
+	want := []float64{0.349578, 0.344421, 0.669001, 0.558218}
+	got := embed(t, store.NewHashEmbedder(4), "Alice works at Acme.")
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-6 {
+			t.Fatalf("EmbedText = %.6f, want %.6f", got, want)
+		}
+	}
+	if !slices.Equal(embed(t, store.NewHashEmbedder(4), ""), embed(t, store.NewHashEmbedder(4), "empty")) {
+		t.Error("empty text is not embedded as \"empty\"")
+	}
+}
+
+func TestHashEmbedderVectors(t *testing.T) {
+	h := store.NewHashEmbedder(1536)
+	a, b := embed(t, h, "Alice works at Acme."), embed(t, h, "Bob lives in Berlin.")
+	if len(a) != 1536 {
+		t.Fatalf("%d dimensions, want 1536", len(a))
+	}
+	if n := math.Sqrt(dot(a, a)); math.Abs(n-1) > 1e-9 {
+		t.Errorf("norm = %v, want a unit vector", n)
+	}
+	if c := dot(a, b); math.Abs(c) > 0.15 {
+		t.Errorf("cosine of unrelated texts = %v, want near 0", c)
+	}
+	// counter mode: later blocks of 16 dimensions do not repeat the first
+	for i := 16; i < len(a); i += 16 {
+		if slices.Equal(a[:16], a[i:i+16]) {
+			t.Fatalf("dimensions %d-%d repeat the first block", i, i+15)
+		}
+	}
+	if odd := embed(t, store.NewHashEmbedder(17), "x"); len(odd) != 17 || odd[16] == 0 {
+		t.Errorf("17-dimension vector = %v, want the last dimension filled", odd)
+	}
+	if n := len(embed(t, store.NewHashEmbedder(0), "x")); n != 1536 {
+		t.Errorf("default dimension = %d, want 1536", n)
+	}
+}
+
+func TestHashEmbedderSeed(t *testing.T) {
+	plain := embed(t, store.NewHashEmbedder(64), "Alice")
+	if !slices.Equal(plain, embed(t, store.NewHashEmbedderWithSeed(64, 0), "Alice")) {
+		t.Error("seed 0 differs from NewHashEmbedder")
+	}
+	seeded := embed(t, store.NewHashEmbedderWithSeed(64, 7), "Alice")
+	if slices.Equal(plain, seeded) {
+		t.Error("seed 7 embeds like seed 0")
+	}
+	if !slices.Equal(seeded, embed(t, store.NewHashEmbedderWithSeed(64, 7), "Alice")) {
+		t.Error("seeded vectors are not reproducible")
+	}
+}
@@ -0,0 +1,216 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+)
+
+const (
+	embedLease        = 2 * time.Minute
+	embedPollInterval = 5 * time.Second
+	embedBackoffBase  = time.Second
+	embedBackoffMax   = 10 * time.Minute
+)
+
+// VectorEnabled reports whether logs are embedded for vector search.
+func (m *MemoryEngine) VectorEnabled() bool {
+	return m.vec.Enabled() && m.embedder != nil
+}
+
+// StoresEmbeddings reports whether embeddings are kept in the embeddings
+// table (Options.StoreEmbeddings), with or without vector search.
+func (m *MemoryEngine) StoresEmbeddings() bool {
+	return m.storeEmbeddings && m.embedder != nil
+}
+
+// embeds reports whether logs are queued for embedding at all: for vector
+// search, for the embeddings table, or both.
+func (m *MemoryEngine) embeds() bool {
+	return m.VectorEnabled() || m.StoresEmbeddings()
+}
+
+// EmbeddingQueueDepth reports how many logs are waiting to be embedded.
+func (m *MemoryEngine) EmbeddingQueueDepth(ctx context.Context) (int64, error) {
+	return m.db.PendingEmbeddingCount(ctx)
+}
+
+// RetryPendingEmbeddings embeds up to limit due queued logs and returns how
+// many were indexed. It is meant for sync mode; in async mode the background
+// workers already drain the queue and this is a no-op.
+func (m *MemoryEngine) RetryPendingEmbeddings(ctx context.Context, limit int) (int, error) {
+	if !m.embeds() || !m.syncEmbedding || m.readOnly || m.breaker.openFor() > 0 {
+		return 0, nil
+	}
+	pending, err := m.db.ClaimEmbeddings(ctx, limit, embedLease)
+	if err != nil {
+		return 0, err
+	}
+	done := 0
+	for _, p := range pending {
+		if err := m.embedLog(ctx, p); err != nil {
+			m.logger.Warn("embedding retry failed", "log_id", p.LogID, "attempts", p.Attempts+1, "err", err)
+			continue
+		}
+		done++
+	}
+	return done, nil
+}
+
+// embedLog embeds content, stores the vector and dequeues the log. An
+// embedding the configured model already computed for the log is reused
+// from the embeddings table instead of calling the embedder again. Failures
+// are recorded on the queue entry with an exponential backoff, except for
+// ErrEmbedderUnavailable, which leaves the entry due without counting an
+// attempt.
+func (m *MemoryEngine) embedLog(ctx context.Context, p sqlite.PendingEmbedding) error {
+	emb, embModel, stored, err := m.embedding(ctx, p)
+	if err == nil && m.storeEmbeddings && !stored {
+		err = m.db.SaveEmbedding(ctx, p.LogID, embModel, emb)
+	}
+	if err == nil {
+		uctx, span := m.startSpan(ctx, "vector.upsert", attribute.Int("paim.dim", len(emb)))
+		err = m.vec.UpsertEmbedding(uctx, p.LogID, emb)
+		endSpan(span, err)
+	}
+	if errors.Is(err, ErrEmbedderUnavailable) {
+		// not an attempt: the log is handed back, not left leased, so it is
+		// due as soon as the breaker closes
+		m.releaseEmbeddings([]sqlite.PendingEmbedding{p})
+		return err
+	}
+	if err != nil {
+		retryAt := time.Now().Add(embedBackoff(p.Attempts))
+		if ferr := m.db.FailEmbedding(ctx, p.LogID, err, retryAt); ferr != nil {
+			m.logger.Error("record embedding failure", "log_id", p.LogID, "err", ferr)
+		}
+		return err
+	}
+	return m.db.CompleteEmbedding(ctx, p.LogID)
+}
+
+// embedding returns the embedding of a queued log, the model that computed
+// it and whether it came from the embeddings table. Stored vectors are only
+// reused when they were computed by the configured model and have the
+// configured dimension.
+func (m *MemoryEngine) embedding(ctx context.Context, p sqlite.PendingEmbedding) ([]float64, string, bool, error) {
+	if m.embedderModel != "" {
+		emb, err := m.db.StoredEmbedding(ctx, p.LogID, m.embedderModel)
+		if err != nil {
+			return nil, "", false, err
+		}
+		if emb != nil && len(emb) == m.db.VectorDim() {
+			return emb, m.embedderModel, true, nil
+		}
+	}
+	emb, embModel, err := m.embedText(ctx, p.Content)
+	return emb, embModel, false, err
+}
+
+func embedBackoff(attempts int) time.Duration {
+	d := embedBackoffBase
+	for i := 0; i < attempts && d < embedBackoffMax; i++ {
+		d *= 2
+	}
+	if d > embedBackoffMax {
+		d = embedBackoffMax
+	}
+	return d
+}
+
+func (m *MemoryEngine) notifyEmbedWorkers() {
+	select {
+	case m.embedNotify <- struct{}{}:
+	default:
+	}
+}
+
+// startEmbedWorkers launches a dispatcher that claims queued logs and n
+// workers that embed them. Pending rows left over from a previous run are
+// picked up on the first poll.
+func (m *MemoryEngine) startEmbedWorkers(n int) {
+	if n <= 0 {
+		n = 2
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.stopWorkers = cancel
+
+	jobs := make(chan sqlite.PendingEmbedding)
+	for i := 0; i < n; i++ {
+		m.workers.Add(1)
+		go func() {
+			defer m.workers.Done()
+			for p := range jobs {
+				err := m.embedLog(ctx, p)
+				switch {
+				case err == nil:
+				case ctx.Err() != nil:
+					// cut short by Close: hand the log back to the queue
+					// rather than leaving it leased
+					m.releaseEmbeddings([]sqlite.PendingEmbedding{p})
+				default:
+					m.logger.Warn("embedding failed", "log_id", p.LogID, "attempts", p.Attempts+1, "err", err)
+				}
+			}
+		}()
+	}
+
+	m.workers.Add(1)
+	go func() {
+		defer m.workers.Done()
+		defer close(jobs)
+		m.dispatchEmbeddings(ctx, jobs, n)
+	}()
+}
+
+func (m *MemoryEngine) dispatchEmbeddings(ctx context.Context, jobs chan<- sqlite.PendingEmbedding, batch int) {
+	for {
+		// claim nothing while the embedder breaker is open
+		if wait := m.breaker.openFor(); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			continue
+		}
+		claimed, err := m.db.ClaimEmbeddings(ctx, batch, embedLease)
+		if err != nil && ctx.Err() == nil {
+			m.logger.Error("claim pending embeddings", "err", err)
+		}
+		for i, p := range claimed {
+			select {
+			case jobs <- p:
+			case <-ctx.Done():
+				m.releaseEmbeddings(claimed[i:])
+				return
+			}
+		}
+		if len(claimed) > 0 {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.embedNotify:
+		case <-time.After(embedPollInterval):
+		}
+	}
+}
+
+// releaseEmbeddings returns claimed logs the workers did not get to when
+// they were stopped, so a restart can embed them without waiting for the
+// lease to expire.
+func (m *MemoryEngine) releaseEmbeddings(pending []sqlite.PendingEmbedding) {
+	ids := make([]string, len(pending))
+	for i, p := range pending {
+		ids[i] = p.LogID
+	}
+	if err := m.db.ReleaseEmbeddings(context.Background(), ids); err != nil {
+		m.logger.Error("release claimed embeddings", "logs", len(ids), "err", err)
+	}
+}
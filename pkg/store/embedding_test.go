@@ -0,0 +1,282 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+// flakyEmbedder fails every call for which fail returns true and embeds
+// the others with a HashEmbedder.
+type flakyEmbedder struct {
+	inner *store.HashEmbedder
+	fail  func(call int) bool
+
+	mu     sync.Mutex
+	calls  int
+	failed int
+}
+
+func newFlakyEmbedder(fail func(call int) bool) *flakyEmbedder {
+	return &flakyEmbedder{inner: store.NewHashEmbedder(64), fail: fail}
+}
+
+func (e *flakyEmbedder) EmbedText(ctx context.Context, text string) ([]float64, error) {
+	e.mu.Lock()
+	e.calls++
+	fail := e.fail(e.calls)
+	if fail {
+		e.failed++
+	}
+	e.mu.Unlock()
+	if fail {
+		return nil, errors.New("embedder unavailable")
+	}
+	return e.inner.EmbedText(ctx, text)
+}
+
+func (e *flakyEmbedder) failures() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.failed
+}
+
+func (e *flakyEmbedder) embedded() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.calls - e.failed
+}
+
+func queueDepth(t *testing.T, m *store.MemoryEngine) int64 {
+	t.Helper()
+	n, err := m.EmbeddingQueueDepth(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestObserveQueuesLogsTheEmbedderFailed(t *testing.T) {
+	ctx := context.Background()
+	emb := newFlakyEmbedder(func(call int) bool { return call%2 == 0 })
+	m := storetest.NewTestEngineWithOptions(t, store.Options{
+		Embedder:              emb,
+		VectorDim:             64,
+		StoreEmbeddings:       true,
+		SyncEmbedding:         true,
+		EmbedBreakerThreshold: -1,
+	})
+	for _, c := range []string{"one", "two", "three", "four", "five", "six"} {
+		if err := m.Observe(ctx, model.SensoryInput{Content: c}); err != nil {
+			t.Fatalf("Observe(%q) failed with the embedder: %v", c, err)
+		}
+	}
+	st, err := m.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Logs != 6 {
+		t.Fatalf("%d logs stored, want 6", st.Logs)
+	}
+	// every log is either embedded or still queued
+	if depth := queueDepth(t, m); depth != int64(emb.failures()) || depth == 0 {
+		t.Fatalf("queue depth %d, want the %d failed embeddings", depth, emb.failures())
+	}
+}
+
+func TestBreakerStopsCallingAFailingEmbedder(t *testing.T) {
+	ctx := context.Background()
+	// retries are scheduled in whole seconds; start at the top of one so
+	// the failed logs are not due again before the test ends
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	var down atomic.Bool
+	down.Store(true)
+	emb := newFlakyEmbedder(func(int) bool { return down.Load() })
+	m := storetest.NewTestEngineWithOptions(t, store.Options{
+		Embedder:              emb,
+		VectorDim:             64,
+		StoreEmbeddings:       true,
+		SyncEmbedding:         true,
+		EmbedBreakerThreshold: 2,
+		EmbedBreakerCooldown:  50 * time.Millisecond,
+		ConsolidateFillRatio:  -1,
+	})
+	if _, err := m.ObserveBatch(ctx, []model.SensoryInput{{Content: "one"}, {Content: "two"}, {Content: "three"}, {Content: "four"}}); err != nil {
+		t.Fatalf("ObserveBatch with the embedder down: %v", err)
+	}
+	if n := emb.failures(); n != 2 {
+		t.Errorf("embedder called %d times, want 2 before the breaker opened", n)
+	}
+	if depth := queueDepth(t, m); depth != 4 {
+		t.Errorf("queue depth %d, want all 4 logs queued", depth)
+	}
+	st, err := m.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.EmbedderBreaker != store.BreakerOpen || st.EmbedderFailures != 2 {
+		t.Errorf("breaker %s with %d failures, want open with 2", st.EmbedderBreaker, st.EmbedderFailures)
+	}
+	if err := m.Observe(ctx, model.SensoryInput{Content: "five"}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := m.RetryPendingEmbeddings(ctx, 10); err != nil || n != 0 {
+		t.Errorf("RetryPendingEmbeddings while open = %d, %v", n, err)
+	}
+	if n := emb.failures(); n != 2 {
+		t.Errorf("open breaker let %d more calls through", n-2)
+	}
+
+	// after the cooldown one probe goes through; it fails and the other
+	// logs claimed with it are refused
+	time.Sleep(60 * time.Millisecond)
+	if n, err := m.RetryPendingEmbeddings(ctx, 10); err != nil || n != 0 {
+		t.Errorf("RetryPendingEmbeddings with a failing probe = %d, %v", n, err)
+	}
+	if n := emb.failures(); n != 3 {
+		t.Errorf("%d embedder failures after the probe, want 3", n)
+	}
+
+	// the refused logs were handed back rather than left leased, so the
+	// next probe reaches the recovered embedder and they are embedded; the
+	// three failed logs are still backing off
+	down.Store(false)
+	time.Sleep(60 * time.Millisecond)
+	if n, err := m.RetryPendingEmbeddings(ctx, 10); err != nil || n != 2 {
+		t.Errorf("RetryPendingEmbeddings after recovering = %d, %v; want the 2 refused", n, err)
+	}
+	st, err = m.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.EmbedderBreaker != store.BreakerClosed || st.EmbedderFailures != 0 {
+		t.Errorf("breaker %s with %d failures after recovering, want closed with 0", st.EmbedderBreaker, st.EmbedderFailures)
+	}
+}
+
+func TestObserveRejectedInputLeavesNothingQueued(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngineWithOptions(t, store.Options{
+		Embedder:        newFlakyEmbedder(func(int) bool { return false }),
+		VectorDim:       64,
+		StoreEmbeddings: true,
+		SyncEmbedding:   true,
+	})
+	_, err := m.ObserveBatch(ctx, []model.SensoryInput{{Content: "fine"}, {Content: "  "}})
+	if !errors.Is(err, store.ErrInvalidInput) {
+		t.Fatalf("ObserveBatch = %v, want ErrInvalidInput", err)
+	}
+	st, err := m.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Logs != 0 || st.PendingEmbeddings != 0 {
+		t.Fatalf("%d logs and %d queued after a rejected batch", st.Logs, st.PendingEmbeddings)
+	}
+}
+
+func TestQueuedEmbeddingsSurviveRestart(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "paim.db")
+	down := newFlakyEmbedder(func(int) bool { return true })
+	m := storetest.NewTestEngineWithOptions(t, store.Options{
+		DBPath:                path,
+		Embedder:              down,
+		VectorDim:             64,
+		StoreEmbeddings:       true,
+		EmbedBreakerThreshold: -1,
+	})
+	for _, c := range []string{"one", "two", "three"} {
+		if err := m.Observe(ctx, model.SensoryInput{Content: c}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if depth := queueDepth(t, m); depth != 3 {
+		t.Fatalf("queue depth %d before restart, want 3", depth)
+	}
+	// the workers are stopped without having embedded anything, as when
+	// the process dies
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	up := newFlakyEmbedder(func(int) bool { return false })
+	m = storetest.NewTestEngineWithOptions(t, store.Options{
+		DBPath:          path,
+		Embedder:        up,
+		VectorDim:       64,
+		StoreEmbeddings: true,
+	})
+	// failed attempts back off for a second before they are due again, and
+	// logs claimed when the first engine stopped were handed back
+	deadline := time.Now().Add(10 * time.Second)
+	for queueDepth(t, m) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue depth %d after restart, want 0", queueDepth(t, m))
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if n := up.embedded(); n != 3 {
+		t.Errorf("restarted engine embedded %d logs, want the 3 queued", n)
+	}
+}
+
+func TestStoredEmbeddingsWithoutVectorSearch(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "paim.db")
+	emb := newFlakyEmbedder(func(int) bool { return false })
+	opt := store.Options{
+		DBPath:          path,
+		Embedder:        emb,
+		EmbedderModel:   "m1",
+		VectorDim:       64,
+		StoreEmbeddings: true,
+		SyncEmbedding:   true,
+	}
+	m := storetest.NewTestEngineWithOptions(t, opt)
+	if m.VectorEnabled() || !m.StoresEmbeddings() {
+		t.Fatalf("vector search %v, stored embeddings %v; want only stored embeddings", m.VectorEnabled(), m.StoresEmbeddings())
+	}
+	for _, c := range []string{"one", "two"} {
+		if err := m.Observe(ctx, model.SensoryInput{Content: c}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, depth := emb.embedded(), queueDepth(t, m); n != 2 || depth != 0 {
+		t.Fatalf("embedded %d logs with %d queued, want 2 and none", n, depth)
+	}
+
+	// the same model's embeddings are reused rather than recomputed
+	report, err := m.Reindex(ctx, store.ReindexOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Embedded != 2 || emb.embedded() != 2 {
+		t.Errorf("reindex embedded %d logs with %d embedder calls, want 2 from storage", report.Embedded, emb.embedded())
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	opt.EmbedderModel = "m2"
+	m = storetest.NewTestEngineWithOptions(t, opt)
+	if _, err := m.Reindex(ctx, store.ReindexOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := emb.embedded(); n != 4 {
+		t.Errorf("%d embedder calls after switching models, want 4", n)
+	}
+
+	off := storetest.NewTestEngine(t)
+	if _, err := off.Reindex(ctx, store.ReindexOptions{}); !errors.Is(err, store.ErrInvalidInput) {
+		t.Errorf("Reindex without vector search or stored embeddings: %v, want ErrInvalidInput", err)
+	}
+}
@@ -0,0 +1,195 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store/graph"
+)
+
+// EventType names what an Event reports.
+type EventType string
+
+const (
+	// EventMemoryObserved is published for each log stored by Observe or
+	// ObserveBatch.
+	EventMemoryObserved EventType = "memory_observed"
+	// EventMemoryUpdated is published for each log edited by UpdateLog.
+	EventMemoryUpdated EventType = "memory_updated"
+	// EventFactsConsolidated is published when Consolidate writes triples.
+	EventFactsConsolidated EventType = "facts_consolidated"
+)
+
+// Event is one entry of the engine's live feed.
+type Event struct {
+	// ID increases by one per event within a process, across namespaces.
+	ID   uint64    `json:"id"`
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+	// Namespace is the namespace of the log or facts reported.
+	Namespace string `json:"namespace"`
+	// Log is the stored log of an EventMemoryObserved or
+	// EventMemoryUpdated.
+	Log *model.LogEntry `json:"log,omitempty"`
+	// Facts are the triples, with their ids, of an EventFactsConsolidated.
+	Facts []model.Triple `json:"facts,omitempty"`
+}
+
+const (
+	// subscriberBuffer is how many events a subscriber may fall behind
+	// before further events are dropped for it.
+	subscriberBuffer = 64
+	// eventHistory is how many recent events SubscribeSince can replay.
+	eventHistory = 256
+)
+
+// eventBus fans events out to subscribers. Publishing never blocks: a
+// subscriber whose buffer is full misses the event.
+type eventBus struct {
+	mu     sync.Mutex
+	nextID uint64
+	// subs maps each subscriber to its namespace; "" receives all.
+	subs    map[chan Event]string
+	history []Event
+	closed  bool
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{nextID: 1, subs: make(map[chan Event]string)}
+}
+
+func (b *eventBus) publish(ev Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	ev.ID = b.nextID
+	b.nextID++
+	if len(b.history) == eventHistory {
+		copy(b.history, b.history[1:])
+		b.history = b.history[:eventHistory-1]
+	}
+	b.history = append(b.history, ev)
+	for ch, ns := range b.subs {
+		if ns != "" && ns != ev.Namespace {
+			continue
+		}
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+func (b *eventBus) subscribe(ctx context.Context, namespace string, after uint64, replay bool) <-chan Event {
+	ch := make(chan Event, subscriberBuffer)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return ch
+	}
+	if replay {
+		for _, ev := range b.history {
+			if ev.ID > after && (namespace == "" || ev.Namespace == namespace) && len(ch) < cap(ch) {
+				ch <- ev
+			}
+		}
+	}
+	b.subs[ch] = namespace
+	context.AfterFunc(ctx, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	})
+	return ch
+}
+
+func (b *eventBus) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+// Subscribe returns a channel of the events of namespace published from now
+// on; an empty namespace receives the events of every namespace. The channel
+// is closed when ctx is done or the engine is closed. Events are dropped for
+// a subscriber that falls more than a few dozen events behind rather than
+// slowing down writes.
+func (m *MemoryEngine) Subscribe(ctx context.Context, namespace string) <-chan Event {
+	return m.events.subscribe(ctx, namespace, 0, false)
+}
+
+// SubscribeSince is Subscribe preceded by the recent events with an ID above
+// lastID, as far as they are still held. It lets a reconnecting client
+// resume where it stopped; older events are not replayed.
+func (m *MemoryEngine) SubscribeSince(ctx context.Context, namespace string, lastID uint64) <-chan Event {
+	return m.events.subscribe(ctx, namespace, lastID, true)
+}
+
+func (m *MemoryEngine) publishObserved(inputs []model.SensoryInput) {
+	now := time.Now().UTC()
+	for _, in := range inputs {
+		ts := now
+		if !in.Timestamp.IsZero() {
+			ts = in.Timestamp.UTC().Truncate(time.Second)
+		}
+		m.events.publish(Event{
+			Type:      EventMemoryObserved,
+			Time:      now,
+			Namespace: in.Namespace,
+			Log: &model.LogEntry{
+				ID:         in.LogID,
+				Timestamp:  ts,
+				SourceType: in.Source,
+				Content:    in.Content,
+				Metadata:   in.Metadata,
+				Namespace:  in.Namespace,
+				SessionID:  in.SessionID,
+			},
+		})
+	}
+}
+
+// publishConsolidated reports the stored form of the triples Consolidate
+// wrote, so counts and timestamps reflect earlier observations too. Each
+// namespace gets its own event.
+func (m *MemoryEngine) publishConsolidated(ctx context.Context, triples []model.Triple, results []graph.UpsertResult) {
+	if len(triples) == 0 {
+		return
+	}
+	var namespaces []string
+	facts := make(map[string][]model.Triple)
+	seen := make(map[int64]bool, len(results))
+	for i, r := range results {
+		if seen[r.ID] {
+			continue
+		}
+		seen[r.ID] = true
+		t, err := m.graph.GetTriple(ctx, r.ID)
+		if err != nil {
+			m.logger.Debug("event uses distilled triple", "id", r.ID, "err", err)
+			d := triples[i]
+			d.ID = r.ID
+			t = &d
+		}
+		if _, ok := facts[t.Namespace]; !ok {
+			namespaces = append(namespaces, t.Namespace)
+		}
+		facts[t.Namespace] = append(facts[t.Namespace], *t)
+	}
+	now := time.Now().UTC()
+	for _, ns := range namespaces {
+		m.events.publish(Event{Type: EventFactsConsolidated, Time: now, Namespace: ns, Facts: facts[ns]})
+	}
+}
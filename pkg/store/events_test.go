@@ -0,0 +1,126 @@
+package store_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+// next returns the next event on ch, failing the test after a second.
+func next(t *testing.T, ch <-chan store.Event) store.Event {
+	t.Helper()
+	select {
+	case ev, ok := <-ch:
+		if !ok {
+			t.Fatal("event channel closed")
+		}
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("no event within a second")
+		return store.Event{}
+	}
+}
+
+func TestSubscribersReceiveEveryEvent(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngine(t)
+	a, b := m.Subscribe(ctx, ""), m.Subscribe(ctx, "")
+	observeAll(t, m, "Alice works at Acme.")
+	if err := m.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for name, ch := range map[string]<-chan store.Event{"a": a, "b": b} {
+		observed, consolidated := next(t, ch), next(t, ch)
+		if observed.Type != store.EventMemoryObserved || observed.Log == nil || observed.Log.Content != "Alice works at Acme." {
+			t.Errorf("subscriber %s: first event %+v, want the observed log", name, observed)
+		}
+		if consolidated.Type != store.EventFactsConsolidated || len(consolidated.Facts) == 0 || consolidated.Facts[0].ID == 0 {
+			t.Errorf("subscriber %s: second event %+v, want the stored facts", name, consolidated)
+		}
+		if consolidated.ID != observed.ID+1 {
+			t.Errorf("subscriber %s: ids %d then %d, want consecutive", name, observed.ID, consolidated.ID)
+		}
+	}
+}
+
+func TestSlowSubscriberMissesEvents(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngine(t)
+	slow := m.Subscribe(ctx, "")
+	reading := m.Subscribe(ctx, "")
+	// the stalled subscriber must not hold up Observe nor the subscriber
+	// that keeps reading
+	const n = 100
+	for i := 0; i < n; i++ {
+		content := fmt.Sprintf("memory %d", i)
+		if err := m.Observe(ctx, model.SensoryInput{Content: content}); err != nil {
+			t.Fatal(err)
+		}
+		if ev := next(t, reading); ev.Log.Content != content {
+			t.Fatalf("reading subscriber got %q, want %q", ev.Log.Content, content)
+		}
+	}
+	if l, c := len(slow), cap(slow); l != c || l >= n {
+		t.Errorf("stalled subscriber holds %d events, want its buffer of %d", l, c)
+	}
+	if ev := next(t, slow); ev.Log.Content != "memory 0" {
+		t.Errorf("stalled subscriber resumes at %q, want the oldest buffered event", ev.Log.Content)
+	}
+}
+
+func TestSubscribeNamespaceAndReplay(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngine(t)
+	work := m.Subscribe(ctx, "work")
+	for _, in := range []model.SensoryInput{
+		{Content: "home one"},
+		{Content: "work one", Namespace: "work"},
+		{Content: "work two", Namespace: "work"},
+	} {
+		if err := m.Observe(ctx, in); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first := next(t, work)
+	if first.Log.Content != "work one" || next(t, work).Log.Content != "work two" {
+		t.Errorf("work subscriber got %q first, want only work events", first.Log.Content)
+	}
+
+	replay := m.SubscribeSince(ctx, "work", first.ID)
+	if ev := next(t, replay); ev.Log.Content != "work two" {
+		t.Errorf("replay after %d started at %q, want work two", first.ID, ev.Log.Content)
+	}
+	select {
+	case ev := <-replay:
+		t.Errorf("unexpected replayed event %+v", ev)
+	default:
+	}
+}
+
+func TestSubscriptionEnds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := storetest.NewTestEngine(t)
+	ch := m.Subscribe(ctx, "")
+	cancel()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Error("received an event after cancelling")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed after the context was cancelled")
+	}
+
+	open := m.Subscribe(context.Background(), "")
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-open; ok {
+		t.Error("channel still open after Close")
+	}
+}
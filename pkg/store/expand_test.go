@@ -0,0 +1,65 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+func assertChain(t *testing.T, m *store.MemoryEngine) {
+	t.Helper()
+	assert(t, m, "work",
+		model.Triple{Subject: "alice", Predicate: "works_at", Object: "acme"},
+		model.Triple{Subject: "acme", Predicate: "located_in", Object: "berlin"},
+		model.Triple{Subject: "acme", Predicate: "makes", Object: "rockets"},
+		model.Triple{Subject: "berlin", Predicate: "part_of", Object: "germany"},
+		model.Triple{Subject: "bob", Predicate: "likes", Object: "tea"},
+	)
+	assert(t, m, "home", model.Triple{Subject: "acme", Predicate: "located_in", Object: "paris"})
+}
+
+func hops(facts []model.Triple) map[string]int {
+	out := make(map[string]int)
+	for _, f := range facts {
+		out[f.Subject+" "+f.Predicate+" "+f.Object] = f.Hop
+	}
+	return out
+}
+
+func TestRecallAddsOneHopNeighbours(t *testing.T) {
+	m := storetest.NewTestEngine(t)
+	assertChain(t, m)
+
+	got := hops(recall(t, m, "alice", model.RecallOptions{Namespace: "work"}).RelatedFacts)
+	want := map[string]int{
+		"alice works_at acme":    0,
+		"acme located_in berlin": 1,
+		"acme makes rockets":     1,
+	}
+	if len(got) != len(want) {
+		t.Errorf("facts = %v, want %v", got, want)
+	}
+	for f, hop := range want {
+		if h, ok := got[f]; !ok || h != hop {
+			t.Errorf("fact %q: hop %d (present %v), want %d", f, h, ok, hop)
+		}
+	}
+}
+
+func TestNeighbourExpansionIsBounded(t *testing.T) {
+	m := storetest.NewTestEngine(t)
+	assertChain(t, m)
+	got := hops(recall(t, m, "alice", model.RecallOptions{Namespace: "work", TopK: 1}).RelatedFacts)
+	if len(got) != 2 || got["alice works_at acme"] != 0 {
+		t.Errorf("facts for top 1 = %v, want alice's fact and one neighbour", got)
+	}
+
+	off := storetest.NewTestEngineWithOptions(t, store.Options{NeighborExpansion: -1})
+	assertChain(t, off)
+	got = hops(recall(t, off, "alice", model.RecallOptions{Namespace: "work"}).RelatedFacts)
+	if len(got) != 1 {
+		t.Errorf("facts with expansion disabled = %v, want alice's fact only", got)
+	}
+}
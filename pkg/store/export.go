@@ -0,0 +1,188 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store/graph"
+)
+
+// ExportVersion identifies the document format written by Export.
+const ExportVersion = 1
+
+// ExportDocument is the JSON document produced by Export and read by Import.
+type ExportDocument struct {
+	Version int              `json:"version"`
+	Logs    []model.LogEntry `json:"logs"`
+	Facts   []model.Triple   `json:"facts"`
+}
+
+// ImportReport counts what Import added; existing logs and facts are skipped
+// or reinforced rather than counted.
+type ImportReport struct {
+	Logs  int64 `json:"logs"`
+	Facts int64 `json:"facts"`
+}
+
+// ExportGraph streams the facts of opts.Namespace as a graph document; see
+// graph.Store.Export.
+func (m *MemoryEngine) ExportGraph(ctx context.Context, w io.Writer, format graph.ExportFormat, opts graph.ExportOptions) error {
+	namespace, err := NormalizeNamespace(opts.Namespace)
+	if err != nil {
+		return err
+	}
+	if _, err := graph.ParseExportFormat(string(format)); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	if opts.MinConfidence < 0 || opts.MinConfidence > 1 {
+		return fmt.Errorf("%w: min confidence must be within [0, 1]", ErrInvalidInput)
+	}
+	if opts.MaxNodes < 0 {
+		return fmt.Errorf("%w: max nodes must not be negative", ErrInvalidInput)
+	}
+	opts.Namespace = namespace
+	return m.graph.Export(ctx, w, format, opts)
+}
+
+// Export streams every log and fact of every namespace, with provenance and
+// namespace, as an ExportDocument.
+func (m *MemoryEngine) Export(ctx context.Context, w io.Writer) error {
+	if _, err := fmt.Fprintf(w, `{"version":%d,"logs":[`, ExportVersion); err != nil {
+		return err
+	}
+	first := true
+	sep := func() error {
+		if first {
+			first = false
+			return nil
+		}
+		_, err := io.WriteString(w, ",")
+		return err
+	}
+	writeItem := func(v any) error {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if err := sep(); err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+
+	if err := m.db.EachLog(ctx, func(e model.LogEntry) error { return writeItem(e) }); err != nil {
+		return fmt.Errorf("export logs: %w", err)
+	}
+	if _, err := io.WriteString(w, `],"facts":[`); err != nil {
+		return err
+	}
+	first = true
+	params := graph.ListParams{Limit: 500}
+	for {
+		page, err := m.graph.ListTriples(ctx, params)
+		if err != nil {
+			return fmt.Errorf("export facts: %w", err)
+		}
+		ids := make([]int64, len(page.Triples))
+		for i, t := range page.Triples {
+			ids[i] = t.ID
+		}
+		sources, err := m.graph.SourcesOf(ctx, ids)
+		if err != nil {
+			return fmt.Errorf("export facts: %w", err)
+		}
+		for _, t := range page.Triples {
+			t.Sources = sources[t.ID]
+			if err := writeItem(t); err != nil {
+				return err
+			}
+		}
+		if page.NextCursor == 0 {
+			break
+		}
+		params.Cursor = page.NextCursor
+	}
+	_, err := io.WriteString(w, "]}\n")
+	return err
+}
+
+// Import loads an ExportDocument. Logs keep their ids and timestamps and are
+// skipped if already present; facts are upserted under their original
+// labels, so re-importing reinforces rather than duplicates them. Fact
+// sources are kept only for logs contained in the document. Logs and facts
+// keep their namespace; those without one go to the default namespace.
+func (m *MemoryEngine) Import(ctx context.Context, r io.Reader) (ImportReport, error) {
+	var report ImportReport
+	if m.readOnly {
+		return report, ErrReadOnly
+	}
+	var doc ExportDocument
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return report, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	if doc.Version != ExportVersion {
+		return report, fmt.Errorf("%w: unsupported export version %d", ErrInvalidInput, doc.Version)
+	}
+
+	known := make(map[string]bool, len(doc.Logs))
+	for i, e := range doc.Logs {
+		if e.ID == "" || e.Content == "" {
+			return report, fmt.Errorf("%w: logs need an id and content", ErrInvalidInput)
+		}
+		ns, err := NormalizeNamespace(e.Namespace)
+		if err != nil {
+			return report, fmt.Errorf("log %s: %w", e.ID, err)
+		}
+		doc.Logs[i].Namespace = ns
+		in, err := m.redact(ctx, model.SensoryInput{Content: e.Content, Source: e.SourceType, Metadata: e.Metadata, Namespace: ns})
+		if err != nil {
+			return report, fmt.Errorf("log %s: %w", e.ID, err)
+		}
+		doc.Logs[i].Content, doc.Logs[i].Metadata = in.Content, in.Metadata
+		known[e.ID] = true
+	}
+	var err error
+	if report.Logs, err = m.db.ImportLogs(ctx, doc.Logs, m.embeds()); err != nil {
+		return report, fmt.Errorf("import logs: %w", err)
+	}
+	if report.Logs > 0 && m.embeds() && !m.syncEmbedding {
+		m.notifyEmbedWorkers()
+	}
+
+	facts := make([]model.Triple, 0, len(doc.Facts))
+	for _, t := range doc.Facts {
+		if t.SubjectLabel != "" {
+			t.Subject = t.SubjectLabel
+		}
+		if t.ObjectLabel != "" {
+			t.Object = t.ObjectLabel
+		}
+		ns, err := NormalizeNamespace(t.Namespace)
+		if err != nil {
+			return report, fmt.Errorf("fact %d: %w", t.ID, err)
+		}
+		t.Namespace = ns
+		var sources []string
+		for _, id := range t.Sources {
+			if known[id] {
+				sources = append(sources, id)
+			}
+		}
+		t.Sources = sources
+		facts = append(facts, t)
+	}
+	results, err := m.graph.UpsertTriples(ctx, facts)
+	if err != nil {
+		return report, fmt.Errorf("import facts: %w", err)
+	}
+	for _, res := range results {
+		if res.Inserted {
+			report.Facts++
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,75 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/graph"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+func assert(t *testing.T, m *store.MemoryEngine, namespace string, triples ...model.Triple) {
+	t.Helper()
+	for i := range triples {
+		triples[i].Namespace = namespace
+		triples[i].Confidence = 0.8
+	}
+	if _, err := m.Assert(context.Background(), triples); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func namespaceFacts(t *testing.T, m *store.MemoryEngine, namespace string) int {
+	t.Helper()
+	res, err := m.ListFacts(context.Background(), graph.ListParams{Namespace: namespace, Limit: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(res.Triples)
+}
+
+func TestDeleteFactsNeedsAllToWipeANamespace(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngine(t)
+	assert(t, m, "work", model.Triple{Subject: "alice", Predicate: "works_at", Object: "acme"})
+	assert(t, m, "home", model.Triple{Subject: "alice", Predicate: "lives_in", Object: "berlin"})
+
+	if _, err := m.DeleteFacts(ctx, "work", "", "", "", false); !errors.Is(err, store.ErrInvalidInput) {
+		t.Fatalf("DeleteFacts with no filter = %v, want ErrInvalidInput", err)
+	}
+	if n := namespaceFacts(t, m, "work"); n != 1 {
+		t.Fatalf("%d facts left in work after a refused delete, want 1", n)
+	}
+
+	n, err := m.DeleteFacts(ctx, "work", "", "", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || namespaceFacts(t, m, "work") != 0 {
+		t.Fatalf("DeleteFacts(all) removed %d, want the one work fact", n)
+	}
+	if n := namespaceFacts(t, m, "home"); n != 1 {
+		t.Fatalf("%d facts left in home, want 1", n)
+	}
+}
+
+func TestDeleteFactsStaysInItsNamespace(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngine(t)
+	assert(t, m, "work", model.Triple{Subject: "alice", Predicate: "likes", Object: "tea"})
+	assert(t, m, "home", model.Triple{Subject: "alice", Predicate: "likes", Object: "tea"})
+
+	n, err := m.DeleteFacts(ctx, "work", "alice", "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("DeleteFacts removed %d, want 1", n)
+	}
+	if n := namespaceFacts(t, m, "home"); n != 1 {
+		t.Fatalf("%d facts left in home, want 1", n)
+	}
+}
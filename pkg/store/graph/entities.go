@@ -0,0 +1,263 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// ErrInvalidAlias is returned by AddAlias for empty or self-referencing aliases.
+var ErrInvalidAlias = errors.New("invalid alias")
+
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// NormalizeEntity trims an entity, collapses internal whitespace and
+// case-folds it, so "Alice", "alice" and "Alice " map to the same node.
+func NormalizeEntity(e string) string {
+	return strings.ToLower(strings.Join(strings.Fields(e), " "))
+}
+
+func (s *Store) normalizeEntity(e string) string {
+	if !s.normalize {
+		return strings.TrimSpace(e)
+	}
+	return NormalizeEntity(e)
+}
+
+// resolve maps an entity to its canonical form: normalization followed by a
+// lookup of the aliases of namespace, "default" when empty. Empty input
+// stays empty so it can act as a wildcard.
+func (s *Store) resolve(ctx context.Context, q querier, namespace, entity string) (string, error) {
+	entity = s.normalizeEntity(entity)
+	if entity == "" {
+		return "", nil
+	}
+	var canonical string
+	err := q.QueryRowContext(ctx, `SELECT canonical FROM entity_aliases WHERE namespace = ? AND alias = ?;`,
+		aliasNamespace(namespace), entity).Scan(&canonical)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return canonical, nil
+}
+
+// aliasNamespace is the namespace whose aliases apply to namespace: lookups
+// across every namespace use those of "default".
+func aliasNamespace(namespace string) string {
+	if namespace == "" {
+		return model.DefaultNamespace
+	}
+	return namespace
+}
+
+// AddAlias makes alias resolve to canonical for writes and lookups in
+// namespace ("default" when empty), and merges triples of namespace already
+// stored under the alias into the canonical entity. Other namespaces are
+// left untouched.
+func (s *Store) AddAlias(ctx context.Context, namespace, alias, canonical string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	namespace = aliasNamespace(namespace)
+	a := s.normalizeEntity(alias)
+	c, err := s.resolve(ctx, tx, namespace, canonical)
+	if err != nil {
+		return err
+	}
+	if a == "" || c == "" {
+		return fmt.Errorf("%w: alias and canonical are required", ErrInvalidAlias)
+	}
+	if a == c {
+		return fmt.Errorf("%w: alias resolves to itself", ErrInvalidAlias)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+        INSERT INTO entity_aliases(namespace, alias, canonical) VALUES (?, ?, ?)
+        ON CONFLICT(namespace, alias) DO UPDATE SET canonical = excluded.canonical;
+    `, namespace, a, c); err != nil {
+		return err
+	}
+	// keep aliases flat: anything that pointed at the alias now points at c
+	if _, err := tx.ExecContext(ctx, `UPDATE entity_aliases SET canonical = ? WHERE namespace = ? AND canonical = ?;`, c, namespace, a); err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+        SELECT id, namespace, subject, predicate, object FROM triples
+        WHERE namespace = ? AND (subject = ? OR object = ?);
+    `, namespace, a, a)
+	if err != nil {
+		return err
+	}
+	targets, err := collectRewrites(rows, func(_, e string) string {
+		if e == a {
+			return c
+		}
+		return e
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := rewriteTriples(ctx, tx, targets); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// NormalizeExisting rewrites triples stored before normalization (or before
+// an alias existed) into canonical form, merging rows that collapse onto the
+// same subject/predicate/object: confidence keeps the maximum, observation
+// counts are summed and provenance links are carried over. It returns the
+// number of rows merged away. Only triples without labels, which builds that
+// did not normalize wrote, are examined; they are labelled once done, so the
+// rewrite happens once per row rather than on every open.
+func (s *Store) NormalizeExisting(ctx context.Context) (int64, error) {
+	if !s.normalize {
+		return 0, nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// aliases by namespace, then alias
+	aliases := make(map[string]map[string]string)
+	arows, err := tx.QueryContext(ctx, `SELECT namespace, alias, canonical FROM entity_aliases;`)
+	if err != nil {
+		return 0, err
+	}
+	for arows.Next() {
+		var ns, a, c string
+		if err := arows.Scan(&ns, &a, &c); err != nil {
+			arows.Close()
+			return 0, err
+		}
+		if aliases[ns] == nil {
+			aliases[ns] = make(map[string]string)
+		}
+		aliases[ns][a] = c
+	}
+	if err := arows.Close(); err != nil {
+		return 0, err
+	}
+
+	// SQLite's lower() only folds ASCII, so rows with non-ASCII characters are
+	// always re-checked in Go.
+	rows, err := tx.QueryContext(ctx, `
+        SELECT id, namespace, subject, predicate, object FROM triples
+        WHERE (subject_label IS NULL OR object_label IS NULL)
+          AND (subject <> lower(trim(subject)) OR object <> lower(trim(object))
+           OR subject GLOB '*[^ -~]*' OR object GLOB '*[^ -~]*'
+           OR subject GLOB '*  *' OR object GLOB '*  *'
+           OR subject IN (SELECT alias FROM entity_aliases a WHERE a.namespace = triples.namespace)
+           OR object IN (SELECT alias FROM entity_aliases a WHERE a.namespace = triples.namespace));
+    `)
+	if err != nil {
+		return 0, err
+	}
+	targets, err := collectRewrites(rows, func(namespace, e string) string {
+		e = NormalizeEntity(e)
+		if c, ok := aliases[namespace][e]; ok {
+			return c
+		}
+		return e
+	})
+	if err != nil {
+		return 0, err
+	}
+	merged, err := rewriteTriples(ctx, tx, targets)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+        UPDATE triples SET
+            subject_label = COALESCE(subject_label, subject),
+            object_label = COALESCE(object_label, object)
+        WHERE subject_label IS NULL OR object_label IS NULL;
+    `); err != nil {
+		return 0, err
+	}
+	return merged, tx.Commit()
+}
+
+type rewrite struct {
+	id                    int64
+	namespace, predicate  string
+	subject, object       string
+	newSubject, newObject string
+}
+
+// collectRewrites reads triples and maps their subject and object, given
+// with the triple's namespace, keeping those that change.
+func collectRewrites(rows *sql.Rows, mapEntity func(namespace, entity string) string) ([]rewrite, error) {
+	defer rows.Close()
+	var out []rewrite
+	for rows.Next() {
+		var r rewrite
+		if err := rows.Scan(&r.id, &r.namespace, &r.subject, &r.predicate, &r.object); err != nil {
+			return nil, err
+		}
+		r.newSubject, r.newObject = mapEntity(r.namespace, r.subject), mapEntity(r.namespace, r.object)
+		if r.newSubject != r.subject || r.newObject != r.object {
+			out = append(out, r)
+		}
+	}
+	return out, rows.Err()
+}
+
+func rewriteTriples(ctx context.Context, tx *sql.Tx, targets []rewrite) (int64, error) {
+	var merged int64
+	for _, r := range targets {
+		var existing int64
+		err := tx.QueryRowContext(ctx, `
+            SELECT id FROM triples
+            WHERE namespace = ? AND subject = ? AND predicate = ? AND object = ? AND id <> ?;
+        `, r.namespace, r.newSubject, r.predicate, r.newObject, r.id).Scan(&existing)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			if _, err := tx.ExecContext(ctx, `
+                UPDATE triples SET subject = ?, object = ?,
+                    subject_label = COALESCE(subject_label, subject),
+                    object_label = COALESCE(object_label, object)
+                WHERE id = ?;
+            `, r.newSubject, r.newObject, r.id); err != nil {
+				return 0, err
+			}
+		case err != nil:
+			return 0, err
+		default:
+			if _, err := tx.ExecContext(ctx, `
+                UPDATE triples SET
+                    confidence = MAX(confidence, (SELECT confidence FROM triples WHERE id = ?)),
+                    observation_count = observation_count + (SELECT observation_count FROM triples WHERE id = ?)
+                WHERE id = ?;
+            `, r.id, r.id, existing); err != nil {
+				return 0, err
+			}
+			if _, err := tx.ExecContext(ctx, `
+                INSERT OR IGNORE INTO triple_sources(triple_id, log_id)
+                SELECT ?, log_id FROM triple_sources WHERE triple_id = ?;
+            `, existing, r.id); err != nil {
+				return 0, err
+			}
+			if _, err := tx.ExecContext(ctx, `DELETE FROM triples WHERE id = ?;`, r.id); err != nil {
+				return 0, err
+			}
+			merged++
+		}
+	}
+	return merged, nil
+}
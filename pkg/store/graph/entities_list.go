@@ -0,0 +1,80 @@
+package graph
+
+import (
+	"context"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+)
+
+// EntityInfo describes one entity and how it is used in the graph.
+type EntityInfo struct {
+	Entity    string    `json:"entity"`
+	AsSubject int64     `json:"as_subject"`
+	AsObject  int64     `json:"as_object"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// ListEntities returns distinct subjects and objects of namespace (every
+// namespace when empty) starting with prefix, ordered by name, with their
+// edge counts over current triples, like Neighbors, and newest triple time.
+// Entities only superseded triples mention are not listed. With
+// normalization enabled the prefix is normalized too, so matching is
+// case-insensitive. The prefix is matched as a range so idx_subject and
+// idx_object can serve it.
+func (s *Store) ListEntities(ctx context.Context, namespace, prefix string, limit, offset int) ([]EntityInfo, error) {
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	if s.normalize {
+		prefix = NormalizeEntity(prefix)
+	}
+	// every string with the prefix sorts before prefix + U+10FFFF
+	upper := prefix + "\U0010FFFF"
+	cond, nsArgs := namespaceCond(namespace)
+	args := []any{prefix, upper}
+	args = append(args, nsArgs...)
+	args = append(args, prefix, upper)
+	args = append(args, nsArgs...)
+	args = append(args, limit, offset)
+
+	rows, err := s.reader.QueryContext(ctx, `
+        SELECT entity, SUM(as_subject), SUM(as_object), MAX(created_at)
+        FROM (
+            SELECT subject AS entity, 1 AS as_subject, 0 AS as_object, created_at
+            FROM triples WHERE subject >= ? AND subject < ? AND superseded_by IS NULL`+cond+`
+            UNION ALL
+            SELECT object, 0, 1, created_at
+            FROM triples WHERE object >= ? AND object < ? AND superseded_by IS NULL`+cond+`
+        )
+        GROUP BY entity
+        ORDER BY entity
+        LIMIT ? OFFSET ?;
+    `, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []EntityInfo
+	for rows.Next() {
+		var e EntityInfo
+		var last string
+		if err := rows.Scan(&e.Entity, &e.AsSubject, &e.AsObject, &last); err != nil {
+			return nil, err
+		}
+		if t, err := time.Parse(sqlite.TimeLayout, last); err == nil {
+			e.LastSeen = t
+		} else if t, err := time.Parse(time.RFC3339, last); err == nil {
+			e.LastSeen = t
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,80 @@
+package graph_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/store/graph"
+)
+
+func TestListEntities(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, graph.Config{})
+	work := spo("alan", "works_at", "acme")
+	work.Namespace = "work"
+	upsert(t, s,
+		spo("alice", "works_at", "acme"),
+		spo("alice", "lives_in", "berlin"),
+		spo("bob", "knows", "alice"),
+		spo("bob", "works_at", "acme"),
+		work,
+	)
+
+	all, err := s.ListEntities(ctx, "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []graph.EntityInfo{
+		{Entity: "acme", AsSubject: 0, AsObject: 3},
+		{Entity: "alan", AsSubject: 1, AsObject: 0},
+		{Entity: "alice", AsSubject: 2, AsObject: 1},
+		{Entity: "berlin", AsSubject: 0, AsObject: 1},
+		{Entity: "bob", AsSubject: 2, AsObject: 0},
+	}
+	if len(all) != len(want) {
+		t.Fatalf("ListEntities = %+v, want %d entities", all, len(want))
+	}
+	for i, e := range all {
+		if e.Entity != want[i].Entity || e.AsSubject != want[i].AsSubject || e.AsObject != want[i].AsObject {
+			t.Errorf("entity %d = %+v, want %+v", i, e, want[i])
+		}
+		if e.LastSeen.IsZero() {
+			t.Errorf("%s has no last seen time", e.Entity)
+		}
+	}
+
+	for _, tt := range []struct {
+		name              string
+		namespace, prefix string
+		limit, offset     int
+		want              []string
+	}{
+		{"prefix", "", "al", 0, 0, []string{"alan", "alice"}},
+		{"prefix is case-insensitive", "", "AL", 0, 0, []string{"alan", "alice"}},
+		{"object only", "", "ber", 0, 0, []string{"berlin"}},
+		{"no match", "", "zed", 0, 0, []string{}},
+		{"namespace", "work", "", 0, 0, []string{"acme", "alan"}},
+		{"default namespace", "default", "a", 0, 0, []string{"acme", "alice"}},
+		{"page", "", "", 2, 1, []string{"alan", "alice"}},
+		{"past the end", "", "", 10, 5, []string{}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.ListEntities(ctx, tt.namespace, tt.prefix, tt.limit, tt.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if names := entityNames(got); !slices.Equal(names, tt.want) {
+				t.Fatalf("ListEntities = %q, want %q", names, tt.want)
+			}
+		})
+	}
+}
+
+func entityNames(entities []graph.EntityInfo) []string {
+	out := []string{}
+	for _, e := range entities {
+		out = append(out, e.Entity)
+	}
+	return out
+}
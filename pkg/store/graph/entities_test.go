@@ -0,0 +1,138 @@
+package graph_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/store/graph"
+)
+
+func TestEntitiesAreNormalizedOnWrite(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, graph.Config{})
+	first, err := s.UpsertTriple(ctx, spo("Alice ", "works_at", "ACME"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := s.UpsertTriple(ctx, spo("alice", "works_at", "  Acme"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != first.ID {
+		t.Fatalf("second upsert wrote row %d, want an update of row %d", again.ID, first.ID)
+	}
+	got, err := s.GetTriple(ctx, first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Subject != "alice" || got.Object != "acme" || got.ObservationCount != 2 {
+		t.Fatalf("triple = %+v, want alice works_at acme observed twice", got)
+	}
+	if got.SubjectLabel != "alice" || got.ObjectLabel != "Acme" {
+		t.Errorf("labels = %q, %q, want the latest surface forms", got.SubjectLabel, got.ObjectLabel)
+	}
+}
+
+func TestNormalizationCanBeDisabled(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, graph.Config{DisableNormalization: true})
+	upsert(t, s, spo("Alice", "works_at", "Acme"), spo("alice", "works_at", "acme"))
+	if n, err := s.Count(ctx); err != nil || n != 2 {
+		t.Fatalf("Count = %d, %v; want both spellings kept", n, err)
+	}
+}
+
+func TestAliasesResolveOnLookupAndMerge(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, graph.Config{})
+	upsert(t, s, spo("Ally", "likes", "tea"), spo("alice", "likes", "tea"), spo("Ally", "works_at", "acme"))
+	if err := s.AddAlias(ctx, "", "ally", "Alice"); err != nil {
+		t.Fatal(err)
+	}
+	all, err := s.DebugDump(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := keys(all), []string{"alice likes tea", "alice works_at acme"}; !slices.Equal(got, want) {
+		t.Fatalf("triples after AddAlias = %q, want %q", got, want)
+	}
+
+	upsert(t, s, spo("ALLY", "lives_in", "berlin"))
+	for _, entity := range []string{"ally", "Alice"} {
+		got, err := s.OneHopNeighbors(ctx, entity, 10, graph.FactFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 3 {
+			t.Errorf("OneHopNeighbors(%q) = %q, want all three alice facts", entity, keys(got))
+		}
+	}
+	found, err := s.SearchFacts(ctx, "Ally", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 3 {
+		t.Errorf("SearchFacts(Ally) = %q, want all three alice facts", keys(found))
+	}
+
+	if err := s.AddAlias(ctx, "", "Alice", "alice"); !errors.Is(err, graph.ErrInvalidAlias) {
+		t.Fatalf("AddAlias to itself = %v, want ErrInvalidAlias", err)
+	}
+}
+
+func TestNormalizeExistingRewritesLegacyTriplesOnce(t *testing.T) {
+	ctx := context.Background()
+	s, db := newTestStore(t, graph.Config{})
+	// rows as builds without normalization wrote them: no labels
+	for _, stmt := range []string{
+		`INSERT INTO memory_logs(id, content) VALUES ('log-1', 'Alice works at Acme'), ('log-2', 'alice works at acme');`,
+		`INSERT INTO triples(id, subject, predicate, object, confidence, observation_count) VALUES
+            (1, 'Alice', 'works_at', 'Acme', 0.9, 2),
+            (2, ' alice ', 'works_at', 'ACME', 0.4, 3),
+            (3, 'Bob  Smith', 'likes', 'tea', 0.5, 1);`,
+		`INSERT INTO triple_sources(triple_id, log_id) VALUES (1, 'log-1'), (2, 'log-2');`,
+	} {
+		if _, err := db.DB().Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+
+	merged, err := s.NormalizeExisting(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged != 1 {
+		t.Fatalf("NormalizeExisting merged %d triples, want 1", merged)
+	}
+	all, err := s.DebugDump(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := keys(all), []string{"alice works_at acme", "bob smith likes tea"}; !slices.Equal(got, want) {
+		t.Fatalf("triples = %q, want %q", got, want)
+	}
+	alice, err := s.GetTriple(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.ObservationCount != 5 || alice.Confidence != 0.9 || len(alice.Sources) != 2 {
+		t.Errorf("merged triple = %+v, want 5 observations at 0.9 citing both logs", alice)
+	}
+
+	// a labelled triple is never rewritten again, even if it looks legacy
+	if _, err := db.DB().Exec(`UPDATE triples SET subject = 'Bob Smith' WHERE id = 3;`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.NormalizeExisting(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetTriple(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Subject != "Bob Smith" {
+		t.Fatalf("subject after a second NormalizeExisting = %q, want it left alone", got.Subject)
+	}
+}
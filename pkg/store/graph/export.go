@@ -0,0 +1,256 @@
+package graph
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// ExportFormat is a graph document format written by Export.
+type ExportFormat string
+
+const (
+	// ExportDOT is the Graphviz DOT language.
+	ExportDOT ExportFormat = "dot"
+	// ExportGraphML is GraphML, as read by Gephi and yEd.
+	ExportGraphML ExportFormat = "graphml"
+)
+
+// ParseExportFormat validates an export format name.
+func ParseExportFormat(s string) (ExportFormat, error) {
+	switch f := ExportFormat(s); f {
+	case ExportDOT, ExportGraphML:
+		return f, nil
+	}
+	return "", fmt.Errorf("format must be %q or %q, got %q", ExportDOT, ExportGraphML, s)
+}
+
+// ContentType is the media type of documents in format f.
+func (f ExportFormat) ContentType() string {
+	if f == ExportGraphML {
+		return "application/graphml+xml; charset=utf-8"
+	}
+	return "text/vnd.graphviz; charset=utf-8"
+}
+
+// ExportOptions selects the triples written by Export.
+type ExportOptions struct {
+	// Namespace restricts the graph to one namespace; empty exports all.
+	Namespace     string
+	MinConfidence float64
+	// Predicates, when not empty, keeps only triples with one of them.
+	Predicates []string
+	// MaxNodes, when positive, stops adding entities once that many were
+	// written; triples between already written entities are still kept.
+	MaxNodes int
+}
+
+// graphWriter writes one document format; node is called once per entity,
+// before the first edge touching it.
+type graphWriter interface {
+	begin() error
+	node(id, label string) error
+	edge(from, to, predicate string, confidence float64) error
+	end() error
+}
+
+// Export streams the graph of current triples as a document in format,
+// oldest triples first; superseded triples are left out. Entities become nodes labeled with their display form and triples become
+// edges labeled with their predicate. Only the set of written entities is
+// kept in memory.
+func (s *Store) Export(ctx context.Context, w io.Writer, format ExportFormat, opts ExportOptions) error {
+	e, err := NewExporter(w, format, opts.MaxNodes)
+	if err != nil {
+		return err
+	}
+
+	cond, args := namespaceCond(opts.Namespace)
+	if opts.MinConfidence > 0 {
+		cond += " AND triples.confidence >= ?"
+		args = append(args, opts.MinConfidence)
+	}
+	if len(opts.Predicates) > 0 {
+		cond += " AND triples.predicate IN (" + placeholders(len(opts.Predicates)) + ")"
+		for _, p := range opts.Predicates {
+			args = append(args, p)
+		}
+	}
+	rows, err := s.reader.QueryContext(ctx, `
+        SELECT `+tripleColumns+`
+        FROM triples
+        WHERE triples.superseded_by IS NULL`+cond+`
+        ORDER BY id;
+    `, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := scanTriple(rows)
+		if err != nil {
+			return err
+		}
+		if err := e.Add(*t); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return e.Close()
+}
+
+// Exporter writes the document of Export from the triples it is given, in
+// the order they are added.
+type Exporter struct {
+	bw       *bufio.Writer
+	gw       graphWriter
+	maxNodes int
+	begun    bool
+	written  map[string]bool
+}
+
+// NewExporter returns an Exporter writing format to w, keeping at most
+// maxNodes entities when positive (see ExportOptions.MaxNodes). Nothing
+// reaches w before the first Add or Close.
+func NewExporter(w io.Writer, format ExportFormat, maxNodes int) (*Exporter, error) {
+	e := &Exporter{bw: bufio.NewWriter(w), maxNodes: maxNodes, written: map[string]bool{}}
+	switch format {
+	case ExportDOT:
+		e.gw = &dotWriter{w: e.bw}
+	case ExportGraphML:
+		e.gw = &graphMLWriter{w: e.bw}
+	default:
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+	return e, nil
+}
+
+func (e *Exporter) begin() error {
+	if e.begun {
+		return nil
+	}
+	e.begun = true
+	return e.gw.begin()
+}
+
+// Add writes t as an edge, and its entities as nodes unless written already.
+func (e *Exporter) Add(t model.Triple) error {
+	if err := e.begin(); err != nil {
+		return err
+	}
+	var added []string
+	if !e.written[t.Subject] {
+		added = append(added, t.Subject)
+	}
+	if t.Object != t.Subject && !e.written[t.Object] {
+		added = append(added, t.Object)
+	}
+	if e.maxNodes > 0 && len(e.written)+len(added) > e.maxNodes {
+		return nil
+	}
+	for _, entity := range added {
+		label := t.SubjectLabel
+		if entity != t.Subject {
+			label = t.ObjectLabel
+		}
+		if err := e.gw.node(entity, label); err != nil {
+			return err
+		}
+		e.written[entity] = true
+	}
+	return e.gw.edge(t.Subject, t.Object, t.Predicate, t.Confidence)
+}
+
+// Close ends the document and flushes it to the writer.
+func (e *Exporter) Close() error {
+	if err := e.begin(); err != nil {
+		return err
+	}
+	if err := e.gw.end(); err != nil {
+		return err
+	}
+	return e.bw.Flush()
+}
+
+type dotWriter struct {
+	w *bufio.Writer
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+
+// dotQuote returns s as a DOT double-quoted string. Anything but the quote,
+// the backslash and line breaks is taken literally, so angle brackets and
+// non-ASCII text need no escaping.
+func dotQuote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
+
+func (d *dotWriter) begin() error {
+	_, err := d.w.WriteString("digraph paim {\n")
+	return err
+}
+
+func (d *dotWriter) node(id, label string) error {
+	_, err := fmt.Fprintf(d.w, "  %s [label=%s];\n", dotQuote(id), dotQuote(label))
+	return err
+}
+
+func (d *dotWriter) edge(from, to, predicate string, confidence float64) error {
+	_, err := fmt.Fprintf(d.w, "  %s -> %s [label=%s, confidence=%s];\n",
+		dotQuote(from), dotQuote(to), dotQuote(predicate), strconv.FormatFloat(confidence, 'g', -1, 64))
+	return err
+}
+
+func (d *dotWriter) end() error {
+	_, err := d.w.WriteString("}\n")
+	return err
+}
+
+type graphMLWriter struct {
+	w     *bufio.Writer
+	edges int
+}
+
+// xmlEscape escapes s for XML text and attribute values; characters XML
+// cannot carry are replaced with U+FFFD.
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func (g *graphMLWriter) begin() error {
+	_, err := g.w.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="label" for="node" attr.name="label" attr.type="string"/>
+  <key id="predicate" for="edge" attr.name="predicate" attr.type="string"/>
+  <key id="confidence" for="edge" attr.name="confidence" attr.type="double"/>
+  <graph id="paim" edgedefault="directed">
+`)
+	return err
+}
+
+func (g *graphMLWriter) node(id, label string) error {
+	_, err := fmt.Fprintf(g.w, "    <node id=\"%s\"><data key=\"label\">%s</data></node>\n", xmlEscape(id), xmlEscape(label))
+	return err
+}
+
+func (g *graphMLWriter) edge(from, to, predicate string, confidence float64) error {
+	g.edges++
+	_, err := fmt.Fprintf(g.w, "    <edge id=\"e%d\" source=\"%s\" target=\"%s\"><data key=\"predicate\">%s</data><data key=\"confidence\">%s</data></edge>\n",
+		g.edges, xmlEscape(from), xmlEscape(to), xmlEscape(predicate), strconv.FormatFloat(confidence, 'g', -1, 64))
+	return err
+}
+
+func (g *graphMLWriter) end() error {
+	_, err := g.w.WriteString("  </graph>\n</graphml>\n")
+	return err
+}
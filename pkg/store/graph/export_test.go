@@ -0,0 +1,138 @@
+package graph_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/store/graph"
+)
+
+type graphML struct {
+	Graph struct {
+		Nodes []struct {
+			ID   string `xml:"id,attr"`
+			Data string `xml:"data"`
+		} `xml:"node"`
+		Edges []struct {
+			Source string `xml:"source,attr"`
+			Target string `xml:"target,attr"`
+			Data   []struct {
+				Key   string `xml:"key,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"data"`
+		} `xml:"edge"`
+	} `xml:"graph"`
+}
+
+func export(t *testing.T, s *graph.Store, format graph.ExportFormat, opts graph.ExportOptions) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := s.Export(context.Background(), &buf, format, opts); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestExportDOTEscapes(t *testing.T) {
+	s, _ := newTestStore(t, graph.Config{})
+	upsert(t, s, spo(`say "hi"`, "wrote", `c:\temp`), spo("<b>é</b>", "line\nbreak", "x"))
+	out := export(t, s, graph.ExportDOT, graph.ExportOptions{})
+
+	for _, want := range []string{
+		`digraph paim {`,
+		`"say \"hi\"" [label="say \"hi\""];`,
+		`"c:\\temp" [label="c:\\temp"];`,
+		`"say \"hi\"" -> "c:\\temp" [label="wrote", confidence=0.8];`,
+		`"<b>é</b>" [label="<b>é</b>"];`,
+		`"<b>é</b>" -> "x" [label="line\nbreak", confidence=0.8];`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("DOT output lacks %s:\n%s", want, out)
+		}
+	}
+	if !strings.HasSuffix(out, "}\n") {
+		t.Errorf("DOT output is not closed:\n%s", out)
+	}
+}
+
+func TestExportGraphMLEscapes(t *testing.T) {
+	s, _ := newTestStore(t, graph.Config{})
+	upsert(t, s, spo(`a<b & "c"`, "r&d", "x\x01y"))
+	out := export(t, s, graph.ExportGraphML, graph.ExportOptions{})
+
+	var doc graphML
+	if err := xml.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatalf("GraphML does not parse: %v\n%s", err, out)
+	}
+	var ids []string
+	for _, n := range doc.Graph.Nodes {
+		ids = append(ids, n.ID)
+		if n.Data != n.ID {
+			t.Errorf("node %q labeled %q", n.ID, n.Data)
+		}
+	}
+	// XML cannot carry U+0001, so it is replaced
+	if want := []string{`a<b & "c"`, "x\uFFFDy"}; !slices.Equal(ids, want) {
+		t.Errorf("nodes = %q, want %q", ids, want)
+	}
+	if len(doc.Graph.Edges) != 1 {
+		t.Fatalf("%d edges, want 1", len(doc.Graph.Edges))
+	}
+	e := doc.Graph.Edges[0]
+	if e.Source != `a<b & "c"` || len(e.Data) != 2 || e.Data[0].Value != "r&d" || e.Data[1].Value != "0.8" {
+		t.Errorf("edge = %+v", e)
+	}
+}
+
+func TestExportFilters(t *testing.T) {
+	s, _ := newTestStore(t, graph.Config{})
+	weak := spo("alice", "knows", "dave")
+	weak.Confidence = 0.3
+	work := spo("erin", "works_at", "acme")
+	work.Namespace = "work"
+	upsert(t, s,
+		spo("alice", "works_at", "acme"),
+		spo("bob", "works_at", "acme"),
+		spo("acme", "located_in", "berlin"),
+		weak,
+		work,
+	)
+	edges := func(opts graph.ExportOptions) int {
+		return strings.Count(export(t, s, graph.ExportDOT, opts), " -> ")
+	}
+	for _, tt := range []struct {
+		name string
+		opts graph.ExportOptions
+		want int
+	}{
+		{"everything", graph.ExportOptions{}, 5},
+		{"namespace", graph.ExportOptions{Namespace: "work"}, 1},
+		{"min confidence", graph.ExportOptions{Namespace: "default", MinConfidence: 0.5}, 3},
+		{"predicates", graph.ExportOptions{Namespace: "default", Predicates: []string{"works_at", "knows"}}, 3},
+		// alice, acme and bob fill the budget; acme located_in berlin and
+		// alice knows dave would add a fourth
+		{"max nodes", graph.ExportOptions{Namespace: "default", MaxNodes: 3}, 2},
+	} {
+		if got := edges(tt.opts); got != tt.want {
+			t.Errorf("%s: %d edges, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseExportFormat(t *testing.T) {
+	for _, f := range []graph.ExportFormat{graph.ExportDOT, graph.ExportGraphML} {
+		if got, err := graph.ParseExportFormat(string(f)); err != nil || got != f {
+			t.Errorf("ParseExportFormat(%q) = %q, %v", f, got, err)
+		}
+	}
+	if _, err := graph.ParseExportFormat("png"); err == nil {
+		t.Error("ParseExportFormat(png) succeeded")
+	}
+	if ct := graph.ExportGraphML.ContentType(); !strings.HasPrefix(ct, "application/graphml+xml") {
+		t.Errorf("GraphML content type = %q", ct)
+	}
+}
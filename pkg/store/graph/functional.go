@@ -0,0 +1,151 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ContradictionPolicy is what upserting a triple of a functional predicate
+// does to the triples it contradicts.
+type ContradictionPolicy int
+
+const (
+	// ContradictionSupersede keeps contradicted triples as history: their
+	// confidence is cut to SupersededConfidence of itself, SupersededBy
+	// names the triple that replaced them and their validity ends where
+	// the new triple's begins. Searches skip them unless asked for history.
+	ContradictionSupersede ContradictionPolicy = iota
+	// ContradictionDelete deletes contradicted triples.
+	ContradictionDelete
+)
+
+// ParseContradictionPolicy maps "supersede" or "delete" to a
+// ContradictionPolicy; empty means ContradictionSupersede.
+func ParseContradictionPolicy(s string) (ContradictionPolicy, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "supersede":
+		return ContradictionSupersede, nil
+	case "delete":
+		return ContradictionDelete, nil
+	default:
+		return ContradictionSupersede, fmt.Errorf("unknown contradiction policy %q (want supersede or delete)", s)
+	}
+}
+
+// SupersededConfidence scales the confidence of a superseded triple. The
+// schema's delete trigger undoes the cut with the same factor.
+const SupersededConfidence = 0.1
+
+// FunctionalSet matches predicates against Config.FunctionalPredicates.
+type FunctionalSet struct {
+	exact    map[string]bool
+	prefixes []string
+}
+
+// NewFunctionalSet parses predicates as Config.FunctionalPredicates: exact
+// names, or prefixes ending in "*".
+func NewFunctionalSet(predicates []string) FunctionalSet {
+	f := FunctionalSet{exact: make(map[string]bool)}
+	for _, p := range predicates {
+		p = strings.TrimSpace(p)
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			f.prefixes = append(f.prefixes, prefix)
+		} else if p != "" {
+			f.exact[p] = true
+		}
+	}
+	return f
+}
+
+// Has reports whether predicate is functional.
+func (f FunctionalSet) Has(predicate string) bool {
+	if f.exact[predicate] {
+		return true
+	}
+	for _, p := range f.prefixes {
+		if strings.HasPrefix(predicate, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveContradictions applies the contradiction policy to the triples of
+// namespace with subject and predicate whose object is not object, once the
+// triple id holding it was upserted. Triples already superseded, or whose
+// validity ended before the new triple starts, are left as they are, so
+// supersession forms a chain from the oldest value to the current one.
+// Superseded triples stop being valid when the new triple
+// starts: at its valid_from, else now, which then becomes its valid_from.
+// Only triples starting no later than the new one are superseded: when a
+// current triple starts after it, the new triple is history, valid until
+// the earliest such start. It returns how many triples it superseded or
+// deleted.
+func (s *Store) resolveContradictions(ctx context.Context, tx *sql.Tx, id int64, namespace, subject, predicate, object string) (int64, error) {
+	if s.contradictions == ContradictionDelete {
+		res, err := tx.ExecContext(ctx, `
+            DELETE FROM triples
+            WHERE namespace = ? AND subject = ? AND predicate = ? AND object <> ?;
+        `, namespace, subject, predicate, object)
+		if err != nil {
+			return 0, err
+		}
+		return res.RowsAffected()
+	}
+
+	var from sql.NullTime
+	if err := tx.QueryRowContext(ctx, `SELECT valid_from FROM triples WHERE id = ?;`, id).Scan(&from); err != nil {
+		return 0, err
+	}
+	at := time.Now()
+	if from.Valid {
+		at = from.Time
+	}
+	res, err := tx.ExecContext(ctx, `
+        UPDATE triples SET superseded_by = ?1, confidence = confidence * ?2,
+            valid_to = ?3
+        WHERE namespace = ?4 AND subject = ?5 AND predicate = ?6 AND object <> ?7
+          AND superseded_by IS NULL AND (valid_to IS NULL OR datetime(valid_to) > ?3)
+          AND (valid_from IS NULL OR datetime(valid_from) <= ?3);
+    `, id, SupersededConfidence, validityArg(&at), namespace, subject, predicate, object)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if err := s.capAtLaterValue(ctx, tx, id, namespace, subject, predicate, object, at); err != nil {
+		return 0, err
+	}
+	if n == 0 || from.Valid {
+		return n, nil
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE triples SET valid_from = ? WHERE id = ?;`, validityArg(&at), id)
+	return n, err
+}
+
+// capAtLaterValue ends the validity of triple id, which starts at at, where
+// the earliest current contradicting triple starting after it begins, if
+// any: a value asserted out of order is history, not the current value.
+func (s *Store) capAtLaterValue(ctx context.Context, tx *sql.Tx, id int64, namespace, subject, predicate, object string, at time.Time) error {
+	var next sql.NullTime
+	err := tx.QueryRowContext(ctx, `
+        SELECT valid_from FROM triples
+        WHERE namespace = ? AND subject = ? AND predicate = ? AND object <> ?
+          AND superseded_by IS NULL AND datetime(valid_from) > ?
+        ORDER BY datetime(valid_from) LIMIT 1;
+    `, namespace, subject, predicate, object, validityArg(&at)).Scan(&next)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE triples SET valid_to = ? WHERE id = ?;`, validityArg(&next.Time), id)
+	return err
+}
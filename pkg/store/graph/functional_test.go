@@ -0,0 +1,212 @@
+package graph_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store/graph"
+)
+
+// current returns the keys of the current and of all facts about subject
+// in the default namespace.
+func current(t *testing.T, s *graph.Store, subject string) (now, all []string) {
+	t.Helper()
+	ctx := context.Background()
+	for _, include := range []bool{false, true} {
+		res, err := s.ListTriples(ctx, graph.ListParams{Namespace: model.DefaultNamespace, Subject: subject, IncludeSuperseded: include, Limit: 50})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if include {
+			all = keys(res.Triples)
+		} else {
+			now = keys(res.Triples)
+		}
+	}
+	return now, all
+}
+
+func byObject(t *testing.T, s *graph.Store, subject string) map[string]model.Triple {
+	t.Helper()
+	res, err := s.ListTriples(context.Background(), graph.ListParams{Namespace: model.DefaultNamespace, Subject: subject, IncludeSuperseded: true, Limit: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(map[string]model.Triple)
+	for _, tr := range res.Triples {
+		out[tr.Object] = tr
+	}
+	return out
+}
+
+func TestFunctionalPredicatesFormASupersessionChain(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, graph.Config{FunctionalPredicates: []string{"lives_in", " prefers_* "}})
+	work := spo("alice", "lives_in", "london")
+	work.Namespace = "work"
+	upsert(t, s, spo("alice", "lives_in", "paris"), spo("bob", "lives_in", "paris"), work)
+	berlin := upsert(t, s, spo("alice", "lives_in", "berlin"))[0]
+	if berlin.Superseded != 1 {
+		t.Errorf("berlin superseded %d triples, want paris", berlin.Superseded)
+	}
+	rome := upsert(t, s, spo("alice", "lives_in", "rome"))[0]
+	if rome.Superseded != 1 {
+		t.Errorf("rome superseded %d triples, want only berlin", rome.Superseded)
+	}
+
+	now, all := current(t, s, "alice")
+	if !slices.Equal(now, []string{"alice lives_in rome"}) || len(all) != 3 {
+		t.Fatalf("alice's facts = %q of %q, want rome current of all three", now, all)
+	}
+	facts := byObject(t, s, "alice")
+	if facts["paris"].SupersededBy != berlin.ID || facts["berlin"].SupersededBy != rome.ID || facts["rome"].SupersededBy != 0 {
+		t.Errorf("superseded_by paris %d, berlin %d, rome %d; want paris->berlin->rome",
+			facts["paris"].SupersededBy, facts["berlin"].SupersededBy, facts["rome"].SupersededBy)
+	}
+	// cut once when superseded, not again by every later value
+	if c := facts["paris"].Confidence; c < 0.079 || c > 0.081 {
+		t.Errorf("paris confidence = %v, want 0.08", c)
+	}
+	if now, _ := current(t, s, "bob"); !slices.Equal(now, []string{"bob lives_in paris"}) {
+		t.Errorf("bob's facts = %q, want his own value untouched", now)
+	}
+	if res, err := s.ListTriples(ctx, graph.ListParams{Namespace: "work", Limit: 10}); err != nil || len(res.Triples) != 1 || res.Triples[0].SupersededBy != 0 {
+		t.Errorf("work facts = %+v, %v; want alice's london fact current", res.Triples, err)
+	}
+
+	for _, tt := range []struct {
+		f    graph.FactFilter
+		want []string
+	}{
+		{graph.FactFilter{Namespace: model.DefaultNamespace, Predicate: "lives_in"}, []string{"alice lives_in rome"}},
+		{graph.FactFilter{Namespace: model.DefaultNamespace, Predicate: "lives_in", IncludeSuperseded: true}, []string{"alice lives_in berlin", "alice lives_in paris", "alice lives_in rome"}},
+	} {
+		got, err := s.SearchFactsFiltered(ctx, "alice", 10, tt.f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k := keys(got); !slices.Equal(k, tt.want) {
+			t.Errorf("search with superseded %v = %q, want %q", tt.f.IncludeSuperseded, k, tt.want)
+		}
+	}
+
+	// observing an old value again makes it current
+	upsert(t, s, spo("alice", "lives_in", "paris"))
+	if now, _ := current(t, s, "alice"); !slices.Equal(now, []string{"alice lives_in paris"}) {
+		t.Errorf("alice's facts after moving back = %q, want paris", now)
+	}
+
+	upsert(t, s, spo("alice", "prefers_color", "red"), spo("alice", "prefers_color", "blue"), spo("alice", "prefers_food", "pasta"))
+	if now, _ := current(t, s, "alice"); !slices.Equal(now, []string{"alice lives_in paris", "alice prefers_color blue", "alice prefers_food pasta"}) {
+		t.Errorf("alice's facts = %q, want one value per prefers_ predicate", now)
+	}
+}
+
+func TestOtherPredicatesKeepEveryValue(t *testing.T) {
+	s, _ := newTestStore(t, graph.Config{FunctionalPredicates: []string{"lives_in"}})
+	for _, tr := range []model.Triple{spo("alice", "likes", "tea"), spo("alice", "likes", "coffee"), spo("alice", "lives_in_past", "oslo"), spo("alice", "lives_in_past", "rome")} {
+		if res := upsert(t, s, tr); res[0].Superseded != 0 {
+			t.Errorf("%s %s %s superseded %d triples", tr.Subject, tr.Predicate, tr.Object, res[0].Superseded)
+		}
+	}
+	if now, all := current(t, s, "alice"); len(now) != 4 || len(all) != 4 {
+		t.Errorf("alice's facts = %q, want all four current", now)
+	}
+
+	plain, _ := newTestStore(t, graph.Config{})
+	upsert(t, plain, spo("alice", "lives_in", "paris"), spo("alice", "lives_in", "berlin"))
+	if now, _ := current(t, plain, "alice"); len(now) != 2 {
+		t.Errorf("facts without functional predicates = %q, want both", now)
+	}
+}
+
+func TestContradictionDeletePolicy(t *testing.T) {
+	s, _ := newTestStore(t, graph.Config{FunctionalPredicates: []string{"works_at"}, Contradictions: graph.ContradictionDelete})
+	upsert(t, s, spo("alice", "works_at", "acme"), spo("alice", "works_at", "initech"))
+	now, all := current(t, s, "alice")
+	if !slices.Equal(now, []string{"alice works_at initech"}) || !slices.Equal(all, now) {
+		t.Errorf("alice's facts = %q of %q, want acme deleted", now, all)
+	}
+}
+
+func TestParseContradictionPolicy(t *testing.T) {
+	for in, want := range map[string]graph.ContradictionPolicy{
+		"": graph.ContradictionSupersede, "supersede": graph.ContradictionSupersede, " Delete ": graph.ContradictionDelete,
+	} {
+		if got, err := graph.ParseContradictionPolicy(in); err != nil || got != want {
+			t.Errorf("ParseContradictionPolicy(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := graph.ParseContradictionPolicy("overwrite"); err == nil {
+		t.Error("parsed an unknown policy")
+	}
+}
+
+func TestDeletingASupersedingTripleRestoresTheChain(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, graph.Config{FunctionalPredicates: []string{"lives_in"}})
+	upsert(t, s, spo("alice", "lives_in", "paris"))
+	berlin := upsert(t, s, spo("alice", "lives_in", "berlin"))[0]
+	rome := upsert(t, s, spo("alice", "lives_in", "rome"))[0]
+
+	// removing the middle of the chain links its ends
+	if err := s.DeleteTriple(ctx, "", berlin.ID); err != nil {
+		t.Fatal(err)
+	}
+	facts := byObject(t, s, "alice")
+	if paris := facts["paris"]; paris.SupersededBy != rome.ID || paris.ValidTo == nil || !paris.ValidTo.Equal(*facts["rome"].ValidFrom) {
+		t.Errorf("paris = %+v, want it superseded by rome, valid until rome starts", paris)
+	}
+
+	// removing the current value makes the one before it current again
+	if n, err := s.DeleteMatching(ctx, "", "alice", "lives_in", "rome"); err != nil || n != 1 {
+		t.Fatalf("DeleteMatching(rome) = %d, %v", n, err)
+	}
+	if now, _ := current(t, s, "alice"); !slices.Equal(now, []string{"alice lives_in paris"}) {
+		t.Fatalf("alice's facts = %q, want paris current again", now)
+	}
+	paris := byObject(t, s, "alice")["paris"]
+	if paris.SupersededBy != 0 || paris.ValidTo != nil || paris.Confidence < 0.79 || paris.Confidence > 0.81 {
+		t.Errorf("paris = %+v, want it open with its confidence restored to 0.8", paris)
+	}
+}
+
+func TestSupersededTriplesAreNotTraversed(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, graph.Config{FunctionalPredicates: []string{"lives_in"}})
+	upsert(t, s, spo("alice", "lives_in", "paris"), spo("paris", "capital_of", "france"))
+	upsert(t, s, spo("alice", "lives_in", "berlin"))
+
+	if path, err := s.FindPath(ctx, "", "alice", "france", 4); !errors.Is(err, graph.ErrNoPath) {
+		t.Errorf("FindPath(alice, france) = %q, %v; want no path through the old home", keys(path), err)
+	}
+	matches, err := s.QueryPattern(ctx, "", []graph.TriplePattern{{Subject: "alice", Predicate: "lives_in", Object: "?city"}}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].Bindings["city"] != "berlin" {
+		t.Errorf("QueryPattern(alice lives_in ?city) = %+v, want berlin only", matches)
+	}
+	entities, err := s.ListEntities(ctx, "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entities {
+		if e.Entity == "alice" && e.AsSubject != 1 {
+			t.Errorf("alice is the subject of %d listed triples, want 1", e.AsSubject)
+		}
+		if e.Entity == "paris" && e.AsObject != 0 {
+			t.Errorf("paris is the object of %d listed triples, want 0", e.AsObject)
+		}
+	}
+	if n, err := s.Neighbors(ctx, "alice", 1, 10, graph.FactFilter{}); err != nil || n.Degree.Total != 1 {
+		t.Errorf("Neighbors(alice) degree = %+v, %v; want 1 like ListEntities", n.Degree, err)
+	}
+	if dot := export(t, s, graph.ExportDOT, graph.ExportOptions{}); strings.Contains(dot, `"alice" -> "paris"`) || !strings.Contains(dot, `"alice" -> "berlin"`) {
+		t.Errorf("export = %s, want the berlin edge only", dot)
+	}
+}
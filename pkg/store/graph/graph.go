@@ -3,101 +3,735 @@ package graph
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store/sqlite"
 )
 
+// MergeStrategy decides the confidence of a triple that is observed again.
+type MergeStrategy int
+
+const (
+	// MergeReinforce moves confidence towards 1 on every re-observation:
+	// new = old + (1-old) * incoming * ReinforceRate.
+	MergeReinforce MergeStrategy = iota
+	// MergeMax keeps the higher of the stored and incoming confidence.
+	MergeMax
+	// MergeReplace overwrites the stored confidence with the incoming one.
+	MergeReplace
+)
+
+// Config controls graph store behavior.
+type Config struct {
+	Merge MergeStrategy
+	// ReinforceRate scales the reinforcement step (default 0.5).
+	ReinforceRate float64
+	// DisableNormalization stores entities exactly as given instead of
+	// trimming and case-folding them.
+	DisableNormalization bool
+	// Reader, if set, serves queries that do not modify the graph so they
+	// do not wait behind writes; writes always go to the db handle.
+	Reader *sql.DB
+	// Logger receives fact search timings at debug level and slow searches
+	// as warnings (default discards).
+	Logger *slog.Logger
+	// FunctionalPredicates name the predicates a subject has one current
+	// value of, such as lives_in; a trailing '*' matches every predicate
+	// with that prefix (prefers_*). Upserting a triple of one resolves the
+	// triples it contradicts, those of the same subject and predicate with
+	// another object, according to Contradictions.
+	FunctionalPredicates []string
+	Contradictions       ContradictionPolicy
+}
+
+// slowSearch is the duration above which fact searches are logged as slow.
+const slowSearch = 250 * time.Millisecond
+
 // Store encapsulates CRUD for triples.
 type Store struct {
-	db *sql.DB
+	db             *sql.DB
+	reader         *sql.DB
+	upsertSQL      string
+	normalize      bool
+	logger         *slog.Logger
+	functional     FunctionalSet
+	contradictions ContradictionPolicy
 }
 
 func New(db *sql.DB) *Store {
-	return &Store{db: db}
+	return NewWithConfig(db, Config{})
 }
 
-// UpsertTriple inserts or updates confidence if duplicate.
-func (s *Store) UpsertTriple(ctx context.Context, t model.Triple) (int64, error) {
-	res, err := s.db.ExecContext(ctx, `
-        INSERT INTO triples(subject, predicate, object, confidence)
-        VALUES(?, ?, ?, ?)
-        ON CONFLICT(subject, predicate, object) DO UPDATE SET confidence=excluded.confidence;
-    `, t.Subject, t.Predicate, t.Object, t.Confidence)
+// NewWithConfig creates a store with an explicit merge strategy.
+func NewWithConfig(db *sql.DB, cfg Config) *Store {
+	if cfg.ReinforceRate <= 0 || cfg.ReinforceRate > 1 {
+		cfg.ReinforceRate = 0.5
+	}
+	reader := cfg.Reader
+	if reader == nil {
+		reader = db
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	return &Store{
+		db:             db,
+		reader:         reader,
+		upsertSQL:      upsertTripleSQL(cfg),
+		normalize:      !cfg.DisableNormalization,
+		logger:         logger,
+		functional:     NewFunctionalSet(cfg.FunctionalPredicates),
+		contradictions: cfg.Contradictions,
+	}
+}
+
+const (
+	tripleColumns = `id, subject, predicate, object, confidence, created_at, observation_count,
+        COALESCE(subject_label, subject), COALESCE(object_label, object), namespace, last_accessed_at, access_count,
+        superseded_by, valid_from, valid_to`
+	linkSourceSQL = `INSERT OR IGNORE INTO triple_sources(triple_id, log_id) VALUES (?, ?);`
+)
+
+func upsertTripleSQL(cfg Config) string {
+	var merge string
+	switch cfg.Merge {
+	case MergeMax:
+		merge = `MAX(confidence, excluded.confidence)`
+	case MergeReplace:
+		merge = `excluded.confidence`
+	default:
+		merge = fmt.Sprintf(`MIN(1.0, confidence + (1.0 - confidence) * excluded.confidence * %g)`, cfg.ReinforceRate)
+	}
+	return `
+        INSERT INTO triples(subject, predicate, object, confidence, subject_label, object_label, namespace, valid_from, valid_to)
+        VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)
+        ON CONFLICT(namespace, subject, predicate, object) DO UPDATE SET
+            confidence = ` + merge + `,
+            observation_count = observation_count + 1,
+            subject_label = excluded.subject_label,
+            object_label = excluded.object_label,
+            valid_from = CASE WHEN superseded_by IS NULL THEN COALESCE(excluded.valid_from, valid_from)
+                ELSE COALESCE(excluded.valid_from, strftime('%Y-%m-%d %H:%M:%S', 'now')) END,
+            valid_to = CASE WHEN superseded_by IS NULL THEN COALESCE(excluded.valid_to, valid_to)
+                ELSE excluded.valid_to END,
+            superseded_by = NULL
+        RETURNING id, observation_count;
+    `
+}
+
+// UpsertTriple inserts or updates confidence if duplicate and records its
+// source logs. A triple is a duplicate only within its namespace; an empty
+// Namespace means model.DefaultNamespace. The result carries the id of the
+// stored row, which is the existing row's id on conflict (read back via
+// RETURNING, never LastInsertId), and whether the row was inserted or
+// updated. Re-observing a superseded triple makes it current again, valid
+// from now unless ValidFrom says otherwise; on other conflicts given
+// validity bounds replace the stored ones. A triple of a functional
+// predicate supersedes or deletes the triples it contradicts (see
+// Config.FunctionalPredicates), unless its ValidTo marks it as history.
+func (s *Store) UpsertTriple(ctx context.Context, t model.Triple) (UpsertResult, error) {
+	res, err := s.UpsertTriples(ctx, []model.Triple{t})
 	if err != nil {
-		return 0, err
+		return UpsertResult{}, err
+	}
+	return res[0], nil
+}
+
+// UpsertResult reports what UpsertTriples did with one triple.
+type UpsertResult struct {
+	ID int64
+	// Inserted is true for a new triple and false when an existing one was
+	// reinforced.
+	Inserted bool
+	// Superseded counts the triples of a functional predicate the triple
+	// superseded or deleted.
+	Superseded int64
+}
+
+// UpsertTriples writes all triples and their source links in a single
+// transaction with prepared statements; either every triple is stored or none
+// are. It reports, in input order, each row id and whether it was newly
+// inserted.
+func (s *Store) UpsertTriples(ctx context.Context, triples []model.Triple) ([]UpsertResult, error) {
+	return s.UpsertTriplesWith(ctx, triples, nil)
+}
+
+// UpsertTriplesWith is UpsertTriples that also runs then, when not nil, in
+// the same transaction after the triples are written, so that its writes
+// commit together with the triples or not at all.
+func (s *Store) UpsertTriplesWith(ctx context.Context, triples []model.Triple, then func(tx *sql.Tx) error) ([]UpsertResult, error) {
+	if len(triples) == 0 && then == nil {
+		return nil, nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var res []UpsertResult
+	if len(triples) > 0 {
+		if res, err = s.upsert(ctx, tx, triples); err != nil {
+			return nil, err
+		}
+	}
+	if then != nil {
+		if err := then(tx); err != nil {
+			return nil, err
+		}
+	}
+	return res, tx.Commit()
+}
+
+func (s *Store) upsert(ctx context.Context, tx *sql.Tx, triples []model.Triple) ([]UpsertResult, error) {
+	upsert, err := tx.PrepareContext(ctx, s.upsertSQL)
+	if err != nil {
+		return nil, err
+	}
+	defer upsert.Close()
+	link, err := tx.PrepareContext(ctx, linkSourceSQL)
+	if err != nil {
+		return nil, err
+	}
+	defer link.Close()
+
+	res := make([]UpsertResult, len(triples))
+	for i, t := range triples {
+		namespace := t.Namespace
+		if namespace == "" {
+			namespace = model.DefaultNamespace
+		}
+		subject, err := s.resolve(ctx, tx, namespace, t.Subject)
+		if err != nil {
+			return nil, err
+		}
+		object, err := s.resolve(ctx, tx, namespace, t.Object)
+		if err != nil {
+			return nil, err
+		}
+		subjectLabel, objectLabel := strings.TrimSpace(t.Subject), strings.TrimSpace(t.Object)
+		var observations int64
+		if t.ValidFrom != nil && t.ValidTo != nil && !t.ValidTo.After(*t.ValidFrom) {
+			return nil, fmt.Errorf("triple %d: valid_to must be after valid_from", i)
+		}
+		if err := upsert.QueryRowContext(ctx, subject, t.Predicate, object, t.Confidence, subjectLabel, objectLabel, namespace,
+			validityArg(t.ValidFrom), validityArg(t.ValidTo)).Scan(&res[i].ID, &observations); err != nil {
+			return nil, fmt.Errorf("triple %d: %w", i, err)
+		}
+		res[i].Inserted = observations == 1
+		if s.functional.Has(t.Predicate) && t.ValidTo == nil {
+			if res[i].Superseded, err = s.resolveContradictions(ctx, tx, res[i].ID, namespace, subject, t.Predicate, object); err != nil {
+				return nil, fmt.Errorf("triple %d: %w", i, err)
+			}
+		}
+		for _, logID := range t.Sources {
+			if _, err := link.ExecContext(ctx, res[i].ID, logID); err != nil {
+				return nil, fmt.Errorf("triple %d: source %s: %w", i, logID, err)
+			}
+		}
+	}
+	return res, nil
+}
+
+// GetTriple fetches a triple by id along with its source log ids. It returns
+// sql.ErrNoRows when the triple does not exist.
+func (s *Store) GetTriple(ctx context.Context, id int64) (*model.Triple, error) {
+	t, err := scanTriple(s.reader.QueryRowContext(ctx, `SELECT `+tripleColumns+` FROM triples WHERE id = ?;`, id))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.reader.QueryContext(ctx, `SELECT log_id FROM triple_sources WHERE triple_id = ? ORDER BY log_id;`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var logID string
+		if err := rows.Scan(&logID); err != nil {
+			return nil, err
+		}
+		t.Sources = append(t.Sources, logID)
+	}
+	return t, rows.Err()
+}
+
+// TriplesFromLog returns the triples distilled from a log, most confident
+// first.
+func (s *Store) TriplesFromLog(ctx context.Context, logID string) ([]model.Triple, error) {
+	rows, err := s.reader.QueryContext(ctx, `
+        SELECT `+tripleColumns+`
+        FROM triples
+        WHERE id IN (SELECT triple_id FROM triple_sources WHERE log_id = ?)
+        ORDER BY confidence DESC, created_at DESC;
+    `, logID)
+	if err != nil {
+		return nil, err
 	}
-	id, _ := res.LastInsertId()
-	return id, nil
+	return scanTriples(rows)
 }
 
-// SearchFacts performs a LIKE-based search on subject/object and limits results.
-func (s *Store) SearchFacts(ctx context.Context, term string, limit int) ([]model.Triple, error) {
+// SearchFacts performs a substring search on subject/object and limits results,
+// most confident first and newest among equals. Facts below minConfidence
+// are skipped; 0 keeps them all. The term is normalized and resolved through
+// aliases like stored entities; its internal whitespace is collapsed even
+// with normalization off, and '%' and '_' in it match literally.
+//
+// With MatchAny or MatchAll each word of the term is resolved and matched on
+// its own, and a fact matches a word when its subject or object contains
+// it. MatchAny ranks facts matching more words first; a single word
+// matches like MatchContains.
+func (s *Store) SearchFacts(ctx context.Context, term string, limit int, minConfidence float64) ([]model.Triple, error) {
+	return s.SearchFactsFiltered(ctx, term, limit, FactFilter{MinConfidence: minConfidence})
+}
+
+// FactFilter restricts SearchFactsFiltered. Namespace keeps only facts of
+// that namespace. Source and Metadata filter by provenance: a fact matches
+// when at least one of its source logs satisfies both. From and To bound the
+// fact's created_at, inclusive. MinConfidence drops facts below it.
+type FactFilter struct {
+	Namespace     string
+	Source        string
+	Metadata      map[string]string
+	From          time.Time
+	To            time.Time
+	MinConfidence float64
+	// Predicate keeps only facts with exactly this predicate.
+	Predicate string
+	// Match is how SearchFactsFiltered matches its term against subjects
+	// and objects (default MatchContains).
+	Match MatchMode
+	// IncludeSuperseded keeps facts a functional predicate's newer value
+	// superseded, for their history.
+	IncludeSuperseded bool
+	// AsOf, when set, keeps only facts valid at that instant (see
+	// model.Triple.ValidFrom), superseded or not.
+	AsOf time.Time
+}
+
+// SearchFactsFiltered is SearchFacts restricted to facts matching f.
+func (s *Store) SearchFactsFiltered(ctx context.Context, term string, limit int, f FactFilter) ([]model.Triple, error) {
 	if limit <= 0 {
 		limit = 10
 	}
-	rows, err := s.db.QueryContext(ctx, `
-        SELECT id, subject, predicate, object, confidence, created_at
-        FROM triples
-        WHERE subject LIKE ? OR object LIKE ?
-        ORDER BY created_at DESC
-        LIMIT ?;
-    `, "%"+term+"%", "%"+term+"%", limit)
+	mode := f.Match
+	if mode == "" {
+		mode = MatchContains
+	}
+	term = strings.Join(strings.Fields(term), " ")
+	if mode.Tokenized() {
+		words := Tokenize(term)
+		if len(words) > 1 {
+			return s.searchWords(ctx, words, mode, limit, f)
+		}
+		if len(words) == 1 {
+			term = words[0]
+		}
+	}
+	term, err := s.resolve(ctx, s.reader, f.Namespace, term)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	subjectCond, subjectArg := mode.condition("subject", term)
+	objectCond, objectArg := mode.condition("object", term)
+	cond, args := f.where()
+	args = append([]any{subjectArg, objectArg}, args...)
+	return s.searchQuery(ctx, `
+        SELECT `+tripleColumns+`
+        FROM triples
+        WHERE (`+subjectCond+` OR `+objectCond+`)`+cond+`
+        ORDER BY confidence DESC, created_at DESC, id DESC
+        LIMIT ?;
+    `, args, limit)
+}
 
-	var out []model.Triple
-	for rows.Next() {
-		var t model.Triple
-		if err := rows.Scan(&t.ID, &t.Subject, &t.Predicate, &t.Object, &t.Confidence, &t.CreatedAt); err != nil {
+// searchWords is SearchFactsFiltered for the words of a MatchAny or
+// MatchAll term. Each fact scores the number of words its subject or
+// object contains; MatchAll keeps only facts scoring every word.
+func (s *Store) searchWords(ctx context.Context, words []string, mode MatchMode, limit int, f FactFilter) ([]model.Triple, error) {
+	scores := make([]string, 0, len(words))
+	var args []any
+	for _, w := range words {
+		w, err := s.resolve(ctx, s.reader, f.Namespace, w)
+		if err != nil {
 			return nil, err
 		}
-		out = append(out, t)
+		subjectCond, subjectArg := MatchContains.condition("subject", w)
+		objectCond, objectArg := MatchContains.condition("object", w)
+		scores = append(scores, "("+subjectCond+" OR "+objectCond+")")
+		args = append(args, subjectArg, objectArg)
 	}
-	return out, rows.Err()
+	minScore := 1
+	if mode == MatchAll {
+		minScore = len(words)
+	}
+	cond, filterArgs := f.where()
+	args = append(args, filterArgs...)
+	args = append(args, minScore)
+	return s.searchQuery(ctx, `
+        SELECT `+tripleColumns+`
+        FROM (
+            SELECT *, `+strings.Join(scores, " + ")+` AS score
+            FROM triples
+            WHERE 1 = 1`+cond+`
+        )
+        WHERE score >= ?
+        ORDER BY score DESC, confidence DESC, created_at DESC, id DESC
+        LIMIT ?;
+    `, args, limit)
 }
 
-// OneHopNeighbors returns triples connected to an entity.
-func (s *Store) OneHopNeighbors(ctx context.Context, entity string, limit int) ([]model.Triple, error) {
-	rows, err := s.db.QueryContext(ctx, `
-        SELECT id, subject, predicate, object, confidence, created_at
+// searchQuery runs a fact search whose last argument is limit and logs its
+// timing.
+func (s *Store) searchQuery(ctx context.Context, query string, args []any, limit int) ([]model.Triple, error) {
+	start := time.Now()
+	rows, err := s.reader.QueryContext(ctx, query, append(args, limit)...)
+	if err != nil {
+		s.logger.Error("fact search failed", "limit", limit, "err", err)
+		return nil, err
+	}
+	facts, err := scanTriples(rows)
+	if d := time.Since(start); d >= slowSearch {
+		s.logger.Warn("slow fact search", "limit", limit, "facts", len(facts), "ms", d.Milliseconds())
+	} else {
+		s.logger.Debug("fact search", "limit", limit, "facts", len(facts), "ms", d.Milliseconds())
+	}
+	return facts, err
+}
+
+// RecentFacts returns the highest-confidence facts among the most recently
+// created ones matching f, for recall without a query term.
+func (s *Store) RecentFacts(ctx context.Context, limit int, f FactFilter) ([]model.Triple, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	cond, args := f.where()
+	args = append(args, recentFactsWindow*limit, limit)
+	rows, err := s.reader.QueryContext(ctx, `
+        SELECT * FROM (
+            SELECT `+tripleColumns+`
+            FROM triples
+            WHERE 1 = 1`+cond+`
+            ORDER BY created_at DESC, id DESC
+            LIMIT ?
+        )
+        ORDER BY confidence DESC, created_at DESC
+        LIMIT ?;
+    `, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanTriples(rows)
+}
+
+// recentFactsWindow is how many recent facts per requested result
+// RecentFacts considers before picking by confidence.
+const recentFactsWindow = 4
+
+// where returns SQL conditions over the triples table, each prefixed with
+// " AND ", and their arguments.
+func (f FactFilter) where() (string, []any) {
+	cond, args := namespaceCond(f.Namespace)
+	if lf := (sqlite.LogFilter{Source: f.Source, Metadata: f.Metadata}); !lf.IsZero() {
+		where, whereArgs := lf.Where("l")
+		cond += `
+          AND EXISTS (
+            SELECT 1 FROM triple_sources ts JOIN memory_logs l ON l.id = ts.log_id
+            WHERE ts.triple_id = triples.id` + where + `)`
+		args = append(args, whereArgs...)
+	}
+	if where, whereArgs := sqlite.TimeRange("created_at", f.From, f.To); where != "" {
+		cond += where
+		args = append(args, whereArgs...)
+	}
+	if f.MinConfidence > 0 {
+		cond += " AND triples.confidence >= ?"
+		args = append(args, f.MinConfidence)
+	}
+	if f.Predicate != "" {
+		cond += " AND triples.predicate = ?"
+		args = append(args, f.Predicate)
+	}
+	switch {
+	case !f.AsOf.IsZero():
+		where, whereArgs := validAt(f.AsOf)
+		cond += where
+		args = append(args, whereArgs...)
+	case !f.IncludeSuperseded:
+		cond += " AND triples.superseded_by IS NULL"
+	}
+	return cond, args
+}
+
+// namespaceCond returns a condition, prefixed with " AND ", keeping triples
+// of namespace, or nothing when namespace is empty.
+func namespaceCond(namespace string) (string, []any) {
+	if namespace == "" {
+		return "", nil
+	}
+	return " AND triples.namespace = ?", []any{namespace}
+}
+
+// NeighborsOf returns triples matching f that touch any of entities, most
+// confident first, at most limit. Entities are used as stored, without alias
+// resolution, since callers take them from existing triples.
+func (s *Store) NeighborsOf(ctx context.Context, entities []string, limit int, f FactFilter) ([]model.Triple, error) {
+	if len(entities) == 0 || limit <= 0 {
+		return nil, nil
+	}
+	cond, condArgs := f.where()
+	args := make([]any, 0, 2*len(entities)+len(condArgs)+1)
+	for _, e := range entities {
+		args = append(args, e)
+	}
+	for _, e := range entities {
+		args = append(args, e)
+	}
+	args = append(append(args, condArgs...), limit)
+	in := placeholders(len(entities))
+	rows, err := s.reader.QueryContext(ctx, `
+        SELECT `+tripleColumns+`
         FROM triples
-        WHERE subject = ? OR object = ?
+        WHERE (subject IN (`+in+`) OR object IN (`+in+`))`+cond+`
         ORDER BY confidence DESC, created_at DESC
         LIMIT ?;
-    `, entity, entity, limit)
+    `, args...)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return scanTriples(rows)
+}
+
+// Neighborhood returns the current triples reachable from entity within depth
+// hops, treating edges as undirected and staying inside namespace (all
+// namespaces when empty). Each triple is returned once, annotated with the
+// hop at which it was first reached; cycles are cut by tracking visited
+// entities, and limit bounds the total result size.
+func (s *Store) Neighborhood(ctx context.Context, namespace, entity string, depth, limit int) ([]model.Triple, error) {
+	entity, err := s.resolve(ctx, s.reader, namespace, entity)
+	if err != nil {
+		return nil, err
+	}
+	return s.neighborhood(ctx, entity, depth, limit, FactFilter{Namespace: namespace})
+}
+
+// clampDepth maps a traversal depth into [1, maxNeighborhoodDepth].
+func clampDepth(depth int) int {
+	return min(max(depth, 1), maxNeighborhoodDepth)
+}
+
+// neighborhood is Neighborhood over the triples matching f, from an entity
+// already resolved.
+func (s *Store) neighborhood(ctx context.Context, entity string, depth, limit int, f FactFilter) ([]model.Triple, error) {
+	cond, condArgs := f.where()
+	return Traverse(ctx, entity, depth, limit, func(ctx context.Context, frontier []string, limit int) ([]model.Triple, error) {
+		args := make([]any, 0, 2*len(frontier)+len(condArgs)+1)
+		for _, e := range frontier {
+			args = append(args, e)
+		}
+		for _, e := range frontier {
+			args = append(args, e)
+		}
+		args = append(args, condArgs...)
+		args = append(args, limit)
+		in := placeholders(len(frontier))
+		rows, err := s.reader.QueryContext(ctx, `
+        SELECT `+tripleColumns+`
+        FROM triples
+        WHERE (subject IN (`+in+`) OR object IN (`+in+`))`+cond+`
+        ORDER BY confidence DESC, created_at DESC
+        LIMIT ?;
+    `, args...)
+		if err != nil {
+			return nil, err
+		}
+		return scanTriples(rows)
+	})
+}
 
-	var res []model.Triple
+// LevelFunc returns the triples touching any of entities, most confident
+// first, at most limit.
+type LevelFunc func(ctx context.Context, entities []string, limit int) ([]model.Triple, error)
+
+// Traverse is Neighborhood from an entity already resolved, reading each
+// hop from level.
+func Traverse(ctx context.Context, entity string, depth, limit int, level LevelFunc) ([]model.Triple, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	depth = clampDepth(depth)
+	visited := map[string]bool{entity: true}
+	seen := make(map[int64]bool)
+	frontier := []string{entity}
+	var out []model.Triple
+
+	for hop := 1; hop <= depth && len(frontier) > 0 && len(out) < limit; hop++ {
+		// over-fetch by the triples already seen, which reappear as edges
+		// back into the previous level
+		triples, err := level(ctx, frontier, limit-len(out)+len(seen))
+		if err != nil {
+			return nil, err
+		}
+
+		var next []string
+		for _, t := range triples {
+			if seen[t.ID] || len(out) >= limit {
+				continue
+			}
+			seen[t.ID] = true
+			t.Hop = hop
+			out = append(out, t)
+			for _, e := range []string{t.Subject, t.Object} {
+				if !visited[e] {
+					visited[e] = true
+					next = append(next, e)
+				}
+			}
+		}
+		frontier = next
+	}
+	return out, nil
+}
+
+// maxNeighborhoodDepth caps traversal depth to keep queries bounded.
+const maxNeighborhoodDepth = 5
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanTriple reads a row selected with tripleColumns.
+func scanTriple(row scanner) (*model.Triple, error) {
+	var t model.Triple
+	var accessed sql.NullTime
+	var superseded sql.NullInt64
+	var validFrom, validTo sql.NullTime
+	if err := row.Scan(&t.ID, &t.Subject, &t.Predicate, &t.Object, &t.Confidence, &t.CreatedAt, &t.ObservationCount,
+		&t.SubjectLabel, &t.ObjectLabel, &t.Namespace, &accessed, &t.AccessCount, &superseded, &validFrom, &validTo); err != nil {
+		return nil, err
+	}
+	if accessed.Valid {
+		t.LastAccessedAt = &accessed.Time
+	}
+	if validFrom.Valid {
+		t.ValidFrom = &validFrom.Time
+	}
+	if validTo.Valid {
+		t.ValidTo = &validTo.Time
+	}
+	t.SupersededBy = superseded.Int64
+	return &t, nil
+}
+
+func scanTriples(rows *sql.Rows) ([]model.Triple, error) {
+	defer rows.Close()
+	var out []model.Triple
 	for rows.Next() {
-		var t model.Triple
-		if err := rows.Scan(&t.ID, &t.Subject, &t.Predicate, &t.Object, &t.Confidence, &t.CreatedAt); err != nil {
+		t, err := scanTriple(rows)
+		if err != nil {
 			return nil, err
 		}
-		res = append(res, t)
+		out = append(out, *t)
+	}
+	return out, rows.Err()
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+// DeleteTriple removes a triple of namespace (any namespace when empty) by
+// id. It returns sql.ErrNoRows when there is no such triple. Like every
+// delete of triples, it hands the triples the removed one superseded to its
+// successor, or makes them current again when it had none.
+func (s *Store) DeleteTriple(ctx context.Context, namespace string, id int64) error {
+	cond, args := namespaceCond(namespace)
+	res, err := s.db.ExecContext(ctx, `DELETE FROM triples WHERE id = ?`+cond+`;`, append([]any{id}, args...)...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ErrNoFilter is returned by DeleteMatching when every field is a wildcard.
+var ErrNoFilter = errors.New("at least one of subject, predicate or object is required")
+
+// DeleteMatching removes triples of namespace matching the given fields
+// exactly, where an empty string is a wildcard, and returns the number of
+// removed rows. It refuses to run with all fields empty; use DeleteAll for
+// that. An empty namespace matches all.
+func (s *Store) DeleteMatching(ctx context.Context, namespace, subject, predicate, object string) (int64, error) {
+	var conds []string
+	var args []any
+	var err error
+	if subject, err = s.resolve(ctx, s.db, namespace, subject); err != nil {
+		return 0, err
+	}
+	if object, err = s.resolve(ctx, s.db, namespace, object); err != nil {
+		return 0, err
+	}
+	for _, f := range []struct{ col, val string }{{"subject", subject}, {"predicate", predicate}, {"object", object}} {
+		if f.val != "" {
+			conds = append(conds, f.col+" = ?")
+			args = append(args, f.val)
+		}
+	}
+	if len(conds) == 0 {
+		return 0, ErrNoFilter
+	}
+	nsCond, nsArgs := namespaceCond(namespace)
+	res, err := s.db.ExecContext(ctx, `DELETE FROM triples WHERE `+strings.Join(conds, " AND ")+nsCond+`;`, append(args, nsArgs...)...)
+	if err != nil {
+		return 0, err
 	}
-	return res, rows.Err()
+	return res.RowsAffected()
 }
 
-// DeleteAll clears triples. Useful for tests.
-func (s *Store) DeleteAll(ctx context.Context) error {
-	_, err := s.db.ExecContext(ctx, `DELETE FROM triples; VACUUM;`)
-	return err
+// DeleteAll clears the triples of namespace, or every triple when namespace
+// is empty, and returns how many were removed.
+func (s *Store) DeleteAll(ctx context.Context, namespace string) (int64, error) {
+	cond, args := namespaceCond(namespace)
+	res, err := s.db.ExecContext(ctx, `DELETE FROM triples WHERE 1 = 1`+cond+`;`, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
 }
 
-// DebugDump returns all triples for logging.
+// DebugDump returns all triples of every namespace for logging.
 func (s *Store) DebugDump(ctx context.Context) ([]model.Triple, error) {
-	return s.SearchFacts(ctx, "", 100)
+	var all []model.Triple
+	params := ListParams{Limit: maxListLimit}
+	for {
+		page, err := s.ListTriples(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page.Triples...)
+		if page.NextCursor == 0 {
+			return all, nil
+		}
+		params.Cursor = page.NextCursor
+	}
 }
 
 func (s *Store) Count(ctx context.Context) (int64, error) {
 	var n int64
-	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM triples;`).Scan(&n); err != nil {
+	if err := s.reader.QueryRowContext(ctx, `SELECT COUNT(*) FROM triples;`).Scan(&n); err != nil {
 		return 0, err
 	}
 	return n, nil
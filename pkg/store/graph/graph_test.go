@@ -0,0 +1,396 @@
+package graph_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store/graph"
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+// newTestStore returns a graph store on a fresh database in a temporary
+// directory, closed when the test ends.
+func newTestStore(t *testing.T, cfg graph.Config) (*graph.Store, *sqlite.Database) {
+	t.Helper()
+	db := storetest.NewTestDatabase(t, sqlite.Config{})
+	cfg.Reader = db.Reader()
+	return graph.NewWithConfig(db.Writer(), cfg), db
+}
+
+// upsert writes triples, with a confidence of 0.8 where none is set.
+func upsert(t *testing.T, s *graph.Store, triples ...model.Triple) []graph.UpsertResult {
+	t.Helper()
+	for i := range triples {
+		if triples[i].Confidence == 0 {
+			triples[i].Confidence = 0.8
+		}
+	}
+	res, err := s.UpsertTriples(context.Background(), triples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func spo(s, p, o string) model.Triple {
+	return model.Triple{Subject: s, Predicate: p, Object: o}
+}
+
+func keys(triples []model.Triple) []string {
+	out := make([]string, len(triples))
+	for i, t := range triples {
+		out[i] = t.Subject + " " + t.Predicate + " " + t.Object
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestNeighborhoodTerminatesOnCycles(t *testing.T) {
+	s, _ := newTestStore(t, graph.Config{})
+	upsert(t, s,
+		spo("a", "next", "b"),
+		spo("b", "next", "c"),
+		spo("c", "next", "a"),
+		spo("c", "next", "d"),
+		spo("a", "self", "a"),
+	)
+	got, err := s.Neighborhood(context.Background(), "", "a", 5, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 5 {
+		t.Fatalf("Neighborhood = %q, want every triple once", keys(got))
+	}
+	hops := make(map[string]int)
+	for _, tr := range got {
+		hops[tr.Subject+">"+tr.Object] = tr.Hop
+	}
+	want := map[string]int{"a>b": 1, "c>a": 1, "a>a": 1, "b>c": 2, "c>d": 2}
+	for k, hop := range want {
+		if hops[k] != hop {
+			t.Errorf("hop of %s = %d, want %d", k, hops[k], hop)
+		}
+	}
+}
+
+func TestNeighborhoodDepthAndLimit(t *testing.T) {
+	s, _ := newTestStore(t, graph.Config{})
+	upsert(t, s, spo("a", "next", "b"), spo("b", "next", "c"), spo("c", "next", "d"))
+	ctx := context.Background()
+
+	got, err := s.Neighborhood(ctx, "", "a", 2, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a next b", "b next c"}; !slices.Equal(keys(got), want) {
+		t.Fatalf("depth 2 = %q, want %q", keys(got), want)
+	}
+	if got, err = s.Neighborhood(ctx, "", "a", 5, 2); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("limit 2 returned %d triples", len(got))
+	}
+	if got, err = s.Neighborhood(ctx, "", "nobody", 3, 10); err != nil || len(got) != 0 {
+		t.Fatalf("unknown entity = %q, %v", keys(got), err)
+	}
+}
+
+func TestNeighborhoodSkipsSupersededFacts(t *testing.T) {
+	s, _ := newTestStore(t, graph.Config{FunctionalPredicates: []string{"lives_in"}})
+	upsert(t, s, spo("alice", "lives_in", "paris"))
+	upsert(t, s, spo("alice", "lives_in", "berlin"))
+
+	got, err := s.Neighborhood(context.Background(), "", "alice", 2, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"alice lives_in berlin"}; !slices.Equal(keys(got), want) {
+		t.Fatalf("Neighborhood = %q, want %q", keys(got), want)
+	}
+}
+
+func TestDeleteMatchingWildcards(t *testing.T) {
+	tests := []struct {
+		subject, predicate, object string
+		want                       []string
+	}{
+		{"alice", "", "", []string{"bob likes tea", "bob works_at acme"}},
+		{"", "works_at", "", []string{"alice likes tea", "bob likes tea"}},
+		{"", "", "tea", []string{"alice works_at acme", "bob works_at acme"}},
+		{"alice", "likes", "", []string{"alice works_at acme", "bob likes tea", "bob works_at acme"}},
+		{"", "likes", "tea", []string{"alice works_at acme", "bob works_at acme"}},
+		{"bob", "works_at", "acme", []string{"alice likes tea", "alice works_at acme", "bob likes tea"}},
+		{"carol", "", "", []string{"alice likes tea", "alice works_at acme", "bob likes tea", "bob works_at acme"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.subject+"|"+tt.predicate+"|"+tt.object, func(t *testing.T) {
+			ctx := context.Background()
+			s, _ := newTestStore(t, graph.Config{})
+			upsert(t, s,
+				spo("alice", "works_at", "acme"),
+				spo("alice", "likes", "tea"),
+				spo("bob", "works_at", "acme"),
+				spo("bob", "likes", "tea"),
+			)
+			n, err := s.DeleteMatching(ctx, "", tt.subject, tt.predicate, tt.object)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := int64(4 - len(tt.want)); n != want {
+				t.Errorf("DeleteMatching removed %d, want %d", n, want)
+			}
+			left, err := s.DebugDump(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := keys(left); !slices.Equal(got, tt.want) {
+				t.Fatalf("left %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteMatchingRefusesAnEmptyFilter(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, graph.Config{})
+	upsert(t, s, spo("alice", "works_at", "acme"))
+	if _, err := s.DeleteMatching(ctx, "", "", "", ""); !errors.Is(err, graph.ErrNoFilter) {
+		t.Fatalf("DeleteMatching with no filter = %v, want ErrNoFilter", err)
+	}
+	if n, err := s.Count(ctx); err != nil || n != 1 {
+		t.Fatalf("Count = %d, %v; want the triple kept", n, err)
+	}
+}
+
+func TestUpsertMergeStrategies(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   graph.Config
+		confs []float64
+		want  float64
+	}{
+		{"reinforce", graph.Config{}, []float64{0.4, 0.4}, 0.4 + 0.6*0.4*0.5},
+		{"reinforce rate", graph.Config{ReinforceRate: 1}, []float64{0.5, 0.5}, 0.75},
+		{"reinforce never exceeds one", graph.Config{ReinforceRate: 1}, []float64{0.9, 1, 1}, 1},
+		{"max keeps the higher", graph.Config{Merge: graph.MergeMax}, []float64{0.9, 0.2}, 0.9},
+		{"max raises", graph.Config{Merge: graph.MergeMax}, []float64{0.2, 0.9}, 0.9},
+		{"replace", graph.Config{Merge: graph.MergeReplace}, []float64{0.9, 0.2}, 0.2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s, _ := newTestStore(t, tt.cfg)
+			var first int64
+			for i, c := range tt.confs {
+				tr := spo("alice", "likes", "tea")
+				tr.Confidence = c
+				res, err := s.UpsertTriple(ctx, tr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				id := res.ID
+				if i == 0 {
+					first = id
+					continue
+				}
+				if id != first {
+					t.Fatalf("upsert %d wrote row %d, want an update of row %d", i, id, first)
+				}
+			}
+			got, err := s.GetTriple(ctx, first)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(got.Confidence-tt.want) > 1e-9 {
+				t.Errorf("confidence = %v, want %v", got.Confidence, tt.want)
+			}
+			if got.ObservationCount != len(tt.confs) {
+				t.Errorf("observation count = %d, want %d", got.ObservationCount, len(tt.confs))
+			}
+		})
+	}
+}
+
+func TestUpsertReturnsTheStoredRowID(t *testing.T) {
+	s, db := newTestStore(t, graph.Config{})
+	// other rows, so a stale last insert id would point elsewhere
+	upsert(t, s, spo("alice", "works_at", "acme"), spo("bob", "lives_in", "berlin"))
+	res := upsert(t, s,
+		spo("carol", "knows", "dave"),
+		spo("alice", "works_at", "acme"),
+		spo("carol", "knows", "dave"),
+	)
+	if !res[0].Inserted || res[1].Inserted || res[2].Inserted {
+		t.Fatalf("results = %+v, want insert, update, update", res)
+	}
+	if res[2].ID != res[0].ID {
+		t.Errorf("repeated upsert returned id %d, want %d", res[2].ID, res[0].ID)
+	}
+	for i, tr := range []model.Triple{spo("carol", "knows", "dave"), spo("alice", "works_at", "acme")} {
+		var id int64
+		err := db.DB().QueryRow(`SELECT id FROM triples WHERE subject = ? AND predicate = ? AND object = ?`,
+			tr.Subject, tr.Predicate, tr.Object).Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res[i].ID != id {
+			t.Errorf("upsert of %s %s %s returned id %d, row has id %d", tr.Subject, tr.Predicate, tr.Object, res[i].ID, id)
+		}
+	}
+}
+
+func TestUpsertTriplesRollsBackTheWholeBatch(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, graph.Config{})
+	upsert(t, s, spo("alice", "works_at", "acme"))
+
+	orphan := spo("bob", "knows", "carol")
+	// violates the foreign key on triple_sources
+	orphan.Sources = []string{"no-such-log"}
+	_, err := s.UpsertTriples(ctx, []model.Triple{
+		{Subject: "alice", Predicate: "works_at", Object: "acme", Confidence: 0.9},
+		{Subject: "dave", Predicate: "likes", Object: "tea", Confidence: 0.5},
+		orphan,
+	})
+	if err == nil {
+		t.Fatal("UpsertTriples with a dangling source succeeded")
+	}
+	if !strings.Contains(err.Error(), "triple 2") {
+		t.Errorf("error %q does not name the failing triple", err)
+	}
+	got, err := s.ListTriples(ctx, graph.ListParams{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Triples) != 1 || got.Triples[0].ObservationCount != 1 || got.Triples[0].Confidence != 0.8 {
+		t.Fatalf("triples after the failed batch = %+v, want alice untouched", got.Triples)
+	}
+
+	// a failing hook undoes the triples too
+	_, err = s.UpsertTriplesWith(ctx, []model.Triple{spo("erin", "likes", "tea")}, func(*sql.Tx) error {
+		return errors.New("hook failed")
+	})
+	if err == nil {
+		t.Fatal("UpsertTriplesWith ignored its hook's error")
+	}
+	if n, err := s.Count(ctx); err != nil || n != 1 {
+		t.Fatalf("Count = %d, %v; want the hook's batch rolled back", n, err)
+	}
+}
+
+func TestNeighborsOf(t *testing.T) {
+	s, _ := newTestStore(t, graph.Config{})
+	weak := spo("b", "near", "c")
+	weak.Confidence = 0.3
+	upsert(t, s, spo("a", "next", "b"), weak, spo("x", "next", "y"), spo("c", "next", "d"))
+	ctx := context.Background()
+
+	got, err := s.NeighborsOf(ctx, []string{"b"}, 10, graph.FactFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Confidence < got[1].Confidence {
+		t.Fatalf("neighbours of b = %q, want both of its facts, most confident first", keys(got))
+	}
+	if got, err = s.NeighborsOf(ctx, []string{"b", "x"}, 10, graph.FactFilter{MinConfidence: 0.5}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a next b", "x next y"}; !slices.Equal(keys(got), want) {
+		t.Errorf("confident neighbours of b and x = %q, want %q", keys(got), want)
+	}
+	if got, err = s.NeighborsOf(ctx, []string{"b"}, 1, graph.FactFilter{}); err != nil || len(got) != 1 {
+		t.Errorf("limit 1 = %q, %v", keys(got), err)
+	}
+	for _, entities := range [][]string{nil, {"nobody"}} {
+		if got, err := s.NeighborsOf(ctx, entities, 10, graph.FactFilter{}); err != nil || len(got) != 0 {
+			t.Errorf("neighbours of %q = %q, %v; want none", entities, keys(got), err)
+		}
+	}
+}
+
+func TestNeighborsByDirection(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, graph.Config{})
+	weak := spo("bob", "knows", "alice")
+	weak.Confidence = 0.3
+	upsert(t, s,
+		spo("alice", "works_at", "acme"),
+		spo("alice", "likes", "alice"),
+		weak,
+		spo("acme", "located_in", "berlin"),
+	)
+
+	n, err := s.Neighbors(ctx, " Alice ", 1, 10, graph.FactFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Entity != "alice" || n.Depth != 1 {
+		t.Errorf("Neighbors = entity %q depth %d, want alice at depth 1", n.Entity, n.Depth)
+	}
+	if got := keys(n.Outgoing); !slices.Equal(got, []string{"alice likes alice", "alice works_at acme"}) {
+		t.Errorf("outgoing = %q", got)
+	}
+	if got := keys(n.Incoming); !slices.Equal(got, []string{"bob knows alice"}) {
+		t.Errorf("incoming = %q, want bob's fact only", got)
+	}
+	// the self-loop counts in both directions but once in the total
+	if n.Degree != (graph.Degree{Out: 2, In: 2, Total: 3}) {
+		t.Errorf("degree = %+v, want 2 out, 2 in, 3 in total", n.Degree)
+	}
+
+	n, err = s.Neighbors(ctx, "alice", 2, 10, graph.FactFilter{MinConfidence: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(n.Incoming) != 0 || len(n.Outgoing) != 2 || !slices.Contains(keys(n.Facts), "acme located_in berlin") {
+		t.Errorf("confident neighbours at depth 2 = out %q, in %q, facts %q", keys(n.Outgoing), keys(n.Incoming), keys(n.Facts))
+	}
+	if n.Degree.Total != 3 {
+		t.Errorf("degree under a filter = %+v, want every fact counted", n.Degree)
+	}
+
+	n, err = s.Neighbors(ctx, "nobody", 1, 10, graph.FactFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Degree.Total != 0 || n.Facts == nil || n.Outgoing == nil || n.Incoming == nil {
+		t.Errorf("neighbours of an unknown entity = %+v, want empty lists", n)
+	}
+}
+
+func TestSearchFactsRanksByConfidence(t *testing.T) {
+	s, _ := newTestStore(t, graph.Config{})
+	low, high, older, newer := spo("alice", "knows", "bob"), spo("alice", "works_at", "acme"), spo("alice", "likes", "tea"), spo("alice", "likes", "jazz")
+	low.Confidence, high.Confidence, older.Confidence, newer.Confidence = 0.2, 0.9, 0.5, 0.5
+	// upserted one at a time so that newer is created last
+	for _, tr := range []model.Triple{low, older, high, newer} {
+		upsert(t, s, tr)
+	}
+
+	got, err := s.SearchFacts(context.Background(), "alice", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for _, tr := range got {
+		order = append(order, tr.Object)
+	}
+	if want := []string{"acme", "jazz", "tea", "bob"}; !slices.Equal(order, want) {
+		t.Errorf("order = %q, want %q", order, want)
+	}
+	if got, err = s.SearchFacts(context.Background(), "alice", 10, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Errorf("%d facts at confidence 0.5 or more, want 3 (the threshold is inclusive)", len(got))
+	}
+}
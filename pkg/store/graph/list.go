@@ -0,0 +1,176 @@
+package graph
+
+import (
+	"context"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+// ListParams selects a page of triples ordered by id. Subject, Predicate
+// and Object match according to Match (entities after normalization and
+// alias resolution); empty fields match anything. With MatchAny or MatchAll
+// a field matches when it contains any or all of the words of its term.
+// Namespace matches exactly.
+type ListParams struct {
+	Namespace     string
+	Subject       string
+	Predicate     string
+	Object        string
+	MinConfidence float64
+	// IncludeSuperseded lists superseded triples too (see
+	// FactFilter.IncludeSuperseded).
+	IncludeSuperseded bool
+	// AsOf lists only triples valid at that instant (see FactFilter.AsOf).
+	AsOf time.Time
+	// Match defaults to MatchExact.
+	Match MatchMode
+	// Cursor is the NextCursor of the previous page; 0 starts from the top.
+	Cursor int64
+	// Limit defaults to 50 and is capped at 500.
+	Limit int
+}
+
+// ListResult is one page of ListTriples.
+type ListResult struct {
+	Triples []model.Triple `json:"facts"`
+	// NextCursor continues the listing; 0 when this is the last page.
+	NextCursor int64 `json:"next_cursor,omitempty"`
+	// Remaining counts matching triples after this page at query time.
+	Remaining int64 `json:"remaining"`
+}
+
+// ListTriples pages through triples by ascending id. Paging on id keeps the
+// cursor stable while new triples are inserted: they only ever appear on
+// later pages.
+func (s *Store) ListTriples(ctx context.Context, p ListParams) (ListResult, error) {
+	if p.Limit <= 0 {
+		p.Limit = defaultListLimit
+	}
+	if p.Limit > maxListLimit {
+		p.Limit = maxListLimit
+	}
+	subject, err := s.listTerms(ctx, p.Namespace, p.Match, p.Subject, true)
+	if err != nil {
+		return ListResult{}, err
+	}
+	object, err := s.listTerms(ctx, p.Namespace, p.Match, p.Object, true)
+	if err != nil {
+		return ListResult{}, err
+	}
+	predicate, _ := s.listTerms(ctx, p.Namespace, p.Match, p.Predicate, false)
+
+	cond := ` WHERE id > ?`
+	args := []any{p.Cursor}
+	if p.Namespace != "" {
+		cond += ` AND namespace = ?`
+		args = append(args, p.Namespace)
+	}
+	for _, f := range []struct {
+		column string
+		terms  []string
+	}{
+		{"subject", subject}, {"predicate", predicate}, {"object", object},
+	} {
+		if len(f.terms) == 0 {
+			continue
+		}
+		c, a := p.Match.termsCondition(f.column, f.terms)
+		cond += ` AND ` + c
+		args = append(args, a...)
+	}
+	if p.MinConfidence > 0 {
+		cond += ` AND confidence >= ?`
+		args = append(args, p.MinConfidence)
+	}
+	switch {
+	case !p.AsOf.IsZero():
+		where, whereArgs := validAt(p.AsOf)
+		cond += where
+		args = append(args, whereArgs...)
+	case !p.IncludeSuperseded:
+		cond += ` AND superseded_by IS NULL`
+	}
+
+	rows, err := s.reader.QueryContext(ctx, `SELECT `+tripleColumns+` FROM triples`+cond+` ORDER BY id LIMIT ?;`, append(args, p.Limit)...)
+	if err != nil {
+		return ListResult{}, err
+	}
+	triples, err := scanTriples(rows)
+	if err != nil {
+		return ListResult{}, err
+	}
+	res := ListResult{Triples: triples}
+	if len(triples) < p.Limit {
+		return res, nil
+	}
+
+	last := triples[len(triples)-1].ID
+	args[0] = last
+	if err := s.reader.QueryRowContext(ctx, `SELECT COUNT(*) FROM triples`+cond+`;`, args...).Scan(&res.Remaining); err != nil {
+		return ListResult{}, err
+	}
+	if res.Remaining > 0 {
+		res.NextCursor = last
+	}
+	return res, nil
+}
+
+// SourcesOf returns the source log ids of each given triple.
+func (s *Store) SourcesOf(ctx context.Context, ids []int64) (map[int64][]string, error) {
+	out := make(map[int64][]string, len(ids))
+	if len(ids) == 0 {
+		return out, nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := s.reader.QueryContext(ctx, `
+        SELECT triple_id, log_id FROM triple_sources
+        WHERE triple_id IN (`+placeholders(len(ids))+`)
+        ORDER BY triple_id, log_id;
+    `, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var logID string
+		if err := rows.Scan(&id, &logID); err != nil {
+			return nil, err
+		}
+		out[id] = append(out[id], logID)
+	}
+	return out, rows.Err()
+}
+
+// listTerms returns what a ListParams field matches: its words for a
+// tokenized mode, else the term itself, or nothing for an empty term.
+// Entities are resolved through the aliases of namespace, each word on its
+// own.
+func (s *Store) listTerms(ctx context.Context, namespace string, mode MatchMode, term string, entity bool) ([]string, error) {
+	terms := []string{term}
+	if mode.Tokenized() {
+		terms = Tokenize(term)
+	}
+	out := make([]string, 0, len(terms))
+	for _, t := range terms {
+		if entity {
+			var err error
+			if t, err = s.resolve(ctx, s.reader, namespace, t); err != nil {
+				return nil, err
+			}
+		}
+		if t != "" {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,84 @@
+package graph_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/store/graph"
+)
+
+func TestListTriplesFilters(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, graph.Config{})
+	weak := spo("bob", "likes", "tea")
+	weak.Confidence = 0.3
+	upsert(t, s,
+		spo("alice", "likes", "tea"),
+		spo("alice", "works_at", "acme"),
+		spo("bob", "works_at", "acme"),
+		weak,
+	)
+	tests := []struct {
+		name string
+		p    graph.ListParams
+		want []string
+	}{
+		{"all", graph.ListParams{}, []string{"alice likes tea", "alice works_at acme", "bob likes tea", "bob works_at acme"}},
+		{"subject", graph.ListParams{Subject: "Alice"}, []string{"alice likes tea", "alice works_at acme"}},
+		{"predicate", graph.ListParams{Predicate: "works_at"}, []string{"alice works_at acme", "bob works_at acme"}},
+		{"object", graph.ListParams{Object: "tea"}, []string{"alice likes tea", "bob likes tea"}},
+		{"subject and predicate", graph.ListParams{Subject: "bob", Predicate: "likes"}, []string{"bob likes tea"}},
+		{"all three", graph.ListParams{Subject: "alice", Predicate: "works_at", Object: "acme"}, []string{"alice works_at acme"}},
+		{"min confidence", graph.ListParams{Object: "tea", MinConfidence: 0.5}, []string{"alice likes tea"}},
+		{"no match", graph.ListParams{Subject: "carol"}, []string{}},
+		{"other namespace", graph.ListParams{Namespace: "work"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := s.ListTriples(ctx, tt.p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := keys(res.Triples); !slices.Equal(got, tt.want) {
+				t.Fatalf("ListTriples = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListTriplesCursorIsStable(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, graph.Config{})
+	for i := 0; i < 5; i++ {
+		upsert(t, s, spo(fmt.Sprintf("e%d", i), "is", "x"))
+	}
+
+	var seen []string
+	p := graph.ListParams{Limit: 2}
+	for page := 0; ; page++ {
+		res, err := s.ListTriples(ctx, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tr := range res.Triples {
+			seen = append(seen, tr.Subject)
+		}
+		if page == 0 {
+			if res.Remaining != 3 {
+				t.Fatalf("remaining after the first page = %d, want 3", res.Remaining)
+			}
+			// inserted while paging: shows up on a later page, once
+			upsert(t, s, spo("late", "is", "x"))
+		}
+		if res.NextCursor == 0 {
+			break
+		}
+		p.Cursor = res.NextCursor
+	}
+	want := []string{"e0", "e1", "e2", "e3", "e4", "late"}
+	if !slices.Equal(seen, want) {
+		t.Fatalf("paged through %q, want %q", seen, want)
+	}
+}
@@ -0,0 +1,115 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// MatchMode selects how a search term matches an entity or predicate.
+type MatchMode string
+
+const (
+	// MatchExact requires equality.
+	MatchExact MatchMode = "exact"
+	// MatchPrefix requires the value to start with the term.
+	MatchPrefix MatchMode = "prefix"
+	// MatchContains requires the value to contain the term.
+	MatchContains MatchMode = "contains"
+	// MatchPhrase is MatchContains: the whole term, words in order.
+	MatchPhrase MatchMode = "phrase"
+	// MatchAny splits the term into words (see Tokenize) and requires the
+	// value to contain at least one of them; searches rank values
+	// containing more words first.
+	MatchAny MatchMode = "any"
+	// MatchAll splits the term into words and requires every word to be
+	// contained, in any order.
+	MatchAll MatchMode = "all"
+)
+
+// MaxSearchTokens bounds the words MatchAny and MatchAll search for; later
+// words are ignored.
+const MaxSearchTokens = 8
+
+// ParseMatchMode validates a match mode name; empty is returned as is so
+// callers can apply their own default.
+func ParseMatchMode(s string) (MatchMode, error) {
+	switch m := MatchMode(s); m {
+	case "", MatchExact, MatchPrefix, MatchContains, MatchPhrase, MatchAny, MatchAll:
+		return m, nil
+	}
+	return "", fmt.Errorf("match mode must be one of %q, %q, %q, %q, %q or %q, got %q",
+		MatchExact, MatchPrefix, MatchContains, MatchPhrase, MatchAny, MatchAll, s)
+}
+
+// Tokenized reports whether m matches the words of a term separately.
+func (m MatchMode) Tokenized() bool {
+	return m == MatchAny || m == MatchAll
+}
+
+// Tokenize splits a term into the distinct words MatchAny and MatchAll
+// search for, at most MaxSearchTokens. Single-character words match too
+// much to be useful and are dropped, unless the term has no longer ones.
+func Tokenize(term string) []string {
+	var words, short []string
+	seen := make(map[string]bool)
+	for _, w := range strings.Fields(term) {
+		if seen[w] {
+			continue
+		}
+		seen[w] = true
+		if utf8.RuneCountInString(w) == 1 {
+			short = append(short, w)
+		} else {
+			words = append(words, w)
+		}
+	}
+	if len(words) == 0 {
+		words = short
+	}
+	if len(words) > MaxSearchTokens {
+		words = words[:MaxSearchTokens]
+	}
+	return words
+}
+
+// condition returns an SQL condition matching column against term in mode m,
+// and its argument. Prefix and contains use LIKE with the term's own
+// wildcards escaped, so '%' and '_' match literally.
+func (m MatchMode) condition(column, term string) (string, any) {
+	switch m {
+	case MatchPrefix:
+		return column + ` LIKE ? ESCAPE '\'`, EscapeLike(term) + "%"
+	case MatchContains, MatchPhrase, MatchAny, MatchAll:
+		return column + ` LIKE ? ESCAPE '\'`, "%" + EscapeLike(term) + "%"
+	default:
+		return column + ` = ?`, term
+	}
+}
+
+// termsCondition matches column against the words of a tokenized mode:
+// any of them for MatchAny, all of them for MatchAll. Other modes match the
+// single term terms[0].
+func (m MatchMode) termsCondition(column string, terms []string) (string, []any) {
+	if !m.Tokenized() || len(terms) == 1 {
+		c, arg := m.condition(column, terms[0])
+		return c, []any{arg}
+	}
+	join := " OR "
+	if m == MatchAll {
+		join = " AND "
+	}
+	conds := make([]string, len(terms))
+	args := make([]any, len(terms))
+	for i, t := range terms {
+		conds[i], args[i] = m.condition(column, t)
+	}
+	return "(" + strings.Join(conds, join) + ")", args
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// EscapeLike escapes the LIKE wildcards of s for use with ESCAPE '\'.
+func EscapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -0,0 +1,260 @@
+package graph_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store/graph"
+)
+
+func TestSearchFactsMatchModes(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, graph.Config{})
+	upsert(t, s,
+		spo("alice", "works_at", "acme"),
+		spo("alice", "likes", "tea"),
+		spo("alice_smith", "works_at", "initech"),
+		spo("malice", "works_at", "evil corp"),
+		spo("bob", "knows", "alice"),
+		spo("aliceX", "likes", "coffee"),
+	)
+	tests := []struct {
+		name string
+		term string
+		f    graph.FactFilter
+		want []string
+	}{
+		{"contains by default", "alice", graph.FactFilter{}, []string{
+			"alice likes tea", "alice works_at acme", "alice_smith works_at initech",
+			"alicex likes coffee", "bob knows alice", "malice works_at evil corp",
+		}},
+		{"prefix", "alice", graph.FactFilter{Match: graph.MatchPrefix}, []string{
+			"alice likes tea", "alice works_at acme", "alice_smith works_at initech",
+			"alicex likes coffee", "bob knows alice",
+		}},
+		{"exact", "alice", graph.FactFilter{Match: graph.MatchExact}, []string{"alice likes tea", "alice works_at acme", "bob knows alice"}},
+		{"underscore is literal", "alice_", graph.FactFilter{Match: graph.MatchPrefix}, []string{"alice_smith works_at initech"}},
+		{"percent is literal", "%", graph.FactFilter{}, []string{}},
+		{"predicate", "alice", graph.FactFilter{Predicate: "works_at"}, []string{"alice works_at acme", "alice_smith works_at initech", "malice works_at evil corp"}},
+		{"predicate and exact", "alice", graph.FactFilter{Predicate: "likes", Match: graph.MatchExact}, []string{"alice likes tea"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.SearchFactsFiltered(ctx, tt.term, 20, tt.f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if k := keys(got); !slices.Equal(k, tt.want) {
+				t.Errorf("SearchFactsFiltered(%q) = %q, want %q", tt.term, k, tt.want)
+			}
+		})
+	}
+}
+
+func TestListTriplesMatchModes(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, graph.Config{})
+	upsert(t, s,
+		spo("alice", "works_at", "acme"),
+		spo("alice", "works_for", "acme"),
+		spo("bob", "worksxat", "acme"),
+	)
+	for _, tt := range []struct {
+		p    graph.ListParams
+		want []string
+	}{
+		{graph.ListParams{Predicate: "works"}, []string{}},
+		{graph.ListParams{Predicate: "works_", Match: graph.MatchPrefix}, []string{"alice works_at acme", "alice works_for acme"}},
+		{graph.ListParams{Predicate: "s_a", Match: graph.MatchContains}, []string{"alice works_at acme"}},
+		{graph.ListParams{Subject: "lic", Match: graph.MatchContains}, []string{"alice works_at acme", "alice works_for acme"}},
+	} {
+		res, err := s.ListTriples(ctx, tt.p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := keys(res.Triples); !slices.Equal(got, tt.want) {
+			t.Errorf("ListTriples(%+v) = %q, want %q", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestParseMatchMode(t *testing.T) {
+	for _, s := range []string{"", "exact", "prefix", "contains", "phrase", "any", "all"} {
+		if m, err := graph.ParseMatchMode(s); err != nil || string(m) != s {
+			t.Errorf("ParseMatchMode(%q) = %q, %v", s, m, err)
+		}
+	}
+	for _, s := range []string{"fuzzy", "Exact"} {
+		if _, err := graph.ParseMatchMode(s); err == nil {
+			t.Errorf("ParseMatchMode(%q) succeeded", s)
+		}
+	}
+}
+
+func TestSearchFactsLiteralWildcards(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, graph.Config{})
+	upsert(t, s,
+		spo("task", "status", "100%_done"),
+		spo("task", "estimate", "100 percent"),
+		spo("other", "status", "100xxdone"),
+		spo("report", "path", `c:\reports`),
+		spo("alice", "lives_in", "new york"),
+	)
+	for _, tt := range []struct {
+		term string
+		f    graph.FactFilter
+		want []string
+	}{
+		{"100%_done", graph.FactFilter{}, []string{"task status 100%_done"}},
+		{"%", graph.FactFilter{Predicate: "status"}, []string{"task status 100%_done"}},
+		{"_", graph.FactFilter{}, []string{"task status 100%_done"}},
+		{"100%", graph.FactFilter{Match: graph.MatchPrefix}, []string{"task status 100%_done"}},
+		{"%_done", graph.FactFilter{Match: graph.MatchExact}, []string{}},
+		{`\`, graph.FactFilter{}, []string{`report path c:\reports`}},
+		{`c:\r`, graph.FactFilter{Match: graph.MatchPrefix}, []string{`report path c:\reports`}},
+		{"100", graph.FactFilter{}, []string{"other status 100xxdone", "task estimate 100 percent", "task status 100%_done"}},
+		{"  new \t york ", graph.FactFilter{Match: graph.MatchExact}, []string{"alice lives_in new york"}},
+		{"w  yo", graph.FactFilter{}, []string{"alice lives_in new york"}},
+	} {
+		got, err := s.SearchFactsFiltered(ctx, tt.term, 20, tt.f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k := keys(got); !slices.Equal(k, tt.want) {
+			t.Errorf("SearchFactsFiltered(%q, %s) = %q, want %q", tt.term, tt.f.Match, k, tt.want)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	for _, tt := range []struct {
+		term string
+		want []string
+	}{
+		{"", []string{}},
+		{"alice", []string{"alice"}},
+		{"  alice   berlin ", []string{"alice", "berlin"}},
+		{"alice berlin alice", []string{"alice", "berlin"}},
+		// single characters are dropped next to longer words
+		{"a alice b berlin", []string{"alice", "berlin"}},
+		{"a b a", []string{"a", "b"}},
+		{"w1 w2 w3 w4 w5 w6 w7 w8 w9 w10", []string{"w1", "w2", "w3", "w4", "w5", "w6", "w7", "w8"}},
+	} {
+		if got := graph.Tokenize(tt.term); !slices.Equal(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", tt.term, got, tt.want)
+		}
+	}
+}
+
+func TestSearchFactsByWords(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, graph.Config{})
+	both := spo("alice", "moved_to", "berlin")
+	both.Confidence = 0.5
+	upsert(t, s,
+		spo("alice", "works_at", "acme"),
+		spo("bob", "lives_in", "berlin"),
+		both,
+		spo("carol", "likes", "tea"),
+	)
+	search := func(term string, mode graph.MatchMode) []model.Triple {
+		t.Helper()
+		got, err := s.SearchFactsFiltered(ctx, term, 20, graph.FactFilter{Match: mode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	// one word matches as a substring, as contains does
+	for _, mode := range []graph.MatchMode{graph.MatchAny, graph.MatchAll, graph.MatchPhrase} {
+		if got, want := keys(search("lic", mode)), keys(search("lic", graph.MatchContains)); !slices.Equal(got, want) {
+			t.Errorf("%s search for one word = %q, want %q as with contains", mode, got, want)
+		}
+	}
+	if got := search("alice berlin", graph.MatchContains); len(got) != 0 {
+		t.Errorf("contains search for two words = %q, want nothing", keys(got))
+	}
+	if got := keys(search("alice berlin", graph.MatchPhrase)); len(got) != 0 {
+		t.Errorf("phrase search for two words = %q, want nothing", got)
+	}
+
+	// the fact with both words ranks first despite its lower confidence
+	got := search("alice berlin", graph.MatchAny)
+	if len(got) != 3 || got[0].Object != "berlin" || got[0].Subject != "alice" {
+		t.Fatalf("any search = %q, want alice moved_to berlin first of 3", keys(got))
+	}
+	if k := keys(got[1:]); !slices.Equal(k, []string{"alice works_at acme", "bob lives_in berlin"}) {
+		t.Errorf("any search then returned %q", k)
+	}
+	if got := keys(search("berlin alice", graph.MatchAll)); !slices.Equal(got, []string{"alice moved_to berlin"}) {
+		t.Errorf("all search = %q, want only the fact with both words", got)
+	}
+	// a single-character word is ignored next to longer ones
+	if got := keys(search("a carol", graph.MatchAll)); !slices.Equal(got, []string{"carol likes tea"}) {
+		t.Errorf("all search with a short word = %q, want carol's fact", got)
+	}
+	if got := search("zed", graph.MatchAny); len(got) != 0 {
+		t.Errorf("any search for an unknown word = %q", keys(got))
+	}
+}
+
+func TestListTriplesByWords(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, graph.Config{})
+	upsert(t, s,
+		spo("alice smith", "works_at", "acme"),
+		spo("bob smith", "works_at", "acme"),
+		spo("alice jones", "lives_in", "berlin"),
+	)
+	for _, tt := range []struct {
+		p    graph.ListParams
+		want []string
+	}{
+		{graph.ListParams{Subject: "smith alice", Match: graph.MatchAny}, []string{"alice jones lives_in berlin", "alice smith works_at acme", "bob smith works_at acme"}},
+		{graph.ListParams{Subject: "smith alice", Match: graph.MatchAll}, []string{"alice smith works_at acme"}},
+		{graph.ListParams{Predicate: "lives works", Match: graph.MatchAll}, []string{}},
+		{graph.ListParams{Predicate: "lives works", Match: graph.MatchAny}, []string{"alice jones lives_in berlin", "alice smith works_at acme", "bob smith works_at acme"}},
+	} {
+		res, err := s.ListTriples(ctx, tt.p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := keys(res.Triples); !slices.Equal(got, tt.want) {
+			t.Errorf("ListTriples(%+v) = %q, want %q", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestListTriplesLiteralWildcards(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, graph.Config{})
+	upsert(t, s,
+		spo("task", "status", "100%_done"),
+		spo("task", "estimate", "100 percent"),
+		spo("report", "path", `c:\reports`),
+	)
+	for _, tt := range []struct {
+		p    graph.ListParams
+		want []string
+	}{
+		{graph.ListParams{Object: "%", Match: graph.MatchContains}, []string{"task status 100%_done"}},
+		{graph.ListParams{Object: "100%", Match: graph.MatchPrefix}, []string{"task status 100%_done"}},
+		{graph.ListParams{Predicate: "_", Match: graph.MatchContains}, []string{}},
+		{graph.ListParams{Object: `\`, Match: graph.MatchContains}, []string{`report path c:\reports`}},
+		{graph.ListParams{Object: "%_d nothing", Match: graph.MatchAny}, []string{"task status 100%_done"}},
+		{graph.ListParams{Object: "100 %_", Match: graph.MatchAll}, []string{"task status 100%_done"}},
+		{graph.ListParams{Object: "100", Match: graph.MatchContains}, []string{"task estimate 100 percent", "task status 100%_done"}},
+	} {
+		res, err := s.ListTriples(ctx, tt.p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k := keys(res.Triples); !slices.Equal(k, tt.want) {
+			t.Errorf("ListTriples(%+v) = %q, want %q", tt.p, k, tt.want)
+		}
+	}
+}
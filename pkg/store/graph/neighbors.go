@@ -0,0 +1,99 @@
+package graph
+
+import (
+	"context"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// Neighbors is the neighbourhood of an entity. Facts holds the triples
+// within Depth hops, annotated with their hop; Outgoing and Incoming split
+// the one-hop ones by direction: Outgoing holds the triples with the entity
+// as subject, Incoming those with it as object only.
+type Neighbors struct {
+	Entity   string         `json:"entity"`
+	Depth    int            `json:"depth"`
+	Facts    []model.Triple `json:"facts"`
+	Outgoing []model.Triple `json:"outgoing"`
+	Incoming []model.Triple `json:"incoming"`
+	Degree   Degree         `json:"degree"`
+}
+
+// Degree counts the current triples touching an entity, whatever the
+// filters applied to the listed neighbours. A triple linking the entity to
+// itself counts in Out and In but once in Total.
+type Degree struct {
+	Out   int64 `json:"out"`
+	In    int64 `json:"in"`
+	Total int64 `json:"total"`
+}
+
+// OneHopNeighbors returns triples matching f connected to an entity, most
+// confident first, at most limit. The entity is normalized and its alias
+// resolved.
+func (s *Store) OneHopNeighbors(ctx context.Context, entity string, limit int, f FactFilter) ([]model.Triple, error) {
+	entity, err := s.resolve(ctx, s.reader, f.Namespace, entity)
+	if err != nil {
+		return nil, err
+	}
+	return s.NeighborsOf(ctx, []string{entity}, limit, f)
+}
+
+// Neighbors returns the triples matching f within depth hops of entity (see
+// Neighborhood), at most limit, with the one-hop ones grouped by direction,
+// and the entity's degree in f.Namespace (all namespaces when empty). Depth
+// is clamped to [1, 5]. An entity without triples has a zero Degree.
+func (s *Store) Neighbors(ctx context.Context, entity string, depth, limit int, f FactFilter) (Neighbors, error) {
+	entity, err := s.resolve(ctx, s.reader, f.Namespace, entity)
+	if err != nil {
+		return Neighbors{}, err
+	}
+	n := NewNeighbors(entity, depth)
+	cond, args := namespaceCond(f.Namespace)
+	if err := s.reader.QueryRowContext(ctx, `
+        SELECT COALESCE(SUM(subject = ?1), 0), COALESCE(SUM(object = ?1), 0), COUNT(*)
+        FROM triples
+        WHERE (subject = ?1 OR object = ?1) AND superseded_by IS NULL`+cond+`;
+    `, append([]any{entity}, args...)...).Scan(&n.Degree.Out, &n.Degree.In, &n.Degree.Total); err != nil {
+		return Neighbors{}, err
+	}
+	if n.Degree.Total == 0 {
+		return n, nil
+	}
+	facts, err := s.neighborhood(ctx, entity, n.Depth, limit, f)
+	if err != nil {
+		return Neighbors{}, err
+	}
+	n.SetFacts(facts)
+	return n, nil
+}
+
+// NewNeighbors returns the empty neighbourhood of entity, depth clamped to
+// [1, 5].
+func NewNeighbors(entity string, depth int) Neighbors {
+	return Neighbors{
+		Entity:   entity,
+		Depth:    clampDepth(depth),
+		Facts:    []model.Triple{},
+		Outgoing: []model.Triple{},
+		Incoming: []model.Triple{},
+	}
+}
+
+// SetFacts stores the triples Traverse found from n.Entity, filing the
+// one-hop ones under Outgoing or Incoming.
+func (n *Neighbors) SetFacts(facts []model.Triple) {
+	if facts != nil {
+		n.Facts = facts
+	}
+	for _, t := range facts {
+		if t.Hop != 1 {
+			continue
+		}
+		if t.Subject == n.Entity {
+			n.Outgoing = append(n.Outgoing, t)
+		} else {
+			n.Incoming = append(n.Incoming, t)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package graph
+
+import (
+	"context"
+	"errors"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// ErrNoPath is returned by FindPath when the entities are not connected
+// within the depth and visit bounds.
+var ErrNoPath = errors.New("no path")
+
+const (
+	// maxPathDepth caps FindPath's search depth.
+	maxPathDepth = 6
+	// maxPathVisits bounds how many entities FindPath may expand.
+	maxPathVisits = 10000
+	// pathBatch bounds entities per IN (...) clause while expanding a level.
+	pathBatch = 250
+)
+
+type pathStep struct {
+	prev   string
+	triple model.Triple
+	// score is the product of the confidences along the path so far.
+	score float64
+}
+
+// FindPath returns a shortest chain of current triples of namespace (any
+// namespace when empty) linking from to to, in path order with Hop set to each step's
+// position. Edges are traversed in either
+// direction; the triples are returned as stored. Among equally short paths,
+// higher-confidence edges win. ErrNoPath is returned when no path exists
+// within maxDepth hops (capped at 6) or the search visits too many entities.
+func (s *Store) FindPath(ctx context.Context, namespace, from, to string, maxDepth int) ([]model.Triple, error) {
+	from, err := s.resolve(ctx, s.reader, namespace, from)
+	if err != nil {
+		return nil, err
+	}
+	to, err = s.resolve(ctx, s.reader, namespace, to)
+	if err != nil {
+		return nil, err
+	}
+	return ShortestPath(ctx, from, to, maxDepth, func(ctx context.Context, entities []string) ([]model.Triple, error) {
+		return s.edgesOf(ctx, namespace, entities)
+	})
+}
+
+// EdgesFunc returns the current triples touching any of entities, strongest
+// first.
+type EdgesFunc func(ctx context.Context, entities []string) ([]model.Triple, error)
+
+// ShortestPath is FindPath between entities already resolved, reading the
+// edges of each level from edgesOf, at most 250 entities at a time.
+func ShortestPath(ctx context.Context, from, to string, maxDepth int, edgesOf EdgesFunc) ([]model.Triple, error) {
+	if maxDepth <= 0 {
+		maxDepth = 4
+	}
+	if maxDepth > maxPathDepth {
+		maxDepth = maxPathDepth
+	}
+	if from == "" || to == "" {
+		return nil, ErrNoPath
+	}
+	if from == to {
+		return []model.Triple{}, nil
+	}
+
+	steps := map[string]pathStep{from: {score: 1}}
+	frontier := []string{from}
+	for depth := 1; depth <= maxDepth && len(frontier) > 0; depth++ {
+		// Entities first reached at this depth; each keeps the strongest of
+		// its equally short paths.
+		level := make(map[string]pathStep)
+		var next []string
+		for start := 0; start < len(frontier); start += pathBatch {
+			end := start + pathBatch
+			if end > len(frontier) {
+				end = len(frontier)
+			}
+			edges, err := edgesOf(ctx, frontier[start:end])
+			if err != nil {
+				return nil, err
+			}
+			for _, t := range edges {
+				for _, hop := range [][2]string{{t.Subject, t.Object}, {t.Object, t.Subject}} {
+					prev, node := hop[0], hop[1]
+					parent, expanded := steps[prev]
+					if !expanded {
+						continue
+					}
+					if _, seen := steps[node]; seen {
+						continue
+					}
+					step := pathStep{prev: prev, triple: t, score: parent.score * t.Confidence}
+					if cur, ok := level[node]; ok {
+						if step.score > cur.score {
+							level[node] = step
+						}
+						continue
+					}
+					level[node] = step
+					next = append(next, node)
+				}
+			}
+			if len(steps)+len(level) > maxPathVisits {
+				return nil, ErrNoPath
+			}
+		}
+		for node, step := range level {
+			steps[node] = step
+		}
+		if _, ok := level[to]; ok {
+			return walkBack(steps, from, to), nil
+		}
+		frontier = next
+	}
+	return nil, ErrNoPath
+}
+
+// edgesOf returns current triples of namespace touching any of the
+// entities, strongest first.
+func (s *Store) edgesOf(ctx context.Context, namespace string, entities []string) ([]model.Triple, error) {
+	args := make([]any, 0, 2*len(entities))
+	for _, e := range entities {
+		args = append(args, e)
+	}
+	for _, e := range entities {
+		args = append(args, e)
+	}
+	cond, nsArgs := namespaceCond(namespace)
+	args = append(args, nsArgs...)
+	in := placeholders(len(entities))
+	rows, err := s.reader.QueryContext(ctx, `
+        SELECT `+tripleColumns+`
+        FROM triples
+        WHERE (subject IN (`+in+`) OR object IN (`+in+`)) AND superseded_by IS NULL`+cond+`
+        ORDER BY confidence DESC, id;
+    `, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanTriples(rows)
+}
+
+func walkBack(steps map[string]pathStep, from, to string) []model.Triple {
+	var path []model.Triple
+	for node := to; node != from; node = steps[node].prev {
+		path = append(path, steps[node].triple)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	for i := range path {
+		path[i].Hop = i + 1
+	}
+	return path
+}
@@ -0,0 +1,109 @@
+package graph_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store/graph"
+)
+
+func pathKeys(path []model.Triple) []string {
+	out := make([]string, len(path))
+	for i, t := range path {
+		out[i] = t.Subject + " " + t.Predicate + " " + t.Object
+	}
+	return out
+}
+
+func TestFindPath(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, graph.Config{})
+	weak := spo("bob", "met", "dave")
+	weak.Confidence = 0.2
+	strong := spo("carol", "knows", "dave")
+	strong.Confidence = 0.9
+	upsert(t, s,
+		spo("bob", "knows", "carol"),
+		strong,
+		spo("bob", "married_to", "erin"),
+		spo("erin", "friend_of", "dave"),
+		spo("dave", "works_at", "acme"),
+		// the long way round
+		spo("bob", "lives_in", "berlin"),
+		spo("acme", "based_in", "berlin"),
+		spo("zed", "likes", "tea"),
+	)
+
+	path, err := s.FindPath(ctx, "", "Bob", "acme", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// bob and acme share berlin: the two-hop path beats any through dave
+	want := []string{"bob lives_in berlin", "acme based_in berlin"}
+	if got := pathKeys(path); !slices.Equal(got, want) {
+		t.Fatalf("FindPath(bob, acme) = %q, want %q", got, want)
+	}
+	for i, tr := range path {
+		if tr.Hop != i+1 {
+			t.Errorf("hop of step %d = %d", i, tr.Hop)
+		}
+	}
+
+	// two-hop paths to dave exist via carol and erin; the weak direct edge
+	// is the only one-hop path
+	upsert(t, s, weak)
+	if path, err = s.FindPath(ctx, "", "bob", "dave", 4); err != nil {
+		t.Fatal(err)
+	}
+	if got := pathKeys(path); !slices.Equal(got, []string{"bob met dave"}) {
+		t.Fatalf("FindPath(bob, dave) = %q, want the direct edge", got)
+	}
+
+	if path, err = s.FindPath(ctx, "", "carol", "erin", 4); err != nil {
+		t.Fatal(err)
+	}
+	// via bob scores 0.8*0.8, via dave 0.9*0.8
+	want = []string{"carol knows dave", "erin friend_of dave"}
+	if got := pathKeys(path); !slices.Equal(got, want) {
+		t.Fatalf("FindPath(carol, erin) = %q, want %q", got, want)
+	}
+
+	if path, err = s.FindPath(ctx, "", "alice", "alice", 4); err != nil || len(path) != 0 {
+		t.Fatalf("FindPath to itself = %q, %v; want an empty path", pathKeys(path), err)
+	}
+	for _, tt := range []struct {
+		from, to string
+		depth    int
+	}{
+		{"bob", "zed", 6},
+		{"carol", "acme", 1},
+		{"nobody", "bob", 4},
+	} {
+		if _, err := s.FindPath(ctx, "", tt.from, tt.to, tt.depth); !errors.Is(err, graph.ErrNoPath) {
+			t.Errorf("FindPath(%s, %s, %d) = %v, want ErrNoPath", tt.from, tt.to, tt.depth, err)
+		}
+	}
+	if _, err := s.FindPath(ctx, "work", "bob", "carol", 4); !errors.Is(err, graph.ErrNoPath) {
+		t.Errorf("FindPath in another namespace = %v, want ErrNoPath", err)
+	}
+}
+
+func TestFindPathPrefersConfidentEdges(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, graph.Config{})
+	low := spo("a", "via_low", "b")
+	low.Confidence = 0.3
+	high := spo("a", "via_high", "c")
+	high.Confidence = 0.9
+	upsert(t, s, low, high, spo("b", "to", "z"), spo("c", "to", "z"))
+	path, err := s.FindPath(ctx, "", "a", "z", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pathKeys(path); !slices.Equal(got, []string{"a via_high c", "c to z"}) {
+		t.Fatalf("FindPath = %q, want the path over the confident edge", got)
+	}
+}
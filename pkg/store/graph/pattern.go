@@ -0,0 +1,250 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// ErrInvalidPattern is returned by QueryPattern for malformed patterns.
+var ErrInvalidPattern = errors.New("invalid pattern")
+
+const (
+	// maxPatterns caps the patterns of one query, and so its self-joins.
+	maxPatterns = 4
+	// defaultPatternLimit and maxPatternLimit bound the matches returned.
+	defaultPatternLimit = 100
+	maxPatternLimit     = 1000
+)
+
+// TriplePattern is one clause of a conjunctive query. Each term is either a
+// constant, matched exactly (entities after normalization and alias
+// resolution), or a variable written as "?name". A variable used in several
+// places must bind the same value everywhere.
+type TriplePattern struct {
+	Subject   string `json:"subject"`
+	Predicate string `json:"predicate"`
+	Object    string `json:"object"`
+}
+
+// PatternMatch is one solution of a pattern query: the value of every
+// variable, and the triple matched by each pattern, in pattern order.
+type PatternMatch struct {
+	Bindings map[string]string `json:"bindings"`
+	Triples  []model.Triple    `json:"triples"`
+}
+
+// variable returns the name of term if it is a variable.
+func variable(term string) (string, bool) {
+	if !strings.HasPrefix(term, "?") {
+		return "", false
+	}
+	return term[1:], true
+}
+
+func validVariable(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r != '_' && (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// QueryPattern returns the solutions of the conjunction of patterns over the
+// current triples of namespace (any namespace when empty), oldest triples
+// first; superseded triples never bind. It
+// is evaluated as a single self-join, so it is bounded to 4 patterns; limit
+// defaults to 100 and is capped at 1000.
+func (s *Store) QueryPattern(ctx context.Context, namespace string, patterns []TriplePattern, limit int) ([]PatternMatch, error) {
+	resolve := func(entity string) (string, error) {
+		return s.resolve(ctx, s.reader, namespace, entity)
+	}
+	q, err := CompilePattern(namespace, patterns, limit, resolve, func(int) string { return "?" })
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.reader.QueryContext(ctx, q.SQL, q.Args...)
+	if err != nil {
+		return nil, err
+	}
+	solutions, err := q.Scan(rows)
+	if err != nil {
+		return nil, err
+	}
+	triples, err := s.triplesByID(ctx, solutions)
+	if err != nil {
+		return nil, err
+	}
+	return q.Matches(solutions, triples), nil
+}
+
+// PatternQuery is a pattern query compiled to one self-join of the triples
+// table, selecting the ids of the triples bound by each pattern.
+type PatternQuery struct {
+	SQL  string
+	Args []any
+
+	patterns int
+	vars     []string
+	first    map[string]patternBinding
+}
+
+type patternBinding struct {
+	pattern int
+	column  string
+}
+
+// CompilePattern validates and compiles a QueryPattern query. resolve maps
+// constant entities to their stored form; placeholder returns the SQL
+// placeholder of the n-th argument, counting from 1.
+func CompilePattern(namespace string, patterns []TriplePattern, limit int, resolve func(entity string) (string, error), placeholder func(n int) string) (*PatternQuery, error) {
+	if len(patterns) == 0 || len(patterns) > maxPatterns {
+		return nil, fmt.Errorf("%w: need 1 to %d patterns, got %d", ErrInvalidPattern, maxPatterns, len(patterns))
+	}
+	if limit <= 0 {
+		limit = defaultPatternLimit
+	}
+	if limit > maxPatternLimit {
+		limit = maxPatternLimit
+	}
+
+	q := &PatternQuery{patterns: len(patterns), first: map[string]patternBinding{}}
+	arg := func(v any) string {
+		q.Args = append(q.Args, v)
+		return placeholder(len(q.Args))
+	}
+	var conds, tables, ids []string
+	for i, p := range patterns {
+		alias := "t" + strconv.Itoa(i)
+		tables = append(tables, "triples "+alias)
+		ids = append(ids, alias+".id")
+		conds = append(conds, alias+".superseded_by IS NULL")
+		if namespace != "" {
+			conds = append(conds, alias+".namespace = "+arg(namespace))
+		}
+		for _, term := range []struct{ column, value string }{
+			{"subject", p.Subject}, {"predicate", p.Predicate}, {"object", p.Object},
+		} {
+			ref := alias + "." + term.column
+			if term.value == "" {
+				return nil, fmt.Errorf("%w: pattern %d has an empty %s", ErrInvalidPattern, i+1, term.column)
+			}
+			if name, ok := variable(term.value); ok {
+				if !validVariable(name) {
+					return nil, fmt.Errorf("%w: bad variable %q in pattern %d", ErrInvalidPattern, term.value, i+1)
+				}
+				if b, seen := q.first[name]; seen {
+					conds = append(conds, ref+" = t"+strconv.Itoa(b.pattern)+"."+b.column)
+					continue
+				}
+				q.first[name] = patternBinding{pattern: i, column: term.column}
+				q.vars = append(q.vars, name)
+				continue
+			}
+			value := term.value
+			if term.column != "predicate" {
+				var err error
+				if value, err = resolve(value); err != nil {
+					return nil, err
+				}
+			}
+			conds = append(conds, ref+" = "+arg(value))
+		}
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	q.SQL = `
+        SELECT ` + strings.Join(ids, ", ") + `
+        FROM ` + strings.Join(tables, ", ") + where + `
+        ORDER BY ` + strings.Join(ids, ", ") + `
+        LIMIT ` + arg(limit) + `;
+    `
+	return q, nil
+}
+
+// Scan reads the solutions selected by q.SQL and closes rows.
+func (q *PatternQuery) Scan(rows *sql.Rows) ([][]int64, error) {
+	defer rows.Close()
+	var solutions [][]int64
+	for rows.Next() {
+		row := make([]int64, q.patterns)
+		dest := make([]any, len(row))
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		solutions = append(solutions, row)
+	}
+	return solutions, rows.Err()
+}
+
+// Matches binds the variables of each solution from triples, which holds
+// every triple the solutions reference.
+func (q *PatternQuery) Matches(solutions [][]int64, triples map[int64]model.Triple) []PatternMatch {
+	out := make([]PatternMatch, 0, len(solutions))
+	for _, row := range solutions {
+		m := PatternMatch{Bindings: make(map[string]string, len(q.vars)), Triples: make([]model.Triple, len(row))}
+		for i, id := range row {
+			m.Triples[i] = triples[id]
+		}
+		for _, name := range q.vars {
+			b := q.first[name]
+			t := m.Triples[b.pattern]
+			switch b.column {
+			case "subject":
+				m.Bindings[name] = t.Subject
+			case "predicate":
+				m.Bindings[name] = t.Predicate
+			default:
+				m.Bindings[name] = t.Object
+			}
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// triplesByID loads the distinct triples referenced by solutions.
+func (s *Store) triplesByID(ctx context.Context, solutions [][]int64) (map[int64]model.Triple, error) {
+	seen := map[int64]bool{}
+	var ids []any
+	for _, row := range solutions {
+		for _, id := range row {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	out := make(map[int64]model.Triple, len(ids))
+	for start := 0; start < len(ids); start += pathBatch {
+		end := min(start+pathBatch, len(ids))
+		rows, err := s.reader.QueryContext(ctx, `
+            SELECT `+tripleColumns+` FROM triples WHERE id IN (`+placeholders(end-start)+`);
+        `, ids[start:end]...)
+		if err != nil {
+			return nil, err
+		}
+		triples, err := scanTriples(rows)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range triples {
+			out[t.ID] = t
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,106 @@
+package graph_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store/graph"
+)
+
+// bindings renders the value of name in each match, sorted.
+func bindings(matches []graph.PatternMatch, name string) []string {
+	out := make([]string, len(matches))
+	for i, m := range matches {
+		out[i] = m.Bindings[name]
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestQueryPattern(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, graph.Config{})
+	other := spo("dave", "works_at", "acme")
+	other.Namespace = "work"
+	upsert(t, s,
+		spo("alice", "works_at", "acme"),
+		spo("bob", "works_at", "initech"),
+		spo("carol", "works_at", "acme"),
+		spo("acme", "located_in", "berlin"),
+		spo("initech", "located_in", "paris"),
+		spo("narcissus", "likes", "narcissus"),
+		spo("narcissus", "likes", "echo"),
+		other,
+	)
+	if err := s.AddAlias(ctx, "", "ACME Corp", "acme"); err != nil {
+		t.Fatal(err)
+	}
+	pat := func(s, p, o string) graph.TriplePattern {
+		return graph.TriplePattern{Subject: s, Predicate: p, Object: o}
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		patterns  []graph.TriplePattern
+		variable  string
+		want      []string
+	}{
+		{"join", model.DefaultNamespace, []graph.TriplePattern{pat("?p", "works_at", "?c"), pat("?c", "located_in", "berlin")}, "p", []string{"alice", "carol"}},
+		{"constant through an alias", model.DefaultNamespace, []graph.TriplePattern{pat("?p", "works_at", "ACME Corp")}, "p", []string{"alice", "carol"}},
+		{"variable predicate", model.DefaultNamespace, []graph.TriplePattern{pat("alice", "?rel", "acme")}, "rel", []string{"works_at"}},
+		{"repeated variable", model.DefaultNamespace, []graph.TriplePattern{pat("?x", "likes", "?x")}, "x", []string{"narcissus"}},
+		{"other namespace", "work", []graph.TriplePattern{pat("?p", "works_at", "acme")}, "p", []string{"dave"}},
+		{"every namespace", "", []graph.TriplePattern{pat("?p", "works_at", "acme")}, "p", []string{"alice", "carol", "dave"}},
+		{"no solution", model.DefaultNamespace, []graph.TriplePattern{pat("?p", "works_at", "?c"), pat("?c", "located_in", "tokyo")}, "p", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.QueryPattern(ctx, tt.namespace, tt.patterns, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b := bindings(got, tt.variable); !slices.Equal(b, tt.want) {
+				t.Errorf("?%s = %q, want %q", tt.variable, b, tt.want)
+			}
+			for _, m := range got {
+				if len(m.Triples) != len(tt.patterns) {
+					t.Errorf("match %+v has %d triples, want one per pattern", m, len(m.Triples))
+				}
+			}
+		})
+	}
+
+	got, err := s.QueryPattern(ctx, "", []graph.TriplePattern{pat("?p", "works_at", "?c"), pat("?c", "located_in", "?city")}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("%d matches with limit 1", len(got))
+	}
+	m := got[0]
+	if m.Triples[0].Object != m.Bindings["c"] || m.Triples[1].Subject != m.Bindings["c"] || m.Triples[1].Object != m.Bindings["city"] {
+		t.Errorf("match %+v: triples disagree with the bindings", m)
+	}
+}
+
+func TestQueryPatternRejects(t *testing.T) {
+	s, _ := newTestStore(t, graph.Config{})
+	p := graph.TriplePattern{Subject: "?s", Predicate: "?p", Object: "?o"}
+	for name, patterns := range map[string][]graph.TriplePattern{
+		"no patterns":     nil,
+		"five patterns":   {p, p, p, p, p},
+		"empty term":      {{Subject: "?s", Predicate: "", Object: "?o"}},
+		"bare ?":          {{Subject: "?", Predicate: "?p", Object: "?o"}},
+		"bad variable":    {{Subject: "?a-b", Predicate: "?p", Object: "?o"}},
+		"spaced variable": {{Subject: "?a b", Predicate: "?p", Object: "?o"}},
+	} {
+		if _, err := s.QueryPattern(context.Background(), "", patterns, 0); !errors.Is(err, graph.ErrInvalidPattern) {
+			t.Errorf("%s: %v, want ErrInvalidPattern", name, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+)
+
+// PruneParams selects the triples PruneTriples deletes.
+type PruneParams struct {
+	// Namespace restricts pruning to one namespace; empty prunes all.
+	Namespace string
+	// MaxAge is how long a triple must have gone without being created or
+	// recalled before it can be pruned. Required.
+	MaxAge time.Duration
+	// MaxConfidence is the confidence a triple must stay below to be
+	// pruned; triples at or above it are always kept. Required, at most 1.
+	MaxConfidence float64
+	// Predicate restricts pruning to triples with this predicate, such as
+	// "notes"; empty matches all.
+	Predicate string
+}
+
+// ErrInvalidPrune is returned by PruneTriples for params that would
+// select every triple regardless of age or confidence.
+var ErrInvalidPrune = errors.New("max age must be positive and max confidence within (0, 1]")
+
+// PruneTriples deletes stale, low-confidence triples selected by p and
+// returns how many were removed. A triple is stale once neither its
+// creation nor its last recall is within MaxAge; their sources go with
+// them.
+func (s *Store) PruneTriples(ctx context.Context, p PruneParams) (int64, error) {
+	if p.MaxAge <= 0 || p.MaxConfidence <= 0 || p.MaxConfidence > 1 {
+		return 0, ErrInvalidPrune
+	}
+	cutoff := time.Now().Add(-p.MaxAge).UTC().Format(sqlite.TimeLayout)
+	query := `DELETE FROM triples WHERE confidence < ? AND COALESCE(last_accessed_at, created_at) <= ?`
+	args := []any{p.MaxConfidence, cutoff}
+	if p.Predicate != "" {
+		query += ` AND predicate = ?`
+		args = append(args, p.Predicate)
+	}
+	cond, nsArgs := namespaceCond(p.Namespace)
+	res, err := s.db.ExecContext(ctx, query+cond+`;`, append(args, nsArgs...)...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,71 @@
+package graph_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store/graph"
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+)
+
+func TestPruneTriples(t *testing.T) {
+	ctx := context.Background()
+	s, db := newTestStore(t, graph.Config{})
+	old := time.Now().Add(-48 * time.Hour).UTC().Format(sqlite.TimeLayout)
+	fact := func(object, predicate, namespace string, confidence float64) model.Triple {
+		return model.Triple{Subject: "alice", Predicate: predicate, Object: object, Namespace: namespace, Confidence: confidence}
+	}
+	upsert(t, s,
+		fact("stale", "notes", "", 0.2),
+		fact("confident", "notes", "", 0.9),
+		fact("fresh", "notes", "", 0.2),
+		fact("recalled", "notes", "", 0.2),
+		fact("other predicate", "likes", "", 0.2),
+		fact("elsewhere", "notes", "work", 0.2),
+	)
+	if _, err := db.Writer().Exec(`UPDATE triples SET created_at = ? WHERE object != 'fresh'`, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Writer().Exec(`UPDATE triples SET last_accessed_at = CURRENT_TIMESTAMP WHERE object = 'recalled'`); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := s.PruneTriples(ctx, graph.PruneParams{Namespace: model.DefaultNamespace, MaxAge: 24 * time.Hour, MaxConfidence: 0.5, Predicate: "notes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("pruned %d triples, want only the stale one", n)
+	}
+	res, err := s.ListTriples(ctx, graph.ListParams{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	for _, tr := range res.Triples {
+		left = append(left, tr.Object)
+	}
+	slices.Sort(left)
+	if want := []string{"confident", "elsewhere", "fresh", "other predicate", "recalled"}; !slices.Equal(left, want) {
+		t.Errorf("left %q, want %q", left, want)
+	}
+
+	// every namespace and predicate
+	if n, err := s.PruneTriples(ctx, graph.PruneParams{MaxAge: 24 * time.Hour, MaxConfidence: 0.5}); err != nil || n != 2 {
+		t.Errorf("pruning everywhere = %d, %v; want the other predicate and the work fact", n, err)
+	}
+
+	for _, p := range []graph.PruneParams{
+		{MaxConfidence: 0.5},
+		{MaxAge: time.Hour},
+		{MaxAge: time.Hour, MaxConfidence: 1.5},
+	} {
+		if _, err := s.PruneTriples(ctx, p); !errors.Is(err, graph.ErrInvalidPrune) {
+			t.Errorf("PruneTriples(%+v) = %v, want ErrInvalidPrune", p, err)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package graph
+
+import (
+	"time"
+
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+)
+
+// validAt returns a condition, prefixed with " AND ", keeping triples valid
+// at instant at: valid_from at or before it and valid_to after it, a NULL
+// bound being open. The interval is half-open, so at a change of value only
+// the new triple holds. Times are compared in UTC at one-second precision.
+func validAt(at time.Time) (string, []any) {
+	v := at.UTC().Format(sqlite.TimeLayout)
+	return ` AND (triples.valid_from IS NULL OR datetime(triples.valid_from) <= ?)` +
+		` AND (triples.valid_to IS NULL OR datetime(triples.valid_to) > ?)`, []any{v, v}
+}
+
+// validityArg returns t as stored in valid_from or valid_to, or nil for an
+// open bound.
+func validityArg(t *time.Time) any {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(sqlite.TimeLayout)
+}
@@ -0,0 +1,175 @@
+package graph_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store/graph"
+)
+
+func date(year int, month time.Month, day int) *time.Time {
+	t := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	return &t
+}
+
+func valid(s, p, o string, from, to *time.Time) model.Triple {
+	t := spo(s, p, o)
+	t.ValidFrom, t.ValidTo = from, to
+	return t
+}
+
+func TestAsOfBoundaries(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, graph.Config{})
+	upsert(t, s,
+		valid("alice", "worked_at", "acme", date(2019, 1, 1), date(2023, 1, 1)),
+		valid("alice", "works_at", "globex", date(2023, 1, 1), nil),
+		valid("alice", "studied_at", "mit", nil, date(2019, 1, 1)),
+		spo("alice", "likes", "tea"),
+	)
+	second := time.Second
+	for _, tt := range []struct {
+		name string
+		at   time.Time
+		want []string
+	}{
+		{"long before", *date(2010, 1, 1), []string{"alice likes tea", "alice studied_at mit"}},
+		{"just before acme", date(2019, 1, 1).Add(-second), []string{"alice likes tea", "alice studied_at mit"}},
+		{"acme starts", *date(2019, 1, 1), []string{"alice likes tea", "alice worked_at acme"}},
+		{"last second at acme", date(2023, 1, 1).Add(-second), []string{"alice likes tea", "alice worked_at acme"}},
+		{"globex starts", *date(2023, 1, 1), []string{"alice likes tea", "alice works_at globex"}},
+		{"same instant elsewhere", date(2023, 1, 1).In(time.FixedZone("CET", 3600)), []string{"alice likes tea", "alice works_at globex"}},
+		{"far future", *date(2100, 1, 1), []string{"alice likes tea", "alice works_at globex"}},
+	} {
+		got, err := s.SearchFactsFiltered(ctx, "alice", 10, graph.FactFilter{AsOf: tt.at})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k := keys(got); !slices.Equal(k, tt.want) {
+			t.Errorf("%s: search as of %s = %q, want %q", tt.name, tt.at, k, tt.want)
+		}
+		res, err := s.ListTriples(ctx, graph.ListParams{Subject: "alice", AsOf: tt.at, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k := keys(res.Triples); !slices.Equal(k, tt.want) {
+			t.Errorf("%s: list as of %s = %q, want %q", tt.name, tt.at, k, tt.want)
+		}
+	}
+
+	all, err := s.SearchFactsFiltered(ctx, "acme", 10, graph.FactFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || !all[0].ValidFrom.Equal(*date(2019, 1, 1)) || !all[0].ValidTo.Equal(*date(2023, 1, 1)) {
+		t.Errorf("acme fact = %+v, want its validity read back", all)
+	}
+}
+
+func TestUpsertValidity(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, graph.Config{})
+	if _, err := s.UpsertTriples(ctx, []model.Triple{valid("alice", "works_at", "acme", date(2023, 1, 1), date(2023, 1, 1))}); err == nil {
+		t.Error("stored a triple valid for no time at all")
+	}
+
+	upsert(t, s, valid("alice", "works_at", "acme", date(2019, 1, 1), nil))
+	// bounds given again replace the stored ones; missing ones keep them
+	upsert(t, s, valid("alice", "works_at", "acme", nil, date(2023, 1, 1)))
+	got, err := s.SearchFactsFiltered(ctx, "acme", 10, graph.FactFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ValidFrom == nil || !got[0].ValidFrom.Equal(*date(2019, 1, 1)) || got[0].ValidTo == nil || !got[0].ValidTo.Equal(*date(2023, 1, 1)) {
+		t.Errorf("acme fact = %+v, want valid 2019 to 2023", got)
+	}
+}
+
+func TestSupersedingClosesValidity(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, graph.Config{FunctionalPredicates: []string{"works_at", "lives_in"}})
+	upsert(t, s, valid("alice", "works_at", "acme", date(2019, 1, 1), nil))
+	globex := upsert(t, s, valid("alice", "works_at", "globex", date(2023, 1, 1), nil))[0]
+	facts := byObject(t, s, "alice")
+	if acme := facts["acme"]; acme.SupersededBy != globex.ID || acme.ValidTo == nil || !acme.ValidTo.Equal(*date(2023, 1, 1)) {
+		t.Errorf("acme = %+v, want it superseded and valid until globex starts", acme)
+	}
+
+	// history stays searchable as of its time, superseded or not
+	for at, want := range map[time.Time][]string{
+		*date(2020, 6, 1): {"alice works_at acme"},
+		*date(2024, 6, 1): {"alice works_at globex"},
+	} {
+		got, err := s.SearchFactsFiltered(ctx, "alice", 10, graph.FactFilter{Predicate: "works_at", AsOf: at})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k := keys(got); !slices.Equal(k, want) {
+			t.Errorf("works_at as of %s = %q, want %q", at.Format(time.DateOnly), k, want)
+		}
+	}
+
+	// a closed interval is history and supersedes nothing
+	if res := upsert(t, s, valid("alice", "works_at", "initech", date(2015, 1, 1), date(2019, 1, 1)))[0]; res.Superseded != 0 {
+		t.Errorf("past job superseded %d triples", res.Superseded)
+	}
+	if facts := byObject(t, s, "alice"); facts["globex"].SupersededBy != 0 || facts["initech"].SupersededBy != 0 {
+		t.Errorf("globex superseded by %d, initech by %d; want both current", facts["globex"].SupersededBy, facts["initech"].SupersededBy)
+	}
+
+	// without a start the new value starts now, and so does the old one's end
+	before := time.Now().Add(-time.Second)
+	upsert(t, s, spo("alice", "lives_in", "paris"))
+	upsert(t, s, spo("alice", "lives_in", "berlin"))
+	facts = byObject(t, s, "alice")
+	paris, berlin := facts["paris"], facts["berlin"]
+	if berlin.ValidFrom == nil || berlin.ValidFrom.Before(before) || paris.ValidTo == nil || !paris.ValidTo.Equal(*berlin.ValidFrom) {
+		t.Errorf("paris valid to %v, berlin from %v; want both at the move", paris.ValidTo, berlin.ValidFrom)
+	}
+}
+
+func TestOutOfOrderHistoryDoesNotSupersede(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, graph.Config{FunctionalPredicates: []string{"works_at"}})
+	upsert(t, s, valid("alice", "works_at", "acme", date(2023, 1, 1), nil))
+	if res := upsert(t, s, valid("alice", "works_at", "initech", date(2015, 1, 1), nil))[0]; res.Superseded != 0 {
+		t.Errorf("an older job superseded %d triples", res.Superseded)
+	}
+	upsert(t, s, valid("alice", "works_at", "hooli", date(2010, 1, 1), nil))
+
+	facts := byObject(t, s, "alice")
+	if acme := facts["acme"]; acme.SupersededBy != 0 || acme.ValidTo != nil {
+		t.Errorf("acme = %+v, want it current and open", acme)
+	}
+	for object, end := range map[string]*time.Time{"initech": date(2023, 1, 1), "hooli": date(2015, 1, 1)} {
+		if f := facts[object]; f.SupersededBy != 0 || f.ValidTo == nil || !f.ValidTo.Equal(*end) {
+			t.Errorf("%s = %+v, want history valid until %s", object, f, end.Format(time.DateOnly))
+		}
+	}
+	for at, want := range map[time.Time][]string{
+		*date(2012, 6, 1): {"alice works_at hooli"},
+		*date(2020, 6, 1): {"alice works_at initech"},
+		*date(2024, 6, 1): {"alice works_at acme"},
+	} {
+		got, err := s.SearchFactsFiltered(ctx, "alice", 10, graph.FactFilter{AsOf: at})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k := keys(got); !slices.Equal(k, want) {
+			t.Errorf("as of %s = %q, want %q", at.Format(time.DateOnly), k, want)
+		}
+	}
+
+	// a value starting in between still supersedes the one before it
+	upsert(t, s, valid("alice", "works_at", "globex", date(2020, 1, 1), nil))
+	facts = byObject(t, s, "alice")
+	if f := facts["initech"]; f.SupersededBy != facts["globex"].ID || !f.ValidTo.Equal(*date(2020, 1, 1)) {
+		t.Errorf("initech = %+v, want it superseded by globex in 2020", f)
+	}
+	if f := facts["globex"]; f.ValidTo == nil || !f.ValidTo.Equal(*date(2023, 1, 1)) || facts["acme"].SupersededBy != 0 {
+		t.Errorf("globex = %+v and acme = %+v, want globex until acme starts", f, facts["acme"])
+	}
+}
@@ -0,0 +1,92 @@
+package graph
+
+import (
+	"sort"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// View is a set of triples shaped as nodes and edges for drawing.
+type View struct {
+	Nodes []ViewNode `json:"nodes"`
+	Edges []ViewEdge `json:"edges"`
+	// Truncated reports that edges were left out to honor the limit.
+	Truncated bool `json:"truncated"`
+}
+
+// ViewNode is an entity; ID is its canonical form and Degree counts the
+// edges of the view touching it.
+type ViewNode struct {
+	ID     string `json:"id"`
+	Label  string `json:"label"`
+	Degree int    `json:"degree"`
+}
+
+// ViewEdge merges the triples from Source to Target: Predicate and
+// Confidence are those of the most confident one, and Count is how many
+// were merged.
+type ViewEdge struct {
+	Source     string  `json:"source"`
+	Target     string  `json:"target"`
+	Predicate  string  `json:"predicate"`
+	Confidence float64 `json:"confidence"`
+	Count      int     `json:"count"`
+}
+
+// NewView builds a view of triples with at most limit edges (no bound when
+// limit <= 0), dropping the least confident edges first. Nodes are sorted by
+// id and edges by descending confidence, so equal inputs give equal views.
+func NewView(triples []model.Triple, limit int) View {
+	type pair struct{ source, target string }
+	merged := map[pair]*ViewEdge{}
+	labels := map[string]string{}
+	for _, t := range triples {
+		for _, l := range [][2]string{{t.Subject, t.SubjectLabel}, {t.Object, t.ObjectLabel}} {
+			if _, ok := labels[l[0]]; !ok {
+				labels[l[0]] = l[1]
+			}
+		}
+		k := pair{t.Subject, t.Object}
+		e, ok := merged[k]
+		if !ok {
+			merged[k] = &ViewEdge{Source: t.Subject, Target: t.Object, Predicate: t.Predicate, Confidence: t.Confidence, Count: 1}
+			continue
+		}
+		e.Count++
+		if t.Confidence > e.Confidence || (t.Confidence == e.Confidence && t.Predicate < e.Predicate) {
+			e.Predicate, e.Confidence = t.Predicate, t.Confidence
+		}
+	}
+
+	v := View{Nodes: []ViewNode{}, Edges: make([]ViewEdge, 0, len(merged))}
+	for _, e := range merged {
+		v.Edges = append(v.Edges, *e)
+	}
+	sort.Slice(v.Edges, func(i, j int) bool {
+		a, b := v.Edges[i], v.Edges[j]
+		if a.Confidence != b.Confidence {
+			return a.Confidence > b.Confidence
+		}
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		return a.Target < b.Target
+	})
+	if limit > 0 && len(v.Edges) > limit {
+		v.Edges = v.Edges[:limit]
+		v.Truncated = true
+	}
+
+	degree := map[string]int{}
+	for _, e := range v.Edges {
+		degree[e.Source]++
+		if e.Target != e.Source {
+			degree[e.Target]++
+		}
+	}
+	for id, d := range degree {
+		v.Nodes = append(v.Nodes, ViewNode{ID: id, Label: labels[id], Degree: d})
+	}
+	sort.Slice(v.Nodes, func(i, j int) bool { return v.Nodes[i].ID < v.Nodes[j].ID })
+	return v
+}
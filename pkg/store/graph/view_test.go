@@ -0,0 +1,61 @@
+package graph_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store/graph"
+)
+
+func edge(s, p, o string, conf float64) model.Triple {
+	return model.Triple{Subject: s, Predicate: p, Object: o, SubjectLabel: "L" + s, ObjectLabel: "L" + o, Confidence: conf}
+}
+
+func TestNewViewMergesParallelEdges(t *testing.T) {
+	v := graph.NewView([]model.Triple{
+		edge("alice", "knows", "bob", 0.5),
+		edge("alice", "likes", "bob", 0.9),
+		edge("alice", "admires", "bob", 0.9),
+		edge("bob", "knows", "alice", 0.4),
+		edge("alice", "is", "alice", 0.7),
+	}, 0)
+
+	wantEdges := []graph.ViewEdge{
+		{Source: "alice", Target: "bob", Predicate: "admires", Confidence: 0.9, Count: 3},
+		{Source: "alice", Target: "alice", Predicate: "is", Confidence: 0.7, Count: 1},
+		{Source: "bob", Target: "alice", Predicate: "knows", Confidence: 0.4, Count: 1},
+	}
+	if !reflect.DeepEqual(v.Edges, wantEdges) {
+		t.Errorf("edges = %+v, want %+v", v.Edges, wantEdges)
+	}
+	// a self-loop counts once towards the degree
+	wantNodes := []graph.ViewNode{{ID: "alice", Label: "Lalice", Degree: 3}, {ID: "bob", Label: "Lbob", Degree: 2}}
+	if !reflect.DeepEqual(v.Nodes, wantNodes) {
+		t.Errorf("nodes = %+v, want %+v", v.Nodes, wantNodes)
+	}
+	if v.Truncated {
+		t.Error("view without a limit is truncated")
+	}
+}
+
+func TestNewViewLimit(t *testing.T) {
+	v := graph.NewView([]model.Triple{
+		edge("a", "p", "b", 0.2),
+		edge("c", "p", "d", 0.8),
+		edge("e", "p", "f", 0.5),
+	}, 2)
+	if !v.Truncated || len(v.Edges) != 2 || v.Edges[0].Source != "c" || v.Edges[1].Source != "e" {
+		t.Errorf("view = %+v, want the two most confident edges, truncated", v)
+	}
+	for _, n := range v.Nodes {
+		if n.ID == "a" || n.ID == "b" {
+			t.Errorf("node %s of a dropped edge kept", n.ID)
+		}
+	}
+
+	empty := graph.NewView(nil, 10)
+	if empty.Nodes == nil || empty.Edges == nil || empty.Truncated {
+		t.Errorf("empty view = %+v, want empty non-nil slices", empty)
+	}
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// Health component states.
+const (
+	HealthOK        = "ok"
+	HealthDisabled  = "disabled"
+	HealthUnchecked = "unchecked"
+	// HealthDegraded is a component that was enabled but is off; Detail
+	// says why. It does not make the report fail.
+	HealthDegraded = "degraded"
+)
+
+// HealthReport is the result of Health. Components maps "database",
+// "vector" and "embedder" to HealthOK, HealthDisabled, HealthUnchecked,
+// HealthDegraded or the error that component returned.
+type HealthReport struct {
+	OK         bool              `json:"ok"`
+	Components map[string]string `json:"components"`
+	Detail     map[string]string `json:"detail,omitempty"`
+}
+
+// Vector search modes reported by VectorStatus and Stats.
+const (
+	VectorEnabled  = "enabled"
+	VectorDisabled = "disabled"
+	VectorDegraded = "degraded"
+)
+
+// VectorStatus reports whether vector search is in use: VectorEnabled,
+// VectorDisabled, or VectorDegraded with the reason when Options.EnableVSS
+// was set but the extension could not provide it.
+func (m *MemoryEngine) VectorStatus() (mode, reason string) {
+	switch {
+	case m.vectorDegraded != "":
+		return VectorDegraded, m.vectorDegraded
+	case m.vec.Enabled():
+		return VectorEnabled, ""
+	}
+	return VectorDisabled, ""
+}
+
+// Health probes the database, the vector table when vector search is enabled,
+// and the embedder when it implements model.HealthChecker.
+func (m *MemoryEngine) Health(ctx context.Context) HealthReport {
+	rep := HealthReport{OK: true, Components: make(map[string]string, 3)}
+	check := func(name string, err error) {
+		if err != nil {
+			rep.OK = false
+			rep.Components[name] = err.Error()
+			return
+		}
+		rep.Components[name] = HealthOK
+	}
+
+	check("database", m.db.Ping(ctx))
+	switch mode, reason := m.VectorStatus(); mode {
+	case VectorEnabled:
+		check("vector", m.vec.Ping(ctx))
+	case VectorDegraded:
+		rep.Components["vector"] = HealthDegraded
+		rep.Detail = map[string]string{"vector": reason}
+	default:
+		rep.Components["vector"] = HealthDisabled
+	}
+	if hc, ok := m.embedder.(model.HealthChecker); ok {
+		check("embedder", hc.HealthCheck(ctx))
+	} else {
+		rep.Components["embedder"] = HealthUnchecked
+	}
+	return rep
+}
+
+// Ping is a cheap database check for readiness probes.
+func (m *MemoryEngine) Ping(ctx context.Context) error {
+	return m.db.Ping(ctx)
+}
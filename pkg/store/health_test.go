@@ -0,0 +1,101 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+// checkedEmbedder is a HashEmbedder whose health check returns err.
+type checkedEmbedder struct {
+	*store.HashEmbedder
+	err error
+}
+
+func (e checkedEmbedder) HealthCheck(context.Context) error { return e.err }
+
+func TestHealth(t *testing.T) {
+	ctx := context.Background()
+	rep := storetest.NewTestEngine(t).Health(ctx)
+	want := map[string]string{"database": store.HealthOK, "vector": store.HealthDisabled, "embedder": store.HealthUnchecked}
+	if !rep.OK || len(rep.Components) != len(want) {
+		t.Fatalf("Health = %+v, want %v", rep, want)
+	}
+	for k, v := range want {
+		if rep.Components[k] != v {
+			t.Errorf("%s = %q, want %q", k, rep.Components[k], v)
+		}
+	}
+
+	m := storetest.NewTestEngineWithOptions(t, store.Options{Embedder: checkedEmbedder{store.NewHashEmbedder(8), nil}})
+	if rep := m.Health(ctx); !rep.OK || rep.Components["embedder"] != store.HealthOK {
+		t.Errorf("Health with a reachable embedder = %+v", rep)
+	}
+	m = storetest.NewTestEngineWithOptions(t, store.Options{Embedder: checkedEmbedder{store.NewHashEmbedder(8), errors.New("connection refused")}})
+	if rep := m.Health(ctx); rep.OK || rep.Components["embedder"] != "connection refused" || rep.Components["database"] != store.HealthOK {
+		t.Errorf("Health with an unreachable embedder = %+v, want only the embedder failing", rep)
+	}
+}
+
+func TestHealthNoticesADeletedDatabase(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "paim.db")
+	m := storetest.NewTestEngineWithOptions(t, store.Options{DBPath: path})
+	if err := m.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Ping(ctx); err == nil {
+		t.Error("Ping succeeded after the database file was deleted")
+	}
+	if rep := m.Health(ctx); rep.OK || rep.Components["database"] == store.HealthOK {
+		t.Errorf("Health = %+v, want the database failing", rep)
+	}
+}
+
+func TestMissingExtensionDegradesVectorSearch(t *testing.T) {
+	ctx := context.Background()
+	missing := filepath.Join(t.TempDir(), "vss0.so")
+	m := storetest.NewTestEngineWithOptions(t, store.Options{EnableVSS: true, ExtensionsPath: missing})
+
+	mode, reason := m.VectorStatus()
+	if mode != store.VectorDegraded || !strings.Contains(reason, missing) {
+		t.Errorf("VectorStatus = %s %q, want degraded naming %s", mode, reason, missing)
+	}
+	st, err := m.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.VectorSearch != store.VectorDegraded || st.VectorError != reason || st.VectorBackend != "" {
+		t.Errorf("Stats = %s %q (backend %q), want degraded", st.VectorSearch, st.VectorError, st.VectorBackend)
+	}
+	rep := m.Health(ctx)
+	if !rep.OK || rep.Components["vector"] != store.HealthDegraded || rep.Detail["vector"] != reason {
+		t.Errorf("Health = %+v, want ok with the vector degraded", rep)
+	}
+	// the rest of the engine works without it
+	if err := m.Observe(ctx, model.SensoryInput{Content: "Alice works at Acme."}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Recall(ctx, "alice", 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if mode, _ := storetest.NewTestEngine(t).VectorStatus(); mode != store.VectorDisabled {
+		t.Errorf("VectorStatus without vector search = %s, want disabled", mode)
+	}
+
+	_, err = store.NewMemoryEngine(ctx, store.Options{DBPath: store.MemoryPath, EnableVSS: true, ExtensionsPath: missing, VSSRequired: true})
+	if !errors.Is(err, store.ErrVectorUnavailable) || !strings.Contains(err.Error(), missing) {
+		t.Errorf("NewMemoryEngine with VSSRequired: %v, want ErrVectorUnavailable naming %s", err, missing)
+	}
+}
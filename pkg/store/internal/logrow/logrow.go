@@ -0,0 +1,46 @@
+// Package logrow scans memory_logs rows for the sqlite, vector and postgres
+// packages, which all select logs.
+package logrow
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// Columns selects a memory_logs row aliased as l for Scan.
+const Columns = `l.id, l.timestamp, l.source_type, l.content, l.metadata, l.namespace, l.session_id,
+        l.last_accessed_at, l.access_count, l.summarized_into, l.updated_at`
+
+// Scan reads the current row: the extra destinations first, then Columns.
+// It reports false, with a zero entry, when the row has no log, as when an
+// outer join found none.
+func Scan(rows *sql.Rows, extra ...any) (model.LogEntry, bool, error) {
+	var e model.LogEntry
+	var id, source, content, meta, namespace, session, summary sql.NullString
+	var ts, accessed, updated sql.NullTime
+	var count sql.NullInt64
+	dest := append(extra, &id, &ts, &source, &content, &meta, &namespace, &session,
+		&accessed, &count, &summary, &updated)
+	if err := rows.Scan(dest...); err != nil {
+		return e, false, err
+	}
+	if !id.Valid {
+		return e, false, nil
+	}
+	e.ID, e.Timestamp, e.SourceType, e.Content = id.String, ts.Time, source.String, content.String
+	e.Namespace, e.AccessCount = namespace.String, int(count.Int64)
+	if accessed.Valid {
+		e.LastAccessedAt = &accessed.Time
+	}
+	if updated.Valid {
+		e.UpdatedAt = &updated.Time
+	}
+	if meta.Valid && meta.String != "" {
+		_ = json.Unmarshal([]byte(meta.String), &e.Metadata)
+	}
+	e.SessionID = session.String
+	e.SummarizedInto = summary.String
+	return e, true, nil
+}
@@ -0,0 +1,87 @@
+package store_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+// logBuffer collects JSON log records written from any goroutine.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// records returns the logged records with the given message.
+func (b *logBuffer) records(t *testing.T, msg string) []map[string]any {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []map[string]any
+	sc := bufio.NewScanner(bytes.NewReader(b.buf.Bytes()))
+	for sc.Scan() {
+		var rec map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("log line %q: %v", sc.Text(), err)
+		}
+		if rec["msg"] == msg {
+			out = append(out, rec)
+		}
+	}
+	return out
+}
+
+func recallLogged(t *testing.T, level slog.Level) *logBuffer {
+	t.Helper()
+	logs := &logBuffer{}
+	m := storetest.NewTestEngineWithOptions(t, store.Options{
+		Logger: slog.New(slog.NewJSONHandler(logs, &slog.HandlerOptions{Level: level})),
+	})
+	observeAll(t, m, "Alice works at Acme.")
+	if err := m.Consolidate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	recall(t, m, "Alice", model.RecallOptions{})
+	return logs
+}
+
+func TestRecallLogsTimingsAtDebug(t *testing.T) {
+	logs := recallLogged(t, slog.LevelDebug)
+	timings := logs.records(t, "recall timings")
+	if len(timings) != 1 {
+		t.Fatalf("%d recall timing records, want 1", len(timings))
+	}
+	for _, k := range []string{"graph_ms", "vector_ms", "fetch_ms", "facts", "logs"} {
+		if _, ok := timings[0][k]; !ok {
+			t.Errorf("recall timings lack %s: %v", k, timings[0])
+		}
+	}
+	searches := logs.records(t, "fact search")
+	if len(searches) == 0 {
+		t.Fatal("no fact search record")
+	}
+	if c := searches[0]["component"]; c != "graph" {
+		t.Errorf("fact search component = %v, want graph", c)
+	}
+}
+
+func TestDebugLogsFilteredAtWarn(t *testing.T) {
+	logs := recallLogged(t, slog.LevelWarn)
+	if n := len(logs.records(t, "recall timings")) + len(logs.records(t, "fact search")); n != 0 {
+		t.Errorf("%d debug records logged at warn level", n)
+	}
+}
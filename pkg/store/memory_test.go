@@ -0,0 +1,102 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/graph"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+func TestInMemoryEnginesAreIsolated(t *testing.T) {
+	ctx := context.Background()
+	a := storetest.NewTestEngine(t)
+	b := storetest.NewTestEngine(t)
+
+	if err := a.Observe(ctx, model.SensoryInput{Content: "Alice works at Acme"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	facts, err := a.ListFacts(ctx, graph.ListParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(facts.Triples) != 1 || facts.Triples[0].Predicate != "works_at" {
+		t.Fatalf("facts of a = %+v, want alice works_at acme", facts.Triples)
+	}
+
+	st, err := b.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Logs != 0 || st.Triples != 0 {
+		t.Fatalf("b sees %d logs and %d triples of a", st.Logs, st.Triples)
+	}
+}
+
+func TestInMemoryReadsSeeWrites(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngine(t)
+	res, err := m.ObserveWithID(ctx, model.SensoryInput{Content: "the build is green", Source: "ci"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// served by the read pool, which must share the writer's database
+	logs, err := m.RecentLogs(ctx, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || logs[0].ID != res.LogID {
+		t.Fatalf("RecentLogs = %+v, want the log just observed", logs)
+	}
+}
+
+func TestInMemoryRejectsReadOnlyAndEncryption(t *testing.T) {
+	for name, opt := range map[string]store.Options{
+		"read-only": {DBPath: store.MemoryPath, ReadOnly: true},
+		"encrypted": {DBPath: store.MemoryPath, EncryptionKey: "secret"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			opt.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+			m, err := store.NewMemoryEngine(context.Background(), opt)
+			if err == nil {
+				m.Close()
+				t.Fatal("NewMemoryEngine succeeded")
+			}
+		})
+	}
+}
+
+func TestInMemoryHasNoFile(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngine(t)
+	observeAll(t, m, "Alice works at Acme.")
+	if err := m.Ping(ctx); err != nil {
+		t.Errorf("Ping: %v", err)
+	}
+	st, err := m.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.DBSizeBytes != 0 || st.WALSizeBytes != 0 {
+		t.Errorf("database %d bytes and WAL %d bytes, want no files", st.DBSizeBytes, st.WALSizeBytes)
+	}
+	report, err := m.Maintain(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Busy || report.WALBytesBefore != 0 {
+		t.Errorf("maintenance = %+v, want nothing to checkpoint", report)
+	}
+	if _, err := os.Stat(store.MemoryPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("stat %s: %v, want no such file", store.MemoryPath, err)
+	}
+}
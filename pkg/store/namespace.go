@@ -0,0 +1,30 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// maxNamespaceLen bounds namespace names.
+const maxNamespaceLen = 64
+
+// NormalizeNamespace returns the namespace to store and query under: empty
+// means model.DefaultNamespace. Names may use ASCII letters, digits, '-',
+// '_' and '.', up to 64 characters; anything else is ErrInvalidInput.
+func NormalizeNamespace(ns string) (string, error) {
+	if ns == "" {
+		return model.DefaultNamespace, nil
+	}
+	if len(ns) > maxNamespaceLen {
+		return "", fmt.Errorf("%w: namespace is longer than %d characters", ErrInvalidInput, maxNamespaceLen)
+	}
+	for _, r := range ns {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return "", fmt.Errorf("%w: namespace %q may only contain letters, digits, '-', '_' and '.'", ErrInvalidInput, ns)
+		}
+	}
+	return ns, nil
+}
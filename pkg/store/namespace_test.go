@@ -0,0 +1,254 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/graph"
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+// tenants holds the same entity in two namespaces with different facts.
+type tenants struct {
+	m *store.MemoryEngine
+	// logs and facts map each namespace to the ids stored in it
+	logs  map[string]string
+	facts map[string]int64
+}
+
+// aliceObject is what alice is linked to in each tenant namespace.
+var aliceObject = map[string]string{"work": "acme", "home": "paris"}
+
+func newTenants(t *testing.T) *tenants {
+	t.Helper()
+	ctx := context.Background()
+	tn := &tenants{
+		m:     storetest.NewTestEngine(t),
+		logs:  make(map[string]string),
+		facts: make(map[string]int64),
+	}
+	for ns, content := range map[string]string{"work": "Alice works at Acme.", "home": "Alice lives in Paris."} {
+		ids, err := tn.m.ObserveBatch(ctx, []model.SensoryInput{{
+			Content:   content,
+			Namespace: ns,
+			Metadata:  map[string]any{"subject": "alice", "predicate": "linked_to", "object": aliceObject[ns]},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tn.logs[ns] = ids[0]
+	}
+	if err := tn.m.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for ns := range aliceObject {
+		res, err := tn.m.ListFacts(ctx, graph.ListParams{Namespace: ns, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Triples) != 1 {
+			t.Fatalf("%d facts in %s, want 1", len(res.Triples), ns)
+		}
+		tn.facts[ns] = res.Triples[0].ID
+	}
+	return tn
+}
+
+func other(ns string) string {
+	if ns == "work" {
+		return "home"
+	}
+	return "work"
+}
+
+// onlyFacts fails unless every triple belongs to ns and none mentions the
+// other namespace's object.
+func onlyFacts(t *testing.T, what, ns string, triples []model.Triple) {
+	t.Helper()
+	for _, tr := range triples {
+		if tr.Namespace != ns || tr.Object == aliceObject[other(ns)] {
+			t.Errorf("%s in %s returned %s %s %s of %s", what, ns, tr.Subject, tr.Predicate, tr.Object, tr.Namespace)
+		}
+	}
+}
+
+func onlyLogs(t *testing.T, what, ns string, logs []model.LogEntry) {
+	t.Helper()
+	for _, l := range logs {
+		if l.Namespace != ns {
+			t.Errorf("%s in %s returned log %q of %s", what, ns, l.Content, l.Namespace)
+		}
+	}
+}
+
+func TestNamespacesDoNotLeakOnRead(t *testing.T) {
+	ctx := context.Background()
+	tn := newTenants(t)
+	m := tn.m
+	for _, ns := range []string{"work", "home"} {
+		for _, query := range []string{"Alice", ""} {
+			res, err := m.RecallWithOptions(ctx, query, model.RecallOptions{TopK: 10, Namespace: ns})
+			if err != nil {
+				t.Fatal(err)
+			}
+			onlyFacts(t, "recall "+query, ns, res.RelatedFacts)
+			onlyLogs(t, "recall "+query, ns, res.RelatedLogs)
+			if len(res.RelatedFacts)+len(res.RelatedLogs) == 0 {
+				t.Errorf("recall %q in %s found nothing", query, ns)
+			}
+		}
+
+		list, err := m.ListFacts(ctx, graph.ListParams{Namespace: ns, Subject: "alice", Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		onlyFacts(t, "ListFacts", ns, list.Triples)
+
+		recent, err := m.RecentLogs(ctx, ns, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		onlyLogs(t, "RecentLogs", ns, recent)
+		byMeta, err := m.QueryLogsByMetadata(ctx, ns, map[string]string{"subject": "alice"}, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(byMeta) != 1 {
+			t.Errorf("QueryLogsByMetadata in %s = %d logs, want 1", ns, len(byMeta))
+		}
+		onlyLogs(t, "QueryLogsByMetadata", ns, byMeta)
+
+		entities, err := m.ListEntities(ctx, ns, "", 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entities {
+			if e.Entity == aliceObject[other(ns)] {
+				t.Errorf("ListEntities in %s lists %s", ns, e.Entity)
+			}
+		}
+		nb, err := m.Neighbors(ctx, ns, "alice", 2, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		onlyFacts(t, "Neighbors", ns, nb.Facts)
+		near, err := m.Neighborhood(ctx, ns, "alice", 2, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		onlyFacts(t, "Neighborhood", ns, near)
+		view, err := m.GraphView(ctx, ns, "alice", 2, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range view.Nodes {
+			if n.ID == aliceObject[other(ns)] {
+				t.Errorf("GraphView in %s shows %s", ns, n.ID)
+			}
+		}
+		matches, err := m.QueryPattern(ctx, ns, []graph.TriplePattern{{Subject: "alice", Predicate: "?p", Object: "?o"}}, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) != 1 || matches[0].Bindings["o"] != aliceObject[ns] {
+			t.Errorf("QueryPattern in %s = %+v, want alice's %s fact only", ns, matches, aliceObject[ns])
+		}
+		if path, err := m.FindPath(ctx, ns, "alice", aliceObject[other(ns)], 3); err == nil && len(path) > 0 {
+			t.Errorf("FindPath in %s reached %s: %+v", ns, aliceObject[other(ns)], path)
+		}
+
+		if _, err := m.Fact(ctx, ns, tn.facts[other(ns)]); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("Fact of %s read from %s: %v, want ErrNotFound", other(ns), ns, err)
+		}
+		if _, err := m.Log(ctx, ns, tn.logs[other(ns)]); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("Log of %s read from %s: %v, want ErrNotFound", other(ns), ns, err)
+		}
+	}
+}
+
+func TestNamespacesDoNotLeakOnWrite(t *testing.T) {
+	ctx := context.Background()
+	tn := newTenants(t)
+	m := tn.m
+
+	if err := m.DeleteFact(ctx, "work", tn.facts["home"]); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("DeleteFact of a home fact from work: %v, want ErrNotFound", err)
+	}
+	content := "rewritten"
+	if _, err := m.UpdateLog(ctx, "work", tn.logs["home"], sqlite.LogPatch{Content: &content}); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("UpdateLog of a home log from work: %v, want ErrNotFound", err)
+	}
+	if n, err := m.DeleteFacts(ctx, "work", "alice", "", "", false); err != nil || n != 1 {
+		t.Errorf("DeleteFacts(alice) in work = %d, %v; want the work fact", n, err)
+	}
+	if n, err := m.DeleteLogs(ctx, sqlite.DeleteParams{Namespace: "work"}, true); err != nil || n != 1 {
+		t.Errorf("DeleteLogs(all) in work = %d, %v; want the work log", n, err)
+	}
+
+	home, err := m.RecentLogs(ctx, "home", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(home) != 1 || home[0].ID != tn.logs["home"] || home[0].Content != "Alice lives in Paris." {
+		t.Errorf("home logs = %+v, want the Paris log", home)
+	}
+	if n := namespaceFacts(t, m, "home"); n != 1 {
+		t.Errorf("%d home facts left, want 1", n)
+	}
+}
+
+func TestAliasesDoNotLeakAcrossNamespaces(t *testing.T) {
+	ctx := context.Background()
+	tn := newTenants(t)
+	m := tn.m
+
+	if err := m.AddAlias(ctx, "work", "alice", "alicia"); err != nil {
+		t.Fatal(err)
+	}
+	facts := func(ns, subject string) []model.Triple {
+		t.Helper()
+		res, err := m.ListFacts(ctx, graph.ListParams{Namespace: ns, Subject: subject, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Triples
+	}
+	if work := facts("work", "alicia"); len(work) != 1 || work[0].Subject != "alicia" {
+		t.Errorf("work facts of alicia = %+v, want the rewritten work fact", work)
+	}
+	if home := facts("home", ""); len(home) != 1 || home[0].ID != tn.facts["home"] || home[0].Subject != "alice" {
+		t.Errorf("home facts = %+v, want alice's fact untouched by a work alias", home)
+	}
+
+	// writes and lookups in home do not resolve work's aliases
+	if _, err := m.Assert(ctx, []model.Triple{{Subject: "alice", Predicate: "likes", Object: "tea", Namespace: "home"}}); err != nil {
+		t.Fatal(err)
+	}
+	if home := facts("home", "alice"); len(home) != 2 {
+		t.Errorf("home facts of alice = %+v, want both stored under alice", home)
+	}
+	if home := facts("home", "alicia"); len(home) != 0 {
+		t.Errorf("home facts of alicia = %+v, want none", home)
+	}
+}
+
+func TestNormalizeNamespace(t *testing.T) {
+	for in, want := range map[string]string{"": model.DefaultNamespace, "work": "work", "team-a_1.x": "team-a_1.x"} {
+		if got, err := store.NormalizeNamespace(in); err != nil || got != want {
+			t.Errorf("NormalizeNamespace(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"a b", "work/home", "é", string(make([]byte, 65))} {
+		if _, err := store.NormalizeNamespace(in); !errors.Is(err, store.ErrInvalidInput) {
+			t.Errorf("NormalizeNamespace(%q) = %v, want ErrInvalidInput", in, err)
+		}
+	}
+	m := storetest.NewTestEngine(t)
+	if err := m.Observe(context.Background(), model.SensoryInput{Content: "x", Namespace: "a b"}); !errors.Is(err, store.ErrInvalidInput) {
+		t.Errorf("Observe into a malformed namespace: %v, want ErrInvalidInput", err)
+	}
+}
@@ -0,0 +1,122 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+func TestObserveContentLimit(t *testing.T) {
+	ctx := context.Background()
+	for _, tt := range []struct {
+		name     string
+		truncate bool
+		content  string
+		want     string // stored content; "" when rejected
+	}{
+		{"at the limit", false, "héllo", "héllo"},
+		{"over the limit", false, "héllo!", ""},
+		{"empty", false, "", ""},
+		{"blank", false, " \n\t", ""},
+		{"truncated", true, "héllo wörld", "héllo"},
+		{"at the limit with truncation", true, "héllo", "héllo"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := storetest.NewTestEngineWithOptions(t, store.Options{MaxContentChars: 5, TruncateContent: tt.truncate})
+			err := m.Observe(ctx, model.SensoryInput{Content: tt.content})
+			if tt.want == "" {
+				if !errors.Is(err, store.ErrInvalidInput) {
+					t.Fatalf("Observe(%q) = %v, want ErrInvalidInput", tt.content, err)
+				}
+				if logs := logContents(t, m); len(logs) != 0 {
+					t.Fatalf("rejected input stored: %q", logs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if logs := logContents(t, m); len(logs) != 1 || logs[0] != tt.want {
+				t.Fatalf("stored %q, want %q", logs, tt.want)
+			}
+		})
+	}
+}
+
+func TestObserveDefaultContentLimit(t *testing.T) {
+	m := storetest.NewTestEngine(t)
+	err := m.Observe(context.Background(), model.SensoryInput{Content: strings.Repeat("x", store.DefaultMaxContentChars+1)})
+	if !errors.Is(err, store.ErrInvalidInput) {
+		t.Fatalf("Observe of %d characters = %v, want ErrInvalidInput", store.DefaultMaxContentChars+1, err)
+	}
+}
+
+func TestObserveTimestamp(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngine(t)
+	events := m.Subscribe(ctx, "")
+	at := time.Date(2019, 3, 4, 5, 6, 7, 890, time.FixedZone("CEST", 2*60*60))
+	res, err := m.ObserveWithID(ctx, model.SensoryInput{Content: "old diary entry", Timestamp: at})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2019, 3, 4, 3, 6, 7, 0, time.UTC)
+	l, err := m.Log(ctx, "", res.LogID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !l.Log.Timestamp.Equal(want) {
+		t.Errorf("stored timestamp %v, want %v", l.Log.Timestamp, want)
+	}
+	if ev := next(t, events); ev.Log == nil || !ev.Log.Timestamp.Equal(want) {
+		t.Errorf("event = %+v, want the log at %v", ev, want)
+	}
+
+	if err := m.Observe(ctx, model.SensoryInput{Content: "slightly fast clock", Timestamp: time.Now().Add(time.Minute)}); err != nil {
+		t.Errorf("timestamp within the allowed skew: %v", err)
+	}
+	err = m.Observe(ctx, model.SensoryInput{Content: "from the future", Timestamp: time.Now().Add(time.Hour)})
+	if !errors.Is(err, store.ErrInvalidInput) {
+		t.Errorf("timestamp an hour ahead: %v, want ErrInvalidInput", err)
+	}
+}
+
+func TestUniqueContentSourcesStoreOnce(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngineWithOptions(t, store.Options{UniqueContentSources: []string{"bookmark"}, ConsolidateFillRatio: -1})
+	res, err := m.ObserveResults(ctx, []model.SensoryInput{
+		{Content: "https://example.com", Source: "bookmark"},
+		{Content: "https://example.com", Source: "bookmark", Metadata: map[string]any{"tag": "later"}},
+		{Content: "https://example.com", Source: "chat"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res[0].Duplicate || !res[1].Duplicate || res[1].Similarity != 1 || res[1].LogID != res[0].LogID {
+		t.Errorf("bookmark results = %+v, %+v; want the repeat to be the first log", res[0], res[1])
+	}
+	if res[2].Duplicate || res[2].LogID == res[0].LogID {
+		t.Errorf("chat result = %+v, want a log of its own", res[2])
+	}
+	// repeats are neither stored nor distilled again
+	if n := len(logContents(t, m)); n != 2 {
+		t.Errorf("%d logs stored, want 2", n)
+	}
+	if n := bufferLen(t, m); n != 2 {
+		t.Errorf("%d inputs buffered, want 2", n)
+	}
+
+	later, err := m.ObserveWithID(ctx, model.SensoryInput{Content: "https://example.com", Source: "bookmark"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !later.Duplicate || later.LogID != res[0].LogID {
+		t.Errorf("later repeat = %+v, want the first log", later)
+	}
+}
@@ -0,0 +1,47 @@
+package postgres
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+)
+
+// where is sqlite.LogFilter.Where for PostgreSQL: conditions over the
+// memory_logs table aliased as alias, each prefixed with " AND ", whose
+// arguments it adds to a.
+func where(f sqlite.LogFilter, alias string, a *args) string {
+	var b strings.Builder
+	if f.Namespace != "" {
+		b.WriteString(" AND " + alias + ".namespace = " + a.add(f.Namespace))
+	}
+	if f.Source != "" {
+		b.WriteString(" AND " + alias + ".source_type = " + a.add(f.Source))
+	}
+	if !f.From.IsZero() {
+		b.WriteString(" AND " + alias + ".timestamp >= " + a.add(seconds(f.From)))
+	}
+	if !f.To.IsZero() {
+		b.WriteString(" AND " + alias + ".timestamp <= " + a.add(seconds(f.To)))
+	}
+	keys := make([]string, 0, len(f.Metadata))
+	for k := range f.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString(" AND " + metadataCondition(alias+".metadata", k, f.Metadata[k], a))
+	}
+	return b.String()
+}
+
+// metadataCondition matches metadata[key] == value on a jsonb column as the
+// sqlite package does: keys are dotted paths, values are compared as text,
+// JSON booleans match "true"/"false", and keys sqlite.MetadataPath rejects
+// match nothing.
+func metadataCondition(column, key, value string, a *args) string {
+	if _, err := sqlite.MetadataPath(key); err != nil {
+		return "false"
+	}
+	return `(` + column + ` #>> ` + a.add(strings.Split(key, ".")) + `::text[]) = ` + a.add(value)
+}
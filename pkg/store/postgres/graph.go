@@ -0,0 +1,559 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store/graph"
+)
+
+// Graph keeps the knowledge graph in the tables of a Database, with the
+// behavior of graph.Store.
+type Graph struct {
+	db             *sql.DB
+	upsertSQL      string
+	normalize      bool
+	logger         *slog.Logger
+	functional     graph.FunctionalSet
+	contradictions graph.ContradictionPolicy
+}
+
+// NewGraph returns the graph stored in db, a Database's pool, configured as
+// graph.NewWithConfig configures a graph.Store; cfg.Reader is not used.
+func NewGraph(db *sql.DB, cfg graph.Config) *Graph {
+	if cfg.ReinforceRate <= 0 || cfg.ReinforceRate > 1 {
+		cfg.ReinforceRate = 0.5
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	return &Graph{
+		db:             db,
+		upsertSQL:      upsertTripleSQL(cfg),
+		normalize:      !cfg.DisableNormalization,
+		logger:         logger,
+		functional:     graph.NewFunctionalSet(cfg.FunctionalPredicates),
+		contradictions: cfg.Contradictions,
+	}
+}
+
+const tripleColumns = `id, subject, predicate, object, confidence, created_at, observation_count,
+        COALESCE(subject_label, subject), COALESCE(object_label, object), namespace, last_accessed_at, access_count,
+        superseded_by, valid_from, valid_to`
+
+func upsertTripleSQL(cfg graph.Config) string {
+	var merge string
+	switch cfg.Merge {
+	case graph.MergeMax:
+		merge = `GREATEST(t.confidence, excluded.confidence)`
+	case graph.MergeReplace:
+		merge = `excluded.confidence`
+	default:
+		merge = fmt.Sprintf(`LEAST(1.0, t.confidence + (1.0 - t.confidence) * excluded.confidence * %g)`, cfg.ReinforceRate)
+	}
+	return `
+        INSERT INTO triples AS t (subject, predicate, object, confidence, subject_label, object_label, namespace, valid_from, valid_to)
+        VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)
+        ON CONFLICT (namespace, subject, predicate, object) DO UPDATE SET
+            confidence = ` + merge + `,
+            observation_count = t.observation_count + 1,
+            subject_label = excluded.subject_label,
+            object_label = excluded.object_label,
+            valid_from = CASE WHEN t.superseded_by IS NULL THEN COALESCE(excluded.valid_from, t.valid_from)
+                ELSE COALESCE(excluded.valid_from, ` + utcNow + `) END,
+            valid_to = CASE WHEN t.superseded_by IS NULL THEN COALESCE(excluded.valid_to, t.valid_to)
+                ELSE excluded.valid_to END,
+            superseded_by = NULL
+        RETURNING id, observation_count;
+    `
+}
+
+// validityArg returns t as stored in valid_from or valid_to, or nil for an
+// open bound.
+func validityArg(t *time.Time) any {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	return seconds(*t)
+}
+
+// UpsertTriples writes all triples and their source links in a single
+// transaction, as graph.Store.UpsertTriples does.
+func (g *Graph) UpsertTriples(ctx context.Context, triples []model.Triple) ([]graph.UpsertResult, error) {
+	return g.UpsertTriplesWith(ctx, triples, nil)
+}
+
+// UpsertTriplesWith is UpsertTriples that also runs then, when not nil, in
+// the same transaction after the triples are written, so that its writes
+// commit together with the triples or not at all.
+func (g *Graph) UpsertTriplesWith(ctx context.Context, triples []model.Triple, then func(tx *sql.Tx) error) ([]graph.UpsertResult, error) {
+	if len(triples) == 0 && then == nil {
+		return nil, nil
+	}
+	tx, err := g.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var res []graph.UpsertResult
+	if len(triples) > 0 {
+		if res, err = g.upsert(ctx, tx, triples); err != nil {
+			return nil, err
+		}
+	}
+	if then != nil {
+		if err := then(tx); err != nil {
+			return nil, err
+		}
+	}
+	return res, tx.Commit()
+}
+
+func (g *Graph) upsert(ctx context.Context, tx *sql.Tx, triples []model.Triple) ([]graph.UpsertResult, error) {
+	res := make([]graph.UpsertResult, len(triples))
+	for i, t := range triples {
+		namespace := namespaceOrDefault(t.Namespace)
+		subject, err := g.resolve(ctx, tx, namespace, t.Subject)
+		if err != nil {
+			return nil, err
+		}
+		object, err := g.resolve(ctx, tx, namespace, t.Object)
+		if err != nil {
+			return nil, err
+		}
+		subjectLabel, objectLabel := strings.TrimSpace(t.Subject), strings.TrimSpace(t.Object)
+		var observations int64
+		if t.ValidFrom != nil && t.ValidTo != nil && !t.ValidTo.After(*t.ValidFrom) {
+			return nil, fmt.Errorf("triple %d: valid_to must be after valid_from", i)
+		}
+		if err := tx.QueryRowContext(ctx, g.upsertSQL, subject, t.Predicate, object, t.Confidence, subjectLabel, objectLabel, namespace,
+			validityArg(t.ValidFrom), validityArg(t.ValidTo)).Scan(&res[i].ID, &observations); err != nil {
+			return nil, fmt.Errorf("triple %d: %w", i, err)
+		}
+		res[i].Inserted = observations == 1
+		if g.functional.Has(t.Predicate) && t.ValidTo == nil {
+			if res[i].Superseded, err = g.resolveContradictions(ctx, tx, res[i].ID, namespace, subject, t.Predicate, object); err != nil {
+				return nil, fmt.Errorf("triple %d: %w", i, err)
+			}
+		}
+		for _, logID := range t.Sources {
+			if _, err := tx.ExecContext(ctx, `
+                INSERT INTO triple_sources(triple_id, log_id) VALUES ($1, $2) ON CONFLICT DO NOTHING;
+            `, res[i].ID, logID); err != nil {
+				return nil, fmt.Errorf("triple %d: source %s: %w", i, logID, err)
+			}
+		}
+	}
+	return res, nil
+}
+
+// resolveContradictions applies the contradiction policy to the triples of
+// namespace with subject and predicate whose object is not object, once the
+// triple id holding it was upserted, as graph.Store does: superseded
+// triples stop being valid where the new one starts, and the new one ends
+// where a later current value starts. It returns how many triples it
+// superseded or deleted.
+func (g *Graph) resolveContradictions(ctx context.Context, tx *sql.Tx, id int64, namespace, subject, predicate, object string) (int64, error) {
+	if g.contradictions == graph.ContradictionDelete {
+		res, err := tx.ExecContext(ctx, `
+            DELETE FROM triples
+            WHERE namespace = $1 AND subject = $2 AND predicate = $3 AND object <> $4;
+        `, namespace, subject, predicate, object)
+		if err != nil {
+			return 0, err
+		}
+		return res.RowsAffected()
+	}
+
+	var from sql.NullTime
+	if err := tx.QueryRowContext(ctx, `SELECT valid_from FROM triples WHERE id = $1;`, id).Scan(&from); err != nil {
+		return 0, err
+	}
+	at := seconds(time.Now())
+	if from.Valid {
+		at = from.Time
+	}
+	res, err := tx.ExecContext(ctx, `
+        UPDATE triples SET superseded_by = $1, confidence = confidence * $2::double precision,
+            valid_to = $3
+        WHERE namespace = $4 AND subject = $5 AND predicate = $6 AND object <> $7
+          AND superseded_by IS NULL AND (valid_to IS NULL OR valid_to > $3)
+          AND (valid_from IS NULL OR valid_from <= $3);
+    `, id, graph.SupersededConfidence, at, namespace, subject, predicate, object)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if err := g.capAtLaterValue(ctx, tx, id, namespace, subject, predicate, object, at); err != nil {
+		return 0, err
+	}
+	if n == 0 || from.Valid {
+		return n, nil
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE triples SET valid_from = $1 WHERE id = $2;`, at, id)
+	return n, err
+}
+
+// capAtLaterValue ends the validity of triple id, which starts at at, where
+// the earliest current contradicting triple starting after it begins, if
+// any: a value asserted out of order is history, not the current value.
+func (g *Graph) capAtLaterValue(ctx context.Context, tx *sql.Tx, id int64, namespace, subject, predicate, object string, at time.Time) error {
+	var next sql.NullTime
+	err := tx.QueryRowContext(ctx, `
+        SELECT valid_from FROM triples
+        WHERE namespace = $1 AND subject = $2 AND predicate = $3 AND object <> $4
+          AND superseded_by IS NULL AND valid_from > $5
+        ORDER BY valid_from LIMIT 1;
+    `, namespace, subject, predicate, object, at).Scan(&next)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE triples SET valid_to = $1 WHERE id = $2;`, next.Time, id)
+	return err
+}
+
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (g *Graph) normalizeEntity(e string) string {
+	if !g.normalize {
+		return strings.TrimSpace(e)
+	}
+	return graph.NormalizeEntity(e)
+}
+
+// resolve maps an entity to its canonical form: normalization followed by a
+// lookup of the aliases of namespace, "default" when empty. Empty input
+// stays empty so it can act as a wildcard.
+func (g *Graph) resolve(ctx context.Context, q querier, namespace, entity string) (string, error) {
+	entity = g.normalizeEntity(entity)
+	if entity == "" {
+		return "", nil
+	}
+	var canonical string
+	err := q.QueryRowContext(ctx, `SELECT canonical FROM entity_aliases WHERE namespace = $1 AND alias = $2;`,
+		namespaceOrDefault(namespace), entity).Scan(&canonical)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return canonical, nil
+}
+
+// AddAlias makes alias resolve to canonical in namespace ("default" when
+// empty) and merges the triples of namespace stored under the alias into
+// the canonical entity, as graph.Store.AddAlias does.
+func (g *Graph) AddAlias(ctx context.Context, namespace, alias, canonical string) error {
+	tx, err := g.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	namespace = namespaceOrDefault(namespace)
+	a := g.normalizeEntity(alias)
+	c, err := g.resolve(ctx, tx, namespace, canonical)
+	if err != nil {
+		return err
+	}
+	if a == "" || c == "" {
+		return fmt.Errorf("%w: alias and canonical are required", graph.ErrInvalidAlias)
+	}
+	if a == c {
+		return fmt.Errorf("%w: alias resolves to itself", graph.ErrInvalidAlias)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+        INSERT INTO entity_aliases(namespace, alias, canonical) VALUES ($1, $2, $3)
+        ON CONFLICT (namespace, alias) DO UPDATE SET canonical = excluded.canonical;
+    `, namespace, a, c); err != nil {
+		return err
+	}
+	// keep aliases flat: anything that pointed at the alias now points at c
+	if _, err := tx.ExecContext(ctx, `UPDATE entity_aliases SET canonical = $1 WHERE namespace = $2 AND canonical = $3;`, c, namespace, a); err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+        SELECT id, subject, predicate, object FROM triples
+        WHERE namespace = $1 AND (subject = $2 OR object = $2)
+        ORDER BY id;
+    `, namespace, a)
+	if err != nil {
+		return err
+	}
+	type rewrite struct {
+		id                         int64
+		subject, predicate, object string
+	}
+	var targets []rewrite
+	for rows.Next() {
+		var r rewrite
+		if err := rows.Scan(&r.id, &r.subject, &r.predicate, &r.object); err != nil {
+			rows.Close()
+			return err
+		}
+		if r.subject == a {
+			r.subject = c
+		}
+		if r.object == a {
+			r.object = c
+		}
+		targets = append(targets, r)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	// a rewritten triple that already exists under the canonical entity is
+	// merged into it: confidence keeps the maximum, observation counts are
+	// summed and provenance links are carried over
+	for _, r := range targets {
+		var existing int64
+		err := tx.QueryRowContext(ctx, `
+            SELECT id FROM triples
+            WHERE namespace = $1 AND subject = $2 AND predicate = $3 AND object = $4 AND id <> $5;
+        `, namespace, r.subject, r.predicate, r.object, r.id).Scan(&existing)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			if _, err := tx.ExecContext(ctx, `
+                UPDATE triples SET subject = $1, object = $2 WHERE id = $3;
+            `, r.subject, r.object, r.id); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		default:
+			if _, err := tx.ExecContext(ctx, `
+                UPDATE triples t SET
+                    confidence = GREATEST(t.confidence, m.confidence),
+                    observation_count = t.observation_count + m.observation_count
+                FROM triples m
+                WHERE t.id = $1 AND m.id = $2;
+            `, existing, r.id); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `
+                INSERT INTO triple_sources(triple_id, log_id)
+                SELECT $1::bigint, log_id FROM triple_sources WHERE triple_id = $2
+                ON CONFLICT DO NOTHING;
+            `, existing, r.id); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `DELETE FROM triples WHERE id = $1;`, r.id); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// GetTriple fetches a triple by id along with its source log ids. It returns
+// sql.ErrNoRows when the triple does not exist.
+func (g *Graph) GetTriple(ctx context.Context, id int64) (*model.Triple, error) {
+	t, err := scanTriple(g.db.QueryRowContext(ctx, `SELECT `+tripleColumns+` FROM triples WHERE id = $1;`, id))
+	if err != nil {
+		return nil, err
+	}
+	sources, err := g.SourcesOf(ctx, []int64{id})
+	if err != nil {
+		return nil, err
+	}
+	t.Sources = sources[id]
+	return t, nil
+}
+
+// SourcesOf returns the source log ids of each given triple.
+func (g *Graph) SourcesOf(ctx context.Context, ids []int64) (map[int64][]string, error) {
+	out := make(map[int64][]string, len(ids))
+	if len(ids) == 0 {
+		return out, nil
+	}
+	// log ids sort bytewise, as in SQLite, whatever the database collation
+	rows, err := g.db.QueryContext(ctx, `
+        SELECT triple_id, log_id FROM triple_sources
+        WHERE triple_id = ANY($1)
+        ORDER BY triple_id, log_id COLLATE "C";
+    `, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var logID string
+		if err := rows.Scan(&id, &logID); err != nil {
+			return nil, err
+		}
+		out[id] = append(out[id], logID)
+	}
+	return out, rows.Err()
+}
+
+// TriplesFromLog returns the triples distilled from a log, most confident
+// first.
+func (g *Graph) TriplesFromLog(ctx context.Context, logID string) ([]model.Triple, error) {
+	rows, err := g.db.QueryContext(ctx, `
+        SELECT `+tripleColumns+`
+        FROM triples
+        WHERE id IN (SELECT triple_id FROM triple_sources WHERE log_id = $1)
+        ORDER BY confidence DESC, created_at DESC;
+    `, logID)
+	if err != nil {
+		return nil, err
+	}
+	return scanTriples(rows)
+}
+
+// DeleteTriple removes a triple of namespace (any namespace when empty) by
+// id. It returns sql.ErrNoRows when there is no such triple. The schema's
+// delete trigger hands the triples it superseded on, as in SQLite.
+func (g *Graph) DeleteTriple(ctx context.Context, namespace string, id int64) error {
+	a := args{id}
+	res, err := g.db.ExecContext(ctx, `DELETE FROM triples WHERE id = $1`+namespaceCond(namespace, &a)+`;`, a...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteMatching removes triples of namespace matching the given fields
+// exactly, where an empty string is a wildcard, and returns the number of
+// removed rows. It fails with graph.ErrNoFilter when every field is empty.
+func (g *Graph) DeleteMatching(ctx context.Context, namespace, subject, predicate, object string) (int64, error) {
+	var err error
+	if subject, err = g.resolve(ctx, g.db, namespace, subject); err != nil {
+		return 0, err
+	}
+	if object, err = g.resolve(ctx, g.db, namespace, object); err != nil {
+		return 0, err
+	}
+	var conds []string
+	a := args{}
+	for _, f := range []struct{ col, val string }{{"subject", subject}, {"predicate", predicate}, {"object", object}} {
+		if f.val != "" {
+			conds = append(conds, f.col+" = "+a.add(f.val))
+		}
+	}
+	if len(conds) == 0 {
+		return 0, graph.ErrNoFilter
+	}
+	res, err := g.db.ExecContext(ctx, `DELETE FROM triples WHERE `+strings.Join(conds, " AND ")+namespaceCond(namespace, &a)+`;`, a...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DeleteAll clears the triples of namespace, or every triple when namespace
+// is empty, and returns how many were removed.
+func (g *Graph) DeleteAll(ctx context.Context, namespace string) (int64, error) {
+	a := args{}
+	res, err := g.db.ExecContext(ctx, `DELETE FROM triples WHERE true`+namespaceCond(namespace, &a)+`;`, a...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// PruneTriples deletes stale, low-confidence triples selected by p and
+// returns how many were removed, as graph.Store.PruneTriples does.
+func (g *Graph) PruneTriples(ctx context.Context, p graph.PruneParams) (int64, error) {
+	if p.MaxAge <= 0 || p.MaxConfidence <= 0 || p.MaxConfidence > 1 {
+		return 0, graph.ErrInvalidPrune
+	}
+	a := args{}
+	query := `DELETE FROM triples WHERE confidence < ` + a.add(p.MaxConfidence) +
+		` AND COALESCE(last_accessed_at, created_at) <= ` + a.add(seconds(time.Now().Add(-p.MaxAge)))
+	if p.Predicate != "" {
+		query += ` AND predicate = ` + a.add(p.Predicate)
+	}
+	res, err := g.db.ExecContext(ctx, query+namespaceCond(p.Namespace, &a)+`;`, a...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Count returns the number of triples across all namespaces.
+func (g *Graph) Count(ctx context.Context) (int64, error) {
+	var n int64
+	if err := g.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM triples;`).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// namespaceCond returns a condition, prefixed with " AND ", keeping triples
+// of namespace, or nothing when namespace is empty.
+func namespaceCond(namespace string, a *args) string {
+	if namespace == "" {
+		return ""
+	}
+	return " AND triples.namespace = " + a.add(namespace)
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanTriple reads a row selected with tripleColumns.
+func scanTriple(row scanner) (*model.Triple, error) {
+	var t model.Triple
+	var accessed sql.NullTime
+	var superseded sql.NullInt64
+	var validFrom, validTo sql.NullTime
+	if err := row.Scan(&t.ID, &t.Subject, &t.Predicate, &t.Object, &t.Confidence, &t.CreatedAt, &t.ObservationCount,
+		&t.SubjectLabel, &t.ObjectLabel, &t.Namespace, &accessed, &t.AccessCount, &superseded, &validFrom, &validTo); err != nil {
+		return nil, err
+	}
+	if accessed.Valid {
+		t.LastAccessedAt = &accessed.Time
+	}
+	if validFrom.Valid {
+		t.ValidFrom = &validFrom.Time
+	}
+	if validTo.Valid {
+		t.ValidTo = &validTo.Time
+	}
+	t.SupersededBy = superseded.Int64
+	return &t, nil
+}
+
+func scanTriples(rows *sql.Rows) ([]model.Triple, error) {
+	defer rows.Close()
+	var out []model.Triple
+	for rows.Next() {
+		t, err := scanTriple(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *t)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,110 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/johncui/PAIM/pkg/store/graph"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+// ListTriples pages through triples by ascending id, as
+// graph.Store.ListTriples does.
+func (g *Graph) ListTriples(ctx context.Context, p graph.ListParams) (graph.ListResult, error) {
+	if p.Limit <= 0 {
+		p.Limit = defaultListLimit
+	}
+	if p.Limit > maxListLimit {
+		p.Limit = maxListLimit
+	}
+	if p.Match == "" {
+		p.Match = graph.MatchExact
+	}
+	subject, err := g.listTerms(ctx, p.Namespace, p.Match, p.Subject, true)
+	if err != nil {
+		return graph.ListResult{}, err
+	}
+	object, err := g.listTerms(ctx, p.Namespace, p.Match, p.Object, true)
+	if err != nil {
+		return graph.ListResult{}, err
+	}
+	predicate, _ := g.listTerms(ctx, p.Namespace, p.Match, p.Predicate, false)
+
+	// the cursor is always $1, so the count below can reuse the arguments
+	a := args{p.Cursor}
+	cond := ` WHERE id > $1`
+	if p.Namespace != "" {
+		cond += ` AND namespace = ` + a.add(p.Namespace)
+	}
+	for _, f := range []struct {
+		column string
+		terms  []string
+	}{
+		{"subject", subject}, {"predicate", predicate}, {"object", object},
+	} {
+		if len(f.terms) == 0 {
+			continue
+		}
+		cond += ` AND ` + termsCondition(p.Match, f.column, f.terms, &a)
+	}
+	if p.MinConfidence > 0 {
+		cond += ` AND confidence >= ` + a.add(p.MinConfidence)
+	}
+	switch {
+	case !p.AsOf.IsZero():
+		cond += validAt(p.AsOf, &a)
+	case !p.IncludeSuperseded:
+		cond += ` AND superseded_by IS NULL`
+	}
+
+	countArgs := append(args{}, a...)
+	rows, err := g.db.QueryContext(ctx, `SELECT `+tripleColumns+` FROM triples`+cond+` ORDER BY id LIMIT `+a.add(p.Limit)+`;`, a...)
+	if err != nil {
+		return graph.ListResult{}, err
+	}
+	triples, err := scanTriples(rows)
+	if err != nil {
+		return graph.ListResult{}, err
+	}
+	res := graph.ListResult{Triples: triples}
+	if len(triples) < p.Limit {
+		return res, nil
+	}
+
+	last := triples[len(triples)-1].ID
+	countArgs[0] = last
+	if err := g.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM triples`+cond+`;`, countArgs...).Scan(&res.Remaining); err != nil {
+		return graph.ListResult{}, err
+	}
+	if res.Remaining > 0 {
+		res.NextCursor = last
+	}
+	return res, nil
+}
+
+// listTerms returns what a ListParams field matches: its words for a
+// tokenized mode, else the term itself, or nothing for an empty term.
+// Entities are resolved through the aliases of namespace, each word on its
+// own.
+func (g *Graph) listTerms(ctx context.Context, namespace string, mode graph.MatchMode, term string, entity bool) ([]string, error) {
+	terms := []string{term}
+	if mode.Tokenized() {
+		terms = graph.Tokenize(term)
+	}
+	out := make([]string, 0, len(terms))
+	for _, t := range terms {
+		if entity {
+			var err error
+			if t, err = g.resolve(ctx, g.db, namespace, t); err != nil {
+				return nil, err
+			}
+		}
+		if t != "" {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
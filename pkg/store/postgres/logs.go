@@ -0,0 +1,296 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store/internal/logrow"
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+)
+
+// logColumns selects a memory_logs row aliased as l for scanLog.
+const logColumns = logrow.Columns
+
+const insertLogSQL = `
+        INSERT INTO memory_logs(id, timestamp, source_type, content, metadata, namespace, session_id, content_hash)
+        VALUES($1, COALESCE($2, ` + utcNow + `), $3, $4, $5, $6, $7, $8);
+    `
+
+// findContentSQL is the sqlite package's: the oldest log of a namespace and
+// source with the given content, compared as well as its hash.
+const findContentSQL = `
+        SELECT id FROM memory_logs
+        WHERE content_hash = $1 AND namespace = $2 AND source_type = $3 AND content = $4
+        ORDER BY timestamp, id LIMIT 1;
+    `
+
+// sessionOrNull stores an empty session id as NULL.
+func sessionOrNull(id string) sql.NullString {
+	return sql.NullString{String: id, Valid: id != ""}
+}
+
+// timestampOrNull passes an explicit log timestamp in whole seconds; zero
+// lets the database use the current time.
+func timestampOrNull(t time.Time) sql.NullTime {
+	if t.IsZero() {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: seconds(t), Valid: true}
+}
+
+// UniqueContent reports whether logs of source are stored exactly once by
+// content (Config.UniqueContentSources).
+func (d *Database) UniqueContent(source string) bool {
+	return d.uniqueSources[source]
+}
+
+// InsertLogs is sqlite.Database.InsertLogs: it writes many logs in one
+// transaction and returns their ids in input order, with the inputs of a
+// unique-content source that repeat a stored log answered by that log.
+func (d *Database) InsertLogs(ctx context.Context, inputs []model.SensoryInput) (ids []string, existing []bool, err error) {
+	return d.insertLogs(ctx, inputs, false)
+}
+
+// InsertLogsPendingEmbedding is InsertLogs that also enqueues every row it
+// stores for embedding in the same transaction.
+func (d *Database) InsertLogsPendingEmbedding(ctx context.Context, inputs []model.SensoryInput) (ids []string, existing []bool, err error) {
+	return d.insertLogs(ctx, inputs, true)
+}
+
+func (d *Database) insertLogs(ctx context.Context, inputs []model.SensoryInput, enqueue bool) ([]string, []bool, error) {
+	if len(inputs) == 0 {
+		return nil, nil, nil
+	}
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	// wrap names the failing input of a batch
+	wrap := func(i int, err error) error {
+		if len(inputs) > 1 {
+			return fmt.Errorf("input %d: %w", i, err)
+		}
+		return err
+	}
+	ids := make([]string, len(inputs))
+	existing := make([]bool, len(inputs))
+	for i, input := range inputs {
+		if input.Content == "" {
+			return nil, nil, wrap(i, fmt.Errorf("content is required"))
+		}
+		ns := namespaceOrDefault(input.Namespace)
+		hash := sqlite.ContentHash(input.Content)
+		if d.uniqueSources[input.Source] {
+			err := tx.QueryRowContext(ctx, findContentSQL, hash, ns, input.Source, input.Content).Scan(&ids[i])
+			if err == nil {
+				existing[i] = true
+				continue
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return nil, nil, wrap(i, err)
+			}
+		}
+		ids[i] = uuid.NewString()
+		metaBytes, _ := json.Marshal(input.Metadata)
+		if _, err := tx.ExecContext(ctx, insertLogSQL, ids[i], timestampOrNull(input.Timestamp), input.Source, input.Content,
+			string(metaBytes), ns, sessionOrNull(input.SessionID), hash); err != nil {
+			return nil, nil, wrap(i, err)
+		}
+		if enqueue {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO embedding_queue(log_id) VALUES ($1)`, ids[i]); err != nil {
+				return nil, nil, wrap(i, err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return ids, existing, nil
+}
+
+// FetchLog retrieves a single log by id. It returns sql.ErrNoRows when the
+// log does not exist.
+func (d *Database) FetchLog(ctx context.Context, id string) (*model.LogEntry, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT `+logColumns+` FROM memory_logs l WHERE l.id = $1;`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, sql.ErrNoRows
+	}
+	e, err := scanLog(rows)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// FetchLogs retrieves logs by ids, in no particular order.
+func (d *Database) FetchLogs(ctx context.Context, ids []string) ([]model.LogEntry, error) {
+	return d.FetchLogsFiltered(ctx, ids, sqlite.LogFilter{})
+}
+
+// FetchLogsFiltered is FetchLogs restricted to logs matching f.
+func (d *Database) FetchLogsFiltered(ctx context.Context, ids []string, f sqlite.LogFilter) ([]model.LogEntry, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	a := args{}
+	query := `SELECT ` + logColumns + ` FROM memory_logs l WHERE l.id = ANY(` + a.add(ids) + `)` + where(f, "l", &a)
+	rows, err := d.db.QueryContext(ctx, query, a...)
+	if err != nil {
+		d.logger.Error("fetch logs failed", "ids", len(ids), "err", err)
+		return nil, err
+	}
+	return scanLogs(rows)
+}
+
+// RecentLogsFiltered returns the latest limit logs matching f, newest first.
+func (d *Database) RecentLogsFiltered(ctx context.Context, limit int, f sqlite.LogFilter) ([]model.LogEntry, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	a := args{}
+	cond := where(f, "l", &a)
+	rows, err := d.db.QueryContext(ctx, `
+        SELECT `+logColumns+`
+        FROM memory_logs l
+        WHERE true`+cond+`
+        ORDER BY l.timestamp DESC, l.seq DESC
+        LIMIT `+a.add(limit)+`;
+    `, a...)
+	if err != nil {
+		return nil, err
+	}
+	return scanLogs(rows)
+}
+
+// FetchSessionFiltered returns the logs of a session matching f in
+// chronological order.
+func (d *Database) FetchSessionFiltered(ctx context.Context, sessionID string, f sqlite.LogFilter) ([]model.LogEntry, error) {
+	if sessionID == "" {
+		return nil, nil
+	}
+	a := args{}
+	session := a.add(sessionID)
+	rows, err := d.db.QueryContext(ctx, `
+        SELECT `+logColumns+`
+        FROM memory_logs l
+        WHERE l.session_id = `+session+where(f, "l", &a)+`
+        ORDER BY l.timestamp, l.seq;
+    `, a...)
+	if err != nil {
+		return nil, err
+	}
+	return scanLogs(rows)
+}
+
+// EachLog calls fn for every log of every namespace in timestamp order.
+func (d *Database) EachLog(ctx context.Context, fn func(model.LogEntry) error) error {
+	rows, err := d.db.QueryContext(ctx, `
+        SELECT `+logColumns+`
+        FROM memory_logs l
+        ORDER BY l.timestamp, l.seq;
+    `)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		e, err := scanLog(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// CountLogs returns the number of memory logs across all namespaces.
+func (d *Database) CountLogs(ctx context.Context) (int64, error) {
+	var n int64
+	err := d.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM memory_logs;`).Scan(&n)
+	return n, err
+}
+
+// ImportLogs inserts logs keeping their ids, timestamps, sessions and
+// namespaces (the default one when unset); logs whose id already exists are
+// skipped. With enqueue set, inserted logs are queued for embedding. It
+// returns how many logs were inserted.
+func (d *Database) ImportLogs(ctx context.Context, logs []model.LogEntry, enqueue bool) (int64, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var inserted int64
+	for _, e := range logs {
+		ts := e.Timestamp
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+		metaBytes, _ := json.Marshal(e.Metadata)
+		var updated sql.NullTime
+		if e.UpdatedAt != nil {
+			updated = sql.NullTime{Time: e.UpdatedAt.UTC(), Valid: true}
+		}
+		res, err := tx.ExecContext(ctx, `
+            INSERT INTO memory_logs(id, timestamp, source_type, content, metadata, namespace, session_id, updated_at, content_hash)
+            VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)
+            ON CONFLICT (id) DO NOTHING;
+        `, e.ID, seconds(ts), e.SourceType, e.Content, string(metaBytes), namespaceOrDefault(e.Namespace),
+			sessionOrNull(e.SessionID), updated, sqlite.ContentHash(e.Content))
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			continue
+		}
+		inserted++
+		if enqueue {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO embedding_queue(log_id) VALUES ($1) ON CONFLICT DO NOTHING`, e.ID); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return inserted, tx.Commit()
+}
+
+func scanLogs(rows *sql.Rows) ([]model.LogEntry, error) {
+	defer rows.Close()
+
+	var entries []model.LogEntry
+	for rows.Next() {
+		e, err := scanLog(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// scanLog reads the current row of a logColumns query.
+func scanLog(rows *sql.Rows) (model.LogEntry, error) {
+	e, _, err := logrow.Scan(rows)
+	return e, err
+}
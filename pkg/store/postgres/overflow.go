@@ -0,0 +1,122 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// StageOverflow records logs whose buffered inputs were evicted, so the next
+// consolidation distills them from the log instead. Logs already staged or
+// no longer stored are ignored.
+func (d *Database) StageOverflow(ctx context.Context, logIDs []string) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// one id at a time, so the staging order is the order of logIDs
+	for _, id := range logIDs {
+		if _, err := tx.ExecContext(ctx, `
+            INSERT INTO consolidation_overflow(log_id)
+            SELECT id FROM memory_logs WHERE id = $1
+            ON CONFLICT DO NOTHING;
+        `, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// OverflowLogs returns up to limit staged logs, oldest staged first.
+func (d *Database) OverflowLogs(ctx context.Context, limit int) ([]model.LogEntry, error) {
+	rows, err := d.db.QueryContext(ctx, `
+        SELECT `+logColumns+`
+        FROM consolidation_overflow o JOIN memory_logs l ON l.id = o.log_id
+        ORDER BY o.staged_at, o.seq
+        LIMIT $1;
+    `, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanLogs(rows)
+}
+
+// ClearOverflowTx unstages logs once they were consolidated, within tx, a
+// transaction Graph.UpsertTriplesWith opened on this database.
+func (d *Database) ClearOverflowTx(ctx context.Context, tx *sql.Tx, logIDs []string) error {
+	if len(logIDs) == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `DELETE FROM consolidation_overflow WHERE log_id = ANY($1);`, logIDs)
+	return err
+}
+
+// OverflowCount returns how many staged logs wait for consolidation.
+func (d *Database) OverflowCount(ctx context.Context) (int64, error) {
+	var n int64
+	err := d.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM consolidation_overflow;`).Scan(&n)
+	return n, err
+}
+
+// RecordConsolidationRun adds run to the consolidation history, setting its
+// ID, and deletes all but the keep latest runs in the same transaction;
+// keep <= 0 keeps every run.
+func (d *Database) RecordConsolidationRun(ctx context.Context, run *model.ConsolidationRun, keep int) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+        INSERT INTO consolidation_runs(started_at, finished_at, inputs, triples_written, error)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING id;
+    `, run.StartedAt.UTC(), run.FinishedAt.UTC(), run.Inputs, run.TriplesWritten,
+		sql.NullString{String: run.Error, Valid: run.Error != ""}).Scan(&id)
+	if err != nil {
+		return err
+	}
+	if keep > 0 {
+		if _, err := tx.ExecContext(ctx, `
+            DELETE FROM consolidation_runs
+            WHERE id <= (SELECT id FROM consolidation_runs ORDER BY id DESC LIMIT 1 OFFSET $1);
+        `, keep); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	run.ID = id
+	return nil
+}
+
+// ConsolidationRuns returns up to limit runs of the consolidation history,
+// latest first.
+func (d *Database) ConsolidationRuns(ctx context.Context, limit int) ([]model.ConsolidationRun, error) {
+	rows, err := d.db.QueryContext(ctx, `
+        SELECT id, started_at, finished_at, inputs, triples_written, error
+        FROM consolidation_runs
+        ORDER BY id DESC
+        LIMIT $1;
+    `, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []model.ConsolidationRun
+	for rows.Next() {
+		var r model.ConsolidationRun
+		var msg sql.NullString
+		if err := rows.Scan(&r.ID, &r.StartedAt, &r.FinishedAt, &r.Inputs, &r.TriplesWritten, &msg); err != nil {
+			return nil, err
+		}
+		r.Error = msg.String
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
@@ -0,0 +1,256 @@
+// Package postgres stores memory logs, the knowledge graph and their
+// embeddings in PostgreSQL, with pgvector for vector search. It mirrors the
+// behavior of the sqlite, graph and vector packages, and reuses their types,
+// so the engine can run on either; storetest.RunConformance checks both.
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+)
+
+// IsDSN reports whether path names a PostgreSQL database, as a postgres://
+// or postgresql:// URL, rather than a SQLite file.
+func IsDSN(path string) bool {
+	return strings.HasPrefix(path, "postgres://") || strings.HasPrefix(path, "postgresql://")
+}
+
+// Config controls PostgreSQL initialization.
+type Config struct {
+	// DSN is the connection URL; see IsDSN.
+	DSN       string
+	EnableVSS bool
+	VectorDim int
+	// MigrateDim lets New rebuild a vector table created with a different
+	// dimension instead of failing with sqlite.ErrVectorDimMismatch.
+	MigrateDim bool
+	// MaxConns sizes the connection pool (default 8).
+	MaxConns int
+	Logger   *slog.Logger
+
+	// ReadOnly opens every connection with default_transaction_read_only,
+	// for serving a replica: nothing is migrated or created, so the schema
+	// must already be current.
+	ReadOnly bool
+
+	// UniqueContentSources is sqlite.Config.UniqueContentSources.
+	UniqueContentSources []string
+}
+
+// Database keeps the memory logs and their bookkeeping in PostgreSQL. Unlike
+// sqlite.Database it needs no separate writer: every query goes through one
+// pool, and the server orders concurrent writes.
+type Database struct {
+	db         *sql.DB
+	enableVSS  bool
+	vectorDim  int
+	migrateDim bool
+	readOnly   bool
+	logger     *slog.Logger
+
+	schemaVersion int
+	vectorVersion string
+	uniqueSources map[string]bool
+}
+
+// Open connects to cfg.DSN and prepares the schema as New does.
+func Open(ctx context.Context, cfg Config) (*Database, error) {
+	if cfg.DSN == "" {
+		return nil, errors.New("database URL is required")
+	}
+	pc, err := pgx.ParseConfig(cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ReadOnly {
+		pc.RuntimeParams["default_transaction_read_only"] = "on"
+	}
+	db := stdlib.OpenDB(*pc)
+	if cfg.MaxConns <= 0 {
+		cfg.MaxConns = 8
+	}
+	db.SetMaxOpenConns(cfg.MaxConns)
+	db.SetMaxIdleConns(cfg.MaxConns)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connect to postgres: %w", err)
+	}
+	d, err := New(ctx, db, cfg)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// New wraps db, an open pgx handle, and migrates the schema, or with
+// cfg.ReadOnly checks that it is current; cfg.DSN and cfg.MaxConns are not
+// used. With cfg.EnableVSS it also creates the pgvector extension and the
+// vector table, failing with sqlite.ErrVectorUnavailable when the server
+// lacks pgvector.
+func New(ctx context.Context, db *sql.DB, cfg Config) (*Database, error) {
+	if cfg.VectorDim == 0 {
+		cfg.VectorDim = 1536
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	d := &Database{db: db, enableVSS: cfg.EnableVSS, vectorDim: cfg.VectorDim, migrateDim: cfg.MigrateDim,
+		readOnly: cfg.ReadOnly, logger: cfg.Logger}
+	for _, s := range cfg.UniqueContentSources {
+		if d.uniqueSources == nil {
+			d.uniqueSources = make(map[string]bool)
+		}
+		d.uniqueSources[s] = true
+	}
+
+	ensure := d.ensureSchema
+	if cfg.ReadOnly {
+		ensure = d.checkSchema
+	}
+	if err := ensure(ctx); err != nil {
+		return nil, err
+	}
+	if cfg.EnableVSS {
+		if err := db.QueryRowContext(ctx, `SELECT extversion FROM pg_extension WHERE extname = 'vector';`).Scan(&d.vectorVersion); err != nil {
+			return nil, fmt.Errorf("%w: read the pgvector version: %v", sqlite.ErrVectorUnavailable, err)
+		}
+		cfg.Logger.Info("vector search available", "backend", vectorName, "version", d.vectorVersion)
+	}
+	return d, nil
+}
+
+// DB returns the connection pool.
+func (d *Database) DB() *sql.DB {
+	return d.db
+}
+
+// Close releases the connection pool.
+func (d *Database) Close() error {
+	return d.db.Close()
+}
+
+// Path returns "": there is no database file to measure.
+func (d *Database) Path() string {
+	return ""
+}
+
+// InMemory reports false; a PostgreSQL database always outlives the engine.
+func (d *Database) InMemory() bool {
+	return false
+}
+
+// HasVSS indicates whether vector search is available.
+func (d *Database) HasVSS() bool {
+	return d.enableVSS
+}
+
+// VectorVersion returns the version of the pgvector extension, or ""
+// without vector search.
+func (d *Database) VectorVersion() string {
+	return d.vectorVersion
+}
+
+// ReadOnly reports whether the database was opened with Config.ReadOnly.
+func (d *Database) ReadOnly() bool {
+	return d.readOnly
+}
+
+// Encrypted reports false: encryption at rest is the server's business.
+func (d *Database) Encrypted() bool {
+	return false
+}
+
+// SchemaVersion returns the migration version the database is at.
+func (d *Database) SchemaVersion() int {
+	return d.schemaVersion
+}
+
+// VectorDim returns configured embedding dimension.
+func (d *Database) VectorDim() int {
+	return d.vectorDim
+}
+
+// Ping checks that the server answers a query.
+func (d *Database) Ping(ctx context.Context) error {
+	var one int
+	return d.db.QueryRowContext(ctx, `SELECT 1;`).Scan(&one)
+}
+
+// Rekey is not supported: the server manages encryption at rest.
+func (d *Database) Rekey(ctx context.Context, newKey string) error {
+	return fmt.Errorf("rekey a postgres database: %w", errors.ErrUnsupported)
+}
+
+// Backup is not supported: use pg_dump, which takes a consistent snapshot
+// of a live database.
+func (d *Database) Backup(ctx context.Context, destPath string) error {
+	return fmt.Errorf("back up a postgres database (use pg_dump): %w", errors.ErrUnsupported)
+}
+
+// Maintain refreshes the query planner statistics with ANALYZE. Autovacuum
+// reclaims space on its own, so there is no WAL to checkpoint and the WAL
+// fields of the report stay zero.
+func (d *Database) Maintain(ctx context.Context) (sqlite.MaintenanceReport, error) {
+	start := time.Now()
+	var report sqlite.MaintenanceReport
+	if _, err := d.db.ExecContext(ctx, `ANALYZE;`); err != nil {
+		return report, err
+	}
+	report.DurationSeconds = time.Since(start).Seconds()
+	d.logger.Info("database maintenance", "duration", time.Since(start))
+	return report, nil
+}
+
+// IsBusy reports whether err is PostgreSQL giving up on a lock or a
+// serialization conflict with another transaction, which is worth retrying
+// later.
+func IsBusy(err error) bool {
+	var pe *pgconn.PgError
+	if !errors.As(err, &pe) {
+		return false
+	}
+	switch pe.Code {
+	case "40001", "40P01", "55P03": // serialization_failure, deadlock_detected, lock_not_available
+		return true
+	}
+	return false
+}
+
+// args collects the arguments of a query as it is built.
+type args []any
+
+// add appends v and returns its placeholder.
+func (a *args) add(v any) string {
+	*a = append(*a, v)
+	return "$" + strconv.Itoa(len(*a))
+}
+
+// namespaceOrDefault maps the empty namespace to model.DefaultNamespace.
+func namespaceOrDefault(ns string) string {
+	if ns == "" {
+		return model.DefaultNamespace
+	}
+	return ns
+}
+
+// seconds truncates t to the whole seconds in UTC that logs and triples are
+// dated with, as in SQLite.
+func seconds(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
@@ -0,0 +1,217 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+	"github.com/johncui/PAIM/pkg/store/vector"
+)
+
+// ClaimEmbeddings returns up to limit queued logs that are due for an attempt
+// and leases them for the given duration. Rows another worker is claiming
+// at the same moment are skipped rather than waited for.
+func (d *Database) ClaimEmbeddings(ctx context.Context, limit int, lease time.Duration) ([]sqlite.PendingEmbedding, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	now := time.Now()
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+        SELECT q.log_id, l.content, q.attempts
+        FROM embedding_queue q
+        JOIN memory_logs l ON l.id = q.log_id
+        WHERE q.next_attempt_at <= $1
+        ORDER BY q.attempts ASC, q.enqueued_at ASC
+        LIMIT $2
+        FOR UPDATE OF q SKIP LOCKED;
+    `, now.Unix(), limit)
+	if err != nil {
+		return nil, err
+	}
+	var out []sqlite.PendingEmbedding
+	var ids []string
+	for rows.Next() {
+		var p sqlite.PendingEmbedding
+		if err := rows.Scan(&p.LogID, &p.Content, &p.Attempts); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		out = append(out, p)
+		ids = append(ids, p.LogID)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE embedding_queue SET next_attempt_at = $1 WHERE log_id = ANY($2)`,
+		now.Add(lease).Unix(), ids); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ReleaseEmbeddings ends the leases ClaimEmbeddings took on logs that were
+// not attempted, making them due again right away.
+func (d *Database) ReleaseEmbeddings(ctx context.Context, logIDs []string) error {
+	if len(logIDs) == 0 {
+		return nil
+	}
+	_, err := d.db.ExecContext(ctx, `UPDATE embedding_queue SET next_attempt_at = $1 WHERE log_id = ANY($2);`,
+		time.Now().Unix(), logIDs)
+	return err
+}
+
+// CompleteEmbedding removes a log from the embedding queue.
+func (d *Database) CompleteEmbedding(ctx context.Context, logID string) error {
+	_, err := d.db.ExecContext(ctx, `DELETE FROM embedding_queue WHERE log_id = $1`, logID)
+	return err
+}
+
+// FailEmbedding records a failed embedding attempt and schedules the next one.
+func (d *Database) FailEmbedding(ctx context.Context, logID string, cause error, retryAt time.Time) error {
+	_, err := d.db.ExecContext(ctx, `
+        UPDATE embedding_queue SET attempts = attempts + 1, last_error = $1, next_attempt_at = $2
+        WHERE log_id = $3;
+    `, cause.Error(), retryAt.Unix(), logID)
+	return err
+}
+
+// LogEmbeddingState reports the embedding state of a log. The vector table
+// is only consulted when indexed is set, since it does not exist while
+// vector search is disabled.
+func (d *Database) LogEmbeddingState(ctx context.Context, logID string, indexed bool) (sqlite.EmbeddingState, error) {
+	var st sqlite.EmbeddingState
+	if indexed {
+		err := d.db.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM `+vectorTable+` WHERE log_id = $1);`, logID).Scan(&st.Indexed)
+		if err != nil {
+			return st, err
+		}
+	}
+	var lastErr sql.NullString
+	err := d.db.QueryRowContext(ctx,
+		`SELECT attempts, last_error FROM embedding_queue WHERE log_id = $1;`, logID).Scan(&st.Attempts, &lastErr)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return st, nil
+	case err != nil:
+		return st, err
+	}
+	st.Queued = true
+	st.LastError = lastErr.String
+	return st, nil
+}
+
+// EnqueueAllLogs queues every memory log for embedding and makes entries
+// already queued due immediately with a fresh attempt count. It returns the
+// number of logs queued.
+func (d *Database) EnqueueAllLogs(ctx context.Context) (int64, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	n, err := enqueueAllLogs(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+func enqueueAllLogs(ctx context.Context, tx *sql.Tx) (int64, error) {
+	if err := execAll(ctx, tx,
+		`UPDATE embedding_queue SET attempts = 0, last_error = NULL, next_attempt_at = 0;`,
+		`INSERT INTO embedding_queue(log_id) SELECT id FROM memory_logs ON CONFLICT DO NOTHING;`,
+	); err != nil {
+		return 0, err
+	}
+	var n int64
+	err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM embedding_queue;`).Scan(&n)
+	return n, err
+}
+
+// PendingEmbeddingCount returns the number of logs waiting for an embedding.
+func (d *Database) PendingEmbeddingCount(ctx context.Context) (int64, error) {
+	var n int64
+	if err := d.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM embedding_queue;`).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// SaveEmbedding stores the embedding of a log computed by model, replacing
+// the one stored before, as a little-endian float32 blob
+// (vector.EncodeFloat32) like the sqlite package's.
+func (d *Database) SaveEmbedding(ctx context.Context, logID, model string, embedding []float64) error {
+	blob, err := vector.EncodeFloat32(embedding)
+	if err != nil {
+		return err
+	}
+	_, err = d.db.ExecContext(ctx, `
+        INSERT INTO embeddings(log_id, model, dim, vector) VALUES ($1, $2, $3, $4)
+        ON CONFLICT (log_id) DO UPDATE SET model = excluded.model, dim = excluded.dim, vector = excluded.vector;
+    `, logID, model, len(embedding), blob)
+	return err
+}
+
+// StoredEmbedding returns the stored embedding of a log if model computed
+// it, and nil otherwise.
+func (d *Database) StoredEmbedding(ctx context.Context, logID, model string) ([]float64, error) {
+	var blob []byte
+	err := d.db.QueryRowContext(ctx, `
+        SELECT vector FROM embeddings WHERE log_id = $1 AND model = $2;
+    `, logID, model).Scan(&blob)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return vector.DecodeFloat32(blob)
+}
+
+// RecentEmbeddings returns the stored embeddings computed by model of the
+// newest limit logs of namespace with the given source type, newest first.
+func (d *Database) RecentEmbeddings(ctx context.Context, namespace, source, model string, limit int) ([]sqlite.StoredVector, error) {
+	rows, err := d.db.QueryContext(ctx, `
+        SELECT e.log_id, e.vector
+        FROM embeddings e
+        JOIN memory_logs l ON l.id = e.log_id
+        WHERE l.namespace = $1 AND l.source_type = $2 AND e.model = $3
+        ORDER BY l.timestamp DESC, l.seq DESC
+        LIMIT $4;
+    `, namespaceOrDefault(namespace), source, model, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []sqlite.StoredVector
+	for rows.Next() {
+		var v sqlite.StoredVector
+		var blob []byte
+		if err := rows.Scan(&v.LogID, &blob); err != nil {
+			return nil, err
+		}
+		if v.Embedding, err = vector.DecodeFloat32(blob); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,264 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+)
+
+// pruneBatch bounds the number of logs one statement deletes or marks.
+const pruneBatch = 500
+
+// PrunableLogs returns ids of logs eligible for retention pruning: logs older
+// than olderThan (if non-zero) and logs beyond the newest keep (if keep > 0).
+// Logs cited as provenance by a fact and ids in exclude are never returned.
+func (d *Database) PrunableLogs(ctx context.Context, olderThan time.Time, keep int, exclude []string) ([]string, error) {
+	if olderThan.IsZero() && keep <= 0 {
+		return nil, nil
+	}
+	var cutoff sql.NullTime
+	if !olderThan.IsZero() {
+		cutoff = sql.NullTime{Time: seconds(olderThan), Valid: true}
+	}
+	rows, err := d.db.QueryContext(ctx, `
+        SELECT id FROM memory_logs m
+        WHERE NOT EXISTS (SELECT 1 FROM triple_sources s WHERE s.log_id = m.id)
+          AND (m.timestamp < $1::timestamp
+            OR ($2::integer > 0 AND m.id NOT IN (
+                SELECT id FROM memory_logs ORDER BY timestamp DESC, seq DESC LIMIT $2)))
+        ORDER BY m.timestamp;
+    `, cutoff, keep)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	skip := make(map[string]struct{}, len(exclude))
+	for _, id := range exclude {
+		skip[id] = struct{}{}
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		if _, ok := skip[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, rows.Err()
+}
+
+// DeleteLogs removes logs and their pending embedding queue entries, returning
+// how many logs were deleted. Their embeddings, vectors, provenance links and
+// staged overflow go with them through foreign keys.
+func (d *Database) DeleteLogs(ctx context.Context, ids []string) (int64, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var deleted int64
+	for start := 0; start < len(ids); start += pruneBatch {
+		batch := ids[start:min(start+pruneBatch, len(ids))]
+		if _, err := tx.ExecContext(ctx, `DELETE FROM embedding_queue WHERE log_id = ANY($1)`, batch); err != nil {
+			return 0, err
+		}
+		res, err := tx.ExecContext(ctx, `DELETE FROM memory_logs WHERE id = ANY($1)`, batch)
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		deleted += n
+	}
+	return deleted, tx.Commit()
+}
+
+// DeleteLogsWhere deletes the logs p selects in batches of 500, each in its
+// own transaction, calling before with the ids of every batch ahead of its
+// deletion, as sqlite.Database.DeleteLogsWhere does.
+func (d *Database) DeleteLogsWhere(ctx context.Context, p sqlite.DeleteParams, before func(ids []string) error) (int64, error) {
+	a := args{}
+	cond := ` WHERE namespace = ` + a.add(namespaceOrDefault(p.Namespace))
+	if p.Source != "" {
+		cond += ` AND source_type = ` + a.add(p.Source)
+	}
+	if !p.Before.IsZero() {
+		cond += ` AND timestamp < ` + a.add(seconds(p.Before))
+	}
+	if !p.After.IsZero() {
+		cond += ` AND timestamp > ` + a.add(seconds(p.After))
+	}
+	query := `SELECT id FROM memory_logs` + cond + ` ORDER BY seq LIMIT ` + a.add(pruneBatch) + `;`
+
+	var deleted int64
+	for {
+		rows, err := d.db.QueryContext(ctx, query, a...)
+		if err != nil {
+			return deleted, err
+		}
+		var ids []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return deleted, err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return deleted, err
+		}
+		if len(ids) == 0 {
+			return deleted, nil
+		}
+		if before != nil {
+			if err := before(ids); err != nil {
+				return deleted, err
+			}
+		}
+		n, err := d.DeleteLogs(ctx, ids)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+		if len(ids) < pruneBatch {
+			return deleted, nil
+		}
+	}
+}
+
+// UncitedLogs returns the ids among ids that no fact cites as provenance.
+func (d *Database) UncitedLogs(ctx context.Context, ids []string) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	rows, err := d.db.QueryContext(ctx, `
+        SELECT id FROM memory_logs m
+        WHERE id = ANY($1)
+          AND NOT EXISTS (SELECT 1 FROM triple_sources s WHERE s.log_id = m.id);
+    `, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
+
+// SummaryCandidates returns up to limit logs older than olderThan that
+// neither are summaries nor have been summarized, oldest first.
+func (d *Database) SummaryCandidates(ctx context.Context, olderThan time.Time, limit int) ([]model.LogEntry, error) {
+	rows, err := d.db.QueryContext(ctx, `
+        SELECT `+logColumns+`
+        FROM memory_logs l
+        WHERE l.timestamp < $1 AND l.summarized_into IS NULL AND l.source_type <> $2
+        ORDER BY l.timestamp, l.seq
+        LIMIT $3;
+    `, seconds(olderThan), model.SummarySource, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanLogs(rows)
+}
+
+// InsertSummary stores summary as a log dated at and marks the originals as
+// summarized into it, enqueueing the summary for embedding when enqueue is
+// set, all in one transaction. It returns the id of the summary.
+func (d *Database) InsertSummary(ctx context.Context, summary model.SensoryInput, at time.Time, originals []string, enqueue bool) (string, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	id := uuid.NewString()
+	metaBytes, _ := json.Marshal(summary.Metadata)
+	if _, err := tx.ExecContext(ctx, `
+        INSERT INTO memory_logs(id, timestamp, source_type, content, metadata, namespace, session_id, content_hash)
+        VALUES($1, $2, $3, $4, $5, $6, $7, $8);
+    `, id, seconds(at), summary.Source, summary.Content, string(metaBytes),
+		namespaceOrDefault(summary.Namespace), sessionOrNull(summary.SessionID), sqlite.ContentHash(summary.Content)); err != nil {
+		return "", err
+	}
+	if enqueue {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO embedding_queue(log_id) VALUES ($1)`, id); err != nil {
+			return "", err
+		}
+	}
+	for start := 0; start < len(originals); start += pruneBatch {
+		batch := originals[start:min(start+pruneBatch, len(originals))]
+		if _, err := tx.ExecContext(ctx, `UPDATE memory_logs SET summarized_into = $1 WHERE id = ANY($2)`, id, batch); err != nil {
+			return "", err
+		}
+	}
+	return id, tx.Commit()
+}
+
+// RecordAccess adds the batch counts to the access_count of logs and
+// triples, sets their last_accessed_at and reinforces the triples, in one
+// transaction. IDs that no longer exist are ignored. Rows are updated in id
+// order, so that concurrent batches lock them in the same order.
+func (d *Database) RecordAccess(ctx context.Context, b sqlite.AccessBatch) error {
+	if len(b.Logs) == 0 && len(b.Triples) == 0 {
+		return nil
+	}
+	ts := seconds(b.At)
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	logIDs := make([]string, 0, len(b.Logs))
+	for id := range b.Logs {
+		logIDs = append(logIDs, id)
+	}
+	sort.Strings(logIDs)
+	for _, id := range logIDs {
+		if _, err := tx.ExecContext(ctx, `
+            UPDATE memory_logs SET access_count = access_count + $1, last_accessed_at = $2 WHERE id = $3;
+        `, b.Logs[id], ts, id); err != nil {
+			return err
+		}
+	}
+
+	tripleIDs := make([]int64, 0, len(b.Triples))
+	for id := range b.Triples {
+		tripleIDs = append(tripleIDs, id)
+	}
+	sort.Slice(tripleIDs, func(i, j int) bool { return tripleIDs[i] < tripleIDs[j] })
+	for _, id := range tripleIDs {
+		if _, err := tx.ExecContext(ctx, `
+            UPDATE triples SET
+                access_count = access_count + $1::integer,
+                last_accessed_at = $2,
+                confidence = CASE WHEN confidence < $4::double precision
+                    THEN LEAST($4::double precision, confidence + $1::integer * $3::double precision)
+                    ELSE confidence END
+            WHERE id = $5;
+        `, b.Triples[id], ts, b.ReinforceStep, b.ReinforceCap, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,365 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+)
+
+// migration is one numbered schema step, as in the sqlite package. All
+// pending steps run in one transaction, DDL included.
+type migration struct {
+	version int
+	name    string
+	up      func(ctx context.Context, tx *sql.Tx) error
+}
+
+// migrations is the ordered schema history. Append new steps; never edit or
+// renumber a step that has shipped.
+var migrations = []migration{
+	{version: 1, name: "initial schema", up: migrateInitial},
+}
+
+// latestSchemaVersion is the schema version this binary understands.
+func latestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// migrationLock is the advisory lock that serializes the migrations of
+// engines opening the same database at once.
+const migrationLock = 0x7061696d // "paim"
+
+// ensureSchema runs pending migrations, then creates the vector table. The
+// latter lives outside the migration history because it depends on whether
+// vector search is enabled for this run.
+func (d *Database) ensureSchema(ctx context.Context) error {
+	if err := d.migrate(ctx); err != nil {
+		return err
+	}
+	if !d.enableVSS {
+		return nil
+	}
+	return d.ensureVectorTable(ctx, d.migrateDim)
+}
+
+// migrate applies pending migrations and records the resulting version. It
+// refuses to touch a database written by a newer binary.
+func (d *Database) migrate(ctx context.Context) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := execAll(ctx, tx,
+		`SELECT pg_advisory_xact_lock(`+strconv.Itoa(migrationLock)+`);`,
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+            version integer PRIMARY KEY,
+            name text NOT NULL,
+            applied_at timestamp NOT NULL DEFAULT (now() AT TIME ZONE 'UTC')
+        );`,
+	); err != nil {
+		return err
+	}
+	var current int
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations;`).Scan(&current); err != nil {
+		return err
+	}
+	if latest := latestSchemaVersion(); current > latest {
+		return fmt.Errorf("database schema version %d is newer than supported version %d; upgrade paim", current, latest)
+	}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := m.up(ctx, tx); err != nil {
+			return fmt.Errorf("migration %03d (%s): %w", m.version, m.name, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations(version, name) VALUES ($1, $2);`, m.version, m.name); err != nil {
+			return err
+		}
+		d.logger.Info("applied schema migration", "version", m.version, "name", m.name)
+		current = m.version
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	d.schemaVersion = current
+	return nil
+}
+
+// checkSchema is ensureSchema for a read-only database: it changes nothing
+// and fails unless the schema and the vector table are already what this
+// binary would have made them.
+func (d *Database) checkSchema(ctx context.Context) error {
+	var current int
+	if err := d.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations;`).Scan(&current); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	if latest := latestSchemaVersion(); current != latest {
+		return fmt.Errorf("database schema version %d does not match supported version %d; open it read-write once to migrate", current, latest)
+	}
+	d.schemaVersion = current
+	if !d.enableVSS {
+		return nil
+	}
+	stored, err := d.storedVectorDim(ctx)
+	if err != nil {
+		return fmt.Errorf("read vector dimension: %w", err)
+	}
+	if stored == 0 {
+		return fmt.Errorf("no %s table; open the database read-write once with vector search enabled", vectorTable)
+	}
+	if stored != d.vectorDim {
+		return fmt.Errorf("%w: %s holds %d-dimensional vectors but %d is configured",
+			sqlite.ErrVectorDimMismatch, vectorTable, stored, d.vectorDim)
+	}
+	return nil
+}
+
+func execAll(ctx context.Context, tx *sql.Tx, stmts ...string) error {
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// utcNow is the default of the columns SQLite fills with CURRENT_TIMESTAMP:
+// the current time in UTC, in whole seconds.
+const utcNow = `date_trunc('second', now() AT TIME ZONE 'UTC')`
+
+// migrateInitial creates the schema the sqlite package reached in its
+// fifteen migrations. Times are timestamps without time zone holding UTC.
+// memory_logs.seq and consolidation_overflow.seq stand in for SQLite's rowid,
+// which breaks ties between equal timestamps in insertion order.
+func migrateInitial(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`CREATE TABLE memory_logs (
+            id text PRIMARY KEY,
+            seq bigint GENERATED ALWAYS AS IDENTITY UNIQUE,
+            timestamp timestamp NOT NULL DEFAULT `+utcNow+`,
+            source_type text,
+            content text,
+            metadata jsonb,
+            namespace text NOT NULL DEFAULT 'default',
+            session_id text,
+            last_accessed_at timestamp,
+            access_count integer NOT NULL DEFAULT 0,
+            summarized_into text,
+            updated_at timestamp,
+            content_hash text
+        );`,
+		`CREATE INDEX idx_memory_logs_namespace ON memory_logs(namespace, timestamp);`,
+		`CREATE INDEX idx_memory_logs_timestamp ON memory_logs(timestamp, seq);`,
+		`CREATE INDEX idx_memory_logs_session ON memory_logs(session_id, timestamp) WHERE session_id IS NOT NULL;`,
+		`CREATE INDEX idx_memory_logs_content_hash ON memory_logs(content_hash, namespace, source_type);`,
+		`CREATE TABLE triples (
+            id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+            namespace text NOT NULL DEFAULT 'default',
+            subject text NOT NULL,
+            predicate text NOT NULL,
+            object text NOT NULL,
+            confidence double precision NOT NULL DEFAULT 1.0,
+            created_at timestamp NOT NULL DEFAULT `+utcNow+`,
+            observation_count integer NOT NULL DEFAULT 1,
+            subject_label text NOT NULL,
+            object_label text NOT NULL,
+            last_accessed_at timestamp,
+            access_count integer NOT NULL DEFAULT 0,
+            superseded_by bigint,
+            valid_from timestamp,
+            valid_to timestamp,
+            UNIQUE (namespace, subject, predicate, object)
+        );`,
+		`CREATE INDEX idx_triples_subject ON triples(namespace, subject);`,
+		`CREATE INDEX idx_triples_object ON triples(namespace, object);`,
+		`CREATE INDEX idx_triples_superseded_by ON triples(superseded_by) WHERE superseded_by IS NOT NULL;`,
+		`CREATE TABLE triple_sources (
+            triple_id bigint NOT NULL REFERENCES triples(id) ON DELETE CASCADE,
+            log_id text NOT NULL REFERENCES memory_logs(id) ON DELETE CASCADE,
+            PRIMARY KEY (triple_id, log_id)
+        );`,
+		`CREATE INDEX idx_triple_sources_log ON triple_sources(log_id);`,
+		`CREATE TABLE entity_aliases (
+            namespace text NOT NULL DEFAULT 'default',
+            alias text NOT NULL,
+            canonical text NOT NULL,
+            PRIMARY KEY (namespace, alias)
+        );`,
+		`CREATE TABLE embedding_queue (
+            log_id text PRIMARY KEY,
+            attempts integer NOT NULL DEFAULT 0,
+            last_error text,
+            next_attempt_at bigint NOT NULL DEFAULT 0,
+            enqueued_at timestamp NOT NULL DEFAULT `+utcNow+`
+        );`,
+		`CREATE INDEX idx_embedding_queue_due ON embedding_queue(next_attempt_at);`,
+		`CREATE TABLE meta (
+            key text PRIMARY KEY,
+            value text NOT NULL
+        );`,
+		`CREATE TABLE embeddings (
+            log_id text PRIMARY KEY REFERENCES memory_logs(id) ON DELETE CASCADE,
+            model text NOT NULL,
+            dim integer NOT NULL,
+            vector bytea NOT NULL
+        );`,
+		`CREATE TABLE consolidation_overflow (
+            log_id text PRIMARY KEY REFERENCES memory_logs(id) ON DELETE CASCADE,
+            seq bigint GENERATED ALWAYS AS IDENTITY,
+            staged_at timestamp NOT NULL DEFAULT `+utcNow+`
+        );`,
+		`CREATE TABLE consolidation_runs (
+            id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+            started_at timestamp NOT NULL,
+            finished_at timestamp NOT NULL,
+            inputs integer NOT NULL DEFAULT 0,
+            triples_written integer NOT NULL DEFAULT 0,
+            error text
+        );`,
+		// the sqlite package's triples_superseded_on_delete, once per
+		// statement: a deleted triple hands the triples it superseded to its
+		// successor, or makes them current again, with an open end and the
+		// supersession cut undone, when it had none. A statement deleting a
+		// chain of triples moves them along it until they reach a triple
+		// that is left.
+		`CREATE FUNCTION triples_superseded_on_delete() RETURNS trigger LANGUAGE plpgsql AS $$
+        BEGIN
+            LOOP
+                UPDATE triples t SET
+                    superseded_by = g.superseded_by,
+                    valid_to = CASE WHEN g.superseded_by IS NULL THEN NULL ELSE g.valid_to END,
+                    confidence = CASE WHEN g.superseded_by IS NULL THEN LEAST(1.0, t.confidence / 0.1) ELSE t.confidence END
+                FROM gone g
+                WHERE t.superseded_by = g.id;
+                EXIT WHEN NOT FOUND;
+            END LOOP;
+            RETURN NULL;
+        END;
+        $$;`,
+		`CREATE TRIGGER triples_superseded_on_delete AFTER DELETE ON triples
+            REFERENCING OLD TABLE AS gone
+            FOR EACH STATEMENT EXECUTE FUNCTION triples_superseded_on_delete();`,
+	)
+}
+
+// Keys in the meta table, as in the sqlite package.
+const (
+	metaVectorDim     = "vector_dim:" + vectorName
+	metaEmbedderModel = "embedder_model"
+)
+
+// Meta returns the value stored under key, or "" when it is unset.
+func (d *Database) Meta(ctx context.Context, key string) (string, error) {
+	var v string
+	err := d.db.QueryRowContext(ctx, `SELECT value FROM meta WHERE key = $1;`, key).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return v, err
+}
+
+// SetMeta stores value under key.
+func (d *Database) SetMeta(ctx context.Context, key, value string) error {
+	return setMeta(ctx, d.db, key, value)
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func setMeta(ctx context.Context, ex execer, key, value string) error {
+	_, err := ex.ExecContext(ctx, `
+        INSERT INTO meta(key, value) VALUES ($1, $2)
+        ON CONFLICT (key) DO UPDATE SET value = excluded.value;
+    `, key, value)
+	return err
+}
+
+// EmbedderModel returns the embedding model the stored vectors were built
+// with, or "" when none was recorded.
+func (d *Database) EmbedderModel(ctx context.Context) (string, error) {
+	return d.Meta(ctx, metaEmbedderModel)
+}
+
+// SetEmbedderModel records the embedding model the stored vectors are built
+// with.
+func (d *Database) SetEmbedderModel(ctx context.Context, name string) error {
+	return d.SetMeta(ctx, metaEmbedderModel, name)
+}
+
+// storedVectorDim returns the dimension the vector table was created with,
+// or 0 when there is none.
+func (d *Database) storedVectorDim(ctx context.Context) (int, error) {
+	v, err := d.Meta(ctx, metaVectorDim)
+	if err != nil || v == "" {
+		return 0, err
+	}
+	return strconv.Atoi(v)
+}
+
+// ensureVectorTable creates the pgvector extension and the vector table, or
+// checks that the existing table matches the configured dimension. On a
+// mismatch it fails with sqlite.ErrVectorDimMismatch unless migrate is set,
+// in which case the table is recreated empty and every log is queued for
+// embedding.
+func (d *Database) ensureVectorTable(ctx context.Context, migrate bool) error {
+	stored, err := d.storedVectorDim(ctx)
+	if err != nil {
+		return fmt.Errorf("read vector dimension: %w", err)
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `CREATE EXTENSION IF NOT EXISTS vector;`); err != nil {
+		return fmt.Errorf("%w: create the pgvector extension: %v", sqlite.ErrVectorUnavailable, err)
+	}
+	if stored != 0 && stored != d.vectorDim {
+		if !migrate {
+			return fmt.Errorf("%w: %s holds %d-dimensional vectors but %d is configured",
+				sqlite.ErrVectorDimMismatch, vectorTable, stored, d.vectorDim)
+		}
+		if _, err := tx.ExecContext(ctx, `DROP TABLE IF EXISTS `+vectorTable+`;`); err != nil {
+			return fmt.Errorf("drop vector table: %w", err)
+		}
+		queued, err := enqueueAllLogs(ctx, tx)
+		if err != nil {
+			return err
+		}
+		d.logger.Warn("recreating vector table for new dimension; logs queued for re-embedding",
+			"from", stored, "to", d.vectorDim, "queued", queued)
+	}
+	if _, err := tx.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS `+vectorTable+` (
+            log_id text PRIMARY KEY REFERENCES memory_logs(id) ON DELETE CASCADE,
+            embedding vector(`+strconv.Itoa(d.vectorDim)+`) NOT NULL
+        );`); err != nil {
+		return fmt.Errorf("%w: create %s: %v", sqlite.ErrVectorUnavailable, vectorTable, err)
+	}
+	if err := setMeta(ctx, tx, metaVectorDim, strconv.Itoa(d.vectorDim)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// HNSW indexes hold at most 2000 dimensions; without one, searches scan
+	// the table, exactly but slowly
+	if _, err := d.db.ExecContext(ctx, `
+        CREATE INDEX IF NOT EXISTS idx_log_vectors_embedding ON `+vectorTable+`
+        USING hnsw (embedding vector_cosine_ops);`); err != nil {
+		d.logger.Warn("no approximate index on the vector table; searches scan it", "err", err)
+	}
+	return nil
+}
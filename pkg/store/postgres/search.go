@@ -0,0 +1,229 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store/graph"
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+)
+
+// slowSearch is the duration above which fact searches are logged as slow.
+const slowSearch = 250 * time.Millisecond
+
+// recentFactsWindow is how many recent facts per requested result
+// RecentFacts considers before picking by confidence.
+const recentFactsWindow = 4
+
+// SearchFactsFiltered is graph.Store.SearchFactsFiltered: a search of the
+// subjects and objects of the facts matching f, most confident first. LIKE
+// matching is case-insensitive as in SQLite, with ILIKE.
+func (g *Graph) SearchFactsFiltered(ctx context.Context, term string, limit int, f graph.FactFilter) ([]model.Triple, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	mode := f.Match
+	if mode == "" {
+		mode = graph.MatchContains
+	}
+	term = strings.Join(strings.Fields(term), " ")
+	if mode.Tokenized() {
+		words := graph.Tokenize(term)
+		if len(words) > 1 {
+			return g.searchWords(ctx, words, mode, limit, f)
+		}
+		if len(words) == 1 {
+			term = words[0]
+		}
+	}
+	term, err := g.resolve(ctx, g.db, f.Namespace, term)
+	if err != nil {
+		return nil, err
+	}
+	a := args{}
+	match := matchCondition(mode, "subject", term, &a) + ` OR ` + matchCondition(mode, "object", term, &a)
+	cond := factWhere(f, &a)
+	return g.searchQuery(ctx, `
+        SELECT `+tripleColumns+`
+        FROM triples
+        WHERE (`+match+`)`+cond+`
+        ORDER BY confidence DESC, created_at DESC, id DESC
+        LIMIT `+a.add(limit)+`;
+    `, a, limit)
+}
+
+// searchWords is SearchFactsFiltered for the words of a MatchAny or
+// MatchAll term. Each fact scores the number of words its subject or
+// object contains; MatchAll keeps only facts scoring every word.
+func (g *Graph) searchWords(ctx context.Context, words []string, mode graph.MatchMode, limit int, f graph.FactFilter) ([]model.Triple, error) {
+	a := args{}
+	scores := make([]string, 0, len(words))
+	for _, w := range words {
+		w, err := g.resolve(ctx, g.db, f.Namespace, w)
+		if err != nil {
+			return nil, err
+		}
+		scores = append(scores, "("+matchCondition(graph.MatchContains, "subject", w, &a)+
+			" OR "+matchCondition(graph.MatchContains, "object", w, &a)+")::integer")
+	}
+	minScore := 1
+	if mode == graph.MatchAll {
+		minScore = len(words)
+	}
+	cond := factWhere(f, &a)
+	return g.searchQuery(ctx, `
+        SELECT `+tripleColumns+`
+        FROM (
+            SELECT *, `+strings.Join(scores, " + ")+` AS score
+            FROM triples
+            WHERE true`+cond+`
+        ) AS triples
+        WHERE score >= `+a.add(minScore)+`
+        ORDER BY score DESC, confidence DESC, created_at DESC, id DESC
+        LIMIT `+a.add(limit)+`;
+    `, a, limit)
+}
+
+// searchQuery runs a fact search and logs its timing.
+func (g *Graph) searchQuery(ctx context.Context, query string, a args, limit int) ([]model.Triple, error) {
+	start := time.Now()
+	rows, err := g.db.QueryContext(ctx, query, a...)
+	if err != nil {
+		g.logger.Error("fact search failed", "limit", limit, "err", err)
+		return nil, err
+	}
+	facts, err := scanTriples(rows)
+	if d := time.Since(start); d >= slowSearch {
+		g.logger.Warn("slow fact search", "limit", limit, "facts", len(facts), "ms", d.Milliseconds())
+	} else {
+		g.logger.Debug("fact search", "limit", limit, "facts", len(facts), "ms", d.Milliseconds())
+	}
+	return facts, err
+}
+
+// RecentFacts returns the highest-confidence facts among the most recently
+// created ones matching f, for recall without a query term.
+func (g *Graph) RecentFacts(ctx context.Context, limit int, f graph.FactFilter) ([]model.Triple, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	a := args{}
+	cond := factWhere(f, &a)
+	rows, err := g.db.QueryContext(ctx, `
+        SELECT * FROM (
+            SELECT `+tripleColumns+`
+            FROM triples
+            WHERE true`+cond+`
+            ORDER BY created_at DESC, id DESC
+            LIMIT `+a.add(recentFactsWindow*limit)+`
+        ) AS recent
+        ORDER BY confidence DESC, created_at DESC
+        LIMIT `+a.add(limit)+`;
+    `, a...)
+	if err != nil {
+		return nil, err
+	}
+	return scanTriples(rows)
+}
+
+// NeighborsOf returns triples matching f that touch any of entities, most
+// confident first, at most limit. Entities are used as stored, without alias
+// resolution, since callers take them from existing triples.
+func (g *Graph) NeighborsOf(ctx context.Context, entities []string, limit int, f graph.FactFilter) ([]model.Triple, error) {
+	if len(entities) == 0 || limit <= 0 {
+		return nil, nil
+	}
+	return g.touching(ctx, entities, limit, f)
+}
+
+// touching selects the triples matching f with any of entities as subject
+// or object, most confident first, at most limit.
+func (g *Graph) touching(ctx context.Context, entities []string, limit int, f graph.FactFilter) ([]model.Triple, error) {
+	a := args{}
+	in := a.add(entities)
+	cond := factWhere(f, &a)
+	rows, err := g.db.QueryContext(ctx, `
+        SELECT `+tripleColumns+`
+        FROM triples
+        WHERE (subject = ANY(`+in+`) OR object = ANY(`+in+`))`+cond+`
+        ORDER BY confidence DESC, created_at DESC
+        LIMIT `+a.add(limit)+`;
+    `, a...)
+	if err != nil {
+		return nil, err
+	}
+	return scanTriples(rows)
+}
+
+// factWhere is graph.FactFilter's conditions over the triples table, each
+// prefixed with " AND ", whose arguments it adds to a.
+func factWhere(f graph.FactFilter, a *args) string {
+	cond := namespaceCond(f.Namespace, a)
+	if lf := (sqlite.LogFilter{Source: f.Source, Metadata: f.Metadata}); !lf.IsZero() {
+		cond += `
+          AND EXISTS (
+            SELECT 1 FROM triple_sources ts JOIN memory_logs l ON l.id = ts.log_id
+            WHERE ts.triple_id = triples.id` + where(lf, "l", a) + `)`
+	}
+	if !f.From.IsZero() {
+		cond += " AND triples.created_at >= " + a.add(seconds(f.From))
+	}
+	if !f.To.IsZero() {
+		cond += " AND triples.created_at <= " + a.add(seconds(f.To))
+	}
+	if f.MinConfidence > 0 {
+		cond += " AND triples.confidence >= " + a.add(f.MinConfidence)
+	}
+	if f.Predicate != "" {
+		cond += " AND triples.predicate = " + a.add(f.Predicate)
+	}
+	switch {
+	case !f.AsOf.IsZero():
+		cond += validAt(f.AsOf, a)
+	case !f.IncludeSuperseded:
+		cond += " AND triples.superseded_by IS NULL"
+	}
+	return cond
+}
+
+// validAt returns a condition, prefixed with " AND ", keeping triples valid
+// at instant at: valid_from at or before it and valid_to after it, a NULL
+// bound being open.
+func validAt(at time.Time, a *args) string {
+	v := a.add(seconds(at))
+	return ` AND (triples.valid_from IS NULL OR triples.valid_from <= ` + v + `)` +
+		` AND (triples.valid_to IS NULL OR triples.valid_to > ` + v + `)`
+}
+
+// matchCondition is graph.MatchMode's condition on column for term, with
+// ILIKE standing in for SQLite's case-insensitive LIKE.
+func matchCondition(m graph.MatchMode, column, term string, a *args) string {
+	switch m {
+	case graph.MatchPrefix:
+		return column + ` ILIKE ` + a.add(graph.EscapeLike(term)+"%") + ` ESCAPE '\'`
+	case graph.MatchContains, graph.MatchPhrase, graph.MatchAny, graph.MatchAll:
+		return column + ` ILIKE ` + a.add("%"+graph.EscapeLike(term)+"%") + ` ESCAPE '\'`
+	default:
+		return column + ` = ` + a.add(term)
+	}
+}
+
+// termsCondition matches column against the words of a tokenized mode:
+// any of them for MatchAny, all of them for MatchAll. Other modes match the
+// single term terms[0].
+func termsCondition(m graph.MatchMode, column string, terms []string, a *args) string {
+	if !m.Tokenized() || len(terms) == 1 {
+		return matchCondition(m, column, terms[0], a)
+	}
+	join := " OR "
+	if m == graph.MatchAll {
+		join = " AND "
+	}
+	conds := make([]string, len(terms))
+	for i, t := range terms {
+		conds[i] = matchCondition(m, column, t, a)
+	}
+	return "(" + strings.Join(conds, join) + ")"
+}
@@ -0,0 +1,233 @@
+package postgres
+
+import (
+	"context"
+	"io"
+	"strconv"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store/graph"
+)
+
+// Neighbors is graph.Store.Neighbors: the triples matching f within depth
+// hops of entity, at most limit, and the entity's degree in f.Namespace.
+func (g *Graph) Neighbors(ctx context.Context, entity string, depth, limit int, f graph.FactFilter) (graph.Neighbors, error) {
+	entity, err := g.resolve(ctx, g.db, f.Namespace, entity)
+	if err != nil {
+		return graph.Neighbors{}, err
+	}
+	n := graph.NewNeighbors(entity, depth)
+	a := args{entity}
+	cond := namespaceCond(f.Namespace, &a)
+	if err := g.db.QueryRowContext(ctx, `
+        SELECT COUNT(*) FILTER (WHERE subject = $1), COUNT(*) FILTER (WHERE object = $1), COUNT(*)
+        FROM triples
+        WHERE (subject = $1 OR object = $1) AND superseded_by IS NULL`+cond+`;
+    `, a...).Scan(&n.Degree.Out, &n.Degree.In, &n.Degree.Total); err != nil {
+		return graph.Neighbors{}, err
+	}
+	if n.Degree.Total == 0 {
+		return n, nil
+	}
+	facts, err := g.neighborhood(ctx, entity, n.Depth, limit, f)
+	if err != nil {
+		return graph.Neighbors{}, err
+	}
+	n.SetFacts(facts)
+	return n, nil
+}
+
+// Neighborhood returns the current triples reachable from entity within depth
+// hops, treating edges as undirected and staying inside namespace (all
+// namespaces when empty), as graph.Store.Neighborhood does.
+func (g *Graph) Neighborhood(ctx context.Context, namespace, entity string, depth, limit int) ([]model.Triple, error) {
+	entity, err := g.resolve(ctx, g.db, namespace, entity)
+	if err != nil {
+		return nil, err
+	}
+	return g.neighborhood(ctx, entity, depth, limit, graph.FactFilter{Namespace: namespace})
+}
+
+// neighborhood is Neighborhood over the triples matching f, from an entity
+// already resolved.
+func (g *Graph) neighborhood(ctx context.Context, entity string, depth, limit int, f graph.FactFilter) ([]model.Triple, error) {
+	return graph.Traverse(ctx, entity, depth, limit, func(ctx context.Context, frontier []string, limit int) ([]model.Triple, error) {
+		return g.touching(ctx, frontier, limit, f)
+	})
+}
+
+// FindPath returns the shortest chain of current triples linking two
+// entities in namespace, as graph.Store.FindPath does; graph.ErrNoPath when
+// there is none.
+func (g *Graph) FindPath(ctx context.Context, namespace, from, to string, maxDepth int) ([]model.Triple, error) {
+	from, err := g.resolve(ctx, g.db, namespace, from)
+	if err != nil {
+		return nil, err
+	}
+	to, err = g.resolve(ctx, g.db, namespace, to)
+	if err != nil {
+		return nil, err
+	}
+	return graph.ShortestPath(ctx, from, to, maxDepth, func(ctx context.Context, entities []string) ([]model.Triple, error) {
+		return g.edgesOf(ctx, namespace, entities)
+	})
+}
+
+func (g *Graph) edgesOf(ctx context.Context, namespace string, entities []string) ([]model.Triple, error) {
+	a := args{entities}
+	rows, err := g.db.QueryContext(ctx, `
+        SELECT `+tripleColumns+`
+        FROM triples
+        WHERE (subject = ANY($1) OR object = ANY($1)) AND superseded_by IS NULL`+namespaceCond(namespace, &a)+`
+        ORDER BY confidence DESC, id;
+    `, a...)
+	if err != nil {
+		return nil, err
+	}
+	return scanTriples(rows)
+}
+
+// QueryPattern answers a conjunctive query over current triples, as
+// graph.Store.QueryPattern does.
+func (g *Graph) QueryPattern(ctx context.Context, namespace string, patterns []graph.TriplePattern, limit int) ([]graph.PatternMatch, error) {
+	resolve := func(entity string) (string, error) {
+		return g.resolve(ctx, g.db, namespace, entity)
+	}
+	q, err := graph.CompilePattern(namespace, patterns, limit, resolve, func(n int) string { return "$" + strconv.Itoa(n) })
+	if err != nil {
+		return nil, err
+	}
+	rows, err := g.db.QueryContext(ctx, q.SQL, q.Args...)
+	if err != nil {
+		return nil, err
+	}
+	solutions, err := q.Scan(rows)
+	if err != nil {
+		return nil, err
+	}
+	triples, err := g.triplesByID(ctx, solutions)
+	if err != nil {
+		return nil, err
+	}
+	return q.Matches(solutions, triples), nil
+}
+
+// triplesByID loads the distinct triples referenced by solutions.
+func (g *Graph) triplesByID(ctx context.Context, solutions [][]int64) (map[int64]model.Triple, error) {
+	seen := map[int64]bool{}
+	var ids []int64
+	for _, row := range solutions {
+		for _, id := range row {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	out := make(map[int64]model.Triple, len(ids))
+	if len(ids) == 0 {
+		return out, nil
+	}
+	rows, err := g.db.QueryContext(ctx, `SELECT `+tripleColumns+` FROM triples WHERE id = ANY($1);`, ids)
+	if err != nil {
+		return nil, err
+	}
+	triples, err := scanTriples(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range triples {
+		out[t.ID] = t
+	}
+	return out, nil
+}
+
+// ListEntities returns distinct subjects and objects of namespace (every
+// namespace when empty) starting with prefix, ordered by name, with their
+// edge counts over current triples and newest triple time, as
+// graph.Store.ListEntities does. Names sort bytewise, as in SQLite.
+func (g *Graph) ListEntities(ctx context.Context, namespace, prefix string, limit, offset int) ([]graph.EntityInfo, error) {
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	if g.normalize {
+		prefix = graph.NormalizeEntity(prefix)
+	}
+	a := args{prefix}
+	cond := namespaceCond(namespace, &a)
+	rows, err := g.db.QueryContext(ctx, `
+        SELECT entity, SUM(as_subject), SUM(as_object), MAX(created_at)
+        FROM (
+            SELECT subject AS entity, 1 AS as_subject, 0 AS as_object, created_at
+            FROM triples WHERE starts_with(subject, $1) AND superseded_by IS NULL`+cond+`
+            UNION ALL
+            SELECT object, 0, 1, created_at
+            FROM triples WHERE starts_with(object, $1) AND superseded_by IS NULL`+cond+`
+        ) AS entities
+        GROUP BY entity
+        ORDER BY entity COLLATE "C"
+        LIMIT `+a.add(limit)+` OFFSET `+a.add(offset)+`;
+    `, a...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []graph.EntityInfo
+	for rows.Next() {
+		var e graph.EntityInfo
+		if err := rows.Scan(&e.Entity, &e.AsSubject, &e.AsObject, &e.LastSeen); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// Export streams the graph of current triples as a document in format,
+// oldest triples first, as graph.Store.Export does.
+func (g *Graph) Export(ctx context.Context, w io.Writer, format graph.ExportFormat, opts graph.ExportOptions) error {
+	e, err := graph.NewExporter(w, format, opts.MaxNodes)
+	if err != nil {
+		return err
+	}
+
+	a := args{}
+	cond := namespaceCond(opts.Namespace, &a)
+	if opts.MinConfidence > 0 {
+		cond += " AND triples.confidence >= " + a.add(opts.MinConfidence)
+	}
+	if len(opts.Predicates) > 0 {
+		cond += " AND triples.predicate = ANY(" + a.add(opts.Predicates) + ")"
+	}
+	rows, err := g.db.QueryContext(ctx, `
+        SELECT `+tripleColumns+`
+        FROM triples
+        WHERE triples.superseded_by IS NULL`+cond+`
+        ORDER BY id;
+    `, a...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := scanTriple(rows)
+		if err != nil {
+			return err
+		}
+		if err := e.Add(*t); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return e.Close()
+}
@@ -0,0 +1,102 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+)
+
+// UpdateLog applies patch to a log in one transaction, as
+// sqlite.Database.UpdateLog does. It returns sql.ErrNoRows when the log
+// does not exist and sqlite.ErrLogModified when patch.UnmodifiedSince is
+// stale.
+func (d *Database) UpdateLog(ctx context.Context, id string, patch sqlite.LogPatch) error {
+	return d.updateLog(ctx, id, patch, false)
+}
+
+// UpdateLogPendingEmbedding is UpdateLog that also queues the log for
+// embedding, with a fresh attempt count, when its content changes.
+func (d *Database) UpdateLogPendingEmbedding(ctx context.Context, id string, patch sqlite.LogPatch) error {
+	return d.updateLog(ctx, id, patch, true)
+}
+
+func (d *Database) updateLog(ctx context.Context, id string, patch sqlite.LogPatch, enqueue bool) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var (
+		content, source string
+		meta            sql.NullString
+		ts              time.Time
+		updated         sql.NullTime
+	)
+	// the row lock keeps a concurrent update from slipping in between the
+	// check against UnmodifiedSince and the write
+	err = tx.QueryRowContext(ctx, `
+        SELECT content, COALESCE(source_type, ''), metadata, timestamp, updated_at FROM memory_logs WHERE id = $1 FOR UPDATE;
+    `, id).Scan(&content, &source, &meta, &ts, &updated)
+	if err != nil {
+		return err
+	}
+	if !patch.UnmodifiedSince.IsZero() {
+		last := ts
+		if updated.Valid {
+			last = updated.Time
+		}
+		if !last.Equal(patch.UnmodifiedSince) {
+			return sqlite.ErrLogModified
+		}
+	}
+
+	contentChanged := patch.Content != nil && *patch.Content != content
+	if patch.Content != nil {
+		content = *patch.Content
+	}
+	if patch.SourceType != nil {
+		source = *patch.SourceType
+	}
+	metadata := map[string]any{}
+	if meta.Valid && meta.String != "" {
+		_ = json.Unmarshal([]byte(meta.String), &metadata)
+	}
+	if patch.ReplaceMetadata {
+		metadata = patch.Metadata
+	} else if patch.Metadata != nil {
+		metadata = sqlite.MergeMetadata(metadata, patch.Metadata)
+	}
+	metaBytes, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	at := patch.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	// updated_at keeps microseconds, the precision of a timestamp column
+	if _, err := tx.ExecContext(ctx, `
+        UPDATE memory_logs SET content = $1, content_hash = $2, source_type = $3, metadata = $4, updated_at = $5 WHERE id = $6;
+    `, content, sqlite.ContentHash(content), source, string(metaBytes), at.UTC().Truncate(time.Microsecond), id); err != nil {
+		return err
+	}
+	if contentChanged {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM embeddings WHERE log_id = $1`, id); err != nil {
+			return err
+		}
+		if enqueue {
+			if _, err := tx.ExecContext(ctx, `
+                INSERT INTO embedding_queue(log_id) VALUES ($1)
+                ON CONFLICT (log_id) DO UPDATE SET attempts = 0, last_error = NULL, next_attempt_at = 0;
+            `, id); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
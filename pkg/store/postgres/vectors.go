@@ -0,0 +1,328 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/store/internal/logrow"
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+	"github.com/johncui/PAIM/pkg/store/vector"
+)
+
+const (
+	// vectorName identifies the index in stats and recall diagnostics.
+	vectorName = "pgvector"
+	// vectorTable holds one embedding per log; its rows go with their log
+	// through the foreign key, so no payload table is needed.
+	vectorTable = "log_vectors"
+)
+
+// slowQuery is the duration above which vector searches are logged as slow.
+const slowQuery = 250 * time.Millisecond
+
+// buildBatch is how many stored embeddings BuildIndexFromTable loads per
+// transaction.
+const buildBatch = 500
+
+// Vectors searches the logs of a Database by embedding with pgvector,
+// ordering by cosine distance.
+type Vectors struct {
+	db      *sql.DB
+	enabled bool
+	dim     int
+	model   string
+	logger  *slog.Logger
+}
+
+// NewVectors returns the vector index of db, a Database's pool, configured
+// as vector.NewWithConfig configures a vector.Store; cfg.Reader and
+// cfg.Backend are not used. cfg.Enabled must only be set when the Database
+// has vector search (Database.HasVSS).
+func NewVectors(db *sql.DB, cfg vector.Config) *Vectors {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	return &Vectors{db: db, enabled: cfg.Enabled, dim: cfg.Dim, model: cfg.Model, logger: cfg.Logger}
+}
+
+func (v *Vectors) Enabled() bool { return v.enabled }
+
+// Name returns "pgvector".
+func (v *Vectors) Name() string { return vectorName }
+
+// Similarity converts a cosine distance, which pgvector reports, into the
+// cosine similarity.
+func (v *Vectors) Similarity(distance float64) float64 { return 1 - distance }
+
+// UpsertEmbedding stores an embedding linked to a memory log id, replacing any
+// embedding previously stored for that log. Logs that no longer exist are
+// ignored.
+func (v *Vectors) UpsertEmbedding(ctx context.Context, logID string, embedding []float64) error {
+	if !v.enabled {
+		return nil
+	}
+	vec, err := v.encode(embedding)
+	if err != nil {
+		return err
+	}
+	_, err = v.db.ExecContext(ctx, `
+        INSERT INTO `+vectorTable+`(log_id, embedding)
+        SELECT id, $2::text::vector FROM memory_logs WHERE id = $1
+        ON CONFLICT (log_id) DO UPDATE SET embedding = excluded.embedding;
+    `, logID, vec)
+	return err
+}
+
+// BuildIndexFromTable indexes the embeddings kept in the embeddings table
+// for logs that have no vector yet, as vector.Store.BuildIndexFromTable
+// does. It returns how many were indexed.
+func (v *Vectors) BuildIndexFromTable(ctx context.Context) (int64, error) {
+	if !v.enabled {
+		return 0, nil
+	}
+	var total int64
+	for {
+		n, err := v.buildIndexBatch(ctx)
+		total += n
+		if err != nil || n < buildBatch {
+			return total, err
+		}
+	}
+}
+
+func (v *Vectors) buildIndexBatch(ctx context.Context) (int64, error) {
+	tx, err := v.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+        SELECT e.log_id, e.vector FROM `+vector.EmbeddingsTable+` e
+        WHERE e.dim = $1 AND ($2 = '' OR e.model = $2)
+          AND NOT EXISTS (SELECT 1 FROM `+vectorTable+` v WHERE v.log_id = e.log_id)
+        LIMIT $3;
+    `, v.dim, v.model, buildBatch)
+	if err != nil {
+		return 0, err
+	}
+	type stored struct {
+		logID string
+		blob  []byte
+	}
+	var batch []stored
+	for rows.Next() {
+		var e stored
+		if err := rows.Scan(&e.logID, &e.blob); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, e)
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+	for _, e := range batch {
+		embedding, err := vector.DecodeFloat32(e.blob)
+		if err != nil {
+			return 0, fmt.Errorf("stored embedding of log %s: %w", e.logID, err)
+		}
+		vec, err := encodeVector(embedding)
+		if err != nil {
+			return 0, fmt.Errorf("stored embedding of log %s: %w", e.logID, err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+            INSERT INTO `+vectorTable+`(log_id, embedding) VALUES ($1, $2::text::vector);
+        `, e.logID, vec); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(batch)), tx.Commit()
+}
+
+const searchSQL = `
+        SELECT v.log_id, m.namespace, v.embedding <=> $1::text::vector AS distance
+        FROM ` + vectorTable + ` v
+        JOIN memory_logs m ON m.id = v.log_id
+        ORDER BY distance
+        LIMIT $2`
+
+// SearchWithScores returns the nearest logs with their distances, nearest
+// first. Hits span all namespaces; callers filter on SearchHit.Namespace.
+func (v *Vectors) SearchWithScores(ctx context.Context, embedding []float64, topK int) ([]vector.SearchHit, error) {
+	if !v.enabled {
+		return nil, nil
+	}
+	if topK <= 0 {
+		topK = 5
+	}
+	vec, err := v.encode(embedding)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	rows, err := v.db.QueryContext(ctx, searchSQL+`;`, vec, topK)
+	if err != nil {
+		v.logger.Error("vector search failed", "top_k", topK, "err", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hits []vector.SearchHit
+	for rows.Next() {
+		var h vector.SearchHit
+		if err := rows.Scan(&h.LogID, &h.Namespace, &h.Distance); err != nil {
+			return nil, err
+		}
+		hits = append(hits, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	v.logQuery(time.Since(start), "top_k", topK, "hits", len(hits))
+	return hits, nil
+}
+
+// SearchLogsFiltered returns the nearest topK hits of every namespace and,
+// joined to them in the same query, the logs of those hits matching f.
+func (v *Vectors) SearchLogsFiltered(ctx context.Context, embedding []float64, topK int, f sqlite.LogFilter) (vector.LogResult, error) {
+	var res vector.LogResult
+	if !v.enabled {
+		return res, nil
+	}
+	if topK <= 0 {
+		topK = 5
+	}
+	vec, err := v.encode(embedding)
+	if err != nil {
+		return res, err
+	}
+
+	a := args{vec, topK}
+	query := `
+        SELECT h.log_id, h.namespace, h.distance, ` + logrow.Columns + `
+        FROM (` + searchSQL + `) h
+        LEFT JOIN memory_logs l ON l.id = h.log_id` + where(f, "l", &a) + `
+        ORDER BY h.distance;`
+	start := time.Now()
+	rows, err := v.db.QueryContext(ctx, query, a...)
+	if err != nil {
+		v.logger.Error("vector search failed", "top_k", topK, "err", err)
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var h vector.SearchHit
+		e, ok, err := logrow.Scan(rows, &h.LogID, &h.Namespace, &h.Distance)
+		if err != nil {
+			return res, err
+		}
+		res.Hits = append(res.Hits, h)
+		if ok {
+			res.Logs = append(res.Logs, e)
+			res.Distances = append(res.Distances, h.Distance)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return res, err
+	}
+	v.logQuery(time.Since(start), "top_k", topK, "hits", len(res.Hits), "logs", len(res.Logs))
+	return res, nil
+}
+
+// DeleteByLogIDs removes the vectors stored for the given log ids and
+// returns how many were deleted. Deleting a log removes its vector too, so
+// only callers keeping the log need this.
+func (v *Vectors) DeleteByLogIDs(ctx context.Context, logIDs []string) (int64, error) {
+	if !v.enabled || len(logIDs) == 0 {
+		return 0, nil
+	}
+	res, err := v.db.ExecContext(ctx, `DELETE FROM `+vectorTable+` WHERE log_id = ANY($1);`, logIDs)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Clear removes every stored vector.
+func (v *Vectors) Clear(ctx context.Context) error {
+	if !v.enabled {
+		return nil
+	}
+	_, err := v.db.ExecContext(ctx, `DELETE FROM `+vectorTable+`;`)
+	return err
+}
+
+// Count returns the number of stored vectors (0 when disabled).
+func (v *Vectors) Count(ctx context.Context) (int64, error) {
+	if !v.enabled {
+		return 0, nil
+	}
+	var n int64
+	err := v.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+vectorTable+`;`).Scan(&n)
+	return n, err
+}
+
+// Ping checks that the vector table answers queries (nil when disabled).
+func (v *Vectors) Ping(ctx context.Context) error {
+	if !v.enabled {
+		return nil
+	}
+	err := v.db.QueryRowContext(ctx, `SELECT 1 FROM `+vectorTable+` LIMIT 1;`).Scan(new(int))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	return err
+}
+
+// encode checks the dimension of embedding and formats it for pgvector.
+func (v *Vectors) encode(embedding []float64) (string, error) {
+	if v.dim > 0 && len(embedding) != v.dim {
+		return "", fmt.Errorf("embedding dimension mismatch: got %d want %d", len(embedding), v.dim)
+	}
+	return encodeVector(embedding)
+}
+
+// logQuery logs a search's duration at debug level, or as a warning when it
+// was slow.
+func (v *Vectors) logQuery(d time.Duration, args ...any) {
+	args = append(args, "ms", d.Milliseconds())
+	if d >= slowQuery {
+		v.logger.Warn("slow vector search", args...)
+		return
+	}
+	v.logger.Debug("vector search", args...)
+}
+
+// encodeVector formats an embedding in pgvector's text form, [1,2,3].
+// pgvector stores float32 values, so NaN, infinities and values outside the
+// float32 range are rejected, as vector.EncodeFloat32 rejects them.
+func encodeVector(vec []float64) (string, error) {
+	if len(vec) == 0 {
+		return "", errors.New("embedding is empty")
+	}
+	var b strings.Builder
+	b.Grow(10 * len(vec))
+	b.WriteByte('[')
+	for i, x := range vec {
+		if math.IsNaN(x) || math.IsInf(x, 0) || math.Abs(x) > math.MaxFloat32 {
+			return "", fmt.Errorf("embedding value %d is not a finite float32: %v", i, x)
+		}
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(x, 'g', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String(), nil
+}
@@ -0,0 +1,124 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/graph"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+func observeID(t *testing.T, m *store.MemoryEngine, content string) string {
+	t.Helper()
+	res, err := m.ObserveWithID(context.Background(), model.SensoryInput{Content: content})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.LogID
+}
+
+// sourcesOf returns the contents of the logs each fact was distilled from,
+// keyed by subject.
+func sourcesOf(t *testing.T, m *store.MemoryEngine) map[string][]string {
+	t.Helper()
+	ctx := context.Background()
+	res, err := m.ListFacts(ctx, graph.ListParams{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(map[string][]string)
+	for _, tr := range res.Triples {
+		detail, err := m.Fact(ctx, "", tr.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range detail.Sources {
+			out[tr.Subject] = append(out[tr.Subject], l.Content)
+		}
+	}
+	return out
+}
+
+func TestFactsCiteTheLogsTheyWereDistilledFrom(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngine(t)
+	want := map[string]string{"alice": "Alice works at Acme.", "bob": "Bob lives in Berlin."}
+	for source, content := range want {
+		if err := m.Observe(ctx, model.SensoryInput{Source: source, Content: content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	got := sourcesOf(t, m)
+	if len(got) != len(want) {
+		t.Fatalf("%d facts, want %d", len(got), len(want))
+	}
+	for subject, content := range want {
+		if len(got[subject]) != 1 || got[subject][0] != content {
+			t.Errorf("sources of %s = %q, want %q", subject, got[subject], content)
+		}
+	}
+}
+
+func TestLogDetail(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngine(t)
+	id := observeID(t, m, "Alice works at Acme.")
+	detail, err := m.Log(ctx, "", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detail.Log.ID != id || detail.Log.Content != "Alice works at Acme." {
+		t.Errorf("log = %+v, want the observed one", detail.Log)
+	}
+	if detail.Embedding != store.EmbeddingDisabled {
+		t.Errorf("embedding = %q without vector search, want %q", detail.Embedding, store.EmbeddingDisabled)
+	}
+	if detail.Facts == nil || len(detail.Facts) != 0 {
+		t.Errorf("facts before consolidation = %#v, want an empty list", detail.Facts)
+	}
+	if err := m.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if detail, err = m.Log(ctx, "", id); err != nil {
+		t.Fatal(err)
+	}
+	if len(detail.Facts) != 1 || detail.Facts[0].Subject != "alice" {
+		t.Errorf("facts after consolidation = %+v, want the alice fact", detail.Facts)
+	}
+
+	if _, err := m.Log(ctx, "", "00000000-0000-4000-8000-000000000000"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Log of a missing id: %v, want ErrNotFound", err)
+	}
+	if _, err := m.Log(ctx, "", "nope"); !errors.Is(err, store.ErrInvalidInput) {
+		t.Errorf("Log of a malformed id: %v, want ErrInvalidInput", err)
+	}
+}
+
+func TestDistillerWithoutProvenanceCitesTheWholeBatch(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngineWithOptions(t, store.Options{Distiller: &stubDistiller{}})
+	for _, content := range []string{"a", "b"} {
+		if err := m.Observe(ctx, model.SensoryInput{Content: content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for subject, sources := range sourcesOf(t, m) {
+		seen := make(map[string]bool)
+		for _, s := range sources {
+			seen[s] = true
+		}
+		if len(seen) != 2 || !seen["a"] || !seen["b"] {
+			t.Errorf("sources of %s = %q, want logs a and b", subject, sources)
+		}
+	}
+}
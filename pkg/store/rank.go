@@ -0,0 +1,126 @@
+package store
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// RankWeights balances the signals merged into RecalledContext.Ranked. A
+// log scores Vector*similarity + Recency*recency and a fact scores
+// Confidence*confidence + Recency*recency (halved for neighbour facts),
+// where similarity is the vector distance min-max normalized over the hits
+// to [0, 1] (nearest = 1) and recency halves every RecencyHalfLife.
+type RankWeights struct {
+	Vector          float64
+	Confidence      float64
+	Recency         float64
+	RecencyHalfLife time.Duration
+}
+
+// DefaultRankWeights favours relevance, with recency as a tie-breaker.
+var DefaultRankWeights = RankWeights{
+	Vector:          1,
+	Confidence:      1,
+	Recency:         0.3,
+	RecencyHalfLife: 7 * 24 * time.Hour,
+}
+
+// neighborDiscount scales the score of facts recall added as neighbours of
+// the matched ones, so they rank below comparable direct matches.
+const neighborDiscount = 0.5
+
+// rankParams configures rank.
+type rankParams struct {
+	weights RankWeights
+	// decay, when positive, multiplies every score by the item's recency
+	// at this half-life. Logs are then scored by their absolute similarity
+	// rather than the min-max normalized one, which would blow small
+	// distance gaps up beyond what age can offset.
+	decay      time.Duration
+	similarity func(distance float64) float64
+	now        time.Time
+}
+
+// rankParams returns the ranking parameters of a recall; the recall's
+// RecencyHalfLife overrides the engine's, and a negative one disables it.
+func (m *MemoryEngine) rankParams(opts model.RecallOptions) rankParams {
+	decay := m.recencyHalfLife
+	if opts.RecencyHalfLife != 0 {
+		decay = opts.RecencyHalfLife
+	}
+	return rankParams{
+		weights:    m.rankWeights,
+		decay:      decay,
+		similarity: m.vec.Similarity,
+		now:        time.Now(),
+	}
+}
+
+// rank merges vector hits and facts into one list, highest score first.
+// distances maps log ids to their vector distance.
+func rank(logs []model.LogEntry, distances map[string]float64, facts []model.Triple, p rankParams) []model.RecalledItem {
+	w := p.weights
+	minD, maxD := math.Inf(1), math.Inf(-1)
+	for _, l := range logs {
+		d := distances[l.ID]
+		minD = math.Min(minD, d)
+		maxD = math.Max(maxD, d)
+	}
+
+	items := make([]model.RecalledItem, 0, len(logs)+len(facts))
+	for i := range logs {
+		l := &logs[i]
+		d, hit := distances[l.ID]
+		sim := 1.0
+		switch {
+		case hit && p.decay > 0 && p.similarity != nil:
+			sim = math.Max(0, math.Min(1, p.similarity(d)))
+		case maxD > minD:
+			sim = 1 - (d-minD)/(maxD-minD)
+		}
+		item := model.RecalledItem{
+			Kind:  model.RecalledLog,
+			Score: w.Vector*sim + w.Recency*recency(l.Timestamp, p.now, w.RecencyHalfLife),
+			Log:   l,
+		}
+		if p.decay > 0 {
+			item.Score *= recency(l.Timestamp, p.now, p.decay)
+		}
+		if hit {
+			item.Distance = &d
+		}
+		items = append(items, item)
+	}
+	for i := range facts {
+		f := &facts[i]
+		score := w.Confidence*f.Confidence + w.Recency*recency(f.CreatedAt, p.now, w.RecencyHalfLife)
+		if f.Hop > 0 {
+			score *= neighborDiscount
+		}
+		if p.decay > 0 {
+			score *= recency(f.CreatedAt, p.now, p.decay)
+		}
+		items = append(items, model.RecalledItem{
+			Kind:  model.RecalledFact,
+			Score: score,
+			Fact:  f,
+		})
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Score > items[j].Score })
+	return items
+}
+
+// recency decays from 1 (now) by half every halfLife; zero times score 0.
+func recency(t, now time.Time, halfLife time.Duration) float64 {
+	if t.IsZero() || halfLife <= 0 {
+		return 0
+	}
+	age := now.Sub(t)
+	if age < 0 {
+		age = 0
+	}
+	return math.Exp2(-float64(age) / float64(halfLife))
+}
@@ -0,0 +1,163 @@
+package store
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+func TestRankMergesLogsAndFacts(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	logs := []model.LogEntry{
+		{ID: "far", Content: "far", Timestamp: now},
+		{ID: "near", Content: "near", Timestamp: now},
+	}
+	distances := map[string]float64{"far": 0.9, "near": 0.1}
+	facts := []model.Triple{
+		{Subject: "weak", Confidence: 0.2, CreatedAt: now},
+		{Subject: "strong", Confidence: 0.95, CreatedAt: now},
+		{Subject: "neighbour", Confidence: 0.95, CreatedAt: now, Hop: 1},
+	}
+	w := RankWeights{Vector: 1, Confidence: 1}
+	got := rank(logs, distances, facts, rankParams{weights: w, now: now})
+
+	var order []string
+	for _, it := range got {
+		if it.Kind == model.RecalledLog {
+			order = append(order, "log:"+it.Log.Content)
+		} else {
+			order = append(order, "fact:"+it.Fact.Subject)
+		}
+	}
+	want := []string{"log:near", "fact:strong", "fact:neighbour", "fact:weak", "log:far"}
+	if len(order) != len(want) {
+		t.Fatalf("ranked %q, want %q", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("ranked %q, want %q", order, want)
+		}
+	}
+	if got[0].Distance == nil || *got[0].Distance != 0.1 {
+		t.Errorf("distance of the nearest log = %v, want 0.1", got[0].Distance)
+	}
+	if got[2].Score != got[1].Score*neighborDiscount {
+		t.Errorf("neighbour score = %v, want %v", got[2].Score, got[1].Score*neighborDiscount)
+	}
+}
+
+func TestRankWeights(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	facts := []model.Triple{
+		{Subject: "old", Confidence: 0.9, CreatedAt: now.Add(-30 * 24 * time.Hour)},
+		{Subject: "new", Confidence: 0.5, CreatedAt: now},
+	}
+	first := func(w RankWeights) string {
+		return rank(nil, nil, append([]model.Triple(nil), facts...), rankParams{weights: w, now: now})[0].Fact.Subject
+	}
+	if s := first(RankWeights{Confidence: 1}); s != "old" {
+		t.Errorf("confidence only: %s first, want old", s)
+	}
+	if s := first(RankWeights{Confidence: 1, Recency: 1, RecencyHalfLife: 24 * time.Hour}); s != "new" {
+		t.Errorf("with recency: %s first, want new", s)
+	}
+}
+
+func TestRecency(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	for _, tt := range []struct {
+		at   time.Time
+		want float64
+	}{
+		{now, 1},
+		{now.Add(-day), 0.5},
+		{now.Add(-2 * day), 0.25},
+		{time.Time{}, 0},
+	} {
+		if got := recency(tt.at, now, day); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("recency(%v) = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestRankDistanceOnlyOnVectorHits(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	logs := []model.LogEntry{
+		{ID: "hit", Timestamp: now},
+		{ID: "recent", Timestamp: now},
+	}
+	facts := []model.Triple{{Subject: "alice", Confidence: 0.9, CreatedAt: now}}
+	got := rank(logs, map[string]float64{"hit": 0}, facts, rankParams{weights: RankWeights{Vector: 1, Confidence: 1}, now: now})
+	for _, it := range got {
+		switch {
+		case it.Kind == model.RecalledFact && it.Distance != nil:
+			t.Errorf("fact %s has distance %v", it.Fact.Subject, *it.Distance)
+		case it.Kind == model.RecalledLog && it.Log.ID == "recent" && it.Distance != nil:
+			t.Errorf("log without a vector hit has distance %v", *it.Distance)
+		case it.Kind == model.RecalledLog && it.Log.ID == "hit" && (it.Distance == nil || *it.Distance != 0):
+			t.Errorf("distance of an exact hit = %v, want 0", it.Distance)
+		}
+	}
+}
+
+func TestRankRecencyHalfLife(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	logs := []model.LogEntry{
+		{ID: "old", Timestamp: now.Add(-30 * day)},
+		{ID: "new", Timestamp: now.Add(-day)},
+	}
+	// the old log is a slightly nearer match
+	distances := map[string]float64{"old": 0.10, "new": 0.15}
+	facts := []model.Triple{{Subject: "alice", Confidence: 0.8, CreatedAt: now.Add(-7 * day)}}
+	p := rankParams{weights: RankWeights{Vector: 1, Confidence: 1}, now: now, similarity: func(d float64) float64 { return 1 - d/2 }}
+
+	if got := rank(logs, distances, facts, p); got[0].Log == nil || got[0].Log.ID != "old" {
+		t.Errorf("without decay %+v ranks first, want the nearer old log", got[0])
+	}
+	p.decay = 7 * day
+	got := rank(logs, distances, facts, p)
+	scores := make(map[string]float64)
+	for _, it := range got {
+		if it.Log != nil {
+			scores[it.Log.ID] = it.Score
+		} else {
+			scores[it.Fact.Subject] = it.Score
+		}
+	}
+	if got[0].Log == nil || got[0].Log.ID != "new" {
+		t.Errorf("with decay %+v ranks first, want the recent log", got[0])
+	}
+	// logs are scored by absolute similarity, not the min-max normalized one
+	if want := 0.925 * recency(now.Add(-day), now, 7*day); math.Abs(scores["new"]-want) > 1e-9 {
+		t.Errorf("score of the recent log = %v, want %v", scores["new"], want)
+	}
+	if want := 0.8 * 0.5; math.Abs(scores["alice"]-want) > 1e-9 {
+		t.Errorf("score of a week-old fact = %v, want %v", scores["alice"], want)
+	}
+}
+
+func TestRankParamsRecencyHalfLife(t *testing.T) {
+	m, err := NewMemoryEngine(context.Background(), Options{DBPath: MemoryPath, RecencyHalfLife: 72 * time.Hour, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	for _, tt := range []struct {
+		opt, want time.Duration
+	}{
+		{0, 72 * time.Hour},
+		{time.Hour, time.Hour},
+		{-1, -1},
+	} {
+		if got := m.rankParams(model.RecallOptions{RecencyHalfLife: tt.opt}).decay; got != tt.want {
+			t.Errorf("decay with RecencyHalfLife %v = %v, want %v", tt.opt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package store_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/graph"
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+// snapshot writes a log and its fact to a database file and returns its
+// path and the log id.
+func snapshot(t *testing.T) (string, string) {
+	t.Helper()
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "paim.db")
+	rw := storetest.NewTestEngineWithOptions(t, store.Options{DBPath: path})
+	res, err := rw.ObserveWithID(ctx, model.SensoryInput{Content: "Alice works at Acme."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path, res.LogID
+}
+
+func TestReadOnlyRejectsEveryWrite(t *testing.T) {
+	ctx := context.Background()
+	path, logID := snapshot(t)
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := storetest.NewTestEngineWithOptions(t, store.Options{DBPath: path, ReadOnly: true, MaintenanceInterval: -1})
+	if !m.ReadOnly() {
+		t.Fatal("engine is not read-only")
+	}
+	facts, err := m.ListFacts(ctx, graph.ListParams{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(facts.Triples) != 1 {
+		t.Fatalf("%d facts in the snapshot, want 1", len(facts.Triples))
+	}
+	factID := facts.Triples[0].ID
+	content := "rewritten"
+
+	for name, write := range map[string]func() error{
+		"Observe": func() error { return m.Observe(ctx, model.SensoryInput{Content: "x"}) },
+		"ObserveWithID": func() error {
+			_, err := m.ObserveWithID(ctx, model.SensoryInput{Content: "x"})
+			return err
+		},
+		"ObserveBatch": func() error {
+			_, err := m.ObserveBatch(ctx, []model.SensoryInput{{Content: "x"}})
+			return err
+		},
+		"ObserveResults": func() error {
+			_, err := m.ObserveResults(ctx, []model.SensoryInput{{Content: "x"}})
+			return err
+		},
+		"Assert": func() error {
+			_, err := m.Assert(ctx, []model.Triple{{Subject: "bob", Predicate: "knows", Object: "alice"}})
+			return err
+		},
+		"UpdateLog": func() error {
+			_, err := m.UpdateLog(ctx, "", logID, sqlite.LogPatch{Content: &content})
+			return err
+		},
+		"DeleteFact": func() error { return m.DeleteFact(ctx, "", factID) },
+		"DeleteFacts": func() error {
+			_, err := m.DeleteFacts(ctx, "", "", "", "", true)
+			return err
+		},
+		"AddAlias":    func() error { return m.AddAlias(ctx, "", "al", "alice") },
+		"Consolidate": func() error { return m.Consolidate(ctx) },
+		"TryConsolidate": func() error {
+			_, err := m.TryConsolidate(ctx)
+			return err
+		},
+		"Summarize": func() error {
+			_, err := m.Summarize(ctx)
+			return err
+		},
+		"Prune": func() error {
+			_, err := m.Prune(ctx)
+			return err
+		},
+		"DeleteLogs": func() error {
+			_, err := m.DeleteLogs(ctx, sqlite.DeleteParams{}, true)
+			return err
+		},
+		"PruneFacts": func() error {
+			_, err := m.PruneFacts(ctx, graph.PruneParams{MaxConfidence: 1})
+			return err
+		},
+		"Import": func() error {
+			_, err := m.Import(ctx, strings.NewReader(`{"type":"log","log":{"content":"x"}}`+"\n"))
+			return err
+		},
+		"Reindex": func() error {
+			_, err := m.Reindex(ctx, store.ReindexOptions{})
+			return err
+		},
+		"Maintain": func() error {
+			_, err := m.Maintain(ctx)
+			return err
+		},
+		"Rekey": func() error { return m.Rekey(ctx, "new key") },
+	} {
+		if err := write(); !errors.Is(err, store.ErrReadOnly) {
+			t.Errorf("%s on a read-only engine: %v, want ErrReadOnly", name, err)
+		}
+	}
+	if n, err := m.RetryPendingEmbeddings(ctx, 10); n != 0 || err != nil {
+		t.Errorf("RetryPendingEmbeddings = %d, %v; want a no-op", n, err)
+	}
+
+	// reads still work, and see the snapshot unchanged
+	res, err := m.Recall(ctx, "Alice", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.RelatedFacts) != 1 {
+		t.Errorf("recall = %d facts, want the snapshot's", len(res.RelatedFacts))
+	}
+	if logs := logContents(t, m); len(logs) != 1 || logs[0] != "Alice works at Acme." {
+		t.Errorf("logs = %q, want the snapshot's", logs)
+	}
+	if items, err := m.BufferedInputs(""); err != nil || len(items) != 0 {
+		t.Errorf("buffer = %v, %v; want nothing buffered", items, err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("the database file changed under a read-only engine")
+	}
+}
@@ -0,0 +1,312 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/graph"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+func observeInputs(t *testing.T, m *store.MemoryEngine, inputs ...model.SensoryInput) {
+	t.Helper()
+	for _, in := range inputs {
+		if err := m.Observe(context.Background(), in); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Consolidate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func recall(t *testing.T, m *store.MemoryEngine, query string, opts model.RecallOptions) *model.RecalledContext {
+	t.Helper()
+	if opts.TopK == 0 {
+		opts.TopK = 10
+	}
+	res, err := m.RecallWithOptions(context.Background(), query, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func objects(facts []model.Triple) []string {
+	var out []string
+	for _, f := range facts {
+		out = append(out, f.Object)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func logsOf(logs []model.LogEntry) []string {
+	var out []string
+	for _, l := range logs {
+		out = append(out, l.Content)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestRecallFiltersBySourceAndMetadata(t *testing.T) {
+	m := storetest.NewTestEngine(t)
+	observeInputs(t, m,
+		model.SensoryInput{Content: "Alice works at Acme", Source: "chat", Metadata: map[string]any{"channel": "work"}},
+		model.SensoryInput{Content: "Alice lives in Berlin", Source: "chat", Metadata: map[string]any{"channel": "home"}},
+		model.SensoryInput{Content: "Alice is a doctor", Source: "email"},
+	)
+
+	tests := []struct {
+		name  string
+		opts  model.RecallOptions
+		facts []string
+		logs  []string
+	}{
+		{"unfiltered", model.RecallOptions{}, []string{"acme", "berlin", "doctor"},
+			[]string{"Alice is a doctor", "Alice lives in Berlin", "Alice works at Acme"}},
+		{"source", model.RecallOptions{Source: "email"}, []string{"doctor"}, []string{"Alice is a doctor"}},
+		{"metadata", model.RecallOptions{Metadata: map[string]string{"channel": "home"}}, []string{"berlin"}, []string{"Alice lives in Berlin"}},
+		{"source and metadata", model.RecallOptions{Source: "email", Metadata: map[string]string{"channel": "home"}}, nil, nil},
+		{"unknown source", model.RecallOptions{Source: "calendar"}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := recall(t, m, "alice", tt.opts)
+			if got := objects(res.RelatedFacts); !slices.Equal(got, tt.facts) {
+				t.Errorf("facts = %q, want %q", got, tt.facts)
+			}
+			// an empty query reads logs directly, so it shows the log filter
+			recent := recall(t, m, "", tt.opts)
+			if got := logsOf(recent.RelatedLogs); !slices.Equal(got, tt.logs) {
+				t.Errorf("logs = %q, want %q", got, tt.logs)
+			}
+		})
+	}
+}
+
+func TestRecallTimeRangeIsInclusive(t *testing.T) {
+	m := storetest.NewTestEngine(t)
+	day := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	observeInputs(t, m,
+		model.SensoryInput{Content: "Alice works at Acme", Timestamp: day.Add(-24 * time.Hour)},
+		model.SensoryInput{Content: "Alice lives in Berlin", Timestamp: day},
+		model.SensoryInput{Content: "Alice is a doctor", Timestamp: day.Add(24 * time.Hour)},
+	)
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     []string
+	}{
+		{"both bounds on rows", day.Add(-24 * time.Hour), day, []string{"Alice lives in Berlin", "Alice works at Acme"}},
+		{"single instant", day, day, []string{"Alice lives in Berlin"}},
+		{"from only", day.Add(time.Second), time.Time{}, []string{"Alice is a doctor"}},
+		{"to only", time.Time{}, day.Add(-time.Second), []string{"Alice works at Acme"}},
+		{"other zone", day.In(time.FixedZone("CEST", 2*3600)), day.In(time.FixedZone("CEST", 2*3600)), []string{"Alice lives in Berlin"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := recall(t, m, "", model.RecallOptions{From: tt.from, To: tt.to})
+			if got := logsOf(res.RelatedLogs); !slices.Equal(got, tt.want) {
+				t.Fatalf("logs = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// facts are bounded by when they were stored, which is now
+	now := time.Now()
+	if res := recall(t, m, "alice", model.RecallOptions{From: now.Add(-time.Hour), To: now.Add(time.Hour)}); len(res.RelatedFacts) != 3 {
+		t.Errorf("facts stored within the hour = %q, want all three", objects(res.RelatedFacts))
+	}
+	if res := recall(t, m, "alice", model.RecallOptions{To: now.Add(-time.Hour)}); len(res.RelatedFacts) != 0 {
+		t.Errorf("facts stored over an hour ago = %q, want none", objects(res.RelatedFacts))
+	}
+}
+
+func TestEmptyQueryRecallsRecentContext(t *testing.T) {
+	m := storetest.NewTestEngine(t)
+	now := time.Now()
+	observeInputs(t, m,
+		model.SensoryInput{Content: "Alice works at Acme", Timestamp: now.Add(-2 * time.Hour)},
+		model.SensoryInput{Content: "Bob lives in Berlin", Timestamp: now.Add(-time.Hour)},
+		model.SensoryInput{Content: "Carol is a doctor", Timestamp: now},
+	)
+	for _, q := range []string{"", "   ", "\n\t"} {
+		res := recall(t, m, q, model.RecallOptions{TopK: 2})
+		if !res.Recent {
+			t.Fatalf("Recall(%q) not flagged as recent context", q)
+		}
+		if len(res.RelatedLogs) != 2 || res.RelatedLogs[0].Content != "Carol is a doctor" || res.RelatedLogs[1].Content != "Bob lives in Berlin" {
+			t.Fatalf("Recall(%q) logs = %q, want the newest two, newest first", q, logsOf(res.RelatedLogs))
+		}
+		if len(res.RelatedFacts) != 2 {
+			t.Fatalf("Recall(%q) facts = %q, want 2", q, objects(res.RelatedFacts))
+		}
+		if res.Diagnostics == nil || res.Diagnostics.VectorSearch {
+			t.Fatalf("Recall(%q) diagnostics = %+v, want no vector search", q, res.Diagnostics)
+		}
+	}
+	if res := recall(t, m, "alice", model.RecallOptions{}); res.Recent {
+		t.Fatal("a non-empty query was answered with recent context")
+	}
+}
+
+func TestMetadataKeysAreValidated(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngine(t)
+	for _, key := range []string{"", "owner.", `x"y`} {
+		filters := map[string]string{key: "v"}
+		if _, err := m.QueryLogsByMetadata(ctx, "", filters, 10); !errors.Is(err, store.ErrInvalidInput) {
+			t.Errorf("QueryLogsByMetadata with key %q: %v, want ErrInvalidInput", key, err)
+		}
+		if _, err := m.RecallWithOptions(ctx, "x", model.RecallOptions{TopK: 1, Metadata: filters}); !errors.Is(err, store.ErrInvalidInput) {
+			t.Errorf("recall with key %q: %v, want ErrInvalidInput", key, err)
+		}
+	}
+}
+
+func TestRecallMinConfidence(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngineWithOptions(t, store.Options{MinConfidence: 0.5, NeighborExpansion: -1})
+	if _, err := m.Assert(ctx, []model.Triple{
+		{Subject: "alice", Predicate: "works_at", Object: "acme", Confidence: 0.9},
+		{Subject: "alice", Predicate: "knows", Object: "bob", Confidence: 0.3},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := objects(recall(t, m, "alice", model.RecallOptions{}).RelatedFacts); !slices.Equal(got, []string{"acme"}) {
+		t.Errorf("facts at the engine threshold = %q, want acme", got)
+	}
+	if got := objects(recall(t, m, "alice", model.RecallOptions{MinConfidence: 0.1}).RelatedFacts); !slices.Equal(got, []string{"acme", "bob"}) {
+		t.Errorf("facts at 0.1 = %q, want both", got)
+	}
+	for _, bad := range []float64{-0.1, 1.5} {
+		if _, err := m.RecallWithOptions(ctx, "alice", model.RecallOptions{TopK: 1, MinConfidence: bad}); !errors.Is(err, store.ErrInvalidInput) {
+			t.Errorf("recall with min confidence %v: %v, want ErrInvalidInput", bad, err)
+		}
+	}
+	if _, err := store.NewMemoryEngine(ctx, store.Options{DBPath: store.MemoryPath, MinConfidence: 2}); err == nil {
+		t.Error("opened an engine with a min confidence of 2")
+	}
+}
+
+func TestRecallLimitsFactsAndLogsSeparately(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngineWithOptions(t, store.Options{MaxTopK: 3, NeighborExpansion: -1})
+	observeInputs(t, m,
+		model.SensoryInput{Content: "Alice works at Acme"},
+		model.SensoryInput{Content: "Alice lives in Berlin"},
+		model.SensoryInput{Content: "Alice is a doctor"},
+		model.SensoryInput{Content: "Alice likes tea"},
+	)
+	for _, tt := range []struct {
+		name        string
+		opts        model.RecallOptions
+		facts, logs int
+	}{
+		{"both without topK", model.RecallOptions{MaxFacts: 1, MaxLogs: 2}, 1, 2},
+		{"facts over topK", model.RecallOptions{TopK: 1, MaxFacts: 2}, 2, 1},
+		{"logs over topK", model.RecallOptions{TopK: 1, MaxLogs: 2}, 1, 2},
+		{"clamped to MaxTopK", model.RecallOptions{MaxFacts: 50, MaxLogs: 50}, 3, 3},
+	} {
+		for _, q := range []string{"", "alice"} {
+			res, err := m.RecallWithOptions(ctx, q, tt.opts)
+			if err != nil {
+				t.Fatalf("%s, query %q: %v", tt.name, q, err)
+			}
+			if len(res.RelatedFacts) != tt.facts {
+				t.Errorf("%s, query %q: %d facts, want %d", tt.name, q, len(res.RelatedFacts), tt.facts)
+			}
+			// without vector search only the recent context has logs
+			if q == "" && len(res.RelatedLogs) != tt.logs {
+				t.Errorf("%s: %d recent logs, want %d", tt.name, len(res.RelatedLogs), tt.logs)
+			}
+		}
+	}
+	for name, opts := range map[string]model.RecallOptions{
+		"negative fact limit": {TopK: 1, MaxFacts: -1},
+		"negative log limit":  {TopK: 1, MaxLogs: -1},
+		"one limit alone":     {MaxFacts: 2},
+	} {
+		if _, err := m.RecallWithOptions(ctx, "alice", opts); !errors.Is(err, store.ErrInvalidInput) {
+			t.Errorf("%s: %v, want ErrInvalidInput", name, err)
+		}
+	}
+}
+
+func TestRecallPredicateAndMatch(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngineWithOptions(t, store.Options{NeighborExpansion: -1})
+	assert(t, m, "",
+		model.Triple{Subject: "alice", Predicate: "works_at", Object: "acme"},
+		model.Triple{Subject: "alice", Predicate: "likes", Object: "tea"},
+		model.Triple{Subject: "malice", Predicate: "works_at", Object: "evil corp"},
+	)
+	for _, tt := range []struct {
+		opts model.RecallOptions
+		want []string
+	}{
+		{model.RecallOptions{}, []string{"acme", "evil corp", "tea"}},
+		{model.RecallOptions{Match: "exact"}, []string{"acme", "tea"}},
+		{model.RecallOptions{Match: "prefix", Predicate: "works_at"}, []string{"acme"}},
+		{model.RecallOptions{Predicate: "works_at"}, []string{"acme", "evil corp"}},
+	} {
+		if got := objects(recall(t, m, "alice", tt.opts).RelatedFacts); !slices.Equal(got, tt.want) {
+			t.Errorf("recall with %+v = %q, want %q", tt.opts, got, tt.want)
+		}
+	}
+	if _, err := m.RecallWithOptions(ctx, "alice", model.RecallOptions{TopK: 1, Match: "fuzzy"}); !errors.Is(err, store.ErrInvalidInput) {
+		t.Errorf("recall with match fuzzy: %v, want ErrInvalidInput", err)
+	}
+	if _, err := m.ListFacts(ctx, graph.ListParams{Subject: "alice", Match: "fuzzy"}); !errors.Is(err, store.ErrInvalidInput) {
+		t.Errorf("ListFacts with match fuzzy: %v, want ErrInvalidInput", err)
+	}
+}
+
+func TestRecallDiagnostics(t *testing.T) {
+	m := storetest.NewTestEngineWithOptions(t, store.Options{MaxTopK: 5})
+	observeInputs(t, m,
+		model.SensoryInput{Content: "Alice works at Acme"},
+		model.SensoryInput{Content: "Bob works at Acme"},
+	)
+	res := recall(t, m, "  alice\n", model.RecallOptions{TopK: 20, MaxLogs: 2, Namespace: "default"})
+	d := res.Diagnostics
+	if d == nil {
+		t.Fatal("recall returned no diagnostics")
+	}
+	if d.Query != "alice" || d.Match != string(graph.MatchContains) || d.Namespace != model.DefaultNamespace || d.MaxFacts != 5 || d.MaxLogs != 2 {
+		t.Errorf("diagnostics = %+v, want the trimmed query, the default match and the clamped limits", d)
+	}
+	// vector search is disabled in tests, so no logs are looked up
+	if d.VectorSearch || d.VectorBackend != "" || d.VectorHits != 0 || d.LogCandidates != 0 || d.Logs != 0 || d.Timings.Embed != 0 || d.Timings.Vector != 0 {
+		t.Errorf("diagnostics = %+v, want no vector search", d)
+	}
+	if !d.GraphExpansion || d.FactsMatched != 1 || d.NeighborsAdded != 1 || d.NeighborsFetched < d.NeighborsAdded {
+		t.Errorf("diagnostics = %+v, want alice's fact and bob's as its neighbour", d)
+	}
+	if d.FactsMatched+d.NeighborsAdded != len(res.RelatedFacts) {
+		t.Errorf("diagnostics count %d+%d facts, recall returned %d", d.FactsMatched, d.NeighborsAdded, len(res.RelatedFacts))
+	}
+	if tm := d.Timings; tm.Total <= 0 || tm.Graph+tm.Expand+tm.Rank > tm.Total {
+		t.Errorf("timings = %+v, want the steps within the total", tm)
+	}
+
+	recent := recall(t, m, "", model.RecallOptions{TopK: 1}).Diagnostics
+	if recent == nil || recent.Query != "" || recent.Match != "" || recent.GraphExpansion || recent.FactsMatched != 1 || recent.Logs != 1 {
+		t.Errorf("recent diagnostics = %+v, want one fact and one log without a match", recent)
+	}
+
+	noExpansion := storetest.NewTestEngineWithOptions(t, store.Options{NeighborExpansion: -1})
+	observeInputs(t, noExpansion, model.SensoryInput{Content: "Alice works at Acme"})
+	if d := recall(t, noExpansion, "alice", model.RecallOptions{}).Diagnostics; d.GraphExpansion || d.NeighborsFetched != 0 || d.Timings.Expand != 0 {
+		t.Errorf("diagnostics without expansion = %+v", d)
+	}
+}
@@ -0,0 +1,98 @@
+package store_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/engine/redact"
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+func newRedacting(t *testing.T) *store.MemoryEngine {
+	t.Helper()
+	r, err := redact.NewRegex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return storetest.NewTestEngineWithOptions(t, store.Options{Redactor: r, ConsolidateFillRatio: -1})
+}
+
+func TestRedactorAppliesToEveryWrite(t *testing.T) {
+	ctx := context.Background()
+	m := newRedacting(t)
+
+	res, err := m.ObserveWithID(ctx, model.SensoryInput{Content: "mail alice@example.com", Metadata: map[string]any{"phone": "555-123-4567"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.ObserveBatch(ctx, []model.SensoryInput{{Content: "card 4111 1111 1111 1111"}}); err != nil {
+		t.Fatal(err)
+	}
+	l, err := m.Log(ctx, "", res.LogID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Log.Content != "mail [EMAIL]" || l.Log.Metadata["phone"] != "[PHONE]" {
+		t.Errorf("observed log = %q %v, want it redacted", l.Log.Content, l.Log.Metadata)
+	}
+	// the buffer, and so the distiller, only sees redacted content
+	items, err := m.BufferedInputs("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("%d inputs buffered, want 2", len(items))
+	}
+	for _, it := range items {
+		if it.Input.Content != "mail [EMAIL]" && it.Input.Content != "card [CARD]" {
+			t.Errorf("buffered %q", it.Input.Content)
+		}
+	}
+
+	content := "now bob@example.com"
+	updated, err := m.UpdateLog(ctx, "", res.LogID, sqlite.LogPatch{Content: &content, Metadata: map[string]any{"cc": "carol@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Content != "now [EMAIL]" || updated.Metadata["cc"] != "[EMAIL]" || updated.Metadata["phone"] != "[PHONE]" {
+		t.Errorf("updated log = %q %v, want it redacted", updated.Content, updated.Metadata)
+	}
+
+	// an export of an engine without a redactor is redacted on import
+	plain := storetest.NewTestEngine(t)
+	observeAll(t, plain, "call 555-123-4567")
+	var dump bytes.Buffer
+	if err := plain.Export(ctx, &dump); err != nil {
+		t.Fatal(err)
+	}
+	imported := newRedacting(t)
+	if _, err := imported.Import(ctx, &dump); err != nil {
+		t.Fatal(err)
+	}
+	if logs := logContents(t, imported); len(logs) != 1 || logs[0] != "call [PHONE]" {
+		t.Errorf("imported logs = %q, want them redacted", logs)
+	}
+}
+
+// failingRedactor rejects every input.
+type failingRedactor struct{}
+
+func (failingRedactor) Redact(_ context.Context, in model.SensoryInput) (model.SensoryInput, error) {
+	return in, errors.New("redactor down")
+}
+
+func TestRedactorFailureStoresNothing(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngineWithOptions(t, store.Options{Redactor: failingRedactor{}})
+	if _, err := m.ObserveBatch(ctx, []model.SensoryInput{{Content: "one"}, {Content: "two"}}); err == nil {
+		t.Fatal("ObserveBatch succeeded with a failing redactor")
+	}
+	if logs := logContents(t, m); len(logs) != 0 {
+		t.Errorf("stored %q despite the redactor failing", logs)
+	}
+}
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// DefaultReindexBatchSize is how many logs Reindex embeds per batch.
+const DefaultReindexBatchSize = 100
+
+// ReindexOptions configures Reindex.
+type ReindexOptions struct {
+	// BatchSize is the number of logs claimed per batch (default 100).
+	BatchSize int
+	// Resume skips dropping the stored vectors and re-queueing every log, and
+	// only drains what an interrupted run left in the embedding queue.
+	Resume bool
+	// Progress, when set, is called after every batch with the running totals.
+	Progress func(ReindexReport)
+}
+
+// ReindexReport summarizes a Reindex run.
+type ReindexReport struct {
+	// Queued is the number of logs waiting to be embedded when the run began.
+	Queued int64 `json:"queued"`
+	// Embedded and Failed count the logs this run processed.
+	Embedded int64 `json:"embedded"`
+	Failed   int64 `json:"failed"`
+	// Remaining is what is left in the queue afterwards: failed logs waiting
+	// for a retry and anything the background workers had not finished yet.
+	Remaining       int64   `json:"remaining"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// Reindex rebuilds every embedding with the current embedder, for example
+// after switching embedding models. It drops the stored vectors, queues all
+// logs in the persistent embedding queue and drains the queue in batches.
+// Logs whose embedding the current model already computed are indexed from
+// the embeddings table without calling the embedder.
+// Because the queue survives restarts, an interrupted run loses nothing: the
+// background workers pick the rest up, and re-running (or running with
+// Resume) is safe.
+func (m *MemoryEngine) Reindex(ctx context.Context, opts ReindexOptions) (ReindexReport, error) {
+	var report ReindexReport
+	if m.readOnly {
+		return report, ErrReadOnly
+	}
+	if !m.embeds() {
+		return report, fmt.Errorf("%w: vector search and embedding storage are disabled", ErrInvalidInput)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultReindexBatchSize
+	}
+	start := time.Now()
+
+	var err error
+	if opts.Resume {
+		report.Queued, err = m.db.PendingEmbeddingCount(ctx)
+	} else {
+		if err = m.vec.Clear(ctx); err != nil {
+			return report, fmt.Errorf("clear embeddings: %w", err)
+		}
+		report.Queued, err = m.db.EnqueueAllLogs(ctx)
+	}
+	if err != nil {
+		return report, err
+	}
+	m.logger.Info("reindex started", "queued", report.Queued, "resume", opts.Resume)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		claimed, err := m.db.ClaimEmbeddings(ctx, opts.BatchSize, embedLease)
+		if err != nil {
+			return report, err
+		}
+		if len(claimed) == 0 {
+			break
+		}
+		for _, p := range claimed {
+			if err := m.embedLog(ctx, p); err != nil {
+				if ctx.Err() != nil {
+					return report, ctx.Err()
+				}
+				m.logger.Warn("reindex embedding failed", "log_id", p.LogID, "err", err)
+				report.Failed++
+				continue
+			}
+			report.Embedded++
+		}
+		report.DurationSeconds = time.Since(start).Seconds()
+		if opts.Progress != nil {
+			opts.Progress(report)
+		}
+	}
+
+	if report.Remaining, err = m.db.PendingEmbeddingCount(ctx); err != nil {
+		return report, err
+	}
+	if m.embedderModel != "" {
+		if err := m.db.SetEmbedderModel(ctx, m.embedderModel); err != nil {
+			return report, err
+		}
+	}
+	report.DurationSeconds = time.Since(start).Seconds()
+	m.logger.Info("reindex finished", "embedded", report.Embedded, "failed", report.Failed,
+		"remaining", report.Remaining, "duration", time.Since(start))
+	return report, nil
+}
+
+// checkEmbedderModel records the embedding model on first use and warns when
+// the stored vectors were built by a different one.
+func checkEmbedderModel(ctx context.Context, db LogStore, name string, logger *slog.Logger) error {
+	stored, err := db.EmbedderModel(ctx)
+	if err != nil {
+		return err
+	}
+	switch stored {
+	case name:
+	case "":
+		return db.SetEmbedderModel(ctx, name)
+	default:
+		logger.Warn("embedding model changed since the stored vectors were built; run a reindex",
+			"stored", stored, "configured", name)
+	}
+	return nil
+}
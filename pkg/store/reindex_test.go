@@ -0,0 +1,97 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+func TestReindex(t *testing.T) {
+	ctx := context.Background()
+	emb := newFlakyEmbedder(func(int) bool { return false })
+	m := storetest.NewTestEngineWithOptions(t, store.Options{
+		Embedder:        emb,
+		VectorDim:       64,
+		StoreEmbeddings: true,
+		SyncEmbedding:   true,
+	})
+	observeAll(t, m, "a", "b", "c", "d", "e")
+	if n := emb.embedded(); n != 5 {
+		t.Fatalf("%d embedded on observe, want 5", n)
+	}
+
+	var progress []int64
+	report, err := m.Reindex(ctx, store.ReindexOptions{BatchSize: 2, Progress: func(r store.ReindexReport) {
+		progress = append(progress, r.Embedded)
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Queued != 5 || report.Embedded != 5 || report.Failed != 0 || report.Remaining != 0 {
+		t.Fatalf("report = %+v, want all 5 re-embedded", report)
+	}
+	if len(progress) != 3 || progress[2] != 5 {
+		t.Errorf("progress = %v, want a call per batch of 2", progress)
+	}
+	if n := emb.embedded(); n != 10 {
+		t.Errorf("%d embedder calls, want every log embedded again", n)
+	}
+}
+
+func TestReindexResumesAfterInterruption(t *testing.T) {
+	emb := newFlakyEmbedder(func(int) bool { return false })
+	m := storetest.NewTestEngineWithOptions(t, store.Options{
+		Embedder:        emb,
+		VectorDim:       64,
+		StoreEmbeddings: true,
+		SyncEmbedding:   true,
+	})
+	observeAll(t, m, "a", "b", "c", "d", "e")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	report, err := m.Reindex(ctx, store.ReindexOptions{BatchSize: 2, Progress: func(store.ReindexReport) { cancel() }})
+	if !errors.Is(err, context.Canceled) || report.Embedded != 2 {
+		t.Fatalf("interrupted Reindex = %+v, %v; want 2 embedded and context.Canceled", report, err)
+	}
+	if depth := queueDepth(t, m); depth != 3 {
+		t.Fatalf("queue depth %d after the interruption, want 3", depth)
+	}
+
+	report, err = m.Reindex(context.Background(), store.ReindexOptions{Resume: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Queued != 3 || report.Embedded != 3 || report.Remaining != 0 {
+		t.Fatalf("resumed Reindex = %+v, want the 3 left over", report)
+	}
+}
+
+func TestReindexFailuresStayQueued(t *testing.T) {
+	ctx := context.Background()
+	emb := newFlakyEmbedder(func(call int) bool { return call > 2 })
+	m := storetest.NewTestEngineWithOptions(t, store.Options{
+		Embedder:              emb,
+		VectorDim:             64,
+		StoreEmbeddings:       true,
+		SyncEmbedding:         true,
+		EmbedBreakerThreshold: -1,
+	})
+	observeAll(t, m, "a", "b")
+	report, err := m.Reindex(ctx, store.ReindexOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Embedded != 0 || report.Failed != 2 || report.Remaining != 2 {
+		t.Fatalf("report = %+v, want both failures left queued", report)
+	}
+}
+
+func TestReindexNeedsEmbeddings(t *testing.T) {
+	m := storetest.NewTestEngine(t)
+	if _, err := m.Reindex(context.Background(), store.ReindexOptions{}); !errors.Is(err, store.ErrInvalidInput) {
+		t.Fatalf("Reindex without embeddings = %v, want ErrInvalidInput", err)
+	}
+}
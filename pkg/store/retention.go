@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/store/graph"
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+)
+
+// PruneReport summarizes one retention pass.
+type PruneReport struct {
+	Logs       int64 `json:"logs"`
+	Embeddings int64 `json:"embeddings"`
+	Facts      int64 `json:"facts"`
+}
+
+// Prune deletes memory logs that fall outside the retention policy
+// (Options.LogRetention and Options.MaxLogs) together with their embeddings,
+// and stale low-confidence facts when Options.FactPruneAge is set. Logs
+// cited as provenance by a fact and logs still waiting in the sensory
+// buffer are kept. With no policy configured it does nothing.
+func (m *MemoryEngine) Prune(ctx context.Context) (PruneReport, error) {
+	var report PruneReport
+	if m.readOnly {
+		return report, ErrReadOnly
+	}
+	if m.factPrune.MaxAge > 0 {
+		n, err := m.graph.PruneTriples(ctx, m.factPrune)
+		if err != nil {
+			return report, fmt.Errorf("prune facts: %w", err)
+		}
+		report.Facts = n
+		if n > 0 {
+			m.logger.Debug("pruned facts", "facts", n)
+		}
+	}
+	if m.logRetention <= 0 && m.maxLogs <= 0 {
+		return report, nil
+	}
+	var olderThan time.Time
+	if m.logRetention > 0 {
+		olderThan = time.Now().Add(-m.logRetention)
+	}
+	var buffered []string
+	for _, it := range m.buffer.SnapshotItems() {
+		if it.Input.LogID != "" {
+			buffered = append(buffered, it.Input.LogID)
+		}
+	}
+
+	ids, err := m.db.PrunableLogs(ctx, olderThan, m.maxLogs, buffered)
+	if err != nil {
+		return report, fmt.Errorf("select logs: %w", err)
+	}
+	if len(ids) == 0 {
+		return report, nil
+	}
+	// vectors go first: a log whose deletion fails is retried next pass,
+	// whereas a vector left behind would point at a missing log forever
+	if report.Embeddings, err = m.vec.DeleteByLogIDs(ctx, ids); err != nil {
+		return report, fmt.Errorf("delete embeddings: %w", err)
+	}
+	if report.Logs, err = m.db.DeleteLogs(ctx, ids); err != nil {
+		return report, fmt.Errorf("delete logs: %w", err)
+	}
+	m.logger.Debug("pruned memory logs", "logs", report.Logs, "embeddings", report.Embeddings)
+	return report, nil
+}
+
+// DeleteLogs deletes the logs of p.Namespace that p selects, together with
+// their embeddings, buffered inputs and provenance links, and returns how
+// many logs were removed. Deleting every log of the namespace requires all
+// to be set, so an empty filter can't clear it by accident.
+func (m *MemoryEngine) DeleteLogs(ctx context.Context, p sqlite.DeleteParams, all bool) (int64, error) {
+	if m.readOnly {
+		return 0, ErrReadOnly
+	}
+	var err error
+	if p.Namespace, err = NormalizeNamespace(p.Namespace); err != nil {
+		return 0, err
+	}
+	if p.IsZero() && !all {
+		return 0, fmt.Errorf("%w: a source, before or after filter is required", ErrInvalidInput)
+	}
+	if !p.Before.IsZero() && !p.After.IsZero() && !p.After.Before(p.Before) {
+		return 0, fmt.Errorf("%w: after must be earlier than before", ErrInvalidInput)
+	}
+	n, err := m.db.DeleteLogsWhere(ctx, p, func(ids []string) error {
+		m.buffer.RemoveLogs(ids)
+		// vectors go first, as in Prune
+		_, err := m.vec.DeleteByLogIDs(ctx, ids)
+		return err
+	})
+	if err != nil {
+		return n, fmt.Errorf("delete logs: %w", err)
+	}
+	m.logger.Debug("deleted memory logs", "namespace", p.Namespace, "logs", n)
+	return n, nil
+}
+
+// PruneFacts deletes the stale, low-confidence facts p selects (see
+// graph.PruneParams) from p.Namespace and returns how many were removed.
+func (m *MemoryEngine) PruneFacts(ctx context.Context, p graph.PruneParams) (int64, error) {
+	if m.readOnly {
+		return 0, ErrReadOnly
+	}
+	var err error
+	if p.Namespace, err = NormalizeNamespace(p.Namespace); err != nil {
+		return 0, err
+	}
+	n, err := m.graph.PruneTriples(ctx, p)
+	if errors.Is(err, graph.ErrInvalidPrune) {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	return n, err
+}
@@ -0,0 +1,213 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/graph"
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+// noFacts distills nothing, so no log is kept as provenance.
+type noFacts struct{}
+
+func (noFacts) Distill(context.Context, []model.SensoryInput) ([]model.Triple, error) {
+	return nil, nil
+}
+
+func observeAt(t *testing.T, m *store.MemoryEngine, content string, at time.Time) {
+	t.Helper()
+	if err := m.Observe(context.Background(), model.SensoryInput{Content: content, Timestamp: at}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func logContents(t *testing.T, m *store.MemoryEngine) []string {
+	t.Helper()
+	logs, err := m.RecentLogs(context.Background(), "", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, l := range logs {
+		out = append(out, l.Content)
+	}
+	return out
+}
+
+func TestPruneDropsLogsPastRetention(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngineWithOptions(t, store.Options{
+		Distiller: noFacts{}, LogRetention: 24 * time.Hour, ConsolidateFillRatio: -1,
+	})
+	observeAt(t, m, "old", time.Now().Add(-48*time.Hour))
+	observeAt(t, m, "fresh", time.Time{})
+
+	report, err := m.Prune(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Logs != 0 {
+		t.Fatalf("Prune removed %d logs still waiting in the buffer", report.Logs)
+	}
+
+	if err := m.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if report, err = m.Prune(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if report.Logs != 1 {
+		t.Fatalf("Prune removed %d logs, want the old one", report.Logs)
+	}
+	if got := logContents(t, m); len(got) != 1 || got[0] != "fresh" {
+		t.Fatalf("logs left = %q, want only fresh", got)
+	}
+}
+
+func TestPruneKeepsLogsCitedByFacts(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngineWithOptions(t, store.Options{
+		Distiller: &stubDistiller{}, LogRetention: time.Hour, ConsolidateFillRatio: -1,
+	})
+	observeAt(t, m, "old", time.Now().Add(-48*time.Hour))
+	if err := m.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	report, err := m.Prune(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Logs != 0 {
+		t.Fatalf("Prune removed %d logs cited by a fact", report.Logs)
+	}
+}
+
+func TestPruneKeepsTheNewestMaxLogs(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngineWithOptions(t, store.Options{
+		Distiller: noFacts{}, MaxLogs: 2, ConsolidateFillRatio: -1,
+	})
+	now := time.Now()
+	for i, c := range []string{"first", "second", "third", "fourth"} {
+		observeAt(t, m, c, now.Add(time.Duration(i-4)*time.Hour))
+	}
+	if err := m.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	report, err := m.Prune(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Logs != 2 {
+		t.Fatalf("Prune removed %d logs, want 2", report.Logs)
+	}
+	if got := logContents(t, m); len(got) != 2 || got[0] != "fourth" || got[1] != "third" {
+		t.Fatalf("logs left = %q, want the newest two", got)
+	}
+}
+
+func TestPruneWithoutPolicyKeepsEverything(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngineWithOptions(t, store.Options{Distiller: noFacts{}})
+	observeAt(t, m, "ancient", time.Now().AddDate(-10, 0, 0))
+	if err := m.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if report, err := m.Prune(ctx); err != nil || report != (store.PruneReport{}) {
+		t.Fatalf("Prune = %+v, %v; want nothing removed", report, err)
+	}
+}
+
+func TestPruneDropsStaleFacts(t *testing.T) {
+	ctx := context.Background()
+	facts := []model.Triple{
+		{Subject: "alice", Predicate: "works_at", Object: "acme", Confidence: 0.9},
+		{Subject: "alice", Predicate: "notes", Object: "maybe", Confidence: 0.3},
+		{Subject: "alice", Predicate: "knows", Object: "bob", Confidence: 0.3},
+	}
+	for _, tt := range []struct {
+		name string
+		opt  store.Options
+		want int64
+	}{
+		{"no policy", store.Options{}, 0},
+		// any age counts as stale
+		{"low confidence", store.Options{FactPruneAge: time.Nanosecond, FactPruneConfidence: 0.5}, 2},
+		{"one predicate", store.Options{FactPruneAge: time.Nanosecond, FactPruneConfidence: 0.5, FactPrunePredicate: "notes"}, 1},
+	} {
+		m := storetest.NewTestEngineWithOptions(t, tt.opt)
+		if _, err := m.Assert(ctx, slices.Clone(facts)); err != nil {
+			t.Fatal(err)
+		}
+		report, err := m.Prune(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Facts != tt.want || namespaceFacts(t, m, "") != len(facts)-int(tt.want) {
+			t.Errorf("%s: pruned %d facts, want %d", tt.name, report.Facts, tt.want)
+		}
+	}
+
+	m := storetest.NewTestEngine(t)
+	if _, err := m.PruneFacts(ctx, graph.PruneParams{MaxConfidence: 0.5}); !errors.Is(err, store.ErrInvalidInput) {
+		t.Errorf("PruneFacts without an age: %v, want ErrInvalidInput", err)
+	}
+	if _, err := m.PruneFacts(ctx, graph.PruneParams{Namespace: "a b", MaxAge: time.Hour, MaxConfidence: 0.5}); !errors.Is(err, store.ErrInvalidInput) {
+		t.Errorf("PruneFacts in a malformed namespace: %v, want ErrInvalidInput", err)
+	}
+}
+
+func TestDeleteLogsDropsBufferedInputs(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngineWithOptions(t, store.Options{ConsolidateFillRatio: -1})
+	for _, in := range []model.SensoryInput{
+		{Content: "Alice works at Acme.", Source: "chat"},
+		{Content: "Bob lives in Berlin.", Source: "mail"},
+	} {
+		if err := m.Observe(ctx, in); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := m.DeleteLogs(ctx, sqlite.DeleteParams{Source: "chat"}, false); err != nil || n != 1 {
+		t.Fatalf("DeleteLogs(chat) = %d, %v; want 1", n, err)
+	}
+	if err := m.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	res, err := m.ListFacts(ctx, graph.ListParams{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Triples) != 1 || res.Triples[0].Subject != "bob" {
+		t.Errorf("facts = %+v, want only bob's: the deleted log was distilled", res.Triples)
+	}
+	if got := logContents(t, m); !slices.Equal(got, []string{"Bob lives in Berlin."}) {
+		t.Errorf("logs left = %q", got)
+	}
+}
+
+func TestDeleteLogsRejects(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngine(t)
+	now := time.Now()
+	for name, p := range map[string]sqlite.DeleteParams{
+		"no filter":           {},
+		"after equals before": {Before: now, After: now},
+		"after later":         {Before: now, After: now.Add(time.Hour)},
+		"malformed namespace": {Namespace: "a b", Source: "chat"},
+	} {
+		if _, err := m.DeleteLogs(ctx, p, false); !errors.Is(err, store.ErrInvalidInput) {
+			t.Errorf("%s: %v, want ErrInvalidInput", name, err)
+		}
+	}
+	if _, err := m.DeleteLogs(ctx, sqlite.DeleteParams{}, true); err != nil {
+		t.Errorf("DeleteLogs of everything with all set: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+func TestExpandSessions(t *testing.T) {
+	ctx := context.Background()
+	m, err := NewMemoryEngine(ctx, Options{DBPath: MemoryPath, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var inputs []model.SensoryInput
+	for i := 0; i < 7; i++ {
+		inputs = append(inputs, model.SensoryInput{Content: fmt.Sprintf("s1-%d", i), SessionID: "s1", Timestamp: at.Add(time.Duration(i) * time.Minute)})
+	}
+	inputs = append(inputs,
+		model.SensoryInput{Content: "s2-0", SessionID: "s2", Timestamp: at},
+		model.SensoryInput{Content: "s2-1", SessionID: "s2", Timestamp: at.Add(time.Minute)},
+		model.SensoryInput{Content: "s1-elsewhere", SessionID: "s1", Namespace: "work", Timestamp: at},
+		model.SensoryInput{Content: "loose", Timestamp: at},
+	)
+	ids, _, err := m.db.InsertLogs(ctx, inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// hits in rank order: s2 first, then two s1 entries whose windows
+	// overlap at s1-3, and a log without a session
+	hits, err := m.db.FetchLogs(ctx, []string{ids[8], ids[1], ids[4], ids[10]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID := make(map[string]model.LogEntry)
+	for _, h := range hits {
+		byID[h.ID] = h
+	}
+	ordered := []model.LogEntry{byID[ids[8]], byID[ids[1]], byID[ids[4]], byID[ids[10]]}
+
+	sessions, err := m.expandSessions(ctx, ordered, model.DefaultNamespace, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, s := range sessions {
+		var contents []string
+		for _, l := range s.Logs {
+			contents = append(contents, l.Content)
+		}
+		got = append(got, s.SessionID+":"+strings.Join(contents, ","))
+	}
+	want := []string{"s2:s2-0,s2-1", "s1:s1-0,s1-1,s1-2,s1-3,s1-4,s1-5"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("sessions = %q, want %q", got, want)
+	}
+}
+
+func TestSessionLimits(t *testing.T) {
+	ctx := context.Background()
+	m, err := NewMemoryEngine(ctx, Options{DBPath: MemoryPath, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if err := m.Observe(ctx, model.SensoryInput{Content: "x", SessionID: strings.Repeat("s", maxSessionIDLen+1)}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Observe with an overlong session id: %v, want ErrInvalidInput", err)
+	}
+	if err := m.Observe(ctx, model.SensoryInput{Content: "x", SessionID: strings.Repeat("s", maxSessionIDLen)}); err != nil {
+		t.Errorf("Observe with a session id at the limit: %v", err)
+	}
+	for _, window := range []int{-1, m.maxTopK + 1} {
+		if _, err := m.RecallWithOptions(ctx, "x", model.RecallOptions{TopK: 1, ExpandSessions: true, SessionWindow: window}); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("recall with session window %d: %v, want ErrInvalidInput", window, err)
+		}
+	}
+}
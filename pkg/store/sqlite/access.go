@@ -0,0 +1,65 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+)
+
+// AccessBatch is the recall accesses RecordAccess writes: how many recalls
+// returned each log and triple since the last batch.
+type AccessBatch struct {
+	Logs    map[string]int
+	Triples map[int64]int
+	At      time.Time
+	// ReinforceStep is added to the confidence of a triple for every
+	// access, up to ReinforceCap; triples already at or above the cap keep
+	// their confidence. Zero leaves confidence alone.
+	ReinforceStep float64
+	ReinforceCap  float64
+}
+
+// RecordAccess adds the batch counts to the access_count of logs and
+// triples, sets their last_accessed_at and reinforces the triples, in one
+// write transaction. IDs that no longer exist are ignored.
+func (d *Database) RecordAccess(ctx context.Context, b AccessBatch) error {
+	if len(b.Logs) == 0 && len(b.Triples) == 0 {
+		return nil
+	}
+	ts := b.At.UTC().Format(TimeLayout)
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	logStmt, err := tx.PrepareContext(ctx, `
+        UPDATE memory_logs SET access_count = access_count + ?, last_accessed_at = ? WHERE id = ?;
+    `)
+	if err != nil {
+		return err
+	}
+	defer logStmt.Close()
+	for id, n := range b.Logs {
+		if _, err := logStmt.ExecContext(ctx, n, ts, id); err != nil {
+			return err
+		}
+	}
+
+	tripleStmt, err := tx.PrepareContext(ctx, `
+        UPDATE triples SET
+            access_count = access_count + ?1,
+            last_accessed_at = ?2,
+            confidence = CASE WHEN confidence < ?4 THEN MIN(?4, confidence + ?1 * ?3) ELSE confidence END
+        WHERE id = ?5;
+    `)
+	if err != nil {
+		return err
+	}
+	defer tripleStmt.Close()
+	for id, n := range b.Triples {
+		if _, err := tripleStmt.ExecContext(ctx, n, ts, b.ReinforceStep, b.ReinforceCap, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,105 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+type accessRow struct {
+	count      int
+	at         sql.NullTime
+	confidence float64
+}
+
+func tripleAccess(t *testing.T, d *Database, id int64) accessRow {
+	t.Helper()
+	var r accessRow
+	if err := d.db.QueryRow(`SELECT access_count, last_accessed_at, confidence FROM triples WHERE id = ?`, id).Scan(&r.count, &r.at, &r.confidence); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// insertTriples stores a triple of each confidence and returns their ids.
+func insertTriples(t *testing.T, d *Database, confidences ...float64) []int64 {
+	t.Helper()
+	var ids []int64
+	for _, conf := range confidences {
+		res, err := d.db.Exec(`INSERT INTO triples(subject, predicate, object, confidence) VALUES ('s', 'p', ?, ?)`, conf, conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestRecordAccess(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t, Config{Path: MemoryPath})
+	ids, _, err := d.InsertLogs(ctx, []model.SensoryInput{{Content: "a"}, {Content: "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	triples := insertTriples(t, d, 0.5, 0.8)
+
+	at := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, b := range []AccessBatch{
+		{Logs: map[string]int{ids[0]: 2, "missing": 1}, Triples: map[int64]int{triples[0]: 3, 9999: 1}, At: at.Add(-time.Hour)},
+		{Logs: map[string]int{ids[0]: 1}, Triples: map[int64]int{triples[0]: 1}, At: at},
+		{},
+	} {
+		if err := d.RecordAccess(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	logs, err := d.FetchLogs(ctx, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range logs {
+		switch {
+		case l.ID == ids[0] && (l.AccessCount != 3 || l.LastAccessedAt == nil || !l.LastAccessedAt.Equal(at)):
+			t.Errorf("accessed log: count %d at %v, want 3 at %v", l.AccessCount, l.LastAccessedAt, at)
+		case l.ID == ids[1] && (l.AccessCount != 0 || l.LastAccessedAt != nil):
+			t.Errorf("untouched log: count %d at %v", l.AccessCount, l.LastAccessedAt)
+		}
+	}
+	if got := tripleAccess(t, d, triples[0]); got.count != 4 || !got.at.Time.Equal(at) || got.confidence != 0.5 {
+		t.Errorf("accessed triple = %+v, want 4 accesses at %v and its confidence unchanged", got, at)
+	}
+	if got := tripleAccess(t, d, triples[1]); got.count != 0 || got.at.Valid {
+		t.Errorf("untouched triple = %+v", got)
+	}
+}
+
+func TestRecordAccessReinforces(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t, Config{Path: MemoryPath})
+	triples := insertTriples(t, d, 0.5, 0.95, 0.85)
+	b := AccessBatch{
+		Triples:       map[int64]int{triples[0]: 3, triples[1]: 1, triples[2]: 4},
+		At:            time.Now(),
+		ReinforceStep: 0.1,
+		ReinforceCap:  0.9,
+	}
+	if err := d.RecordAccess(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	// 0.5 + 3*0.1; above the cap already; 0.85 + 4*0.1 capped
+	for i, want := range []float64{0.8, 0.95, 0.9} {
+		if got := tripleAccess(t, d, triples[i]).confidence; math.Abs(got-want) > 1e-9 {
+			t.Errorf("triple %d confidence = %v, want %v", i, got, want)
+		}
+	}
+}
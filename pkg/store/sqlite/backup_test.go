@@ -0,0 +1,66 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupCopiesEveryRow(t *testing.T) {
+	ctx := context.Background()
+	src := openTestDB(t, Config{Path: filepath.Join(t.TempDir(), "src.db"), MaintenanceInterval: -1})
+	for _, stmt := range []string{
+		`INSERT INTO memory_logs(id, content) VALUES ('log-1', 'a'), ('log-2', 'b'), ('log-3', 'c');`,
+		`INSERT INTO triples(subject, predicate, object) VALUES ('alice', 'likes', 'tea'), ('bob', 'likes', 'coffee');`,
+		`INSERT INTO triple_sources(triple_id, log_id) VALUES (1, 'log-1'), (2, 'log-2');`,
+	} {
+		if _, err := src.Writer().ExecContext(ctx, stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dest := filepath.Join(t.TempDir(), "backup.db")
+	if err := src.Backup(ctx, dest); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Backup(ctx, dest); err == nil {
+		t.Fatal("Backup overwrote an existing file")
+	}
+
+	copied := openTestDB(t, Config{Path: dest, MaintenanceInterval: -1})
+	if copied.SchemaVersion() != src.SchemaVersion() {
+		t.Fatalf("backup schema version = %d, want %d", copied.SchemaVersion(), src.SchemaVersion())
+	}
+	for _, table := range []string{"memory_logs", "triples", "triple_sources", "schema_migrations"} {
+		var want, got int
+		if err := src.Reader().QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table).Scan(&want); err != nil {
+			t.Fatal(err)
+		}
+		if err := copied.Reader().QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: %d rows in the backup, want %d", table, got, want)
+		}
+	}
+}
+
+func TestBackupOfAnInMemoryDatabase(t *testing.T) {
+	ctx := context.Background()
+	src := openTestDB(t, Config{Path: MemoryPath})
+	if _, err := src.Writer().ExecContext(ctx, `INSERT INTO memory_logs(id, content) VALUES ('log-1', 'a');`); err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(t.TempDir(), "backup.db")
+	if err := src.Backup(ctx, dest); err != nil {
+		t.Fatal(err)
+	}
+	copied := openTestDB(t, Config{Path: dest, MaintenanceInterval: -1})
+	var n int
+	if err := copied.Reader().QueryRowContext(ctx, `SELECT COUNT(*) FROM memory_logs`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("%d logs in the backup, want 1", n)
+	}
+}
@@ -0,0 +1,166 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var (
+	// ErrEncryptionUnsupported is returned by New when Config.EncryptionKey
+	// is set but the SQLite linked into the binary is not SQLCipher, which
+	// would silently write the database in the clear.
+	ErrEncryptionUnsupported = errors.New("encryption needs SQLite built with SQLCipher")
+	// ErrWrongKey is returned by New when Config.EncryptionKey does not
+	// decrypt the database.
+	ErrWrongKey = errors.New("wrong encryption key")
+	// ErrKeyRequired is returned by New when the file cannot be read without
+	// a key: it is encrypted, or not a SQLite database at all.
+	ErrKeyRequired = errors.New("database is encrypted or not a SQLite database; an encryption key is required")
+)
+
+// IsKeyError reports whether err is one of the encryption errors of New.
+func IsKeyError(err error) bool {
+	return errors.Is(err, ErrEncryptionUnsupported) || errors.Is(err, ErrWrongKey) || errors.Is(err, ErrKeyRequired)
+}
+
+// cipher holds the key of an encrypted database. Rekey changes it and bumps
+// gen, so connections keyed before are dropped by the pools and reopened
+// with the new key.
+type cipher struct {
+	mu  sync.RWMutex
+	key string
+	gen atomic.Uint64
+}
+
+// hook returns the ConnectHook of an encrypted database. PRAGMA key must run
+// before anything reads the file, so pragmas that do, such as the journal
+// mode, are left out of the DSN and passed here to run once the key is
+// checked.
+func (c *cipher) hook(pragmas []string) func(*sqlite3.SQLiteConn) error {
+	return func(conn *sqlite3.SQLiteConn) error {
+		c.mu.RLock()
+		key := c.key
+		c.mu.RUnlock()
+		if _, err := conn.Exec(`PRAGMA key = `+quoteLiteral(key)+`;`, nil); err != nil {
+			return err
+		}
+		version, err := cipherVersion(conn)
+		if err != nil {
+			return err
+		}
+		if version == "" {
+			return ErrEncryptionUnsupported
+		}
+		if _, err := conn.Exec(`SELECT count(*) FROM sqlite_master;`, nil); err != nil {
+			if isNotADB(err) {
+				return ErrWrongKey
+			}
+			return err
+		}
+		for _, p := range pragmas {
+			if _, err := conn.Exec(p, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// cipherVersion returns the SQLCipher version, or "" for plain SQLite,
+// which ignores the pragma.
+func cipherVersion(conn *sqlite3.SQLiteConn) (string, error) {
+	rows, err := conn.Query(`PRAGMA cipher_version;`, nil)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	dest := make([]driver.Value, 1)
+	if err := rows.Next(dest); err != nil {
+		if errors.Is(err, io.EOF) {
+			return "", nil
+		}
+		return "", err
+	}
+	s, _ := dest[0].(string)
+	return s, nil
+}
+
+// keyedConn is a connection of an encrypted database, keyed at generation
+// gen of its cipher.
+type keyedConn struct {
+	*sqlite3.SQLiteConn
+	gen    uint64
+	cipher *cipher
+}
+
+// IsValid drops the connection from the pool once a Rekey made its key
+// stale.
+func (c *keyedConn) IsValid() bool {
+	return c.gen == c.cipher.gen.Load()
+}
+
+// ResetSession keeps a stale connection from being reused.
+func (c *keyedConn) ResetSession(context.Context) error {
+	if !c.IsValid() {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+// Rekey re-encrypts the database with newKey. It runs on the writer
+// connection; read connections keyed with the old key are replaced as they
+// return to the pool, so a read racing with Rekey may fail once.
+func (d *Database) Rekey(ctx context.Context, newKey string) error {
+	switch {
+	case d.cipher == nil:
+		return errors.New("database is not encrypted")
+	case d.readOnly:
+		return errors.New("database is read-only")
+	case newKey == "":
+		return errors.New("new encryption key is required")
+	}
+	// taken before locking, as opening a connection needs the key
+	conn, err := d.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	d.cipher.mu.Lock()
+	defer d.cipher.mu.Unlock()
+	if _, err := conn.ExecContext(ctx, `PRAGMA rekey = `+quoteLiteral(newKey)+`;`); err != nil {
+		return fmt.Errorf("rekey: %w", err)
+	}
+	d.cipher.key = newKey
+	d.cipher.gen.Add(1)
+	d.logger.Info("database re-encrypted with a new key")
+	return nil
+}
+
+// keyError turns the SQLITE_NOTADB error of opening an encrypted database
+// without a key into ErrKeyRequired.
+func keyError(err error, keyed bool) error {
+	if keyed || !isNotADB(err) {
+		return err
+	}
+	return fmt.Errorf("%w (%v)", ErrKeyRequired, err)
+}
+
+func isNotADB(err error) bool {
+	var se sqlite3.Error
+	return errors.As(err, &se) && se.Code == sqlite3.ErrNotADB
+}
+
+// quoteLiteral quotes s as an SQL string literal; PRAGMA key does not take
+// bound parameters.
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,82 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// plainHeader starts every unencrypted SQLite database file.
+var plainHeader = []byte("SQLite format 3\x00")
+
+// With a key the database is either encrypted or not opened at all,
+// whichever SQLite the binary links: it is never written in the clear.
+func TestKeyedDatabaseIsNeverPlain(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "paim.db")
+	d, err := New(ctx, Config{Path: path, EncryptionKey: "s3cret", MaintenanceInterval: -1, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if errors.Is(err, ErrEncryptionUnsupported) {
+		if !IsKeyError(err) {
+			t.Errorf("IsKeyError(%v) = false", err)
+		}
+	} else {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.InsertLog(ctx, model.SensoryInput{Content: "Alice works at Acme."}); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	if bytes.HasPrefix(data, plainHeader) || bytes.Contains(data, []byte("Alice works at Acme.")) {
+		t.Error("keyed database written in the clear")
+	}
+}
+
+func TestUnreadableFileAsksForAKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "paim.db")
+	if err := os.WriteFile(path, bytes.Repeat([]byte{0x5a}, 4096), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := New(context.Background(), Config{Path: path, MaintenanceInterval: -1, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if !errors.Is(err, ErrKeyRequired) || !IsKeyError(err) {
+		t.Errorf("New on a file that is not a plain database = %v, want ErrKeyRequired", err)
+	}
+}
+
+func TestRekeyNeedsAnEncryptedDatabase(t *testing.T) {
+	d := openTestDB(t, Config{Path: MemoryPath})
+	if err := d.Rekey(context.Background(), "new"); err == nil {
+		t.Error("rekeyed a plain database")
+	}
+	if d.Encrypted() {
+		t.Error("plain database reports encryption")
+	}
+}
+
+func TestQuoteLiteral(t *testing.T) {
+	for in, want := range map[string]string{
+		"":        "''",
+		"key":     "'key'",
+		"it's":    "'it''s'",
+		"'; --":   "'''; --'",
+		`a"b\c''`: `'a"b\c'''''`,
+	} {
+		if got := quoteLiteral(in); got != want {
+			t.Errorf("quoteLiteral(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
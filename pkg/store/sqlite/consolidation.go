@@ -0,0 +1,70 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// RecordConsolidationRun adds run to the consolidation history, setting its
+// ID, and deletes all but the keep latest runs in the same transaction;
+// keep <= 0 keeps every run.
+func (d *Database) RecordConsolidationRun(ctx context.Context, run *model.ConsolidationRun, keep int) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `
+        INSERT INTO consolidation_runs(started_at, finished_at, inputs, triples_written, error)
+        VALUES (?, ?, ?, ?, ?);
+    `, run.StartedAt.UTC(), run.FinishedAt.UTC(), run.Inputs, run.TriplesWritten, sql.NullString{String: run.Error, Valid: run.Error != ""})
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if keep > 0 {
+		if _, err := tx.ExecContext(ctx, `
+            DELETE FROM consolidation_runs
+            WHERE id <= (SELECT id FROM consolidation_runs ORDER BY id DESC LIMIT 1 OFFSET ?);
+        `, keep); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	run.ID = id
+	return nil
+}
+
+// ConsolidationRuns returns up to limit runs of the consolidation history,
+// latest first.
+func (d *Database) ConsolidationRuns(ctx context.Context, limit int) ([]model.ConsolidationRun, error) {
+	rows, err := d.reader.QueryContext(ctx, `
+        SELECT id, started_at, finished_at, inputs, triples_written, error
+        FROM consolidation_runs
+        ORDER BY id DESC
+        LIMIT ?;
+    `, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []model.ConsolidationRun
+	for rows.Next() {
+		var r model.ConsolidationRun
+		var msg sql.NullString
+		if err := rows.Scan(&r.ID, &r.StartedAt, &r.FinishedAt, &r.Inputs, &r.TriplesWritten, &msg); err != nil {
+			return nil, err
+		}
+		r.Error = msg.String
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
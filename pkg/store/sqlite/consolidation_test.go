@@ -0,0 +1,73 @@
+package sqlite
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+func TestConsolidationRunsKeepTheLatest(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t, Config{Path: MemoryPath})
+	start := time.Date(2026, 6, 1, 3, 0, 0, 0, time.UTC)
+	record := func(i, keep int, msg string) *model.ConsolidationRun {
+		t.Helper()
+		run := &model.ConsolidationRun{
+			StartedAt:  start.Add(time.Duration(i) * time.Minute),
+			FinishedAt: start.Add(time.Duration(i)*time.Minute + time.Second),
+			Inputs:     i, TriplesWritten: 2 * i, Error: msg,
+		}
+		if err := d.RecordConsolidationRun(ctx, run, keep); err != nil {
+			t.Fatal(err)
+		}
+		return run
+	}
+	inputs := func(runs []model.ConsolidationRun) []int {
+		var out []int
+		for _, r := range runs {
+			out = append(out, r.Inputs)
+		}
+		return out
+	}
+
+	if runs, err := d.ConsolidationRuns(ctx, 10); err != nil || len(runs) != 0 {
+		t.Fatalf("runs of a new database = %v, %v", runs, err)
+	}
+	for i := 1; i <= 5; i++ {
+		record(i, 0, "")
+	}
+	failed := record(6, 0, "distill: model unavailable")
+	if failed.ID == 0 {
+		t.Error("recorded run has no id")
+	}
+
+	runs, err := d.ConsolidationRuns(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := inputs(runs); len(got) != 6 || got[0] != 6 || got[5] != 1 {
+		t.Fatalf("runs = %v, want all six, latest first", got)
+	}
+	if r := runs[0]; r.ID != failed.ID || r.Error != failed.Error || r.TriplesWritten != 12 ||
+		!r.StartedAt.Equal(failed.StartedAt) || !r.FinishedAt.Equal(failed.FinishedAt) {
+		t.Errorf("latest run = %+v, want %+v", r, *failed)
+	}
+	if runs[1].Error != "" {
+		t.Errorf("successful run has error %q", runs[1].Error)
+	}
+	if runs, _ := d.ConsolidationRuns(ctx, 2); len(runs) != 2 || runs[0].Inputs != 6 {
+		t.Errorf("limited runs = %v, want the latest two", inputs(runs))
+	}
+
+	// keeping three deletes the oldest, counting the new run
+	record(7, 3, "")
+	runs, err = d.ConsolidationRuns(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := inputs(runs); len(got) != 3 || got[0] != 7 || got[2] != 5 {
+		t.Errorf("runs after trimming to 3 = %v, want 7, 6, 5", got)
+	}
+}
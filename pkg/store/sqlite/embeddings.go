@@ -0,0 +1,83 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/johncui/PAIM/pkg/store/vector"
+)
+
+// SaveEmbedding stores the embedding of a log computed by model, replacing
+// the one stored before. Vectors are kept as little-endian float32 blobs
+// (vector.EncodeFloat32), whether or not a vector extension is loaded.
+func (d *Database) SaveEmbedding(ctx context.Context, logID, model string, embedding []float64) error {
+	blob, err := vector.EncodeFloat32(embedding)
+	if err != nil {
+		return err
+	}
+	_, err = d.db.ExecContext(ctx, `
+        INSERT INTO `+vector.EmbeddingsTable+`(log_id, model, dim, vector) VALUES (?, ?, ?, ?)
+        ON CONFLICT(log_id) DO UPDATE SET model = excluded.model, dim = excluded.dim, vector = excluded.vector;
+    `, logID, model, len(embedding), blob)
+	return err
+}
+
+// StoredEmbedding returns the stored embedding of a log if model computed
+// it, and nil otherwise.
+func (d *Database) StoredEmbedding(ctx context.Context, logID, model string) ([]float64, error) {
+	var blob []byte
+	err := d.reader.QueryRowContext(ctx, `
+        SELECT vector FROM `+vector.EmbeddingsTable+` WHERE log_id = ? AND model = ?;
+    `, logID, model).Scan(&blob)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return vector.DecodeFloat32(blob)
+}
+
+// CountStoredEmbeddings returns the number of stored embeddings.
+func (d *Database) CountStoredEmbeddings(ctx context.Context) (int64, error) {
+	var n int64
+	err := d.reader.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+vector.EmbeddingsTable+`;`).Scan(&n)
+	return n, err
+}
+
+// StoredVector is a log id with its stored embedding.
+type StoredVector struct {
+	LogID     string
+	Embedding []float64
+}
+
+// RecentEmbeddings returns the stored embeddings computed by model of the
+// newest limit logs of namespace with the given source type, newest first.
+func (d *Database) RecentEmbeddings(ctx context.Context, namespace, source, model string, limit int) ([]StoredVector, error) {
+	rows, err := d.reader.QueryContext(ctx, `
+        SELECT e.log_id, e.vector
+        FROM `+vector.EmbeddingsTable+` e
+        JOIN memory_logs l ON l.id = e.log_id
+        WHERE l.namespace = ? AND l.source_type = ? AND e.model = ?
+        ORDER BY l.timestamp DESC, l.rowid DESC
+        LIMIT ?;
+    `, namespaceOrDefault(namespace), source, model, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []StoredVector
+	for rows.Next() {
+		var v StoredVector
+		var blob []byte
+		if err := rows.Scan(&v.LogID, &blob); err != nil {
+			return nil, err
+		}
+		if v.Embedding, err = vector.DecodeFloat32(blob); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
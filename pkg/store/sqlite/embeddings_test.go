@@ -0,0 +1,54 @@
+package sqlite
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+func TestStoredEmbeddings(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t, Config{Path: MemoryPath})
+	ids, _, err := d.InsertLogs(ctx, []model.SensoryInput{{Content: "a"}, {Content: "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SaveEmbedding(ctx, ids[0], "m1", []float64{1, 0}); err != nil {
+		t.Fatal(err)
+	}
+	// replaced, not added
+	if err := d.SaveEmbedding(ctx, ids[0], "m2", []float64{0.5, 0.25, 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SaveEmbedding(ctx, ids[1], "m2", []float64{1, 1, 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SaveEmbedding(ctx, ids[1], "m2", nil); err == nil {
+		t.Error("saved an empty embedding")
+	}
+
+	got, err := d.StoredEmbedding(ctx, ids[0], "m2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, []float64{0.5, 0.25, 1}) {
+		t.Errorf("stored embedding = %v, want the replacement", got)
+	}
+	for _, lookup := range [][2]string{{ids[0], "m1"}, {"missing", "m2"}} {
+		if got, err := d.StoredEmbedding(ctx, lookup[0], lookup[1]); got != nil || err != nil {
+			t.Errorf("StoredEmbedding(%s, %s) = %v, %v; want nil", lookup[0], lookup[1], got, err)
+		}
+	}
+
+	if n, err := d.CountStoredEmbeddings(ctx); err != nil || n != 2 {
+		t.Errorf("CountStoredEmbeddings = %d, %v; want 2", n, err)
+	}
+	if _, err := d.DeleteLogs(ctx, ids[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := d.CountStoredEmbeddings(ctx); err != nil || n != 1 {
+		t.Errorf("CountStoredEmbeddings after deleting a log = %d, %v; want 1", n, err)
+	}
+}
@@ -0,0 +1,80 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// EachLog calls fn for every log of every namespace in timestamp order. fn must not use the
+// database: the single connection is busy with the open result set.
+func (d *Database) EachLog(ctx context.Context, fn func(model.LogEntry) error) error {
+	rows, err := d.reader.QueryContext(ctx, `
+        SELECT `+logColumns+`
+        FROM memory_logs l
+        ORDER BY l.timestamp, l.rowid;
+    `)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		e, err := scanLog(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ImportLogs inserts logs keeping their ids, timestamps, sessions and
+// namespaces (the default one when unset); logs whose id already exists are skipped. With
+// enqueue set, inserted logs are queued for embedding. It returns how many
+// logs were inserted.
+func (d *Database) ImportLogs(ctx context.Context, logs []model.LogEntry, enqueue bool) (int64, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var inserted int64
+	for _, e := range logs {
+		ts := e.Timestamp
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+		metaBytes, _ := json.Marshal(e.Metadata)
+		var updated sql.NullString
+		if e.UpdatedAt != nil {
+			updated = sql.NullString{String: e.UpdatedAt.UTC().Format(updatedAtLayout), Valid: true}
+		}
+		res, err := tx.ExecContext(ctx, `
+            INSERT OR IGNORE INTO memory_logs(id, timestamp, source_type, content, metadata, namespace, session_id, updated_at, content_hash)
+            VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?);
+        `, e.ID, ts.UTC().Format(TimeLayout), e.SourceType, e.Content, string(metaBytes), namespaceOrDefault(e.Namespace), sessionOrNull(e.SessionID), updated, ContentHash(e.Content))
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			continue
+		}
+		inserted++
+		if enqueue {
+			if _, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO embedding_queue(log_id) VALUES (?)`, e.ID); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return inserted, tx.Commit()
+}
@@ -0,0 +1,64 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// connector opens connections that load extensions, and for an encrypted
+// database apply the key, as part of opening, so every connection the pool
+// creates has them: after a recycle on ConnMaxIdleTime as much as with a
+// larger pool.
+type connector struct {
+	dsn    string
+	driver *sqlite3.SQLiteDriver
+	cipher *cipher
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) {
+	if c.cipher == nil {
+		return c.driver.Open(c.dsn)
+	}
+	// read before opening, so a Rekey racing with it can only make the
+	// connection look older than its key
+	gen := c.cipher.gen.Load()
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &keyedConn{SQLiteConn: conn.(*sqlite3.SQLiteConn), gen: gen, cipher: c.cipher}, nil
+}
+
+func (c connector) Driver() driver.Driver { return c.driver }
+
+// openWithExtension opens dsn with the extension at extPath loaded on every
+// connection. Loading is checked once here so a bad path fails at startup.
+func openWithExtension(ctx context.Context, dsn, extPath string, c *cipher, pragmas ...string) (*sql.DB, error) {
+	if extPath == "" {
+		return nil, errors.New("extension path not provided")
+	}
+	return openDB(ctx, dsn, extPath, c, pragmas...)
+}
+
+// openDB opens dsn through a connector loading the extension at extPath,
+// unless it is empty, and keying connections with c, unless it is nil; see
+// cipher.hook for pragmas. The first connection is opened here.
+func openDB(ctx context.Context, dsn, extPath string, c *cipher, pragmas ...string) (*sql.DB, error) {
+	drv := &sqlite3.SQLiteDriver{}
+	if extPath != "" {
+		drv.Extensions = []string{extPath}
+	}
+	if c != nil {
+		drv.ConnectHook = c.hook(pragmas)
+	}
+	db := sql.OpenDB(connector{dsn: dsn, driver: drv, cipher: c})
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,76 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Extensions are loaded by the driver as each connection opens, like the
+// ConnectHook here, so a connection the pool opens to replace a closed one
+// must go through the connector as well.
+func TestConnectorSetsUpReplacementConnections(t *testing.T) {
+	ctx := context.Background()
+	var opened atomic.Int64
+	drv := &sqlite3.SQLiteDriver{ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+		opened.Add(1)
+		// a per-connection function, as an extension registers
+		return conn.RegisterFunc("paim_probe", func() int64 { return 1 }, true)
+	}}
+	db := sql.OpenDB(connector{dsn: "file:/paim-churn?vfs=memdb", driver: drv})
+	defer db.Close()
+	// no idle connections: every query after the first runs on a fresh one
+	db.SetMaxOpenConns(3)
+	db.SetMaxIdleConns(0)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 3; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				var n int64
+				if err := db.QueryRowContext(ctx, `SELECT paim_probe();`).Scan(&n); err != nil || n != 1 {
+					t.Errorf("paim_probe() = %d, %v", n, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n := opened.Load(); n < 20 {
+		t.Errorf("%d connections opened, want the pool to have replaced them", n)
+	}
+}
+
+func TestMissingExtensionFailsAtOpen(t *testing.T) {
+	ctx := context.Background()
+	dsn := "file:/paim-ext?vfs=memdb"
+	if _, err := openWithExtension(ctx, dsn, "", nil); err == nil {
+		t.Error("opened without an extension path")
+	}
+	missing := filepath.Join(t.TempDir(), "missing.so")
+	if db, err := openWithExtension(ctx, dsn, missing, nil); err == nil {
+		db.Close()
+		t.Errorf("opened with the extension %s missing", missing)
+	}
+
+	t.Setenv("GO_SQLITE3_EXTENSIONS", "")
+	_, err := New(ctx, Config{
+		Path:           filepath.Join(t.TempDir(), "paim.db"),
+		EnableVSS:      true,
+		ExtensionsPath: missing,
+		Logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if !errors.Is(err, ErrVectorUnavailable) {
+		t.Errorf("New with a missing extension = %v, want ErrVectorUnavailable", err)
+	}
+}
@@ -0,0 +1,145 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// LogFilter restricts which logs FetchLogsFiltered returns. Zero-valued
+// fields do not filter.
+type LogFilter struct {
+	// Namespace, when set, keeps only logs of that namespace.
+	Namespace string
+	Source    string
+	Metadata  map[string]string
+	// From and To bound the log timestamp, inclusive.
+	From time.Time
+	To   time.Time
+}
+
+// IsZero reports whether the filter matches every log.
+func (f LogFilter) IsZero() bool {
+	return f.Namespace == "" && f.Source == "" && len(f.Metadata) == 0 && f.From.IsZero() && f.To.IsZero()
+}
+
+// Where returns SQL conditions over the memory_logs table aliased as alias,
+// each prefixed with " AND ", and their arguments.
+func (f LogFilter) Where(alias string) (string, []any) {
+	var b strings.Builder
+	var args []any
+	if f.Namespace != "" {
+		b.WriteString(" AND " + alias + ".namespace = ?")
+		args = append(args, f.Namespace)
+	}
+	if f.Source != "" {
+		b.WriteString(" AND " + alias + ".source_type = ?")
+		args = append(args, f.Source)
+	}
+	if cond, a := TimeRange(alias+".timestamp", f.From, f.To); cond != "" {
+		b.WriteString(cond)
+		args = append(args, a...)
+	}
+	keys := make([]string, 0, len(f.Metadata))
+	for k := range f.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		cond, a := metadataCondition(alias+".metadata", k, f.Metadata[k])
+		b.WriteString(" AND " + cond)
+		args = append(args, a...)
+	}
+	return b.String(), args
+}
+
+// TimeRange returns conditions (each prefixed with " AND ") bounding a
+// DATETIME column to [from, to]; zero bounds are open. Times are compared in
+// UTC at the one-second precision of CURRENT_TIMESTAMP.
+func TimeRange(column string, from, to time.Time) (string, []any) {
+	var b strings.Builder
+	var args []any
+	if !from.IsZero() {
+		b.WriteString(" AND datetime(" + column + ") >= ?")
+		args = append(args, from.UTC().Format(TimeLayout))
+	}
+	if !to.IsZero() {
+		b.WriteString(" AND datetime(" + column + ") <= ?")
+		args = append(args, to.UTC().Format(TimeLayout))
+	}
+	return b.String(), args
+}
+
+// TimeLayout matches SQLite's CURRENT_TIMESTAMP and datetime() output.
+const TimeLayout = "2006-01-02 15:04:05"
+
+// MetadataPath returns the JSON path addressing key in a metadata object.
+// Dots separate the keys of nested objects, so "owner.name" matches
+// {"owner": {"name": ...}}. Every segment is quoted in the path; empty
+// segments and segments containing '"' or '\' are rejected, which keeps
+// keys from rewriting the path.
+func MetadataPath(key string) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("metadata key is empty")
+	}
+	var b strings.Builder
+	b.WriteString("$")
+	for _, seg := range strings.Split(key, ".") {
+		if seg == "" || strings.ContainsAny(seg, `"\`) {
+			return "", fmt.Errorf("invalid metadata key %q", key)
+		}
+		b.WriteString(`."` + seg + `"`)
+	}
+	return b.String(), nil
+}
+
+// metadataCondition returns a JSON1 condition matching metadata[key] == value
+// on a JSON column. Values are compared as text, and JSON booleans match
+// "true"/"false". Keys MetadataPath rejects match nothing.
+//
+// The condition inspects every candidate row's JSON, so it cannot use an
+// index; other conditions (namespace, source, time) narrow the scan first.
+// A key queried often on a large database can be indexed with an expression
+// index, e.g. CREATE INDEX idx_logs_project ON
+// memory_logs(json_extract(metadata, '$."project"')), but only queries
+// written against that exact expression use it.
+func metadataCondition(column, key, value string) (string, []any) {
+	path, err := MetadataPath(key)
+	if err != nil {
+		return "0", nil
+	}
+	return `(CASE json_type(` + column + `, ?)
+            WHEN 'true' THEN 'true' WHEN 'false' THEN 'false'
+            ELSE CAST(json_extract(` + column + `, ?) AS TEXT) END) = ?`,
+		[]any{path, path, value}
+}
+
+// FetchLogsFiltered is FetchLogs restricted to logs matching f.
+func (d *Database) FetchLogsFiltered(ctx context.Context, ids []string, f LogFilter) ([]model.LogEntry, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	cond, condArgs := f.Where("l")
+	query := `SELECT ` + logColumns + ` FROM memory_logs l WHERE l.id IN (` + placeholders(len(ids)) + `)` + cond
+	args := make([]any, 0, len(ids)+len(condArgs))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	args = append(args, condArgs...)
+
+	start := time.Now()
+	rows, err := d.reader.QueryContext(ctx, query, args...)
+	if err != nil {
+		d.logger.Error("fetch logs failed", "ids", len(ids), "err", err)
+		return nil, err
+	}
+	logs, err := scanLogs(rows)
+	if dur := time.Since(start); dur >= slowQuery {
+		d.logger.Warn("slow log fetch", "ids", len(ids), "logs", len(logs), "ms", dur.Milliseconds())
+	}
+	return logs, err
+}
@@ -0,0 +1,69 @@
+package sqlite
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+func TestMetadataPath(t *testing.T) {
+	for key, want := range map[string]string{
+		"channel":       `$."channel"`,
+		"owner.name":    `$."owner"."name"`,
+		"a b.c-d":       `$."a b"."c-d"`,
+		"[0]":           `$."[0]"`,
+		"owner'); DROP": `$."owner'); DROP"`,
+	} {
+		if got, err := MetadataPath(key); err != nil || got != want {
+			t.Errorf("MetadataPath(%q) = %q, %v; want %q", key, got, err, want)
+		}
+	}
+	for _, key := range []string{"", ".", "owner.", ".name", "a..b", `x"y`, `x\y`, `owner."name`} {
+		if got, err := MetadataPath(key); err == nil {
+			t.Errorf("MetadataPath(%q) = %q, want an error", key, got)
+		}
+	}
+}
+
+func TestRecentLogsByMetadata(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t, Config{Path: MemoryPath})
+	if _, _, err := d.InsertLogs(ctx, []model.SensoryInput{
+		{Content: "nested", Metadata: map[string]any{"owner": map[string]any{"name": "alice"}, "urgent": true, "n": 3}},
+		{Content: "flat dotted key", Metadata: map[string]any{"owner.name": "alice", "urgent": false}},
+		{Content: "bob", Metadata: map[string]any{"owner": map[string]any{"name": "bob"}}},
+		{Content: "none"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		filters map[string]string
+		want    []string
+	}{
+		{"nested key", map[string]string{"owner.name": "alice"}, []string{"nested"}},
+		{"true", map[string]string{"urgent": "true"}, []string{"nested"}},
+		{"false", map[string]string{"urgent": "false"}, []string{"flat dotted key"}},
+		{"number as text", map[string]string{"n": "3"}, []string{"nested"}},
+		{"all filters", map[string]string{"owner.name": "alice", "urgent": "false"}, nil},
+		{"missing key", map[string]string{"colour": "red"}, nil},
+		{"invalid key", map[string]string{`owner"name`: "alice"}, nil},
+	} {
+		logs, err := d.RecentLogsFiltered(ctx, 10, LogFilter{Metadata: tt.filters})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []string
+		for _, l := range logs {
+			got = append(got, l.Content)
+		}
+		sort.Strings(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
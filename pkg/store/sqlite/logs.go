@@ -2,64 +2,231 @@ package sqlite
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store/internal/logrow"
+	"github.com/johncui/PAIM/pkg/store/vector"
 )
 
-// InsertLog writes a new memory_log row and returns its id.
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// InsertLog writes a new memory_log row and returns its id, or the id of the
+// stored log it repeats when its source is a unique-content source.
 func (d *Database) InsertLog(ctx context.Context, input model.SensoryInput) (string, error) {
-	if input.Content == "" {
-		return "", fmt.Errorf("content is required")
+	ids, _, err := d.insertLogs(ctx, []model.SensoryInput{input}, false)
+	if err != nil {
+		return "", err
 	}
-	id := uuid.NewString()
-	metaBytes, _ := json.Marshal(input.Metadata)
+	return ids[0], nil
+}
 
-	_, err := d.db.ExecContext(ctx, `
-        INSERT INTO memory_logs(id, timestamp, source_type, content, metadata)
-        VALUES(?, CURRENT_TIMESTAMP, ?, ?, ?);
-    `, id, input.Source, input.Content, string(metaBytes))
+// InsertLogPendingEmbedding writes a memory_log row and enqueues it for
+// embedding in the same transaction, so a log can never exist without either
+// an embedding or a pending queue entry.
+func (d *Database) InsertLogPendingEmbedding(ctx context.Context, input model.SensoryInput) (string, error) {
+	ids, _, err := d.insertLogs(ctx, []model.SensoryInput{input}, true)
 	if err != nil {
 		return "", err
 	}
-	return id, nil
+	return ids[0], nil
+}
+
+const insertLogSQL = `
+        INSERT INTO memory_logs(id, timestamp, source_type, content, metadata, namespace, session_id, content_hash)
+        VALUES(?, COALESCE(?, CURRENT_TIMESTAMP), ?, ?, ?, ?, ?, ?);
+    `
+
+// findContentSQL finds the oldest log of a namespace and source with the
+// given content. The content is compared as well as its hash, so a hash
+// collision cannot merge two different inputs.
+const findContentSQL = `
+        SELECT id FROM memory_logs
+        WHERE content_hash = ? AND namespace = ? AND source_type = ? AND content = ?
+        ORDER BY timestamp, id LIMIT 1;
+    `
+
+// logColumns selects a memory_logs row aliased as l for scanLog.
+const logColumns = logrow.Columns
+
+// ContentHash is the hash of a log's content kept in the content_hash
+// column: the hex SHA-256 of the content. Metadata is not part of it.
+func ContentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// UniqueContent reports whether logs of source are stored exactly once by
+// content (Config.UniqueContentSources).
+func (d *Database) UniqueContent(source string) bool {
+	return d.uniqueSources[source]
+}
+
+// namespaceOrDefault maps the empty namespace to model.DefaultNamespace.
+func namespaceOrDefault(ns string) string {
+	if ns == "" {
+		return model.DefaultNamespace
+	}
+	return ns
+}
+
+// sessionOrNull stores an empty session id as NULL.
+func sessionOrNull(id string) sql.NullString {
+	return sql.NullString{String: id, Valid: id != ""}
+}
+
+// timestampOrNull formats an explicit log timestamp; zero lets the database
+// use the current time.
+func timestampOrNull(t time.Time) sql.NullString {
+	if t.IsZero() {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: t.UTC().Format(TimeLayout), Valid: true}
+}
+
+// InsertLogs writes many memory_log rows in one transaction with a prepared
+// statement and returns their ids in input order. Nothing is stored if any
+// row fails. An input of a unique-content source whose content a stored log
+// of the same namespace and source already has, including an earlier input
+// of the batch, is not stored: its id is that log's and existing[i] is set.
+// Metadata plays no part in the match, so the repeat's metadata is dropped.
+func (d *Database) InsertLogs(ctx context.Context, inputs []model.SensoryInput) (ids []string, existing []bool, err error) {
+	return d.insertLogs(ctx, inputs, false)
+}
+
+// InsertLogsPendingEmbedding is InsertLogs that also enqueues every row it
+// stores for embedding in the same transaction.
+func (d *Database) InsertLogsPendingEmbedding(ctx context.Context, inputs []model.SensoryInput) (ids []string, existing []bool, err error) {
+	return d.insertLogs(ctx, inputs, true)
+}
+
+func (d *Database) insertLogs(ctx context.Context, inputs []model.SensoryInput, enqueue bool) ([]string, []bool, error) {
+	if len(inputs) == 0 {
+		return nil, nil, nil
+	}
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	insert, err := tx.PrepareContext(ctx, insertLogSQL)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer insert.Close()
+	var queue, find *sql.Stmt
+	if enqueue {
+		if queue, err = tx.PrepareContext(ctx, `INSERT INTO embedding_queue(log_id) VALUES (?)`); err != nil {
+			return nil, nil, err
+		}
+		defer queue.Close()
+	}
+	if len(d.uniqueSources) > 0 {
+		if find, err = tx.PrepareContext(ctx, findContentSQL); err != nil {
+			return nil, nil, err
+		}
+		defer find.Close()
+	}
+
+	// wrap names the failing input of a batch
+	wrap := func(i int, err error) error {
+		if len(inputs) > 1 {
+			return fmt.Errorf("input %d: %w", i, err)
+		}
+		return err
+	}
+	ids := make([]string, len(inputs))
+	existing := make([]bool, len(inputs))
+	for i, input := range inputs {
+		if input.Content == "" {
+			return nil, nil, wrap(i, fmt.Errorf("content is required"))
+		}
+		ns := namespaceOrDefault(input.Namespace)
+		hash := ContentHash(input.Content)
+		if find != nil && d.uniqueSources[input.Source] {
+			err := find.QueryRowContext(ctx, hash, ns, input.Source, input.Content).Scan(&ids[i])
+			if err == nil {
+				existing[i] = true
+				continue
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return nil, nil, wrap(i, err)
+			}
+		}
+		ids[i] = uuid.NewString()
+		metaBytes, _ := json.Marshal(input.Metadata)
+		if _, err := insert.ExecContext(ctx, ids[i], timestampOrNull(input.Timestamp), input.Source, input.Content, string(metaBytes), ns, sessionOrNull(input.SessionID), hash); err != nil {
+			return nil, nil, wrap(i, err)
+		}
+		if queue != nil {
+			if _, err := queue.ExecContext(ctx, ids[i]); err != nil {
+				return nil, nil, wrap(i, err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return ids, existing, nil
 }
 
 // FetchLogs retrieves logs by ids preserving order as best-effort.
 func (d *Database) FetchLogs(ctx context.Context, ids []string) ([]model.LogEntry, error) {
-	if len(ids) == 0 {
-		return nil, nil
+	return d.FetchLogsFiltered(ctx, ids, LogFilter{})
+}
+
+// FetchLog retrieves a single log by id. It returns sql.ErrNoRows when the
+// log does not exist.
+func (d *Database) FetchLog(ctx context.Context, id string) (*model.LogEntry, error) {
+	rows, err := d.reader.QueryContext(ctx, `SELECT `+logColumns+` FROM memory_logs l WHERE l.id = ?;`, id)
+	if err != nil {
+		return nil, err
 	}
-	query := `SELECT id, timestamp, source_type, content, metadata FROM memory_logs WHERE id IN (` + placeholders(len(ids)) + `)`
-	args := make([]any, len(ids))
-	for i, id := range ids {
-		args[i] = id
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, sql.ErrNoRows
 	}
-
-	rows, err := d.db.QueryContext(ctx, query, args...)
+	e, err := scanLog(rows)
 	if err != nil {
 		return nil, err
 	}
+	return &e, nil
+}
+
+func scanLogs(rows *sql.Rows) ([]model.LogEntry, error) {
 	defer rows.Close()
 
-	entries := make([]model.LogEntry, 0, len(ids))
+	var entries []model.LogEntry
 	for rows.Next() {
-		var e model.LogEntry
-		var meta sql.NullString
-		if err := rows.Scan(&e.ID, &e.Timestamp, &e.SourceType, &e.Content, &meta); err != nil {
+		e, err := scanLog(rows)
+		if err != nil {
 			return nil, err
 		}
-		if meta.Valid && meta.String != "" {
-			_ = json.Unmarshal([]byte(meta.String), &e.Metadata)
-		}
 		entries = append(entries, e)
 	}
 	return entries, rows.Err()
 }
 
+// scanLog reads the current row of a logColumns query.
+func scanLog(rows *sql.Rows) (model.LogEntry, error) {
+	e, _, err := logrow.Scan(rows)
+	return e, err
+}
+
 func placeholders(n int) string {
 	if n <= 0 {
 		return ""
@@ -76,38 +243,104 @@ func placeholders(n int) string {
 
 // RecentLogs fetches latest logs limited by n.
 func (d *Database) RecentLogs(ctx context.Context, limit int) ([]model.LogEntry, error) {
+	return d.RecentLogsFiltered(ctx, limit, LogFilter{})
+}
+
+// RecentLogsFiltered is RecentLogs restricted to logs matching f.
+func (d *Database) RecentLogsFiltered(ctx context.Context, limit int, f LogFilter) ([]model.LogEntry, error) {
 	if limit <= 0 {
 		limit = 50
 	}
-	rows, err := d.db.QueryContext(ctx, `
-        SELECT id, timestamp, source_type, content, metadata
-        FROM memory_logs
-        ORDER BY timestamp DESC
+	cond, args := f.Where("l")
+	args = append(args, limit)
+	rows, err := d.reader.QueryContext(ctx, `
+        SELECT `+logColumns+`
+        FROM memory_logs l
+        WHERE 1 = 1`+cond+`
+        ORDER BY l.timestamp DESC, l.rowid DESC
         LIMIT ?;
-    `, limit)
+    `, args...)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return scanLogs(rows)
+}
 
-	var out []model.LogEntry
-	for rows.Next() {
-		var e model.LogEntry
-		var meta sql.NullString
-		if err := rows.Scan(&e.ID, &e.Timestamp, &e.SourceType, &e.Content, &meta); err != nil {
+// QueryLogsByMetadata returns the latest logs of every namespace whose
+// metadata holds each key of filters with the given value, newest first.
+// Keys follow MetadataPath, so nested keys are dotted; values are bound as
+// parameters and may contain any character.
+func (d *Database) QueryLogsByMetadata(ctx context.Context, filters map[string]string, limit int) ([]model.LogEntry, error) {
+	if len(filters) == 0 {
+		return nil, fmt.Errorf("at least one metadata filter is required")
+	}
+	for k := range filters {
+		if _, err := MetadataPath(k); err != nil {
 			return nil, err
 		}
-		if meta.Valid && meta.String != "" {
-			_ = json.Unmarshal([]byte(meta.String), &e.Metadata)
-		}
-		out = append(out, e)
 	}
-	return out, rows.Err()
+	return d.RecentLogsFiltered(ctx, limit, LogFilter{Metadata: filters})
 }
 
-// DeleteAllLogs clears logs table.
-func (d *Database) DeleteAllLogs(ctx context.Context) error {
-	_, err := d.db.ExecContext(ctx, `DELETE FROM memory_logs; VACUUM;`)
+// FetchSession returns the logs of a session in chronological order, across
+// namespaces.
+func (d *Database) FetchSession(ctx context.Context, sessionID string) ([]model.LogEntry, error) {
+	return d.FetchSessionFiltered(ctx, sessionID, LogFilter{})
+}
+
+// FetchSessionFiltered is FetchSession restricted to logs matching f.
+func (d *Database) FetchSessionFiltered(ctx context.Context, sessionID string, f LogFilter) ([]model.LogEntry, error) {
+	if sessionID == "" {
+		return nil, nil
+	}
+	cond, args := f.Where("l")
+	rows, err := d.reader.QueryContext(ctx, `
+        SELECT `+logColumns+`
+        FROM memory_logs l
+        WHERE l.session_id = ?`+cond+`
+        ORDER BY l.timestamp, l.rowid;
+    `, append([]any{sessionID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanLogs(rows)
+}
+
+// CountLogs returns the number of memory logs across all namespaces.
+func (d *Database) CountLogs(ctx context.Context) (int64, error) {
+	var n int64
+	err := d.reader.QueryRowContext(ctx, `SELECT COUNT(*) FROM memory_logs;`).Scan(&n)
+	return n, err
+}
+
+// DeleteAllLogs clears the logs of a namespace together with their
+// embedding queue entries and, when vector search is enabled, their stored
+// vectors. Other namespaces are left untouched.
+func (d *Database) DeleteAllLogs(ctx context.Context, namespace string) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	const logs = `SELECT id FROM memory_logs WHERE namespace = ?`
+	stmts := []string{`DELETE FROM embedding_queue WHERE log_id IN (` + logs + `);`}
+	if d.enableVSS {
+		stmts = append(stmts,
+			`DELETE FROM `+d.backend.Table()+` WHERE rowid IN (SELECT rowid FROM `+vector.PayloadTable+` WHERE log_id IN (`+logs+`));`,
+			`DELETE FROM `+vector.PayloadTable+` WHERE log_id IN (`+logs+`);`)
+	}
+	stmts = append(stmts, `DELETE FROM memory_logs WHERE namespace = ?;`)
+	namespace = namespaceOrDefault(namespace)
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt, namespace); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	_, err = d.db.ExecContext(ctx, `VACUUM;`)
 	return err
 }
 
@@ -0,0 +1,285 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+func TestInsertLogsKeepsInputOrder(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t, Config{Path: MemoryPath})
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	inputs := []model.SensoryInput{
+		{Content: "first", Source: "chat", Timestamp: at},
+		{Content: "second", Source: "mail", Metadata: map[string]any{"k": "v"}},
+		{Content: "third", Source: "chat", Namespace: "work", SessionID: "s1"},
+	}
+	ids, existing, err := d.InsertLogs(ctx, inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 || len(existing) != 3 {
+		t.Fatalf("InsertLogs = %q, %v", ids, existing)
+	}
+	logs, err := d.FetchLogs(ctx, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID := make(map[string]model.LogEntry, len(logs))
+	for _, l := range logs {
+		byID[l.ID] = l
+	}
+	for i, id := range ids {
+		if existing[i] {
+			t.Errorf("input %d reported as existing", i)
+		}
+		if got := byID[id]; got.Content != inputs[i].Content || got.SourceType != inputs[i].Source {
+			t.Errorf("id %d = %+v, want input %q", i, got, inputs[i].Content)
+		}
+	}
+	if got := byID[ids[0]].Timestamp; !got.Equal(at) {
+		t.Errorf("explicit timestamp stored as %v, want %v", got, at)
+	}
+	if got := byID[ids[2]]; got.Namespace != "work" || got.SessionID != "s1" {
+		t.Errorf("third log = %+v, want namespace work and session s1", got)
+	}
+	if got := byID[ids[1]].Namespace; got != model.DefaultNamespace {
+		t.Errorf("namespace = %q, want the default", got)
+	}
+}
+
+func TestInsertLogsIsAllOrNothing(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t, Config{Path: MemoryPath})
+	_, _, err := d.InsertLogsPendingEmbedding(ctx, []model.SensoryInput{
+		{Content: "ok"}, {Content: ""}, {Content: "never reached"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "input 1") {
+		t.Fatalf("InsertLogs = %v, want an error naming input 1", err)
+	}
+	if n, err := d.CountLogs(ctx); err != nil || n != 0 {
+		t.Fatalf("%d logs after a failed batch, %v; want none", n, err)
+	}
+	if n, err := d.PendingEmbeddingCount(ctx); err != nil || n != 0 {
+		t.Fatalf("%d queued after a failed batch, %v; want none", n, err)
+	}
+
+	ids, _, err := d.InsertLogsPendingEmbedding(ctx, []model.SensoryInput{{Content: "a"}, {Content: "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := d.PendingEmbeddingCount(ctx); err != nil || n != int64(len(ids)) {
+		t.Fatalf("%d queued, %v; want every stored log", n, err)
+	}
+}
+
+func TestInsertLogsUniqueContent(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t, Config{Path: MemoryPath, UniqueContentSources: []string{"doc"}})
+	first, _, err := d.InsertLogs(ctx, []model.SensoryInput{{Content: "readme", Source: "doc"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, existing, err := d.InsertLogs(ctx, []model.SensoryInput{
+		{Content: "readme", Source: "doc"},
+		{Content: "readme", Source: "chat"},
+		{Content: "readme", Source: "doc", Namespace: "work"},
+		{Content: "changelog", Source: "doc"},
+		{Content: "changelog", Source: "doc"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantExisting := []bool{true, false, false, false, true}
+	for i, want := range wantExisting {
+		if existing[i] != want {
+			t.Errorf("existing[%d] = %v, want %v", i, existing[i], want)
+		}
+	}
+	if ids[0] != first[0] || ids[4] != ids[3] {
+		t.Errorf("repeats = %q, want the ids of the logs they repeat", ids)
+	}
+	if n, err := d.CountLogs(ctx); err != nil || n != 4 {
+		t.Errorf("%d logs, %v; want 4", n, err)
+	}
+}
+
+func TestUpdateLogRehashesContent(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t, Config{Path: MemoryPath, UniqueContentSources: []string{"doc"}})
+	ids, _, err := d.InsertLogs(ctx, []model.SensoryInput{{Content: "draft", Source: "doc"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	final := "final"
+	if err := d.UpdateLog(ctx, ids[0], LogPatch{Content: &final}); err != nil {
+		t.Fatal(err)
+	}
+	again, existing, err := d.InsertLogs(ctx, []model.SensoryInput{{Content: "final", Source: "doc"}, {Content: "draft", Source: "doc"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !existing[0] || again[0] != ids[0] {
+		t.Errorf("the edited content = %s (existing %v), want a repeat of %s", again[0], existing[0], ids[0])
+	}
+	if existing[1] {
+		t.Error("the content replaced by the edit still counts as stored")
+	}
+}
+
+func benchmarkInputs(n int) []model.SensoryInput {
+	inputs := make([]model.SensoryInput, n)
+	for i := range inputs {
+		inputs[i] = model.SensoryInput{Content: fmt.Sprintf("log %d", i), Source: "bench"}
+	}
+	return inputs
+}
+
+// BenchmarkInsertLogs compares one 1000-row InsertLogs with 1000 InsertLog
+// calls, each a transaction of its own.
+func BenchmarkInsertLogs(b *testing.B) {
+	inputs := benchmarkInputs(1000)
+	open := func(b *testing.B) *Database {
+		d, err := New(context.Background(), Config{
+			Path:                filepath.Join(b.TempDir(), "paim.db"),
+			MaintenanceInterval: -1,
+			Logger:              slog.New(slog.NewTextHandler(io.Discard, nil)),
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Cleanup(func() { d.Close() })
+		return d
+	}
+	b.Run("batch", func(b *testing.B) {
+		d := open(b)
+		for i := 0; i < b.N; i++ {
+			if _, _, err := d.InsertLogs(context.Background(), inputs); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("loop", func(b *testing.B) {
+		d := open(b)
+		for i := 0; i < b.N; i++ {
+			for _, in := range inputs {
+				if _, err := d.InsertLog(context.Background(), in); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+func TestDeleteAllLogsClearsTheEmbeddingQueue(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t, Config{Path: MemoryPath})
+	if _, _, err := d.InsertLogsPendingEmbedding(ctx, []model.SensoryInput{{Content: "a"}, {Content: "b"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DeleteAllLogs(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := d.CountLogs(ctx); err != nil || n != 0 {
+		t.Errorf("CountLogs = %d, %v; want 0", n, err)
+	}
+	if n, err := d.PendingEmbeddingCount(ctx); err != nil || n != 0 {
+		t.Errorf("PendingEmbeddingCount = %d, %v; want 0", n, err)
+	}
+}
+
+func TestFetchSession(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t, Config{Path: MemoryPath})
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	// inserted out of order; the session is read back by timestamp
+	if _, _, err := d.InsertLogs(ctx, []model.SensoryInput{
+		{Content: "third", SessionID: "s1", Timestamp: at.Add(2 * time.Minute)},
+		{Content: "first", SessionID: "s1", Timestamp: at},
+		{Content: "other session", SessionID: "s2", Timestamp: at},
+		{Content: "no session", Timestamp: at},
+		{Content: "second", SessionID: "s1", Namespace: "work", Timestamp: at.Add(time.Minute)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	logs, err := d.FetchSession(ctx, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, l := range logs {
+		got = append(got, l.Content)
+	}
+	if strings.Join(got, ",") != "first,second,third" {
+		t.Errorf("session s1 = %q, want first, second and third across namespaces", got)
+	}
+
+	logs, err = d.FetchSessionFiltered(ctx, "s1", LogFilter{Namespace: "work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || logs[0].Content != "second" {
+		t.Errorf("session s1 in work = %+v, want the second entry only", logs)
+	}
+
+	for _, id := range []string{"", "missing"} {
+		if logs, err := d.FetchSession(ctx, id); err != nil || len(logs) != 0 {
+			t.Errorf("FetchSession(%q) = %+v, %v; want nothing", id, logs, err)
+		}
+	}
+}
+
+func TestFetchLogAndEmbeddingState(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t, Config{Path: MemoryPath})
+	ids, _, err := d.InsertLogsPendingEmbedding(ctx, []model.SensoryInput{{Content: "hello", Namespace: "work"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := ids[0]
+	l, err := d.FetchLog(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Content != "hello" || l.Namespace != "work" {
+		t.Errorf("FetchLog = %+v, want the work log", l)
+	}
+	if _, err := d.FetchLog(ctx, "missing"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("FetchLog of a missing id: %v, want sql.ErrNoRows", err)
+	}
+
+	state := func() EmbeddingState {
+		t.Helper()
+		st, err := d.LogEmbeddingState(ctx, id, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return st
+	}
+	if st := state(); !st.Queued || st.Attempts != 0 || st.Indexed {
+		t.Errorf("state of a new log = %+v, want queued without attempts", st)
+	}
+	if err := d.FailEmbedding(ctx, id, errors.New("embedder down"), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if st := state(); !st.Queued || st.Attempts != 1 || st.LastError != "embedder down" {
+		t.Errorf("state after a failure = %+v, want one attempt and its error", st)
+	}
+	if err := d.CompleteEmbedding(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if st := state(); st.Queued || st.Indexed {
+		t.Errorf("state after completion = %+v, want neither queued nor indexed", st)
+	}
+}
@@ -0,0 +1,103 @@
+package sqlite
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+const (
+	// DefaultMaintenanceInterval is the default Config.MaintenanceInterval.
+	DefaultMaintenanceInterval = time.Hour
+	// DefaultCheckpointWALBytes is the default Config.CheckpointWALBytes.
+	DefaultCheckpointWALBytes = 64 << 20
+	// maintainTimeout bounds one background maintenance run.
+	maintainTimeout = 5 * time.Minute
+)
+
+// Checkpoint modes reported by Maintain.
+const (
+	CheckpointPassive  = "passive"
+	CheckpointTruncate = "truncate"
+)
+
+// MaintenanceReport describes one Maintain run.
+type MaintenanceReport struct {
+	WALBytesBefore int64 `json:"wal_bytes_before"`
+	WALBytesAfter  int64 `json:"wal_bytes_after"`
+	// Checkpoint is the strongest checkpoint that ran: "passive", or
+	// "truncate" when the WAL was over the threshold and fully copied.
+	Checkpoint string `json:"checkpoint"`
+	// Busy is set when readers or the writer kept the passive checkpoint
+	// from copying every frame; the WAL is then left as it is.
+	Busy            bool    `json:"busy"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// Maintain refreshes the query planner statistics and checkpoints the WAL.
+// PRAGMA optimize runs first, so that statistics it writes are checkpointed
+// too. A PASSIVE checkpoint follows, copying what it can without waiting on
+// readers; only when it copied every frame, so the database is idle, and
+// the WAL is over Config.CheckpointWALBytes does a TRUNCATE checkpoint reset
+// the file. Both run on the writer connection and hold it only briefly.
+func (d *Database) Maintain(ctx context.Context) (MaintenanceReport, error) {
+	start := time.Now()
+	var report MaintenanceReport
+	report.WALBytesBefore = walSize(d.path)
+
+	if _, err := d.db.ExecContext(ctx, `PRAGMA optimize;`); err != nil {
+		return report, err
+	}
+	var busy, frames, copied int
+	if err := d.db.QueryRowContext(ctx, `PRAGMA wal_checkpoint(PASSIVE);`).Scan(&busy, &frames, &copied); err != nil {
+		return report, err
+	}
+	report.Checkpoint = CheckpointPassive
+	report.Busy = busy != 0 || copied < frames
+	if !report.Busy && report.WALBytesBefore > d.checkpointWALBytes {
+		if err := d.db.QueryRowContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE);`).Scan(&busy, &frames, &copied); err != nil {
+			return report, err
+		}
+		if busy == 0 {
+			report.Checkpoint = CheckpointTruncate
+		}
+	}
+	report.WALBytesAfter = walSize(d.path)
+	report.DurationSeconds = time.Since(start).Seconds()
+	d.logger.Info("database maintenance", "checkpoint", report.Checkpoint, "busy", report.Busy,
+		"wal_bytes_before", report.WALBytesBefore, "wal_bytes_after", report.WALBytesAfter,
+		"duration", time.Since(start))
+	return report, nil
+}
+
+// walSize returns the size of the WAL file of the database at path, or 0.
+func walSize(path string) int64 {
+	fi, err := os.Stat(path + "-wal")
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
+
+// startMaintenance runs Maintain every interval until Close.
+func (d *Database) startMaintenance(interval time.Duration) {
+	d.stopMaintenance = make(chan struct{})
+	d.maintenanceDone = make(chan struct{})
+	go func() {
+		defer close(d.maintenanceDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.stopMaintenance:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), maintainTimeout)
+				if _, err := d.Maintain(ctx); err != nil {
+					d.logger.Error("database maintenance failed", "err", err)
+				}
+				cancel()
+			}
+		}
+	}()
+}
@@ -0,0 +1,109 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// fillWAL writes n logs, each committed on its own, to grow the WAL.
+func fillWAL(t *testing.T, d *Database, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, err := d.InsertLog(context.Background(), model.SensoryInput{Content: fmt.Sprintf("log %d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMaintainTruncatesALargeWAL(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "paim.db")
+	d := openTestDB(t, Config{Path: path, MaintenanceInterval: -1, CheckpointWALBytes: 1})
+	fillWAL(t, d, 50)
+	if walSize(path) == 0 {
+		t.Fatal("no WAL after writing")
+	}
+	report, err := d.Maintain(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checkpoint != CheckpointTruncate || report.Busy {
+		t.Errorf("checkpoint %s (busy %v), want truncate", report.Checkpoint, report.Busy)
+	}
+	if report.WALBytesBefore == 0 || report.WALBytesAfter != 0 || walSize(path) != 0 {
+		t.Errorf("WAL %d bytes before and %d after, want it emptied", report.WALBytesBefore, report.WALBytesAfter)
+	}
+}
+
+func TestMaintainLeavesASmallWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "paim.db")
+	d := openTestDB(t, Config{Path: path, MaintenanceInterval: -1})
+	fillWAL(t, d, 5)
+	report, err := d.Maintain(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checkpoint != CheckpointPassive || report.Busy {
+		t.Errorf("checkpoint %s (busy %v), want passive", report.Checkpoint, report.Busy)
+	}
+	if report.WALBytesAfter == 0 || report.WALBytesAfter != report.WALBytesBefore {
+		t.Errorf("WAL %d bytes before and %d after, want it left under the threshold", report.WALBytesBefore, report.WALBytesAfter)
+	}
+}
+
+func TestMaintainDoesNotTruncateUnderAReader(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "paim.db")
+	d := openTestDB(t, Config{Path: path, MaintenanceInterval: -1, CheckpointWALBytes: 1})
+	fillWAL(t, d, 5)
+
+	// a read transaction pins its snapshot, so the frames written after it
+	// cannot be copied back yet
+	tx, err := d.Reader().BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	var n int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM memory_logs;`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	fillWAL(t, d, 5)
+
+	report, err := d.Maintain(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checkpoint != CheckpointPassive || !report.Busy {
+		t.Errorf("checkpoint %s (busy %v) under a reader, want a busy passive one", report.Checkpoint, report.Busy)
+	}
+	if report.WALBytesAfter == 0 {
+		t.Error("WAL truncated under a reader")
+	}
+}
+
+func TestBackgroundMaintenance(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "paim.db")
+	d := openTestDB(t, Config{Path: path, MaintenanceInterval: 10 * time.Millisecond, CheckpointWALBytes: 1})
+	fillWAL(t, d, 20)
+	deadline := time.Now().Add(5 * time.Second)
+	for walSize(path) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("WAL still %d bytes, want it truncated by the background maintenance", walSize(path))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-d.maintenanceDone:
+	default:
+		t.Error("maintenance still running after Close")
+	}
+}
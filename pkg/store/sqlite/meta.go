@@ -0,0 +1,145 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/johncui/PAIM/pkg/store/vector"
+)
+
+// Keys in the meta table. The vector dimension is kept per backend since
+// each has its own table.
+const (
+	metaVectorDimPrefix = "vector_dim:"
+	metaEmbedderModel   = "embedder_model"
+)
+
+// ErrVectorDimMismatch is returned by New when the vector table was created
+// with a different dimension than the configured one.
+var ErrVectorDimMismatch = errors.New("vector dimension mismatch")
+
+// ErrVectorUnavailable is returned by New when vector search was enabled but
+// the extension cannot provide it: the file is missing or fails to load, is
+// not the configured backend, or cannot create the vector table.
+var ErrVectorUnavailable = errors.New("vector search unavailable")
+
+// Meta returns the value stored under key, or "" when it is unset.
+func (d *Database) Meta(ctx context.Context, key string) (string, error) {
+	var v string
+	err := d.db.QueryRowContext(ctx, `SELECT value FROM meta WHERE key = ?;`, key).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return v, err
+}
+
+// SetMeta stores value under key.
+func (d *Database) SetMeta(ctx context.Context, key, value string) error {
+	return setMeta(ctx, d.db, key, value)
+}
+
+func setMeta(ctx context.Context, ex execer, key, value string) error {
+	_, err := ex.ExecContext(ctx, `
+        INSERT INTO meta(key, value) VALUES (?, ?)
+        ON CONFLICT(key) DO UPDATE SET value = excluded.value;
+    `, key, value)
+	return err
+}
+
+// EmbedderModel returns the embedding model the stored vectors were built
+// with, or "" when none was recorded.
+func (d *Database) EmbedderModel(ctx context.Context) (string, error) {
+	return d.Meta(ctx, metaEmbedderModel)
+}
+
+// SetEmbedderModel records the embedding model the stored vectors are built
+// with.
+func (d *Database) SetEmbedderModel(ctx context.Context, name string) error {
+	return d.SetMeta(ctx, metaEmbedderModel, name)
+}
+
+// storedVectorDim returns the dimension the vector table was created with:
+// the value recorded in meta, or for databases from before meta existed the
+// one declared in the table's schema. It returns 0 when there is no table.
+func (d *Database) storedVectorDim(ctx context.Context) (int, error) {
+	v, err := d.Meta(ctx, metaVectorDimPrefix+d.backend.Name())
+	if err != nil {
+		return 0, err
+	}
+	if v != "" {
+		return strconv.Atoi(v)
+	}
+	var ddl string
+	err = d.db.QueryRowContext(ctx, `SELECT sql FROM sqlite_master WHERE name = ?;`, d.backend.Table()).Scan(&ddl)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return dimFromSchema(ddl)
+}
+
+// declaredDim matches the column declaration of both backends:
+// content_embedding(1536) for vss0 and content_embedding float[1536] for vec0.
+var declaredDim = regexp.MustCompile(`content_embedding\s*(?:\(|float\[)\s*(\d+)`)
+
+func dimFromSchema(ddl string) (int, error) {
+	m := declaredDim.FindStringSubmatch(ddl)
+	if m == nil {
+		return 0, fmt.Errorf("cannot read vector dimension from %q", ddl)
+	}
+	return strconv.Atoi(m[1])
+}
+
+// ensureVectorTable creates the vector table, or checks that the existing one
+// matches the configured dimension. On a mismatch it fails with
+// ErrVectorDimMismatch unless migrate is set, in which case the table is
+// recreated empty and every log is queued for embedding.
+func (d *Database) ensureVectorTable(ctx context.Context, migrate bool) error {
+	stored, err := d.storedVectorDim(ctx)
+	if err != nil {
+		return fmt.Errorf("read vector dimension: %w", err)
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if stored != 0 && stored != d.vectorDim {
+		if !migrate {
+			return fmt.Errorf("%w: %s holds %d-dimensional vectors but %d is configured",
+				ErrVectorDimMismatch, d.backend.Table(), stored, d.vectorDim)
+		}
+		if err := execAll(ctx, tx,
+			`DROP TABLE IF EXISTS `+d.backend.Table()+`;`,
+			`DELETE FROM `+vector.PayloadTable+`;`,
+		); err != nil {
+			return fmt.Errorf("drop vector table: %w", err)
+		}
+		queued, err := enqueueAllLogs(ctx, tx)
+		if err != nil {
+			return err
+		}
+		d.logger.Warn("recreating vector table for new dimension; logs queued for re-embedding",
+			"from", stored, "to", d.vectorDim, "queued", queued)
+	}
+	if err := execAll(ctx, tx, d.backend.Schema(d.vectorDim)...); err != nil {
+		return fmt.Errorf("%w: create %s with the sqlite-%s extension at %q: %v",
+			ErrVectorUnavailable, d.backend.Table(), d.backend.Name(), d.extensionsPath, err)
+	}
+	// payload tables from before namespaces only hold default-namespace logs
+	if err := addColumnIfMissing(ctx, tx, vector.PayloadTable, "namespace", "TEXT NOT NULL DEFAULT 'default'"); err != nil {
+		return err
+	}
+	if err := setMeta(ctx, tx, metaVectorDimPrefix+d.backend.Name(), strconv.Itoa(d.vectorDim)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
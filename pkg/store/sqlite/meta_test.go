@@ -0,0 +1,76 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store/vector"
+)
+
+func TestDimFromSchema(t *testing.T) {
+	for _, tt := range []struct {
+		ddl  string
+		want int
+	}{
+		{`CREATE VIRTUAL TABLE vss_memories USING vss0(content_embedding(1536))`, 1536},
+		{`CREATE VIRTUAL TABLE vec_memories USING vec0(content_embedding float[384])`, 384},
+		{`CREATE VIRTUAL TABLE vss_memories USING vss0( content_embedding ( 8 ) )`, 8},
+	} {
+		if got, err := dimFromSchema(tt.ddl); err != nil || got != tt.want {
+			t.Errorf("dimFromSchema(%q) = %d, %v; want %d", tt.ddl, got, err, tt.want)
+		}
+	}
+	if _, err := dimFromSchema(`CREATE TABLE x(y)`); err == nil {
+		t.Error("dimFromSchema of a table without embeddings succeeded")
+	}
+}
+
+func TestVectorDimMismatchIsDetected(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t, Config{Path: MemoryPath, VectorDim: 16})
+	if dim, err := d.storedVectorDim(ctx); err != nil || dim != 0 {
+		t.Fatalf("storedVectorDim of a fresh database = %d, %v; want 0", dim, err)
+	}
+	if err := d.SetMeta(ctx, metaVectorDimPrefix+d.backend.Name(), "8"); err != nil {
+		t.Fatal(err)
+	}
+	if dim, err := d.storedVectorDim(ctx); err != nil || dim != 8 {
+		t.Fatalf("storedVectorDim = %d, %v; want 8", dim, err)
+	}
+	err := d.ensureVectorTable(ctx, false)
+	if !errors.Is(err, ErrVectorDimMismatch) {
+		t.Fatalf("ensureVectorTable = %v, want ErrVectorDimMismatch", err)
+	}
+	if n, err := d.PendingEmbeddingCount(ctx); err != nil || n != 0 {
+		t.Fatalf("%d logs queued by a refused migration, %v", n, err)
+	}
+}
+
+func TestFailedDimMigrationChangesNothing(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t, Config{Path: MemoryPath, VectorDim: 16})
+	if _, err := d.InsertLog(ctx, model.SensoryInput{Content: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	// left by an earlier run with vector search
+	if _, err := d.Writer().ExecContext(ctx, `CREATE TABLE `+vector.PayloadTable+` (rowid INTEGER PRIMARY KEY, log_id TEXT NOT NULL);`); err != nil {
+		t.Fatal(err)
+	}
+	key := metaVectorDimPrefix + d.backend.Name()
+	if err := d.SetMeta(ctx, key, "8"); err != nil {
+		t.Fatal(err)
+	}
+	// without the extension the new table cannot be created, so the
+	// migration must roll back whole
+	if err := d.ensureVectorTable(ctx, true); !errors.Is(err, ErrVectorUnavailable) {
+		t.Fatalf("ensureVectorTable = %v, want ErrVectorUnavailable", err)
+	}
+	if n, err := d.PendingEmbeddingCount(ctx); err != nil || n != 0 {
+		t.Errorf("%d logs queued by a failed migration, %v; want none", n, err)
+	}
+	if v, err := d.Meta(ctx, key); err != nil || v != "8" {
+		t.Errorf("stored dimension = %q, %v; want it unchanged", v, err)
+	}
+}
@@ -0,0 +1,437 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// migration is one numbered schema step. Steps run in order, each in its own
+// transaction, and are recorded in schema_migrations once applied.
+type migration struct {
+	version int
+	name    string
+	up      func(ctx context.Context, tx *sql.Tx) error
+}
+
+// migrations is the ordered schema history. Append new steps; never edit or
+// renumber a step that has shipped.
+var migrations = []migration{
+	{version: 1, name: "initial schema", up: migrateInitial},
+	{version: 2, name: "meta table", up: migrateMeta},
+	{version: 3, name: "namespaces", up: migrateNamespaces},
+	{version: 4, name: "sessions", up: migrateSessions},
+	{version: 5, name: "embeddings", up: migrateEmbeddings},
+	{version: 6, name: "access tracking", up: migrateAccessTracking},
+	{version: 7, name: "summaries", up: migrateSummaries},
+	{version: 8, name: "log updates", up: migrateLogUpdates},
+	{version: 9, name: "consolidation overflow", up: migrateOverflow},
+	{version: 10, name: "content hashes", up: migrateContentHash},
+	{version: 11, name: "consolidation runs", up: migrateConsolidationRuns},
+	{version: 12, name: "superseded triples", up: migrateSuperseded},
+	{version: 13, name: "triple validity", up: migrateValidity},
+	{version: 14, name: "supersession on delete", up: migrateSupersededOnDelete},
+	{version: 15, name: "namespaced aliases", up: migrateNamespacedAliases},
+	{version: 16, name: "unlabelled triples index", up: migrateUnlabelledIndex},
+}
+
+// latestSchemaVersion is the schema version this binary understands.
+func latestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// migrate applies pending migrations and records the resulting version. It
+// refuses to touch a database written by a newer binary.
+func (d *Database) migrate(ctx context.Context) error {
+	if _, err := d.db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS schema_migrations (
+            version INTEGER PRIMARY KEY,
+            name TEXT NOT NULL,
+            applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+        );`); err != nil {
+		return err
+	}
+
+	var current int
+	if err := d.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations;`).Scan(&current); err != nil {
+		return err
+	}
+	if latest := latestSchemaVersion(); current > latest {
+		return fmt.Errorf("database schema version %d is newer than supported version %d; upgrade paim", current, latest)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := d.applyMigration(ctx, m); err != nil {
+			return fmt.Errorf("migration %03d (%s): %w", m.version, m.name, err)
+		}
+		d.logger.Info("applied schema migration", "version", m.version, "name", m.name)
+		current = m.version
+	}
+	d.schemaVersion = current
+	return nil
+}
+
+func (d *Database) applyMigration(ctx context.Context, m migration) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.up(ctx, tx); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations(version, name) VALUES (?, ?);`, m.version, m.name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func execAll(ctx context.Context, tx *sql.Tx, stmts ...string) error {
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateInitial creates the schema as it stood before versioning. It stays
+// idempotent so databases created by older, unversioned builds adopt it: the
+// tables already exist and only the later-added columns are filled in.
+func migrateInitial(ctx context.Context, tx *sql.Tx) error {
+	if err := execAll(ctx, tx,
+		`CREATE TABLE IF NOT EXISTS memory_logs (
+            id TEXT PRIMARY KEY,
+            timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+            source_type TEXT,
+            content TEXT,
+            metadata JSON
+        );`,
+		`CREATE TABLE IF NOT EXISTS triples (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            subject TEXT NOT NULL,
+            predicate TEXT NOT NULL,
+            object TEXT NOT NULL,
+            confidence REAL DEFAULT 1.0,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            observation_count INTEGER NOT NULL DEFAULT 1,
+            subject_label TEXT,
+            object_label TEXT,
+            UNIQUE(subject, predicate, object)
+        );`,
+		`CREATE TABLE IF NOT EXISTS entity_aliases (
+            alias TEXT PRIMARY KEY,
+            canonical TEXT NOT NULL
+        );`,
+		`CREATE INDEX IF NOT EXISTS idx_subject ON triples(subject);`,
+		`CREATE INDEX IF NOT EXISTS idx_object ON triples(object);`,
+		`CREATE TABLE IF NOT EXISTS triple_sources (
+            triple_id INTEGER NOT NULL REFERENCES triples(id) ON DELETE CASCADE,
+            log_id TEXT NOT NULL REFERENCES memory_logs(id) ON DELETE CASCADE,
+            PRIMARY KEY (triple_id, log_id)
+        );`,
+		`CREATE INDEX IF NOT EXISTS idx_triple_sources_log ON triple_sources(log_id);`,
+		`CREATE TABLE IF NOT EXISTS embedding_queue (
+            log_id TEXT PRIMARY KEY,
+            attempts INTEGER NOT NULL DEFAULT 0,
+            last_error TEXT,
+            next_attempt_at INTEGER NOT NULL DEFAULT 0,
+            enqueued_at DATETIME DEFAULT CURRENT_TIMESTAMP
+        );`,
+		`CREATE INDEX IF NOT EXISTS idx_embedding_queue_due ON embedding_queue(next_attempt_at);`,
+	); err != nil {
+		return err
+	}
+
+	// columns added to triples by unversioned builds
+	for _, c := range []struct{ table, column, decl string }{
+		{"triples", "observation_count", "INTEGER NOT NULL DEFAULT 1"},
+		{"triples", "subject_label", "TEXT"},
+		{"triples", "object_label", "TEXT"},
+	} {
+		if err := addColumnIfMissing(ctx, tx, c.table, c.column, c.decl); err != nil {
+			return err
+		}
+	}
+	// triples written before entity normalization, still to be rewritten
+	return execAll(ctx, tx,
+		`CREATE INDEX IF NOT EXISTS idx_triples_unlabelled ON triples(id)
+            WHERE subject_label IS NULL OR object_label IS NULL;`,
+	)
+}
+
+// migrateMeta adds a key/value table for facts about the database itself,
+// such as the dimension the vector table was created with.
+func migrateMeta(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`CREATE TABLE IF NOT EXISTS meta (
+            key TEXT PRIMARY KEY,
+            value TEXT NOT NULL
+        );`,
+	)
+}
+
+// migrateNamespaces scopes logs and triples by namespace, placing existing
+// rows in "default". Triples are rebuilt because their uniqueness now
+// includes the namespace; triple_sources references triples, so its rows are
+// parked in a temporary table while the old table is dropped.
+func migrateNamespaces(ctx context.Context, tx *sql.Tx) error {
+	var seq int64
+	err := tx.QueryRowContext(ctx, `SELECT seq FROM sqlite_sequence WHERE name = 'triples';`).Scan(&seq)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	return execAll(ctx, tx,
+		`ALTER TABLE memory_logs ADD COLUMN namespace TEXT NOT NULL DEFAULT 'default';`,
+		`CREATE INDEX IF NOT EXISTS idx_memory_logs_namespace ON memory_logs(namespace, timestamp);`,
+		`CREATE TABLE triples_new (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            namespace TEXT NOT NULL DEFAULT 'default',
+            subject TEXT NOT NULL,
+            predicate TEXT NOT NULL,
+            object TEXT NOT NULL,
+            confidence REAL DEFAULT 1.0,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            observation_count INTEGER NOT NULL DEFAULT 1,
+            subject_label TEXT,
+            object_label TEXT,
+            UNIQUE(namespace, subject, predicate, object)
+        );`,
+		`INSERT INTO triples_new(id, subject, predicate, object, confidence, created_at, observation_count, subject_label, object_label)
+            SELECT id, subject, predicate, object, confidence, created_at, observation_count, subject_label, object_label FROM triples;`,
+		`CREATE TEMP TABLE triple_sources_backup AS SELECT triple_id, log_id FROM triple_sources;`,
+		`DROP TABLE triple_sources;`,
+		`DROP TABLE triples;`,
+		`ALTER TABLE triples_new RENAME TO triples;`,
+		`CREATE TABLE triple_sources (
+            triple_id INTEGER NOT NULL REFERENCES triples(id) ON DELETE CASCADE,
+            log_id TEXT NOT NULL REFERENCES memory_logs(id) ON DELETE CASCADE,
+            PRIMARY KEY (triple_id, log_id)
+        );`,
+		`INSERT INTO triple_sources(triple_id, log_id) SELECT triple_id, log_id FROM triple_sources_backup;`,
+		`DROP TABLE triple_sources_backup;`,
+		`CREATE INDEX idx_triple_sources_log ON triple_sources(log_id);`,
+		`CREATE INDEX idx_subject ON triples(namespace, subject);`,
+		`CREATE INDEX idx_object ON triples(namespace, object);`,
+		// keep ids of deleted triples from being handed out again
+		fmt.Sprintf(`UPDATE sqlite_sequence SET seq = MAX(seq, %d) WHERE name = 'triples';`, seq),
+	)
+}
+
+// migrateSessions lets logs name the conversation they belong to. Most logs
+// have no session, so the index only covers those that do.
+func migrateSessions(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`ALTER TABLE memory_logs ADD COLUMN session_id TEXT;`,
+		`CREATE INDEX IF NOT EXISTS idx_memory_logs_session ON memory_logs(session_id, timestamp) WHERE session_id IS NOT NULL;`,
+	)
+}
+
+// migrateEmbeddings keeps raw embeddings outside any vector extension, so
+// they survive with vector search disabled and can be indexed later.
+func migrateEmbeddings(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`CREATE TABLE IF NOT EXISTS embeddings (
+            log_id TEXT PRIMARY KEY REFERENCES memory_logs(id) ON DELETE CASCADE,
+            model TEXT NOT NULL,
+            dim INTEGER NOT NULL,
+            vector BLOB NOT NULL
+        );`,
+	)
+}
+
+// migrateAccessTracking records when logs and triples were last returned by
+// a recall and how often.
+func migrateAccessTracking(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`ALTER TABLE memory_logs ADD COLUMN last_accessed_at DATETIME;`,
+		`ALTER TABLE memory_logs ADD COLUMN access_count INTEGER NOT NULL DEFAULT 0;`,
+		`ALTER TABLE triples ADD COLUMN last_accessed_at DATETIME;`,
+		`ALTER TABLE triples ADD COLUMN access_count INTEGER NOT NULL DEFAULT 0;`,
+	)
+}
+
+// migrateSummaries links logs to the summary log that replaced them.
+func migrateSummaries(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`ALTER TABLE memory_logs ADD COLUMN summarized_into TEXT;`,
+	)
+}
+
+// migrateLogUpdates records when a log was last edited.
+func migrateLogUpdates(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`ALTER TABLE memory_logs ADD COLUMN updated_at DATETIME;`,
+	)
+}
+
+// migrateOverflow stages logs whose inputs the sensory buffer evicted for
+// lack of room, until a consolidation distills them.
+func migrateOverflow(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`CREATE TABLE IF NOT EXISTS consolidation_overflow (
+            log_id TEXT PRIMARY KEY REFERENCES memory_logs(id) ON DELETE CASCADE,
+            staged_at DATETIME DEFAULT CURRENT_TIMESTAMP
+        );`,
+	)
+}
+
+// migrateContentHash records a hash of every log's content, so the logs of a
+// unique-content source can be matched by content through an index. The
+// index is not unique: the sources that allow duplicates share the table,
+// and which sources are unique is configuration that may change.
+func migrateContentHash(ctx context.Context, tx *sql.Tx) error {
+	if err := execAll(ctx, tx,
+		`ALTER TABLE memory_logs ADD COLUMN content_hash TEXT;`,
+	); err != nil {
+		return err
+	}
+	rows, err := tx.QueryContext(ctx, `SELECT id, content FROM memory_logs;`)
+	if err != nil {
+		return err
+	}
+	hashes := make(map[string]string)
+	for rows.Next() {
+		var id string
+		var content sql.NullString
+		if err := rows.Scan(&id, &content); err != nil {
+			rows.Close()
+			return err
+		}
+		hashes[id] = ContentHash(content.String)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	update, err := tx.PrepareContext(ctx, `UPDATE memory_logs SET content_hash = ? WHERE id = ?;`)
+	if err != nil {
+		return err
+	}
+	defer update.Close()
+	for id, hash := range hashes {
+		if _, err := update.ExecContext(ctx, hash, id); err != nil {
+			return err
+		}
+	}
+	return execAll(ctx, tx,
+		`CREATE INDEX IF NOT EXISTS idx_memory_logs_content_hash ON memory_logs(content_hash, namespace, source_type);`,
+	)
+}
+
+func migrateConsolidationRuns(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`CREATE TABLE IF NOT EXISTS consolidation_runs (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            started_at DATETIME NOT NULL,
+            finished_at DATETIME NOT NULL,
+            inputs INTEGER NOT NULL DEFAULT 0,
+            triples_written INTEGER NOT NULL DEFAULT 0,
+            error TEXT
+        );`,
+	)
+}
+
+// migrateSuperseded lets a triple point at the triple that replaced it as
+// the value of a functional predicate.
+func migrateSuperseded(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`ALTER TABLE triples ADD COLUMN superseded_by INTEGER;`,
+	)
+}
+
+// migrateValidity bounds the time a triple holds with valid_from and
+// valid_to, NULL for open ends. Triples already superseded stop being valid
+// when the triple that replaced them was created.
+func migrateValidity(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`ALTER TABLE triples ADD COLUMN valid_from DATETIME;`,
+		`ALTER TABLE triples ADD COLUMN valid_to DATETIME;`,
+		`UPDATE triples SET valid_to = (SELECT t.created_at FROM triples t WHERE t.id = triples.superseded_by)
+            WHERE superseded_by IS NOT NULL;`,
+	)
+}
+
+// migrateSupersededOnDelete keeps supersession chains intact when a triple
+// is deleted: the triples it superseded are superseded by its own successor
+// instead, valid until that one starts, or become current again when it was
+// the current value, with an open end and the confidence cut by
+// supersession (graph's SupersededConfidence, 0.1) undone. Triples already
+// pointing at deleted triples are repaired the same way.
+func migrateSupersededOnDelete(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`UPDATE triples SET superseded_by = NULL, valid_to = NULL, confidence = MIN(1.0, confidence / 0.1)
+            WHERE superseded_by IS NOT NULL AND superseded_by NOT IN (SELECT id FROM triples);`,
+		`CREATE INDEX IF NOT EXISTS idx_triples_superseded_by ON triples(superseded_by) WHERE superseded_by IS NOT NULL;`,
+		`CREATE TRIGGER IF NOT EXISTS triples_superseded_on_delete AFTER DELETE ON triples
+            WHEN EXISTS (SELECT 1 FROM triples WHERE superseded_by = OLD.id)
+        BEGIN
+            UPDATE triples SET
+                superseded_by = OLD.superseded_by,
+                valid_to = CASE WHEN OLD.superseded_by IS NULL THEN NULL ELSE OLD.valid_to END,
+                confidence = CASE WHEN OLD.superseded_by IS NULL THEN MIN(1.0, confidence / 0.1) ELSE confidence END
+            WHERE superseded_by = OLD.id;
+        END;`,
+	)
+}
+
+// migrateNamespacedAliases scopes entity aliases by namespace, so that one
+// tenant's aliases never rewrite another's triples. Existing aliases are
+// placed in "default".
+func migrateNamespacedAliases(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`CREATE TABLE entity_aliases_new (
+            namespace TEXT NOT NULL DEFAULT 'default',
+            alias TEXT NOT NULL,
+            canonical TEXT NOT NULL,
+            PRIMARY KEY (namespace, alias)
+        );`,
+		`INSERT INTO entity_aliases_new(alias, canonical) SELECT alias, canonical FROM entity_aliases;`,
+		`DROP TABLE entity_aliases;`,
+		`ALTER TABLE entity_aliases_new RENAME TO entity_aliases;`,
+	)
+}
+
+// migrateUnlabelledIndex restores the index of triples still to be
+// normalized, which the triples rebuild of migrateNamespaces left out.
+func migrateUnlabelledIndex(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`CREATE INDEX IF NOT EXISTS idx_triples_unlabelled ON triples(id)
+            WHERE subject_label IS NULL OR object_label IS NULL;`,
+	)
+}
+
+func addColumnIfMissing(ctx context.Context, tx *sql.Tx, table, column, decl string) error {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s);", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid     int
+			name    string
+			typ     string
+			notNull int
+			dflt    sql.NullString
+			pk      int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, decl))
+	return err
+}
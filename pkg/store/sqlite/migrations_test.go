@@ -0,0 +1,238 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// openTestDB opens cfg, with logs discarded, and closes it when the test
+// ends.
+func openTestDB(t *testing.T, cfg Config) *Database {
+	t.Helper()
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	d, err := New(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+// createAtVersion creates a database file in a temporary directory as a
+// binary that knew only the migrations up to version would, runs setup on
+// it, and returns its path.
+func createAtVersion(t *testing.T, version int, setup ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "old.db")
+	all := migrations
+	migrations = all[:version]
+	defer func() { migrations = all }()
+
+	d := openTestDB(t, Config{Path: path})
+	if got := d.SchemaVersion(); got != version {
+		t.Fatalf("schema version = %d, want %d", got, version)
+	}
+	for _, stmt := range setup {
+		if _, err := d.DB().Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestUpgradeHashesStoredContent(t *testing.T) {
+	ctx := context.Background()
+	path := createAtVersion(t, 9,
+		`INSERT INTO memory_logs(id, content, source_type) VALUES ('log-1', 'readme', 'doc');`,
+	)
+	d := openTestDB(t, Config{Path: path, MaintenanceInterval: -1, UniqueContentSources: []string{"doc"}})
+	ids, existing, err := d.InsertLogs(ctx, []model.SensoryInput{{Content: "readme", Source: "doc"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !existing[0] || ids[0] != "log-1" {
+		t.Errorf("InsertLogs after the upgrade = %s (existing %v), want the stored log-1", ids[0], existing[0])
+	}
+}
+
+func TestUpgradeEndsSupersededTriples(t *testing.T) {
+	path := createAtVersion(t, 12,
+		`INSERT INTO triples(id, subject, predicate, object, confidence, created_at, superseded_by) VALUES
+            (1, 'alice', 'lives_in', 'paris', 0.08, '2024-01-01 00:00:00', 2),
+            (2, 'alice', 'lives_in', 'berlin', 0.8, '2025-03-01 12:00:00', NULL);`,
+	)
+	d := openTestDB(t, Config{Path: path, MaintenanceInterval: -1})
+	var parisFrom, paris, berlin sql.NullTime
+	if err := d.Reader().QueryRow(`SELECT valid_from, valid_to FROM triples WHERE id = 1`).Scan(&parisFrom, &paris); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Reader().QueryRow(`SELECT valid_to FROM triples WHERE id = 2`).Scan(&berlin); err != nil {
+		t.Fatal(err)
+	}
+	if !paris.Valid || !paris.Time.Equal(time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)) || parisFrom.Valid {
+		t.Errorf("paris valid from %v to %v, want open until berlin was created", parisFrom, paris)
+	}
+	if berlin.Valid {
+		t.Errorf("current triple valid to %v, want open", berlin.Time)
+	}
+}
+
+func TestUpgradeFromEveryOlderVersion(t *testing.T) {
+	for version := 1; version < latestSchemaVersion(); version++ {
+		t.Run(migrations[version-1].name, func(t *testing.T) {
+			path := createAtVersion(t, version,
+				`INSERT INTO memory_logs(id, content, source_type) VALUES ('log-1', 'alice works at acme', 'chat');`,
+				`INSERT INTO triples(subject, predicate, object) VALUES ('alice', 'works_at', 'acme');`,
+			)
+			d := openTestDB(t, Config{Path: path})
+			if got := d.SchemaVersion(); got != latestSchemaVersion() {
+				t.Fatalf("schema version = %d, want %d", got, latestSchemaVersion())
+			}
+			var applied int
+			if err := d.DB().QueryRow(`SELECT COUNT(*) FROM schema_migrations;`).Scan(&applied); err != nil {
+				t.Fatal(err)
+			}
+			if applied != len(migrations) {
+				t.Fatalf("%d migrations recorded, want %d", applied, len(migrations))
+			}
+			var namespace string
+			if err := d.Reader().QueryRow(`SELECT namespace FROM triples WHERE subject = 'alice';`).Scan(&namespace); err != nil {
+				t.Fatal(err)
+			}
+			if namespace != "default" {
+				t.Fatalf("upgraded triple is in namespace %q, want default", namespace)
+			}
+			logs, err := d.FetchLogs(context.Background(), []string{"log-1"})
+			if err != nil || len(logs) != 1 {
+				t.Fatalf("FetchLogs after upgrade = %d logs, %v", len(logs), err)
+			}
+		})
+	}
+}
+
+func TestUnversionedDatabaseAdoptsMigrations(t *testing.T) {
+	path := createAtVersion(t, 1,
+		`INSERT INTO triples(subject, predicate, object) VALUES ('alice', 'works_at', 'acme');`,
+		`DROP TABLE schema_migrations;`,
+	)
+	d := openTestDB(t, Config{Path: path})
+	if got := d.SchemaVersion(); got != latestSchemaVersion() {
+		t.Fatalf("schema version = %d, want %d", got, latestSchemaVersion())
+	}
+	var n int
+	if err := d.Reader().QueryRow(`SELECT COUNT(*) FROM triples;`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("%d triples after adopting migrations, want 1", n)
+	}
+}
+
+func TestNewerSchemaIsRefused(t *testing.T) {
+	path := createAtVersion(t, latestSchemaVersion(),
+		`INSERT INTO schema_migrations(version, name) VALUES (9999, 'from the future');`,
+	)
+	_, err := New(context.Background(), Config{
+		Path:   path,
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err == nil || !strings.Contains(err.Error(), "newer than supported") {
+		t.Fatalf("New on a newer schema = %v, want a version error", err)
+	}
+}
+
+func TestUpgradeMovesRowsIntoTheDefaultNamespace(t *testing.T) {
+	path := createAtVersion(t, 2,
+		`INSERT INTO memory_logs(id, content, source_type) VALUES ('log-1', 'Alice works at Acme', 'chat');`,
+		`INSERT INTO triples(id, subject, predicate, object) VALUES (1, 'alice', 'works_at', 'acme'), (7, 'bob', 'likes', 'tea');`,
+		`INSERT INTO triple_sources(triple_id, log_id) VALUES (1, 'log-1');`,
+		`DELETE FROM triples WHERE id = 7;`,
+	)
+	d := openTestDB(t, Config{Path: path})
+
+	var logNS, tripleNS string
+	var sources int
+	if err := d.Reader().QueryRow(`SELECT namespace FROM memory_logs WHERE id = 'log-1'`).Scan(&logNS); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Reader().QueryRow(`SELECT namespace FROM triples WHERE id = 1`).Scan(&tripleNS); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Reader().QueryRow(`SELECT COUNT(*) FROM triple_sources WHERE triple_id = 1 AND log_id = 'log-1'`).Scan(&sources); err != nil {
+		t.Fatal(err)
+	}
+	if logNS != "default" || tripleNS != "default" || sources != 1 {
+		t.Errorf("after upgrade: log in %q, triple in %q, %d sources; want default, default, 1", logNS, tripleNS, sources)
+	}
+
+	// the same triple may now exist in another namespace, and ids of
+	// deleted triples are not handed out again
+	res, err := d.Writer().Exec(`INSERT INTO triples(namespace, subject, predicate, object) VALUES ('work', 'alice', 'works_at', 'acme')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := res.LastInsertId(); id <= 7 {
+		t.Errorf("new triple id %d reuses a deleted id", id)
+	}
+	if _, err := d.Writer().Exec(`INSERT INTO triples(namespace, subject, predicate, object) VALUES ('work', 'alice', 'works_at', 'acme')`); err == nil {
+		t.Error("duplicate triple within a namespace was accepted")
+	}
+}
+
+func TestUpgradeRepairsDanglingSupersession(t *testing.T) {
+	path := createAtVersion(t, 13,
+		`INSERT INTO triples(id, subject, predicate, object, confidence, superseded_by, valid_to) VALUES
+            (1, 'alice', 'lives_in', 'paris', 0.08, 9, '2025-03-01 12:00:00');`,
+	)
+	d := openTestDB(t, Config{Path: path, MaintenanceInterval: -1})
+	var by sql.NullInt64
+	var to sql.NullTime
+	var conf float64
+	if err := d.Reader().QueryRow(`SELECT superseded_by, valid_to, confidence FROM triples WHERE id = 1`).Scan(&by, &to, &conf); err != nil {
+		t.Fatal(err)
+	}
+	if by.Valid || to.Valid || conf < 0.79 || conf > 0.81 {
+		t.Errorf("paris superseded by %v, valid to %v, confidence %v; want it current again at 0.8", by, to, conf)
+	}
+}
+
+func TestUpgradeScopesAliasesToTheDefaultNamespace(t *testing.T) {
+	path := createAtVersion(t, 14, `INSERT INTO entity_aliases(alias, canonical) VALUES ('ally', 'alice');`)
+	d := openTestDB(t, Config{Path: path, MaintenanceInterval: -1})
+	var ns, canonical string
+	if err := d.Reader().QueryRow(`SELECT namespace, canonical FROM entity_aliases WHERE alias = 'ally'`).Scan(&ns, &canonical); err != nil {
+		t.Fatal(err)
+	}
+	if ns != "default" || canonical != "alice" {
+		t.Errorf("alias ally in %q to %q, want default to alice", ns, canonical)
+	}
+	if _, err := d.DB().Exec(`INSERT INTO entity_aliases(namespace, alias, canonical) VALUES ('work', 'ally', 'allison')`); err != nil {
+		t.Errorf("the same alias in another namespace: %v", err)
+	}
+}
+
+func TestUpgradeKeepsTheUnlabelledTriplesIndex(t *testing.T) {
+	for _, version := range []int{2, 15} {
+		d := openTestDB(t, Config{Path: createAtVersion(t, version), MaintenanceInterval: -1})
+		var n int
+		if err := d.Reader().QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'idx_triples_unlabelled'`).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Errorf("upgraded from version %d: idx_triples_unlabelled missing", version)
+		}
+	}
+}
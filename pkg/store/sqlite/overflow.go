@@ -0,0 +1,73 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// StageOverflow records logs whose buffered inputs were evicted, so the next
+// consolidation distills them from the log instead. Logs already staged or
+// no longer stored are ignored.
+func (d *Database) StageOverflow(ctx context.Context, logIDs []string) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, id := range logIDs {
+		if _, err := tx.ExecContext(ctx, `
+            INSERT OR IGNORE INTO consolidation_overflow(log_id)
+            SELECT id FROM memory_logs WHERE id = ?;
+        `, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// OverflowLogs returns up to limit staged logs, oldest staged first.
+func (d *Database) OverflowLogs(ctx context.Context, limit int) ([]model.LogEntry, error) {
+	rows, err := d.reader.QueryContext(ctx, `
+        SELECT `+logColumns+`
+        FROM consolidation_overflow o JOIN memory_logs l ON l.id = o.log_id
+        ORDER BY o.staged_at, o.rowid
+        LIMIT ?;
+    `, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanLogs(rows)
+}
+
+// ClearOverflow unstages logs once they were consolidated.
+func (d *Database) ClearOverflow(ctx context.Context, logIDs []string) error {
+	return clearOverflow(ctx, d.db, logIDs)
+}
+
+// ClearOverflowTx is ClearOverflow within tx, a transaction on the writer.
+func (d *Database) ClearOverflowTx(ctx context.Context, tx *sql.Tx, logIDs []string) error {
+	return clearOverflow(ctx, tx, logIDs)
+}
+
+func clearOverflow(ctx context.Context, ex execer, logIDs []string) error {
+	for start := 0; start < len(logIDs); start += pruneBatch {
+		end := min(start+pruneBatch, len(logIDs))
+		args := make([]any, end-start)
+		for i, id := range logIDs[start:end] {
+			args[i] = id
+		}
+		if _, err := ex.ExecContext(ctx, `DELETE FROM consolidation_overflow WHERE log_id IN (`+placeholders(len(args))+`);`, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OverflowCount returns how many staged logs wait for consolidation.
+func (d *Database) OverflowCount(ctx context.Context) (int64, error) {
+	var n int64
+	err := d.reader.QueryRowContext(ctx, `SELECT COUNT(*) FROM consolidation_overflow;`).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,58 @@
+package sqlite
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+func TestOverflowStaging(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t, Config{Path: MemoryPath})
+	ids, _, err := d.InsertLogs(ctx, []model.SensoryInput{{Content: "a"}, {Content: "b"}, {Content: "c"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	staged := func() []string {
+		t.Helper()
+		logs, err := d.OverflowLogs(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, l := range logs {
+			out = append(out, l.Content)
+		}
+		return out
+	}
+
+	// unknown logs and logs staged twice are ignored
+	if err := d.StageOverflow(ctx, []string{ids[1], "missing", ids[0]}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.StageOverflow(ctx, []string{ids[1], ids[2]}); err != nil {
+		t.Fatal(err)
+	}
+	if got := staged(); !slices.Equal(got, []string{"b", "a", "c"}) {
+		t.Errorf("staged = %q, want b, a, c in staging order", got)
+	}
+	if logs, err := d.OverflowLogs(ctx, 1); err != nil || len(logs) != 1 {
+		t.Errorf("OverflowLogs(1) = %d logs, %v", len(logs), err)
+	}
+
+	if err := d.ClearOverflow(ctx, []string{ids[1]}); err != nil {
+		t.Fatal(err)
+	}
+	// a deleted log leaves the stage with it
+	if _, err := d.DeleteLogs(ctx, ids[2:]); err != nil {
+		t.Fatal(err)
+	}
+	if got := staged(); !slices.Equal(got, []string{"a"}) {
+		t.Errorf("staged = %q, want a", got)
+	}
+	if n, err := d.OverflowCount(ctx); err != nil || n != 1 {
+		t.Errorf("OverflowCount = %d, %v; want 1", n, err)
+	}
+}
@@ -0,0 +1,177 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/store/vector"
+)
+
+// PendingEmbedding is a queued log waiting to be embedded.
+type PendingEmbedding struct {
+	LogID    string
+	Content  string
+	Attempts int
+}
+
+// ClaimEmbeddings returns up to limit queued logs that are due for an attempt
+// and leases them for the given duration, so concurrent workers (or a worker
+// that crashed mid-flight) don't process the same log twice before the lease
+// expires. Rows survive restarts; an expired lease simply makes them due again.
+func (d *Database) ClaimEmbeddings(ctx context.Context, limit int, lease time.Duration) ([]PendingEmbedding, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	now := time.Now()
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+        SELECT q.log_id, l.content, q.attempts
+        FROM embedding_queue q
+        JOIN memory_logs l ON l.id = q.log_id
+        WHERE q.next_attempt_at <= ?
+        ORDER BY q.attempts ASC, q.enqueued_at ASC
+        LIMIT ?;
+    `, now.Unix(), limit)
+	if err != nil {
+		return nil, err
+	}
+	var out []PendingEmbedding
+	for rows.Next() {
+		var p PendingEmbedding
+		if err := rows.Scan(&p.LogID, &p.Content, &p.Attempts); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+
+	leaseUntil := now.Add(lease).Unix()
+	for _, p := range out {
+		if _, err := tx.ExecContext(ctx, `UPDATE embedding_queue SET next_attempt_at = ? WHERE log_id = ?`, leaseUntil, p.LogID); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ReleaseEmbeddings ends the leases ClaimEmbeddings took on logs that were
+// not attempted, making them due again right away.
+func (d *Database) ReleaseEmbeddings(ctx context.Context, logIDs []string) error {
+	if len(logIDs) == 0 {
+		return nil
+	}
+	args := make([]any, 0, len(logIDs)+1)
+	args = append(args, time.Now().Unix())
+	for _, id := range logIDs {
+		args = append(args, id)
+	}
+	_, err := d.db.ExecContext(ctx, `UPDATE embedding_queue SET next_attempt_at = ? WHERE log_id IN (`+placeholders(len(logIDs))+`);`, args...)
+	return err
+}
+
+// CompleteEmbedding removes a log from the embedding queue.
+func (d *Database) CompleteEmbedding(ctx context.Context, logID string) error {
+	_, err := d.db.ExecContext(ctx, `DELETE FROM embedding_queue WHERE log_id = ?`, logID)
+	return err
+}
+
+// FailEmbedding records a failed embedding attempt and schedules the next one.
+func (d *Database) FailEmbedding(ctx context.Context, logID string, cause error, retryAt time.Time) error {
+	_, err := d.db.ExecContext(ctx, `
+        UPDATE embedding_queue SET attempts = attempts + 1, last_error = ?, next_attempt_at = ?
+        WHERE log_id = ?;
+    `, cause.Error(), retryAt.Unix(), logID)
+	return err
+}
+
+// EmbeddingState is where one log stands in the embedding pipeline.
+type EmbeddingState struct {
+	// Indexed is set when the vector index holds an embedding of the log.
+	Indexed bool
+	// Queued is set while the log waits in the embedding queue; Attempts
+	// and LastError describe its failed attempts so far.
+	Queued    bool
+	Attempts  int
+	LastError string
+}
+
+// LogEmbeddingState reports the embedding state of a log. The vector index
+// is only consulted when indexed is set, since its payload table does not
+// exist while vector search is disabled.
+func (d *Database) LogEmbeddingState(ctx context.Context, logID string, indexed bool) (EmbeddingState, error) {
+	var st EmbeddingState
+	if indexed {
+		err := d.reader.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM `+vector.PayloadTable+` WHERE log_id = ?);`, logID).Scan(&st.Indexed)
+		if err != nil {
+			return st, err
+		}
+	}
+	var lastErr sql.NullString
+	err := d.reader.QueryRowContext(ctx,
+		`SELECT attempts, last_error FROM embedding_queue WHERE log_id = ?;`, logID).Scan(&st.Attempts, &lastErr)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return st, nil
+	case err != nil:
+		return st, err
+	}
+	st.Queued = true
+	st.LastError = lastErr.String
+	return st, nil
+}
+
+// EnqueueAllLogs queues every memory log for embedding and makes entries
+// already queued due immediately with a fresh attempt count. It returns the
+// number of logs queued.
+func (d *Database) EnqueueAllLogs(ctx context.Context) (int64, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	n, err := enqueueAllLogs(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+func enqueueAllLogs(ctx context.Context, tx *sql.Tx) (int64, error) {
+	if err := execAll(ctx, tx,
+		`UPDATE embedding_queue SET attempts = 0, last_error = NULL, next_attempt_at = 0;`,
+		`INSERT OR IGNORE INTO embedding_queue(log_id) SELECT id FROM memory_logs;`,
+	); err != nil {
+		return 0, err
+	}
+	var n int64
+	err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM embedding_queue;`).Scan(&n)
+	return n, err
+}
+
+// PendingEmbeddingCount returns the number of logs waiting for an embedding.
+func (d *Database) PendingEmbeddingCount(ctx context.Context) (int64, error) {
+	var n int64
+	if err := d.reader.QueryRowContext(ctx, `SELECT COUNT(*) FROM embedding_queue;`).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,86 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+func claimIDs(t *testing.T, d *Database, limit int, lease time.Duration) []string {
+	t.Helper()
+	claimed, err := d.ClaimEmbeddings(context.Background(), limit, lease)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, len(claimed))
+	for i, p := range claimed {
+		ids[i] = p.LogID
+	}
+	return ids
+}
+
+func TestEmbeddingQueue(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t, Config{Path: MemoryPath})
+	if _, err := d.InsertLog(ctx, model.SensoryInput{Content: "not queued"}); err != nil {
+		t.Fatal(err)
+	}
+	first, err := d.InsertLogPendingEmbedding(ctx, model.SensoryInput{Content: "first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := d.InsertLogPendingEmbedding(ctx, model.SensoryInput{Content: "second"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := d.PendingEmbeddingCount(ctx); err != nil || n != 2 {
+		t.Fatalf("PendingEmbeddingCount = %d, %v; want 2", n, err)
+	}
+
+	// a claimed log is leased: nobody else gets it until it is released
+	if got := claimIDs(t, d, 1, time.Hour); len(got) != 1 || got[0] != first {
+		t.Fatalf("first claim = %q, want %s", got, first)
+	}
+	if got := claimIDs(t, d, 10, time.Hour); len(got) != 1 || got[0] != second {
+		t.Fatalf("second claim = %q, want only %s", got, second)
+	}
+	if got := claimIDs(t, d, 10, time.Hour); len(got) != 0 {
+		t.Fatalf("claim with every log leased = %q", got)
+	}
+
+	// a failed attempt is due again at its retry time, behind untried logs
+	if err := d.FailEmbedding(ctx, first, errors.New("embedder unavailable"), time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ReleaseEmbeddings(ctx, []string{second}); err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := d.ClaimEmbeddings(ctx, 10, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 2 || claimed[0].LogID != second || claimed[1].LogID != first || claimed[1].Attempts != 1 || claimed[1].Content != "first" {
+		t.Fatalf("claim after a failure = %+v, want %s, then %s with one attempt", claimed, second, first)
+	}
+
+	if err := d.CompleteEmbedding(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := d.PendingEmbeddingCount(ctx); err != nil || n != 1 {
+		t.Fatalf("PendingEmbeddingCount after completing one = %d, %v; want 1", n, err)
+	}
+}
+
+func TestInsertLogPendingEmbeddingRejectsEmptyContent(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t, Config{Path: MemoryPath})
+	if _, err := d.InsertLogPendingEmbedding(ctx, model.SensoryInput{}); err == nil {
+		t.Fatal("inserted a log without content")
+	}
+	if n, err := d.PendingEmbeddingCount(ctx); err != nil || n != 0 {
+		t.Fatalf("PendingEmbeddingCount = %d, %v; want nothing queued", n, err)
+	}
+}
@@ -0,0 +1,166 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+)
+
+// pruneBatch bounds the number of ids bound into one IN (...) clause.
+const pruneBatch = 500
+
+// PrunableLogs returns ids of logs eligible for retention pruning: logs older
+// than olderThan (if non-zero) and logs beyond the newest keep (if keep > 0).
+// Logs cited as provenance by a fact and ids in exclude are never returned.
+func (d *Database) PrunableLogs(ctx context.Context, olderThan time.Time, keep int, exclude []string) ([]string, error) {
+	if olderThan.IsZero() && keep <= 0 {
+		return nil, nil
+	}
+	var cutoff string
+	if !olderThan.IsZero() {
+		cutoff = olderThan.UTC().Format(TimeLayout)
+	}
+	rows, err := d.reader.QueryContext(ctx, `
+        SELECT id FROM memory_logs m
+        WHERE NOT EXISTS (SELECT 1 FROM triple_sources s WHERE s.log_id = m.id)
+          AND ((? <> '' AND m.timestamp < ?)
+            OR (? > 0 AND m.id NOT IN (
+                SELECT id FROM memory_logs ORDER BY timestamp DESC, rowid DESC LIMIT ?)))
+        ORDER BY m.timestamp;
+    `, cutoff, cutoff, keep, keep)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	skip := make(map[string]struct{}, len(exclude))
+	for _, id := range exclude {
+		skip[id] = struct{}{}
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		if _, ok := skip[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, rows.Err()
+}
+
+// DeleteLogs removes logs and their pending embedding queue entries, returning
+// how many logs were deleted.
+func (d *Database) DeleteLogs(ctx context.Context, ids []string) (int64, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var deleted int64
+	for start := 0; start < len(ids); start += pruneBatch {
+		end := start + pruneBatch
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batch := ids[start:end]
+		args := make([]any, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+		in := placeholders(len(batch))
+		if _, err := tx.ExecContext(ctx, `DELETE FROM embedding_queue WHERE log_id IN (`+in+`)`, args...); err != nil {
+			return 0, err
+		}
+		res, err := tx.ExecContext(ctx, `DELETE FROM memory_logs WHERE id IN (`+in+`)`, args...)
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		deleted += n
+	}
+	return deleted, tx.Commit()
+}
+
+// DeleteParams selects logs for DeleteLogsWhere. Empty fields match every
+// log, so a zero DeleteParams selects them all.
+type DeleteParams struct {
+	Namespace string
+	Source    string
+	// Before and After, when set, keep only logs with a timestamp strictly
+	// before or after them.
+	Before time.Time
+	After  time.Time
+}
+
+// IsZero reports whether p matches every log of its namespace.
+func (p DeleteParams) IsZero() bool {
+	return p.Source == "" && p.Before.IsZero() && p.After.IsZero()
+}
+
+// DeleteLogsWhere deletes the logs p selects in batches of 500, each in its
+// own transaction, so a large purge never holds the write lock for long.
+// before, when not nil, is called with the ids of every batch ahead of its
+// deletion, for cleanup outside this database such as vectors; a failure
+// stops the purge with that batch kept. It returns how many logs were
+// deleted, including those of batches completed before an error.
+func (d *Database) DeleteLogsWhere(ctx context.Context, p DeleteParams, before func(ids []string) error) (int64, error) {
+	cond := ` WHERE namespace = ?`
+	args := []any{namespaceOrDefault(p.Namespace)}
+	if p.Source != "" {
+		cond += ` AND source_type = ?`
+		args = append(args, p.Source)
+	}
+	if !p.Before.IsZero() {
+		cond += ` AND datetime(timestamp) < ?`
+		args = append(args, p.Before.UTC().Format(TimeLayout))
+	}
+	if !p.After.IsZero() {
+		cond += ` AND datetime(timestamp) > ?`
+		args = append(args, p.After.UTC().Format(TimeLayout))
+	}
+	args = append(args, pruneBatch)
+
+	var deleted int64
+	for {
+		// read through the writer: the reader may not see the previous
+		// batch's deletion yet and would hand its ids out again
+		rows, err := d.db.QueryContext(ctx, `SELECT id FROM memory_logs`+cond+` ORDER BY rowid LIMIT ?;`, args...)
+		if err != nil {
+			return deleted, err
+		}
+		var ids []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return deleted, err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return deleted, err
+		}
+		if len(ids) == 0 {
+			return deleted, nil
+		}
+		if before != nil {
+			if err := before(ids); err != nil {
+				return deleted, err
+			}
+		}
+		n, err := d.DeleteLogs(ctx, ids)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+		if len(ids) < pruneBatch {
+			return deleted, nil
+		}
+	}
+}
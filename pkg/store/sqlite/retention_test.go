@@ -0,0 +1,103 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+func TestDeleteLogsWhere(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t, Config{Path: MemoryPath})
+	day := func(n int) time.Time { return time.Date(2026, 1, n, 12, 0, 0, 0, time.UTC) }
+	if _, _, err := d.InsertLogs(ctx, []model.SensoryInput{
+		{Content: "chat 1", Source: "chat", Timestamp: day(1)},
+		{Content: "chat 2", Source: "chat", Timestamp: day(2)},
+		{Content: "mail 3", Source: "mail", Timestamp: day(3)},
+		{Content: "chat 4", Source: "chat", Timestamp: day(4)},
+		{Content: "work chat", Source: "chat", Namespace: "work", Timestamp: day(1)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	left := func() []string {
+		t.Helper()
+		logs, err := d.RecentLogsFiltered(ctx, 10, LogFilter{Namespace: model.DefaultNamespace})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, l := range logs {
+			out = append(out, l.Content)
+		}
+		slices.Sort(out)
+		return out
+	}
+
+	var seen []string
+	n, err := d.DeleteLogsWhere(ctx, DeleteParams{Source: "chat", After: day(1), Before: day(4)}, func(ids []string) error {
+		seen = append(seen, ids...)
+		return nil
+	})
+	if err != nil || n != 1 || len(seen) != 1 {
+		t.Fatalf("delete chat strictly between days 1 and 4 = %d, %v (saw %q); want chat 2", n, err, seen)
+	}
+	if got := left(); !slices.Equal(got, []string{"chat 1", "chat 4", "mail 3"}) {
+		t.Errorf("logs left = %q", got)
+	}
+
+	if n, err := d.DeleteLogsWhere(ctx, DeleteParams{Before: day(4)}, nil); err != nil || n != 2 {
+		t.Errorf("delete before day 4 = %d, %v; want chat 1 and mail 3", n, err)
+	}
+	if n, err := d.DeleteLogsWhere(ctx, DeleteParams{}, nil); err != nil || n != 1 {
+		t.Errorf("delete all = %d, %v; want chat 4", n, err)
+	}
+	work, err := d.RecentLogsFiltered(ctx, 10, LogFilter{Namespace: "work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(work) != 1 {
+		t.Errorf("%d work logs left, want the untouched one", len(work))
+	}
+}
+
+func TestDeleteLogsWhereInBatches(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t, Config{Path: MemoryPath})
+	inputs := make([]model.SensoryInput, 2*pruneBatch+1)
+	for i := range inputs {
+		inputs[i] = model.SensoryInput{Content: fmt.Sprintf("log %d", i), Source: "chat"}
+	}
+	if _, _, err := d.InsertLogs(ctx, inputs); err != nil {
+		t.Fatal(err)
+	}
+
+	var batches []int
+	boom := errors.New("boom")
+	n, err := d.DeleteLogsWhere(ctx, DeleteParams{Source: "chat"}, func(ids []string) error {
+		batches = append(batches, len(ids))
+		if len(batches) == 2 {
+			return boom
+		}
+		return nil
+	})
+	if !errors.Is(err, boom) || n != pruneBatch {
+		t.Fatalf("delete failing on the second batch = %d, %v; want the first batch deleted and the error", n, err)
+	}
+	if count, err := d.CountLogs(ctx); err != nil || count != int64(pruneBatch+1) {
+		t.Errorf("%d logs left (%v), want the failed batch kept", count, err)
+	}
+
+	batches = nil
+	n, err = d.DeleteLogsWhere(ctx, DeleteParams{Source: "chat"}, func(ids []string) error {
+		batches = append(batches, len(ids))
+		return nil
+	})
+	if err != nil || n != int64(pruneBatch+1) || !slices.Equal(batches, []int{pruneBatch, 1}) {
+		t.Errorf("delete the rest = %d, %v in batches %v", n, err, batches)
+	}
+}
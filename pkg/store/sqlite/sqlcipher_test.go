@@ -0,0 +1,68 @@
+//go:build libsqlite3
+
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// These run only in a -tags libsqlite3 build, the one that can link
+// SQLCipher, and skip when the linked library is plain SQLite.
+
+func openKeyed(path, key string) (*Database, error) {
+	return New(context.Background(), Config{Path: path, EncryptionKey: key, MaintenanceInterval: -1, ReadConns: 2,
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+}
+
+func TestEncryptedRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "paim.db")
+	d, err := openKeyed(path, "old key")
+	if errors.Is(err, ErrEncryptionUnsupported) {
+		t.Skip("linked SQLite is not SQLCipher")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := d.InsertLog(ctx, model.SensoryInput{Content: "Alice works at Acme."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Encrypted() {
+		t.Error("keyed database does not report encryption")
+	}
+	if err := d.Rekey(ctx, "new 'key'"); err != nil {
+		t.Fatal(err)
+	}
+	// read connections keyed before the rekey are replaced
+	for i := 0; i < 4; i++ {
+		if logs, err := d.FetchLogs(ctx, []string{id}); err != nil || len(logs) != 1 {
+			t.Fatalf("FetchLogs after rekey = %d logs, %v", len(logs), err)
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := openKeyed(path, "old key"); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("open with the old key = %v, want ErrWrongKey", err)
+	}
+	if _, err := openKeyed(path, ""); !errors.Is(err, ErrKeyRequired) {
+		t.Errorf("open without a key = %v, want ErrKeyRequired", err)
+	}
+	d, err = openKeyed(path, "new 'key'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if logs, err := d.FetchLogs(ctx, []string{id}); err != nil || len(logs) != 1 || logs[0].Content != "Alice works at Acme." {
+		t.Errorf("FetchLogs with the new key = %+v, %v", logs, err)
+	}
+}
@@ -7,26 +7,89 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"sync/atomic"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/johncui/PAIM/pkg/store/vector"
 )
 
+// MemoryPath as Config.Path keeps the database in memory instead of a file.
+// Each New gets a database of its own, shared by its writer and read pool and
+// lost on Close; it has no WAL, so readers and the writer take turns.
+const MemoryPath = ":memory:"
+
+// memoryDBs numbers in-memory databases so engines never share one.
+var memoryDBs atomic.Uint64
+
 // Config controls SQLite initialization.
 type Config struct {
 	Path           string
 	ExtensionsPath string
 	EnableVSS      bool
-	VectorDim      int
-	Logger         *slog.Logger
+	// VectorBackend selects the vector extension: "vss" (default) or "vec".
+	VectorBackend string
+	VectorDim     int
+	// MigrateDim lets New rebuild a vector table created with a different
+	// dimension instead of failing with ErrVectorDimMismatch.
+	MigrateDim bool
+	// ReadConns sizes the read-only connection pool (default 4).
+	ReadConns int
+	Logger    *slog.Logger
+	// MaintenanceInterval is how often Maintain runs in the background
+	// (default DefaultMaintenanceInterval; negative disables it).
+	MaintenanceInterval time.Duration
+	// CheckpointWALBytes is the WAL size above which Maintain truncates the
+	// WAL (default DefaultCheckpointWALBytes).
+	CheckpointWALBytes int64
+
+	// ReadOnly opens the file with mode=ro for serving a snapshot: nothing
+	// is migrated or created, so the schema must already be current, and
+	// the maintenance loop does not run.
+	ReadOnly bool
+
+	// EncryptionKey encrypts the database with SQLCipher; the binary must
+	// be linked against it (see ErrEncryptionUnsupported). Every connection
+	// is keyed as it opens, and a wrong key fails New with ErrWrongKey.
+	EncryptionKey string
+
+	// UniqueContentSources lists the sources stored exactly once by
+	// content: InsertLogs returns the id of a stored log of the same
+	// namespace and source with the same content instead of adding one.
+	UniqueContentSources []string
 }
 
-// Database wraps the sql.DB handle with feature flags.
+// slowQuery is the duration above which reads are logged as slow.
+const slowQuery = 250 * time.Millisecond
+
+// Database wraps two handles on the same WAL-mode file: a single-connection
+// writer that serializes every mutation, and a read-only pool so queries run
+// concurrently with writes and with each other.
 type Database struct {
-	db        *sql.DB
-	enableVSS bool
-	vectorDim int
-	logger    *slog.Logger
+	db         *sql.DB
+	reader     *sql.DB
+	path       string
+	enableVSS  bool
+	backend    vector.Backend
+	vectorDim  int
+	migrateDim bool
+	logger     *slog.Logger
+
+	schemaVersion int
+	readOnly      bool
+	inMemory      bool
+	cipher        *cipher
+	// extensionsPath is the vector extension loaded, and vectorVersion the
+	// version it reported.
+	extensionsPath string
+	vectorVersion  string
+	// uniqueSources is Config.UniqueContentSources.
+	uniqueSources map[string]bool
+
+	checkpointWALBytes int64
+	stopMaintenance    chan struct{}
+	maintenanceDone    chan struct{}
 }
 
 // New opens the database, loads extensions if requested, and ensures schema.
@@ -41,108 +104,216 @@ func New(ctx context.Context, cfg Config) (*Database, error) {
 	if cfg.Logger == nil {
 		cfg.Logger = slog.New(slog.NewTextHandler(os.Stdout, nil))
 	}
-
-	dsn := fmt.Sprintf("file:%s?_foreign_keys=on&_journal_mode=WAL&_busy_timeout=5000&_synchronous=NORMAL", cfg.Path)
-	db, err := sql.Open("sqlite3", dsn)
+	if cfg.ReadConns <= 0 {
+		cfg.ReadConns = 4
+	}
+	if cfg.MaintenanceInterval == 0 {
+		cfg.MaintenanceInterval = DefaultMaintenanceInterval
+	}
+	if cfg.CheckpointWALBytes <= 0 {
+		cfg.CheckpointWALBytes = DefaultCheckpointWALBytes
+	}
+	backend, err := vector.BackendByName(cfg.VectorBackend)
 	if err != nil {
 		return nil, err
 	}
+
+	inMemory := cfg.Path == MemoryPath
+	dsn := fmt.Sprintf("file:%s?_foreign_keys=on&_journal_mode=WAL&_busy_timeout=5000&_synchronous=NORMAL", cfg.Path)
+	readerDSN := fmt.Sprintf("file:%s?mode=ro&_foreign_keys=on&_busy_timeout=5000", cfg.Path)
+	// the connections stay open for good: the memdb VFS frees the database
+	// with the last one
+	idle := 5 * time.Minute
+	switch {
+	case inMemory && cfg.ReadOnly:
+		return nil, errors.New("an in-memory database cannot be read-only")
+	case inMemory && cfg.EncryptionKey != "":
+		return nil, errors.New("an in-memory database cannot be encrypted")
+	case inMemory:
+		name := fmt.Sprintf("/paim-%d", memoryDBs.Add(1))
+		dsn = fmt.Sprintf("file:%s?vfs=memdb&_foreign_keys=on&_busy_timeout=5000", name)
+		readerDSN = fmt.Sprintf("file:%s?vfs=memdb&mode=ro&_foreign_keys=on&_busy_timeout=5000", name)
+		idle = 0
+	case cfg.ReadOnly:
+		if _, err := os.Stat(cfg.Path); err != nil {
+			return nil, fmt.Errorf("read-only database: %w", err)
+		}
+		dsn = readerDSN
+	}
+	var (
+		ciph    *cipher
+		pragmas []string
+	)
+	if cfg.EncryptionKey != "" {
+		ciph = &cipher{key: cfg.EncryptionKey}
+		if !cfg.ReadOnly {
+			// these read the file, so they wait for the key
+			dsn = fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000", cfg.Path)
+			pragmas = []string{`PRAGMA journal_mode = WAL;`, `PRAGMA synchronous = NORMAL;`}
+		}
+	}
+	var (
+		db            *sql.DB
+		vectorVersion string
+	)
+	switch {
+	case cfg.EnableVSS:
+		if cfg.ExtensionsPath == "" {
+			cfg.ExtensionsPath = os.Getenv("GO_SQLITE3_EXTENSIONS")
+		}
+		cfg.Logger.Info("loading sqlite extension", "path", cfg.ExtensionsPath)
+		if db, err = openWithExtension(ctx, dsn, cfg.ExtensionsPath, ciph, pragmas...); err != nil {
+			if err = keyError(err, ciph != nil); IsKeyError(err) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w: load sqlite-%s extension %q: %v", ErrVectorUnavailable, backend.Name(), cfg.ExtensionsPath, err)
+		}
+		if err := db.QueryRowContext(ctx, backend.VersionSQL()).Scan(&vectorVersion); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("%w: %q is not the sqlite-%s extension: %v", ErrVectorUnavailable, cfg.ExtensionsPath, backend.Name(), err)
+		}
+		cfg.Logger.Info("vector search available", "backend", backend.Name(), "version", vectorVersion)
+	case ciph != nil:
+		if db, err = openDB(ctx, dsn, "", ciph, pragmas...); err != nil {
+			return nil, err
+		}
+	default:
+		if db, err = sql.Open("sqlite3", dsn); err != nil {
+			return nil, err
+		}
+	}
 	db.SetMaxOpenConns(1)
-	db.SetConnMaxIdleTime(5 * time.Minute)
+	db.SetConnMaxIdleTime(idle)
 
-	wrapper := &Database{db: db, enableVSS: cfg.EnableVSS, vectorDim: cfg.VectorDim, logger: cfg.Logger}
+	wrapper := &Database{db: db, path: cfg.Path, enableVSS: cfg.EnableVSS, backend: backend, vectorDim: cfg.VectorDim, migrateDim: cfg.MigrateDim, logger: cfg.Logger,
+		checkpointWALBytes: cfg.CheckpointWALBytes, readOnly: cfg.ReadOnly, inMemory: inMemory, cipher: ciph,
+		extensionsPath: cfg.ExtensionsPath, vectorVersion: vectorVersion}
+	for _, s := range cfg.UniqueContentSources {
+		if wrapper.uniqueSources == nil {
+			wrapper.uniqueSources = make(map[string]bool)
+		}
+		wrapper.uniqueSources[s] = true
+	}
 
+	ensure := wrapper.ensureSchema
+	if cfg.ReadOnly {
+		ensure = wrapper.checkSchema
+	}
+	if err := ensure(ctx); err != nil {
+		db.Close()
+		return nil, keyError(err, ciph != nil)
+	}
 	if cfg.EnableVSS {
-		if err := wrapper.loadExtension(ctx, cfg.ExtensionsPath); err != nil {
-			return nil, fmt.Errorf("load sqlite-vss extension: %w", err)
+		// a table made by another build of the extension may not open
+		if _, err := db.ExecContext(ctx, backend.ProbeSQL()); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("%w: query %s with the sqlite-%s extension at %q: %v",
+				ErrVectorUnavailable, backend.Table(), backend.Name(), cfg.ExtensionsPath, err)
 		}
 	}
 
-	if err := wrapper.ensureSchema(ctx); err != nil {
-		return nil, err
+	// opened after the schema exists; mode=ro makes any write attempt fail.
+	// Every pooled connection loads the extension too, so vector searches
+	// can run on the pool.
+	var reader *sql.DB
+	switch {
+	case cfg.EnableVSS:
+		reader, err = openWithExtension(ctx, readerDSN, cfg.ExtensionsPath, ciph)
+	case ciph != nil:
+		reader, err = openDB(ctx, readerDSN, "", ciph)
+	default:
+		reader, err = sql.Open("sqlite3", readerDSN)
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open read pool: %w", err)
+	}
+	reader.SetMaxOpenConns(cfg.ReadConns)
+	reader.SetMaxIdleConns(cfg.ReadConns)
+	reader.SetConnMaxIdleTime(idle)
+	if err := reader.PingContext(ctx); err != nil {
+		reader.Close()
+		db.Close()
+		return nil, fmt.Errorf("open read pool: %w", err)
+	}
+	wrapper.reader = reader
+	if cfg.MaintenanceInterval > 0 && !cfg.ReadOnly && !inMemory {
+		wrapper.startMaintenance(cfg.MaintenanceInterval)
 	}
 
 	return wrapper, nil
 }
 
-func (d *Database) loadExtension(ctx context.Context, extPath string) error {
-	if extPath == "" {
-		if env := os.Getenv("GO_SQLITE3_EXTENSIONS"); env != "" {
-			extPath = env
-		}
+// ensureSchema runs pending migrations, then creates the vector tables. The
+// latter live outside the migration history because they depend on which
+// extension is loaded for this run.
+func (d *Database) ensureSchema(ctx context.Context) error {
+	if err := d.migrate(ctx); err != nil {
+		return err
 	}
-	if extPath == "" {
-		return errors.New("extension path not provided")
+	if !d.enableVSS {
+		return nil
 	}
+	return d.ensureVectorTable(ctx, d.migrateDim)
+}
 
-	dsn := fmt.Sprintf("file:%s", extPath)
-	d.logger.Info("loading sqlite extension", "path", dsn)
-
-	conn, err := d.db.Conn(ctx)
+// checkSchema is ensureSchema for a read-only database: it changes nothing
+// and fails unless the schema and the vector table are already what this
+// binary would have made them.
+func (d *Database) checkSchema(ctx context.Context) error {
+	var current int
+	if err := d.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations;`).Scan(&current); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	if latest := latestSchemaVersion(); current != latest {
+		return fmt.Errorf("database schema version %d does not match supported version %d; open it read-write once to migrate", current, latest)
+	}
+	d.schemaVersion = current
+	if !d.enableVSS {
+		return nil
+	}
+	stored, err := d.storedVectorDim(ctx)
 	if err != nil {
-		return err
+		return fmt.Errorf("read vector dimension: %w", err)
 	}
-	defer conn.Close()
-
-	// enable extension loading per connection
-	if _, err := conn.ExecContext(ctx, "PRAGMA busy_timeout=5000; PRAGMA foreign_keys=ON; PRAGMA journal_mode=WAL; PRAGMA enable_load_extension=1;"); err != nil {
-		return err
+	if stored == 0 {
+		return fmt.Errorf("no %s table; open the database read-write once with vector search enabled", d.backend.Table())
 	}
-	if _, err := conn.ExecContext(ctx, "SELECT load_extension(?)", extPath); err != nil {
-		return err
+	if stored != d.vectorDim {
+		return fmt.Errorf("%w: %s holds %d-dimensional vectors but %d is configured",
+			ErrVectorDimMismatch, d.backend.Table(), stored, d.vectorDim)
 	}
 	return nil
 }
 
-func (d *Database) ensureSchema(ctx context.Context) error {
-	stmts := []string{
-		`CREATE TABLE IF NOT EXISTS memory_logs (
-            id TEXT PRIMARY KEY,
-            timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
-            source_type TEXT,
-            content TEXT,
-            metadata JSON
-        );`,
-		`CREATE TABLE IF NOT EXISTS triples (
-            id INTEGER PRIMARY KEY AUTOINCREMENT,
-            subject TEXT NOT NULL,
-            predicate TEXT NOT NULL,
-            object TEXT NOT NULL,
-            confidence REAL DEFAULT 1.0,
-            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-            UNIQUE(subject, predicate, object)
-        );`,
-		`CREATE INDEX IF NOT EXISTS idx_subject ON triples(subject);`,
-		`CREATE INDEX IF NOT EXISTS idx_object ON triples(object);`,
-	}
-
-	// vector schema if enabled
-	if d.enableVSS {
-		stmts = append(stmts,
-			fmt.Sprintf(`CREATE VIRTUAL TABLE IF NOT EXISTS vss_memories USING vss0(content_embedding(%d));`, d.vectorDim),
-			`CREATE TABLE IF NOT EXISTS vss_payload (
-                rowid INTEGER PRIMARY KEY,
-                log_id TEXT NOT NULL
-            );`,
-		)
-	}
-
-	for _, stmt := range stmts {
-		if _, err := d.db.ExecContext(ctx, stmt); err != nil {
-			return err
-		}
-	}
-	return nil
+// DB returns the writer handle; it is the same as Writer.
+func (d *Database) DB() *sql.DB {
+	return d.db
 }
 
-// DB returns the underlying database handle.
-func (d *Database) DB() *sql.DB {
+// Writer returns the single-connection handle all mutations go through.
+func (d *Database) Writer() *sql.DB {
 	return d.db
 }
 
-// Close releases the database.
+// Reader returns the read-only connection pool.
+func (d *Database) Reader() *sql.DB {
+	return d.reader
+}
+
+// Close stops the maintenance loop and releases both handles.
 func (d *Database) Close() error {
-	return d.db.Close()
+	if d.stopMaintenance != nil {
+		close(d.stopMaintenance)
+		<-d.maintenanceDone
+		d.stopMaintenance = nil
+	}
+	return errors.Join(d.reader.Close(), d.db.Close())
+}
+
+// Path returns the database file path.
+func (d *Database) Path() string {
+	return d.path
 }
 
 // HasVSS indicates whether vector search is available.
@@ -150,7 +321,62 @@ func (d *Database) HasVSS() bool {
 	return d.enableVSS
 }
 
+// VectorVersion returns the version the vector extension reported, or ""
+// without vector search.
+func (d *Database) VectorVersion() string {
+	return d.vectorVersion
+}
+
+// VectorBackend returns the configured vector extension backend.
+func (d *Database) VectorBackend() vector.Backend {
+	return d.backend
+}
+
+// ReadOnly reports whether the database was opened with Config.ReadOnly;
+// the writer handle then rejects every write.
+func (d *Database) ReadOnly() bool {
+	return d.readOnly
+}
+
+// Encrypted reports whether the database was opened with an encryption key.
+func (d *Database) Encrypted() bool {
+	return d.cipher != nil
+}
+
+// InMemory reports whether the database was opened at MemoryPath.
+func (d *Database) InMemory() bool {
+	return d.inMemory
+}
+
+// SchemaVersion returns the migration version the database is at.
+func (d *Database) SchemaVersion() int {
+	return d.schemaVersion
+}
+
+// Ping checks that the database file still exists and answers a query.
+func (d *Database) Ping(ctx context.Context) error {
+	if !d.inMemory {
+		if _, err := os.Stat(d.path); err != nil {
+			return fmt.Errorf("database file: %w", err)
+		}
+	}
+	for _, h := range []*sql.DB{d.db, d.reader} {
+		var one int
+		if err := h.QueryRowContext(ctx, `SELECT 1;`).Scan(&one); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // VectorDim returns configured embedding dimension.
 func (d *Database) VectorDim() int {
 	return d.vectorDim
 }
+
+// IsBusy reports whether err is SQLite giving up on a lock held by another
+// connection or process, which is worth retrying later.
+func IsBusy(err error) bool {
+	var se sqlite3.Error
+	return errors.As(err, &se) && (se.Code == sqlite3.ErrBusy || se.Code == sqlite3.ErrLocked)
+}
@@ -0,0 +1,61 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// An in-memory database has no WAL, so this only holds for files.
+func TestReadsProceedDuringAWriteTransaction(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t, Config{Path: filepath.Join(t.TempDir(), "paim.db"), MaintenanceInterval: -1, ReadConns: 4})
+	id, err := d.InsertLog(ctx, model.SensoryInput{Content: "committed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := d.Writer().BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `UPDATE memory_logs SET content = 'uncommitted';`); err != nil {
+		t.Fatal(err)
+	}
+
+	// readers neither wait for the writer nor see its changes
+	rctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			logs, err := d.FetchLogs(rctx, []string{id})
+			if err == nil && (len(logs) != 1 || logs[0].Content != "committed") {
+				t.Errorf("FetchLogs during the write = %+v", logs)
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("read during the write: %v", err)
+		}
+	}
+	if n, err := d.CountLogs(rctx); err != nil || n != 1 {
+		t.Fatalf("CountLogs during the write = %d, %v", n, err)
+	}
+}
+
+func TestReaderCannotWrite(t *testing.T) {
+	for _, path := range []string{filepath.Join(t.TempDir(), "paim.db"), MemoryPath} {
+		d := openTestDB(t, Config{Path: path, MaintenanceInterval: -1})
+		_, err := d.Reader().ExecContext(context.Background(), `INSERT INTO memory_logs(id, content) VALUES ('log-1', 'a');`)
+		if err == nil {
+			t.Errorf("%s: write through the reader succeeded", path)
+		}
+	}
+}
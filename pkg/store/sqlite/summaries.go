@@ -0,0 +1,104 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// SummaryCandidates returns up to limit logs older than olderThan that
+// neither are summaries nor have been summarized, oldest first.
+func (d *Database) SummaryCandidates(ctx context.Context, olderThan time.Time, limit int) ([]model.LogEntry, error) {
+	rows, err := d.reader.QueryContext(ctx, `
+        SELECT `+logColumns+`
+        FROM memory_logs l
+        WHERE l.timestamp < ? AND l.summarized_into IS NULL AND l.source_type <> ?
+        ORDER BY l.timestamp, l.rowid
+        LIMIT ?;
+    `, olderThan.UTC().Format(TimeLayout), model.SummarySource, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanLogs(rows)
+}
+
+// InsertSummary stores summary as a log dated at and marks the originals as
+// summarized into it, enqueueing the summary for embedding when enqueue is
+// set, all in one transaction. It returns the id of the summary.
+func (d *Database) InsertSummary(ctx context.Context, summary model.SensoryInput, at time.Time, originals []string, enqueue bool) (string, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	id := uuid.NewString()
+	metaBytes, _ := json.Marshal(summary.Metadata)
+	if _, err := tx.ExecContext(ctx, `
+        INSERT INTO memory_logs(id, timestamp, source_type, content, metadata, namespace, session_id, content_hash)
+        VALUES(?, ?, ?, ?, ?, ?, ?, ?);
+    `, id, at.UTC().Format(TimeLayout), summary.Source, summary.Content, string(metaBytes),
+		namespaceOrDefault(summary.Namespace), sessionOrNull(summary.SessionID), ContentHash(summary.Content)); err != nil {
+		return "", err
+	}
+	if enqueue {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO embedding_queue(log_id) VALUES (?)`, id); err != nil {
+			return "", err
+		}
+	}
+	if err := markSummarized(ctx, tx, id, originals); err != nil {
+		return "", err
+	}
+	return id, tx.Commit()
+}
+
+func markSummarized(ctx context.Context, tx *sql.Tx, summaryID string, ids []string) error {
+	for start := 0; start < len(ids); start += pruneBatch {
+		end := min(start+pruneBatch, len(ids))
+		args := []any{summaryID}
+		for _, id := range ids[start:end] {
+			args = append(args, id)
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE memory_logs SET summarized_into = ? WHERE id IN (`+placeholders(end-start)+`)`, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UncitedLogs returns the ids among ids that no fact cites as provenance.
+func (d *Database) UncitedLogs(ctx context.Context, ids []string) ([]string, error) {
+	var out []string
+	for start := 0; start < len(ids); start += pruneBatch {
+		end := min(start+pruneBatch, len(ids))
+		args := make([]any, 0, end-start)
+		for _, id := range ids[start:end] {
+			args = append(args, id)
+		}
+		rows, err := d.reader.QueryContext(ctx, `
+            SELECT id FROM memory_logs m
+            WHERE id IN (`+placeholders(end-start)+`)
+              AND NOT EXISTS (SELECT 1 FROM triple_sources s WHERE s.log_id = m.id);
+        `, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			out = append(out, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,145 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/store/vector"
+)
+
+// ErrLogModified is returned by UpdateLog when the log changed after the
+// time the patch expects.
+var ErrLogModified = errors.New("log was modified")
+
+// updatedAtLayout keeps nanoseconds, unlike TimeLayout, so that the check
+// against LogPatch.UnmodifiedSince tells apart updates within one second.
+const updatedAtLayout = "2006-01-02 15:04:05.000000000"
+
+// LogPatch is a partial update of a memory log; nil fields are left as they
+// are.
+type LogPatch struct {
+	Content    *string
+	SourceType *string
+	// Metadata is merged into the stored metadata as a JSON merge patch
+	// (RFC 7396): nested objects are merged, and a nil value removes its
+	// key. With ReplaceMetadata set it replaces the stored metadata instead.
+	Metadata        map[string]any
+	ReplaceMetadata bool
+	// UnmodifiedSince, when set, makes the update fail with ErrLogModified
+	// unless the log's updated_at (its timestamp, if it was never updated)
+	// equals it.
+	UnmodifiedSince time.Time
+	// At is the updated_at to record; zero means now.
+	At time.Time
+}
+
+// UpdateLog applies patch to a log in one transaction. It returns
+// sql.ErrNoRows when the log does not exist. A stored embedding of the log
+// is dropped when its content changes, since it no longer matches.
+func (d *Database) UpdateLog(ctx context.Context, id string, patch LogPatch) error {
+	return d.updateLog(ctx, id, patch, false)
+}
+
+// UpdateLogPendingEmbedding is UpdateLog that also queues the log for
+// embedding, with a fresh attempt count, when its content changes.
+func (d *Database) UpdateLogPendingEmbedding(ctx context.Context, id string, patch LogPatch) error {
+	return d.updateLog(ctx, id, patch, true)
+}
+
+func (d *Database) updateLog(ctx context.Context, id string, patch LogPatch, enqueue bool) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var (
+		content, source string
+		meta            sql.NullString
+		ts              time.Time
+		updated         sql.NullTime
+	)
+	err = tx.QueryRowContext(ctx, `
+        SELECT content, COALESCE(source_type, ''), metadata, timestamp, updated_at FROM memory_logs WHERE id = ?;
+    `, id).Scan(&content, &source, &meta, &ts, &updated)
+	if err != nil {
+		return err
+	}
+	if !patch.UnmodifiedSince.IsZero() {
+		last := ts
+		if updated.Valid {
+			last = updated.Time
+		}
+		if !last.Equal(patch.UnmodifiedSince) {
+			return ErrLogModified
+		}
+	}
+
+	contentChanged := patch.Content != nil && *patch.Content != content
+	if patch.Content != nil {
+		content = *patch.Content
+	}
+	if patch.SourceType != nil {
+		source = *patch.SourceType
+	}
+	metadata := map[string]any{}
+	if meta.Valid && meta.String != "" {
+		_ = json.Unmarshal([]byte(meta.String), &metadata)
+	}
+	if patch.ReplaceMetadata {
+		metadata = patch.Metadata
+	} else if patch.Metadata != nil {
+		metadata = MergeMetadata(metadata, patch.Metadata)
+	}
+	metaBytes, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	at := patch.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+        UPDATE memory_logs SET content = ?, content_hash = ?, source_type = ?, metadata = ?, updated_at = ? WHERE id = ?;
+    `, content, ContentHash(content), source, string(metaBytes), at.UTC().Format(updatedAtLayout), id); err != nil {
+		return err
+	}
+	if contentChanged {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+vector.EmbeddingsTable+` WHERE log_id = ?`, id); err != nil {
+			return err
+		}
+		if enqueue {
+			if _, err := tx.ExecContext(ctx, `
+                INSERT INTO embedding_queue(log_id) VALUES (?)
+                ON CONFLICT(log_id) DO UPDATE SET attempts = 0, last_error = NULL, next_attempt_at = 0;
+            `, id); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// MergeMetadata applies patch to base as a JSON merge patch (RFC 7396) and
+// returns the result; base is modified in place.
+func MergeMetadata(base, patch map[string]any) map[string]any {
+	if base == nil {
+		base = map[string]any{}
+	}
+	for k, v := range patch {
+		switch v := v.(type) {
+		case nil:
+			delete(base, k)
+		case map[string]any:
+			sub, _ := base[k].(map[string]any)
+			base[k] = MergeMetadata(sub, v)
+		default:
+			base[k] = v
+		}
+	}
+	return base
+}
@@ -0,0 +1,108 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+func TestUpdateLog(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t, Config{Path: MemoryPath})
+	ids, _, err := d.InsertLogs(ctx, []model.SensoryInput{{
+		Content:  "draft",
+		Source:   "chat",
+		Metadata: map[string]any{"keep": "yes", "drop": true, "nested": map[string]any{"x": 1, "y": 2}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := ids[0]
+	if err := d.SaveEmbedding(ctx, id, "m", []float64{1, 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	source := "notes"
+	if err := d.UpdateLog(ctx, id, LogPatch{
+		SourceType: &source,
+		Metadata:   map[string]any{"drop": nil, "nested": map[string]any{"y": nil, "z": 3}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	l, err := d.FetchLog(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"keep": "yes", "nested": map[string]any{"x": float64(1), "z": float64(3)}}
+	if l.SourceType != "notes" || l.Content != "draft" || !reflect.DeepEqual(l.Metadata, want) {
+		t.Errorf("merged log = %+v, want source notes and metadata %v", l, want)
+	}
+	if l.UpdatedAt == nil {
+		t.Fatal("updated_at not set")
+	}
+	if v, err := d.StoredEmbedding(ctx, id, "m"); err != nil || v == nil {
+		t.Errorf("stored embedding after a metadata edit = %v, %v; want it kept", v, err)
+	}
+
+	stale := l.Timestamp
+	content := "final"
+	if err := d.UpdateLogPendingEmbedding(ctx, id, LogPatch{Content: &content, UnmodifiedSince: stale}); !errors.Is(err, ErrLogModified) {
+		t.Errorf("update against a stale time: %v, want ErrLogModified", err)
+	}
+	if err := d.UpdateLogPendingEmbedding(ctx, id, LogPatch{Content: &content, UnmodifiedSince: *l.UpdatedAt}); err != nil {
+		t.Fatalf("update against the current time: %v", err)
+	}
+	if v, err := d.StoredEmbedding(ctx, id, "m"); err != nil || v != nil {
+		t.Errorf("stored embedding after a content edit = %v, %v; want it dropped", v, err)
+	}
+	if n, err := d.PendingEmbeddingCount(ctx); err != nil || n != 1 {
+		t.Errorf("%d queued, %v; want the edited log", n, err)
+	}
+
+	if err := d.UpdateLog(ctx, id, LogPatch{ReplaceMetadata: true, Metadata: map[string]any{"only": "this"}}); err != nil {
+		t.Fatal(err)
+	}
+	if l, err := d.FetchLog(ctx, id); err != nil || !reflect.DeepEqual(l.Metadata, map[string]any{"only": "this"}) {
+		t.Errorf("replaced metadata = %v, %v", l.Metadata, err)
+	}
+
+	if err := d.UpdateLog(ctx, "missing", LogPatch{Content: &content}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("update of a missing log: %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestUpdatedAtTellsApartEditsWithinASecond(t *testing.T) {
+	ctx := context.Background()
+	d := openTestDB(t, Config{Path: MemoryPath})
+	ids, _, err := d.InsertLogs(ctx, []model.SensoryInput{{Content: "a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2026, 3, 1, 12, 0, 0, 100, time.UTC)
+	source := "x"
+	if err := d.UpdateLog(ctx, ids[0], LogPatch{SourceType: &source, At: at}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.UpdateLog(ctx, ids[0], LogPatch{SourceType: &source, UnmodifiedSince: at.Add(time.Nanosecond)}); !errors.Is(err, ErrLogModified) {
+		t.Errorf("update against a time 1ns off: %v, want ErrLogModified", err)
+	}
+	if err := d.UpdateLog(ctx, ids[0], LogPatch{SourceType: &source, UnmodifiedSince: at}); err != nil {
+		t.Errorf("update against the exact time: %v", err)
+	}
+}
+
+func TestMergeMetadata(t *testing.T) {
+	got := MergeMetadata(nil, map[string]any{"a": 1, "gone": nil, "n": map[string]any{"b": 2}})
+	if want := map[string]any{"a": 1, "n": map[string]any{"b": 2}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("merge into nil = %v, want %v", got, want)
+	}
+	got = MergeMetadata(map[string]any{"n": "scalar", "tags": []any{"x"}}, map[string]any{"n": map[string]any{"b": 2}, "tags": []any{"y"}})
+	if want := map[string]any{"n": map[string]any{"b": 2}, "tags": []any{"y"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("merge over scalars and arrays = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+)
+
+// EngineStats is a point-in-time summary of the engine's state. It lives in
+// model so API clients can decode it without importing the store.
+type EngineStats = model.EngineStats
+
+// Stats gathers counts with single COUNT queries plus in-memory state.
+func (m *MemoryEngine) Stats(ctx context.Context) (EngineStats, error) {
+	var st EngineStats
+	var err error
+	if st.Logs, err = m.db.CountLogs(ctx); err != nil {
+		return st, err
+	}
+	if st.Triples, err = m.graph.Count(ctx); err != nil {
+		return st, err
+	}
+	if st.Embeddings, err = m.vec.Count(ctx); err != nil {
+		return st, err
+	}
+	if st.PendingEmbeddings, err = m.db.PendingEmbeddingCount(ctx); err != nil {
+		return st, err
+	}
+	buf := m.buffer.Stats()
+	st.BufferLen = buf.Len
+	st.BufferOldestAgeSeconds = buf.OldestAge.Seconds()
+	st.BufferCapacity = buf.Capacity
+	st.BufferEvicted = buf.Evicted
+	st.BufferExpired = buf.Expired
+	if st.BufferOverflow, err = m.db.OverflowCount(ctx); err != nil {
+		return st, err
+	}
+	if path := m.db.Path(); path != "" && !m.db.InMemory() {
+		if st.DBSizeBytes, err = fileSize(path); err != nil {
+			return st, err
+		}
+		if st.WALSizeBytes, err = fileSize(path + "-wal"); err != nil {
+			return st, err
+		}
+	}
+	st.SchemaVersion = m.db.SchemaVersion()
+	st.EmbedderBreaker, st.EmbedderFailures = m.breaker.snapshot()
+	st.VectorSearch, st.VectorError = m.VectorStatus()
+	if st.VectorSearch == VectorEnabled {
+		st.VectorBackend = m.vec.Name()
+		st.VectorVersion = m.db.VectorVersion()
+	}
+
+	runs, err := m.db.ConsolidationRuns(ctx, 1)
+	if err != nil {
+		return st, err
+	}
+	if len(runs) > 0 {
+		st.LastConsolidationRun = &runs[0]
+	}
+
+	m.statsMu.Lock()
+	if !m.lastConsolidation.IsZero() {
+		t := m.lastConsolidation
+		st.LastConsolidation = &t
+	}
+	if !m.lastConsolidationFailure.IsZero() {
+		t := m.lastConsolidationFailure
+		st.LastConsolidationFailure = &t
+		st.LastConsolidationError = m.lastConsolidationError
+	}
+	m.statsMu.Unlock()
+	return st, nil
+}
+
+// BufferedInput is an input waiting in the sensory buffer for consolidation.
+type BufferedInput struct {
+	Seq        uint64             `json:"seq"`
+	BufferedAt time.Time          `json:"buffered_at"`
+	AgeSeconds float64            `json:"age_seconds"`
+	Input      model.SensoryInput `json:"input"`
+}
+
+// BufferedInputs lists the unexpired inputs of namespace waiting in the
+// sensory buffer, oldest first, for debugging consolidation.
+func (m *MemoryEngine) BufferedInputs(namespace string) ([]BufferedInput, error) {
+	namespace, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	out := []BufferedInput{}
+	for _, it := range m.buffer.SnapshotItems() {
+		if it.Input.Namespace != namespace {
+			continue
+		}
+		out = append(out, BufferedInput{Seq: it.Seq, BufferedAt: it.At, AgeSeconds: now.Sub(it.At).Seconds(), Input: it.Input})
+	}
+	return out, nil
+}
+
+func (m *MemoryEngine) recordConsolidation(err error) {
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+	if err != nil {
+		m.lastConsolidationFailure = time.Now()
+		m.lastConsolidationError = err.Error()
+		return
+	}
+	m.lastConsolidation = time.Now()
+}
+
+// fileSize returns a file's size, or 0 if it does not exist.
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,101 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+func TestStatsAfterObserveAndConsolidate(t *testing.T) {
+	ctx := context.Background()
+	d := &stubDistiller{}
+	m := storetest.NewTestEngineWithOptions(t, store.Options{
+		DBPath:    filepath.Join(t.TempDir(), "paim.db"),
+		Distiller: d,
+	})
+	observeAll(t, m, "a", "b")
+	if err := m.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	observeAll(t, m, "c")
+
+	st, err := m.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Logs != 3 || st.Triples != 2 || st.BufferLen != 1 || st.BufferCapacity == 0 {
+		t.Errorf("counts = %d logs, %d triples, %d/%d buffered; want 3, 2, 1/n",
+			st.Logs, st.Triples, st.BufferLen, st.BufferCapacity)
+	}
+	if st.DBSizeBytes == 0 || st.SchemaVersion == 0 {
+		t.Errorf("db size %d, schema version %d; want both set", st.DBSizeBytes, st.SchemaVersion)
+	}
+	if st.LastConsolidation == nil || st.LastConsolidationFailure != nil {
+		t.Errorf("consolidation times = %v, %v; want a success only", st.LastConsolidation, st.LastConsolidationFailure)
+	}
+	if run := st.LastConsolidationRun; run == nil || run.Error != "" || run.Inputs != 2 || run.TriplesWritten != 2 {
+		t.Errorf("last run = %+v, want 2 inputs turned into 2 triples", run)
+	}
+	if st.EmbedderBreaker == "" || st.VectorSearch != store.VectorDisabled {
+		t.Errorf("breaker %q, vector search %q", st.EmbedderBreaker, st.VectorSearch)
+	}
+
+	d.set(errors.New("model offline"), false)
+	if err := m.Consolidate(ctx); err == nil {
+		t.Fatal("Consolidate succeeded with a failing distiller")
+	}
+	if st, err = m.Stats(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if st.LastConsolidationFailure == nil || st.LastConsolidationError == "" || st.LastConsolidation == nil {
+		t.Errorf("after a failure: %v %q, last success %v", st.LastConsolidationFailure, st.LastConsolidationError, st.LastConsolidation)
+	}
+	if run := st.LastConsolidationRun; run == nil || run.Error == "" {
+		t.Errorf("last run = %+v, want the failure", run)
+	}
+}
+
+func TestBufferedInputs(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngineWithOptions(t, store.Options{BufferSize: 2, ConsolidateFillRatio: -1})
+	for _, in := range []model.SensoryInput{
+		{Content: "evicted", Namespace: "work"},
+		{Content: "first", Namespace: "work"},
+		{Content: "home", Namespace: "home"},
+	} {
+		if err := m.Observe(ctx, in); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	items, err := m.BufferedInputs("home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Input.Content != "home" || items[0].Input.LogID == "" || items[0].BufferedAt.IsZero() {
+		t.Errorf("home inputs = %+v, want the stored home input", items)
+	}
+	if items, err := m.BufferedInputs("work"); err != nil || len(items) != 1 || items[0].Input.Content != "first" {
+		t.Errorf("work inputs = %+v, %v; want only the one not evicted", items, err)
+	}
+	if items, err := m.BufferedInputs(""); err != nil || items == nil || len(items) != 0 {
+		t.Errorf("default inputs = %#v, %v; want an empty list", items, err)
+	}
+	if _, err := m.BufferedInputs("a b"); !errors.Is(err, store.ErrInvalidInput) {
+		t.Errorf("BufferedInputs of a malformed namespace: %v, want ErrInvalidInput", err)
+	}
+
+	st, err := m.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.BufferLen != 2 || st.BufferCapacity != 2 || st.BufferEvicted != 1 || st.BufferExpired != 0 {
+		t.Errorf("buffer stats = %d/%d, %d evicted, %d expired; want 2/2 and 1 evicted",
+			st.BufferLen, st.BufferCapacity, st.BufferEvicted, st.BufferExpired)
+	}
+}
@@ -3,42 +3,337 @@ package store
 import (
 	"context"
 	"crypto/sha256"
+	"database/sql"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"log/slog"
 	"math"
 	"os"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/johncui/PAIM/pkg/engine/distill"
+	"github.com/johncui/PAIM/pkg/engine/redact"
+	"github.com/johncui/PAIM/pkg/engine/summarize"
 	"github.com/johncui/PAIM/pkg/memory"
 	"github.com/johncui/PAIM/pkg/model"
 	"github.com/johncui/PAIM/pkg/store/graph"
+	"github.com/johncui/PAIM/pkg/store/postgres"
 	"github.com/johncui/PAIM/pkg/store/sqlite"
 	"github.com/johncui/PAIM/pkg/store/vector"
 )
 
+var (
+	// ErrNotFound is returned when a requested record does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidInput is returned when a request is malformed or unsafe.
+	ErrInvalidInput = errors.New("invalid input")
+	// ErrConflict is returned when a record changed since the caller read
+	// it.
+	ErrConflict = errors.New("conflict")
+	// ErrReadOnly is returned by every method that would write to an engine
+	// opened with Options.ReadOnly.
+	ErrReadOnly = errors.New("read-only")
+	// ErrVectorDimMismatch is returned by NewMemoryEngine when the vector
+	// table was built for a different VectorDim; see Options.MigrateDim.
+	ErrVectorDimMismatch = sqlite.ErrVectorDimMismatch
+	// ErrVectorUnavailable is returned by NewMemoryEngine with
+	// Options.VSSRequired set when the vector extension is missing, fails
+	// to load or cannot serve the vector table.
+	ErrVectorUnavailable = sqlite.ErrVectorUnavailable
+	// ErrWrongKey and ErrKeyRequired are returned by NewMemoryEngine when
+	// an encrypted database is opened with the wrong Options.EncryptionKey
+	// or none; ErrEncryptionUnsupported when the binary cannot encrypt.
+	ErrWrongKey              = sqlite.ErrWrongKey
+	ErrKeyRequired           = sqlite.ErrKeyRequired
+	ErrEncryptionUnsupported = sqlite.ErrEncryptionUnsupported
+)
+
+// MemoryPath as Options.DBPath keeps the database in memory.
+const MemoryPath = sqlite.MemoryPath
+
+// IsUnavailable reports whether err is transient: the database is locked by
+// another writer, PostgreSQL gave up on a conflict or lock, or the request
+// ran out of time.
+func IsUnavailable(err error) bool {
+	return sqlite.IsBusy(err) || postgres.IsBusy(err) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// DefaultMaxTopK caps recall results when Options.MaxTopK is unset.
+const DefaultMaxTopK = 100
+
+// DefaultMaxContentChars limits observed content when
+// Options.MaxContentChars is unset.
+const DefaultMaxContentChars = 32 * 1024
+
 // Options configures MemoryEngine.
 type Options struct {
-	DBPath         string
-	EnableVSS      bool
+	// DBPath is the database file, or MemoryPath for a database that lives
+	// in memory and is lost on Close, as for tests and ephemeral agents. A
+	// postgres:// or postgresql:// URL stores everything in PostgreSQL
+	// instead, with pgvector for vector search.
+	DBPath    string
+	EnableVSS bool
+	// VectorBackend selects the vector extension: "vss" (default) or "vec".
+	VectorBackend  string
 	ExtensionsPath string
 	VectorDim      int
-	BufferSize     int
-	BufferTTL      time.Duration
-	Embedder       model.EmbeddingClient
-	Distiller      distill.Distiller
-	Logger         *slog.Logger
+	// MigrateDim rebuilds a vector table created with a different VectorDim
+	// and queues every log for re-embedding, instead of failing with
+	// ErrVectorDimMismatch.
+	MigrateDim bool
+	// VSSRequired makes NewMemoryEngine fail with ErrVectorUnavailable when
+	// EnableVSS is set but the extension cannot provide vector search.
+	// Unset, the engine logs a warning and opens without vector search;
+	// VectorStatus and Stats report it as degraded.
+	VSSRequired bool
+	BufferSize  int
+	BufferTTL   time.Duration
+	// BufferDedup controls whether identical inputs (same content, source and
+	// namespace) are buffered more than once (default memory.DedupOff).
+	BufferDedup memory.DedupMode
+	Embedder    model.EmbeddingClient
+	// EmbedderModel names the embedding model (default HashEmbedderModel
+	// for the built-in HashEmbedder). It is recorded with the vectors so a model
+	// switch is reported at startup until Reindex has run.
+	EmbedderModel string
+	Distiller     distill.Distiller
+	Logger        *slog.Logger
+	// StoreEmbeddings keeps every log's embedding in the embeddings table,
+	// even with vector search disabled, so enabling it later indexes the
+	// stored vectors instead of re-embedding every log.
+	StoreEmbeddings bool
+	// SyncEmbedding embeds inside Observe instead of handing logs to the
+	// background embedding workers.
+	SyncEmbedding bool
+	// EmbedWorkers is the number of background embedding workers (async mode).
+	EmbedWorkers int
+	// FactMerge controls how re-observed triples update their confidence
+	// (default graph.MergeReinforce).
+	FactMerge graph.MergeStrategy
+	// FunctionalPredicates name the single-valued predicates, such as
+	// lives_in or prefers_* (a trailing '*' matches a prefix): a new value
+	// supersedes the subject's other values of the predicate, or deletes
+	// them per Contradictions (default graph.ContradictionSupersede).
+	// Recall skips superseded facts unless RecallOptions.IncludeSuperseded.
+	FunctionalPredicates []string
+	Contradictions       graph.ContradictionPolicy
+	// DisableEntityNormalization stores entities verbatim instead of trimmed
+	// and case-folded.
+	DisableEntityNormalization bool
+	// LogRetention prunes memory logs older than this age (0 keeps them).
+	LogRetention time.Duration
+	// MaxLogs prunes the oldest memory logs beyond this count (0 is unbounded).
+	MaxLogs int
+	// MaxTopK caps the number of results a recall may request (default
+	// DefaultMaxTopK); larger values are clamped.
+	MaxTopK int
+	// RankWeights tunes the merged ranking of recall results (zero value
+	// means DefaultRankWeights).
+	RankWeights RankWeights
+	// RecencyHalfLife, when positive, multiplies the ranked score of every
+	// recalled log and fact by a recency factor that halves with each
+	// RecencyHalfLife of age, so a slightly less similar but recent item
+	// can outrank an old near-match; RecallOptions.RecencyHalfLife
+	// overrides it per recall. Unlike the additive recency term of
+	// RankWeights it scales relevance itself. Zero disables it.
+	RecencyHalfLife time.Duration
+	// MaxContentChars limits the length of observed content in characters
+	// (default DefaultMaxContentChars). Longer input is rejected with
+	// ErrInvalidInput unless TruncateContent is set.
+	MaxContentChars int
+	// TruncateContent cuts content longer than MaxContentChars instead of
+	// rejecting it.
+	TruncateContent bool
+	// MaintenanceInterval is how often the WAL is checkpointed and PRAGMA
+	// optimize runs in the background (default hourly; negative disables
+	// it); see MemoryEngine.Maintain.
+	MaintenanceInterval time.Duration
+	// CheckpointWALBytes is the WAL size above which maintenance truncates
+	// the WAL (default 64 MiB).
+	CheckpointWALBytes int64
+	// ReadConns sizes the read-only connection pool used by queries
+	// (default 4).
+	ReadConns int
+	// ConsolidateFillRatio requests a consolidation once the buffer holds
+	// this fraction of BufferSize (default DefaultConsolidateFillRatio;
+	// negative disables the trigger).
+	ConsolidateFillRatio float64
+	// ConsolidateMinInterval is the least time between the end of one
+	// consolidation and a run the fill trigger requests; a request arriving
+	// sooner is deferred until then. Zero applies no minimum.
+	ConsolidateMinInterval time.Duration
+	// ConsolidationHistory is how many of the latest consolidation runs are
+	// kept in the database (default DefaultConsolidationHistory; negative
+	// records none).
+	ConsolidationHistory int
+	// EmbedTimeout bounds each embedder call, so a hung endpoint cannot
+	// stall Observe and Recall for the embedder's own timeout. Zero leaves
+	// it to the embedder.
+	EmbedTimeout time.Duration
+	// EmbedBreakerThreshold is how many consecutive embedder failures open
+	// the circuit breaker (default DefaultEmbedBreakerThreshold; negative
+	// disables it). While open, logs are stored and left queued for
+	// embedding, and recall skips vector search.
+	EmbedBreakerThreshold int
+	// EmbedBreakerCooldown is how long the breaker stays open before one
+	// call probes the embedder again (default DefaultEmbedBreakerCooldown).
+	EmbedBreakerCooldown time.Duration
+	// NeighborExpansion is how many entities of the facts a query matched
+	// recall expands with their one-hop neighbours (default
+	// DefaultNeighborExpansion; negative disables expansion).
+	NeighborExpansion int
+	// MinConfidence is the confidence below which recall drops facts unless
+	// RecallOptions.MinConfidence overrides it (0, the default, keeps all).
+	MinConfidence float64
+	// ReinforceFacts raises the confidence of facts every time recall
+	// returns them, by ReinforceStep (default DefaultReinforceStep) up to
+	// ReinforceCap (default DefaultReinforceCap), so facts in use outlast
+	// unused ones. A fact counts once per recall, however many lists
+	// returned it; reinforcement is written with the access counts, in the
+	// background.
+	ReinforceFacts bool
+	ReinforceStep  float64
+	ReinforceCap   float64
+	// FactPruneAge makes Prune delete facts that have been neither created
+	// nor recalled for this long and whose confidence is below
+	// FactPruneConfidence (default DefaultFactPruneConfidence), optionally
+	// only those with FactPrunePredicate. 0, the default, keeps facts.
+	FactPruneAge        time.Duration
+	FactPruneConfidence float64
+	FactPrunePredicate  string
+	// Summarizer condenses logs older than SummarizeAge into summary logs
+	// when Summarize runs; nil or a zero age disables summarization.
+	// SummarizeDelete deletes the summarized logs instead of only marking
+	// them.
+	Summarizer      summarize.Summarizer
+	SummarizeAge    time.Duration
+	SummarizeDelete bool
+	// DedupThreshold, when set, makes Observe drop inputs whose embedding
+	// has at least this cosine similarity to a stored log of the same
+	// namespace and source (e.g. 0.97). It needs vector search, or
+	// StoreEmbeddings for a brute-force comparison with recent logs, and
+	// embeds every input on the calling goroutine. 0, the default,
+	// disables the check.
+	DedupThreshold float64
+	// UniqueContentSources lists the sources stored exactly once by
+	// content, such as bookmark sync or feed ingestion: an input repeating
+	// the content of a stored log of the same namespace and source is not
+	// stored, embedded or distilled again and gets that log's id, whatever
+	// its metadata. The match is exact and made in the insert transaction,
+	// so concurrent repeats still store one log. Other sources keep
+	// duplicates.
+	UniqueContentSources []string
+
+	// ReadOnly opens the database with mode=ro to serve a snapshot, such as
+	// a restored backup. Recall and every read work as usual; Observe,
+	// Consolidate and the other writes return ErrReadOnly. No background
+	// writer runs: embedding workers, access tracking and database
+	// maintenance are off, and the schema must already be current.
+	ReadOnly bool
+
+	// EncryptionKey encrypts the database at rest with SQLCipher. The binary
+	// must be linked against SQLCipher rather than the bundled SQLite;
+	// otherwise NewMemoryEngine fails with ErrEncryptionUnsupported instead
+	// of writing in the clear. See Rekey to change the key.
+	EncryptionKey string
+
+	// Redactor, when set, rewrites every input before it is stored,
+	// embedded or distilled, e.g. a redact.Regex removing emails and card
+	// numbers. It applies to Observe and its batch forms, to UpdateLog and
+	// to the logs of Import.
+	Redactor redact.Redactor
 }
 
+// DefaultNeighborExpansion is the default Options.NeighborExpansion.
+const DefaultNeighborExpansion = 5
+
+// DefaultReinforceStep and DefaultReinforceCap are the defaults of
+// Options.ReinforceStep and Options.ReinforceCap.
+const (
+	DefaultReinforceStep = 0.02
+	DefaultReinforceCap  = 0.95
+)
+
+// DefaultFactPruneConfidence is the default Options.FactPruneConfidence; it
+// covers the notes of the heuristic distiller.
+const DefaultFactPruneConfidence = 0.5
+
 // MemoryEngine implements the MemoryStore interface.
 type MemoryEngine struct {
-	db        *sqlite.Database
-	vec       *vector.Store
-	graph     *graph.Store
-	buffer    *memory.SensoryBuffer
-	embedder  model.EmbeddingClient
+	db       LogStore
+	vec      VectorIndex
+	graph    TripleStore
+	buffer   *memory.SensoryBuffer
+	stager   *overflowStager
+	embedder model.EmbeddingClient
+	// embedderModel is recorded in the database once Reindex completes, and
+	// with every embedding kept in the embeddings table.
+	embedderModel   string
+	storeEmbeddings bool
+	embedTimeout    time.Duration
+	breaker         *breaker
+	// dbHash identifies the database in trace spans.
+	dbHash    string
 	distiller distill.Distiller
 	logger    *slog.Logger
+
+	logRetention time.Duration
+	maxLogs      int
+	rankWeights  RankWeights
+	maxTopK      int
+	// neighborExpansion is Options.NeighborExpansion; 0 disables.
+	neighborExpansion int
+	minConfidence     float64
+	// recencyHalfLife is Options.RecencyHalfLife; 0 disables.
+	recencyHalfLife time.Duration
+	// reinforceStep is 0 unless Options.ReinforceFacts is set.
+	reinforceStep float64
+	reinforceCap  float64
+	// factPrune is the fact retention policy; a zero MaxAge disables it.
+	factPrune graph.PruneParams
+
+	summarizer      summarize.Summarizer
+	summarizeAge    time.Duration
+	summarizeDelete bool
+	dedupThreshold  float64
+	readOnly        bool
+	redactor        redact.Redactor
+	// vectorDegraded says why vector search is off although it was enabled.
+	vectorDegraded string
+
+	maxContentChars int
+	truncateContent bool
+
+	consolidateMu  sync.Mutex
+	consolidateReq chan struct{}
+	consolidateAt  int
+	// consolidateGap is Options.ConsolidateMinInterval; deferredReq is the
+	// pending request it postponed, if any.
+	consolidateGap time.Duration
+	deferMu        sync.Mutex
+	deferredReq    *time.Timer
+	// history is Options.ConsolidationHistory.
+	history int
+
+	statsMu                  sync.Mutex
+	lastConsolidation        time.Time
+	lastConsolidationFailure time.Time
+	lastConsolidationError   string
+
+	events *eventBus
+	access *accessTracker
+
+	syncEmbedding bool
+	embedNotify   chan struct{}
+	stopWorkers   context.CancelFunc
+	workers       sync.WaitGroup
 }
 
 // NewMemoryEngine initializes storage layers.
@@ -52,142 +347,1336 @@ func NewMemoryEngine(ctx context.Context, opt Options) (*MemoryEngine, error) {
 	if opt.BufferTTL == 0 {
 		opt.BufferTTL = 30 * time.Minute
 	}
-	db, err := sqlite.New(ctx, sqlite.Config{
-		Path:           opt.DBPath,
-		EnableVSS:      opt.EnableVSS,
-		ExtensionsPath: opt.ExtensionsPath,
-		VectorDim:      opt.VectorDim,
-		Logger:         opt.Logger,
-	})
+	if opt.MaxTopK <= 0 {
+		opt.MaxTopK = DefaultMaxTopK
+	}
+	if opt.MaxContentChars <= 0 {
+		opt.MaxContentChars = DefaultMaxContentChars
+	}
+	if opt.ConsolidateFillRatio == 0 {
+		opt.ConsolidateFillRatio = DefaultConsolidateFillRatio
+	}
+	if opt.NeighborExpansion == 0 {
+		opt.NeighborExpansion = DefaultNeighborExpansion
+	}
+	if opt.MinConfidence < 0 || opt.MinConfidence > 1 {
+		return nil, fmt.Errorf("min confidence must be within [0, 1], got %v", opt.MinConfidence)
+	}
+	if opt.ReinforceStep == 0 {
+		opt.ReinforceStep = DefaultReinforceStep
+	}
+	if opt.ReinforceCap == 0 {
+		opt.ReinforceCap = DefaultReinforceCap
+	}
+	if opt.ReinforceStep < 0 || opt.ReinforceStep > 1 {
+		return nil, fmt.Errorf("reinforce step must be within [0, 1], got %v", opt.ReinforceStep)
+	}
+	if opt.ReinforceCap < 0 || opt.ReinforceCap > 1 {
+		return nil, fmt.Errorf("reinforce cap must be within [0, 1], got %v", opt.ReinforceCap)
+	}
+	if opt.DedupThreshold < 0 || opt.DedupThreshold > 1 {
+		return nil, fmt.Errorf("dedup threshold must be within [0, 1], got %v", opt.DedupThreshold)
+	}
+	if opt.FactPruneConfidence == 0 {
+		opt.FactPruneConfidence = DefaultFactPruneConfidence
+	}
+	if opt.FactPruneConfidence < 0 || opt.FactPruneConfidence > 1 {
+		return nil, fmt.Errorf("fact prune confidence must be within (0, 1], got %v", opt.FactPruneConfidence)
+	}
+	if opt.RankWeights == (RankWeights{}) {
+		opt.RankWeights = DefaultRankWeights
+	}
+	if opt.EmbedBreakerThreshold == 0 {
+		opt.EmbedBreakerThreshold = DefaultEmbedBreakerThreshold
+	}
+	if opt.ConsolidationHistory == 0 {
+		opt.ConsolidationHistory = DefaultConsolidationHistory
+	}
+	if opt.EmbedBreakerCooldown <= 0 {
+		opt.EmbedBreakerCooldown = DefaultEmbedBreakerCooldown
+	}
+	if opt.Embedder == nil && opt.EmbedderModel == "" {
+		opt.EmbedderModel = HashEmbedderModel
+	}
+	st, err := OpenStores(ctx, opt)
 	if err != nil {
 		return nil, err
 	}
-
-	vec := vector.New(db.DB(), db.HasVSS(), db.VectorDim())
-	gr := graph.New(db.DB())
-	buf := memory.NewSensoryBuffer(opt.BufferSize, opt.BufferTTL)
-
-	dist := opt.Distiller
-	if dist == nil {
-		dist = distill.NewHeuristic()
-	}
+	db, vec, gr := st.Logs, st.Vectors, st.Triples
 
 	emb := opt.Embedder
 	if emb == nil {
 		emb = NewHashEmbedder(db.VectorDim())
 	}
+	stager := &overflowStager{db: db, logger: opt.Logger}
+	buf := memory.NewSensoryBufferWithConfig(memory.BufferConfig{
+		Capacity: opt.BufferSize,
+		TTL:      opt.BufferTTL,
+		Dedup:    opt.BufferDedup,
+		OnEvict:  stager.stage,
+	})
 
-	return &MemoryEngine{
-		db:        db,
-		vec:       vec,
-		graph:     gr,
-		buffer:    buf,
-		embedder:  emb,
-		distiller: dist,
-		logger:    opt.Logger,
-	}, nil
+	var dist distill.Distiller = distill.NewHeuristic()
+	if opt.Distiller != nil {
+		dist = distill.WithProvenance(opt.Distiller)
+	}
+
+	if vec.Enabled() && opt.EmbedderModel != "" && !opt.ReadOnly {
+		if err := checkEmbedderModel(ctx, db, opt.EmbedderModel, opt.Logger); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	m := &MemoryEngine{
+		db:              db,
+		vec:             vec,
+		graph:           gr,
+		buffer:          buf,
+		stager:          stager,
+		embedder:        emb,
+		embedderModel:   opt.EmbedderModel,
+		storeEmbeddings: opt.StoreEmbeddings,
+		embedTimeout:    max(opt.EmbedTimeout, 0),
+		breaker:         newBreaker(opt.EmbedBreakerThreshold, opt.EmbedBreakerCooldown),
+		distiller:       dist,
+		logger:          opt.Logger,
+		logRetention:    opt.LogRetention,
+		maxLogs:         opt.MaxLogs,
+		rankWeights:     opt.RankWeights,
+		maxTopK:         opt.MaxTopK,
+		syncEmbedding:   opt.SyncEmbedding,
+		embedNotify:     make(chan struct{}, 1),
+
+		maxContentChars: opt.MaxContentChars,
+		truncateContent: opt.TruncateContent,
+
+		neighborExpansion: max(opt.NeighborExpansion, 0),
+		minConfidence:     opt.MinConfidence,
+		recencyHalfLife:   max(opt.RecencyHalfLife, 0),
+
+		reinforceCap: opt.ReinforceCap,
+		factPrune: graph.PruneParams{
+			MaxAge:        max(opt.FactPruneAge, 0),
+			MaxConfidence: opt.FactPruneConfidence,
+			Predicate:     opt.FactPrunePredicate,
+		},
+
+		summarizer:      opt.Summarizer,
+		summarizeAge:    opt.SummarizeAge,
+		summarizeDelete: opt.SummarizeDelete,
+		dedupThreshold:  opt.DedupThreshold,
+		readOnly:        opt.ReadOnly,
+		redactor:        opt.Redactor,
+		vectorDegraded:  st.VectorDegraded,
+
+		dbHash:         dbPathHash(opt.DBPath),
+		events:         newEventBus(),
+		consolidateReq: make(chan struct{}, 1),
+		consolidateAt:  fillThreshold(opt.BufferSize, opt.ConsolidateFillRatio),
+		consolidateGap: opt.ConsolidateMinInterval,
+		history:        opt.ConsolidationHistory,
+	}
+	if m.embeds() && !opt.SyncEmbedding && !opt.ReadOnly {
+		m.startEmbedWorkers(opt.EmbedWorkers)
+	}
+	if opt.ReinforceFacts {
+		m.reinforceStep = opt.ReinforceStep
+	}
+	if m.dedupThreshold > 0 && !m.dedupEnabled() {
+		m.logger.Warn("duplicate detection needs vector search or stored embeddings; disabled")
+	}
+	if !opt.ReadOnly {
+		m.startAccessTracker()
+	}
+	return m, nil
 }
 
-// Observe writes to sensory buffer and durable log, and optionally vector index.
+// repairOnOpen fixes what older builds left behind in the vector table and
+// the graph.
+func repairOnOpen(ctx context.Context, vec *vector.Store, gr *graph.Store, logger *slog.Logger) error {
+	// vectors left behind by builds that deleted logs without them
+	if n, err := vec.DeleteOrphans(ctx); err != nil {
+		return fmt.Errorf("delete orphan embeddings: %w", err)
+	} else if n > 0 {
+		logger.Info("deleted embeddings of missing logs", "count", n)
+	}
+	if merged, err := gr.NormalizeExisting(ctx); err != nil {
+		return fmt.Errorf("normalize entities: %w", err)
+	} else if merged > 0 {
+		logger.Info("merged duplicate triples after entity normalization", "count", merged)
+	}
+	return nil
+}
+
+// ReadOnly reports whether the engine was opened with Options.ReadOnly.
+func (m *MemoryEngine) ReadOnly() bool {
+	return m.readOnly
+}
+
+// Observe writes to sensory buffer and durable log, and optionally vector
+// index. When vector search or StoreEmbeddings is enabled the log is
+// enqueued for embedding in the same transaction. In async mode the
+// embedding workers pick it up; in sync mode it is embedded inline, and on
+// failure it stays queued for RetryPendingEmbeddings instead of failing the
+// call, so callers never need to retry (and duplicate) an already stored
+// input.
 func (m *MemoryEngine) Observe(ctx context.Context, input model.SensoryInput) error {
-	logID, err := m.db.InsertLog(ctx, input)
+	_, err := m.ObserveBatch(ctx, []model.SensoryInput{input})
+	return err
+}
+
+// ObserveWithID is Observe returning the id of the new log, or of the
+// stored log the input duplicates.
+func (m *MemoryEngine) ObserveWithID(ctx context.Context, input model.SensoryInput) (model.ObserveResult, error) {
+	results, err := m.ObserveResults(ctx, []model.SensoryInput{input})
 	if err != nil {
-		return err
+		return model.ObserveResult{}, err
 	}
-	m.buffer.Add(input)
+	return results[0], nil
+}
 
-	if m.vec.Enabled() && m.embedder != nil {
-		emb, err := m.embedder.EmbedText(ctx, input.Content)
+// ObserveBatch is Observe for many inputs: they are validated up front and
+// their logs written in one transaction, so either all are stored or none.
+// It returns the new log ids in input order. Inputs may belong to different
+// namespaces. With Options.DedupThreshold set, an input that nearly repeats
+// a stored log is not stored and gets the id of that log instead, as does
+// one repeating the content of a log of an Options.UniqueContentSources
+// source; use ObserveResults to tell the two apart.
+func (m *MemoryEngine) ObserveBatch(ctx context.Context, inputs []model.SensoryInput) ([]string, error) {
+	results, err := m.ObserveResults(ctx, inputs)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(results))
+	for i, r := range results {
+		ids[i] = r.LogID
+	}
+	return ids, nil
+}
+
+// ObserveResults is ObserveBatch reporting, for every input, whether it was
+// stored or dropped as a near-duplicate.
+func (m *MemoryEngine) ObserveResults(ctx context.Context, inputs []model.SensoryInput) ([]model.ObserveResult, error) {
+	ctx, span := m.startSpan(ctx, "observe", attribute.Int("paim.inputs", len(inputs)))
+	results, err := m.observeBatch(ctx, inputs)
+	endSpan(span, err)
+	return results, err
+}
+
+func (m *MemoryEngine) observeBatch(ctx context.Context, inputs []model.SensoryInput) ([]model.ObserveResult, error) {
+	if m.readOnly {
+		return nil, ErrReadOnly
+	}
+	inputs = append([]model.SensoryInput(nil), inputs...)
+	for i := range inputs {
+		var err error
+		if inputs[i], err = m.redact(ctx, inputs[i]); err == nil {
+			inputs[i].Content, err = m.checkContent(inputs[i].Content)
+		}
+		if err == nil {
+			inputs[i].Namespace, err = NormalizeNamespace(inputs[i].Namespace)
+		}
+		if err == nil && len(inputs[i].SessionID) > maxSessionIDLen {
+			err = fmt.Errorf("%w: session_id is longer than %d bytes", ErrInvalidInput, maxSessionIDLen)
+		}
+		if err == nil && inputs[i].Timestamp.After(time.Now().Add(maxTimestampSkew)) {
+			err = fmt.Errorf("%w: timestamp %s is in the future", ErrInvalidInput, inputs[i].Timestamp.Format(time.RFC3339))
+		}
 		if err != nil {
-			return err
+			if len(inputs) > 1 {
+				err = fmt.Errorf("input %d: %w", i, err)
+			}
+			return nil, err
 		}
-		if err := m.vec.UpsertEmbedding(ctx, logID, emb); err != nil {
-			return err
+	}
+
+	var (
+		dups      []*duplicate
+		embs      [][]float64
+		embModels []string
+	)
+	if m.dedupEnabled() {
+		dups, embs, embModels = m.findDuplicates(ctx, inputs)
+	}
+	// fresh holds the inputs to store, and index their positions in inputs
+	var fresh []model.SensoryInput
+	var index []int
+	for i, in := range inputs {
+		if dups == nil || dups[i] == nil {
+			fresh = append(fresh, in)
+			index = append(index, i)
 		}
 	}
-	return nil
+
+	embed := m.embeds()
+	var (
+		ids      []string
+		existing []bool
+		err      error
+	)
+	if embed {
+		ids, existing, err = m.db.InsertLogsPendingEmbedding(ctx, fresh)
+	} else {
+		ids, existing, err = m.db.InsertLogs(ctx, fresh)
+	}
+	if err != nil {
+		return nil, err
+	}
+	results := make([]model.ObserveResult, len(inputs))
+	n := 0
+	for k, i := range index {
+		results[i].LogID = ids[k]
+		if existing[k] {
+			// a unique-content source repeated a stored log
+			results[i].Duplicate, results[i].Similarity = true, 1
+			continue
+		}
+		fresh[n], ids[n], index[n] = fresh[k], ids[k], i
+		fresh[n].LogID = ids[n]
+		m.bufferInput(fresh[n])
+		n++
+	}
+	fresh, ids, index = fresh[:n], ids[:n], index[:n]
+	for i, d := range dups {
+		if d == nil {
+			continue
+		}
+		results[i] = model.ObserveResult{LogID: d.logID, Duplicate: true, Similarity: d.similarity}
+		if d.input >= 0 {
+			results[i].LogID = results[d.input].LogID
+		}
+	}
+	if len(fresh) == 0 {
+		return results, nil
+	}
+	m.publishObserved(fresh)
+	if !embed {
+		return results, nil
+	}
+	if m.storeEmbeddings && embs != nil {
+		// the duplicate check already embedded the inputs; keep the
+		// vectors so the queue does not embed them again
+		for k, i := range index {
+			if embs[i] == nil {
+				continue
+			}
+			if err := m.db.SaveEmbedding(ctx, ids[k], embModels[i], embs[i]); err != nil {
+				m.logger.Warn("save embedding", "log_id", ids[k], "err", err)
+			}
+		}
+	}
+
+	if !m.syncEmbedding {
+		m.notifyEmbedWorkers()
+		return results, nil
+	}
+	for k, in := range fresh {
+		if ctx.Err() != nil {
+			// the rest stay queued for RetryPendingEmbeddings; the logs are
+			// stored, so the call still succeeds
+			break
+		}
+		if err := m.embedLog(ctx, sqlite.PendingEmbedding{LogID: ids[k], Content: in.Content}); err != nil {
+			if errors.Is(err, ErrEmbedderUnavailable) {
+				// the breaker is open; the rest stay queued as well
+				break
+			}
+			m.logger.Warn("embedding deferred", "log_id", ids[k], "err", err)
+		}
+	}
+	return results, nil
+}
+
+// maxSessionIDLen bounds SensoryInput.SessionID.
+const maxSessionIDLen = 256
+
+// maxTimestampSkew is how far SensoryInput.Timestamp may lie ahead of the
+// clock, to allow for clients whose clocks run slightly fast.
+const maxTimestampSkew = 5 * time.Minute
+
+// redact applies Options.Redactor to input, if set.
+func (m *MemoryEngine) redact(ctx context.Context, input model.SensoryInput) (model.SensoryInput, error) {
+	if m.redactor == nil {
+		return input, nil
+	}
+	out, err := m.redactor.Redact(ctx, input)
+	if err != nil {
+		return input, fmt.Errorf("redact: %w", err)
+	}
+	return out, nil
+}
+
+// checkContent rejects blank content and applies the length limit.
+func (m *MemoryEngine) checkContent(content string) (string, error) {
+	if strings.TrimSpace(content) == "" {
+		return "", fmt.Errorf("%w: content is required", ErrInvalidInput)
+	}
+	n := utf8.RuneCountInString(content)
+	if n <= m.maxContentChars {
+		return content, nil
+	}
+	if !m.truncateContent {
+		return "", fmt.Errorf("%w: content is %d characters, limit is %d", ErrInvalidInput, n, m.maxContentChars)
+	}
+	return string([]rune(content)[:m.maxContentChars]), nil
 }
 
-// Recall performs graph + vector retrieval.
+// Recall performs graph + vector retrieval in the default namespace.
 func (m *MemoryEngine) Recall(ctx context.Context, query string, topK int) (*model.RecalledContext, error) {
-	facts, err := m.graph.SearchFacts(ctx, query, topK)
+	return m.RecallWithOptions(ctx, query, model.RecallOptions{TopK: topK})
+}
+
+// recallRecent answers an empty query with the latest logs and the most
+// confident recent facts, without touching the embedder.
+func (m *MemoryEngine) recallRecent(ctx context.Context, limits recallLimits, opts model.RecallOptions, diag *model.RecallDiagnostics) (*model.RecalledContext, error) {
+	start := time.Now()
+	facts, err := m.graph.RecentFacts(ctx, limits.facts, factFilter(opts))
+	if err != nil {
+		return nil, err
+	}
+	diag.Timings.Graph = milliseconds(time.Since(start))
+	start = time.Now()
+	logs, err := m.db.RecentLogsFiltered(ctx, limits.logs, logFilter(opts))
 	if err != nil {
 		return nil, err
 	}
+	diag.Timings.Fetch = milliseconds(time.Since(start))
+	diag.FactsMatched, diag.Logs = len(facts), len(logs)
+	start = time.Now()
+	ranked := rank(logs, nil, facts, m.rankParams(opts))
+	diag.Timings.Rank = milliseconds(time.Since(start))
+	return &model.RecalledContext{
+		RelatedLogs:  logs,
+		RelatedFacts: facts,
+		Ranked:       ranked,
+		Recent:       true,
+		Diagnostics:  diag,
+	}, nil
+}
+
+// factFilter and logFilter translate recall options into store filters.
+func factFilter(opts model.RecallOptions) graph.FactFilter {
+	return graph.FactFilter{
+		Namespace:         opts.Namespace,
+		Source:            opts.Source,
+		Metadata:          opts.Metadata,
+		From:              opts.From,
+		To:                opts.To,
+		MinConfidence:     opts.MinConfidence,
+		Predicate:         opts.Predicate,
+		Match:             graph.MatchMode(opts.Match),
+		IncludeSuperseded: opts.IncludeSuperseded,
+		AsOf:              opts.AsOf,
+	}
+}
+
+func logFilter(opts model.RecallOptions) sqlite.LogFilter {
+	return sqlite.LogFilter{
+		Namespace: opts.Namespace,
+		Source:    opts.Source,
+		Metadata:  opts.Metadata,
+		From:      opts.From,
+		To:        opts.To,
+	}
+}
+
+// recallLimits are the effective numbers of facts and logs a recall
+// returns.
+type recallLimits struct {
+	facts, logs int
+}
+
+// validateRecall checks a recall request and returns its effective limits:
+// MaxFacts and MaxLogs, falling back to TopK, clamped to the configured
+// maximum.
+func (m *MemoryEngine) validateRecall(opts model.RecallOptions) (recallLimits, error) {
+	if opts.MaxFacts < 0 || opts.MaxLogs < 0 {
+		return recallLimits{}, fmt.Errorf("%w: fact and log limits must not be negative", ErrInvalidInput)
+	}
+	if (opts.MaxFacts == 0 || opts.MaxLogs == 0) && opts.TopK <= 0 {
+		return recallLimits{}, fmt.Errorf("%w: topK must be positive, got %d", ErrInvalidInput, opts.TopK)
+	}
+	if err := checkMetadataKeys(opts.Metadata); err != nil {
+		return recallLimits{}, err
+	}
+	if !opts.From.IsZero() && !opts.To.IsZero() && opts.From.After(opts.To) {
+		return recallLimits{}, fmt.Errorf("%w: from is after to", ErrInvalidInput)
+	}
+	if opts.MinConfidence < 0 || opts.MinConfidence > 1 {
+		return recallLimits{}, fmt.Errorf("%w: min confidence must be within [0, 1], got %v", ErrInvalidInput, opts.MinConfidence)
+	}
+	if _, err := graph.ParseMatchMode(opts.Match); err != nil {
+		return recallLimits{}, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	if opts.SessionWindow < 0 || opts.SessionWindow > m.maxTopK {
+		return recallLimits{}, fmt.Errorf("%w: session window must be between 0 and %d, got %d", ErrInvalidInput, m.maxTopK, opts.SessionWindow)
+	}
+	limit := func(n int) int {
+		if n == 0 {
+			n = opts.TopK
+		}
+		return min(n, m.maxTopK)
+	}
+	return recallLimits{facts: limit(opts.MaxFacts), logs: limit(opts.MaxLogs)}, nil
+}
+
+// checkMetadataKeys rejects metadata filter keys sqlite.MetadataPath cannot
+// address.
+func checkMetadataKeys(filters map[string]string) error {
+	for k := range filters {
+		if _, err := sqlite.MetadataPath(k); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		}
+	}
+	return nil
+}
+
+// maxRecallCandidates caps vector over-fetching for filtered recall.
+const maxRecallCandidates = 1000
+
+// RecallWithOptions performs graph + vector retrieval restricted by opts.
+// An empty or whitespace-only query returns recent context instead (see
+// RecalledContext.Recent).
+// Vector hits are filtered after the nearest-neighbour search, so candidates
+// are over-fetched until topK matches are found or the index is exhausted.
+func (m *MemoryEngine) RecallWithOptions(ctx context.Context, query string, opts model.RecallOptions) (*model.RecalledContext, error) {
+	ctx, span := m.startSpan(ctx, "recall", attribute.Int("paim.top_k", opts.TopK))
+	res, err := m.recall(ctx, query, opts)
+	if res != nil {
+		m.recordAccess(res)
+		span.SetAttributes(attribute.Int("paim.logs", len(res.RelatedLogs)), attribute.Int("paim.facts", len(res.RelatedFacts)))
+	}
+	endSpan(span, err)
+	return res, err
+}
+
+func (m *MemoryEngine) recall(ctx context.Context, query string, opts model.RecallOptions) (*model.RecalledContext, error) {
+	begin := time.Now()
+	limits, err := m.validateRecall(opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Namespace, err = NormalizeNamespace(opts.Namespace); err != nil {
+		return nil, err
+	}
+	if opts.MinConfidence == 0 {
+		opts.MinConfidence = m.minConfidence
+	}
+	diag := &model.RecallDiagnostics{
+		Query:     strings.TrimSpace(query),
+		Namespace: opts.Namespace,
+		MaxFacts:  limits.facts,
+		MaxLogs:   limits.logs,
+	}
+	if diag.Query == "" {
+		res, err := m.recallRecent(ctx, limits, opts, diag)
+		diag.Timings.Total = milliseconds(time.Since(begin))
+		return res, err
+	}
+	diag.Match = opts.Match
+	if diag.Match == "" {
+		diag.Match = string(graph.MatchContains)
+	}
+	start := time.Now()
+	gctx, span := m.startSpan(ctx, "graph.search", attribute.Int("paim.top_k", limits.facts))
+	facts, err := m.graph.SearchFactsFiltered(gctx, query, limits.facts, factFilter(opts))
+	span.SetAttributes(attribute.Int("paim.facts", len(facts)))
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	diag.FactsMatched = len(facts)
+	diag.Timings.Graph = milliseconds(time.Since(start))
+	if m.neighborExpansion > 0 && len(facts) > 0 {
+		start = time.Now()
+		xctx, span := m.startSpan(ctx, "graph.expand")
+		facts, diag.NeighborsFetched, err = m.expandFacts(xctx, facts, limits.facts, factFilter(opts))
+		span.SetAttributes(attribute.Int("paim.facts", len(facts)))
+		endSpan(span, err)
+		if err != nil {
+			return nil, err
+		}
+		diag.GraphExpansion = true
+		diag.NeighborsAdded = len(facts) - diag.FactsMatched
+		diag.Timings.Expand = milliseconds(time.Since(start))
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	var logs []model.LogEntry
+	var distances map[string]float64
+	vectorSkipped := false
 	if m.vec.Enabled() && m.embedder != nil {
-		emb, err := m.embedder.EmbedText(ctx, query)
+		start = time.Now()
+		emb, _, err := m.embedText(ctx, query)
+		diag.Timings.Embed = milliseconds(time.Since(start))
+		switch {
+		case err != nil && ctx.Err() != nil:
+			return nil, ctx.Err()
+		case err != nil:
+			// answer from the graph rather than fail the whole recall
+			m.logger.Warn("vector search skipped", "err", err)
+			vectorSkipped = true
+		default:
+			diag.VectorSearch = true
+			diag.VectorBackend = m.vec.Name()
+			logs, distances, err = m.searchLogs(ctx, emb, limits.logs, logFilter(opts), diag)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	diag.Logs = len(logs)
+	var sessions []model.SessionContext
+	if opts.ExpandSessions {
+		start = time.Now()
+		window := opts.SessionWindow
+		if window == 0 {
+			window = model.DefaultSessionWindow
+		}
+		sctx, span := m.startSpan(ctx, "expand_sessions")
+		sessions, err = m.expandSessions(sctx, logs, opts.Namespace, window)
+		span.SetAttributes(attribute.Int("paim.sessions", len(sessions)))
+		endSpan(span, err)
 		if err != nil {
 			return nil, err
 		}
-		ids, err := m.vec.Search(ctx, emb, topK)
+		diag.Timings.Sessions = milliseconds(time.Since(start))
+	}
+	start = time.Now()
+	ranked := rank(logs, distances, facts, m.rankParams(opts))
+	diag.Timings.Rank = milliseconds(time.Since(start))
+	diag.Timings.Total = milliseconds(time.Since(begin))
+	m.logger.Debug("recall timings", "max_facts", limits.facts, "max_logs", limits.logs, "facts", len(facts), "logs", len(logs),
+		"graph_ms", diag.Timings.Graph, "embed_ms", diag.Timings.Embed,
+		"vector_ms", diag.Timings.Vector, "fetch_ms", diag.Timings.Fetch)
+
+	return &model.RecalledContext{
+		RelatedLogs:   logs,
+		RelatedFacts:  facts,
+		Ranked:        ranked,
+		Sessions:      sessions,
+		VectorSkipped: vectorSkipped,
+		Diagnostics:   diag,
+	}, nil
+}
+
+// milliseconds converts d for RecallTimings.
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// expandSessions returns the conversation around the hits that belong to a
+// session: each hit with up to window entries of its session on either side.
+// Sessions are listed in the order of their best hit, and entries shared by
+// overlapping windows appear once. Hits without a session are skipped; they
+// are already in RelatedLogs.
+func (m *MemoryEngine) expandSessions(ctx context.Context, hits []model.LogEntry, namespace string, window int) ([]model.SessionContext, error) {
+	var order []string
+	hitIDs := make(map[string][]string)
+	for _, h := range hits {
+		if h.SessionID == "" {
+			continue
+		}
+		if _, ok := hitIDs[h.SessionID]; !ok {
+			order = append(order, h.SessionID)
+		}
+		hitIDs[h.SessionID] = append(hitIDs[h.SessionID], h.ID)
+	}
+	sessions := make([]model.SessionContext, 0, len(order))
+	for _, id := range order {
+		logs, err := m.db.FetchSessionFiltered(ctx, id, sqlite.LogFilter{Namespace: namespace})
 		if err != nil {
 			return nil, err
 		}
-		logs, err = m.db.FetchLogs(ctx, ids)
+		pos := make(map[string]int, len(logs))
+		for i, l := range logs {
+			pos[l.ID] = i
+		}
+		keep := make([]bool, len(logs))
+		for _, hit := range hitIDs[id] {
+			i, ok := pos[hit]
+			if !ok {
+				continue
+			}
+			for j := max(0, i-window); j <= min(len(logs)-1, i+window); j++ {
+				keep[j] = true
+			}
+		}
+		sc := model.SessionContext{SessionID: id}
+		for i, l := range logs {
+			if keep[i] {
+				sc.Logs = append(sc.Logs, l)
+			}
+		}
+		if len(sc.Logs) > 0 {
+			sessions = append(sessions, sc)
+		}
+	}
+	return sessions, nil
+}
+
+// expandFacts appends the one-hop neighbours of the first
+// neighborExpansion distinct entities of facts, marked with Hop 1 and
+// matching the same filter, and returns how many neighbours it fetched. At
+// most topK neighbours are added, so recall returns no more than 2*topK
+// facts.
+func (m *MemoryEngine) expandFacts(ctx context.Context, facts []model.Triple, topK int, f graph.FactFilter) ([]model.Triple, int, error) {
+	seen := make(map[int64]bool, len(facts))
+	var entities []string
+	seenEntity := make(map[string]bool)
+	for _, t := range facts {
+		seen[t.ID] = true
+		for _, e := range []string{t.Subject, t.Object} {
+			if len(entities) < m.neighborExpansion && !seenEntity[e] {
+				seenEntity[e] = true
+				entities = append(entities, e)
+			}
+		}
+	}
+	// the matched facts touch these entities too and come back first when
+	// they are the most confident, so over-fetch by their number
+	neighbors, err := m.graph.NeighborsOf(ctx, entities, topK+len(facts), f)
+	if err != nil {
+		return nil, 0, err
+	}
+	added := 0
+	for _, t := range neighbors {
+		if added == topK {
+			break
+		}
+		if seen[t.ID] {
+			continue
+		}
+		t.Hop = 1
+		facts = append(facts, t)
+		added++
+	}
+	return facts, len(neighbors), nil
+}
+
+// searchLogs returns the topK logs nearest to emb that match filter. The
+// vector index spans all namespaces, so hits of other namespaces are dropped
+// before their logs are fetched, and FetchLogsFiltered checks the namespace
+// again on the logs themselves. The time spent and the candidate counts are
+// recorded in diag.
+func (m *MemoryEngine) searchLogs(ctx context.Context, emb []float64, topK int, filter sqlite.LogFilter, diag *model.RecallDiagnostics) ([]model.LogEntry, map[string]float64, error) {
+	candidates := topK
+	// the namespace alone does not over-fetch up front; the loop below
+	// widens the search when other namespaces crowd out the hits
+	if rest := (sqlite.LogFilter{Source: filter.Source, Metadata: filter.Metadata, From: filter.From, To: filter.To}); !rest.IsZero() {
+		candidates = topK * 4
+	}
+	for ; ; candidates *= 2 {
+		if candidates > maxRecallCandidates {
+			candidates = maxRecallCandidates
+		}
+		start := time.Now()
+		vctx, span := m.startSpan(ctx, "vector.search", attribute.Int("paim.top_k", candidates))
+		res, err := m.vec.SearchLogsFiltered(vctx, emb, candidates, filter)
+		span.SetAttributes(attribute.Int("paim.hits", len(res.Hits)), attribute.Int("paim.logs", len(res.Logs)))
+		endSpan(span, err)
+		if err != nil {
+			return nil, nil, err
+		}
+		diag.Timings.Vector += milliseconds(time.Since(start))
+		diag.VectorHits = len(res.Hits)
+		diag.LogCandidates = 0
+		for _, h := range res.Hits {
+			if h.Namespace == filter.Namespace {
+				diag.LogCandidates++
+			}
+		}
+		// hits whose log is gone (or filtered out) are dropped, so keep
+		// widening the search until topK logs are found
+		if len(res.Logs) >= topK || len(res.Hits) < candidates || candidates == maxRecallCandidates {
+			logs := res.Logs
+			if len(logs) > topK {
+				logs = logs[:topK]
+			}
+			distances := make(map[string]float64, len(logs))
+			for i, e := range logs {
+				distances[e.ID] = res.Distances[i]
+			}
+			return logs, distances, nil
+		}
+	}
+}
+
+// FactDetail is a triple together with the logs it was distilled from.
+type FactDetail struct {
+	Fact    model.Triple     `json:"fact"`
+	Sources []model.LogEntry `json:"sources"`
+}
+
+// Fact returns a triple of namespace with its source log entries, or
+// ErrNotFound. Facts of other namespaces are reported as not found.
+func (m *MemoryEngine) Fact(ctx context.Context, namespace string, id int64) (*FactDetail, error) {
+	namespace, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	t, err := m.graph.GetTriple(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && t.Namespace != namespace) {
+		return nil, fmt.Errorf("%w: fact %d", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	logs, err := m.db.FetchLogs(ctx, t.Sources)
+	if err != nil {
+		return nil, err
+	}
+	if logs == nil {
+		logs = []model.LogEntry{}
+	}
+	return &FactDetail{Fact: *t, Sources: logs}, nil
+}
+
+// AssertedFact is a fact stored by Assert.
+type AssertedFact struct {
+	Fact model.Triple `json:"fact"`
+	// Inserted is false when the fact already existed and was reinforced.
+	Inserted bool `json:"inserted"`
+}
+
+// Assert stores facts directly, bypassing the sensory buffer and distiller.
+// All facts are validated first and written in one transaction, each in its
+// own Namespace.
+func (m *MemoryEngine) Assert(ctx context.Context, facts []model.Triple) ([]AssertedFact, error) {
+	if m.readOnly {
+		return nil, ErrReadOnly
+	}
+	if len(facts) == 0 {
+		return nil, fmt.Errorf("%w: no facts given", ErrInvalidInput)
+	}
+	clean := make([]model.Triple, len(facts))
+	for i, f := range facts {
+		f.Subject = strings.TrimSpace(f.Subject)
+		f.Predicate = strings.TrimSpace(f.Predicate)
+		f.Object = strings.TrimSpace(f.Object)
+		if f.Subject == "" || f.Predicate == "" || f.Object == "" {
+			return nil, fmt.Errorf("%w: fact %d: subject, predicate and object are required", ErrInvalidInput, i)
+		}
+		if f.Confidence < 0 || f.Confidence > 1 {
+			return nil, fmt.Errorf("%w: fact %d: confidence must be within [0, 1]", ErrInvalidInput, i)
+		}
+		if f.ValidFrom != nil && f.ValidTo != nil && !f.ValidTo.After(*f.ValidFrom) {
+			return nil, fmt.Errorf("%w: fact %d: valid_to must be after valid_from", ErrInvalidInput, i)
+		}
+		ns, err := NormalizeNamespace(f.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("fact %d: %w", i, err)
+		}
+		f.Namespace = ns
+		clean[i] = f
+	}
+
+	results, err := m.graph.UpsertTriples(ctx, clean)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]AssertedFact, len(results))
+	for i, r := range results {
+		stored, err := m.graph.GetTriple(ctx, r.ID)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = AssertedFact{Fact: *stored, Inserted: r.Inserted}
+	}
+	return out, nil
+}
+
+// Embedding states reported by LogDetail.
+const (
+	EmbeddingIndexed  = "indexed"
+	EmbeddingQueued   = "queued"
+	EmbeddingFailed   = "failed"
+	EmbeddingMissing  = "missing"
+	EmbeddingDisabled = "disabled"
+)
+
+// LogDetail is a log entry together with its embedding state and the facts
+// distilled from it.
+type LogDetail struct {
+	Log model.LogEntry `json:"log"`
+	// Embedding is EmbeddingIndexed when the vector index holds the log,
+	// EmbeddingQueued while it waits for its first attempt, EmbeddingFailed
+	// while failed attempts are being retried (EmbeddingError holds the last
+	// error), EmbeddingMissing when it is neither indexed nor queued, and
+	// EmbeddingDisabled without vector search.
+	Embedding      string         `json:"embedding"`
+	EmbeddingError string         `json:"embedding_error,omitempty"`
+	Facts          []model.Triple `json:"facts"`
+}
+
+// Log returns a log of namespace with its embedding state and the facts
+// that cite it, or ErrNotFound. Logs of other namespaces are reported as not
+// found; an id that is not a UUID is ErrInvalidInput.
+func (m *MemoryEngine) Log(ctx context.Context, namespace, id string) (*LogDetail, error) {
+	namespace, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, fmt.Errorf("%w: log id %q is not a UUID", ErrInvalidInput, id)
+	}
+	e, err := m.db.FetchLog(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && e.Namespace != namespace) {
+		return nil, fmt.Errorf("%w: log %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	detail := &LogDetail{Log: *e, Embedding: EmbeddingDisabled}
+	if m.vec.Enabled() {
+		st, err := m.db.LogEmbeddingState(ctx, id, true)
 		if err != nil {
 			return nil, err
 		}
+		switch {
+		case st.Indexed:
+			detail.Embedding = EmbeddingIndexed
+		case st.Queued && st.Attempts > 0:
+			detail.Embedding, detail.EmbeddingError = EmbeddingFailed, st.LastError
+		case st.Queued:
+			detail.Embedding = EmbeddingQueued
+		default:
+			detail.Embedding = EmbeddingMissing
+		}
+	}
+	detail.Facts, err = m.graph.TriplesFromLog(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if detail.Facts == nil {
+		detail.Facts = []model.Triple{}
 	}
+	return detail, nil
+}
+
+// RecentLogs returns the latest memory logs of namespace, newest first.
+func (m *MemoryEngine) RecentLogs(ctx context.Context, namespace string, limit int) ([]model.LogEntry, error) {
+	namespace, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return m.db.RecentLogsFiltered(ctx, limit, sqlite.LogFilter{Namespace: namespace})
+}
+
+// QueryLogsByMetadata returns the latest logs of namespace whose metadata
+// matches every filter (see sqlite.MetadataPath for nested keys), newest
+// first.
+func (m *MemoryEngine) QueryLogsByMetadata(ctx context.Context, namespace string, filters map[string]string, limit int) ([]model.LogEntry, error) {
+	namespace, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMetadataKeys(filters); err != nil {
+		return nil, err
+	}
+	return m.db.RecentLogsFiltered(ctx, limit, sqlite.LogFilter{Namespace: namespace, Metadata: filters})
+}
+
+// ListFacts pages through the facts of p.Namespace with exact-match and
+// confidence filters.
+func (m *MemoryEngine) ListFacts(ctx context.Context, p graph.ListParams) (graph.ListResult, error) {
+	var err error
+	if p.Namespace, err = NormalizeNamespace(p.Namespace); err != nil {
+		return graph.ListResult{}, err
+	}
+	if p.MinConfidence < 0 || p.MinConfidence > 1 {
+		return graph.ListResult{}, fmt.Errorf("%w: min_confidence must be within [0, 1]", ErrInvalidInput)
+	}
+	if p.Cursor < 0 {
+		return graph.ListResult{}, fmt.Errorf("%w: cursor must not be negative", ErrInvalidInput)
+	}
+	if _, err := graph.ParseMatchMode(string(p.Match)); err != nil {
+		return graph.ListResult{}, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	return m.graph.ListTriples(ctx, p)
+}
 
-	return &model.RecalledContext{RelatedLogs: logs, RelatedFacts: facts}, nil
+// DeleteFact removes a single triple of namespace, or returns ErrNotFound.
+func (m *MemoryEngine) DeleteFact(ctx context.Context, namespace string, id int64) error {
+	if m.readOnly {
+		return ErrReadOnly
+	}
+	namespace, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return err
+	}
+	err = m.graph.DeleteTriple(ctx, namespace, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: fact %d", ErrNotFound, id)
+	}
+	return err
+}
+
+// DeleteFacts removes triples of namespace matching subject/predicate/object,
+// with empty fields acting as wildcards. Wiping every triple of the
+// namespace requires all to be set, so an empty filter can't clear it by
+// accident; other namespaces are never touched.
+func (m *MemoryEngine) DeleteFacts(ctx context.Context, namespace, subject, predicate, object string, all bool) (int64, error) {
+	if m.readOnly {
+		return 0, ErrReadOnly
+	}
+	namespace, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return 0, err
+	}
+	if subject == "" && predicate == "" && object == "" {
+		if !all {
+			return 0, fmt.Errorf("%w: %v", ErrInvalidInput, graph.ErrNoFilter)
+		}
+		return m.graph.DeleteAll(ctx, namespace)
+	}
+	return m.graph.DeleteMatching(ctx, namespace, subject, predicate, object)
+}
+
+// AddAlias makes alias resolve to canonical in the knowledge graph of
+// namespace. Other namespaces are not affected.
+func (m *MemoryEngine) AddAlias(ctx context.Context, namespace, alias, canonical string) error {
+	if m.readOnly {
+		return ErrReadOnly
+	}
+	namespace, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return err
+	}
+	err = m.graph.AddAlias(ctx, namespace, alias, canonical)
+	if errors.Is(err, graph.ErrInvalidAlias) {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	return err
+}
+
+// FindPath returns a shortest chain of facts of namespace linking two
+// entities, or ErrNotFound when none exists within depth hops.
+func (m *MemoryEngine) FindPath(ctx context.Context, namespace, from, to string, depth int) ([]model.Triple, error) {
+	namespace, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	path, err := m.graph.FindPath(ctx, namespace, from, to, depth)
+	if errors.Is(err, graph.ErrNoPath) {
+		return nil, fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	return path, err
+}
+
+// QueryPattern returns the solutions of a conjunctive triple-pattern query
+// over the facts of namespace; see graph.Store.QueryPattern.
+func (m *MemoryEngine) QueryPattern(ctx context.Context, namespace string, patterns []graph.TriplePattern, limit int) ([]graph.PatternMatch, error) {
+	namespace, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := m.graph.QueryPattern(ctx, namespace, patterns, limit)
+	if errors.Is(err, graph.ErrInvalidPattern) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	return matches, err
+}
+
+// ListEntities returns entities of namespace starting with prefix and their
+// edge counts.
+func (m *MemoryEngine) ListEntities(ctx context.Context, namespace, prefix string, limit, offset int) ([]graph.EntityInfo, error) {
+	namespace, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return m.graph.ListEntities(ctx, namespace, prefix, limit, offset)
+}
+
+// Neighbors returns the current facts of namespace with at least
+// minConfidence within depth hops of entity, at most limit, with the one-hop
+// ones split into outgoing and incoming edges, and the entity's degree. An
+// entity without facts in namespace is ErrNotFound.
+func (m *MemoryEngine) Neighbors(ctx context.Context, namespace, entity string, depth, limit int, minConfidence float64) (graph.Neighbors, error) {
+	namespace, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return graph.Neighbors{}, err
+	}
+	if strings.TrimSpace(entity) == "" {
+		return graph.Neighbors{}, fmt.Errorf("%w: entity is required", ErrInvalidInput)
+	}
+	if minConfidence < 0 || minConfidence > 1 {
+		return graph.Neighbors{}, fmt.Errorf("%w: min_confidence must be within [0, 1]", ErrInvalidInput)
+	}
+	n, err := m.graph.Neighbors(ctx, entity, depth, limit, graph.FactFilter{Namespace: namespace, MinConfidence: minConfidence})
+	if err != nil {
+		return graph.Neighbors{}, err
+	}
+	if n.Degree.Total == 0 {
+		return graph.Neighbors{}, fmt.Errorf("%w: entity %q", ErrNotFound, entity)
+	}
+	return n, nil
+}
+
+// Neighborhood returns facts of namespace within depth hops of entity.
+func (m *MemoryEngine) Neighborhood(ctx context.Context, namespace, entity string, depth, limit int) ([]model.Triple, error) {
+	namespace, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return m.graph.Neighborhood(ctx, namespace, entity, depth, limit)
+}
+
+// maxViewEdges caps the edges of GraphView.
+const maxViewEdges = 1000
+
+// GraphView returns facts of namespace as nodes and edges with at most
+// limit edges: the neighborhood of center within depth hops, or the graph
+// from its oldest facts when center is empty. Twice the limit of facts is
+// read so that merged parallel edges and the least confident ones can be
+// dropped; the view is marked truncated when that read was cut short too.
+func (m *MemoryEngine) GraphView(ctx context.Context, namespace, center string, depth, limit int) (graph.View, error) {
+	namespace, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return graph.View{}, err
+	}
+	if limit <= 0 || limit > maxViewEdges {
+		return graph.View{}, fmt.Errorf("%w: limit must be within [1, %d]", ErrInvalidInput, maxViewEdges)
+	}
+	fetch := 2 * limit
+	var triples []model.Triple
+	if center != "" {
+		if triples, err = m.graph.Neighborhood(ctx, namespace, center, depth, fetch); err != nil {
+			return graph.View{}, err
+		}
+	} else {
+		p := graph.ListParams{Namespace: namespace, Limit: fetch}
+		for len(triples) < fetch {
+			p.Limit = fetch - len(triples)
+			page, err := m.graph.ListTriples(ctx, p)
+			if err != nil {
+				return graph.View{}, err
+			}
+			triples = append(triples, page.Triples...)
+			if page.NextCursor == 0 {
+				break
+			}
+			p.Cursor = page.NextCursor
+		}
+	}
+	view := graph.NewView(triples, limit)
+	if len(triples) >= fetch {
+		view.Truncated = true
+	}
+	return view, nil
 }
 
 // Consolidate distills buffered sensory inputs into triples and writes to graph.
+// Each namespace is distilled separately and its triples stored in it.
+// Buffered items are only removed once all their triples are committed; on
+// failure they stay in the buffer for the next cycle. Concurrent calls run
+// one after another.
 func (m *MemoryEngine) Consolidate(ctx context.Context) error {
-	snapshot := m.buffer.Snapshot()
-	if len(snapshot) == 0 {
-		return nil
+	if m.readOnly {
+		return ErrReadOnly
 	}
+	m.consolidateMu.Lock()
+	defer m.consolidateMu.Unlock()
+	ctx, span := m.startSpan(ctx, "consolidate")
+	err := m.runConsolidation(ctx)
+	endSpan(span, err)
+	return err
+}
 
-	triples, err := m.distiller.Distill(ctx, snapshot)
+// consolidate distills the buffer and the staged overflow into the graph.
+// It reports how many inputs it distilled and triples it wrote.
+func (m *MemoryEngine) consolidate(ctx context.Context) (inputCount, written int, err error) {
+	items := m.buffer.SnapshotItems()
+	overflow, err := m.db.OverflowLogs(ctx, maxOverflowBatch)
 	if err != nil {
+		return 0, 0, fmt.Errorf("load overflow: %w", err)
+	}
+	if len(items) == 0 && len(overflow) == 0 {
+		return 0, 0, nil
+	}
+	// evicted inputs are older than anything still buffered
+	inputs := make([]model.SensoryInput, 0, len(overflow)+len(items))
+	for _, e := range overflow {
+		inputs = append(inputs, overflowInput(e))
+	}
+	for _, item := range items {
+		inputs = append(inputs, item.Input)
+	}
+	var namespaces []string
+	byNamespace := make(map[string][]model.SensoryInput)
+	for _, in := range inputs {
+		ns := in.Namespace
+		if _, ok := byNamespace[ns]; !ok {
+			namespaces = append(namespaces, ns)
+		}
+		byNamespace[ns] = append(byNamespace[ns], in)
+	}
+
+	var triples []model.Triple
+	for _, ns := range namespaces {
+		inputs := byNamespace[ns]
+		dctx, span := m.startSpan(ctx, "distill", attribute.Int("paim.inputs", len(inputs)))
+		distilled, err := m.distiller.Distill(dctx, inputs)
+		span.SetAttributes(attribute.Int("paim.triples", len(distilled)))
+		endSpan(span, err)
+		if err != nil {
+			return len(overflow) + len(items), 0, fmt.Errorf("distill: %w", err)
+		}
+		for i := range distilled {
+			distilled[i].Namespace = ns
+		}
+		triples = append(triples, distilled...)
+	}
+	if m.logger.Enabled(ctx, slog.LevelDebug) {
+		byDistiller := make(map[string]int)
+		for _, t := range triples {
+			byDistiller[t.Distiller]++
+		}
+		m.logger.Debug("distilled buffer", "inputs", len(items), "overflow", len(overflow), "namespaces", len(namespaces), "triples", len(triples), "by_distiller", byDistiller)
+	}
+	// the distilled overflow is cleared in the same transaction as the
+	// triples are written, so a failure cannot leave it staged to be
+	// distilled a second time; so are snapshot items evicted and staged
+	// while distilling
+	clearIDs := make([]string, 0, len(overflow)+len(items))
+	for _, e := range overflow {
+		clearIDs = append(clearIDs, e.ID)
+	}
+	for _, item := range items {
+		if item.Input.LogID != "" {
+			clearIDs = append(clearIDs, item.Input.LogID)
+		}
+	}
+	var results []graph.UpsertResult
+	err = m.stager.commit(items, func() (err error) {
+		results, err = m.graph.UpsertTriplesWith(ctx, triples, func(tx *sql.Tx) error {
+			return m.db.ClearOverflowTx(ctx, tx, clearIDs)
+		})
 		return err
+	})
+	if err != nil {
+		return len(inputs), 0, fmt.Errorf("write triples: %w", err)
+	}
+	m.publishConsolidated(ctx, triples, results)
+	if len(overflow) == maxOverflowBatch {
+		m.RequestConsolidation()
 	}
-	for _, t := range triples {
-		if _, err := m.graph.UpsertTriple(ctx, t); err != nil {
-			return err
+	// the snapshot held every live item up to the highest sequence number;
+	// inputs observed while distilling come after it and stay buffered
+	var last uint64
+	for _, item := range items {
+		if item.Seq > last {
+			last = item.Seq
 		}
 	}
-	m.buffer.Clear()
-	return nil
+	m.buffer.TrimThrough(last)
+	return len(inputs), len(results), nil
+}
+
+// Backup writes a consistent snapshot of the database to destPath, which must
+// not exist yet. It is safe to call while the engine is serving requests.
+func (m *MemoryEngine) Backup(ctx context.Context, destPath string) error {
+	return m.db.Backup(ctx, destPath)
+}
+
+// MaintenanceReport describes one Maintain run.
+type MaintenanceReport = sqlite.MaintenanceReport
+
+// Maintain checkpoints the WAL and runs PRAGMA optimize now, as the
+// background maintenance does every Options.MaintenanceInterval.
+func (m *MemoryEngine) Maintain(ctx context.Context) (MaintenanceReport, error) {
+	if m.readOnly {
+		return MaintenanceReport{}, ErrReadOnly
+	}
+	return m.db.Maintain(ctx)
+}
+
+// Rekey re-encrypts a database opened with Options.EncryptionKey with
+// newKey, which must be used from then on.
+func (m *MemoryEngine) Rekey(ctx context.Context, newKey string) error {
+	if m.readOnly {
+		return ErrReadOnly
+	}
+	if !m.db.Encrypted() {
+		return fmt.Errorf("%w: the database is not encrypted", ErrInvalidInput)
+	}
+	if newKey == "" {
+		return fmt.Errorf("%w: a new key is required", ErrInvalidInput)
+	}
+	return m.db.Rekey(ctx, newKey)
 }
 
-// Close releases resources.
+// Close stops background workers, ends event subscriptions and releases
+// resources.
 func (m *MemoryEngine) Close() error {
+	m.deferMu.Lock()
+	if m.deferredReq != nil {
+		m.deferredReq.Stop()
+	}
+	m.deferMu.Unlock()
+	m.events.close()
+	if m.stopWorkers != nil {
+		m.stopWorkers()
+		m.workers.Wait()
+	}
+	m.stopAccessTracker()
 	return m.db.Close()
 }
 
 // HashEmbedder is a deterministic, dependency-free embedding stub to keep the
 // system local-first by default. Replace with real embedding service when available.
 type HashEmbedder struct {
-	dim int
+	dim  int
+	seed uint64
 }
 
+// HashEmbedderModel is the EmbedderModel recorded for HashEmbedder vectors.
+// It changes whenever HashEmbedder's output does, so stored vectors of an
+// older version are reported as needing a reindex.
+const HashEmbedderModel = "hash-v2"
+
 func NewHashEmbedder(dim int) *HashEmbedder {
+	return NewHashEmbedderWithSeed(dim, 0)
+}
+
+// NewHashEmbedderWithSeed is NewHashEmbedder whose vectors also depend on
+// seed, for fixtures that need distinct but reproducible embeddings.
+func NewHashEmbedderWithSeed(dim int, seed uint64) *HashEmbedder {
 	if dim <= 0 {
 		dim = 1536
 	}
-	return &HashEmbedder{dim: dim}
+	return &HashEmbedder{dim: dim, seed: seed}
 }
 
-// EmbedText hashes the text into a pseudo-random but deterministic vector.
+// EmbedText hashes the text into a pseudo-random but deterministic unit
+// vector. The SHA-256 digest of seed and text is expanded in counter mode,
+// hashing digest||block for every 16 dimensions, so that no two dimensions
+// repeat each other; the output is the same on every platform.
 func (h *HashEmbedder) EmbedText(_ context.Context, text string) ([]float64, error) {
 	if text == "" {
 		text = "empty"
 	}
-	hash := sha256.Sum256([]byte(text))
+	var seed [8]byte
+	binary.LittleEndian.PutUint64(seed[:], h.seed)
+	digest := sha256.Sum256(append(seed[:], text...))
+
 	vec := make([]float64, h.dim)
-	for i := 0; i < h.dim; i++ {
-		// spread hash bits across dimensions
-		chunk := binary.LittleEndian.Uint16(hash[(i % 16):])
-		vec[i] = float64(chunk%1000) / 1000.0
-	}
-	// normalize lightly
+	var block [sha256.Size + 4]byte
+	copy(block[:], digest[:])
 	var sum float64
-	for _, v := range vec {
-		sum += v * v
+	for i := 0; i < h.dim; i += sha256.Size / 2 {
+		binary.LittleEndian.PutUint32(block[sha256.Size:], uint32(i/(sha256.Size/2)))
+		bits := sha256.Sum256(block[:])
+		for j := 0; j < sha256.Size/2 && i+j < h.dim; j++ {
+			// centered on zero, so unrelated texts are near orthogonal
+			v := float64(binary.LittleEndian.Uint16(bits[2*j:]))/32767.5 - 1
+			vec[i+j] = v
+			sum += v * v
+		}
 	}
 	norm := math.Sqrt(sum)
 	if norm == 0 {
@@ -199,5 +1688,8 @@ func (h *HashEmbedder) EmbedText(_ context.Context, text string) ([]float64, err
 	return vec, nil
 }
 
-var _ model.MemoryStore = (*MemoryEngine)(nil)
+var (
+	_ model.MemoryStore = (*MemoryEngine)(nil)
+	_ model.IDObserver  = (*MemoryEngine)(nil)
+)
 var _ model.EmbeddingClient = (*HashEmbedder)(nil)
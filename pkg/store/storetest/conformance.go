@@ -0,0 +1,1412 @@
+package storetest
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/graph"
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+)
+
+// Opener opens fresh, empty stores for one test with the behavior fields of
+// opt; where they live is up to it. It must close them when the test ends.
+type Opener func(t *testing.T, opt store.Options) store.Stores
+
+// RunConformance checks that the stores open returns behave as the engine
+// expects of every backend, using only the store interfaces. Each subtest
+// opens its own stores.
+func RunConformance(t *testing.T, open Opener) {
+	for _, c := range []struct {
+		name string
+		opt  store.Options
+		fn   func(*testing.T, store.Stores)
+	}{
+		{"logs/insert", store.Options{}, testInsertLogs},
+		{"logs/unique-content", store.Options{UniqueContentSources: []string{"profile"}}, testUniqueContent},
+		{"logs/filters", store.Options{}, testLogFilters},
+		{"logs/sessions", store.Options{}, testSessions},
+		{"logs/update", store.Options{}, testUpdateLog},
+		{"logs/delete", store.Options{}, testDeleteLogs},
+		{"logs/import", store.Options{}, testImportLogs},
+		{"logs/embedding-queue", store.Options{}, testEmbeddingQueue},
+		{"logs/embeddings", store.Options{}, testStoredEmbeddings},
+		{"logs/overflow", store.Options{}, testOverflow},
+		{"logs/consolidation-runs", store.Options{}, testConsolidationRuns},
+		{"logs/retention", store.Options{}, testRetention},
+		{"logs/summaries", store.Options{}, testSummaries},
+		{"logs/access", store.Options{}, testAccess},
+		{"triples/upsert", store.Options{}, testUpsertTriples},
+		{"triples/search", store.Options{}, testSearchFacts},
+		{"triples/recent", store.Options{}, testRecentFacts},
+		{"triples/list", store.Options{}, testListTriples},
+		{"triples/neighbors", store.Options{}, testNeighbors},
+		{"triples/path", store.Options{}, testFindPath},
+		{"triples/pattern", store.Options{}, testQueryPattern},
+		{"triples/entities", store.Options{}, testListEntities},
+		{"triples/aliases", store.Options{}, testAliases},
+		{"triples/supersede", store.Options{FunctionalPredicates: []string{"lives_in"}}, testSupersede},
+		{"triples/contradictions-delete", store.Options{FunctionalPredicates: []string{"lives_*"}, Contradictions: graph.ContradictionDelete}, testContradictionsDelete},
+		{"triples/delete", store.Options{}, testDeleteTriples},
+		{"triples/prune", store.Options{}, testPruneTriples},
+		{"triples/export", store.Options{FunctionalPredicates: []string{"lives_in"}}, testExport},
+		{"triples/provenance", store.Options{}, testProvenance},
+		{"vectors/search", store.Options{EnableVSS: true}, testVectorSearch},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			c.fn(t, open(t, c.opt))
+		})
+	}
+}
+
+// day is the date the suite's logs are timestamped on, whole seconds in
+// UTC as every backend stores them.
+var day = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func hour(n int) time.Time { return day.Add(time.Duration(n) * time.Hour) }
+
+func insertLogs(t *testing.T, st store.Stores, inputs ...model.SensoryInput) []string {
+	t.Helper()
+	ids, _, err := st.Logs.InsertLogs(context.Background(), inputs)
+	if err != nil {
+		t.Fatalf("insert logs: %v", err)
+	}
+	return ids
+}
+
+func upsertTriples(t *testing.T, st store.Stores, triples ...model.Triple) []int64 {
+	t.Helper()
+	res, err := st.Triples.UpsertTriples(context.Background(), triples)
+	if err != nil {
+		t.Fatalf("upsert triples: %v", err)
+	}
+	ids := make([]int64, len(res))
+	for i, r := range res {
+		ids[i] = r.ID
+	}
+	return ids
+}
+
+func logIDs(logs []model.LogEntry) []string {
+	ids := make([]string, len(logs))
+	for i, l := range logs {
+		ids[i] = l.ID
+	}
+	return ids
+}
+
+func tripleIDs(triples []model.Triple) []int64 {
+	ids := make([]int64, len(triples))
+	for i, tr := range triples {
+		ids[i] = tr.ID
+	}
+	return ids
+}
+
+func sorted(ids []string) []string {
+	ids = append([]string{}, ids...)
+	sort.Strings(ids)
+	return ids
+}
+
+func equal[T any](t *testing.T, what string, got, want T) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s = %v, want %v", what, got, want)
+	}
+}
+
+func near(t *testing.T, what string, got, want float64) {
+	t.Helper()
+	if math.Abs(got-want) > 1e-6 {
+		t.Errorf("%s = %v, want %v", what, got, want)
+	}
+}
+
+func fetchLog(t *testing.T, st store.Stores, id string) *model.LogEntry {
+	t.Helper()
+	l, err := st.Logs.FetchLog(context.Background(), id)
+	if err != nil {
+		t.Fatalf("fetch log %s: %v", id, err)
+	}
+	return l
+}
+
+func getTriple(t *testing.T, st store.Stores, id int64) *model.Triple {
+	t.Helper()
+	tr, err := st.Triples.GetTriple(context.Background(), id)
+	if err != nil {
+		t.Fatalf("get triple %d: %v", id, err)
+	}
+	return tr
+}
+
+func testInsertLogs(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	ids := insertLogs(t, st,
+		model.SensoryInput{Content: "first", Source: "chat", Timestamp: day, SessionID: "s1",
+			Metadata: map[string]any{"project": "paim", "owner": map[string]any{"name": "ann"}}},
+		model.SensoryInput{Content: "second", Source: "mail", Namespace: "work"},
+	)
+	if len(ids) != 2 || ids[0] == "" || ids[0] == ids[1] {
+		t.Fatalf("ids = %v, want two distinct ids", ids)
+	}
+
+	l := fetchLog(t, st, ids[0])
+	equal(t, "content", l.Content, "first")
+	equal(t, "source", l.SourceType, "chat")
+	equal(t, "namespace", l.Namespace, model.DefaultNamespace)
+	equal(t, "session", l.SessionID, "s1")
+	equal(t, "metadata", l.Metadata, map[string]any{"project": "paim", "owner": map[string]any{"name": "ann"}})
+	if !l.Timestamp.Equal(day) {
+		t.Errorf("timestamp = %v, want %v", l.Timestamp, day)
+	}
+	if l.UpdatedAt != nil {
+		t.Errorf("updated_at = %v, want none", l.UpdatedAt)
+	}
+	equal(t, "namespace", fetchLog(t, st, ids[1]).Namespace, "work")
+	if ts := fetchLog(t, st, ids[1]).Timestamp; ts.IsZero() {
+		t.Error("a log without timestamp must be dated now")
+	}
+
+	if _, err := st.Logs.FetchLog(ctx, "missing"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("fetch missing log: err = %v, want sql.ErrNoRows", err)
+	}
+	logs, err := st.Logs.FetchLogs(ctx, []string{ids[1], "missing", ids[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "fetched logs", sorted(logIDs(logs)), sorted(ids))
+	if n, err := st.Logs.CountLogs(ctx); err != nil || n != 2 {
+		t.Errorf("count = %d, %v; want 2", n, err)
+	}
+}
+
+func testUniqueContent(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	first := insertLogs(t, st, model.SensoryInput{Content: "likes tea", Source: "profile"})
+	ids, existing, err := st.Logs.InsertLogs(ctx, []model.SensoryInput{
+		{Content: "likes tea", Source: "profile"},
+		{Content: "likes tea", Source: "profile", Namespace: "work"},
+		{Content: "likes tea", Source: "chat"},
+		{Content: "likes tea", Source: "chat"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "existing", existing, []bool{true, false, false, false})
+	equal(t, "id of the duplicate", ids[0], first[0])
+	if ids[2] == ids[3] {
+		t.Error("content of other sources must not be deduplicated")
+	}
+	if n, _ := st.Logs.CountLogs(ctx); n != 4 {
+		t.Errorf("count = %d, want 4", n)
+	}
+}
+
+func testLogFilters(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	ids := insertLogs(t, st,
+		model.SensoryInput{Content: "a", Source: "chat", Timestamp: hour(0), Metadata: map[string]any{"project": "x"}},
+		model.SensoryInput{Content: "b", Source: "mail", Timestamp: hour(1), Metadata: map[string]any{"project": "y", "flag": true, "n": 2}},
+		model.SensoryInput{Content: "c", Source: "chat", Timestamp: hour(2), Namespace: "work"},
+		model.SensoryInput{Content: "d", Source: "chat", Timestamp: hour(3), Metadata: map[string]any{"project": "x"}},
+	)
+	a, b, c, d := ids[0], ids[1], ids[2], ids[3]
+	for _, tc := range []struct {
+		name  string
+		limit int
+		f     sqlite.LogFilter
+		want  []string
+	}{
+		{"namespace", 10, sqlite.LogFilter{Namespace: model.DefaultNamespace}, []string{d, b, a}},
+		{"every namespace", 10, sqlite.LogFilter{}, []string{d, c, b, a}},
+		{"source", 10, sqlite.LogFilter{Namespace: model.DefaultNamespace, Source: "chat"}, []string{d, a}},
+		{"metadata", 10, sqlite.LogFilter{Metadata: map[string]string{"project": "x"}}, []string{d, a}},
+		{"metadata bool", 10, sqlite.LogFilter{Metadata: map[string]string{"flag": "true"}}, []string{b}},
+		{"metadata number", 10, sqlite.LogFilter{Metadata: map[string]string{"n": "2"}}, []string{b}},
+		{"metadata missing", 10, sqlite.LogFilter{Metadata: map[string]string{"project": "z"}}, []string{}},
+		{"time range", 10, sqlite.LogFilter{From: hour(1), To: hour(2)}, []string{c, b}},
+		{"limit", 1, sqlite.LogFilter{Namespace: model.DefaultNamespace}, []string{d}},
+	} {
+		logs, err := st.Logs.RecentLogsFiltered(ctx, tc.limit, tc.f)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		equal(t, tc.name, logIDs(logs), tc.want)
+	}
+}
+
+func testSessions(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	ids := insertLogs(t, st,
+		model.SensoryInput{Content: "later", SessionID: "s1", Timestamp: hour(1)},
+		model.SensoryInput{Content: "earlier", SessionID: "s1", Timestamp: hour(0)},
+		model.SensoryInput{Content: "other namespace", SessionID: "s1", Timestamp: hour(2), Namespace: "work"},
+		model.SensoryInput{Content: "other session", SessionID: "s2", Timestamp: hour(0)},
+	)
+	logs, err := st.Logs.FetchSessionFiltered(ctx, "s1", sqlite.LogFilter{Namespace: model.DefaultNamespace})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "session logs", logIDs(logs), []string{ids[1], ids[0]})
+	logs, err = st.Logs.FetchSessionFiltered(ctx, "s1", sqlite.LogFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "session logs of every namespace", logIDs(logs), []string{ids[1], ids[0], ids[2]})
+}
+
+func testUpdateLog(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	id := insertLogs(t, st, model.SensoryInput{Content: "old", Source: "chat", Timestamp: day,
+		Metadata: map[string]any{"a": 1, "nested": map[string]any{"x": 1, "y": 2}}})[0]
+	if err := st.Logs.SaveEmbedding(ctx, id, "m", []float64{1, 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	content, source := "new", "mail"
+	at := day.Add(time.Hour + 123456*time.Microsecond)
+	err := st.Logs.UpdateLogPendingEmbedding(ctx, id, sqlite.LogPatch{
+		Content: &content, SourceType: &source, At: at, UnmodifiedSince: day,
+		Metadata: map[string]any{"nested": map[string]any{"y": nil}, "b": "2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := fetchLog(t, st, id)
+	equal(t, "content", l.Content, "new")
+	equal(t, "source", l.SourceType, "mail")
+	equal(t, "metadata", l.Metadata, map[string]any{"a": float64(1), "nested": map[string]any{"x": float64(1)}, "b": "2"})
+	if l.UpdatedAt == nil || !l.UpdatedAt.Equal(at) {
+		t.Errorf("updated_at = %v, want %v", l.UpdatedAt, at)
+	}
+	if emb, err := st.Logs.StoredEmbedding(ctx, id, "m"); err != nil || emb != nil {
+		t.Errorf("stored embedding after a content change = %v, %v; want none", emb, err)
+	}
+	if s, err := st.Logs.LogEmbeddingState(ctx, id, false); err != nil || !s.Queued {
+		t.Errorf("embedding state = %+v, %v; want queued", s, err)
+	}
+
+	if err := st.Logs.UpdateLog(ctx, id, sqlite.LogPatch{Content: &content, UnmodifiedSince: day}); !errors.Is(err, sqlite.ErrLogModified) {
+		t.Errorf("stale update: err = %v, want ErrLogModified", err)
+	}
+	err = st.Logs.UpdateLog(ctx, id, sqlite.LogPatch{UnmodifiedSince: *l.UpdatedAt, ReplaceMetadata: true,
+		Metadata: map[string]any{"only": "this"}})
+	if err != nil {
+		t.Errorf("update with the current updated_at: %v", err)
+	}
+	equal(t, "replaced metadata", fetchLog(t, st, id).Metadata, map[string]any{"only": "this"})
+	if err := st.Logs.UpdateLog(ctx, "missing", sqlite.LogPatch{Content: &content}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("update missing log: err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testDeleteLogs(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	ids, _, err := st.Logs.InsertLogsPendingEmbedding(ctx, []model.SensoryInput{
+		{Content: "a", Source: "chat", Timestamp: hour(0)},
+		{Content: "b", Source: "chat", Timestamp: hour(1)},
+		{Content: "c", Source: "chat", Timestamp: hour(2)},
+		{Content: "d", Source: "mail", Timestamp: hour(0)},
+		{Content: "e", Source: "chat", Timestamp: hour(0), Namespace: "work"},
+		{Content: "f", Source: "chat", Timestamp: hour(5), Namespace: "work"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seen []string
+	n, err := st.Logs.DeleteLogsWhere(ctx, sqlite.DeleteParams{Namespace: model.DefaultNamespace, Source: "chat", After: hour(0)},
+		func(batch []string) error {
+			seen = append(seen, batch...)
+			return nil
+		})
+	if err != nil || n != 2 {
+		t.Fatalf("delete where = %d, %v; want 2", n, err)
+	}
+	equal(t, "ids passed to before", sorted(seen), sorted(ids[1:3]))
+	n, err = st.Logs.DeleteLogsWhere(ctx, sqlite.DeleteParams{Namespace: "work", Before: hour(1)}, nil)
+	if err != nil || n != 1 {
+		t.Fatalf("delete where before = %d, %v; want 1", n, err)
+	}
+	if n, err := st.Logs.DeleteLogsWhere(ctx, sqlite.DeleteParams{Namespace: "work"},
+		func([]string) error { return errors.New("stop") }); err == nil || n != 0 {
+		t.Errorf("delete where with failing before = %d, %v; want 0 and the error", n, err)
+	}
+	n, err = st.Logs.DeleteLogs(ctx, []string{ids[3], "missing"})
+	if err != nil || n != 1 {
+		t.Fatalf("delete logs = %d, %v; want 1", n, err)
+	}
+
+	logs, err := st.Logs.RecentLogsFiltered(ctx, 10, sqlite.LogFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "remaining logs", logIDs(logs), []string{ids[5], ids[0]})
+	if n, err := st.Logs.PendingEmbeddingCount(ctx); err != nil || n != 2 {
+		t.Errorf("pending embeddings = %d, %v; want those of the remaining logs", n, err)
+	}
+}
+
+func testImportLogs(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	updated := hour(5)
+	logs := []model.LogEntry{
+		{ID: "imp-1", Content: "one", SourceType: "chat", Timestamp: hour(1), UpdatedAt: &updated,
+			Metadata: map[string]any{"k": "v"}, SessionID: "s"},
+		{ID: "imp-2", Content: "two", SourceType: "chat", Timestamp: hour(0), Namespace: "work"},
+	}
+	if n, err := st.Logs.ImportLogs(ctx, logs, true); err != nil || n != 2 {
+		t.Fatalf("import = %d, %v; want 2", n, err)
+	}
+	if n, err := st.Logs.ImportLogs(ctx, logs, true); err != nil || n != 0 {
+		t.Errorf("import again = %d, %v; want 0", n, err)
+	}
+	if n, _ := st.Logs.PendingEmbeddingCount(ctx); n != 2 {
+		t.Errorf("pending embeddings = %d, want 2", n)
+	}
+
+	var got []model.LogEntry
+	if err := st.Logs.EachLog(ctx, func(l model.LogEntry) error {
+		got = append(got, l)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "logs in timestamp order", logIDs(got), []string{"imp-2", "imp-1"})
+	l := fetchLog(t, st, "imp-1")
+	equal(t, "namespace", l.Namespace, model.DefaultNamespace)
+	equal(t, "session", l.SessionID, "s")
+	equal(t, "metadata", l.Metadata, map[string]any{"k": "v"})
+	if !l.Timestamp.Equal(hour(1)) || l.UpdatedAt == nil || !l.UpdatedAt.Equal(updated) {
+		t.Errorf("timestamps = %v, %v; want %v, %v", l.Timestamp, l.UpdatedAt, hour(1), updated)
+	}
+	stop := errors.New("stop")
+	if err := st.Logs.EachLog(ctx, func(model.LogEntry) error { return stop }); !errors.Is(err, stop) {
+		t.Errorf("EachLog err = %v, want the callback's", err)
+	}
+}
+
+func testEmbeddingQueue(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	ids, _, err := st.Logs.InsertLogsPendingEmbedding(ctx, []model.SensoryInput{{Content: "a"}, {Content: "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	insertLogs(t, st, model.SensoryInput{Content: "not queued"})
+	if n, err := st.Logs.PendingEmbeddingCount(ctx); err != nil || n != 2 {
+		t.Fatalf("pending = %d, %v; want 2", n, err)
+	}
+
+	claimed, err := st.Logs.ClaimEmbeddings(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 2 || claimed[0].Content == "" {
+		t.Fatalf("claimed = %+v, want both logs with their content", claimed)
+	}
+	if again, _ := st.Logs.ClaimEmbeddings(ctx, 10, time.Minute); len(again) != 0 {
+		t.Errorf("claimed leased logs %+v", again)
+	}
+	if err := st.Logs.ReleaseEmbeddings(ctx, []string{ids[0]}); err != nil {
+		t.Fatal(err)
+	}
+	claimed, err = st.Logs.ClaimEmbeddings(ctx, 10, time.Minute)
+	if err != nil || len(claimed) != 1 || claimed[0].LogID != ids[0] {
+		t.Fatalf("claim after release = %+v, %v; want %s", claimed, err, ids[0])
+	}
+
+	if err := st.Logs.FailEmbedding(ctx, ids[1], errors.New("boom"), time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	s, err := st.Logs.LogEmbeddingState(ctx, ids[1], false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Queued || s.Attempts != 1 || s.LastError != "boom" {
+		t.Errorf("state after failure = %+v", s)
+	}
+	claimed, err = st.Logs.ClaimEmbeddings(ctx, 10, time.Minute)
+	if err != nil || len(claimed) != 1 || claimed[0].LogID != ids[1] || claimed[0].Attempts != 1 {
+		t.Fatalf("claim after failure = %+v, %v; want the retry of %s", claimed, err, ids[1])
+	}
+	if err := st.Logs.FailEmbedding(ctx, ids[1], errors.New("again"), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if claimed, _ := st.Logs.ClaimEmbeddings(ctx, 10, time.Minute); len(claimed) != 0 {
+		t.Errorf("claimed %+v before its retry", claimed)
+	}
+
+	if err := st.Logs.CompleteEmbedding(ctx, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := st.Logs.LogEmbeddingState(ctx, ids[0], false); s.Queued {
+		t.Errorf("completed log still queued: %+v", s)
+	}
+	if n, err := st.Logs.EnqueueAllLogs(ctx); err != nil || n != 3 {
+		t.Fatalf("enqueue all = %d, %v; want 3", n, err)
+	}
+	if s, _ := st.Logs.LogEmbeddingState(ctx, ids[1], false); s.Attempts != 0 || s.LastError != "" {
+		t.Errorf("state after enqueue all = %+v, want a fresh attempt count", s)
+	}
+	claimed, err = st.Logs.ClaimEmbeddings(ctx, 2, time.Minute)
+	if err != nil || len(claimed) != 2 {
+		t.Errorf("claim after enqueue all = %+v, %v; want limit 2", claimed, err)
+	}
+}
+
+func testStoredEmbeddings(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	ids := insertLogs(t, st,
+		model.SensoryInput{Content: "a", Source: "chat", Timestamp: hour(0)},
+		model.SensoryInput{Content: "b", Source: "chat", Timestamp: hour(1)},
+		model.SensoryInput{Content: "c", Source: "mail", Timestamp: hour(2)},
+		model.SensoryInput{Content: "d", Source: "chat", Timestamp: hour(3), Namespace: "work"},
+	)
+	for _, id := range ids {
+		if err := st.Logs.SaveEmbedding(ctx, id, "m1", []float64{1, 0.5, -0.25}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.Logs.SaveEmbedding(ctx, ids[0], "m1", []float64{0, 1, 0}); err != nil {
+		t.Fatal(err)
+	}
+	emb, err := st.Logs.StoredEmbedding(ctx, ids[0], "m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "stored embedding", emb, []float64{0, 1, 0})
+	if emb, err := st.Logs.StoredEmbedding(ctx, ids[0], "m2"); err != nil || emb != nil {
+		t.Errorf("embedding of another model = %v, %v; want none", emb, err)
+	}
+	recent, err := st.Logs.RecentEmbeddings(ctx, model.DefaultNamespace, "chat", "m1", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, len(recent))
+	for i, v := range recent {
+		got[i] = v.LogID
+	}
+	equal(t, "recent embeddings", got, []string{ids[1], ids[0]})
+
+	if name, err := st.Logs.EmbedderModel(ctx); err != nil || name != "" {
+		t.Errorf("embedder model = %q, %v; want none", name, err)
+	}
+	if err := st.Logs.SetEmbedderModel(ctx, "m1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Logs.SetEmbedderModel(ctx, "m2"); err != nil {
+		t.Fatal(err)
+	}
+	if name, err := st.Logs.EmbedderModel(ctx); err != nil || name != "m2" {
+		t.Errorf("embedder model = %q, %v; want m2", name, err)
+	}
+	if st.Logs.VectorDim() <= 0 {
+		t.Errorf("vector dim = %d", st.Logs.VectorDim())
+	}
+}
+
+func testOverflow(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	ids := insertLogs(t, st, model.SensoryInput{Content: "a"}, model.SensoryInput{Content: "b"}, model.SensoryInput{Content: "c"})
+	if err := st.Logs.StageOverflow(ctx, []string{ids[1], ids[0], "missing"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Logs.StageOverflow(ctx, []string{ids[1]}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := st.Logs.OverflowCount(ctx); err != nil || n != 2 {
+		t.Fatalf("overflow count = %d, %v; want 2", n, err)
+	}
+	logs, err := st.Logs.OverflowLogs(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "overflow logs", logIDs(logs), []string{ids[1], ids[0]})
+
+	triple := model.Triple{Subject: "a", Predicate: "p", Object: "b", Confidence: 0.5}
+	if _, err := st.Triples.UpsertTriplesWith(ctx, []model.Triple{triple}, func(tx *sql.Tx) error {
+		return st.Logs.ClearOverflowTx(ctx, tx, []string{ids[1]})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	fail := errors.New("fail")
+	triple.Object = "c"
+	if _, err := st.Triples.UpsertTriplesWith(ctx, []model.Triple{triple}, func(tx *sql.Tx) error {
+		if err := st.Logs.ClearOverflowTx(ctx, tx, []string{ids[0]}); err != nil {
+			return err
+		}
+		return fail
+	}); !errors.Is(err, fail) {
+		t.Fatalf("err = %v, want %v", err, fail)
+	}
+	logs, err = st.Logs.OverflowLogs(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "overflow logs after clearing", logIDs(logs), []string{ids[0]})
+	if n, _ := st.Triples.Count(ctx); n != 1 {
+		t.Errorf("triples = %d, want 1: the failed transaction must roll back", n)
+	}
+}
+
+func testConsolidationRuns(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	var runs []model.ConsolidationRun
+	for i := 0; i < 3; i++ {
+		run := model.ConsolidationRun{StartedAt: hour(i), FinishedAt: hour(i).Add(time.Second), Inputs: i, TriplesWritten: 2 * i}
+		if i == 2 {
+			run.Error = "extraction failed"
+		}
+		if err := st.Logs.RecordConsolidationRun(ctx, &run, 2); err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 && run.ID <= runs[i-1].ID {
+			t.Errorf("run id %d after %d", run.ID, runs[i-1].ID)
+		}
+		runs = append(runs, run)
+	}
+	got, err := st.Logs.ConsolidationRuns(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("runs = %+v, want the latest 2", got)
+	}
+	for i, want := range []model.ConsolidationRun{runs[2], runs[1]} {
+		g := got[i]
+		if g.ID != want.ID || !g.StartedAt.Equal(want.StartedAt) || !g.FinishedAt.Equal(want.FinishedAt) ||
+			g.Inputs != want.Inputs || g.TriplesWritten != want.TriplesWritten || g.Error != want.Error {
+			t.Errorf("run %d = %+v, want %+v", i, g, want)
+		}
+	}
+}
+
+func testRetention(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	ids := insertLogs(t, st,
+		model.SensoryInput{Content: "cited", Timestamp: hour(0)},
+		model.SensoryInput{Content: "old", Timestamp: hour(1)},
+		model.SensoryInput{Content: "new", Timestamp: hour(3)},
+	)
+	cited, old, recent := ids[0], ids[1], ids[2]
+	upsertTriples(t, st, model.Triple{Subject: "a", Predicate: "p", Object: "b", Confidence: 0.5, Sources: []string{cited}})
+
+	for _, tc := range []struct {
+		name      string
+		olderThan time.Time
+		keep      int
+		exclude   []string
+		want      []string
+	}{
+		{"older than", hour(2), 0, nil, []string{old}},
+		{"keep", time.Time{}, 1, nil, []string{old}},
+		{"keep none older", hour(0), 0, nil, []string{}},
+		{"exclude", hour(4), 0, []string{old}, []string{recent}},
+	} {
+		got, err := st.Logs.PrunableLogs(ctx, tc.olderThan, tc.keep, tc.exclude)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		equal(t, tc.name, sorted(got), tc.want)
+	}
+	got, err := st.Logs.UncitedLogs(ctx, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "uncited logs", sorted(got), sorted([]string{old, recent}))
+}
+
+func testSummaries(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	ids := insertLogs(t, st,
+		model.SensoryInput{Content: "b", Source: "chat", Timestamp: hour(1)},
+		model.SensoryInput{Content: "a", Source: "chat", Timestamp: hour(0), Namespace: "work"},
+		model.SensoryInput{Content: "new", Source: "chat", Timestamp: hour(3)},
+	)
+	candidates, err := st.Logs.SummaryCandidates(ctx, hour(2), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "candidates", logIDs(candidates), []string{ids[1], ids[0]})
+
+	id, err := st.Logs.InsertSummary(ctx, model.SensoryInput{Content: "summary of b", Source: model.SummarySource},
+		hour(1), []string{ids[0]}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := fetchLog(t, st, id)
+	equal(t, "summary source", s.SourceType, model.SummarySource)
+	equal(t, "summary namespace", s.Namespace, model.DefaultNamespace)
+	if !s.Timestamp.Equal(hour(1)) {
+		t.Errorf("summary timestamp = %v, want %v", s.Timestamp, hour(1))
+	}
+	equal(t, "summarized into", fetchLog(t, st, ids[0]).SummarizedInto, id)
+	if n, _ := st.Logs.PendingEmbeddingCount(ctx); n != 1 {
+		t.Errorf("pending embeddings = %d, want the summary", n)
+	}
+	candidates, err = st.Logs.SummaryCandidates(ctx, hour(2), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "candidates after summarizing", logIDs(candidates), []string{ids[1]})
+}
+
+func testAccess(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	logID := insertLogs(t, st, model.SensoryInput{Content: "a"})[0]
+	tripleID := upsertTriples(t, st, model.Triple{Subject: "a", Predicate: "p", Object: "b", Confidence: 0.5})[0]
+	b := sqlite.AccessBatch{
+		Logs:    map[string]int{logID: 2, "missing": 1},
+		Triples: map[int64]int{tripleID: 1, tripleID + 100: 1},
+		At:      day, ReinforceStep: 0.1, ReinforceCap: 0.65,
+	}
+	if err := st.Logs.RecordAccess(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	l := fetchLog(t, st, logID)
+	if l.AccessCount != 2 || l.LastAccessedAt == nil || !l.LastAccessedAt.Equal(day) {
+		t.Errorf("log access = %d at %v, want 2 at %v", l.AccessCount, l.LastAccessedAt, day)
+	}
+	tr := getTriple(t, st, tripleID)
+	if tr.AccessCount != 1 || tr.LastAccessedAt == nil || !tr.LastAccessedAt.Equal(day) {
+		t.Errorf("triple access = %d at %v, want 1 at %v", tr.AccessCount, tr.LastAccessedAt, day)
+	}
+	near(t, "reinforced confidence", tr.Confidence, 0.6)
+	if err := st.Logs.RecordAccess(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	near(t, "capped confidence", getTriple(t, st, tripleID).Confidence, 0.65)
+}
+
+func testUpsertTriples(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	logID := insertLogs(t, st, model.SensoryInput{Content: "alice works at acme"})[0]
+	res, err := st.Triples.UpsertTriples(ctx, []model.Triple{
+		{Subject: " Alice ", Predicate: "works_at", Object: "ACME  Corp", Confidence: 0.5, Sources: []string{logID}},
+		{Subject: "alice", Predicate: "works_at", Object: "acme corp", Confidence: 0.4},
+		{Subject: "alice", Predicate: "works_at", Object: "acme corp", Confidence: 0.5, Namespace: "work"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res[0].Inserted || res[1].Inserted || res[1].ID != res[0].ID || !res[2].Inserted || res[2].ID == res[0].ID {
+		t.Fatalf("results = %+v", res)
+	}
+	tr := getTriple(t, st, res[0].ID)
+	equal(t, "subject", tr.Subject, "alice")
+	equal(t, "object", tr.Object, "acme corp")
+	equal(t, "labels", []string{tr.SubjectLabel, tr.ObjectLabel}, []string{"alice", "acme corp"})
+	equal(t, "namespace", tr.Namespace, model.DefaultNamespace)
+	equal(t, "observations", tr.ObservationCount, 2)
+	equal(t, "sources", tr.Sources, []string{logID})
+	near(t, "reinforced confidence", tr.Confidence, 0.5+0.5*0.4*0.5)
+	if tr.CreatedAt.IsZero() || tr.SupersededBy != 0 || tr.ValidFrom != nil || tr.ValidTo != nil {
+		t.Errorf("triple = %+v", tr)
+	}
+	if _, err := st.Triples.GetTriple(ctx, res[0].ID+100); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("get missing triple: err = %v, want sql.ErrNoRows", err)
+	}
+
+	from, to := hour(0), hour(1)
+	id := upsertTriples(t, st, model.Triple{Subject: "bob", Predicate: "visited", Object: "rome", Confidence: 0.7, ValidFrom: &from, ValidTo: &to})[0]
+	tr = getTriple(t, st, id)
+	if tr.ValidFrom == nil || !tr.ValidFrom.Equal(from) || tr.ValidTo == nil || !tr.ValidTo.Equal(to) {
+		t.Errorf("validity = %v..%v, want %v..%v", tr.ValidFrom, tr.ValidTo, from, to)
+	}
+	if _, err := st.Triples.UpsertTriples(ctx, []model.Triple{
+		{Subject: "carol", Predicate: "p", Object: "x", Confidence: 0.5},
+		{Subject: "bob", Predicate: "visited", Object: "oslo", Confidence: 0.5, ValidFrom: &to, ValidTo: &from},
+	}); err == nil {
+		t.Error("valid_to before valid_from must fail")
+	}
+	if n, _ := st.Triples.Count(ctx); n != 3 {
+		t.Errorf("count = %d, want 3: the batch must be atomic", n)
+	}
+}
+
+// searchGraph stores the facts the search tests run on and returns their
+// ids: alice works at acme corp, bob works at acme corp, alice likes 100%
+// juice, carol knows alice, and in "work" alice works at globex.
+func searchGraph(t *testing.T, st store.Stores) []int64 {
+	mail := insertLogs(t, st, model.SensoryInput{Content: "from bob", Source: "mail", Metadata: map[string]any{"thread": "t1"}})[0]
+	return upsertTriples(t, st,
+		model.Triple{Subject: "Alice", Predicate: "works_at", Object: "Acme Corp", Confidence: 0.9},
+		model.Triple{Subject: "Bob", Predicate: "works_at", Object: "Acme Corp", Confidence: 0.6, Sources: []string{mail}},
+		model.Triple{Subject: "Alice", Predicate: "likes", Object: "100% juice", Confidence: 0.8},
+		model.Triple{Subject: "Carol", Predicate: "knows", Object: "Alice", Confidence: 0.4},
+		model.Triple{Subject: "Alice", Predicate: "works_at", Object: "Globex", Confidence: 0.7, Namespace: "work"},
+	)
+}
+
+func testSearchFacts(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	ids := searchGraph(t, st)
+	worksAt, bobWorksAt, likes, knows, globex := ids[0], ids[1], ids[2], ids[3], ids[4]
+	def := model.DefaultNamespace
+	for _, tc := range []struct {
+		name string
+		term string
+		f    graph.FactFilter
+		want []int64
+	}{
+		{"contains", "Alice", graph.FactFilter{Namespace: def}, []int64{worksAt, likes, knows}},
+		{"every namespace", "alice", graph.FactFilter{}, []int64{worksAt, likes, globex, knows}},
+		{"min confidence", "alice", graph.FactFilter{Namespace: def, MinConfidence: 0.5}, []int64{worksAt, likes}},
+		{"predicate", "alice", graph.FactFilter{Namespace: def, Predicate: "works_at"}, []int64{worksAt}},
+		{"prefix", "ac", graph.FactFilter{Namespace: def, Match: graph.MatchPrefix}, []int64{worksAt, bobWorksAt}},
+		{"prefix inside a word", "lice", graph.FactFilter{Namespace: def, Match: graph.MatchPrefix}, []int64{}},
+		{"exact", "acme corp", graph.FactFilter{Namespace: def, Match: graph.MatchExact}, []int64{worksAt, bobWorksAt}},
+		{"exact partial", "acme", graph.FactFilter{Namespace: def, Match: graph.MatchExact}, []int64{}},
+		{"phrase", "acme  corp", graph.FactFilter{Namespace: def, Match: graph.MatchPhrase}, []int64{worksAt, bobWorksAt}},
+		{"phrase out of order", "corp acme", graph.FactFilter{Namespace: def, Match: graph.MatchPhrase}, []int64{}},
+		{"literal percent", "100%", graph.FactFilter{Namespace: def}, []int64{likes}},
+		{"literal underscore", "1_0", graph.FactFilter{Namespace: def}, []int64{}},
+		{"all words", "alice acme", graph.FactFilter{Namespace: def, Match: graph.MatchAll}, []int64{worksAt}},
+		{"any word", "bob carol", graph.FactFilter{Namespace: def, Match: graph.MatchAny}, []int64{bobWorksAt, knows}},
+		{"any word ranks by words", "alice acme", graph.FactFilter{Namespace: def, Match: graph.MatchAny}, []int64{worksAt, likes, bobWorksAt, knows}},
+		{"source", "acme", graph.FactFilter{Source: "mail"}, []int64{bobWorksAt}},
+		{"metadata", "acme", graph.FactFilter{Metadata: map[string]string{"thread": "t1"}}, []int64{bobWorksAt}},
+		{"created before", "alice", graph.FactFilter{Namespace: def, To: day}, []int64{}},
+		{"created after", "alice", graph.FactFilter{Namespace: def, From: day}, []int64{worksAt, likes, knows}},
+	} {
+		facts, err := st.Triples.SearchFactsFiltered(ctx, tc.term, 10, tc.f)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		equal(t, tc.name, tripleIDs(facts), tc.want)
+	}
+	facts, err := st.Triples.SearchFactsFiltered(ctx, "alice", 1, graph.FactFilter{Namespace: def})
+	if err != nil || len(facts) != 1 || facts[0].ID != worksAt {
+		t.Errorf("limit 1 = %v, %v", facts, err)
+	} else if facts[0].SubjectLabel != "Alice" || facts[0].ObjectLabel != "Acme Corp" {
+		t.Errorf("labels = %q, %q", facts[0].SubjectLabel, facts[0].ObjectLabel)
+	}
+}
+
+func testRecentFacts(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	ids := searchGraph(t, st)
+	facts, err := st.Triples.RecentFacts(ctx, 2, graph.FactFilter{Namespace: model.DefaultNamespace})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "recent facts", tripleIDs(facts), []int64{ids[0], ids[2]})
+	facts, err = st.Triples.RecentFacts(ctx, 10, graph.FactFilter{Namespace: model.DefaultNamespace, MinConfidence: 0.7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "recent confident facts", tripleIDs(facts), []int64{ids[0], ids[2]})
+	facts, err = st.Triples.RecentFacts(ctx, 10, graph.FactFilter{Namespace: "work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "recent facts of work", tripleIDs(facts), []int64{ids[4]})
+}
+
+func testListTriples(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	ids := searchGraph(t, st)
+	page, err := st.Triples.ListTriples(ctx, graph.ListParams{Namespace: model.DefaultNamespace, Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "first page", tripleIDs(page.Triples), ids[:3])
+	if page.NextCursor != ids[2] || page.Remaining != 1 {
+		t.Errorf("cursor = %d, remaining = %d; want %d, 1", page.NextCursor, page.Remaining, ids[2])
+	}
+	page, err = st.Triples.ListTriples(ctx, graph.ListParams{Namespace: model.DefaultNamespace, Limit: 3, Cursor: page.NextCursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "last page", tripleIDs(page.Triples), ids[3:4])
+	if page.NextCursor != 0 || page.Remaining != 0 {
+		t.Errorf("cursor = %d, remaining = %d; want none", page.NextCursor, page.Remaining)
+	}
+
+	for _, tc := range []struct {
+		name string
+		p    graph.ListParams
+		want []int64
+	}{
+		{"subject", graph.ListParams{Subject: "ALICE"}, []int64{ids[0], ids[2], ids[4]}},
+		{"object", graph.ListParams{Namespace: model.DefaultNamespace, Object: "acme corp"}, []int64{ids[0], ids[1]}},
+		{"predicate and confidence", graph.ListParams{Predicate: "works_at", MinConfidence: 0.65}, []int64{ids[0], ids[4]}},
+		{"contains", graph.ListParams{Object: "acme", Match: graph.MatchContains}, []int64{ids[0], ids[1]}},
+		{"any word", graph.ListParams{Namespace: model.DefaultNamespace, Object: "juice alice", Match: graph.MatchAny}, []int64{ids[2], ids[3]}},
+	} {
+		page, err := st.Triples.ListTriples(ctx, tc.p)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		equal(t, tc.name, tripleIDs(page.Triples), tc.want)
+	}
+}
+
+// chain stores a -> b -> c -> d, x -> a and the stronger detour
+// a -> e -> c in the default namespace, and a -> d in "work".
+func chain(t *testing.T, st store.Stores) map[string]int64 {
+	ids := upsertTriples(t, st,
+		model.Triple{Subject: "a", Predicate: "to", Object: "b", Confidence: 0.5},
+		model.Triple{Subject: "b", Predicate: "to", Object: "c", Confidence: 0.5},
+		model.Triple{Subject: "c", Predicate: "to", Object: "d", Confidence: 0.5},
+		model.Triple{Subject: "x", Predicate: "to", Object: "a", Confidence: 0.5},
+		model.Triple{Subject: "a", Predicate: "via", Object: "e", Confidence: 0.9},
+		model.Triple{Subject: "e", Predicate: "via", Object: "c", Confidence: 0.9},
+		model.Triple{Subject: "a", Predicate: "to", Object: "d", Confidence: 0.5, Namespace: "work"},
+	)
+	return map[string]int64{"ab": ids[0], "bc": ids[1], "cd": ids[2], "xa": ids[3], "ae": ids[4], "ec": ids[5], "work": ids[6]}
+}
+
+func testNeighbors(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	ids := chain(t, st)
+	def := graph.FactFilter{Namespace: model.DefaultNamespace}
+	n, err := st.Triples.Neighbors(ctx, "A", 1, 10, def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "entity", n.Entity, "a")
+	equal(t, "degree", n.Degree, graph.Degree{Out: 2, In: 1, Total: 3})
+	equal(t, "facts", sortedIDs(n.Facts), sortedInts(ids["ab"], ids["xa"], ids["ae"]))
+	equal(t, "outgoing", sortedIDs(n.Outgoing), sortedInts(ids["ab"], ids["ae"]))
+	equal(t, "incoming", tripleIDs(n.Incoming), []int64{ids["xa"]})
+	for _, f := range n.Facts {
+		if f.Hop != 1 {
+			t.Errorf("hop of %d = %d, want 1", f.ID, f.Hop)
+		}
+	}
+
+	n, err = st.Triples.Neighbors(ctx, "a", 2, 10, def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hops := map[int64]int{}
+	for _, f := range n.Facts {
+		hops[f.ID] = f.Hop
+	}
+	equal(t, "hops", hops, map[int64]int{ids["ab"]: 1, ids["xa"]: 1, ids["ae"]: 1, ids["bc"]: 2, ids["ec"]: 2})
+
+	n, err = st.Triples.Neighbors(ctx, "nobody", 1, 10, def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Degree.Total != 0 || len(n.Facts) != 0 {
+		t.Errorf("neighbors of an unknown entity = %+v", n)
+	}
+
+	facts, err := st.Triples.NeighborsOf(ctx, []string{"b", "d"}, 10, def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "neighbors of b and d", sortedIDs(facts), sortedInts(ids["ab"], ids["bc"], ids["cd"]))
+	facts, err = st.Triples.Neighborhood(ctx, model.DefaultNamespace, "c", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "neighborhood of c", sortedIDs(facts), sortedInts(ids["bc"], ids["cd"], ids["ec"]))
+	facts, err = st.Triples.Neighborhood(ctx, "work", "a", 2, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "neighborhood in work", tripleIDs(facts), []int64{ids["work"]})
+}
+
+func sortedIDs(triples []model.Triple) []int64 { return sortedInts(tripleIDs(triples)...) }
+
+func sortedInts(ids ...int64) []int64 {
+	ids = append([]int64{}, ids...)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func testFindPath(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	ids := chain(t, st)
+	def := model.DefaultNamespace
+	path, err := st.Triples.FindPath(ctx, def, "A", "c", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "strongest path", tripleIDs(path), []int64{ids["ae"], ids["ec"]})
+	for i, f := range path {
+		if f.Hop != i+1 {
+			t.Errorf("hop %d = %d", i, f.Hop)
+		}
+	}
+	path, err = st.Triples.FindPath(ctx, def, "a", "d", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(path) != 3 || path[2].ID != ids["cd"] {
+		t.Errorf("path a to d = %v", tripleIDs(path))
+	}
+	path, err = st.Triples.FindPath(ctx, def, "d", "x", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(path) != 4 || path[0].ID != ids["cd"] || path[3].ID != ids["xa"] {
+		t.Errorf("path against the edges = %v", tripleIDs(path))
+	}
+	if _, err := st.Triples.FindPath(ctx, def, "a", "d", 2); !errors.Is(err, graph.ErrNoPath) {
+		t.Errorf("path beyond max depth: err = %v, want ErrNoPath", err)
+	}
+	if _, err := st.Triples.FindPath(ctx, def, "a", "nobody", 4); !errors.Is(err, graph.ErrNoPath) {
+		t.Errorf("path to an unknown entity: err = %v, want ErrNoPath", err)
+	}
+	path, err = st.Triples.FindPath(ctx, "work", "a", "d", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "path in work", tripleIDs(path), []int64{ids["work"]})
+	if path, err := st.Triples.FindPath(ctx, def, "a", "A", 4); err != nil || len(path) != 0 {
+		t.Errorf("path to itself = %v, %v; want empty", path, err)
+	}
+}
+
+func testQueryPattern(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	ids := upsertTriples(t, st,
+		model.Triple{Subject: "alice", Predicate: "works_at", Object: "acme", Confidence: 0.9},
+		model.Triple{Subject: "bob", Predicate: "works_at", Object: "acme", Confidence: 0.6},
+		model.Triple{Subject: "alice", Predicate: "knows", Object: "bob", Confidence: 0.7},
+		model.Triple{Subject: "bob", Predicate: "works_at", Object: "globex", Confidence: 0.6, Namespace: "work"},
+	)
+	def := model.DefaultNamespace
+	matches, err := st.Triples.QueryPattern(ctx, def, []graph.TriplePattern{{Subject: "?p", Predicate: "works_at", Object: "Acme"}}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 || matches[0].Bindings["p"] != "alice" || matches[1].Bindings["p"] != "bob" {
+		t.Fatalf("matches = %+v", matches)
+	}
+	equal(t, "triples of the first match", tripleIDs(matches[0].Triples), []int64{ids[0]})
+
+	matches, err = st.Triples.QueryPattern(ctx, def, []graph.TriplePattern{
+		{Subject: "?x", Predicate: "knows", Object: "?y"},
+		{Subject: "?y", Predicate: "works_at", Object: "?company"},
+	}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("matches = %+v, want one", matches)
+	}
+	equal(t, "join bindings", matches[0].Bindings, map[string]string{"x": "alice", "y": "bob", "company": "acme"})
+	equal(t, "join triples", tripleIDs(matches[0].Triples), []int64{ids[2], ids[1]})
+
+	matches, err = st.Triples.QueryPattern(ctx, def, []graph.TriplePattern{{Subject: "?x", Predicate: "?p", Object: "?x"}}, 10)
+	if err != nil || len(matches) != 0 {
+		t.Errorf("repeated variable = %+v, %v; want no match", matches, err)
+	}
+	matches, err = st.Triples.QueryPattern(ctx, def, []graph.TriplePattern{{Subject: "?p", Predicate: "works_at", Object: "?c"}}, 1)
+	if err != nil || len(matches) != 1 {
+		t.Errorf("limit 1 = %+v, %v", matches, err)
+	}
+	for _, bad := range [][]graph.TriplePattern{
+		nil,
+		{{Subject: "?x", Predicate: "", Object: "?y"}},
+		{{Subject: "?x-y", Predicate: "p", Object: "?y"}},
+		chainPattern("a", "b", "c", "d", "e", "f"),
+	} {
+		if _, err := st.Triples.QueryPattern(ctx, def, bad, 10); !errors.Is(err, graph.ErrInvalidPattern) {
+			t.Errorf("pattern %+v: err = %v, want ErrInvalidPattern", bad, err)
+		}
+	}
+}
+
+// chainPattern joins the variables named by vars with predicate p.
+func chainPattern(vars ...string) []graph.TriplePattern {
+	var out []graph.TriplePattern
+	for i := 1; i < len(vars); i++ {
+		out = append(out, graph.TriplePattern{Subject: "?" + vars[i-1], Predicate: "p", Object: "?" + vars[i]})
+	}
+	return out
+}
+
+func testListEntities(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	searchGraph(t, st)
+	entities, err := st.Triples.ListEntities(ctx, model.DefaultNamespace, "A", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entities) != 2 {
+		t.Fatalf("entities = %+v", entities)
+	}
+	got := map[string][2]int64{}
+	for _, e := range entities {
+		got[e.Entity] = [2]int64{e.AsSubject, e.AsObject}
+		if e.LastSeen.IsZero() {
+			t.Errorf("last seen of %s is unset", e.Entity)
+		}
+	}
+	equal(t, "entities", got, map[string][2]int64{"acme corp": {0, 2}, "alice": {2, 1}})
+
+	all, err := st.Triples.ListEntities(ctx, model.DefaultNamespace, "", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 5 {
+		t.Errorf("entities = %+v, want 5", all)
+	}
+	rest, err := st.Triples.ListEntities(ctx, model.DefaultNamespace, "", 10, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 2 || rest[0].Entity != all[3].Entity {
+		t.Errorf("offset 3 = %+v, want the last two of %+v", rest, all)
+	}
+	if work, err := st.Triples.ListEntities(ctx, "work", "", 10, 0); err != nil || len(work) != 2 {
+		t.Errorf("entities of work = %+v, %v", work, err)
+	}
+}
+
+func testAliases(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	ctxLog := insertLogs(t, st, model.SensoryInput{Content: "ally likes tea"})[0]
+	ids := upsertTriples(t, st,
+		model.Triple{Subject: "Alice", Predicate: "likes", Object: "tea", Confidence: 0.5},
+		model.Triple{Subject: "Ally", Predicate: "likes", Object: "tea", Confidence: 0.8, Sources: []string{ctxLog}},
+		model.Triple{Subject: "bob", Predicate: "knows", Object: "ally", Confidence: 0.5},
+		model.Triple{Subject: "ally", Predicate: "likes", Object: "tea", Confidence: 0.5, Namespace: "work"},
+	)
+	if err := st.Triples.AddAlias(ctx, "", "ALLY", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	tr := getTriple(t, st, ids[0])
+	equal(t, "merged observations", tr.ObservationCount, 2)
+	near(t, "merged confidence", tr.Confidence, 0.8)
+	equal(t, "merged sources", tr.Sources, []string{ctxLog})
+	if _, err := st.Triples.GetTriple(ctx, ids[1]); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("merged triple still stored: %v", err)
+	}
+	equal(t, "rewritten object", getTriple(t, st, ids[2]).Object, "alice")
+	equal(t, "other namespace", getTriple(t, st, ids[3]).Subject, "ally")
+
+	facts, err := st.Triples.SearchFactsFiltered(ctx, "Ally", 10, graph.FactFilter{Namespace: model.DefaultNamespace, Match: graph.MatchExact})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "search through the alias", tripleIDs(facts), []int64{ids[0], ids[2]})
+	res, err := st.Triples.UpsertTriples(ctx, []model.Triple{{Subject: "ally", Predicate: "likes", Object: "tea", Confidence: 0.5}})
+	if err != nil || res[0].ID != ids[0] {
+		t.Errorf("upsert through the alias = %+v, %v; want triple %d", res, err, ids[0])
+	}
+
+	if err := st.Triples.AddAlias(ctx, "", "Al", "ally"); err != nil {
+		t.Fatal(err)
+	}
+	if path, err := st.Triples.FindPath(ctx, model.DefaultNamespace, "bob", "al", 2); err != nil || len(path) != 1 {
+		t.Errorf("path through a chained alias = %v, %v", path, err)
+	}
+	if err := st.Triples.AddAlias(ctx, "", "alice", "al"); !errors.Is(err, graph.ErrInvalidAlias) {
+		t.Errorf("alias of itself: err = %v, want ErrInvalidAlias", err)
+	}
+	if err := st.Triples.AddAlias(ctx, "", " ", "alice"); !errors.Is(err, graph.ErrInvalidAlias) {
+		t.Errorf("empty alias: err = %v, want ErrInvalidAlias", err)
+	}
+}
+
+func testSupersede(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	def := model.DefaultNamespace
+	t0, t1, t2 := hour(0), hour(2), hour(4)
+	paris := upsertTriples(t, st, model.Triple{Subject: "ann", Predicate: "lives_in", Object: "paris", Confidence: 0.8, ValidFrom: &t0})[0]
+	res, err := st.Triples.UpsertTriples(ctx, []model.Triple{{Subject: "ann", Predicate: "lives_in", Object: "rome", Confidence: 0.9, ValidFrom: &t2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rome := res[0].ID
+	equal(t, "superseded", res[0].Superseded, int64(1))
+	tr := getTriple(t, st, paris)
+	equal(t, "superseded by", tr.SupersededBy, rome)
+	near(t, "superseded confidence", tr.Confidence, 0.08)
+	if tr.ValidTo == nil || !tr.ValidTo.Equal(t2) {
+		t.Errorf("valid_to = %v, want %v", tr.ValidTo, t2)
+	}
+
+	// an older value asserted late is history up to the current one
+	res, err = st.Triples.UpsertTriples(ctx, []model.Triple{{Subject: "ann", Predicate: "lives_in", Object: "oslo", Confidence: 0.7, ValidFrom: &t1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oslo := res[0].ID
+	tr = getTriple(t, st, oslo)
+	if tr.ValidTo == nil || !tr.ValidTo.Equal(t2) || tr.SupersededBy != 0 {
+		t.Errorf("late value = %+v, want valid until %v", tr, t2)
+	}
+
+	for _, tc := range []struct {
+		name string
+		f    graph.FactFilter
+		want []int64
+	}{
+		{"current", graph.FactFilter{Namespace: def}, []int64{rome, oslo}},
+		{"history", graph.FactFilter{Namespace: def, IncludeSuperseded: true}, []int64{rome, paris, oslo}},
+		{"as of", graph.FactFilter{Namespace: def, AsOf: t0.Add(time.Minute)}, []int64{paris}},
+		{"as of a change", graph.FactFilter{Namespace: def, AsOf: t2}, []int64{rome}},
+	} {
+		facts, err := st.Triples.SearchFactsFiltered(ctx, "ann", 10, tc.f)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		equal(t, tc.name, sortedIDs(facts), sortedInts(tc.want...))
+	}
+	page, err := st.Triples.ListTriples(ctx, graph.ListParams{Namespace: def, Subject: "ann"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "listed current triples", tripleIDs(page.Triples), []int64{rome, oslo})
+	if n, err := st.Triples.Neighbors(ctx, "ann", 1, 10, graph.FactFilter{Namespace: def}); err != nil || n.Degree.Out != 2 {
+		t.Errorf("degree = %+v, %v; want the 2 current triples", n.Degree, err)
+	}
+
+	if err := st.Triples.DeleteTriple(ctx, def, rome); err != nil {
+		t.Fatal(err)
+	}
+	tr = getTriple(t, st, paris)
+	if tr.SupersededBy != 0 || tr.ValidTo != nil {
+		t.Errorf("after deleting its successor = %+v, want current", tr)
+	}
+	near(t, "restored confidence", tr.Confidence, 0.8)
+
+	// re-observing a superseded value makes it current again
+	upsertTriples(t, st, model.Triple{Subject: "ann", Predicate: "lives_in", Object: "rome", Confidence: 0.9, ValidFrom: &t2})
+	res, err = st.Triples.UpsertTriples(ctx, []model.Triple{{Subject: "ann", Predicate: "lives_in", Object: "paris", Confidence: 0.5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr = getTriple(t, st, paris)
+	if res[0].ID != paris || tr.SupersededBy != 0 || tr.ValidTo != nil || tr.ValidFrom == nil || !tr.ValidFrom.After(t2) {
+		t.Errorf("re-observed value = %+v, want current from now", tr)
+	}
+}
+
+func testContradictionsDelete(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	upsertTriples(t, st,
+		model.Triple{Subject: "bob", Predicate: "lives_in", Object: "paris", Confidence: 0.8},
+		model.Triple{Subject: "bob", Predicate: "lives_in", Object: "paris", Confidence: 0.8, Namespace: "work"},
+		model.Triple{Subject: "bob", Predicate: "likes", Object: "paris", Confidence: 0.8},
+	)
+	res, err := st.Triples.UpsertTriples(ctx, []model.Triple{{Subject: "bob", Predicate: "lives_in", Object: "rome", Confidence: 0.9}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "deleted", res[0].Superseded, int64(1))
+	if n, _ := st.Triples.Count(ctx); n != 3 {
+		t.Errorf("count = %d, want 3", n)
+	}
+}
+
+func testDeleteTriples(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	ids := searchGraph(t, st)
+	def := model.DefaultNamespace
+	if err := st.Triples.DeleteTriple(ctx, "work", ids[0]); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("delete from another namespace: err = %v, want sql.ErrNoRows", err)
+	}
+	if err := st.Triples.DeleteTriple(ctx, def, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Triples.DeleteTriple(ctx, def, ids[0]); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("delete twice: err = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := st.Triples.DeleteMatching(ctx, def, " ", "", ""); !errors.Is(err, graph.ErrNoFilter) {
+		t.Errorf("delete matching nothing: err = %v, want ErrNoFilter", err)
+	}
+	if n, err := st.Triples.DeleteMatching(ctx, def, "ALICE", "", ""); err != nil || n != 1 {
+		t.Errorf("delete matching subject = %d, %v; want 1", n, err)
+	}
+	if n, err := st.Triples.DeleteMatching(ctx, def, "", "", "alice"); err != nil || n != 1 {
+		t.Errorf("delete matching object = %d, %v; want 1", n, err)
+	}
+	if n, err := st.Triples.DeleteAll(ctx, "work"); err != nil || n != 1 {
+		t.Errorf("delete all of work = %d, %v; want 1", n, err)
+	}
+	if n, err := st.Triples.Count(ctx); err != nil || n != 1 {
+		t.Errorf("count = %d, %v; want 1", n, err)
+	}
+}
+
+func testPruneTriples(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	ids := upsertTriples(t, st,
+		model.Triple{Subject: "a", Predicate: "p", Object: "weak", Confidence: 0.2},
+		model.Triple{Subject: "a", Predicate: "q", Object: "weak", Confidence: 0.2},
+		model.Triple{Subject: "a", Predicate: "p", Object: "strong", Confidence: 0.9},
+		model.Triple{Subject: "a", Predicate: "p", Object: "weak", Confidence: 0.2, Namespace: "work"},
+	)
+	if _, err := st.Triples.PruneTriples(ctx, graph.PruneParams{MaxConfidence: 0.5}); !errors.Is(err, graph.ErrInvalidPrune) {
+		t.Errorf("prune without max age: err = %v, want ErrInvalidPrune", err)
+	}
+	if n, err := st.Triples.PruneTriples(ctx, graph.PruneParams{Namespace: model.DefaultNamespace, MaxAge: time.Hour, MaxConfidence: 0.5}); err != nil || n != 0 {
+		t.Errorf("prune of fresh triples = %d, %v; want 0", n, err)
+	}
+	n, err := st.Triples.PruneTriples(ctx, graph.PruneParams{Namespace: model.DefaultNamespace, MaxAge: time.Nanosecond, MaxConfidence: 0.5, Predicate: "p"})
+	if err != nil || n != 1 {
+		t.Fatalf("prune = %d, %v; want 1", n, err)
+	}
+	if _, err := st.Triples.GetTriple(ctx, ids[0]); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("pruned triple still stored: %v", err)
+	}
+	if n, _ := st.Triples.Count(ctx); n != 3 {
+		t.Errorf("count = %d, want 3", n)
+	}
+}
+
+func testExport(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	upsertTriples(t, st,
+		model.Triple{Subject: "Ann", Predicate: "lives_in", Object: "Paris", Confidence: 0.8},
+		model.Triple{Subject: "Ann", Predicate: "lives_in", Object: "Rome", Confidence: 0.9},
+		model.Triple{Subject: "Ann", Predicate: "knows", Object: `Bob "B"`, Confidence: 0.3},
+		model.Triple{Subject: "Cy", Predicate: "knows", Object: "Ann", Confidence: 0.6, Namespace: "work"},
+	)
+	var buf bytes.Buffer
+	if err := st.Triples.Export(ctx, &buf, graph.ExportDOT, graph.ExportOptions{Namespace: model.DefaultNamespace}); err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "DOT", buf.String(), `digraph paim {
+  "ann" [label="Ann"];
+  "rome" [label="Rome"];
+  "ann" -> "rome" [label="lives_in", confidence=0.9];
+  "bob \"b\"" [label="Bob \"B\""];
+  "ann" -> "bob \"b\"" [label="knows", confidence=0.3];
+}
+`)
+	buf.Reset()
+	if err := st.Triples.Export(ctx, &buf, graph.ExportGraphML, graph.ExportOptions{MinConfidence: 0.5, Predicates: []string{"knows"}}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "<?xml") || !strings.Contains(out, `<node id="cy">`) || strings.Contains(out, "lives_in") || strings.Contains(out, "bob") {
+		t.Errorf("GraphML = %s", out)
+	}
+	buf.Reset()
+	if err := st.Triples.Export(ctx, &buf, graph.ExportDOT, graph.ExportOptions{Namespace: model.DefaultNamespace, MaxNodes: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "bob") {
+		t.Errorf("export beyond max nodes = %s", buf.String())
+	}
+	if err := st.Triples.Export(ctx, &buf, "csv", graph.ExportOptions{}); err == nil {
+		t.Error("unknown export format must fail")
+	}
+}
+
+func testProvenance(t *testing.T, st store.Stores) {
+	ctx := context.Background()
+	logs := insertLogs(t, st, model.SensoryInput{Content: "one"}, model.SensoryInput{Content: "two"})
+	ids := upsertTriples(t, st,
+		model.Triple{Subject: "a", Predicate: "p", Object: "b", Confidence: 0.5, Sources: []string{logs[0], logs[1]}},
+		model.Triple{Subject: "a", Predicate: "p", Object: "c", Confidence: 0.9, Sources: []string{logs[0]}},
+		model.Triple{Subject: "a", Predicate: "p", Object: "d", Confidence: 0.7},
+	)
+	facts, err := st.Triples.TriplesFromLog(ctx, logs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "triples from log", tripleIDs(facts), []int64{ids[1], ids[0]})
+	sources, err := st.Triples.SourcesOf(ctx, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "sources", sources, map[int64][]string{ids[0]: sorted(logs), ids[1]: {logs[0]}})
+
+	if _, err := st.Logs.DeleteLogs(ctx, []string{logs[0]}); err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "sources after deleting a log", getTriple(t, st, ids[0]).Sources, []string{logs[1]})
+	if facts, err := st.Triples.TriplesFromLog(ctx, logs[0]); err != nil || len(facts) != 0 {
+		t.Errorf("triples from a deleted log = %v, %v", facts, err)
+	}
+}
+
+// unit returns the unit vector of dim dimensions along axes.
+func unit(dim int, axes ...int) []float64 {
+	v := make([]float64, dim)
+	for _, a := range axes {
+		v[a] = 1 / math.Sqrt(float64(len(axes)))
+	}
+	return v
+}
+
+func testVectorSearch(t *testing.T, st store.Stores) {
+	if !st.Vectors.Enabled() {
+		t.Skip(st.VectorDegraded)
+	}
+	ctx := context.Background()
+	if st.Vectors.Name() == "" {
+		t.Error("vector index has no name")
+	}
+	if err := st.Vectors.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	dim := st.Logs.VectorDim()
+	ids := insertLogs(t, st,
+		model.SensoryInput{Content: "x", Source: "chat"},
+		model.SensoryInput{Content: "xy", Source: "mail"},
+		model.SensoryInput{Content: "y", Source: "chat", Namespace: "work"},
+	)
+	for i, v := range [][]float64{unit(dim, 0), unit(dim, 0, 1), unit(dim, 1)} {
+		if err := st.Vectors.UpsertEmbedding(ctx, ids[i], v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := st.Vectors.Count(ctx); err != nil || n != 3 {
+		t.Fatalf("count = %d, %v; want 3", n, err)
+	}
+	hits, err := st.Vectors.SearchWithScores(ctx, unit(dim, 0), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 3 || hits[0].LogID != ids[0] || hits[1].LogID != ids[1] || hits[2].LogID != ids[2] {
+		t.Fatalf("hits = %+v", hits)
+	}
+	near(t, "similarity of the nearest", st.Vectors.Similarity(hits[0].Distance), 1)
+	near(t, "similarity of the diagonal", st.Vectors.Similarity(hits[1].Distance), 1/math.Sqrt2)
+	equal(t, "namespace of the farthest", hits[2].Namespace, "work")
+
+	res, err := st.Vectors.SearchLogsFiltered(ctx, unit(dim, 0), 3, sqlite.LogFilter{Namespace: model.DefaultNamespace, Source: "mail"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "filtered logs", logIDs(res.Logs), []string{ids[1]})
+	if len(res.Distances) != 1 || len(res.Hits) != 3 {
+		t.Errorf("result = %+v, want one distance and every hit", res)
+	}
+
+	if err := st.Vectors.UpsertEmbedding(ctx, ids[2], unit(dim, 0)); err != nil {
+		t.Fatal(err)
+	}
+	hits, err = st.Vectors.SearchWithScores(ctx, unit(dim, 0), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 2 {
+		t.Fatalf("hits after replacing an embedding = %+v", hits)
+	}
+	equal(t, "hits after replacing an embedding", sorted([]string{hits[0].LogID, hits[1].LogID}), sorted([]string{ids[0], ids[2]}))
+	if n, err := st.Vectors.DeleteByLogIDs(ctx, []string{ids[0], "missing"}); err != nil || n != 1 {
+		t.Errorf("delete = %d, %v; want 1", n, err)
+	}
+	if err := st.Vectors.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := st.Vectors.Count(ctx); err != nil || n != 0 {
+		t.Errorf("count after clear = %d, %v", n, err)
+	}
+}
@@ -0,0 +1,92 @@
+// Package storetest provides MemoryEngines and databases for tests, backed
+// by in-memory databases so nothing is left on disk, and the conformance
+// suite every storage backend must pass.
+package storetest
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+)
+
+// NewTestEngine returns an engine on a fresh in-memory database that is
+// closed, and its data dropped, when the test ends. Engine logs are
+// discarded.
+func NewTestEngine(t testing.TB) *store.MemoryEngine {
+	t.Helper()
+	return NewTestEngineWithOptions(t, store.Options{})
+}
+
+// NewTestEngineWithOptions is NewTestEngine with opt; DBPath defaults to
+// store.MemoryPath and Logger to one that discards everything.
+func NewTestEngineWithOptions(t testing.TB, opt store.Options) *store.MemoryEngine {
+	t.Helper()
+	if opt.DBPath == "" {
+		opt.DBPath = store.MemoryPath
+	}
+	if opt.Logger == nil {
+		opt.Logger = discardLogger()
+	}
+	m, err := store.NewMemoryEngine(context.Background(), opt)
+	if err != nil {
+		t.Fatalf("open test engine: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := m.Close(); err != nil {
+			t.Errorf("close test engine: %v", err)
+		}
+	})
+	return m
+}
+
+// NewTestStores opens the storage backends as store.OpenStores does for a
+// test, closing them when it ends. opt.DBPath defaults to store.MemoryPath.
+func NewTestStores(t testing.TB, opt store.Options) store.Stores {
+	t.Helper()
+	if opt.DBPath == "" {
+		opt.DBPath = store.MemoryPath
+	}
+	st, err := store.OpenStores(context.Background(), opt)
+	if err != nil {
+		t.Fatalf("open test stores: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := st.Close(); err != nil {
+			t.Errorf("close test stores: %v", err)
+		}
+	})
+	return st
+}
+
+// NewTestDatabase returns a fresh in-memory database for the tests of the
+// packages the engine is built on, such as graph and vector, which use
+// Writer and Reader as the engine does. It is closed when the test ends.
+// cfg.Path defaults to sqlite.MemoryPath and cfg.Logger to one that
+// discards everything.
+func NewTestDatabase(t testing.TB, cfg sqlite.Config) *sqlite.Database {
+	t.Helper()
+	if cfg.Path == "" {
+		cfg.Path = sqlite.MemoryPath
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = discardLogger()
+	}
+	db, err := sqlite.New(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("close test database: %v", err)
+		}
+	})
+	return db
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+)
+
+// summarizeBatch bounds the logs read by one summarization pass; the rest
+// wait for the next pass.
+const summarizeBatch = 2000
+
+// SummaryReport summarizes one summarization pass: Logs were compacted into
+// Summaries, and Deleted of them removed.
+type SummaryReport struct {
+	Logs      int64 `json:"logs"`
+	Summaries int64 `json:"summaries"`
+	Deleted   int64 `json:"deleted"`
+}
+
+// summaryKey identifies the logs of one namespace, session, source and UTC
+// day, which one summary covers.
+type summaryKey struct {
+	namespace, session, source, day string
+}
+
+type summaryGroup struct {
+	summaryKey
+	logs []model.LogEntry
+}
+
+// Summarize compacts logs older than Options.SummarizeAge into one summary
+// log per namespace, session, source and day, written by
+// Options.Summarizer with source model.SummarySource and the ids of the
+// originals in its "summary_of" metadata. The originals are marked with the
+// summary id, so a pass never summarizes a log twice, and deleted with their
+// embeddings when Options.SummarizeDelete is set, unless a fact cites them.
+// Logs still in the sensory buffer wait for the next pass. With no
+// summarizer or age configured it does nothing.
+func (m *MemoryEngine) Summarize(ctx context.Context) (SummaryReport, error) {
+	var report SummaryReport
+	if m.readOnly {
+		return report, ErrReadOnly
+	}
+	if m.summarizer == nil || m.summarizeAge <= 0 {
+		return report, nil
+	}
+	logs, err := m.db.SummaryCandidates(ctx, time.Now().Add(-m.summarizeAge), summarizeBatch)
+	if err != nil {
+		return report, fmt.Errorf("select logs: %w", err)
+	}
+	if len(logs) == summarizeBatch {
+		// the last day may continue past the batch; leave it whole for
+		// the next pass unless it is all there is
+		last := logs[len(logs)-1].Timestamp.UTC().Format(time.DateOnly)
+		if first := logs[0].Timestamp.UTC().Format(time.DateOnly); first != last {
+			for len(logs) > 0 && logs[len(logs)-1].Timestamp.UTC().Format(time.DateOnly) == last {
+				logs = logs[:len(logs)-1]
+			}
+		}
+	}
+
+	buffered := make(map[string]bool)
+	for _, it := range m.buffer.SnapshotItems() {
+		buffered[it.Input.LogID] = true
+	}
+	var groups []*summaryGroup
+	byKey := make(map[summaryKey]*summaryGroup)
+	for _, l := range logs {
+		if buffered[l.ID] {
+			continue
+		}
+		key := summaryKey{namespace: l.Namespace, session: l.SessionID, source: l.SourceType, day: l.Timestamp.UTC().Format(time.DateOnly)}
+		g := byKey[key]
+		if g == nil {
+			g = &summaryGroup{summaryKey: key}
+			byKey[key] = g
+			groups = append(groups, g)
+		}
+		g.logs = append(g.logs, l)
+	}
+
+	for _, g := range groups {
+		n, err := m.summarizeGroup(ctx, g)
+		if err != nil {
+			return report, fmt.Errorf("summarize %s %s %s: %w", g.namespace, g.source, g.day, err)
+		}
+		if n < 0 {
+			continue
+		}
+		report.Summaries++
+		report.Logs += int64(len(g.logs))
+		report.Deleted += n
+	}
+	if report.Summaries > 0 {
+		m.logger.Debug("summarized memory logs", "logs", report.Logs, "summaries", report.Summaries, "deleted", report.Deleted)
+	}
+	return report, nil
+}
+
+// summarizeGroup stores the summary of g and returns how many originals it
+// deleted, or -1 when the summarizer produced no summary.
+func (m *MemoryEngine) summarizeGroup(ctx context.Context, g *summaryGroup) (int64, error) {
+	content, err := m.summarizer.Summarize(ctx, g.logs)
+	if err != nil {
+		return 0, err
+	}
+	if strings.TrimSpace(content) == "" {
+		return -1, nil
+	}
+	if r := []rune(content); len(r) > m.maxContentChars {
+		content = string(r[:m.maxContentChars])
+	}
+	ids := make([]string, len(g.logs))
+	for i, l := range g.logs {
+		ids[i] = l.ID
+	}
+	embed := m.embeds()
+	summaryID, err := m.db.InsertSummary(ctx, model.SensoryInput{
+		Content:   content,
+		Source:    model.SummarySource,
+		Namespace: g.namespace,
+		SessionID: g.session,
+		Metadata: map[string]any{
+			"summary_of": ids,
+			"source":     g.source,
+			"day":        g.day,
+		},
+	}, g.logs[len(g.logs)-1].Timestamp, ids, embed)
+	if err != nil {
+		return 0, err
+	}
+	if embed {
+		if m.syncEmbedding {
+			if err := m.embedLog(ctx, sqlite.PendingEmbedding{LogID: summaryID, Content: content}); err != nil {
+				m.logger.Warn("embedding deferred", "log_id", summaryID, "err", err)
+			}
+		} else {
+			m.notifyEmbedWorkers()
+		}
+	}
+	if !m.summarizeDelete {
+		return 0, nil
+	}
+	uncited, err := m.db.UncitedLogs(ctx, ids)
+	if err != nil || len(uncited) == 0 {
+		return 0, err
+	}
+	// vectors go first, as in Prune
+	if _, err := m.vec.DeleteByLogIDs(ctx, uncited); err != nil {
+		return 0, err
+	}
+	return m.db.DeleteLogs(ctx, uncited)
+}
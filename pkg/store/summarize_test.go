@@ -0,0 +1,100 @@
+package store_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/engine/summarize"
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+func TestSummarize(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngineWithOptions(t, store.Options{
+		Distiller:       noFacts{},
+		Summarizer:      summarize.NewExtractive(0),
+		SummarizeAge:    24 * time.Hour,
+		SummarizeDelete: true,
+	})
+	day := time.Now().AddDate(0, 0, -3).UTC().Truncate(24 * time.Hour).Add(9 * time.Hour)
+	for _, in := range []model.SensoryInput{
+		{Content: "Met Alice.", Source: "chat", Timestamp: day},
+		{Content: "Booked a flight.", Source: "chat", Timestamp: day.Add(time.Hour)},
+		{Content: "Invoice paid.", Source: "mail", Timestamp: day.Add(time.Hour)},
+		{Content: "Met Bob.", Source: "chat", Timestamp: day.AddDate(0, 0, 1)},
+		{Content: "Today's note.", Source: "chat"},
+	} {
+		if err := m.Observe(ctx, in); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := m.Summarize(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report != (store.SummaryReport{Logs: 4, Summaries: 3, Deleted: 4}) {
+		t.Errorf("report = %+v, want 4 logs in 3 summaries, all deleted", report)
+	}
+	got := logContents(t, m)
+	slices.Sort(got)
+	if want := []string{"Invoice paid.", "Met Alice.; Booked a flight.", "Met Bob.", "Today's note."}; !slices.Equal(got, want) {
+		t.Errorf("logs after summarizing = %q, want %q", got, want)
+	}
+
+	summaries, err := m.QueryLogsByMetadata(ctx, "", map[string]string{"source": "chat", "day": day.Format(time.DateOnly)}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 1 || summaries[0].SourceType != model.SummarySource || !summaries[0].Timestamp.Equal(day.Add(time.Hour)) {
+		t.Errorf("summary of the first chat day = %+v, want one summary dated at its last log", summaries)
+	} else if of, _ := summaries[0].Metadata["summary_of"].([]any); len(of) != 2 {
+		t.Errorf("summary_of = %v, want the two originals", summaries[0].Metadata["summary_of"])
+	}
+
+	if report, err := m.Summarize(ctx); err != nil || report.Summaries != 0 {
+		t.Errorf("second pass = %+v, %v; want nothing left to summarize", report, err)
+	}
+}
+
+func TestSummarizeKeepsCitedAndBufferedLogs(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngineWithOptions(t, store.Options{
+		Summarizer:      summarize.NewExtractive(0),
+		SummarizeAge:    time.Hour,
+		SummarizeDelete: true,
+	})
+	old := time.Now().Add(-48 * time.Hour)
+	if err := m.Observe(ctx, model.SensoryInput{Content: "Alice works at Acme.", Timestamp: old}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Observe(ctx, model.SensoryInput{Content: "Not consolidated yet.", Timestamp: old.AddDate(0, 0, -1)}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := m.Summarize(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Summaries != 1 || report.Deleted != 0 {
+		t.Errorf("report = %+v, want the cited log summarized but kept and the buffered one left alone", report)
+	}
+	if n := len(logContents(t, m)); n != 3 {
+		t.Errorf("%d logs, want both originals and the summary", n)
+	}
+
+	off := storetest.NewTestEngineWithOptions(t, store.Options{SummarizeAge: time.Hour})
+	if report, err := off.Summarize(ctx); err != nil || report != (store.SummaryReport{}) {
+		t.Errorf("Summarize without a summarizer = %+v, %v", report, err)
+	}
+}
@@ -0,0 +1,98 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+// hungEmbedder never answers; it returns only when its context ends.
+type hungEmbedder struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (e *hungEmbedder) EmbedText(ctx context.Context, _ string) ([]float64, error) {
+	e.mu.Lock()
+	e.calls++
+	e.mu.Unlock()
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestObserveStopsEmbeddingAtTheDeadline(t *testing.T) {
+	emb := &hungEmbedder{}
+	m := storetest.NewTestEngineWithOptions(t, store.Options{
+		Embedder:              emb,
+		VectorDim:             64,
+		StoreEmbeddings:       true,
+		SyncEmbedding:         true,
+		EmbedBreakerThreshold: -1,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	ids, err := m.ObserveBatch(ctx, []model.SensoryInput{{Content: "one"}, {Content: "two"}, {Content: "three"}})
+	if err != nil {
+		t.Fatalf("ObserveBatch past the deadline: %v", err)
+	}
+	if len(ids) != 3 {
+		t.Fatalf("%d ids, want 3", len(ids))
+	}
+	emb.mu.Lock()
+	calls := emb.calls
+	emb.mu.Unlock()
+	if calls != 1 {
+		t.Errorf("embedder called %d times, want once before the deadline", calls)
+	}
+	if depth := queueDepth(t, m); depth != 3 {
+		t.Errorf("queue depth %d, want all 3 logs still queued", depth)
+	}
+}
+
+func TestEmbedTimeoutBoundsEachCall(t *testing.T) {
+	ctx := context.Background()
+	emb := &hungEmbedder{}
+	m := storetest.NewTestEngineWithOptions(t, store.Options{
+		Embedder:              emb,
+		VectorDim:             64,
+		StoreEmbeddings:       true,
+		SyncEmbedding:         true,
+		EmbedTimeout:          20 * time.Millisecond,
+		EmbedBreakerThreshold: 1,
+		EmbedBreakerCooldown:  time.Hour,
+	})
+	start := time.Now()
+	if err := m.Observe(ctx, model.SensoryInput{Content: "one"}); err != nil {
+		t.Fatalf("Observe with a hung embedder: %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Observe took %v with a 20ms embed timeout", d)
+	}
+	if depth := queueDepth(t, m); depth != 1 {
+		t.Errorf("queue depth %d, want the log queued", depth)
+	}
+	// the timeout is the embedder's failure, not the caller giving up
+	st, err := m.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.EmbedderBreaker != store.BreakerOpen {
+		t.Errorf("breaker %s after a timed out call, want open", st.EmbedderBreaker)
+	}
+}
+
+func TestRecallHonorsTheDeadline(t *testing.T) {
+	m := storetest.NewTestEngine(t)
+	observeAll(t, m, "Alice works at Acme.")
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if _, err := m.Recall(ctx, "Alice", 5); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Recall with an expired deadline = %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,38 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer comes from the global provider, so spans are no-ops unless the
+// program installs one with otel.SetTracerProvider. Span attributes carry
+// counts and sizes only, never memory content.
+var tracer = otel.Tracer("github.com/johncui/PAIM/pkg/store")
+
+// dbPathHash identifies the database in spans without exposing its path.
+func dbPathHash(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return hex.EncodeToString(sum[:8])
+}
+
+// startSpan starts a span tagged with the database hash.
+func (m *MemoryEngine) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, attribute.String("paim.db_hash", m.dbHash))
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err, if any, and ends span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
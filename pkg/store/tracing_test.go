@@ -0,0 +1,76 @@
+package store_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// The engine's tracer binds to the first global provider installed, so this
+// is the only test in the package that installs one.
+func TestEngineSpans(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+
+	ctx := context.Background()
+	const secret = "Alice whispered the launch code."
+	m := storetest.NewTestEngineWithOptions(t, store.Options{
+		Embedder:        newFlakyEmbedder(func(int) bool { return false }),
+		VectorDim:       64,
+		StoreEmbeddings: true,
+		SyncEmbedding:   true,
+	})
+	observeAll(t, m, secret)
+	if err := m.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	recall(t, m, "Alice", model.RecallOptions{TopK: 3})
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range rec.Ended() {
+		spans[s.Name()] = s
+		for _, kv := range s.Attributes() {
+			if strings.Contains(kv.Value.Emit(), "Alice") {
+				t.Errorf("span %s attribute %s carries content: %q", s.Name(), kv.Key, kv.Value.Emit())
+			}
+		}
+	}
+	for _, name := range []string{"observe", "embed", "vector.upsert", "consolidate", "distill", "recall", "graph.search"} {
+		s, ok := spans[name]
+		if !ok {
+			t.Errorf("no %s span", name)
+			continue
+		}
+		if v, ok := attr(s, "paim.db_hash"); !ok || v.AsString() == "" {
+			t.Errorf("span %s lacks the database hash", name)
+		}
+	}
+	if s, ok := spans["recall"]; ok {
+		if v, _ := attr(s, "paim.top_k"); v.AsInt64() != 3 {
+			t.Errorf("recall top_k = %v, want 3", v.Emit())
+		}
+		if v, ok := attr(s, "paim.facts"); !ok || v.AsInt64() == 0 {
+			t.Errorf("recall facts = %v, want the recalled count", v.Emit())
+		}
+	}
+	if r, c := spans["recall"], spans["graph.search"]; r != nil && c != nil && c.Parent().SpanID() != r.SpanContext().SpanID() {
+		t.Error("graph.search is not a child of recall")
+	}
+}
+
+func attr(s sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range s.Attributes() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
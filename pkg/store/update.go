@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+)
+
+// UpdateLog edits a log of namespace and returns it as stored. New content
+// is checked like Observe input, and the log is embedded again: right away
+// with Options.SyncEmbedding, otherwise by the background workers, which
+// replace its vector. Facts already distilled from the old content are kept.
+// It returns ErrNotFound for a missing log or one of another namespace, and
+// ErrConflict when patch.UnmodifiedSince is set and the log was edited since.
+func (m *MemoryEngine) UpdateLog(ctx context.Context, namespace, id string, patch sqlite.LogPatch) (*model.LogEntry, error) {
+	if m.readOnly {
+		return nil, ErrReadOnly
+	}
+	namespace, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, fmt.Errorf("%w: log id %q is not a UUID", ErrInvalidInput, id)
+	}
+	if patch.Content == nil && patch.SourceType == nil && patch.Metadata == nil && !patch.ReplaceMetadata {
+		return nil, fmt.Errorf("%w: nothing to update", ErrInvalidInput)
+	}
+	if m.redactor != nil && (patch.Content != nil || patch.Metadata != nil) {
+		in := model.SensoryInput{Metadata: patch.Metadata, Namespace: namespace}
+		if patch.Content != nil {
+			in.Content = *patch.Content
+		}
+		if in, err = m.redact(ctx, in); err != nil {
+			return nil, err
+		}
+		if patch.Content != nil {
+			patch.Content = &in.Content
+		}
+		patch.Metadata = in.Metadata
+	}
+	if patch.Content != nil {
+		content, err := m.checkContent(*patch.Content)
+		if err != nil {
+			return nil, err
+		}
+		patch.Content = &content
+	}
+
+	old, err := m.db.FetchLog(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && old.Namespace != namespace) {
+		return nil, fmt.Errorf("%w: log %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	embed := m.embeds()
+	if embed {
+		err = m.db.UpdateLogPendingEmbedding(ctx, id, patch)
+	} else {
+		err = m.db.UpdateLog(ctx, id, patch)
+	}
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, fmt.Errorf("%w: log %s", ErrNotFound, id)
+	case errors.Is(err, sqlite.ErrLogModified):
+		return nil, fmt.Errorf("%w: log %s was updated after %s", ErrConflict, id, patch.UnmodifiedSince.Format(time.RFC3339Nano))
+	case err != nil:
+		return nil, err
+	}
+
+	e, err := m.db.FetchLog(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	m.buffer.Update(id, func(in *model.SensoryInput) {
+		in.Content, in.Source, in.Metadata = e.Content, e.SourceType, e.Metadata
+	})
+	m.events.publish(Event{Type: EventMemoryUpdated, Time: time.Now().UTC(), Namespace: e.Namespace, Log: e})
+
+	if embed && e.Content != old.Content {
+		if !m.syncEmbedding {
+			m.notifyEmbedWorkers()
+		} else if err := m.embedLog(ctx, sqlite.PendingEmbedding{LogID: id, Content: e.Content}); err != nil {
+			m.logger.Warn("embedding deferred", "log_id", id, "err", err)
+		}
+	}
+	return e, nil
+}
@@ -0,0 +1,93 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/store"
+	"github.com/johncui/PAIM/pkg/store/graph"
+	"github.com/johncui/PAIM/pkg/store/sqlite"
+	"github.com/johncui/PAIM/pkg/store/storetest"
+)
+
+func TestUpdateLogEmbedsTheNewContent(t *testing.T) {
+	ctx := context.Background()
+	emb := newFlakyEmbedder(func(int) bool { return false })
+	m := storetest.NewTestEngineWithOptions(t, store.Options{
+		Embedder:        emb,
+		VectorDim:       64,
+		StoreEmbeddings: true,
+		SyncEmbedding:   true,
+	})
+	events := m.Subscribe(ctx, "")
+	id := observeID(t, m, "Alice works at Acme.")
+	next(t, events)
+
+	content := "Bob lives in Berlin."
+	e, err := m.UpdateLog(ctx, "", id, sqlite.LogPatch{Content: &content})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Content != content || e.UpdatedAt == nil {
+		t.Errorf("updated log = %+v, want the new content and an update time", e)
+	}
+	if n := emb.embedded(); n != 2 {
+		t.Errorf("%d embeddings after a content edit, want 2", n)
+	}
+	if ev := next(t, events); ev.Type != store.EventMemoryUpdated || ev.Log == nil || ev.Log.Content != content {
+		t.Errorf("event = %+v, want memory_updated with the new content", ev)
+	}
+
+	if _, err := m.UpdateLog(ctx, "", id, sqlite.LogPatch{Metadata: map[string]any{"k": "v"}}); err != nil {
+		t.Fatal(err)
+	}
+	if n := emb.embedded(); n != 2 {
+		t.Errorf("%d embeddings after a metadata edit, want still 2", n)
+	}
+
+	// the log was still buffered, so consolidation distills the edit
+	if err := m.Consolidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	res, err := m.ListFacts(ctx, graph.ListParams{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Triples) != 1 || res.Triples[0].Subject != "bob" {
+		t.Errorf("facts = %+v, want bob's only", res.Triples)
+	}
+}
+
+func TestUpdateLogErrors(t *testing.T) {
+	ctx := context.Background()
+	m := storetest.NewTestEngine(t)
+	id := observeID(t, m, "Alice works at Acme.")
+	content := "edited"
+	for name, tc := range map[string]struct {
+		id    string
+		patch sqlite.LogPatch
+		want  error
+	}{
+		"empty patch":     {id, sqlite.LogPatch{}, store.ErrInvalidInput},
+		"blank content":   {id, sqlite.LogPatch{Content: new(string)}, store.ErrInvalidInput},
+		"malformed id":    {"nope", sqlite.LogPatch{Content: &content}, store.ErrInvalidInput},
+		"missing log":     {"00000000-0000-4000-8000-000000000000", sqlite.LogPatch{Content: &content}, store.ErrNotFound},
+		"stale timestamp": {id, sqlite.LogPatch{Content: &content, UnmodifiedSince: time.Unix(1, 0)}, store.ErrConflict},
+	} {
+		if _, err := m.UpdateLog(ctx, "", tc.id, tc.patch); !errors.Is(err, tc.want) {
+			t.Errorf("%s: %v, want %v", name, err, tc.want)
+		}
+	}
+	l, err := m.Log(ctx, "", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Log.Content != "Alice works at Acme." || l.Log.UpdatedAt != nil {
+		t.Errorf("log after failed edits = %+v, want it untouched", l.Log)
+	}
+	if _, err := m.UpdateLog(ctx, "", id, sqlite.LogPatch{Content: &content, UnmodifiedSince: l.Log.Timestamp}); err != nil {
+		t.Errorf("edit against the log's timestamp: %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package vector
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Backend describes the SQL dialect of a SQLite vector extension. The
+// payload table mapping vector rowids to memory log ids is shared by all
+// backends; only the virtual table and its query syntax differ.
+type Backend interface {
+	// Name is the config value selecting the backend ("vss" or "vec").
+	Name() string
+	// Table is the name of the vector virtual table.
+	Table() string
+	// Schema returns the statements creating the vector table for dim.
+	Schema(dim int) []string
+	// Encode converts an embedding to the value bound to InsertSQL and
+	// SearchSQL.
+	Encode(vec []float64) (any, error)
+	// InsertSQL inserts one encoded embedding; its rowid links to the payload.
+	InsertSQL() string
+	// DeleteByLogSQL removes vector rows for a log id (one argument).
+	DeleteByLogSQL() string
+	// SearchSQL selects (log_id, namespace, distance) for an encoded query
+	// embedding and a result limit, nearest first.
+	SearchSQL() string
+	// ProbeSQL is a cheap query against the virtual table that fails when
+	// the extension is not loaded on the connection.
+	ProbeSQL() string
+	// VersionSQL selects the version of the extension; it fails when the
+	// extension loaded is not this backend's.
+	VersionSQL() string
+	// ClearSQL removes every row from the vector table.
+	ClearSQL() string
+	// Similarity converts a SearchSQL distance into the cosine similarity
+	// of unit-length embeddings.
+	Similarity(distance float64) float64
+}
+
+// PayloadTable maps vector rowids to memory log ids, and the namespace of
+// each log, for every backend.
+const PayloadTable = "vss_payload"
+
+// EmbeddingsTable keeps the raw embedding of each log as a float32 blob,
+// independent of any extension; Store.BuildIndexFromTable loads a vector
+// table from it. The table is created by the database migrations.
+const EmbeddingsTable = "embeddings"
+
+func payloadSchema() []string {
+	return []string{
+		`CREATE TABLE IF NOT EXISTS ` + PayloadTable + ` (
+                rowid INTEGER PRIMARY KEY,
+                log_id TEXT NOT NULL,
+                namespace TEXT NOT NULL DEFAULT 'default'
+            );`,
+		`CREATE INDEX IF NOT EXISTS idx_vss_payload_log ON ` + PayloadTable + `(log_id);`,
+	}
+}
+
+// BackendByName returns the backend for a config value; empty means vss.
+func BackendByName(name string) (Backend, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "vss":
+		return VSS{}, nil
+	case "vec":
+		return Vec{}, nil
+	default:
+		return nil, fmt.Errorf("unknown vector backend %q (want vss or vec)", name)
+	}
+}
+
+// VSS targets the sqlite-vss extension (vss0 virtual table).
+type VSS struct{}
+
+func (VSS) Name() string { return "vss" }
+
+func (VSS) Table() string { return "vss_memories" }
+
+func (VSS) Schema(dim int) []string {
+	return append([]string{
+		fmt.Sprintf(`CREATE VIRTUAL TABLE IF NOT EXISTS vss_memories USING vss0(content_embedding(%d));`, dim),
+	}, payloadSchema()...)
+}
+
+// Encode uses JSON text: vss0 parses vectors from JSON (or its own blob
+// format), not from plain float32 blobs.
+func (VSS) Encode(vec []float64) (any, error) { return encodeJSON(vec) }
+
+func (VSS) InsertSQL() string {
+	return `INSERT INTO vss_memories(content_embedding) VALUES (json(?))`
+}
+
+func (VSS) DeleteByLogSQL() string {
+	return `DELETE FROM vss_memories WHERE rowid IN (SELECT rowid FROM ` + PayloadTable + ` WHERE log_id = ?)`
+}
+
+// Similarity assumes the squared L2 distance faiss reports.
+func (VSS) Similarity(distance float64) float64 { return 1 - distance/2 }
+
+func (VSS) SearchSQL() string {
+	return `
+        SELECT p.log_id, p.namespace, vss_memories.distance
+        FROM vss_memories
+        JOIN ` + PayloadTable + ` p ON p.rowid = vss_memories.rowid
+        WHERE content_embedding MATCH vss_search(json(?))
+        LIMIT ?;`
+}
+
+func (VSS) ProbeSQL() string {
+	return `SELECT rowid FROM vss_memories LIMIT 1;`
+}
+
+func (VSS) VersionSQL() string {
+	return `SELECT vss_version();`
+}
+
+func (VSS) ClearSQL() string {
+	return `DELETE FROM vss_memories;`
+}
+
+// Vec targets the sqlite-vec extension (vec0 virtual table), the maintained
+// successor of sqlite-vss. KNN queries use MATCH plus a k constraint.
+type Vec struct{}
+
+func (Vec) Name() string { return "vec" }
+
+func (Vec) Table() string { return "vec_memories" }
+
+func (Vec) Schema(dim int) []string {
+	return append([]string{
+		fmt.Sprintf(`CREATE VIRTUAL TABLE IF NOT EXISTS vec_memories USING vec0(content_embedding float[%d]);`, dim),
+	}, payloadSchema()...)
+}
+
+// Encode uses little-endian float32 blobs, which vec0 takes directly.
+func (Vec) Encode(vec []float64) (any, error) { return EncodeFloat32(vec) }
+
+func (Vec) InsertSQL() string {
+	return `INSERT INTO vec_memories(content_embedding) VALUES (?)`
+}
+
+func (Vec) DeleteByLogSQL() string {
+	return `DELETE FROM vec_memories WHERE rowid IN (SELECT rowid FROM ` + PayloadTable + ` WHERE log_id = ?)`
+}
+
+// Similarity assumes vec0's default L2 distance.
+func (Vec) Similarity(distance float64) float64 { return 1 - distance*distance/2 }
+
+func (Vec) SearchSQL() string {
+	return `
+        SELECT p.log_id, p.namespace, v.distance
+        FROM (
+            SELECT rowid, distance FROM vec_memories
+            WHERE content_embedding MATCH ? AND k = ?
+        ) v
+        JOIN ` + PayloadTable + ` p ON p.rowid = v.rowid
+        ORDER BY v.distance;`
+}
+
+func (Vec) ProbeSQL() string {
+	return `SELECT rowid FROM vec_memories LIMIT 1;`
+}
+
+func (Vec) VersionSQL() string {
+	return `SELECT vec_version();`
+}
+
+func (Vec) ClearSQL() string {
+	return `DELETE FROM vec_memories;`
+}
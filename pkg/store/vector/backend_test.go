@@ -0,0 +1,90 @@
+package vector
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestBackendByName(t *testing.T) {
+	for name, want := range map[string]string{"": "vss", "vss": "vss", " VEC ": "vec"} {
+		b, err := BackendByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Name() != want {
+			t.Errorf("BackendByName(%q) = %s, want %s", name, b.Name(), want)
+		}
+	}
+	if _, err := BackendByName("faiss"); err == nil {
+		t.Fatal("BackendByName accepted an unknown backend")
+	}
+}
+
+func TestBackendSQL(t *testing.T) {
+	tests := []struct {
+		backend Backend
+		schema  string
+		search  []string
+	}{
+		{VSS{}, "USING vss0(content_embedding(384))", []string{"MATCH vss_search(json(?))", "LIMIT ?"}},
+		{Vec{}, "USING vec0(content_embedding float[384])", []string{"MATCH ? AND k = ?", "ORDER BY v.distance"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.backend.Name(), func(t *testing.T) {
+			schema := tt.backend.Schema(384)
+			if !strings.Contains(schema[0], tt.schema) || !strings.Contains(schema[0], tt.backend.Table()) {
+				t.Errorf("schema = %q, want %q on %s", schema[0], tt.schema, tt.backend.Table())
+			}
+			if !strings.Contains(strings.Join(schema, "\n"), PayloadTable) {
+				t.Errorf("schema does not create %s", PayloadTable)
+			}
+			search := tt.backend.SearchSQL()
+			for _, want := range append(tt.search, PayloadTable, "log_id", "namespace") {
+				if !strings.Contains(search, want) {
+					t.Errorf("search SQL lacks %q:\n%s", want, search)
+				}
+			}
+			for _, q := range []string{tt.backend.InsertSQL(), tt.backend.DeleteByLogSQL(), tt.backend.ProbeSQL(), tt.backend.ClearSQL()} {
+				if !strings.Contains(q, tt.backend.Table()) {
+					t.Errorf("%q does not use %s", q, tt.backend.Table())
+				}
+			}
+		})
+	}
+}
+
+func TestBackendEncodeAndSimilarity(t *testing.T) {
+	v := []float64{0.5, -1, 0}
+	text, err := VSS{}.Encode(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "[0.5,-1,0]" {
+		t.Errorf("vss encoding = %v, want a JSON array", text)
+	}
+	blob, err := Vec{}.Encode(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, ok := blob.([]byte); !ok || len(b) != 12 {
+		t.Errorf("vec encoding = %v, want a 12-byte float32 blob", blob)
+	}
+	for _, b := range []Backend{VSS{}, Vec{}} {
+		if _, err := b.Encode([]float64{math.NaN()}); err == nil {
+			t.Errorf("%s encoded NaN", b.Name())
+		}
+	}
+
+	// identical unit vectors are at distance 0, opposite ones at squared
+	// distance 4 (vss) or distance 2 (vec)
+	if s := (VSS{}).Similarity(0); s != 1 {
+		t.Errorf("vss similarity at 0 = %v, want 1", s)
+	}
+	if s := (VSS{}).Similarity(4); s != -1 {
+		t.Errorf("vss similarity at 4 = %v, want -1", s)
+	}
+	if s := (Vec{}).Similarity(2); s != -1 {
+		t.Errorf("vec similarity at 2 = %v, want -1", s)
+	}
+}
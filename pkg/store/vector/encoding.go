@@ -0,0 +1,67 @@
+package vector
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// EncodeFloat32 packs an embedding as little-endian float32 values, the
+// compact blob format vector extensions accept. NaN, infinities and values
+// outside the float32 range are rejected.
+func EncodeFloat32(vec []float64) ([]byte, error) {
+	if err := checkFinite(vec); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 4*len(vec))
+	for i, v := range vec {
+		binary.LittleEndian.PutUint32(out[4*i:], math.Float32bits(float32(v)))
+	}
+	return out, nil
+}
+
+// DecodeFloat32 unpacks a blob written by EncodeFloat32.
+func DecodeFloat32(b []byte) ([]float64, error) {
+	if len(b)%4 != 0 {
+		return nil, fmt.Errorf("float32 blob length %d is not a multiple of 4", len(b))
+	}
+	out := make([]float64, len(b)/4)
+	for i := range out {
+		out[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:])))
+	}
+	return out, nil
+}
+
+// encodeJSON formats an embedding as a JSON array, for extensions that only
+// take vectors as text.
+func encodeJSON(vec []float64) (string, error) {
+	if err := checkFinite(vec); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.Grow(10 * len(vec))
+	b.WriteByte('[')
+	for i, v := range vec {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(v, 'g', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String(), nil
+}
+
+func checkFinite(vec []float64) error {
+	if len(vec) == 0 {
+		return errors.New("embedding is empty")
+	}
+	for i, v := range vec {
+		if math.IsNaN(v) || math.IsInf(v, 0) || math.Abs(v) > math.MaxFloat32 {
+			return fmt.Errorf("embedding value %d is not a finite float32: %v", i, v)
+		}
+	}
+	return nil
+}
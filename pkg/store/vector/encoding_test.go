@@ -0,0 +1,89 @@
+package vector
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestFloat32RoundTrip(t *testing.T) {
+	v := []float64{0.5, -1, 0, 1e-3, 3.14159, -math.MaxFloat32}
+	blob, err := EncodeFloat32(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blob) != 4*len(v) {
+		t.Fatalf("blob is %d bytes, want %d", len(blob), 4*len(v))
+	}
+	got, err := DecodeFloat32(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(v) {
+		t.Fatalf("decoded %d values, want %d", len(got), len(v))
+	}
+	for i := range v {
+		if got[i] != float64(float32(v[i])) {
+			t.Errorf("value %d = %v, want %v", i, got[i], float32(v[i]))
+		}
+	}
+}
+
+func TestFloat32Rejects(t *testing.T) {
+	for name, v := range map[string][]float64{
+		"empty":    nil,
+		"nan":      {1, math.NaN()},
+		"inf":      {math.Inf(-1)},
+		"overflow": {math.MaxFloat64},
+	} {
+		if _, err := EncodeFloat32(v); err == nil {
+			t.Errorf("%s: encoded %v", name, v)
+		}
+	}
+	if _, err := DecodeFloat32(make([]byte, 7)); err == nil {
+		t.Error("decoded a 7-byte blob")
+	}
+	if got, err := DecodeFloat32(nil); err != nil || len(got) != 0 {
+		t.Errorf("decode of an empty blob = %v, %v", got, err)
+	}
+}
+
+func benchmarkVector(n int) []float64 {
+	r := rand.New(rand.NewSource(1))
+	v := make([]float64, n)
+	for i := range v {
+		v[i] = r.Float64()*2 - 1
+	}
+	return v
+}
+
+func BenchmarkEncode(b *testing.B) {
+	v := benchmarkVector(1536)
+	b.Run("float32", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := EncodeFloat32(v); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("json", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := encodeJSON(v); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkDecodeFloat32(b *testing.B) {
+	blob, err := EncodeFloat32(benchmarkVector(1536))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(blob)))
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeFloat32(blob); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -3,45 +3,114 @@ package vector
 import (
 	"context"
 	"database/sql"
-	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"strings"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/model"
+	"github.com/johncui/PAIM/pkg/store/internal/logrow"
 )
 
-// Store wraps vector search operations using sqlite-vss.
+// slowQuery is the duration above which searches are logged as slow.
+const slowQuery = 250 * time.Millisecond
+
+// Store wraps vector search operations on a SQLite vector extension.
 type Store struct {
 	db      *sql.DB
+	reader  *sql.DB
 	enabled bool
 	dim     int
+	model   string
+	backend Backend
+	logger  *slog.Logger
 }
 
+// Config configures a Store.
+type Config struct {
+	Enabled bool
+	Dim     int
+	// Model names the embedding model of the vectors the store indexes;
+	// BuildIndexFromTable only loads embeddings computed by it (any model
+	// when empty).
+	Model string
+	// Backend is the extension dialect (default VSS).
+	Backend Backend
+	// Logger receives search timings at debug level and slow searches as
+	// warnings (default discards).
+	Logger *slog.Logger
+	// Reader serves searches, counts and probes; its connections must load
+	// the extension too (default the writer handle).
+	Reader *sql.DB
+}
+
+// New creates a store on the sqlite-vss backend.
 func New(db *sql.DB, enabled bool, dim int) *Store {
-	return &Store{db: db, enabled: enabled, dim: dim}
+	return NewWithBackend(db, enabled, dim, VSS{})
+}
+
+// NewWithBackend creates a store using the given extension backend.
+func NewWithBackend(db *sql.DB, enabled bool, dim int, backend Backend) *Store {
+	return NewWithConfig(db, Config{Enabled: enabled, Dim: dim, Backend: backend})
+}
+
+// NewWithConfig creates a store from cfg.
+func NewWithConfig(db *sql.DB, cfg Config) *Store {
+	if cfg.Backend == nil {
+		cfg.Backend = VSS{}
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	reader := cfg.Reader
+	if reader == nil {
+		reader = db
+	}
+	return &Store{db: db, reader: reader, enabled: cfg.Enabled, dim: cfg.Dim, model: cfg.Model, backend: cfg.Backend, logger: cfg.Logger}
 }
 
 func (s *Store) Enabled() bool { return s.enabled }
 
-// UpsertEmbedding stores an embedding linked to a memory log id.
+// Backend returns the extension backend in use.
+func (s *Store) Backend() Backend { return s.backend }
+
+// UpsertEmbedding stores an embedding linked to a memory log id, replacing any
+// embedding previously stored for that log. The payload records the log's
+// namespace so searches can tell hits of different namespaces apart.
 func (s *Store) UpsertEmbedding(ctx context.Context, logID string, embedding []float64) error {
 	if !s.enabled {
 		return nil
 	}
-	if len(embedding) == 0 {
-		return errors.New("embedding is empty")
+	if err := s.checkDim(embedding); err != nil {
+		return err
 	}
-	if s.dim > 0 && len(embedding) != s.dim {
-		return fmt.Errorf("embedding dimension mismatch: got %d want %d", len(embedding), s.dim)
+	vec, err := s.backend.Encode(embedding)
+	if err != nil {
+		return err
 	}
 
-	vec := toJSON(embedding)
-
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	res, err := tx.ExecContext(ctx, `INSERT INTO vss_memories(content_embedding) VALUES (json(?))`, vec)
+	if _, err := tx.ExecContext(ctx, s.backend.DeleteByLogSQL(), logID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM `+PayloadTable+` WHERE log_id = ?`, logID); err != nil {
+		return err
+	}
+	if err := s.insert(ctx, tx, logID, vec); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insert adds an encoded vector for a log that has none.
+func (s *Store) insert(ctx context.Context, tx *sql.Tx, logID string, vec any) error {
+	res, err := tx.ExecContext(ctx, s.backend.InsertSQL(), vec)
 	if err != nil {
 		return err
 	}
@@ -49,57 +118,337 @@ func (s *Store) UpsertEmbedding(ctx context.Context, logID string, embedding []f
 	if err != nil {
 		return err
 	}
-	if _, err := tx.ExecContext(ctx, `INSERT INTO vss_payload(rowid, log_id) VALUES (?, ?)`, rowID, logID); err != nil {
-		return err
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO `+PayloadTable+`(rowid, log_id, namespace)
+        VALUES (?, ?, COALESCE((SELECT namespace FROM memory_logs WHERE id = ?), 'default'))
+    `, rowID, logID, logID)
+	return err
+}
+
+// buildBatch is how many stored embeddings BuildIndexFromTable loads per
+// transaction.
+const buildBatch = 500
+
+// BuildIndexFromTable indexes the embeddings kept in EmbeddingsTable for
+// logs that have no vector yet, so enabling vector search does not require
+// re-embedding what was stored while it was off. Only embeddings of the
+// store's model and dimension are used; it returns how many were indexed.
+func (s *Store) BuildIndexFromTable(ctx context.Context) (int64, error) {
+	if !s.enabled {
+		return 0, nil
+	}
+	var total int64
+	for {
+		n, err := s.buildIndexBatch(ctx)
+		total += n
+		if err != nil || n < buildBatch {
+			return total, err
+		}
 	}
-	return tx.Commit()
 }
 
-// Search returns log ids ordered by vector similarity.
+func (s *Store) buildIndexBatch(ctx context.Context) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+        SELECT e.log_id, e.vector FROM `+EmbeddingsTable+` e
+        WHERE e.dim = ? AND (? = '' OR e.model = ?)
+          AND NOT EXISTS (SELECT 1 FROM `+PayloadTable+` p WHERE p.log_id = e.log_id)
+        LIMIT ?;
+    `, s.dim, s.model, s.model, buildBatch)
+	if err != nil {
+		return 0, err
+	}
+	type stored struct {
+		logID string
+		blob  []byte
+	}
+	var batch []stored
+	for rows.Next() {
+		var e stored
+		if err := rows.Scan(&e.logID, &e.blob); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, e)
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+	for _, e := range batch {
+		embedding, err := DecodeFloat32(e.blob)
+		if err != nil {
+			return 0, fmt.Errorf("stored embedding of log %s: %w", e.logID, err)
+		}
+		vec, err := s.backend.Encode(embedding)
+		if err != nil {
+			return 0, fmt.Errorf("stored embedding of log %s: %w", e.logID, err)
+		}
+		if err := s.insert(ctx, tx, e.logID, vec); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(batch)), tx.Commit()
+}
+
+// SearchHit is one nearest-neighbour result.
+type SearchHit struct {
+	LogID     string
+	Namespace string
+	Distance  float64
+}
+
+// Search returns log ids of every namespace ordered by vector similarity.
 func (s *Store) Search(ctx context.Context, embedding []float64, topK int) ([]string, error) {
+	hits, err := s.SearchWithScores(ctx, embedding, topK)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(hits))
+	for i, h := range hits {
+		ids[i] = h.LogID
+	}
+	return ids, nil
+}
+
+// SearchWithScores returns the nearest logs with their distances, nearest
+// first. Hits span all namespaces; callers filter on SearchHit.Namespace.
+func (s *Store) SearchWithScores(ctx context.Context, embedding []float64, topK int) ([]SearchHit, error) {
 	if !s.enabled {
 		return nil, nil
 	}
 	if topK <= 0 {
 		topK = 5
 	}
-	if s.dim > 0 && len(embedding) != s.dim {
-		return nil, fmt.Errorf("embedding dimension mismatch: got %d want %d", len(embedding), s.dim)
+	if err := s.checkDim(embedding); err != nil {
+		return nil, err
+	}
+	vec, err := s.backend.Encode(embedding)
+	if err != nil {
+		return nil, err
 	}
 
-	vec := toJSON(embedding)
-
-	rows, err := s.db.QueryContext(ctx, `
-        SELECT p.log_id
-        FROM vss_memories
-        JOIN vss_payload p ON p.rowid = vss_memories.rowid
-        WHERE content_embedding MATCH vss_search(json(?))
-        LIMIT ?;`, vec, topK)
+	start := time.Now()
+	rows, err := s.reader.QueryContext(ctx, s.backend.SearchSQL(), vec, topK)
 	if err != nil {
+		s.logger.Error("vector search failed", "top_k", topK, "err", err)
 		return nil, err
 	}
 	defer rows.Close()
 
-	var ids []string
+	var hits []SearchHit
 	for rows.Next() {
-		var id string
-		if err := rows.Scan(&id); err != nil {
+		var h SearchHit
+		if err := rows.Scan(&h.LogID, &h.Namespace, &h.Distance); err != nil {
 			return nil, err
 		}
-		ids = append(ids, id)
+		hits = append(hits, h)
 	}
-	return ids, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	logQuery(s.logger, "vector search", time.Since(start), "top_k", topK, "hits", len(hits))
+	return hits, nil
+}
+
+// LogResult is a SearchLogsWhere result.
+type LogResult struct {
+	// Hits are all the nearest neighbours found, nearest first, including
+	// those whose log is gone or failed the condition.
+	Hits []SearchHit
+	// Logs are the logs of the hits that matched, nearest first, and
+	// Distances their distances.
+	Logs      []model.LogEntry
+	Distances []float64
+}
+
+// SearchLogs returns the logs of every namespace nearest to embedding with
+// their distances, nearest first. The logs are joined to the index hits in
+// the search query itself; hits whose log is gone are skipped.
+func (s *Store) SearchLogs(ctx context.Context, embedding []float64, topK int) ([]model.LogEntry, []float64, error) {
+	res, err := s.SearchLogsWhere(ctx, embedding, topK, "", nil)
+	return res.Logs, res.Distances, err
 }
 
-func toJSON(vec []float64) string {
-	var b strings.Builder
-	b.WriteString("[")
-	for i, v := range vec {
-		if i > 0 {
-			b.WriteString(",")
+// SearchLogsWhere is SearchLogs keeping only the logs matching cond, SQL
+// conditions over memory_logs aliased as l, each prefixed with " AND ", as
+// sqlite.LogFilter.Where builds them. The condition applies to the topK
+// nearest hits, so fewer than topK logs may match; Hits tells a caller
+// whether searching wider can find more.
+func (s *Store) SearchLogsWhere(ctx context.Context, embedding []float64, topK int, cond string, args []any) (LogResult, error) {
+	var res LogResult
+	if !s.enabled {
+		return res, nil
+	}
+	if topK <= 0 {
+		topK = 5
+	}
+	if err := s.checkDim(embedding); err != nil {
+		return res, err
+	}
+	vec, err := s.backend.Encode(embedding)
+	if err != nil {
+		return res, err
+	}
+
+	search := strings.TrimSuffix(strings.TrimSpace(s.backend.SearchSQL()), ";")
+	query := `
+        SELECT h.log_id, h.namespace, h.distance, ` + logrow.Columns + `
+        FROM (` + search + `) h
+        LEFT JOIN memory_logs l ON l.id = h.log_id` + cond + `
+        ORDER BY h.distance;`
+	start := time.Now()
+	rows, err := s.reader.QueryContext(ctx, query, append([]any{vec, topK}, args...)...)
+	if err != nil {
+		s.logger.Error("vector search failed", "top_k", topK, "err", err)
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var h SearchHit
+		e, ok, err := logrow.Scan(rows, &h.LogID, &h.Namespace, &h.Distance)
+		if err != nil {
+			return res, err
+		}
+		res.Hits = append(res.Hits, h)
+		if ok {
+			res.Logs = append(res.Logs, e)
+			res.Distances = append(res.Distances, h.Distance)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return res, err
+	}
+	logQuery(s.logger, "vector search", time.Since(start), "top_k", topK, "hits", len(res.Hits), "logs", len(res.Logs))
+	return res, nil
+}
+
+// DeleteByLogID removes the vector stored for a log id, if any.
+func (s *Store) DeleteByLogID(ctx context.Context, logID string) error {
+	_, err := s.DeleteByLogIDs(ctx, []string{logID})
+	return err
+}
+
+// DeleteByLogIDs removes the vectors stored for the given log ids in one
+// transaction and returns how many were deleted. Every path that deletes
+// memory logs must call it (or DeleteOrphans) since vss_payload has no
+// foreign key to memory_logs.
+func (s *Store) DeleteByLogIDs(ctx context.Context, logIDs []string) (int64, error) {
+	if !s.enabled || len(logIDs) == 0 {
+		return 0, nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var deleted int64
+	for _, id := range logIDs {
+		if _, err := tx.ExecContext(ctx, s.backend.DeleteByLogSQL(), id); err != nil {
+			return 0, err
 		}
-		b.WriteString(fmt.Sprintf("%g", v))
+		res, err := tx.ExecContext(ctx, `DELETE FROM `+PayloadTable+` WHERE log_id = ?`, id)
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		deleted += n
+	}
+	return deleted, tx.Commit()
+}
+
+// DeleteOrphans removes vectors whose memory log no longer exists and returns
+// how many were deleted.
+func (s *Store) DeleteOrphans(ctx context.Context) (int64, error) {
+	if !s.enabled {
+		return 0, nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	const orphans = `SELECT rowid FROM ` + PayloadTable + ` WHERE log_id NOT IN (SELECT id FROM memory_logs)`
+	if _, err := tx.ExecContext(ctx, `DELETE FROM `+s.backend.Table()+` WHERE rowid IN (`+orphans+`);`); err != nil {
+		return 0, err
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM `+PayloadTable+` WHERE rowid IN (`+orphans+`);`)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// Clear removes every stored embedding.
+func (s *Store) Clear(ctx context.Context) error {
+	if !s.enabled {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, s.backend.ClearSQL()); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM `+PayloadTable+`;`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Count returns the number of stored embeddings (0 when disabled).
+func (s *Store) Count(ctx context.Context) (int64, error) {
+	if !s.enabled {
+		return 0, nil
+	}
+	var n int64
+	err := s.reader.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+PayloadTable+`;`).Scan(&n)
+	return n, err
+}
+
+// Ping checks that the vector table answers queries (nil when disabled).
+func (s *Store) Ping(ctx context.Context) error {
+	if !s.enabled {
+		return nil
+	}
+	rows, err := s.reader.QueryContext(ctx, s.backend.ProbeSQL())
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+func (s *Store) checkDim(embedding []float64) error {
+	if s.dim > 0 && len(embedding) != s.dim {
+		return fmt.Errorf("embedding dimension mismatch: got %d want %d", len(embedding), s.dim)
+	}
+	return nil
+}
+
+// logQuery logs a query's duration at debug level, or as a warning when it
+// was slow.
+func logQuery(logger *slog.Logger, msg string, d time.Duration, args ...any) {
+	args = append(args, "ms", d.Milliseconds())
+	if d >= slowQuery {
+		logger.Warn("slow "+msg, args...)
+		return
 	}
-	b.WriteString("]")
-	return b.String()
+	logger.Debug(msg, args...)
 }
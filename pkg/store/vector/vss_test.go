@@ -0,0 +1,393 @@
+package vector
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johncui/PAIM/pkg/store/internal/logrow"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// flat stands in for an extension backend with an ordinary table, so the
+// payload bookkeeping can be tested without sqlite-vss or sqlite-vec. The
+// "distance" of a vector is its rowid: earlier inserts are nearer.
+type flat struct{ Vec }
+
+func (flat) Table() string { return "flat_memories" }
+
+func (flat) Schema(int) []string {
+	return append([]string{`CREATE TABLE flat_memories (rowid INTEGER PRIMARY KEY, content_embedding BLOB);`}, payloadSchema()...)
+}
+
+func (flat) InsertSQL() string {
+	return `INSERT INTO flat_memories(content_embedding) VALUES (?)`
+}
+
+func (flat) DeleteByLogSQL() string {
+	return `DELETE FROM flat_memories WHERE rowid IN (SELECT rowid FROM ` + PayloadTable + ` WHERE log_id = ?)`
+}
+
+func (flat) SearchSQL() string {
+	return `
+        SELECT p.log_id, p.namespace, CAST(v.rowid AS REAL) AS distance
+        FROM flat_memories v JOIN ` + PayloadTable + ` p ON p.rowid = v.rowid
+        WHERE ? IS NOT NULL
+        ORDER BY v.rowid LIMIT ?;`
+}
+
+func (flat) ProbeSQL() string { return `SELECT rowid FROM flat_memories LIMIT 1;` }
+
+func (flat) ClearSQL() string { return `DELETE FROM flat_memories;` }
+
+// newFlatStore returns a store over an in-memory database holding a log and
+// its vector for each id.
+func newFlatStore(t testing.TB, logIDs ...string) (*Store, *sql.DB) {
+	t.Helper()
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	stmts := append(flat{}.Schema(2), `CREATE TABLE memory_logs (
+            id TEXT PRIMARY KEY, timestamp DATETIME, source_type TEXT, content TEXT, metadata JSON,
+            namespace TEXT NOT NULL DEFAULT 'default', session_id TEXT, last_accessed_at DATETIME,
+            access_count INTEGER NOT NULL DEFAULT 0, summarized_into TEXT, updated_at DATETIME
+        );`, `CREATE TABLE `+EmbeddingsTable+` (log_id TEXT PRIMARY KEY, model TEXT NOT NULL, dim INTEGER NOT NULL, vector BLOB NOT NULL);`)
+	for _, stmt := range stmts {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewWithConfig(db, Config{Enabled: true, Dim: 2, Backend: flat{}})
+	for _, id := range logIDs {
+		if _, err := db.ExecContext(ctx, `INSERT INTO memory_logs(id, content) VALUES (?, ?)`, id, "log "+id); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.UpsertEmbedding(ctx, id, []float64{1, 0}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s, db
+}
+
+func countRows(t testing.TB, db *sql.DB, table string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestUpsertEmbeddingReplaces(t *testing.T) {
+	s, db := newFlatStore(t, "a")
+	if err := s.UpsertEmbedding(context.Background(), "a", []float64{0, 1}); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, db, "flat_memories"); n != 1 {
+		t.Errorf("%d vectors after re-embedding a log, want 1", n)
+	}
+	if err := s.UpsertEmbedding(context.Background(), "a", []float64{1}); err == nil {
+		t.Error("stored an embedding of the wrong dimension")
+	}
+}
+
+func TestDeleteByLogIDs(t *testing.T) {
+	ctx := context.Background()
+	s, db := newFlatStore(t, "a", "b", "c")
+	n, err := s.DeleteByLogIDs(ctx, []string{"a", "c", "missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("deleted %d, want 2", n)
+	}
+	if err := s.DeleteByLogID(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if v, p := countRows(t, db, "flat_memories"), countRows(t, db, PayloadTable); v != 0 || p != 0 {
+		t.Errorf("%d vectors and %d payload rows left, want none", v, p)
+	}
+}
+
+func TestOrphanEmbeddings(t *testing.T) {
+	ctx := context.Background()
+	s, db := newFlatStore(t, "a", "b", "c")
+	// a log deleted without its vector, as older builds did
+	if _, err := db.Exec(`DELETE FROM memory_logs WHERE id = 'b'`); err != nil {
+		t.Fatal(err)
+	}
+
+	logs, distances, err := s.SearchLogs(ctx, []float64{1, 0}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, l := range logs {
+		ids = append(ids, l.ID)
+	}
+	if !slices.Equal(ids, []string{"a", "c"}) || len(distances) != 2 {
+		t.Errorf("search returned %q (distances %v), want a and c", ids, distances)
+	}
+
+	n, err := s.DeleteOrphans(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("deleted %d orphans, want 1", n)
+	}
+	hits, err := s.SearchWithScores(ctx, []float64{1, 0}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 2 || hits[0].LogID != "a" || hits[1].LogID != "c" {
+		t.Errorf("hits after deleting orphans = %+v, want a and c", hits)
+	}
+	if v := countRows(t, db, "flat_memories"); v != 2 {
+		t.Errorf("%d vectors left, want 2", v)
+	}
+}
+
+func TestDisabledStoreIsANoop(t *testing.T) {
+	ctx := context.Background()
+	s := New(nil, false, 2)
+	if err := s.UpsertEmbedding(ctx, "a", []float64{1, 0}); err != nil {
+		t.Error(err)
+	}
+	if n, err := s.DeleteByLogIDs(ctx, []string{"a"}); n != 0 || err != nil {
+		t.Errorf("DeleteByLogIDs = %d, %v", n, err)
+	}
+	if n, err := s.DeleteOrphans(ctx); n != 0 || err != nil {
+		t.Errorf("DeleteOrphans = %d, %v", n, err)
+	}
+	if hits, err := s.SearchWithScores(ctx, []float64{1, 0}, 3); hits != nil || err != nil {
+		t.Errorf("SearchHits = %v, %v", hits, err)
+	}
+}
+
+func TestHitsCarryTheLogNamespace(t *testing.T) {
+	ctx := context.Background()
+	s, db := newFlatStore(t, "a")
+	if _, err := db.Exec(`INSERT INTO memory_logs(id, content, namespace) VALUES ('w', 'log w', 'work')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpsertEmbedding(ctx, "w", []float64{0, 1}); err != nil {
+		t.Fatal(err)
+	}
+	hits, err := s.SearchWithScores(ctx, []float64{1, 0}, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, h := range hits {
+		got[h.LogID] = h.Namespace
+	}
+	if got["a"] != "default" || got["w"] != "work" {
+		t.Errorf("hit namespaces = %v, want a in default and w in work", got)
+	}
+}
+
+func TestBuildIndexFromTable(t *testing.T) {
+	ctx := context.Background()
+	_, db := newFlatStore(t, "indexed")
+	save := func(logID, model string, v []float64) {
+		t.Helper()
+		blob, err := EncodeFloat32(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(`INSERT INTO memory_logs(id, content) VALUES (?, 'x') ON CONFLICT DO NOTHING`, logID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(`INSERT INTO `+EmbeddingsTable+`(log_id, model, dim, vector) VALUES (?, ?, ?, ?)`, logID, model, len(v), blob); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save("indexed", "m", []float64{1, 0})
+	save("new", "m", []float64{0, 1})
+	save("other model", "m2", []float64{0, 1})
+	save("other dim", "m", []float64{0, 1, 0})
+
+	s := NewWithConfig(db, Config{Enabled: true, Dim: 2, Model: "m", Backend: flat{}})
+	n, err := s.BuildIndexFromTable(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("indexed %d stored embeddings, want only the unindexed one of model m", n)
+	}
+	if n, err := s.BuildIndexFromTable(ctx); err != nil || n != 0 {
+		t.Errorf("second build indexed %d, %v; want nothing", n, err)
+	}
+	hits, err := s.SearchWithScores(ctx, []float64{1, 0}, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, h := range hits {
+		ids = append(ids, h.LogID)
+	}
+	if !slices.Equal(ids, []string{"indexed", "new"}) {
+		t.Errorf("searchable logs = %q, want indexed and new", ids)
+	}
+
+	if n, err := NewWithConfig(db, Config{Enabled: true, Dim: 2, Backend: flat{}}).BuildIndexFromTable(ctx); err != nil || n != 1 {
+		t.Errorf("build without a model indexed %d, %v; want the other model's embedding", n, err)
+	}
+	if n, err := New(db, false, 2).BuildIndexFromTable(ctx); err != nil || n != 0 {
+		t.Errorf("disabled store indexed %d, %v", n, err)
+	}
+}
+
+func TestBuildIndexFromTableInBatches(t *testing.T) {
+	ctx := context.Background()
+	_, db := newFlatStore(t)
+	blob, err := EncodeFloat32([]float64{1, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := buildBatch + 3
+	for i := 0; i < total; i++ {
+		id := fmt.Sprintf("log-%d", i)
+		if _, err := db.Exec(`INSERT INTO memory_logs(id, content) VALUES (?, 'x')`, id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(`INSERT INTO `+EmbeddingsTable+`(log_id, model, dim, vector) VALUES (?, 'm', 2, ?)`, id, blob); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewWithConfig(db, Config{Enabled: true, Dim: 2, Backend: flat{}})
+	if n, err := s.BuildIndexFromTable(ctx); err != nil || n != int64(total) {
+		t.Errorf("BuildIndexFromTable = %d, %v; want %d", n, err, total)
+	}
+	if got := countRows(t, db, PayloadTable); got != total {
+		t.Errorf("%d payload rows, want %d", got, total)
+	}
+}
+
+// addLog stores a log and its vector; flat ranks it after the logs added
+// before it.
+func addLog(t testing.TB, s *Store, db *sql.DB, id, namespace, metadata string) {
+	t.Helper()
+	if _, err := db.Exec(`INSERT INTO memory_logs(id, timestamp, source_type, content, metadata, namespace, session_id, access_count)
+        VALUES (?, ?, 'note', ?, ?, ?, 'chat-1', 3)`, id, time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC), "log "+id, metadata, namespace); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpsertEmbedding(context.Background(), id, []float64{1, 0}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSearchLogsJoinsHitsToLogs(t *testing.T) {
+	ctx := context.Background()
+	s, db := newFlatStore(t)
+	addLog(t, s, db, "c", "default", `{"room":"A","floor":2}`)
+	addLog(t, s, db, "gone", "default", "")
+	addLog(t, s, db, "a", "default", "")
+	addLog(t, s, db, "w", "work", "")
+	addLog(t, s, db, "b", "default", `{"tags":["x"]}`)
+	if _, err := db.Exec(`DELETE FROM memory_logs WHERE id = 'gone'`); err != nil {
+		t.Fatal(err)
+	}
+
+	logs, distances, err := s.SearchLogs(ctx, []float64{1, 0}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, l := range logs {
+		ids = append(ids, l.ID)
+	}
+	// in rank order, not id order, without the deleted log
+	if !slices.Equal(ids, []string{"c", "a", "w", "b"}) || !slices.Equal(distances, []float64{1, 3, 4, 5}) {
+		t.Fatalf("SearchLogs = %q at %v, want c, a, w, b nearest first", ids, distances)
+	}
+	c := logs[0]
+	if c.Content != "log c" || c.SourceType != "note" || c.Namespace != "default" || c.SessionID != "chat-1" || c.AccessCount != 3 ||
+		!c.Timestamp.Equal(time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("log c = %+v", c)
+	}
+	if c.Metadata["room"] != "A" || c.Metadata["floor"] != 2.0 {
+		t.Errorf("log c metadata = %v, want room A on floor 2", c.Metadata)
+	}
+	if tags, ok := logs[3].Metadata["tags"].([]any); !ok || len(tags) != 1 || tags[0] != "x" {
+		t.Errorf("log b metadata = %v, want tags [x]", logs[3].Metadata)
+	}
+	if logs[1].Metadata != nil {
+		t.Errorf("log a metadata = %v, want none", logs[1].Metadata)
+	}
+
+	res, err := s.SearchLogsWhere(ctx, []float64{1, 0}, 3, " AND l.namespace = ?", []any{"default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids = ids[:0]
+	for _, l := range res.Logs {
+		ids = append(ids, l.ID)
+	}
+	if len(res.Hits) != 3 || res.Hits[1].LogID != "gone" || !slices.Equal(ids, []string{"c", "a"}) || !slices.Equal(res.Distances, []float64{1, 3}) {
+		t.Errorf("SearchLogsWhere = %d hits, logs %q at %v; want 3 hits and c, a", len(res.Hits), ids, res.Distances)
+	}
+
+	if logs, _, err := New(db, false, 2).SearchLogs(ctx, []float64{1, 0}, 3); logs != nil || err != nil {
+		t.Errorf("disabled SearchLogs = %v, %v", logs, err)
+	}
+	if _, _, err := s.SearchLogs(ctx, []float64{1}, 3); err == nil {
+		t.Error("searched with an embedding of the wrong dimension")
+	}
+}
+
+// BenchmarkSearchLogs compares the joined search with searching the index
+// and then fetching the logs of the hits in a second query, as recall did
+// before.
+func BenchmarkSearchLogs(b *testing.B) {
+	ctx := context.Background()
+	s, db := newFlatStore(b)
+	for i := 0; i < 1000; i++ {
+		addLog(b, s, db, fmt.Sprintf("log-%04d", i), "default", `{"room":"A"}`)
+	}
+	emb := []float64{1, 0}
+	const topK = 20
+	b.Run("join", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if logs, _, err := s.SearchLogs(ctx, emb, topK); err != nil || len(logs) != topK {
+				b.Fatal(len(logs), err)
+			}
+		}
+	})
+	b.Run("two queries", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			hits, err := s.SearchWithScores(ctx, emb, topK)
+			if err != nil {
+				b.Fatal(err)
+			}
+			ids := make([]any, len(hits))
+			for j, h := range hits {
+				ids[j] = h.LogID
+			}
+			rows, err := db.QueryContext(ctx, `SELECT `+logrow.Columns+` FROM memory_logs l WHERE l.id IN (?`+strings.Repeat(",?", len(ids)-1)+`)`, ids...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			n := 0
+			for rows.Next() {
+				if _, _, err := logrow.Scan(rows); err != nil {
+					b.Fatal(err)
+				}
+				n++
+			}
+			rows.Close()
+			if n != topK {
+				b.Fatalf("fetched %d logs", n)
+			}
+		}
+	})
+}